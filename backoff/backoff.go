@@ -0,0 +1,167 @@
+// Package backoff provides strategies of delays between retries, shared by Pub/Sub implementations
+// for re-connecting, creating topics and publishing.
+package backoff
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Strategy returns the delay before the retry.
+//
+// Strategy should be stateless (the attempt number is passed to Next), so a single Strategy can be shared
+// by many concurrent retry loops.
+type Strategy interface {
+	// Next returns the delay before the attempt, starting from 1 for the first retry.
+	// When false is returned, there should be no more retries.
+	Next(attempt int) (delay time.Duration, ok bool)
+}
+
+// StrategyFunc allows to use a function as Strategy.
+type StrategyFunc func(attempt int) (time.Duration, bool)
+
+func (f StrategyFunc) Next(attempt int) (time.Duration, bool) {
+	return f(attempt)
+}
+
+// Constant retries forever with the same delay.
+func Constant(delay time.Duration) Strategy {
+	return StrategyFunc(func(attempt int) (time.Duration, bool) {
+		return delay, true
+	})
+}
+
+// Exponential retries forever, multiplying the delay by Multiplier after every attempt.
+type Exponential struct {
+	// Initial is the delay before the first retry.
+	Initial time.Duration
+	// Max is the maximum delay. When 0, the delay is not limited.
+	Max time.Duration
+	// Multiplier defaults to 2.
+	Multiplier float64
+}
+
+func (e Exponential) Next(attempt int) (time.Duration, bool) {
+	multiplier := e.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(e.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if e.Max > 0 && delay > float64(e.Max) {
+		return e.Max, true
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64), true
+	}
+
+	return time.Duration(delay), true
+}
+
+// Jitter randomizes delays of the strategy by up to ±factor (from 0 to 1) of the delay,
+// so many instances don't retry at the same time.
+func Jitter(strategy Strategy, factor float64) Strategy {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomLock := sync.Mutex{}
+
+	return StrategyFunc(func(attempt int) (time.Duration, bool) {
+		delay, ok := strategy.Next(attempt)
+		if !ok {
+			return 0, false
+		}
+
+		randomLock.Lock()
+		r := random.Float64()
+		randomLock.Unlock()
+
+		delta := factor * float64(delay)
+
+		return time.Duration(float64(delay) - delta + r*2*delta), true
+	})
+}
+
+// MaxAttempts limits the strategy to maxRetries retries.
+func MaxAttempts(strategy Strategy, maxRetries int) Strategy {
+	return StrategyFunc(func(attempt int) (time.Duration, bool) {
+		if attempt > maxRetries {
+			return 0, false
+		}
+		return strategy.Next(attempt)
+	})
+}
+
+// Budget stops retrying, when the sum of all delays would exceed the budget.
+//
+// The sum is calculated by calling strategy for all previous attempts,
+// so Budget should wrap a deterministic strategy, for example Jitter(Budget(Exponential{...}, time.Minute), 0.2).
+func Budget(strategy Strategy, budget time.Duration) Strategy {
+	return StrategyFunc(func(attempt int) (time.Duration, bool) {
+		var total time.Duration
+		var delay time.Duration
+
+		for i := 1; i <= attempt; i++ {
+			var ok bool
+			delay, ok = strategy.Next(i)
+			if !ok {
+				return 0, false
+			}
+
+			total += delay
+			if total > budget || total < 0 {
+				return 0, false
+			}
+		}
+
+		return delay, true
+	})
+}
+
+// Wait waits for the delay before the attempt. It returns false, when there should be no more retries.
+// The error is returned, when ctx was canceled.
+func Wait(ctx context.Context, strategy Strategy, attempt int) (bool, error) {
+	delay, ok := strategy.Next(attempt)
+	if !ok {
+		return false, nil
+	}
+
+	if delay <= 0 {
+		return true, ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Retry calls fn, until it succeeds, the strategy stops retrying or ctx is canceled.
+// The last error of fn is returned.
+func Retry(ctx context.Context, strategy Strategy, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		retry, waitErr := Wait(ctx, strategy, attempt)
+		if waitErr != nil {
+			return errors.Wrapf(err, "retrying interrupted: %s", waitErr)
+		}
+		if !retry {
+			return err
+		}
+	}
+}
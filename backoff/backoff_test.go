@@ -0,0 +1,107 @@
+package backoff_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/backoff"
+)
+
+func delays(strategy backoff.Strategy, attempts int) []time.Duration {
+	var result []time.Duration
+	for i := 1; i <= attempts; i++ {
+		delay, ok := strategy.Next(i)
+		if !ok {
+			break
+		}
+		result = append(result, delay)
+	}
+	return result
+}
+
+func TestConstant(t *testing.T) {
+	assert.Equal(
+		t,
+		[]time.Duration{time.Second, time.Second, time.Second},
+		delays(backoff.Constant(time.Second), 3),
+	)
+}
+
+func TestExponential(t *testing.T) {
+	strategy := backoff.Exponential{Initial: time.Second, Max: time.Second * 5}
+
+	assert.Equal(
+		t,
+		[]time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5},
+		delays(strategy, 5),
+	)
+}
+
+func TestExponential_no_max_overflow(t *testing.T) {
+	delay, ok := backoff.Exponential{Initial: time.Second}.Next(1000)
+	assert.True(t, ok)
+	assert.True(t, delay > 0)
+}
+
+func TestJitter(t *testing.T) {
+	strategy := backoff.Jitter(backoff.Constant(time.Second), 0.5)
+
+	for _, delay := range delays(strategy, 100) {
+		assert.True(t, delay >= time.Millisecond*500 && delay <= time.Millisecond*1500, "unexpected delay %s", delay)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	assert.Len(t, delays(backoff.MaxAttempts(backoff.Constant(time.Second), 3), 10), 3)
+}
+
+func TestBudget(t *testing.T) {
+	strategy := backoff.Budget(backoff.Exponential{Initial: time.Second}, time.Second*10)
+
+	// 1 + 2 + 4 = 7, next 8 exceeds the budget
+	assert.Equal(t, []time.Duration{time.Second, time.Second * 2, time.Second * 4}, delays(strategy, 10))
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	err := backoff.Retry(context.Background(), backoff.Constant(time.Millisecond), func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetry_gives_up(t *testing.T) {
+	calls := 0
+	err := backoff.Retry(context.Background(), backoff.MaxAttempts(backoff.Constant(0), 2), func() error {
+		calls++
+		return errors.New("failed")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetry_context_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := backoff.Retry(ctx, backoff.Constant(time.Hour), func() error {
+		calls++
+		return errors.New("failed")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
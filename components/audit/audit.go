@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Result is the result of the handler execution.
+type Result string
+
+const (
+	ResultSuccess Result = "success"
+	ResultError   Result = "error"
+)
+
+// Record describes a single execution of the handler.
+type Record struct {
+	MessageUUID string `json:"message_uuid"`
+	Topic       string `json:"topic"`
+	HandlerName string `json:"handler_name"`
+
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+
+	Result Result `json:"result"`
+	Error  string `json:"error,omitempty"`
+
+	// ProducedMessages are UUIDs of the messages returned by the handler.
+	ProducedMessages []string `json:"produced_messages,omitempty"`
+}
+
+// Sink stores the audit records.
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+type Config struct {
+	// Sink stores the audit records.
+	Sink Sink
+
+	// SampleRate is the fraction (0, 1] of handler executions which are recorded. Defaults to 1 (all executions).
+	SampleRate float64
+
+	// SampleErrors enables sampling of failed handler executions.
+	// When false, failed executions are always recorded, regardless of SampleRate.
+	SampleErrors bool
+
+	// FailOnSinkError makes the handler fail (and the message nacked), when the record cannot be written to the Sink.
+	// When false, the error is only logged.
+	FailOnSinkError bool
+
+	// RandSource is the source of randomness used for sampling. Defaults to a time-seeded source.
+	RandSource rand.Source
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.SampleRate == 0 {
+		c.SampleRate = 1
+	}
+	if c.RandSource == nil {
+		c.RandSource = rand.NewSource(time.Now().UnixNano())
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Sink == nil {
+		return errors.New("missing Sink")
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return errors.Errorf("SampleRate must be in (0, 1] range, got %f", c.SampleRate)
+	}
+
+	return nil
+}
+
+// Auditor provides a middleware which writes an audit record of every handler execution to the Sink,
+// so it is possible to reconstruct what happened to any message.
+type Auditor struct {
+	config Config
+
+	rand     *rand.Rand
+	randLock sync.Mutex
+}
+
+func NewAuditor(config Config) (*Auditor, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Auditor config")
+	}
+
+	return &Auditor{
+		config: config,
+		rand:   rand.New(config.RandSource),
+	}, nil
+}
+
+func (a *Auditor) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		ctx := msg.Context()
+		startedAt := time.Now()
+
+		producedMessages, err := h(msg)
+
+		record := Record{
+			MessageUUID: msg.UUID,
+			Topic:       message.SubscribeTopicFromCtx(ctx),
+			HandlerName: message.HandlerNameFromCtx(ctx),
+			StartedAt:   startedAt,
+			Duration:    time.Since(startedAt),
+			Result:      ResultSuccess,
+		}
+		if err != nil {
+			record.Result = ResultError
+			record.Error = err.Error()
+		}
+		for _, producedMsg := range producedMessages {
+			record.ProducedMessages = append(record.ProducedMessages, producedMsg.UUID)
+		}
+
+		if !a.sampled(record) {
+			return producedMessages, err
+		}
+
+		if sinkErr := a.config.Sink.Write(ctx, record); sinkErr != nil {
+			if a.config.FailOnSinkError && err == nil {
+				return nil, errors.Wrap(sinkErr, "cannot write audit record")
+			}
+
+			a.config.Logger.Error("Cannot write audit record", sinkErr, watermill.LogFields{
+				"message_uuid": msg.UUID,
+				"handler_name": record.HandlerName,
+			})
+		}
+
+		return producedMessages, err
+	}
+}
+
+func (a *Auditor) sampled(record Record) bool {
+	if a.config.SampleRate >= 1 {
+		return true
+	}
+	if record.Result == ResultError && !a.config.SampleErrors {
+		return true
+	}
+
+	a.randLock.Lock()
+	defer a.randLock.Unlock()
+
+	return a.rand.Float64() < a.config.SampleRate
+}
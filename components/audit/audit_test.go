@@ -0,0 +1,149 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/audit"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+)
+
+type memorySink struct {
+	records []audit.Record
+	lock    sync.Mutex
+}
+
+func (s *memorySink) Write(ctx context.Context, record audit.Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *memorySink) Records() []audit.Record {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]audit.Record{}, s.records...)
+}
+
+type channelSink chan audit.Record
+
+func (s channelSink) Write(ctx context.Context, record audit.Record) error {
+	s <- record
+	return nil
+}
+
+func TestAuditor_router(t *testing.T) {
+	logger := watermill.NewStdLogger(false, false)
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, logger)
+	sink := make(channelSink, 1)
+
+	auditor, err := audit.NewAuditor(audit.Config{Sink: sink})
+	require.NoError(t, err)
+
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	require.NoError(t, err)
+	router.AddMiddleware(auditor.Middleware)
+
+	router.AddNoPublisherHandler("audited_handler", "audited_topic", pubSub, func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	})
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		require.NoError(t, router.Close())
+	}()
+	<-router.Running()
+
+	require.NoError(t, pubSub.Publish("audited_topic", message.NewMessage("1", nil)))
+
+	var record audit.Record
+	select {
+	case record = <-sink:
+	case <-time.After(time.Second):
+		t.Fatal("audit record not written")
+	}
+
+	assert.Equal(t, "1", record.MessageUUID)
+	assert.Equal(t, "audited_topic", record.Topic)
+	assert.Equal(t, "audited_handler", record.HandlerName)
+	assert.Equal(t, audit.ResultSuccess, record.Result)
+	assert.Empty(t, record.Error)
+}
+
+func TestAuditor_sampling(t *testing.T) {
+	sink := &memorySink{}
+
+	auditor, err := audit.NewAuditor(audit.Config{
+		Sink:       sink,
+		SampleRate: 0.1,
+		RandSource: rand.NewSource(1),
+	})
+	require.NoError(t, err)
+
+	h := auditor.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		if msg.UUID == "failing" {
+			return nil, errors.New("failed")
+		}
+		return []*message.Message{message.NewMessage("produced", nil)}, nil
+	})
+
+	for i := 0; i < 100; i++ {
+		_, err := h(message.NewMessage("ok", nil))
+		require.NoError(t, err)
+	}
+	_, err = h(message.NewMessage("failing", nil))
+	require.Error(t, err)
+
+	records := sink.Records()
+	assert.True(t, len(records) > 1 && len(records) < 50, "only some of the executions should be recorded")
+
+	failed := records[len(records)-1]
+	assert.Equal(t, audit.ResultError, failed.Result)
+	assert.Equal(t, "failed", failed.Error)
+
+	assert.Equal(t, []string{"produced"}, records[0].ProducedMessages)
+}
+
+func TestAuditor_missing_sink(t *testing.T) {
+	_, err := audit.NewAuditor(audit.Config{})
+	assert.Error(t, err)
+}
+
+func TestWriterSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := audit.NewWriterSink(buf)
+
+	record := audit.Record{
+		MessageUUID: "1",
+		Topic:       "topic",
+		HandlerName: "handler",
+		StartedAt:   time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Duration:    time.Millisecond,
+		Result:      audit.ResultSuccess,
+	}
+	require.NoError(t, sink.Write(context.Background(), record))
+	require.NoError(t, sink.Write(context.Background(), record))
+
+	decoder := json.NewDecoder(buf)
+	for i := 0; i < 2; i++ {
+		var written audit.Record
+		require.NoError(t, decoder.Decode(&written))
+		assert.Equal(t, record, written)
+	}
+}
@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/components/sqlutil"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// PublisherSink publishes the audit records as JSON messages to the topic.
+type PublisherSink struct {
+	publisher message.Publisher
+	topic     string
+}
+
+func NewPublisherSink(publisher message.Publisher, topic string) (*PublisherSink, error) {
+	if publisher == nil {
+		return nil, errors.New("missing publisher")
+	}
+	if topic == "" {
+		return nil, errors.New("missing topic")
+	}
+
+	return &PublisherSink{publisher, topic}, nil
+}
+
+func (s *PublisherSink) Write(ctx context.Context, record Record) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal record")
+	}
+
+	return s.publisher.Publish(s.topic, message.NewMessageWithGeneratedUUID(payload))
+}
+
+// WriterSink writes the audit records as JSON lines to the writer, for example to a file.
+type WriterSink struct {
+	writer io.Writer
+	lock   sync.Mutex
+}
+
+func NewWriterSink(writer io.Writer) *WriterSink {
+	return &WriterSink{writer: writer}
+}
+
+func (s *WriterSink) Write(ctx context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal record")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err = s.writer.Write(append(line, '\n'))
+	return errors.Wrap(err, "cannot write record")
+}
+
+type SQLSinkConfig struct {
+	// DB is the database with the audit table.
+	//
+	// The table needs to have the following columns:
+	//
+	//	message_uuid       VARCHAR(36) NOT NULL
+	//	topic              VARCHAR(255) NOT NULL
+	//	handler_name       VARCHAR(255) NOT NULL
+	//	started_at         TIMESTAMP NOT NULL
+	//	duration_ns        BIGINT NOT NULL
+	//	result             VARCHAR(16) NOT NULL
+	//	error              TEXT NOT NULL
+	//	produced_messages  TEXT NOT NULL
+	DB *sql.DB
+
+	// Table is the name of the audit table. Defaults to "audit_records".
+	Table string
+
+	// Placeholder of the query arguments. Defaults to sqlutil.QuestionMarkPlaceholder,
+	// use sqlutil.DollarPlaceholder for PostgreSQL.
+	Placeholder sqlutil.Placeholder
+}
+
+func (c *SQLSinkConfig) setDefaults() {
+	if c.Table == "" {
+		c.Table = "audit_records"
+	}
+	if c.Placeholder == nil {
+		c.Placeholder = sqlutil.QuestionMarkPlaceholder
+	}
+}
+
+func (c SQLSinkConfig) validate() error {
+	if c.DB == nil {
+		return errors.New("missing DB")
+	}
+
+	return nil
+}
+
+// SQLSink inserts the audit records to a SQL database.
+// It works with any database/sql driver.
+type SQLSink struct {
+	config SQLSinkConfig
+	query  string
+}
+
+func NewSQLSink(config SQLSinkConfig) (*SQLSink, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid SQLSink config")
+	}
+
+	return &SQLSink{
+		config: config,
+		query: fmt.Sprintf(
+			"INSERT INTO %s "+
+				"(message_uuid, topic, handler_name, started_at, duration_ns, result, error, produced_messages) "+
+				"VALUES (%s)",
+			config.Table, config.Placeholder.List(8),
+		),
+	}, nil
+}
+
+func (s *SQLSink) Write(ctx context.Context, record Record) error {
+	producedMessages, err := json.Marshal(record.ProducedMessages)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal produced messages")
+	}
+
+	_, err = s.config.DB.ExecContext(
+		ctx,
+		s.query,
+		record.MessageUUID,
+		record.Topic,
+		record.HandlerName,
+		record.StartedAt,
+		record.Duration.Nanoseconds(),
+		string(record.Result),
+		record.Error,
+		string(producedMessages),
+	)
+	return errors.Wrap(err, "cannot insert audit record")
+}
@@ -8,7 +8,12 @@ import (
 )
 
 type JSONMarshaler struct {
+	// NewUUID generates UUIDs of the messages. Defaults to watermill.NewMessageUUID.
 	NewUUID func() string
+
+	// GenerateName generates the name of the command or event. Defaults to ObjectName.
+	// StructName, FullyQualifiedStructName or VersionedName can be used as well.
+	GenerateName func(v interface{}) string
 }
 
 func (m JSONMarshaler) Marshal(v interface{}) (*message.Message, error) {
@@ -32,7 +37,7 @@ func (m JSONMarshaler) newUUID() string {
 	}
 
 	// default
-	return watermill.NewUUID()
+	return watermill.NewMessageUUID()
 }
 
 func (JSONMarshaler) Unmarshal(msg *message.Message, v interface{}) (err error) {
@@ -40,6 +45,10 @@ func (JSONMarshaler) Unmarshal(msg *message.Message, v interface{}) (err error)
 }
 
 func (m JSONMarshaler) Name(cmdOrEvent interface{}) string {
+	if m.GenerateName != nil {
+		return m.GenerateName(cmdOrEvent)
+	}
+
 	return ObjectName(cmdOrEvent)
 }
 
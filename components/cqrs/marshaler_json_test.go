@@ -28,3 +28,13 @@ func TestJsonMarshaler(t *testing.T) {
 
 	assert.EqualValues(t, eventToMarshal, eventToUnmarshal)
 }
+
+func TestJsonMarshaler_GenerateName(t *testing.T) {
+	marshaler := cqrs.JSONMarshaler{GenerateName: cqrs.StructName}
+
+	msg, err := marshaler.Marshal(&TestEvent{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "TestEvent", marshaler.Name(TestEvent{}))
+	assert.Equal(t, "TestEvent", marshaler.NameFromMessage(msg))
+}
@@ -11,7 +11,12 @@ import (
 )
 
 type ProtobufMarshaler struct {
+	// NewUUID generates UUIDs of the messages. Defaults to watermill.NewMessageUUID.
 	NewUUID func() string
+
+	// GenerateName generates the name of the command or event. Defaults to ObjectName.
+	// StructName, FullyQualifiedStructName or VersionedName can be used as well.
+	GenerateName func(v interface{}) string
 }
 
 type NoProtoMessageError struct {
@@ -53,7 +58,7 @@ func (m ProtobufMarshaler) newUUID() string {
 	}
 
 	// default
-	return watermill.NewUUID()
+	return watermill.NewMessageUUID()
 }
 
 func (ProtobufMarshaler) Unmarshal(msg *message.Message, v interface{}) (err error) {
@@ -61,6 +66,10 @@ func (ProtobufMarshaler) Unmarshal(msg *message.Message, v interface{}) (err err
 }
 
 func (m ProtobufMarshaler) Name(cmdOrEvent interface{}) string {
+	if m.GenerateName != nil {
+		return m.GenerateName(cmdOrEvent)
+	}
+
 	return ObjectName(cmdOrEvent)
 }
 
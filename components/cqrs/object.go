@@ -3,6 +3,7 @@ package cqrs
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -24,9 +25,59 @@ func (e NonPointerError) Error() string {
 	return "non-pointer command: " + e.Type.String() + ", handler.NewCommand() should return pointer to the command"
 }
 
+// ObjectName returns the name of the object's type with the package name, for example "events.OrderPlaced".
+// It is the default name of commands and events.
 func ObjectName(v interface{}) string {
 	s := fmt.Sprintf("%T", v)
 	s = strings.TrimLeft(s, "*")
 
 	return s
 }
+
+// StructName returns the name of the object's type without the package name, for example "OrderPlaced".
+func StructName(v interface{}) string {
+	return objectType(v).Name()
+}
+
+// FullyQualifiedStructName returns the name of the object's type with the full package path,
+// for example "github.com/company/project/events.OrderPlaced".
+func FullyQualifiedStructName(v interface{}) string {
+	t := objectType(v)
+	if t.PkgPath() == "" {
+		return t.String()
+	}
+
+	return t.PkgPath() + "." + t.Name()
+}
+
+func objectType(v interface{}) reflect.Type {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// Versioned is implemented by commands and events, which have multiple versions of the schema.
+type Versioned interface {
+	// SchemaVersion returns the version of the command's or event's schema.
+	SchemaVersion() int
+}
+
+// VersionedName wraps generateName, so the schema version of Versioned objects is appended to the name,
+// for example "events.OrderPlaced.v2".
+//
+// Every version has a different name, so handlers of the old and the new versions of the event can work side by side,
+// when the schema evolves.
+func VersionedName(generateName func(v interface{}) string) func(v interface{}) string {
+	return func(v interface{}) string {
+		name := generateName(v)
+
+		if versioned, ok := v.(Versioned); ok {
+			name += ".v" + strconv.Itoa(versioned.SchemaVersion())
+		}
+
+		return name
+	}
+}
@@ -14,6 +14,34 @@ func TestObjectName(t *testing.T) {
 	assert.Equal(t, "cqrs_test.Object", cqrs.ObjectName(&Object{}))
 }
 
+func TestStructName(t *testing.T) {
+	type Object struct{}
+
+	assert.Equal(t, "Object", cqrs.StructName(Object{}))
+	assert.Equal(t, "Object", cqrs.StructName(&Object{}))
+}
+
+func TestFullyQualifiedStructName(t *testing.T) {
+	type Object struct{}
+
+	assert.Equal(t, "github.com/ThreeDotsLabs/watermill/components/cqrs_test.Object", cqrs.FullyQualifiedStructName(&Object{}))
+}
+
+type versionedObject struct{}
+
+func (versionedObject) SchemaVersion() int {
+	return 2
+}
+
+func TestVersionedName(t *testing.T) {
+	type Object struct{}
+
+	generateName := cqrs.VersionedName(cqrs.StructName)
+
+	assert.Equal(t, "Object", generateName(Object{}))
+	assert.Equal(t, "versionedObject.v2", generateName(versionedObject{}))
+}
+
 func BenchmarkObjectName(b *testing.B) {
 	type Object struct{}
 	o := Object{}
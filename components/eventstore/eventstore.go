@@ -0,0 +1,196 @@
+package eventstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// StreamIDMetadataKey is the metadata key with the ID of the stream to which the event belongs.
+	StreamIDMetadataKey = "stream_id"
+	// StreamVersionMetadataKey is the metadata key with the version of the stream after appending the event.
+	StreamVersionMetadataKey = "stream_version"
+)
+
+const (
+	// AnyVersion disables the optimistic concurrency check when appending to a stream.
+	AnyVersion = -1
+	// NoStream is the expected version of a stream which doesn't exist yet.
+	NoStream = 0
+)
+
+// WrongExpectedVersionError happens when the stream was modified concurrently
+// and its version is not equal to the expected version.
+type WrongExpectedVersionError struct {
+	StreamID        string
+	ExpectedVersion int
+	ActualVersion   int
+}
+
+func (e WrongExpectedVersionError) Error() string {
+	return fmt.Sprintf(
+		"wrong expected version of stream %s: expected %d, actual %d",
+		e.StreamID, e.ExpectedVersion, e.ActualVersion,
+	)
+}
+
+// Storage persists the events of the streams.
+type Storage interface {
+	// Append stores the events at the end of the stream.
+	// Storage is responsible for setting the versions of the events with SetStreamVersions.
+	//
+	// When expectedVersion is not AnyVersion and the current version of the stream is different,
+	// Append must return WrongExpectedVersionError and store no events.
+	Append(ctx context.Context, streamID string, expectedVersion int, events []*message.Message) error
+
+	// Read returns the events of the stream, starting from fromVersion (inclusive).
+	Read(ctx context.Context, streamID string, fromVersion int) ([]*message.Message, error)
+
+	// ReadAll returns the events of all streams, in the order in which they were appended.
+	ReadAll(ctx context.Context) ([]*message.Message, error)
+}
+
+type Config struct {
+	// Storage persists the events.
+	Storage Storage
+
+	// Publisher publishes appended events to Topic, so they can be consumed by projections.
+	Publisher message.Publisher
+	Topic     string
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Storage == nil {
+		return errors.New("missing Storage")
+	}
+	if c.Publisher == nil {
+		return errors.New("missing Publisher")
+	}
+	if c.Topic == "" {
+		return errors.New("missing Topic")
+	}
+
+	return nil
+}
+
+// EventStore stores events in streams and publishes them to the Pub/Sub.
+//
+// Events are Watermill's messages, so any marshaler (for example cqrs.CommandEventMarshaler) can be used to create them.
+type EventStore struct {
+	config Config
+}
+
+func NewEventStore(config Config) (*EventStore, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	return &EventStore{config}, nil
+}
+
+// AppendToStream appends events to the stream and publishes them to the configured topic.
+//
+// expectedVersion is the version of the stream known by the caller (the number of events in the stream).
+// When the stream was modified in the meantime, WrongExpectedVersionError is returned.
+// Use AnyVersion to append without the concurrency check, and NoStream to create a new stream.
+//
+// Events are published after they are stored. When publishing fails, events are stored anyway
+// and can be published again with Replay.
+func (s *EventStore) AppendToStream(
+	ctx context.Context,
+	streamID string,
+	expectedVersion int,
+	events ...*message.Message,
+) error {
+	if streamID == "" {
+		return errors.New("empty stream id")
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	for _, event := range events {
+		event.Metadata.Set(StreamIDMetadataKey, streamID)
+	}
+
+	if err := s.config.Storage.Append(ctx, streamID, expectedVersion, events); err != nil {
+		return err
+	}
+
+	s.config.Logger.Trace("Events appended to stream", watermill.LogFields{
+		"stream_id":    streamID,
+		"events_count": len(events),
+	})
+
+	if err := s.config.Publisher.Publish(s.config.Topic, events...); err != nil {
+		return errors.Wrap(err, "cannot publish events")
+	}
+
+	return nil
+}
+
+// ReadStream returns the events of the stream, starting from fromVersion (inclusive).
+// Versions are starting from 1.
+func (s *EventStore) ReadStream(ctx context.Context, streamID string, fromVersion int) ([]*message.Message, error) {
+	events, err := s.config.Storage.Read(ctx, streamID, fromVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read stream %s", streamID)
+	}
+
+	return events, nil
+}
+
+// Replay publishes all stored events to the topic, in the order in which they were appended.
+// It can be used to rebuild projections from scratch.
+func (s *EventStore) Replay(ctx context.Context, topic string) error {
+	events, err := s.config.Storage.ReadAll(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot read events")
+	}
+
+	s.config.Logger.Info("Replaying events", watermill.LogFields{
+		"topic":        topic,
+		"events_count": len(events),
+	})
+
+	for _, event := range events {
+		if err := s.config.Publisher.Publish(topic, event); err != nil {
+			return errors.Wrapf(err, "cannot replay event %s", event.UUID)
+		}
+	}
+
+	return nil
+}
+
+// Topic returns the topic to which the events are published.
+func (s *EventStore) Topic() string {
+	return s.config.Topic
+}
+
+// SetStreamVersions sets consecutive versions on the events appended to the stream with currentVersion.
+// It should be used by Storage implementations.
+func SetStreamVersions(currentVersion int, events []*message.Message) {
+	for i, event := range events {
+		event.Metadata.Set(StreamVersionMetadataKey, strconv.Itoa(currentVersion+i+1))
+	}
+}
+
+// StreamVersion returns the version of the stream after appending the event.
+func StreamVersion(event *message.Message) (int, error) {
+	return strconv.Atoi(event.Metadata.Get(StreamVersionMetadataKey))
+}
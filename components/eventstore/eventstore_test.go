@@ -0,0 +1,107 @@
+package eventstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/eventstore"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+)
+
+func newEventStore(t *testing.T) (*eventstore.EventStore, message.PubSub) {
+	logger := watermill.NewStdLogger(false, false)
+	pubSub := gochannel.NewGoChannel(gochannel.Config{Persistent: true}, logger)
+
+	store, err := eventstore.NewEventStore(eventstore.Config{
+		Storage:   eventstore.NewMemoryStorage(),
+		Publisher: pubSub,
+		Topic:     "events",
+		Logger:    logger,
+	})
+	require.NoError(t, err)
+
+	return store, pubSub
+}
+
+func newEvent(payload string) *message.Message {
+	return message.NewMessage(watermill.NewUUID(), []byte(payload))
+}
+
+func TestEventStore_AppendToStream(t *testing.T) {
+	store, _ := newEventStore(t)
+	ctx := context.Background()
+
+	require.NoError(t, store.AppendToStream(ctx, "stream_1", eventstore.NoStream, newEvent("1"), newEvent("2")))
+	require.NoError(t, store.AppendToStream(ctx, "stream_1", 2, newEvent("3")))
+	require.NoError(t, store.AppendToStream(ctx, "stream_1", eventstore.AnyVersion, newEvent("4")))
+
+	err := store.AppendToStream(ctx, "stream_1", 2, newEvent("5"))
+	assert.Equal(t, eventstore.WrongExpectedVersionError{
+		StreamID:        "stream_1",
+		ExpectedVersion: 2,
+		ActualVersion:   4,
+	}, err)
+
+	events, err := store.ReadStream(ctx, "stream_1", 3)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	for i, event := range events {
+		version, err := eventstore.StreamVersion(event)
+		require.NoError(t, err)
+
+		assert.Equal(t, i+3, version)
+		assert.Equal(t, "stream_1", event.Metadata.Get(eventstore.StreamIDMetadataKey))
+	}
+	assert.Equal(t, "3", string(events[0].Payload))
+	assert.Equal(t, "4", string(events[1].Payload))
+}
+
+func TestEventStore_projection(t *testing.T) {
+	store, pubSub := newEventStore(t)
+	ctx := context.Background()
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NewStdLogger(false, false))
+	require.NoError(t, err)
+
+	projected := make(chan string)
+	store.AddProjectionHandler(router, "projection", pubSub, func(event *message.Message) error {
+		projected <- string(event.Payload)
+		return nil
+	}, 2)
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		assert.NoError(t, router.Close())
+	}()
+	<-router.Running()
+
+	require.NoError(t, store.AppendToStream(ctx, "stream_1", eventstore.NoStream, newEvent("1"), newEvent("2")))
+	assert.ElementsMatch(t, []string{"1", "2"}, readProjected(t, projected, 2))
+
+	require.NoError(t, store.Replay(ctx, store.Topic()))
+	assert.ElementsMatch(t, []string{"1", "2"}, readProjected(t, projected, 2))
+}
+
+func readProjected(t *testing.T, projected <-chan string, count int) []string {
+	var payloads []string
+
+	for i := 0; i < count; i++ {
+		select {
+		case payload := <-projected:
+			payloads = append(payloads, payload)
+		case <-time.After(5 * time.Second):
+			t.Fatal("projection timed out")
+		}
+	}
+
+	return payloads
+}
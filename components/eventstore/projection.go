@@ -0,0 +1,33 @@
+package eventstore
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// ProjectionHandler updates the read model with the event.
+type ProjectionHandler func(event *message.Message) error
+
+// AddProjectionHandler adds a handler which feeds the projection with events published by the event store.
+//
+// Events of the same stream are processed in order, events of different streams are processed
+// in parallel by up to workersCount workers.
+// The subscriber should be subscribed to the event store's topic, for example with a separate consumer group per projection.
+func (s *EventStore) AddProjectionHandler(
+	router *message.Router,
+	handlerName string,
+	subscriber message.Subscriber,
+	projectionHandler ProjectionHandler,
+	workersCount int,
+) *message.Handler {
+	handler := router.AddNoPublisherHandler(
+		handlerName,
+		s.config.Topic,
+		subscriber,
+		func(msg *message.Message) ([]*message.Message, error) {
+			return nil, projectionHandler(msg)
+		},
+	)
+	handler.ProcessInOrder(message.OrderingKeyFromMetadata(StreamIDMetadataKey), workersCount)
+
+	return handler
+}
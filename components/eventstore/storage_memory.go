@@ -0,0 +1,88 @@
+package eventstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// MemoryStorage is a Storage which keeps the events in memory.
+// It is useful for tests and prototyping.
+type MemoryStorage struct {
+	streams map[string][]*message.Message
+	all     []*message.Message
+	lock    sync.RWMutex
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		streams: map[string][]*message.Message{},
+	}
+}
+
+func (s *MemoryStorage) Append(ctx context.Context, streamID string, expectedVersion int, events []*message.Message) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	currentVersion := len(s.streams[streamID])
+	if expectedVersion != AnyVersion && expectedVersion != currentVersion {
+		return WrongExpectedVersionError{
+			StreamID:        streamID,
+			ExpectedVersion: expectedVersion,
+			ActualVersion:   currentVersion,
+		}
+	}
+
+	SetStreamVersions(currentVersion, events)
+
+	for _, event := range events {
+		// events are copied, because the original messages are acked by the publisher
+		stored := copyEvent(event)
+		s.streams[streamID] = append(s.streams[streamID], stored)
+		s.all = append(s.all, stored)
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) Read(ctx context.Context, streamID string, fromVersion int) ([]*message.Message, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	stream := s.streams[streamID]
+	if fromVersion < 1 {
+		fromVersion = 1
+	}
+	if fromVersion > len(stream) {
+		return nil, nil
+	}
+
+	return copyEvents(stream[fromVersion-1:]), nil
+}
+
+func (s *MemoryStorage) ReadAll(ctx context.Context) ([]*message.Message, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return copyEvents(s.all), nil
+}
+
+func copyEvents(events []*message.Message) []*message.Message {
+	copied := make([]*message.Message, len(events))
+	for i, event := range events {
+		copied[i] = copyEvent(event)
+	}
+
+	return copied
+}
+
+// copyEvent copies the event together with its metadata, so the stored events can't be modified by the callers.
+func copyEvent(event *message.Message) *message.Message {
+	copied := message.NewMessage(event.UUID, event.Payload)
+	for k, v := range event.Metadata {
+		copied.Metadata.Set(k, v)
+	}
+
+	return copied
+}
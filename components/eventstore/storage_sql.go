@@ -0,0 +1,254 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/components/sqlutil"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type SQLStorageConfig struct {
+	// DB is the database with the events table.
+	//
+	// The table needs to have the following columns:
+	//
+	//	position   auto incremented primary key
+	//	stream_id  VARCHAR(255) NOT NULL
+	//	version    INTEGER NOT NULL
+	//	uuid       VARCHAR(36) NOT NULL
+	//	metadata   TEXT NOT NULL
+	//	payload    BLOB
+	//
+	// and a unique index on (stream_id, version), which protects streams from concurrent appends.
+	DB *sql.DB
+
+	// Table is the name of the events table. Defaults to "events".
+	Table string
+
+	// Placeholder of the query arguments. Defaults to sqlutil.QuestionMarkPlaceholder,
+	// use sqlutil.DollarPlaceholder for PostgreSQL.
+	Placeholder sqlutil.Placeholder
+
+	// IsUniqueViolation tells if the insert failed because of a unique index. It's a concurrent append,
+	// when the version of the stream changed, otherwise the error is returned. Defaults to sqlutil.IsUniqueViolation.
+	IsUniqueViolation sqlutil.UniqueViolationFunc
+
+	// MaxAppendAttempts limits the attempts of appending with AnyVersion, when the stream is appended concurrently.
+	// Defaults to 10.
+	MaxAppendAttempts int
+}
+
+func (c *SQLStorageConfig) setDefaults() {
+	if c.Table == "" {
+		c.Table = "events"
+	}
+	if c.Placeholder == nil {
+		c.Placeholder = sqlutil.QuestionMarkPlaceholder
+	}
+	if c.IsUniqueViolation == nil {
+		c.IsUniqueViolation = sqlutil.IsUniqueViolation
+	}
+	if c.MaxAppendAttempts == 0 {
+		c.MaxAppendAttempts = 10
+	}
+}
+
+func (c SQLStorageConfig) validate() error {
+	if c.DB == nil {
+		return errors.New("missing DB")
+	}
+	if c.MaxAppendAttempts < 0 {
+		return errors.New("MaxAppendAttempts cannot be negative")
+	}
+
+	return nil
+}
+
+// SQLStorage is a Storage which keeps the events in a SQL database.
+// It works with any database/sql driver.
+type SQLStorage struct {
+	config SQLStorageConfig
+}
+
+func NewSQLStorage(config SQLStorageConfig) (*SQLStorage, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid SQLStorage config")
+	}
+
+	return &SQLStorage{config}, nil
+}
+
+// uniqueViolationError happens when inserting of the event violated a unique index.
+type uniqueViolationError struct {
+	err           error
+	eventUUID     string
+	streamVersion int
+}
+
+func (e uniqueViolationError) Error() string {
+	return errors.Wrapf(e.err, "cannot insert event %s", e.eventUUID).Error()
+}
+
+// Append stores the events in a transaction. When the stream is appended concurrently,
+// it returns WrongExpectedVersionError, or retries up to MaxAppendAttempts times when expectedVersion is AnyVersion.
+func (s *SQLStorage) Append(ctx context.Context, streamID string, expectedVersion int, events []*message.Message) error {
+	for attempt := 1; ; attempt++ {
+		err := s.append(ctx, streamID, expectedVersion, events)
+		violation, ok := errors.Cause(err).(uniqueViolationError)
+		if !ok {
+			return err
+		}
+
+		actualVersion, err := s.streamVersion(ctx, s.config.DB, streamID)
+		if err != nil {
+			return err
+		}
+		if actualVersion == violation.streamVersion {
+			// the stream was not appended, so another unique index was violated, for example of the event uuid
+			return violation
+		}
+
+		if expectedVersion != AnyVersion {
+			return WrongExpectedVersionError{
+				StreamID:        streamID,
+				ExpectedVersion: expectedVersion,
+				ActualVersion:   actualVersion,
+			}
+		}
+
+		if attempt >= s.config.MaxAppendAttempts {
+			return errors.Errorf("stream %s was appended concurrently %d times", streamID, attempt)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// the events are appended after the events of the concurrent append
+	}
+}
+
+func (s *SQLStorage) append(ctx context.Context, streamID string, expectedVersion int, events []*message.Message) (err error) {
+	tx, err := s.config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot begin transaction")
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		err = errors.Wrap(tx.Commit(), "cannot commit transaction")
+	}()
+
+	currentVersion, err := s.streamVersion(ctx, tx, streamID)
+	if err != nil {
+		return err
+	}
+
+	if expectedVersion != AnyVersion && expectedVersion != currentVersion {
+		return WrongExpectedVersionError{
+			StreamID:        streamID,
+			ExpectedVersion: expectedVersion,
+			ActualVersion:   currentVersion,
+		}
+	}
+
+	SetStreamVersions(currentVersion, events)
+
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO %s (stream_id, version, uuid, metadata, payload) VALUES (%s)",
+		s.config.Table, s.config.Placeholder.List(5),
+	)
+
+	for i, event := range events {
+		metadata, err := json.Marshal(event.Metadata)
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal metadata of event %s", event.UUID)
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			insertQuery,
+			streamID, currentVersion+i+1, event.UUID, string(metadata), []byte(event.Payload),
+		)
+		if s.config.IsUniqueViolation(err) {
+			return uniqueViolationError{err: err, eventUUID: event.UUID, streamVersion: currentVersion}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot insert event %s", event.UUID)
+		}
+	}
+
+	return nil
+}
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *SQLStorage) streamVersion(ctx context.Context, q rowQuerier, streamID string) (int, error) {
+	var version int
+	err := q.QueryRowContext(
+		ctx,
+		fmt.Sprintf(
+			"SELECT COALESCE(MAX(version), 0) FROM %s WHERE stream_id = %s",
+			s.config.Table, s.config.Placeholder(1),
+		),
+		streamID,
+	).Scan(&version)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot read stream version")
+	}
+
+	return version, nil
+}
+
+func (s *SQLStorage) Read(ctx context.Context, streamID string, fromVersion int) ([]*message.Message, error) {
+	return s.query(
+		ctx,
+		fmt.Sprintf(
+			"SELECT uuid, metadata, payload FROM %s WHERE stream_id = %s AND version >= %s ORDER BY version",
+			s.config.Table, s.config.Placeholder(1), s.config.Placeholder(2),
+		),
+		streamID, fromVersion,
+	)
+}
+
+func (s *SQLStorage) ReadAll(ctx context.Context) ([]*message.Message, error) {
+	return s.query(
+		ctx,
+		fmt.Sprintf("SELECT uuid, metadata, payload FROM %s ORDER BY position", s.config.Table),
+	)
+}
+
+func (s *SQLStorage) query(ctx context.Context, query string, args ...interface{}) ([]*message.Message, error) {
+	rows, err := s.config.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot query events")
+	}
+	defer rows.Close()
+
+	var events []*message.Message
+	for rows.Next() {
+		var uuid, metadata string
+		var payload []byte
+
+		if err := rows.Scan(&uuid, &metadata, &payload); err != nil {
+			return nil, errors.Wrap(err, "cannot scan event")
+		}
+
+		event := message.NewMessage(uuid, payload)
+		if err := json.Unmarshal([]byte(metadata), &event.Metadata); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal metadata of event %s", uuid)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, errors.Wrap(rows.Err(), "cannot read events")
+}
@@ -0,0 +1,386 @@
+package eventstore_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/eventstore"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// fakeDriver is a minimal database/sql driver, which supports only the queries of SQLStorage.
+// Every data source name has its own database. Changes are visible after the commit.
+type fakeDriver struct {
+	lock sync.Mutex
+	dbs  map[string]*fakeDB
+}
+
+var fakeDBs = &fakeDriver{dbs: map[string]*fakeDB{}}
+
+func init() {
+	sql.Register("eventstore_fake", fakeDBs)
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if _, ok := d.dbs[name]; !ok {
+		d.dbs[name] = &fakeDB{}
+	}
+
+	return &fakeConn{db: d.dbs[name]}, nil
+}
+
+func (d *fakeDriver) db(name string) *fakeDB {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.dbs[name]
+}
+
+type fakeEvent struct {
+	streamID string
+	version  int64
+	uuid     string
+	metadata string
+	payload  []byte
+}
+
+type fakeDB struct {
+	lock   sync.Mutex
+	events []fakeEvent
+
+	// beforeInsert is called once, before the next insert
+	beforeInsert func()
+}
+
+// commit stores the events, failing like the unique index on (stream_id, version).
+func (d *fakeDB) commit(events []fakeEvent) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, event := range events {
+		for _, stored := range d.events {
+			if stored.streamID == event.streamID && stored.version == event.version {
+				return errors.New("UNIQUE constraint failed: events.stream_id, events.version")
+			}
+		}
+		d.events = append(d.events, event)
+	}
+
+	return nil
+}
+
+func (d *fakeDB) setBeforeInsert(beforeInsert func()) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.beforeInsert = beforeInsert
+}
+
+func (d *fakeDB) takeBeforeInsert() func() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	beforeInsert := d.beforeInsert
+	d.beforeInsert = nil
+
+	return beforeInsert
+}
+
+type fakeConn struct {
+	db *fakeDB
+
+	pending []fakeEvent
+}
+
+// visibleEvents returns the committed events and the events inserted in the current transaction.
+// It must be called with the lock of the database.
+func (c *fakeConn) visibleEvents() []fakeEvent {
+	events := make([]fakeEvent, 0, len(c.db.events)+len(c.pending))
+	events = append(events, c.db.events...)
+	return append(events, c.pending...)
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.pending = nil
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return c.db.commit(c.pending)
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s fakeStmt) Close() error {
+	return nil
+}
+
+func (s fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.HasPrefix(s.query, "INSERT INTO events") {
+		return nil, errors.Errorf("unsupported query %s", s.query)
+	}
+
+	if beforeInsert := s.conn.db.takeBeforeInsert(); beforeInsert != nil {
+		beforeInsert()
+	}
+
+	event := fakeEvent{
+		streamID: args[0].(string),
+		version:  args[1].(int64),
+		uuid:     args[2].(string),
+		metadata: args[3].(string),
+		payload:  args[4].([]byte),
+	}
+
+	s.conn.db.lock.Lock()
+	defer s.conn.db.lock.Unlock()
+
+	for _, stored := range s.conn.visibleEvents() {
+		if stored.streamID == event.streamID && stored.version == event.version {
+			return nil, errors.New("UNIQUE constraint failed: events.stream_id, events.version")
+		}
+		if stored.uuid == event.uuid {
+			return nil, errors.New("UNIQUE constraint failed: events.uuid")
+		}
+	}
+	s.conn.pending = append(s.conn.pending, event)
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.db.lock.Lock()
+	defer s.conn.db.lock.Unlock()
+
+	events := s.conn.db.events
+
+	switch {
+	case strings.HasPrefix(s.query, "SELECT COALESCE(MAX(version), 0) FROM events WHERE stream_id"):
+		version := int64(0)
+		for _, event := range s.conn.visibleEvents() {
+			if event.streamID == args[0].(string) && event.version > version {
+				version = event.version
+			}
+		}
+		return &fakeRows{columns: []string{"version"}, values: [][]driver.Value{{version}}}, nil
+	case strings.HasPrefix(s.query, "SELECT uuid, metadata, payload FROM events WHERE stream_id"):
+		// events are inserted in the order of versions
+		rows := &fakeRows{columns: []string{"uuid", "metadata", "payload"}}
+		for _, event := range events {
+			if event.streamID == args[0].(string) && event.version >= args[1].(int64) {
+				rows.values = append(rows.values, []driver.Value{event.uuid, event.metadata, event.payload})
+			}
+		}
+		return rows, nil
+	case strings.HasPrefix(s.query, "SELECT uuid, metadata, payload FROM events ORDER BY position"):
+		rows := &fakeRows{columns: []string{"uuid", "metadata", "payload"}}
+		for _, event := range events {
+			rows.values = append(rows.values, []driver.Value{event.uuid, event.metadata, event.payload})
+		}
+		return rows, nil
+	default:
+		return nil, errors.Errorf("unsupported query %s", s.query)
+	}
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func newSQLStorage(t *testing.T) (*eventstore.SQLStorage, *fakeDB) {
+	dbName := t.Name() + "_" + watermill.NewUUID()
+
+	sqlDB, err := sql.Open("eventstore_fake", dbName)
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Ping())
+
+	storage, err := eventstore.NewSQLStorage(eventstore.SQLStorageConfig{DB: sqlDB})
+	require.NoError(t, err)
+
+	return storage, fakeDBs.db(dbName)
+}
+
+func streamVersions(t *testing.T, events []*message.Message) []int {
+	var versions []int
+	for _, event := range events {
+		version, err := eventstore.StreamVersion(event)
+		require.NoError(t, err)
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func TestSQLStorage(t *testing.T) {
+	storage, _ := newSQLStorage(t)
+	ctx := context.Background()
+
+	require.NoError(t, storage.Append(ctx, "stream_1", eventstore.NoStream, []*message.Message{newEvent("1"), newEvent("2")}))
+	require.NoError(t, storage.Append(ctx, "stream_2", eventstore.NoStream, []*message.Message{newEvent("3")}))
+	require.NoError(t, storage.Append(ctx, "stream_1", 2, []*message.Message{newEvent("4")}))
+	require.NoError(t, storage.Append(ctx, "stream_1", eventstore.AnyVersion, []*message.Message{newEvent("5")}))
+
+	err := storage.Append(ctx, "stream_1", 2, []*message.Message{newEvent("6")})
+	assert.Equal(t, eventstore.WrongExpectedVersionError{
+		StreamID:        "stream_1",
+		ExpectedVersion: 2,
+		ActualVersion:   4,
+	}, err)
+
+	events, err := storage.Read(ctx, "stream_1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "4", "5"}, payloads(events))
+	assert.Equal(t, []int{2, 3, 4}, streamVersions(t, events))
+
+	events, err = storage.ReadAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, payloads(events))
+}
+
+func TestSQLStorage_concurrent_append(t *testing.T) {
+	storage, db := newSQLStorage(t)
+	ctx := context.Background()
+
+	// the concurrent transaction commits the event after the version of the stream was read
+	db.beforeInsert = func() {
+		require.NoError(t, db.commit([]fakeEvent{{
+			streamID: "stream_1",
+			version:  1,
+			uuid:     watermill.NewUUID(),
+			metadata: "{}",
+		}}))
+	}
+
+	err := storage.Append(ctx, "stream_1", eventstore.NoStream, []*message.Message{newEvent("1")})
+	assert.Equal(t, eventstore.WrongExpectedVersionError{
+		StreamID:        "stream_1",
+		ExpectedVersion: eventstore.NoStream,
+		ActualVersion:   1,
+	}, err)
+
+	events, err := storage.Read(ctx, "stream_1", 0)
+	require.NoError(t, err)
+	assert.Len(t, events, 1, "only the event of the concurrent transaction should be stored")
+}
+
+func TestSQLStorage_concurrent_append_any_version(t *testing.T) {
+	storage, db := newSQLStorage(t)
+	ctx := context.Background()
+
+	db.beforeInsert = func() {
+		require.NoError(t, db.commit([]fakeEvent{{
+			streamID: "stream_1",
+			version:  1,
+			uuid:     watermill.NewUUID(),
+			metadata: "{}",
+			payload:  []byte("concurrent"),
+		}}))
+	}
+
+	require.NoError(t, storage.Append(ctx, "stream_1", eventstore.AnyVersion, []*message.Message{newEvent("1")}))
+
+	events, err := storage.Read(ctx, "stream_1", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"concurrent", "1"}, payloads(events))
+	assert.Equal(t, []int{2}, streamVersions(t, events[1:]))
+}
+
+func payloads(events []*message.Message) []string {
+	var payloads []string
+	for _, event := range events {
+		payloads = append(payloads, string(event.Payload))
+	}
+	return payloads
+}
+
+func TestSQLStorage_duplicate_event_uuid(t *testing.T) {
+	storage, _ := newSQLStorage(t)
+	ctx := context.Background()
+
+	event := newEvent("1")
+	require.NoError(t, storage.Append(ctx, "stream_1", eventstore.NoStream, []*message.Message{event}))
+
+	duplicate := message.NewMessage(event.UUID, []byte("2"))
+	err := storage.Append(ctx, "stream_2", eventstore.AnyVersion, []*message.Message{duplicate})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "UNIQUE constraint failed: events.uuid")
+
+	events, err := storage.Read(ctx, "stream_2", 0)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestSQLStorage_concurrent_append_max_attempts(t *testing.T) {
+	storage, db := newSQLStorage(t)
+	ctx := context.Background()
+
+	// every attempt is overtaken by a concurrent append
+	version := int64(0)
+	var appendConcurrently func()
+	appendConcurrently = func() {
+		version++
+		require.NoError(t, db.commit([]fakeEvent{{
+			streamID: "stream_1",
+			version:  version,
+			uuid:     watermill.NewUUID(),
+			metadata: "{}",
+		}}))
+		db.setBeforeInsert(appendConcurrently)
+	}
+	db.setBeforeInsert(appendConcurrently)
+
+	err := storage.Append(ctx, "stream_1", eventstore.AnyVersion, []*message.Message{newEvent("1")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "appended concurrently 10 times")
+	assert.EqualValues(t, 10, version)
+}
@@ -0,0 +1,151 @@
+// Package inbox provides the middleware implementing the inbox pattern: the UUID of every consumed message
+// is recorded in a SQL table in the same transaction as the handler's writes, and messages which were
+// already recorded are skipped. It makes consumption idempotent, regardless of the Pub/Sub delivery guarantees.
+//
+// The handler gets the transaction from the message's context:
+//
+//	func handler(msg *message.Message) ([]*message.Message, error) {
+//		tx := inbox.TxFromCtx(msg.Context())
+//		_, err := tx.ExecContext(msg.Context(), "UPDATE balances SET ...")
+//		return nil, err
+//	}
+//
+// Unlike components/stateful, the handlers keep the message.HandlerFunc signature,
+// so the inbox can be added to existing handlers or to the whole router with Router.AddMiddleware.
+package inbox
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/sqlutil"
+	"github.com/ThreeDotsLabs/watermill/components/stateful"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// TxProvider begins the transactions of handlers. It's implemented by *sql.DB.
+type TxProvider = stateful.TxProvider
+
+// ErrNoConsumer happens when the consumer name is not set in Config and the message is not handled by the Router.
+var ErrNoConsumer = errors.New("cannot determine the consumer of the message")
+
+type Config struct {
+	// TxProvider begins the transactions, usually it's *sql.DB. Required.
+	//
+	// The inbox table needs to have the following columns:
+	//
+	//	consumer      VARCHAR(255) NOT NULL
+	//	message_uuid  VARCHAR(36) NOT NULL
+	//
+	// and a unique index on (consumer, message_uuid), which protects from concurrent processing
+	// of the same message.
+	TxProvider TxProvider
+
+	// Table is the name of the inbox table. Defaults to "inbox".
+	Table string
+
+	// Consumer is the name of the consumer recorded with the message UUID,
+	// so many handlers can consume the same message once each.
+	// Defaults to the name of the Router's handler (message.HandlerNameFromCtx).
+	Consumer string
+
+	// Placeholder of the query arguments. Defaults to sqlutil.QuestionMarkPlaceholder,
+	// use sqlutil.DollarPlaceholder for PostgreSQL.
+	Placeholder sqlutil.Placeholder
+
+	// TxOptions are used to begin the transaction. Optional.
+	TxOptions *sql.TxOptions
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.Table == "" {
+		c.Table = "inbox"
+	}
+	if c.Placeholder == nil {
+		c.Placeholder = sqlutil.QuestionMarkPlaceholder
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.TxProvider == nil {
+		return errors.New("missing TxProvider")
+	}
+
+	return nil
+}
+
+type txCtxKey struct{}
+
+// TxFromCtx returns the transaction of the inbox, in which the handler should do its writes.
+// It returns nil, when the message is not handled with the inbox middleware.
+func TxFromCtx(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(txCtxKey{}).(*sql.Tx)
+	return tx
+}
+
+// Inbox records consumed messages and skips the already recorded ones.
+// The messages are recorded with stateful.Processor, using the consumer as the handler name.
+type Inbox struct {
+	config    Config
+	processor *stateful.Processor
+}
+
+func NewInbox(config Config) (*Inbox, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Inbox config")
+	}
+
+	processor, err := stateful.NewProcessor(stateful.Config{
+		DB:                     config.TxProvider,
+		ProcessedMessagesTable: config.Table,
+		HandlerNameColumn:      "consumer",
+		Placeholder:            config.Placeholder,
+		TxOptions:              config.TxOptions,
+		Logger:                 config.Logger,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create stateful Processor")
+	}
+
+	return &Inbox{
+		config:    config,
+		processor: processor,
+	}, nil
+}
+
+// Middleware calls the handler in the transaction available with TxFromCtx.
+//
+// The transaction is committed only when the handler returns no error. When the handler panics,
+// the transaction is rolled back and the panic is propagated. When the message was already recorded,
+// the handler is not called and the message is acked.
+//
+// Messages produced by the handler are published after the commit. When publishing fails, the redelivered message
+// is skipped, so they are not published again. Write them to an outbox table with the transaction,
+// when the produced messages must not be lost.
+func (i *Inbox) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		consumer := i.config.Consumer
+		if consumer == "" {
+			consumer = message.HandlerNameFromCtx(msg.Context())
+		}
+		if consumer == "" {
+			return nil, ErrNoConsumer
+		}
+
+		return i.processor.Process(consumer, msg, func(ctx context.Context, tx *sql.Tx, msg *message.Message) ([]*message.Message, error) {
+			msg.SetContext(context.WithValue(ctx, txCtxKey{}, tx))
+			defer msg.SetContext(ctx)
+
+			return h(msg)
+		})
+	}
+}
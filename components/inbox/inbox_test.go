@@ -0,0 +1,249 @@
+package inbox_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/inbox"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// fakeDB is a minimal database/sql driver, which supports only the queries used in the tests.
+// Changes are visible after the commit.
+type fakeDB struct {
+	lock    sync.Mutex
+	inbox   map[string]bool
+	counter int
+}
+
+var db = &fakeDB{inbox: map[string]bool{}}
+
+func init() {
+	sql.Register("inbox_fake", db)
+}
+
+func (d *fakeDB) Open(name string) (driver.Conn, error) {
+	return &fakeConn{db: d}, nil
+}
+
+func (d *fakeDB) counterValue() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.counter
+}
+
+type fakeConn struct {
+	db *fakeDB
+
+	pendingInbox   []string
+	pendingCounter int
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.pendingInbox = nil
+	c.pendingCounter = 0
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.lock.Lock()
+	defer c.db.lock.Unlock()
+
+	for _, key := range c.pendingInbox {
+		c.db.inbox[key] = true
+	}
+	c.db.counter += c.pendingCounter
+
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s fakeStmt) Close() error {
+	return nil
+}
+
+func (s fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch {
+	case strings.HasPrefix(s.query, "INSERT INTO inbox"):
+		s.conn.pendingInbox = append(s.conn.pendingInbox, args[0].(string)+"/"+args[1].(string))
+	case strings.HasPrefix(s.query, "UPDATE counter"):
+		s.conn.pendingCounter++
+	default:
+		return nil, errors.Errorf("unsupported query %s", s.query)
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT COUNT(*) FROM inbox") {
+		return nil, errors.Errorf("unsupported query %s", s.query)
+	}
+
+	s.conn.db.lock.Lock()
+	defer s.conn.db.lock.Unlock()
+
+	count := int64(0)
+	if s.conn.db.inbox[args[0].(string)+"/"+args[1].(string)] {
+		count = 1
+	}
+
+	return &fakeRows{values: []driver.Value{count}}, nil
+}
+
+type fakeRows struct {
+	values []driver.Value
+	read   bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"count"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.read {
+		return io.EOF
+	}
+	r.read = true
+	copy(dest, r.values)
+	return nil
+}
+
+func TestInbox_Middleware(t *testing.T) {
+	sqlDB, err := sql.Open("inbox_fake", "")
+	require.NoError(t, err)
+
+	i, err := inbox.NewInbox(inbox.Config{TxProvider: sqlDB, Consumer: "consumer"})
+	require.NoError(t, err)
+
+	failHandler := true
+	handler := i.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		tx := inbox.TxFromCtx(msg.Context())
+		require.NotNil(t, tx)
+
+		if _, err := tx.ExecContext(msg.Context(), "UPDATE counter SET value = value + 1"); err != nil {
+			return nil, err
+		}
+		if failHandler {
+			return nil, errors.New("handler failed")
+		}
+
+		return []*message.Message{message.NewMessage(watermill.NewUUID(), nil)}, nil
+	})
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+
+	// the writes of the failed handler are rolled back
+	_, err = handler(msg)
+	require.Error(t, err)
+	assert.Equal(t, 0, db.counterValue())
+
+	failHandler = false
+	producedMessages, err := handler(msg)
+	require.NoError(t, err)
+	assert.Len(t, producedMessages, 1)
+	assert.Equal(t, 1, db.counterValue())
+	assert.Nil(t, inbox.TxFromCtx(msg.Context()), "context of the message should be restored")
+
+	// redelivered message is skipped
+	producedMessages, err = handler(msg)
+	require.NoError(t, err)
+	assert.Empty(t, producedMessages)
+	assert.Equal(t, 1, db.counterValue())
+}
+
+func TestInbox_Middleware_panic(t *testing.T) {
+	sqlDB, err := sql.Open("inbox_fake", "")
+	require.NoError(t, err)
+
+	i, err := inbox.NewInbox(inbox.Config{TxProvider: sqlDB, Consumer: "panic_consumer"})
+	require.NoError(t, err)
+
+	counterBefore := db.counterValue()
+
+	panicHandler := true
+	handler := i.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		tx := inbox.TxFromCtx(msg.Context())
+		if _, err := tx.ExecContext(msg.Context(), "UPDATE counter SET value = value + 1"); err != nil {
+			return nil, err
+		}
+		if panicHandler {
+			panic("handler panicked")
+		}
+
+		return nil, nil
+	})
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+
+	assert.PanicsWithValue(t, "handler panicked", func() {
+		_, _ = handler(msg)
+	})
+	assert.Equal(t, counterBefore, db.counterValue())
+	assert.Nil(t, inbox.TxFromCtx(msg.Context()), "context of the message should be restored")
+
+	// redelivered message is not skipped, because the panicked transaction was rolled back
+	panicHandler = false
+	_, err = handler(msg)
+	require.NoError(t, err)
+	assert.Equal(t, counterBefore+1, db.counterValue())
+}
+
+func TestInbox_Middleware_no_consumer(t *testing.T) {
+	sqlDB, err := sql.Open("inbox_fake", "")
+	require.NoError(t, err)
+
+	i, err := inbox.NewInbox(inbox.Config{TxProvider: sqlDB})
+	require.NoError(t, err)
+
+	handler := i.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	})
+
+	_, err = handler(message.NewMessage(watermill.NewUUID(), nil))
+	assert.Equal(t, inbox.ErrNoConsumer, err)
+}
+
+func TestNewInbox_missing_tx_provider(t *testing.T) {
+	_, err := inbox.NewInbox(inbox.Config{})
+	assert.Error(t, err)
+}
+
+func TestTxFromCtx_no_inbox(t *testing.T) {
+	assert.Nil(t, inbox.TxFromCtx(context.Background()))
+}
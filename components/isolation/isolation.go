@@ -0,0 +1,378 @@
+// Package isolation runs handlers in separate worker processes, so a crashing or leaking handler can be restarted
+// without closing the subscriptions of the Router.
+//
+// The Router keeps consuming messages in the parent process and the IsolatedHandler forwards them to the worker
+// process over its stdin and stdout. When the worker crashes, messages being handled are nacked
+// and the worker is restarted.
+//
+// The worker is by default the same binary started with HandlerNameEnv set, so main needs to serve the handler,
+// when it's started as the worker:
+//
+//	func main() {
+//		if isolation.WorkerHandlerName() == "orders" {
+//			if err := isolation.ServeWorker(handleOrder); err != nil {
+//				log.Fatal(err)
+//			}
+//			return
+//		}
+//
+//		ordersHandler, err := isolation.NewIsolatedHandler(isolation.Config{HandlerName: "orders"})
+//		// ...
+//		router.AddNoPublisherHandler("orders", "orders", subscriber, ordersHandler.HandlerFunc)
+//	}
+//
+// Only the UUID, the metadata and the payload of messages are passed between the processes.
+// Messages are acked or nacked by the Router in the parent process, according to the result of the handler.
+package isolation
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+var (
+	// ErrWorkerCrashed is returned by the handler, when the worker process exited while handling the message.
+	ErrWorkerCrashed = errors.New("isolated worker process crashed")
+	// ErrClosed is returned by the handler, when the IsolatedHandler is closed.
+	ErrClosed = errors.New("isolated handler is closed")
+	// ErrResponseTimeout is returned by the handler, when the worker didn't respond within Config.ResponseTimeout.
+	ErrResponseTimeout = errors.New("isolated worker didn't respond in time")
+)
+
+type Config struct {
+	// HandlerName is passed to the worker process in HandlerNameEnv. Required.
+	HandlerName string
+
+	// Command returns the command starting the worker process.
+	// Defaults to the current binary started with the same arguments.
+	// Stdin and Stdout of the command are used to communicate with the worker.
+	Command func() *exec.Cmd
+
+	// RestartDelay is the minimum time between the crash of the worker and its restart. Defaults to one second.
+	RestartDelay time.Duration
+
+	// ResponseTimeout is optional. When the worker doesn't respond to the message within it,
+	// the worker is considered hung, so it's killed and restarted.
+	// Other messages handled by the killed worker fail with ErrWorkerCrashed.
+	ResponseTimeout time.Duration
+
+	// CloseTimeout is how long Close waits for the messages being handled by the worker,
+	// before killing it. Defaults to 30 seconds.
+	CloseTimeout time.Duration
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.Command == nil {
+		c.Command = func() *exec.Cmd {
+			cmd := exec.Command(os.Args[0], os.Args[1:]...)
+			cmd.Stderr = os.Stderr
+			return cmd
+		}
+	}
+	if c.RestartDelay == 0 {
+		c.RestartDelay = time.Second
+	}
+	if c.CloseTimeout == 0 {
+		c.CloseTimeout = time.Second * 30
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.HandlerName == "" {
+		return errors.New("missing HandlerName")
+	}
+	if c.RestartDelay < 0 {
+		return errors.New("RestartDelay cannot be negative")
+	}
+	if c.ResponseTimeout < 0 {
+		return errors.New("ResponseTimeout cannot be negative")
+	}
+
+	return nil
+}
+
+// IsolatedHandler forwards messages to the handler running in the worker process.
+// The worker is started with the first message and restarted after it crashes.
+type IsolatedHandler struct {
+	config Config
+	logger watermill.LoggerAdapter
+
+	lock      sync.Mutex
+	worker    *workerProcess
+	crashedAt time.Time
+	closed    bool
+	closing   chan struct{}
+
+	lastRequestID uint64
+}
+
+func NewIsolatedHandler(config Config) (*IsolatedHandler, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid IsolatedHandler config")
+	}
+
+	return &IsolatedHandler{
+		config:  config,
+		logger:  config.Logger.With(watermill.LogFields{"isolated_handler": config.HandlerName}),
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// HandlerFunc handles the message in the worker process.
+// It returns ErrWorkerCrashed, when the worker exited before returning the result,
+// and ErrResponseTimeout, when the worker was killed after Config.ResponseTimeout.
+func (h *IsolatedHandler) HandlerFunc(msg *message.Message) ([]*message.Message, error) {
+	worker, err := h.runningWorker(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	id := atomic.AddUint64(&h.lastRequestID, 1)
+	responses := worker.register(id)
+	defer worker.unregister(id)
+
+	if err := worker.send(request{ID: id, Message: toWireMessage(msg)}); err != nil {
+		return nil, errors.Wrap(ErrWorkerCrashed, err.Error())
+	}
+
+	var responseTimeout <-chan time.Time
+	if h.config.ResponseTimeout > 0 {
+		timer := time.NewTimer(h.config.ResponseTimeout)
+		defer timer.Stop()
+		responseTimeout = timer.C
+	}
+
+	select {
+	case resp := <-responses:
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+		return toMessages(resp.ProducedMessages), nil
+	case <-worker.exited:
+		return nil, ErrWorkerCrashed
+	case <-responseTimeout:
+		h.logger.Error("Isolated worker didn't respond in time, killing it", ErrResponseTimeout, watermill.LogFields{
+			"message_uuid":     msg.UUID,
+			"response_timeout": h.config.ResponseTimeout,
+		})
+		if err := worker.cmd.Process.Kill(); err != nil {
+			h.logger.Error("Cannot kill the worker", err, nil)
+		}
+		return nil, ErrResponseTimeout
+	case <-msg.Context().Done():
+		return nil, msg.Context().Err()
+	}
+}
+
+// runningWorker returns the running worker process, starting it when needed.
+// After a crash, it waits for RestartDelay without holding the lock, so Close isn't blocked.
+func (h *IsolatedHandler) runningWorker(msg *message.Message) (*workerProcess, error) {
+	for {
+		h.lock.Lock()
+
+		if h.closed {
+			h.lock.Unlock()
+			return nil, ErrClosed
+		}
+		if h.worker != nil {
+			worker := h.worker
+			h.lock.Unlock()
+			return worker, nil
+		}
+
+		if wait := h.config.RestartDelay - time.Since(h.crashedAt); !h.crashedAt.IsZero() && wait > 0 {
+			h.lock.Unlock()
+
+			select {
+			case <-time.After(wait):
+				// other messages may have started the worker in the meantime
+				continue
+			case <-h.closing:
+				return nil, ErrClosed
+			case <-msg.Context().Done():
+				return nil, msg.Context().Err()
+			}
+		}
+
+		worker, err := h.startWorker()
+		if err == nil {
+			h.worker = worker
+		}
+		h.lock.Unlock()
+
+		return worker, err
+	}
+}
+
+func (h *IsolatedHandler) startWorker() (*workerProcess, error) {
+	cmd := h.config.Command()
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, HandlerNameEnv+"="+h.config.HandlerName)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create stdin of the worker")
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create stdout of the worker")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "cannot start the worker")
+	}
+
+	h.logger.Info("Isolated worker started", watermill.LogFields{"pid": cmd.Process.Pid})
+
+	worker := &workerProcess{
+		cmd:     cmd,
+		stdin:   stdin,
+		encoder: json.NewEncoder(stdin),
+		pending: map[uint64]chan response{},
+		exited:  make(chan struct{}),
+	}
+	go h.readResponses(worker, stdout)
+
+	return worker, nil
+}
+
+// readResponses passes the responses of the worker to the handled messages, until the worker exits.
+func (h *IsolatedHandler) readResponses(worker *workerProcess, stdout io.Reader) {
+	decoder := json.NewDecoder(bufio.NewReader(stdout))
+	for {
+		var resp response
+		err := decoder.Decode(&resp)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the worker wrote something else than a response to stdout, so the responses can't be read anymore
+			h.logger.Error("Cannot decode response of the isolated worker, killing it", err, nil)
+			if err := worker.cmd.Process.Kill(); err != nil {
+				h.logger.Error("Cannot kill the worker", err, nil)
+			}
+			break
+		}
+		worker.dispatch(resp)
+	}
+
+	err := worker.cmd.Wait()
+	close(worker.exited)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.worker == worker {
+		h.worker = nil
+		h.crashedAt = time.Now()
+	}
+	if h.closed {
+		h.logger.Info("Isolated worker stopped", nil)
+		return
+	}
+
+	if err == nil {
+		err = errors.New("worker exited")
+	}
+	h.logger.Error("Isolated worker crashed, it will be restarted", err, watermill.LogFields{
+		"restart_delay": h.config.RestartDelay,
+	})
+}
+
+// Close stops the worker process, after it handles the messages sent to it.
+func (h *IsolatedHandler) Close() error {
+	h.lock.Lock()
+	if h.closed {
+		h.lock.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.closing)
+	worker := h.worker
+	h.lock.Unlock()
+
+	if worker == nil {
+		return nil
+	}
+
+	if err := worker.stdin.Close(); err != nil {
+		h.logger.Error("Cannot close stdin of the worker", err, nil)
+	}
+
+	select {
+	case <-worker.exited:
+		return nil
+	case <-time.After(h.config.CloseTimeout):
+		if err := worker.cmd.Process.Kill(); err != nil {
+			return errors.Wrap(err, "cannot kill the worker")
+		}
+		<-worker.exited
+		return errors.New("isolated worker close timeouted")
+	}
+}
+
+type workerProcess struct {
+	cmd *exec.Cmd
+
+	stdin     io.WriteCloser
+	encoder   *json.Encoder
+	writeLock sync.Mutex
+
+	pending     map[uint64]chan response
+	pendingLock sync.Mutex
+
+	exited chan struct{}
+}
+
+func (w *workerProcess) register(id uint64) <-chan response {
+	responses := make(chan response, 1)
+
+	w.pendingLock.Lock()
+	w.pending[id] = responses
+	w.pendingLock.Unlock()
+
+	return responses
+}
+
+func (w *workerProcess) unregister(id uint64) {
+	w.pendingLock.Lock()
+	delete(w.pending, id)
+	w.pendingLock.Unlock()
+}
+
+func (w *workerProcess) dispatch(resp response) {
+	w.pendingLock.Lock()
+	responses, ok := w.pending[resp.ID]
+	w.pendingLock.Unlock()
+
+	if ok {
+		// the channel is buffered and every request has exactly one response
+		responses <- resp
+	}
+}
+
+func (w *workerProcess) send(req request) error {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	return w.encoder.Encode(req)
+}
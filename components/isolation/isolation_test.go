@@ -0,0 +1,243 @@
+package isolation_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/components/isolation"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// TestMain serves the handlers, when the test binary is started as the worker process.
+func TestMain(m *testing.M) {
+	if isolation.WorkerHandlerName() == "echo" {
+		if err := isolation.ServeWorker(echoHandler); err != nil {
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func echoHandler(msg *message.Message) ([]*message.Message, error) {
+	switch string(msg.Payload) {
+	case "crash":
+		os.Exit(1)
+	case "fail":
+		return nil, errors.New("handler failed")
+	case "panic":
+		panic("handler panicked")
+	case "garbage":
+		// ServeWorker redirects os.Stdout, so the output is written directly to the file descriptor
+		_, _ = os.NewFile(1, "stdout").WriteString("not a response\n")
+		select {}
+	case "hang":
+		select {}
+	}
+
+	produced := message.NewMessage("produced-"+msg.UUID, msg.Payload)
+	produced.Metadata.Set("source", msg.Metadata.Get("source"))
+
+	return []*message.Message{produced}, nil
+}
+
+func newIsolatedHandler(t *testing.T) *isolation.IsolatedHandler {
+	h, err := isolation.NewIsolatedHandler(isolation.Config{
+		HandlerName:  "echo",
+		RestartDelay: time.Millisecond * 10,
+	})
+	require.NoError(t, err)
+
+	return h
+}
+
+func TestIsolatedHandler(t *testing.T) {
+	h := newIsolatedHandler(t)
+	defer func() {
+		assert.NoError(t, h.Close())
+	}()
+
+	msg := message.NewMessage("1", []byte("payload"))
+	msg.Metadata.Set("source", "test")
+
+	producedMessages, err := h.HandlerFunc(msg)
+	require.NoError(t, err)
+
+	require.Len(t, producedMessages, 1)
+	assert.Equal(t, "produced-1", producedMessages[0].UUID)
+	assert.Equal(t, message.Payload("payload"), producedMessages[0].Payload)
+	assert.Equal(t, "test", producedMessages[0].Metadata.Get("source"))
+
+	_, err = h.HandlerFunc(message.NewMessage("2", []byte("fail")))
+	assert.EqualError(t, err, "handler failed")
+
+	_, err = h.HandlerFunc(message.NewMessage("3", []byte("panic")))
+	assert.EqualError(t, err, "panic in isolated handler: handler panicked")
+}
+
+func TestIsolatedHandler_restart_after_crash(t *testing.T) {
+	h := newIsolatedHandler(t)
+	defer func() {
+		assert.NoError(t, h.Close())
+	}()
+
+	_, err := h.HandlerFunc(message.NewMessage("1", []byte("crash")))
+	assert.Equal(t, isolation.ErrWorkerCrashed, errors.Cause(err))
+
+	var producedMessages []*message.Message
+	deadline := time.Now().Add(time.Second * 10)
+	for {
+		producedMessages, err = h.HandlerFunc(message.NewMessage("2", []byte("payload")))
+		// the handler may be called before the crash of the worker was noticed
+		if errors.Cause(err) != isolation.ErrWorkerCrashed || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	require.NoError(t, err)
+	assert.Len(t, producedMessages, 1)
+}
+
+func TestIsolatedHandler_worker_killed_on_protocol_error(t *testing.T) {
+	h := newIsolatedHandler(t)
+	defer func() {
+		assert.NoError(t, h.Close())
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	msg := message.NewMessage("1", []byte("garbage"))
+	msg.SetContext(ctx)
+
+	_, err := h.HandlerFunc(msg)
+	assert.Equal(t, isolation.ErrWorkerCrashed, errors.Cause(err))
+}
+
+func TestIsolatedHandler_response_timeout(t *testing.T) {
+	h, err := isolation.NewIsolatedHandler(isolation.Config{
+		HandlerName:     "echo",
+		RestartDelay:    time.Millisecond * 10,
+		ResponseTimeout: time.Second,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, h.Close())
+	}()
+
+	_, err = h.HandlerFunc(message.NewMessage("1", []byte("hang")))
+	assert.Equal(t, isolation.ErrResponseTimeout, errors.Cause(err))
+
+	var producedMessages []*message.Message
+	deadline := time.Now().Add(time.Second * 10)
+	for {
+		producedMessages, err = h.HandlerFunc(message.NewMessage("2", []byte("payload")))
+		// the handler may be called before the killed worker exited
+		if errors.Cause(err) != isolation.ErrWorkerCrashed || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	require.NoError(t, err, "worker should be restarted")
+	assert.Len(t, producedMessages, 1)
+}
+
+func TestIsolatedHandler_Close_during_restart_delay(t *testing.T) {
+	h, err := isolation.NewIsolatedHandler(isolation.Config{
+		HandlerName:  "echo",
+		RestartDelay: time.Minute,
+	})
+	require.NoError(t, err)
+
+	_, err = h.HandlerFunc(message.NewMessage("1", []byte("crash")))
+	require.Equal(t, isolation.ErrWorkerCrashed, errors.Cause(err))
+
+	handled := make(chan error, 1)
+	go func() {
+		for {
+			_, err := h.HandlerFunc(message.NewMessage("2", []byte("payload")))
+			// the handler may be called before the crash of the worker was noticed
+			if errors.Cause(err) != isolation.ErrWorkerCrashed {
+				handled <- err
+				return
+			}
+		}
+	}()
+
+	// waiting for the handler to wait for the restart
+	time.Sleep(time.Millisecond * 100)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- h.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Close blocked by the restart delay")
+	}
+
+	select {
+	case err := <-handled:
+		assert.Equal(t, isolation.ErrClosed, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("handler not released by Close")
+	}
+}
+
+func TestIsolatedHandler_context_canceled(t *testing.T) {
+	h := newIsolatedHandler(t)
+	defer func() {
+		assert.NoError(t, h.Close())
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	msg := message.NewMessage("1", []byte("payload"))
+	msg.SetContext(ctx)
+
+	_, err := h.HandlerFunc(msg)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestIsolatedHandler_closed(t *testing.T) {
+	h := newIsolatedHandler(t)
+	require.NoError(t, h.Close())
+
+	_, err := h.HandlerFunc(message.NewMessage("1", nil))
+	assert.Equal(t, isolation.ErrClosed, err)
+}
+
+func TestServe(t *testing.T) {
+	in := strings.NewReader(
+		`{"id": 1, "message": {"uuid": "1", "payload": "cGF5bG9hZA=="}}` + "\n" +
+			`{"id": 2, "message": {"uuid": "2", "payload": "ZmFpbA=="}}` + "\n",
+	)
+	out := &bytes.Buffer{}
+
+	require.NoError(t, isolation.Serve(echoHandler, in, out))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+
+	output := out.String()
+	assert.Contains(t, output, `"uuid":"produced-1"`)
+	assert.Contains(t, output, `{"id":2,"error":"handler failed"}`)
+}
+
+func TestNewIsolatedHandler_missing_handler_name(t *testing.T) {
+	_, err := isolation.NewIsolatedHandler(isolation.Config{})
+	assert.Error(t, err)
+}
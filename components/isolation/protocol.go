@@ -0,0 +1,67 @@
+package isolation
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// request is sent by the parent process to the worker, as a single JSON line.
+type request struct {
+	ID      uint64       `json:"id"`
+	Message *wireMessage `json:"message"`
+}
+
+// response is sent by the worker to the parent process, as a single JSON line.
+type response struct {
+	ID               uint64         `json:"id"`
+	ProducedMessages []*wireMessage `json:"produced_messages,omitempty"`
+	Error            string         `json:"error,omitempty"`
+}
+
+type wireMessage struct {
+	UUID     string           `json:"uuid"`
+	Metadata message.Metadata `json:"metadata,omitempty"`
+	Payload  message.Payload  `json:"payload"`
+}
+
+func toWireMessage(msg *message.Message) *wireMessage {
+	return &wireMessage{
+		UUID:     msg.UUID,
+		Metadata: msg.Metadata,
+		Payload:  msg.Payload,
+	}
+}
+
+func (m *wireMessage) toMessage() *message.Message {
+	msg := message.NewMessage(m.UUID, m.Payload)
+	for k, v := range m.Metadata {
+		msg.Metadata.Set(k, v)
+	}
+
+	return msg
+}
+
+func toWireMessages(messages []*message.Message) []*wireMessage {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	wireMessages := make([]*wireMessage, len(messages))
+	for i, msg := range messages {
+		wireMessages[i] = toWireMessage(msg)
+	}
+
+	return wireMessages
+}
+
+func toMessages(wireMessages []*wireMessage) []*message.Message {
+	if len(wireMessages) == 0 {
+		return nil
+	}
+
+	messages := make([]*message.Message, len(wireMessages))
+	for i, wireMsg := range wireMessages {
+		messages[i] = wireMsg.toMessage()
+	}
+
+	return messages
+}
@@ -0,0 +1,95 @@
+package isolation
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// HandlerNameEnv is the environment variable with the name of the handler served by the worker process.
+const HandlerNameEnv = "WATERMILL_ISOLATED_HANDLER"
+
+// WorkerHandlerName returns the name of the handler, which should be served by the current process
+// with ServeWorker. It returns an empty string in the parent process.
+func WorkerHandlerName() string {
+	return os.Getenv(HandlerNameEnv)
+}
+
+// ServeWorker serves the handler in the worker process, until the parent process closes the connection.
+//
+// The messages are received from stdin and the results are written to stdout, so os.Stdout is redirected
+// to os.Stderr for the time of serving. Logs of the worker should be written to stderr.
+//
+// Messages are handled concurrently, like by the Router.
+func ServeWorker(h message.HandlerFunc) error {
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() {
+		os.Stdout = out
+	}()
+
+	return Serve(h, os.Stdin, out)
+}
+
+// Serve serves the handler with the messages read from r and the results written to w.
+// It returns, when r is closed and all messages are handled.
+func Serve(h message.HandlerFunc, r io.Reader, w io.Writer) error {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+
+	var writeLock sync.Mutex
+	encoder := json.NewEncoder(w)
+
+	var handlersWg sync.WaitGroup
+	defer handlersWg.Wait()
+
+	for {
+		var req request
+		if err := decoder.Decode(&req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "cannot decode request")
+		}
+		if req.Message == nil {
+			return errors.Errorf("request %d without message", req.ID)
+		}
+
+		handlersWg.Add(1)
+		go func(req request) {
+			defer handlersWg.Done()
+
+			resp := handle(h, req)
+
+			writeLock.Lock()
+			defer writeLock.Unlock()
+
+			// when the parent process is gone, there is nobody to report the error to
+			_ = encoder.Encode(resp)
+		}(req)
+	}
+}
+
+func handle(h message.HandlerFunc, req request) (resp response) {
+	resp.ID = req.ID
+
+	defer func() {
+		if r := recover(); r != nil {
+			resp.ProducedMessages = nil
+			resp.Error = errors.Errorf("panic in isolated handler: %v", r).Error()
+		}
+	}()
+
+	producedMessages, err := h(req.Message.toMessage())
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+
+	resp.ProducedMessages = toWireMessages(producedMessages)
+	return resp
+}
@@ -1,7 +1,6 @@
 package metrics
 
 import (
-	"github.com/ThreeDotsLabs/watermill/internal"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -16,6 +15,8 @@ func NewPrometheusMetricsBuilder(prometheusRegistry *prometheus.Registry, namesp
 }
 
 // PrometheusMetricsBuilder provides methods to decorate publishers, subscribers and handlers.
+// It's a SinkMetricsBuilder reporting to PrometheusSink, which registers the metrics upfront,
+// so registration errors are returned by the decorators.
 type PrometheusMetricsBuilder struct {
 	// PrometheusRegistry may be filled with a pre-existing Prometheus registry, or left empty for the default registry.
 	PrometheusRegistry *prometheus.Registry
@@ -34,54 +35,28 @@ func (b PrometheusMetricsBuilder) AddPrometheusRouterMetrics(r *message.Router)
 
 // DecoratePublisher wraps the underlying publisher with Prometheus metrics.
 func (b PrometheusMetricsBuilder) DecoratePublisher(pub message.Publisher) (message.Publisher, error) {
-	var err error
-	d := PublisherPrometheusMetricsDecorator{
-		pub:           pub,
-		publisherName: internal.StructName(pub),
-	}
-
-	d.publishTimeSeconds, err = b.registerHistogramVec(prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: b.Namespace,
-			Subsystem: b.Subsystem,
-			Name:      "publish_time_seconds",
-			Help:      "The time that a publishing attempt (success or not) took in seconds",
-		},
-		publisherLabelKeys,
-	))
-	if err != nil {
+	sink := b.sink()
+	if _, err := sink.histogramVec(MetricPublishTime, publisherLabelKeys); err != nil {
 		return nil, errors.Wrap(err, "could not register publish time metric")
 	}
-	return d, nil
+
+	return PublisherPrometheusMetricsDecorator{SinkMetricsBuilder{Sink: sink}.publisherDecorator(pub)}, nil
 }
 
 // DecorateSubscriber wraps the underlying subscriber with Prometheus metrics.
 func (b PrometheusMetricsBuilder) DecorateSubscriber(sub message.Subscriber) (message.Subscriber, error) {
-	var err error
-	d := &SubscriberPrometheusMetricsDecorator{
-		closing:        make(chan struct{}),
-		subscriberName: internal.StructName(sub),
-	}
-
-	d.subscriberMessagesReceivedTotal, err = b.registerCounterVec(prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: b.Namespace,
-			Subsystem: b.Subsystem,
-			Name:      "subscriber_messages_received_total",
-			Help:      "The total number of messages received by the subscriber",
-		},
-		append(subscriberLabelKeys, labelAcked),
-	))
-	if err != nil {
+	sink := b.sink()
+	labelKeys := append([]string{labelAcked}, subscriberLabelKeys...)
+	if _, err := sink.counterVec(MetricSubscriberMessagesReceived, labelKeys); err != nil {
 		return nil, errors.Wrap(err, "could not register time to ack metric")
 	}
 
-	d.Subscriber, err = message.MessageTransformSubscriberDecorator(d.recordMetrics)(sub)
+	d, err := SinkMetricsBuilder{Sink: sink}.subscriberDecorator(sub)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not decorate subscriber with metrics decorator")
+		return nil, err
 	}
 
-	return d, nil
+	return &SubscriberPrometheusMetricsDecorator{d}, nil
 }
 
 func (b PrometheusMetricsBuilder) DecoratePubSub(pubSub message.PubSub) (message.PubSub, error) {
@@ -97,31 +72,32 @@ func (b PrometheusMetricsBuilder) DecoratePubSub(pubSub message.PubSub) (message
 	return message.NewPubSub(pub, sub), nil
 }
 
-func (b PrometheusMetricsBuilder) register(c prometheus.Collector) (prometheus.Collector, error) {
-	err := b.PrometheusRegistry.Register(c)
-	if err == nil {
-		return c, nil
+// NewRouterMiddleware returns the middleware recording the handler execution time.
+// It panics if the metric can't be registered.
+func (b PrometheusMetricsBuilder) NewRouterMiddleware() HandlerPrometheusMetricsMiddleware {
+	sink := b.sink()
+	if _, err := sink.histogramVec(MetricHandlerExecutionTime, handlerLabelKeys); err != nil {
+		panic(errors.Wrap(err, "could not register handler execution time metric"))
 	}
 
-	if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
-		return are.ExistingCollector, nil
-	}
+	return HandlerPrometheusMetricsMiddleware{SinkMetricsBuilder{Sink: sink}.NewRouterMiddleware()}
+}
 
-	return nil, err
+func (b PrometheusMetricsBuilder) sink() *PrometheusSink {
+	return NewPrometheusSink(b.PrometheusRegistry, b.Namespace, b.Subsystem)
 }
 
-func (b PrometheusMetricsBuilder) registerCounterVec(c *prometheus.CounterVec) (*prometheus.CounterVec, error) {
-	col, err := b.register(c)
-	if err != nil {
-		return nil, err
-	}
-	return col.(*prometheus.CounterVec), nil
+// HandlerPrometheusMetricsMiddleware is the HandlerSinkMetricsMiddleware reporting to PrometheusSink.
+type HandlerPrometheusMetricsMiddleware struct {
+	HandlerSinkMetricsMiddleware
 }
 
-func (b PrometheusMetricsBuilder) registerHistogramVec(h *prometheus.HistogramVec) (*prometheus.HistogramVec, error) {
-	col, err := b.register(h)
-	if err != nil {
-		return nil, err
-	}
-	return col.(*prometheus.HistogramVec), nil
+// PublisherPrometheusMetricsDecorator is the PublisherSinkMetricsDecorator reporting to PrometheusSink.
+type PublisherPrometheusMetricsDecorator struct {
+	PublisherSinkMetricsDecorator
+}
+
+// SubscriberPrometheusMetricsDecorator is the SubscriberSinkMetricsDecorator reporting to PrometheusSink.
+type SubscriberPrometheusMetricsDecorator struct {
+	*SubscriberSinkMetricsDecorator
 }
@@ -19,6 +19,22 @@ const (
 )
 
 var (
+	publisherLabelKeys = []string{
+		labelKeyHandlerName,
+		labelKeyPublisherName,
+		labelSuccess,
+	}
+
+	subscriberLabelKeys = []string{
+		labelKeyHandlerName,
+		labelKeySubscriberName,
+	}
+
+	handlerLabelKeys = []string{
+		labelKeyHandlerName,
+		labelSuccess,
+	}
+
 	labelGetters = map[string]func(context.Context) string{
 		labelKeyHandlerName:    message.HandlerNameFromCtx,
 		labelKeyPublisherName:  message.PublisherNameFromCtx,
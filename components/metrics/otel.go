@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	otelapi "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/ThreeDotsLabs/watermill/components/metrics"
+
+// OpenTelemetrySink is a MetricsSink recording metrics with OpenTelemetry instruments.
+// Durations are recorded as float histograms in seconds, counters as int counters.
+// Labels are recorded as attributes.
+//
+// Instruments are created on the first use of the metric name. Metrics whose instrument can't be created are dropped.
+type OpenTelemetrySink struct {
+	meter metric.Meter
+
+	histograms map[string]metric.Float64Histogram
+	counters   map[string]metric.Int64Counter
+	lock       sync.Mutex
+}
+
+// NewOpenTelemetrySink creates an OpenTelemetrySink. If meterProvider is nil, the global MeterProvider is used.
+func NewOpenTelemetrySink(meterProvider metric.MeterProvider) *OpenTelemetrySink {
+	if meterProvider == nil {
+		meterProvider = otelapi.GetMeterProvider()
+	}
+
+	return &OpenTelemetrySink{
+		meter:      meterProvider.Meter(instrumentationName),
+		histograms: map[string]metric.Float64Histogram{},
+		counters:   map[string]metric.Int64Counter{},
+	}
+}
+
+func (s *OpenTelemetrySink) ObserveDuration(name string, labels map[string]string, d time.Duration) {
+	h, err := s.histogram(name)
+	if err != nil {
+		return
+	}
+
+	h.Record(context.Background(), d.Seconds(), metric.WithAttributes(attributes(labels)...))
+}
+
+func (s *OpenTelemetrySink) IncCounter(name string, labels map[string]string) {
+	c, err := s.counter(name)
+	if err != nil {
+		return
+	}
+
+	c.Add(context.Background(), 1, metric.WithAttributes(attributes(labels)...))
+}
+
+func (s *OpenTelemetrySink) histogram(name string) (metric.Float64Histogram, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if h, ok := s.histograms[name]; ok {
+		return h, nil
+	}
+
+	h, err := s.meter.Float64Histogram(name, metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	s.histograms[name] = h
+	return h, nil
+}
+
+func (s *OpenTelemetrySink) counter(name string) (metric.Int64Counter, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if c, ok := s.counters[name]; ok {
+		return c, nil
+	}
+
+	c, err := s.meter.Int64Counter(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.counters[name] = c
+	return c, nil
+}
+
+func attributes(labels map[string]string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for _, k := range labelNames(labels) {
+		attrs = append(attrs, attribute.String(k, labels[k]))
+	}
+	return attrs
+}
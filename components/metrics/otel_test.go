@@ -0,0 +1,58 @@
+package metrics_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
+)
+
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	collected := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			collected[m.Name] = m.Data
+		}
+	}
+	return collected
+}
+
+func TestOpenTelemetrySink(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	sink := metrics.NewOpenTelemetrySink(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	sink.ObserveDuration(metrics.MetricPublishTime, map[string]string{"success": "true"}, 2*time.Second)
+	sink.ObserveDuration(metrics.MetricPublishTime, map[string]string{"success": "true"}, time.Second)
+	sink.IncCounter(metrics.MetricSubscriberMessagesReceived, map[string]string{"acked": "acked"})
+	sink.IncCounter(metrics.MetricSubscriberMessagesReceived, map[string]string{"acked": "nacked"})
+
+	collected := collectMetrics(t, reader)
+
+	histogram, ok := collected[metrics.MetricPublishTime].(metricdata.Histogram[float64])
+	require.True(t, ok, "publish time should be a float histogram")
+	require.Len(t, histogram.DataPoints, 1)
+	assert.EqualValues(t, 2, histogram.DataPoints[0].Count)
+	assert.EqualValues(t, 3, histogram.DataPoints[0].Sum)
+	assert.Equal(t, attribute.NewSet(attribute.String("success", "true")), histogram.DataPoints[0].Attributes)
+
+	counter, ok := collected[metrics.MetricSubscriberMessagesReceived].(metricdata.Sum[int64])
+	require.True(t, ok, "messages received should be an int counter")
+	require.Len(t, counter.DataPoints, 2)
+
+	values := map[string]int64{}
+	for _, dp := range counter.DataPoints {
+		acked, _ := dp.Attributes.Value("acked")
+		values[acked.AsString()] = dp.Value
+	}
+	assert.Equal(t, map[string]int64{"acked": 1, "nacked": 1}, values)
+}
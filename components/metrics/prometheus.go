@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+var (
+	// handlerExecutionTimeBuckets are one order of magnitude smaller than default buckets (5ms~10s),
+	// because the handler execution times are typically shorter (µs~ms range).
+	handlerExecutionTimeBuckets = []float64{
+		0.0005,
+		0.001,
+		0.0025,
+		0.005,
+		0.01,
+		0.025,
+		0.05,
+		0.1,
+		0.25,
+		0.5,
+		1,
+	}
+
+	prometheusHelp = map[string]string{
+		MetricPublishTime:                "The time that a publishing attempt (success or not) took in seconds",
+		MetricSubscriberMessagesReceived: "The total number of messages received by the subscriber",
+		MetricHandlerExecutionTime:       "The total time elapsed while executing the handler function in seconds",
+	}
+
+	prometheusBuckets = map[string][]float64{
+		MetricHandlerExecutionTime: handlerExecutionTimeBuckets,
+	}
+)
+
+// PrometheusSink is a MetricsSink exporting metrics to Prometheus.
+// Durations are recorded as histograms in seconds.
+//
+// Collectors are registered on the first use of the metric name, with the label names of that observation.
+// Metrics which can't be registered, or whose label names differ from the registered ones, are dropped
+// and the error is passed to OnError.
+type PrometheusSink struct {
+	// OnError is called with the errors of dropped metrics. By default, the errors are logged.
+	OnError func(name string, err error)
+
+	registerer prometheus.Registerer
+	namespace  string
+	subsystem  string
+
+	histograms map[string]*prometheus.HistogramVec
+	counters   map[string]*prometheus.CounterVec
+	lock       sync.Mutex
+}
+
+// NewPrometheusSink creates a PrometheusSink. If registry is nil, the default Prometheus registry is used.
+func NewPrometheusSink(registry *prometheus.Registry, namespace string, subsystem string) *PrometheusSink {
+	var registerer prometheus.Registerer = prometheus.DefaultRegisterer
+	if registry != nil {
+		registerer = registry
+	}
+
+	logger := watermill.NewStdLogger(false, false)
+
+	return &PrometheusSink{
+		OnError: func(name string, err error) {
+			logger.Error("Cannot record Prometheus metric", err, watermill.LogFields{"metric": name})
+		},
+		registerer: registerer,
+		namespace:  namespace,
+		subsystem:  subsystem,
+		histograms: map[string]*prometheus.HistogramVec{},
+		counters:   map[string]*prometheus.CounterVec{},
+	}
+}
+
+func (s *PrometheusSink) ObserveDuration(name string, labels map[string]string, d time.Duration) {
+	h, err := s.histogramVec(name, labelNames(labels))
+	if err != nil {
+		s.onError(name, err)
+		return
+	}
+
+	o, err := h.GetMetricWith(labels)
+	if err != nil {
+		s.onError(name, err)
+		return
+	}
+	o.Observe(d.Seconds())
+}
+
+func (s *PrometheusSink) IncCounter(name string, labels map[string]string) {
+	c, err := s.counterVec(name, labelNames(labels))
+	if err != nil {
+		s.onError(name, err)
+		return
+	}
+
+	counter, err := c.GetMetricWith(labels)
+	if err != nil {
+		s.onError(name, err)
+		return
+	}
+	counter.Inc()
+}
+
+func (s *PrometheusSink) onError(name string, err error) {
+	if s.OnError != nil {
+		s.OnError(name, err)
+	}
+}
+
+func (s *PrometheusSink) histogramVec(name string, labelNames []string) (*prometheus.HistogramVec, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if h, ok := s.histograms[name]; ok {
+		return h, nil
+	}
+
+	col, err := s.register(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: s.namespace,
+			Subsystem: s.subsystem,
+			Name:      name,
+			Help:      help(name),
+			Buckets:   prometheusBuckets[name],
+		},
+		labelNames,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	h, ok := col.(*prometheus.HistogramVec)
+	if !ok {
+		return nil, errors.Errorf("metric %s is already registered with a different type", name)
+	}
+	s.histograms[name] = h
+	return h, nil
+}
+
+func (s *PrometheusSink) counterVec(name string, labelNames []string) (*prometheus.CounterVec, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if c, ok := s.counters[name]; ok {
+		return c, nil
+	}
+
+	col, err := s.register(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: s.namespace,
+			Subsystem: s.subsystem,
+			Name:      name,
+			Help:      help(name),
+		},
+		labelNames,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	c, ok := col.(*prometheus.CounterVec)
+	if !ok {
+		return nil, errors.Errorf("metric %s is already registered with a different type", name)
+	}
+	s.counters[name] = c
+	return c, nil
+}
+
+func (s *PrometheusSink) register(c prometheus.Collector) (prometheus.Collector, error) {
+	err := s.registerer.Register(c)
+	if err == nil {
+		return c, nil
+	}
+
+	if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		return are.ExistingCollector, nil
+	}
+
+	return nil, err
+}
+
+func help(name string) string {
+	if h, ok := prometheusHelp[name]; ok {
+		return h
+	}
+	return name
+}
+
+func labelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,120 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+)
+
+func gatherMetric(t *testing.T, registry *prometheus.Registry, name string) *dto.MetricFamily {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	for _, f := range families {
+		if f.GetName() == name {
+			return f
+		}
+	}
+
+	t.Fatalf("metric %s not found", name)
+	return nil
+}
+
+func metricLabels(m *dto.Metric) map[string]string {
+	labels := map[string]string{}
+	for _, l := range m.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	return labels
+}
+
+func TestPrometheusSink(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	sink := metrics.NewPrometheusSink(registry, "ns", "sub")
+
+	sink.ObserveDuration("operation_seconds", map[string]string{"a": "1"}, 2*time.Second)
+	sink.ObserveDuration("operation_seconds", map[string]string{"a": "1"}, time.Second)
+	sink.IncCounter("operations_total", map[string]string{"a": "1", "b": "2"})
+
+	var droppedMetrics []string
+	sink.OnError = func(name string, err error) {
+		assert.Error(t, err)
+		droppedMetrics = append(droppedMetrics, name)
+	}
+
+	// labels not matching the registered ones are dropped
+	sink.IncCounter("operations_total", map[string]string{"a": "1"})
+	assert.Equal(t, []string{"operations_total"}, droppedMetrics)
+
+	histogram := gatherMetric(t, registry, "ns_sub_operation_seconds")
+	require.Len(t, histogram.GetMetric(), 1)
+	assert.Equal(t, map[string]string{"a": "1"}, metricLabels(histogram.GetMetric()[0]))
+	assert.EqualValues(t, 2, histogram.GetMetric()[0].GetHistogram().GetSampleCount())
+	assert.EqualValues(t, 3, histogram.GetMetric()[0].GetHistogram().GetSampleSum())
+
+	counter := gatherMetric(t, registry, "ns_sub_operations_total")
+	require.Len(t, counter.GetMetric(), 1)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, metricLabels(counter.GetMetric()[0]))
+	assert.EqualValues(t, 1, counter.GetMetric()[0].GetCounter().GetValue())
+}
+
+func TestPrometheusMetricsBuilder(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	builder := metrics.NewPrometheusMetricsBuilder(registry, "", "")
+
+	pub, err := builder.DecoratePublisher(publisherMock{})
+	require.NoError(t, err)
+	assert.IsType(t, metrics.PublisherPrometheusMetricsDecorator{}, pub)
+
+	// the collectors already registered by the first decorator are reused
+	_, err = builder.DecoratePublisher(publisherMock{})
+	require.NoError(t, err)
+
+	require.NoError(t, pub.Publish("topic", message.NewMessage(watermill.NewUUID(), nil)))
+
+	sub, err := builder.DecorateSubscriber(gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{}))
+	require.NoError(t, err)
+	assert.IsType(t, &metrics.SubscriberPrometheusMetricsDecorator{}, sub)
+	require.NoError(t, sub.Close())
+
+	h := builder.NewRouterMiddleware().Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	})
+	_, err = h(message.NewMessage(watermill.NewUUID(), nil))
+	require.NoError(t, err)
+
+	publishTime := gatherMetric(t, registry, metrics.MetricPublishTime)
+	require.Len(t, publishTime.GetMetric(), 1)
+	assert.Equal(t, map[string]string{
+		"handler_name":   "<no handler>",
+		"publisher_name": "metrics_test.publisherMock",
+		"success":        "true",
+	}, metricLabels(publishTime.GetMetric()[0]))
+
+	handlerTime := gatherMetric(t, registry, metrics.MetricHandlerExecutionTime)
+	require.Len(t, handlerTime.GetMetric(), 1)
+	// handler execution time has smaller buckets than the default ones
+	assert.EqualValues(t, 0.0005, handlerTime.GetMetric()[0].GetHistogram().GetBucket()[0].GetUpperBound())
+}
+
+func TestPrometheusMetricsBuilder_registration_error(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: metrics.MetricPublishTime,
+		Help: "conflicting metric",
+	})))
+
+	builder := metrics.NewPrometheusMetricsBuilder(registry, "", "")
+
+	_, err := builder.DecoratePublisher(publisherMock{})
+	assert.Error(t, err)
+}
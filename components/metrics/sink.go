@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/internal"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Names of the metrics reported to MetricsSink. They are the same as the names of Prometheus metrics.
+const (
+	MetricPublishTime                = "publish_time_seconds"
+	MetricSubscriberMessagesReceived = "subscriber_messages_received_total"
+	MetricHandlerExecutionTime       = "handler_execution_time_seconds"
+)
+
+// MetricsSink receives metrics of publishers, subscribers and handlers.
+// Implementations are provided for Prometheus (PrometheusSink), OpenTelemetry (OpenTelemetrySink)
+// and StatsD (StatsDSink).
+//
+// Implementations must be safe for concurrent use.
+type MetricsSink interface {
+	// ObserveDuration records the duration of a single operation.
+	ObserveDuration(name string, labels map[string]string, d time.Duration)
+
+	// IncCounter increments the counter by one.
+	IncCounter(name string, labels map[string]string)
+}
+
+// SinkMetricsBuilder provides methods to decorate publishers, subscribers and handlers with metrics reported to the Sink.
+// PrometheusMetricsBuilder is a SinkMetricsBuilder reporting to PrometheusSink.
+type SinkMetricsBuilder struct {
+	Sink MetricsSink
+}
+
+// AddRouterMetrics acts on the message router to add the metrics middleware to all its handlers.
+// The handlers' publishers and subscribers are also decorated.
+func (b SinkMetricsBuilder) AddRouterMetrics(r *message.Router) {
+	r.AddPublisherDecorators(b.DecoratePublisher)
+	r.AddSubscriberDecorators(b.DecorateSubscriber)
+	r.AddMiddleware(b.NewRouterMiddleware().Middleware)
+}
+
+// DecoratePublisher wraps the underlying publisher with metrics.
+func (b SinkMetricsBuilder) DecoratePublisher(pub message.Publisher) (message.Publisher, error) {
+	return b.publisherDecorator(pub), nil
+}
+
+func (b SinkMetricsBuilder) publisherDecorator(pub message.Publisher) PublisherSinkMetricsDecorator {
+	return PublisherSinkMetricsDecorator{
+		pub:           pub,
+		publisherName: internal.StructName(pub),
+		sink:          b.Sink,
+	}
+}
+
+// DecorateSubscriber wraps the underlying subscriber with metrics.
+func (b SinkMetricsBuilder) DecorateSubscriber(sub message.Subscriber) (message.Subscriber, error) {
+	return b.subscriberDecorator(sub)
+}
+
+func (b SinkMetricsBuilder) subscriberDecorator(sub message.Subscriber) (*SubscriberSinkMetricsDecorator, error) {
+	var err error
+	d := &SubscriberSinkMetricsDecorator{
+		subscriberName: internal.StructName(sub),
+		sink:           b.Sink,
+	}
+
+	d.Subscriber, err = message.MessageTransformSubscriberDecorator(d.recordMetrics)(sub)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decorate subscriber with metrics decorator")
+	}
+
+	return d, nil
+}
+
+func (b SinkMetricsBuilder) DecoratePubSub(pubSub message.PubSub) (message.PubSub, error) {
+	pub, err := b.DecoratePublisher(pubSub)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := b.DecorateSubscriber(pubSub)
+	if err != nil {
+		return nil, err
+	}
+
+	return message.NewPubSub(pub, sub), nil
+}
+
+func (b SinkMetricsBuilder) NewRouterMiddleware() HandlerSinkMetricsMiddleware {
+	return HandlerSinkMetricsMiddleware{sink: b.Sink}
+}
+
+type HandlerSinkMetricsMiddleware struct {
+	sink MetricsSink
+}
+
+func (m HandlerSinkMetricsMiddleware) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) (msgs []*message.Message, err error) {
+		now := time.Now()
+		labels := map[string]string{
+			labelKeyHandlerName: message.HandlerNameFromCtx(msg.Context()),
+		}
+
+		defer func() {
+			labels[labelSuccess] = successLabelValue(err)
+			m.sink.ObserveDuration(MetricHandlerExecutionTime, labels, time.Since(now))
+		}()
+
+		return h(msg)
+	}
+}
+
+type PublisherSinkMetricsDecorator struct {
+	pub           message.Publisher
+	publisherName string
+	sink          MetricsSink
+}
+
+// Publish reports the publish time to the sink and calls the wrapped publisher's Publish.
+func (m PublisherSinkMetricsDecorator) Publish(topic string, messages ...*message.Message) (err error) {
+	if len(messages) == 0 {
+		return m.pub.Publish(topic)
+	}
+
+	ctx := messages[0].Context()
+	labels := labelsFromCtx(ctx, publisherLabelKeys...)
+	if labels[labelKeyPublisherName] == "" {
+		labels[labelKeyPublisherName] = m.publisherName
+	}
+	if labels[labelKeyHandlerName] == "" {
+		labels[labelKeyHandlerName] = labelValueNoHandler
+	}
+	start := time.Now()
+
+	defer func() {
+		if publishAlreadyObserved(ctx) {
+			// decorator idempotency when applied decorator multiple times
+			return
+		}
+
+		labels[labelSuccess] = successLabelValue(err)
+		m.sink.ObserveDuration(MetricPublishTime, labels, time.Since(start))
+	}()
+
+	for _, msg := range messages {
+		msg.SetContext(setPublishObservedToCtx(msg.Context()))
+	}
+
+	return m.pub.Publish(topic, messages...)
+}
+
+func (m PublisherSinkMetricsDecorator) Close() error {
+	return m.pub.Close()
+}
+
+type SubscriberSinkMetricsDecorator struct {
+	message.Subscriber
+	subscriberName string
+	sink           MetricsSink
+}
+
+func (s SubscriberSinkMetricsDecorator) recordMetrics(msg *message.Message) {
+	if msg == nil {
+		return
+	}
+
+	ctx := msg.Context()
+	labels := labelsFromCtx(ctx, subscriberLabelKeys...)
+	if labels[labelKeySubscriberName] == "" {
+		labels[labelKeySubscriberName] = s.subscriberName
+	}
+	if labels[labelKeyHandlerName] == "" {
+		labels[labelKeyHandlerName] = labelValueNoHandler
+	}
+
+	go func() {
+		if subscribeAlreadyObserved(ctx) {
+			// decorator idempotency when applied decorator multiple times
+			return
+		}
+
+		select {
+		case <-msg.Acked():
+			labels[labelAcked] = "acked"
+		case <-msg.Nacked():
+			labels[labelAcked] = "nacked"
+		}
+		s.sink.IncCounter(MetricSubscriberMessagesReceived, labels)
+	}()
+
+	msg.SetContext(setSubscribeObservedToCtx(msg.Context()))
+}
+
+func successLabelValue(err error) string {
+	if err != nil {
+		return "false"
+	}
+	return "true"
+}
@@ -0,0 +1,154 @@
+package metrics_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+)
+
+type recordedMetric struct {
+	Name   string
+	Labels map[string]string
+}
+
+type recordingSink struct {
+	durations []recordedMetric
+	counters  []recordedMetric
+	lock      sync.Mutex
+}
+
+func (s *recordingSink) ObserveDuration(name string, labels map[string]string, d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.durations = append(s.durations, recordedMetric{name, labels})
+}
+
+func (s *recordingSink) IncCounter(name string, labels map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.counters = append(s.counters, recordedMetric{name, labels})
+}
+
+func (s *recordingSink) Durations() []recordedMetric {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]recordedMetric(nil), s.durations...)
+}
+
+func (s *recordingSink) Counters() []recordedMetric {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]recordedMetric(nil), s.counters...)
+}
+
+type publisherMock struct {
+	err error
+}
+
+func (p publisherMock) Publish(topic string, messages ...*message.Message) error {
+	return p.err
+}
+
+func (p publisherMock) Close() error {
+	return nil
+}
+
+func TestSinkMetricsBuilder_DecoratePublisher(t *testing.T) {
+	sink := &recordingSink{}
+	builder := metrics.SinkMetricsBuilder{Sink: sink}
+
+	pub, err := builder.DecoratePublisher(publisherMock{})
+	require.NoError(t, err)
+	failingPub, err := builder.DecoratePublisher(publisherMock{err: errors.New("failed")})
+	require.NoError(t, err)
+
+	require.NoError(t, pub.Publish("topic", message.NewMessage(watermill.NewUUID(), nil)))
+	require.Error(t, failingPub.Publish("topic", message.NewMessage(watermill.NewUUID(), nil)))
+
+	assert.Equal(t, []recordedMetric{
+		{
+			Name: metrics.MetricPublishTime,
+			Labels: map[string]string{
+				"handler_name":   "<no handler>",
+				"publisher_name": "metrics_test.publisherMock",
+				"success":        "true",
+			},
+		},
+		{
+			Name: metrics.MetricPublishTime,
+			Labels: map[string]string{
+				"handler_name":   "<no handler>",
+				"publisher_name": "metrics_test.publisherMock",
+				"success":        "false",
+			},
+		},
+	}, sink.Durations())
+}
+
+func TestSinkMetricsBuilder_DecorateSubscriber(t *testing.T) {
+	sink := &recordingSink{}
+	builder := metrics.SinkMetricsBuilder{Sink: sink}
+
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	defer pubSub.Close()
+
+	sub, err := builder.DecorateSubscriber(pubSub)
+	require.NoError(t, err)
+
+	messages, err := sub.Subscribe(context.Background(), "topic")
+	require.NoError(t, err)
+
+	require.NoError(t, pubSub.Publish("topic", message.NewMessage(watermill.NewUUID(), nil)))
+
+	select {
+	case msg := <-messages:
+		msg.Ack()
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	require.Eventually(t, func() bool {
+		return len(sink.Counters()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, recordedMetric{
+		Name: metrics.MetricSubscriberMessagesReceived,
+		Labels: map[string]string{
+			"handler_name":    "<no handler>",
+			"subscriber_name": "gochannel.GoChannel",
+			"acked":           "acked",
+		},
+	}, sink.Counters()[0])
+}
+
+func TestSinkMetricsBuilder_NewRouterMiddleware(t *testing.T) {
+	sink := &recordingSink{}
+	builder := metrics.SinkMetricsBuilder{Sink: sink}
+
+	h := builder.NewRouterMiddleware().Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, errors.New("failed")
+	})
+
+	_, err := h(message.NewMessage(watermill.NewUUID(), nil))
+	require.Error(t, err)
+
+	assert.Equal(t, []recordedMetric{
+		{
+			Name: metrics.MetricHandlerExecutionTime,
+			Labels: map[string]string{
+				"handler_name": "",
+				"success":      "false",
+			},
+		},
+	}, sink.Durations())
+}
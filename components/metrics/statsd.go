@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type StatsDFormat int
+
+const (
+	// StatsDFormatPlain appends the label values to the metric name, because the plain StatsD protocol has no tags.
+	StatsDFormatPlain StatsDFormat = iota
+	// StatsDFormatDogStatsD sends labels as DogStatsD tags, supported by the Datadog agent.
+	StatsDFormatDogStatsD
+)
+
+type StatsDSinkConfig struct {
+	// Addr is the UDP address of the StatsD server (or the Datadog agent), for example "localhost:8125".
+	Addr string
+
+	// Prefix is prepended to all metric names, for example "myservice.watermill.".
+	Prefix string
+
+	Format StatsDFormat
+}
+
+func (c StatsDSinkConfig) Validate() error {
+	if c.Addr == "" {
+		return errors.New("missing Addr")
+	}
+	if c.Format != StatsDFormatPlain && c.Format != StatsDFormatDogStatsD {
+		return errors.Errorf("unknown StatsD format %d", c.Format)
+	}
+
+	return nil
+}
+
+// StatsDSink is a MetricsSink sending metrics to StatsD or DogStatsD over UDP.
+// Durations are sent as timings in milliseconds.
+//
+// Errors of sending metrics are ignored, as metrics are sent on a best-effort basis.
+type StatsDSink struct {
+	config StatsDSinkConfig
+
+	conn     net.Conn
+	connLock sync.Mutex
+}
+
+func NewStatsDSink(config StatsDSinkConfig) (*StatsDSink, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid StatsD sink config")
+	}
+
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot connect to StatsD at %s", config.Addr)
+	}
+
+	return &StatsDSink{config: config, conn: conn}, nil
+}
+
+func (s *StatsDSink) ObserveDuration(name string, labels map[string]string, d time.Duration) {
+	s.send(name, labels, fmt.Sprintf("%g|ms", float64(d)/float64(time.Millisecond)))
+}
+
+func (s *StatsDSink) IncCounter(name string, labels map[string]string) {
+	s.send(name, labels, "1|c")
+}
+
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsDSink) send(name string, labels map[string]string, value string) {
+	line := s.line(name, labels, value)
+
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+
+	_, _ = s.conn.Write([]byte(line))
+}
+
+func (s *StatsDSink) line(name string, labels map[string]string, value string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if s.config.Format == StatsDFormatDogStatsD {
+		tags := make([]string, 0, len(keys))
+		for _, k := range keys {
+			tags = append(tags, k+":"+sanitizeStatsD(labels[k]))
+		}
+
+		line := s.config.Prefix + name + ":" + value
+		if len(tags) > 0 {
+			line += "|#" + strings.Join(tags, ",")
+		}
+		return line
+	}
+
+	parts := []string{s.config.Prefix + name}
+	for _, k := range keys {
+		parts = append(parts, sanitizeStatsD(labels[k]))
+	}
+
+	return strings.Join(parts, ".") + ":" + value
+}
+
+var statsDReplacer = strings.NewReplacer(
+	":", "_",
+	"|", "_",
+	"#", "_",
+	",", "_",
+	"@", "_",
+	".", "_",
+	" ", "_",
+	"<", "",
+	">", "",
+)
+
+func sanitizeStatsD(s string) string {
+	return statsDReplacer.Replace(s)
+}
@@ -0,0 +1,83 @@
+package metrics_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
+)
+
+func newStatsDServer(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func readStatsDLine(t *testing.T, conn net.PacketConn) string {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	return string(buf[:n])
+}
+
+func TestStatsDSink(t *testing.T) {
+	labels := map[string]string{
+		"success":      "true",
+		"handler_name": "handler.name:1",
+	}
+
+	testCases := []struct {
+		Name             string
+		Format           metrics.StatsDFormat
+		ExpectedDuration string
+		ExpectedCounter  string
+	}{
+		{
+			Name:             "plain",
+			Format:           metrics.StatsDFormatPlain,
+			ExpectedDuration: "app.publish_time_seconds.handler_name_1.true:1500|ms",
+			ExpectedCounter:  "app.subscriber_messages_received_total.handler_name_1.true:1|c",
+		},
+		{
+			Name:             "dogstatsd",
+			Format:           metrics.StatsDFormatDogStatsD,
+			ExpectedDuration: "app.publish_time_seconds:1500|ms|#handler_name:handler_name_1,success:true",
+			ExpectedCounter:  "app.subscriber_messages_received_total:1|c|#handler_name:handler_name_1,success:true",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := newStatsDServer(t)
+
+			sink, err := metrics.NewStatsDSink(metrics.StatsDSinkConfig{
+				Addr:   server.LocalAddr().String(),
+				Prefix: "app.",
+				Format: tc.Format,
+			})
+			require.NoError(t, err)
+			defer sink.Close()
+
+			sink.ObserveDuration(metrics.MetricPublishTime, labels, 1500*time.Millisecond)
+			assert.Equal(t, tc.ExpectedDuration, readStatsDLine(t, server))
+
+			sink.IncCounter(metrics.MetricSubscriberMessagesReceived, labels)
+			assert.Equal(t, tc.ExpectedCounter, readStatsDLine(t, server))
+		})
+	}
+}
+
+func TestStatsDSinkConfig_Validate(t *testing.T) {
+	assert.Error(t, metrics.StatsDSinkConfig{}.Validate())
+	assert.Error(t, metrics.StatsDSinkConfig{Addr: "localhost:8125", Format: 42}.Validate())
+	assert.NoError(t, metrics.StatsDSinkConfig{Addr: "localhost:8125"}.Validate())
+}
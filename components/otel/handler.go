@@ -0,0 +1,72 @@
+package otel
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Attributes of spans and metrics.
+const (
+	AttributeHandlerName   = attribute.Key("watermill.handler_name")
+	AttributeTopic         = attribute.Key("watermill.topic")
+	AttributeMessageUUID   = attribute.Key("watermill.message_uuid")
+	AttributePublisherName = attribute.Key("watermill.publisher_name")
+	AttributeSuccess       = attribute.Key("watermill.success")
+)
+
+// Middleware records the span and the duration of every handler execution.
+//
+// The span is a child of the trace context propagated in the message's metadata.
+// Messages produced by the handler are published in the context of the span.
+func (i *Instrumentation) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) (producedMessages []*message.Message, err error) {
+		handlerName := message.HandlerNameFromCtx(msg.Context())
+		topic := message.SubscribeTopicFromCtx(msg.Context())
+
+		ctx := i.config.Propagator.Extract(msg.Context(), metadataCarrier(msg.Metadata))
+		ctx, span := i.tracer.Start(
+			ctx,
+			handlerName,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				AttributeHandlerName.String(handlerName),
+				AttributeTopic.String(topic),
+				AttributeMessageUUID.String(msg.UUID),
+			),
+		)
+		defer span.End()
+
+		msg.SetContext(ctx)
+		start := time.Now()
+
+		producedMessages, err = h(msg)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		i.handlerDuration.Record(
+			ctx,
+			time.Since(start).Seconds(),
+			metric.WithAttributes(
+				AttributeHandlerName.String(handlerName),
+				AttributeSuccess.Bool(err == nil),
+			),
+		)
+
+		for _, produced := range producedMessages {
+			if !trace.SpanContextFromContext(produced.Context()).IsValid() {
+				produced.SetContext(ctx)
+			}
+		}
+
+		return producedMessages, err
+	}
+}
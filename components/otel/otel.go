@@ -0,0 +1,117 @@
+// Package otel provides OpenTelemetry tracing and metrics for handlers and publishers.
+//
+// Only the OpenTelemetry API is used, so the exporters are configured with the TracerProvider and MeterProvider
+// passed in Config (or the global ones).
+package otel
+
+import (
+	"github.com/pkg/errors"
+	otelapi "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const instrumentationName = "github.com/ThreeDotsLabs/watermill/components/otel"
+
+// Names of the recorded metrics.
+const (
+	MetricHandlerDuration = "watermill.handler.duration"
+	MetricPublishDuration = "watermill.publish.duration"
+)
+
+type Config struct {
+	// TracerProvider defaults to the global TracerProvider.
+	TracerProvider trace.TracerProvider
+
+	// MeterProvider defaults to the global MeterProvider.
+	MeterProvider metric.MeterProvider
+
+	// Propagator propagates the trace context in the messages' metadata.
+	// Defaults to the global TextMapPropagator.
+	Propagator propagation.TextMapPropagator
+}
+
+func (c *Config) setDefaults() {
+	if c.TracerProvider == nil {
+		c.TracerProvider = otelapi.GetTracerProvider()
+	}
+	if c.MeterProvider == nil {
+		c.MeterProvider = otelapi.GetMeterProvider()
+	}
+	if c.Propagator == nil {
+		c.Propagator = otelapi.GetTextMapPropagator()
+	}
+}
+
+// Instrumentation provides the handler middleware and the publisher decorator, which record spans
+// and duration histograms.
+//
+// Durations are recorded with the context of the span, so exemplars linking the metrics to the traces
+// are attached by the SDK (when it's configured to do so).
+type Instrumentation struct {
+	config Config
+
+	tracer trace.Tracer
+
+	handlerDuration metric.Float64Histogram
+	publishDuration metric.Float64Histogram
+}
+
+func NewInstrumentation(config Config) (*Instrumentation, error) {
+	config.setDefaults()
+
+	meter := config.MeterProvider.Meter(instrumentationName)
+
+	handlerDuration, err := meter.Float64Histogram(
+		MetricHandlerDuration,
+		metric.WithDescription("The duration of the handler execution"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create handler duration histogram")
+	}
+
+	publishDuration, err := meter.Float64Histogram(
+		MetricPublishDuration,
+		metric.WithDescription("The duration of publishing"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publish duration histogram")
+	}
+
+	return &Instrumentation{
+		config:          config,
+		tracer:          config.TracerProvider.Tracer(instrumentationName),
+		handlerDuration: handlerDuration,
+		publishDuration: publishDuration,
+	}, nil
+}
+
+// AddRouterInstrumentation adds the middleware to all router's handlers and decorates their publishers.
+func (i *Instrumentation) AddRouterInstrumentation(r *message.Router) {
+	r.AddPublisherDecorators(i.DecoratePublisher)
+	r.AddMiddleware(i.Middleware)
+}
+
+// metadataCarrier allows to propagate the trace context in the message's metadata.
+type metadataCarrier message.Metadata
+
+func (c metadataCarrier) Get(key string) string {
+	return message.Metadata(c).Get(key)
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	message.Metadata(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,108 @@
+package otel_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/otel"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type publisherMock struct {
+	published []*message.Message
+}
+
+func (p *publisherMock) Publish(topic string, messages ...*message.Message) error {
+	p.published = append(p.published, messages...)
+	return nil
+}
+
+func (p *publisherMock) Close() error {
+	return nil
+}
+
+func newInstrumentation(t *testing.T) (*otel.Instrumentation, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	spanRecorder := tracetest.NewSpanRecorder()
+	metricReader := sdkmetric.NewManualReader()
+
+	instrumentation, err := otel.NewInstrumentation(otel.Config{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader)),
+		Propagator:     propagation.TraceContext{},
+	})
+	require.NoError(t, err)
+
+	return instrumentation, spanRecorder, metricReader
+}
+
+func findHistogram(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Histogram[float64] {
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data.(metricdata.Histogram[float64])
+			}
+		}
+	}
+
+	t.Fatalf("metric %s not found", name)
+	return metricdata.Histogram[float64]{}
+}
+
+func TestInstrumentation(t *testing.T) {
+	instrumentation, spanRecorder, metricReader := newInstrumentation(t)
+
+	pub := &publisherMock{}
+	decoratedPub, err := instrumentation.DecoratePublisher(pub)
+	require.NoError(t, err)
+
+	// the message published outside of the handler carries the trace context to the handler
+	require.NoError(t, decoratedPub.Publish("topic", message.NewMessage(watermill.NewUUID(), nil)))
+	require.Len(t, pub.published, 1)
+	publishedMsg := pub.published[0]
+	assert.NotEmpty(t, publishedMsg.Metadata.Get("traceparent"))
+
+	handler := instrumentation.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return []*message.Message{message.NewMessage(watermill.NewUUID(), nil)}, nil
+	})
+
+	producedMessages, err := handler(publishedMsg)
+	require.NoError(t, err)
+	require.Len(t, producedMessages, 1)
+
+	spans := spanRecorder.Ended()
+	require.Len(t, spans, 2)
+	publishSpan, handlerSpan := spans[0], spans[1]
+
+	assert.Equal(t, trace.SpanKindProducer, publishSpan.SpanKind())
+	assert.Equal(t, trace.SpanKindConsumer, handlerSpan.SpanKind())
+	assert.Equal(t, publishSpan.SpanContext().TraceID(), handlerSpan.SpanContext().TraceID())
+	assert.Equal(t, publishSpan.SpanContext().SpanID(), handlerSpan.Parent().SpanID())
+
+	// produced messages are published in the context of the handler's span
+	assert.Equal(
+		t,
+		handlerSpan.SpanContext().SpanID(),
+		trace.SpanContextFromContext(producedMessages[0].Context()).SpanID(),
+	)
+
+	handlerDuration := findHistogram(t, metricReader, otel.MetricHandlerDuration)
+	require.Len(t, handlerDuration.DataPoints, 1)
+	assert.EqualValues(t, 1, handlerDuration.DataPoints[0].Count)
+
+	publishDuration := findHistogram(t, metricReader, otel.MetricPublishDuration)
+	require.Len(t, publishDuration.DataPoints, 1)
+	assert.EqualValues(t, 1, publishDuration.DataPoints[0].Count)
+}
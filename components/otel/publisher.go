@@ -0,0 +1,80 @@
+package otel
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ThreeDotsLabs/watermill/internal"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// DecoratePublisher wraps the publisher, so a span is recorded for every published message
+// and the trace context is propagated in the message's metadata.
+// The duration of every Publish call is recorded as well.
+func (i *Instrumentation) DecoratePublisher(pub message.Publisher) (message.Publisher, error) {
+	return &publisherDecorator{
+		pub:             pub,
+		publisherName:   internal.StructName(pub),
+		instrumentation: i,
+	}, nil
+}
+
+type publisherDecorator struct {
+	pub             message.Publisher
+	publisherName   string
+	instrumentation *Instrumentation
+}
+
+func (d *publisherDecorator) Publish(topic string, messages ...*message.Message) (err error) {
+	i := d.instrumentation
+
+	spans := make([]trace.Span, 0, len(messages))
+	for _, msg := range messages {
+		ctx, span := i.tracer.Start(
+			msg.Context(),
+			topic+" publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				AttributeTopic.String(topic),
+				AttributeMessageUUID.String(msg.UUID),
+				AttributePublisherName.String(d.publisherName),
+			),
+		)
+		i.config.Propagator.Inject(ctx, metadataCarrier(msg.Metadata))
+		spans = append(spans, span)
+	}
+
+	start := time.Now()
+	err = d.pub.Publish(topic, messages...)
+	duration := time.Since(start).Seconds()
+
+	for _, span := range spans {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	// the duration is recorded in the context of the first message, like in the metrics component
+	if len(messages) > 0 {
+		i.publishDuration.Record(
+			trace.ContextWithSpan(messages[0].Context(), spans[0]),
+			duration,
+			metric.WithAttributes(
+				AttributeHandlerName.String(message.HandlerNameFromCtx(messages[0].Context())),
+				AttributePublisherName.String(d.publisherName),
+				AttributeSuccess.Bool(err == nil),
+			),
+		)
+	}
+
+	return err
+}
+
+func (d *publisherDecorator) Close() error {
+	return d.pub.Close()
+}
@@ -0,0 +1,140 @@
+package payloadformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Format is the format of the message's payload.
+type Format string
+
+const (
+	FormatUnknown  Format = "unknown"
+	FormatJSON     Format = "json"
+	FormatProtobuf Format = "protobuf"
+	FormatAvroOCF  Format = "avro-ocf"
+	FormatGzip     Format = "gzip"
+)
+
+var (
+	gzipMagic    = []byte{0x1f, 0x8b}
+	avroOCFMagic = []byte{'O', 'b', 'j', 0x01}
+)
+
+// DefaultContentTypes maps the values of the content type metadata to formats.
+var DefaultContentTypes = map[string]Format{
+	"application/json":       FormatJSON,
+	"application/protobuf":   FormatProtobuf,
+	"application/x-protobuf": FormatProtobuf,
+	"avro/binary":            FormatAvroOCF,
+	"application/avro":       FormatAvroOCF,
+	"application/gzip":       FormatGzip,
+	"application/x-gzip":     FormatGzip,
+}
+
+// Detect returns the format of the payload, based on its magic bytes.
+//
+// Protobuf has no magic bytes, so the payload is detected as protobuf when it can be fully parsed as protobuf wire format.
+// Empty payload is always unknown.
+func Detect(payload message.Payload) Format {
+	switch {
+	case len(payload) == 0:
+		return FormatUnknown
+	case bytes.HasPrefix(payload, gzipMagic):
+		return FormatGzip
+	case bytes.HasPrefix(payload, avroOCFMagic):
+		return FormatAvroOCF
+	case isJSON(payload):
+		return FormatJSON
+	case isProtobufWire(payload):
+		return FormatProtobuf
+	}
+
+	return FormatUnknown
+}
+
+// detectFromHint returns the format from the content type hint, or FormatUnknown when the hint is not known.
+func detectFromHint(contentType string, contentTypes map[string]Format) Format {
+	// parameters like `; charset=utf-8` are ignored
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+
+	if format, ok := contentTypes[contentType]; ok {
+		return format
+	}
+
+	return FormatUnknown
+}
+
+func isJSON(payload []byte) bool {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+
+	return json.Valid(trimmed)
+}
+
+// isProtobufWire checks if the payload is a valid sequence of protobuf fields.
+func isProtobufWire(payload []byte) bool {
+	for len(payload) > 0 {
+		tag, n := readVarint(payload)
+		if n == 0 {
+			return false
+		}
+		payload = payload[n:]
+
+		if tag>>3 == 0 {
+			// field number 0 is invalid
+			return false
+		}
+
+		switch tag & 0x7 {
+		case 0: // varint
+			_, n = readVarint(payload)
+			if n == 0 {
+				return false
+			}
+			payload = payload[n:]
+		case 1: // 64-bit
+			if len(payload) < 8 {
+				return false
+			}
+			payload = payload[8:]
+		case 2: // length-delimited
+			length, n := readVarint(payload)
+			if n == 0 || uint64(len(payload)-n) < length {
+				return false
+			}
+			payload = payload[n+int(length):]
+		case 5: // 32-bit
+			if len(payload) < 4 {
+				return false
+			}
+			payload = payload[4:]
+		default:
+			// groups are deprecated and not supported
+			return false
+		}
+	}
+
+	return true
+}
+
+// readVarint returns the decoded varint and the number of read bytes, or 0 bytes when the varint is invalid.
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+
+	return 0, 0
+}
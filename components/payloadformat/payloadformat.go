@@ -0,0 +1,181 @@
+// Package payloadformat provides a subscriber decorator, which detects the format of the messages' payloads
+// and converts them to the target format.
+//
+// It eases consuming topics with messages in heterogeneous formats, for example from legacy producers.
+package payloadformat
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// DetectedFormatMetadataKey is the metadata key with the detected format of the payload.
+	// When the payload was compressed, it's the format of the decompressed payload.
+	DetectedFormatMetadataKey = "detected_payload_format"
+
+	// DetectedCompressionMetadataKey is the metadata key with the compression of the payload, when it was compressed.
+	DetectedCompressionMetadataKey = "detected_payload_compression"
+
+	// DefaultHintMetadataKey is the default metadata key with the content type of the payload.
+	DefaultHintMetadataKey = "content_type"
+
+	// DefaultMaxDecompressedSize is the default maximum size of the decompressed payload, 32 MiB.
+	DefaultMaxDecompressedSize = 32 * 1024 * 1024
+)
+
+// ConvertFunc converts the payload to the target format.
+type ConvertFunc func(payload message.Payload) (message.Payload, error)
+
+type Config struct {
+	// Target is the format to which the payloads are converted. When empty, payloads are only detected
+	// (and decompressed), without the conversion.
+	Target Format
+
+	// Converters convert the payloads from the detected format to Target.
+	// When there is no converter for the detected format, the payload is passed as is.
+	Converters map[Format]ConvertFunc
+
+	// HintMetadataKey is the metadata key with the content type of the payload.
+	// When the content type is known, it has precedence over the magic bytes. Defaults to DefaultHintMetadataKey.
+	//
+	// The metadata is removed when the payload is decompressed or converted, because it describes the original payload.
+	HintMetadataKey string
+
+	// ContentTypes maps the content types from HintMetadataKey to formats. Defaults to DefaultContentTypes.
+	ContentTypes map[string]Format
+
+	// KeepCompressed disables decompression of gzip payloads.
+	KeepCompressed bool
+
+	// MaxDecompressedSize is the maximum size of the decompressed payload in bytes.
+	// Payloads exceeding it are passed compressed, to protect against decompression bombs.
+	// Defaults to DefaultMaxDecompressedSize.
+	MaxDecompressedSize int64
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.HintMetadataKey == "" {
+		c.HintMetadataKey = DefaultHintMetadataKey
+	}
+	if c.ContentTypes == nil {
+		c.ContentTypes = DefaultContentTypes
+	}
+	if c.MaxDecompressedSize == 0 {
+		c.MaxDecompressedSize = DefaultMaxDecompressedSize
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Target == FormatGzip || c.Target == FormatUnknown {
+		return errors.Errorf("invalid Target %s", c.Target)
+	}
+	if _, ok := c.Converters[c.Target]; ok {
+		return errors.Errorf("converter from the Target %s is not allowed", c.Target)
+	}
+	if c.MaxDecompressedSize < 0 {
+		return errors.New("MaxDecompressedSize cannot be negative")
+	}
+
+	return nil
+}
+
+// SubscriberDecorator creates a subscriber decorator, which detects the format of the received messages' payloads
+// and converts them to Config.Target.
+//
+// The detected format is stored in the DetectedFormatMetadataKey metadata. When the payload cannot be decompressed
+// or converted, the error is logged and the message is passed with the payload as is, so the handler can decide
+// what to do with it.
+func SubscriberDecorator(config Config) (message.SubscriberDecorator, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid payload format config")
+	}
+
+	n := normalizer{config: config}
+
+	return message.MessageTransformSubscriberDecorator(n.normalize), nil
+}
+
+type normalizer struct {
+	config Config
+}
+
+func (n normalizer) normalize(msg *message.Message) {
+	logFields := watermill.LogFields{"message_uuid": msg.UUID}
+
+	format := detectFromHint(msg.Metadata.Get(n.config.HintMetadataKey), n.config.ContentTypes)
+	if format == FormatUnknown {
+		format = Detect(msg.Payload)
+	}
+
+	if format == FormatGzip && !n.config.KeepCompressed {
+		payload, err := gunzip(msg.Payload, n.config.MaxDecompressedSize)
+		if err != nil {
+			n.config.Logger.Error("Cannot decompress payload", err, logFields)
+			msg.Metadata.Set(DetectedFormatMetadataKey, string(format))
+			return
+		}
+
+		msg.Payload = payload
+		msg.Metadata.Set(DetectedCompressionMetadataKey, string(FormatGzip))
+		// the hint describes the compressed payload, so only the magic bytes are used
+		delete(msg.Metadata, n.config.HintMetadataKey)
+		format = Detect(msg.Payload)
+	}
+
+	msg.Metadata.Set(DetectedFormatMetadataKey, string(format))
+
+	if n.config.Target == "" || format == n.config.Target {
+		return
+	}
+
+	convert, ok := n.config.Converters[format]
+	if !ok {
+		n.config.Logger.Trace("No converter for payload format", logFields.Add(watermill.LogFields{"format": format}))
+		return
+	}
+
+	payload, err := convert(msg.Payload)
+	if err != nil {
+		n.config.Logger.Error(
+			"Cannot convert payload",
+			err,
+			logFields.Add(watermill.LogFields{"format": format, "target": n.config.Target}),
+		)
+		return
+	}
+
+	msg.Payload = payload
+	delete(msg.Metadata, n.config.HintMetadataKey)
+}
+
+func gunzip(payload []byte, maxSize int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) > maxSize {
+		return nil, errors.Errorf("decompressed payload exceeds MaxDecompressedSize of %d bytes", maxSize)
+	}
+
+	return decompressed, nil
+}
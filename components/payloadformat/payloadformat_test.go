@@ -0,0 +1,152 @@
+package payloadformat_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/payloadformat"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+)
+
+func gzipPayload(t *testing.T, payload []byte) []byte {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write(payload)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Payload  []byte
+		Expected payloadformat.Format
+	}{
+		{"empty", nil, payloadformat.FormatUnknown},
+		{"json_object", []byte(` {"id": 1}`), payloadformat.FormatJSON},
+		{"json_array", []byte(`[1, 2]`), payloadformat.FormatJSON},
+		// field 1 (varint) = 150, field 2 (bytes) = "ab"
+		{"protobuf", []byte{0x08, 0x96, 0x01, 0x12, 0x02, 'a', 'b'}, payloadformat.FormatProtobuf},
+		{"protobuf_truncated", []byte{0x08, 0x96, 0x01, 0x12, 0x05, 'a', 'b'}, payloadformat.FormatUnknown},
+		{"avro_ocf", []byte{'O', 'b', 'j', 0x01, 0x02}, payloadformat.FormatAvroOCF},
+		{"gzip", gzipPayload(t, []byte("foo")), payloadformat.FormatGzip},
+		{"text", []byte("hello"), payloadformat.FormatUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, payloadformat.Detect(tc.Payload))
+		})
+	}
+}
+
+func TestSubscriberDecorator(t *testing.T) {
+	decorator, err := payloadformat.SubscriberDecorator(payloadformat.Config{
+		Target: payloadformat.FormatJSON,
+		Converters: map[payloadformat.Format]payloadformat.ConvertFunc{
+			payloadformat.FormatProtobuf: func(payload message.Payload) (message.Payload, error) {
+				return message.Payload(`{"converted": true}`), nil
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	sub, err := decorator(pubSub)
+	require.NoError(t, err)
+
+	messages, err := sub.Subscribe(context.Background(), "topic")
+	require.NoError(t, err)
+
+	gzippedJSON := message.NewMessage(watermill.NewUUID(), gzipPayload(t, []byte(`{"id": 1}`)))
+	gzippedJSON.Metadata.Set(payloadformat.DefaultHintMetadataKey, "application/gzip")
+	protobuf := message.NewMessage(watermill.NewUUID(), []byte{0x08, 0x96, 0x01})
+	hinted := message.NewMessage(watermill.NewUUID(), []byte("not really protobuf"))
+	hinted.Metadata.Set(payloadformat.DefaultHintMetadataKey, "application/x-protobuf; proto=Order")
+	unknown := message.NewMessage(watermill.NewUUID(), []byte("hello"))
+
+	published := make(chan error, 1)
+	go func() {
+		published <- pubSub.Publish("topic", gzippedJSON, protobuf, hinted, unknown)
+	}()
+
+	type expectedMessage struct {
+		Payload     string
+		Format      payloadformat.Format
+		Compression string
+	}
+	expected := map[string]expectedMessage{
+		gzippedJSON.UUID: {`{"id": 1}`, payloadformat.FormatJSON, "gzip"},
+		protobuf.UUID:    {`{"converted": true}`, payloadformat.FormatProtobuf, ""},
+		hinted.UUID:      {`{"converted": true}`, payloadformat.FormatProtobuf, ""},
+		unknown.UUID:     {"hello", payloadformat.FormatUnknown, ""},
+	}
+
+	for range expected {
+		select {
+		case msg := <-messages:
+			e, ok := expected[msg.UUID]
+			require.True(t, ok)
+
+			assert.Equal(t, e.Payload, string(msg.Payload))
+			assert.Equal(t, string(e.Format), msg.Metadata.Get(payloadformat.DetectedFormatMetadataKey))
+			assert.Equal(t, e.Compression, msg.Metadata.Get(payloadformat.DetectedCompressionMetadataKey))
+			assert.NotContains(t, msg.Metadata, payloadformat.DefaultHintMetadataKey, "hint of the original payload should be removed")
+			msg.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("message not received")
+		}
+	}
+
+	require.NoError(t, <-published)
+	require.NoError(t, sub.Close())
+}
+
+func TestSubscriberDecorator_max_decompressed_size(t *testing.T) {
+	decorator, err := payloadformat.SubscriberDecorator(payloadformat.Config{
+		MaxDecompressedSize: 1024,
+	})
+	require.NoError(t, err)
+
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	sub, err := decorator(pubSub)
+	require.NoError(t, err)
+
+	messages, err := sub.Subscribe(context.Background(), "topic")
+	require.NoError(t, err)
+
+	compressed := gzipPayload(t, make([]byte, 1025))
+	msg := message.NewMessage(watermill.NewUUID(), compressed)
+
+	published := make(chan error, 1)
+	go func() {
+		published <- pubSub.Publish("topic", msg)
+	}()
+
+	select {
+	case received := <-messages:
+		assert.Equal(t, compressed, []byte(received.Payload), "payload exceeding the limit should be passed compressed")
+		assert.Equal(t, string(payloadformat.FormatGzip), received.Metadata.Get(payloadformat.DetectedFormatMetadataKey))
+		received.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("message not received")
+	}
+
+	require.NoError(t, <-published)
+	require.NoError(t, sub.Close())
+}
+
+func TestSubscriberDecorator_invalid_config(t *testing.T) {
+	_, err := payloadformat.SubscriberDecorator(payloadformat.Config{Target: payloadformat.FormatGzip})
+	assert.Error(t, err)
+}
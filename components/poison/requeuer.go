@@ -0,0 +1,301 @@
+// Package poison provides the Requeuer, which republishes messages from the poison (or dead letter) topic
+// to the topics from which they were originally received, for example after the bug in the handler was fixed.
+package poison
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+// RequeueCountKey is the metadata key with the number of times the message was requeued.
+const RequeueCountKey = "requeue_count"
+
+// ErrMissingOriginalTopic is returned by DefaultOriginalTopic, when the topic of the message is not recorded.
+var ErrMissingOriginalTopic = errors.New("original topic of the message is unknown")
+
+// DefaultOriginalTopic returns the topic recorded by the PoisonQueue middleware or by the dead letter
+// of the Router.
+func DefaultOriginalTopic(msg *message.Message) (string, error) {
+	if topic := msg.Metadata.Get(middleware.PoisonedTopicKey); topic != "" {
+		return topic, nil
+	}
+	if topic := msg.Metadata.Get(message.DeadLetterTopicMetadataKey); topic != "" {
+		return topic, nil
+	}
+
+	return "", ErrMissingOriginalTopic
+}
+
+// DefaultRemovedMetadata are the metadata keys describing why the message was poisoned,
+// which are removed before the message is requeued.
+var DefaultRemovedMetadata = []string{
+	middleware.ReasonForPoisonedKey,
+	middleware.PoisonedTopicKey,
+	middleware.PoisonedHandlerKey,
+	message.DeadLetterReasonMetadataKey,
+	message.DeadLetterHandlerMetadataKey,
+	message.DeadLetterTopicMetadataKey,
+}
+
+type Config struct {
+	// Subscriber is used to read messages from PoisonTopic. Required.
+	Subscriber message.Subscriber
+
+	// PoisonTopic is the poison (or dead letter) topic. Required.
+	PoisonTopic string
+
+	// Publisher is used to requeue messages to their original topics. Required.
+	Publisher message.Publisher
+
+	// OriginalTopic returns the topic, to which the message is requeued. Defaults to DefaultOriginalTopic.
+	// Messages, for which it returns an error, are left in the poison topic and reported in Stats.FailedMessages.
+	OriginalTopic func(msg *message.Message) (string, error)
+
+	// Transform is optional and allows to fix the message before it's requeued.
+	// When it returns nil message, the message is dropped from the poison topic without requeueing.
+	// When it returns an error, the message is left in the poison topic.
+	Transform func(msg *message.Message) (*message.Message, error)
+
+	// RemovedMetadata are the metadata keys removed from the message before requeueing.
+	// Defaults to DefaultRemovedMetadata.
+	RemovedMetadata []string
+
+	// RateLimit is the maximum number of requeued messages per second. When 0, the rate is not limited.
+	RateLimit int
+
+	// MaxMessages is the maximum number of messages read from the poison topic. When 0, it's not limited.
+	MaxMessages int
+
+	// IdleTimeout stops the Requeuer, when no message is received from the poison topic for this time.
+	// Defaults to 5 seconds.
+	IdleTimeout time.Duration
+
+	// DryRun only logs what would be requeued. Messages are not published and they are nacked,
+	// so they stay in the poison topic.
+	//
+	// Pub/Subs redelivering the nacked message before the next one (like Kafka) allow to preview
+	// only the first message, see Run.
+	DryRun bool
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.OriginalTopic == nil {
+		c.OriginalTopic = DefaultOriginalTopic
+	}
+	if c.RemovedMetadata == nil {
+		c.RemovedMetadata = DefaultRemovedMetadata
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = time.Second * 5
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Subscriber == nil {
+		return errors.New("missing Subscriber")
+	}
+	if c.PoisonTopic == "" {
+		return errors.New("missing PoisonTopic")
+	}
+	if c.Publisher == nil {
+		return errors.New("missing Publisher")
+	}
+	if c.RateLimit < 0 {
+		return errors.New("RateLimit cannot be negative")
+	}
+	if c.MaxMessages < 0 {
+		return errors.New("MaxMessages cannot be negative")
+	}
+	if c.IdleTimeout < 0 {
+		return errors.New("IdleTimeout cannot be negative")
+	}
+
+	return nil
+}
+
+// Stats summarize the run of the Requeuer.
+type Stats struct {
+	// Requeued is the number of messages published to their original topics (or which would be, in DryRun).
+	Requeued int
+	// Dropped is the number of messages dropped by Transform.
+	Dropped int
+	// Failed is the number of messages left in the poison topic, because of an error.
+	Failed int
+	// FailedMessages are the UUIDs of the messages left in the poison topic, because of an error.
+	FailedMessages []string
+}
+
+// Requeuer republishes messages from the poison topic to their original topics.
+type Requeuer struct {
+	config Config
+	logger watermill.LoggerAdapter
+}
+
+func NewRequeuer(config Config) (*Requeuer, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Requeuer config")
+	}
+
+	return &Requeuer{
+		config: config,
+		logger: config.Logger.With(watermill.LogFields{"poison_topic": config.PoisonTopic}),
+	}, nil
+}
+
+// Run requeues messages from the poison topic, until it's idle for IdleTimeout, MaxMessages are read
+// or ctx is canceled. The Subscriber is not closed by Run.
+//
+// Messages which cannot be requeued are nacked, so they stay in the poison topic and they are requeued
+// by the next Run, after the cause of the failure is fixed. Nacked messages are redelivered by most Pub/Subs,
+// many of them (like Kafka or GoChannel) before the next message. To not spin on such a message forever,
+// Run stops when it receives a message which it already nacked.
+func (r *Requeuer) Run(ctx context.Context) (Stats, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// the subscription is closed with the context
+	defer cancel()
+
+	messages, err := r.config.Subscriber.Subscribe(ctx, r.config.PoisonTopic)
+	if err != nil {
+		return Stats{}, errors.Wrap(err, "cannot subscribe to the poison topic")
+	}
+
+	var limit <-chan time.Time
+	if r.config.RateLimit > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(r.config.RateLimit))
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+
+	stats := Stats{}
+	nacked := map[string]struct{}{}
+
+	for read := 0; r.config.MaxMessages == 0 || read < r.config.MaxMessages; read++ {
+		var msg *message.Message
+		var ok bool
+
+		select {
+		case msg, ok = <-messages:
+			if !ok {
+				return stats, nil
+			}
+		case <-time.After(r.config.IdleTimeout):
+			r.logger.Debug("Poison topic is idle, stopping", nil)
+			return stats, nil
+		case <-ctx.Done():
+			return stats, ctx.Err()
+		}
+
+		if _, ok := nacked[msg.UUID]; ok {
+			msg.Nack()
+			r.logger.Info("Nacked message received again, stopping", watermill.LogFields{
+				"message_uuid": msg.UUID,
+			})
+			return stats, nil
+		}
+
+		if limit != nil {
+			select {
+			case <-limit:
+			case <-ctx.Done():
+				msg.Nack()
+				return stats, ctx.Err()
+			}
+		}
+
+		if !r.requeue(msg, &stats) {
+			nacked[msg.UUID] = struct{}{}
+		}
+	}
+
+	return stats, nil
+}
+
+// requeue requeues the message and returns true, when the message was acked.
+func (r *Requeuer) requeue(msg *message.Message, stats *Stats) bool {
+	logFields := watermill.LogFields{"message_uuid": msg.UUID}
+
+	topic, err := r.config.OriginalTopic(msg)
+	if err != nil {
+		r.logger.Error("Cannot get original topic of the message", err, logFields)
+		return r.fail(msg, stats)
+	}
+	logFields["topic"] = topic
+
+	requeued := msg
+	if r.config.Transform != nil {
+		requeued, err = r.config.Transform(msg)
+		if err != nil {
+			r.logger.Error("Cannot transform the message", err, logFields)
+			return r.fail(msg, stats)
+		}
+	}
+
+	if requeued == nil {
+		r.logger.Info("Message dropped by Transform", logFields)
+		stats.Dropped++
+		return r.ackUnlessDryRun(msg)
+	}
+
+	requeued = r.prepare(requeued)
+
+	if r.config.DryRun {
+		r.logger.Info("Message would be requeued (dry run)", logFields)
+		stats.Requeued++
+		msg.Nack()
+		return false
+	}
+
+	if err := r.config.Publisher.Publish(topic, requeued); err != nil {
+		r.logger.Error("Cannot requeue the message", err, logFields)
+		return r.fail(msg, stats)
+	}
+
+	r.logger.Info("Message requeued", logFields)
+	stats.Requeued++
+	msg.Ack()
+	return true
+}
+
+// fail leaves the message in the poison topic and reports it in stats.
+func (r *Requeuer) fail(msg *message.Message, stats *Stats) bool {
+	stats.Failed++
+	stats.FailedMessages = append(stats.FailedMessages, msg.UUID)
+	msg.Nack()
+	return false
+}
+
+// prepare returns the copy of the message, without the metadata describing the poisoning
+// and with the incremented RequeueCountKey.
+func (r *Requeuer) prepare(msg *message.Message) *message.Message {
+	prepared := msg.Copy()
+	for _, key := range r.config.RemovedMetadata {
+		delete(prepared.Metadata, key)
+	}
+
+	count, _ := strconv.Atoi(prepared.Metadata.Get(RequeueCountKey))
+	prepared.Metadata.Set(RequeueCountKey, strconv.Itoa(count+1))
+
+	return prepared
+}
+
+func (r *Requeuer) ackUnlessDryRun(msg *message.Message) bool {
+	if r.config.DryRun {
+		msg.Nack()
+		return false
+	}
+	msg.Ack()
+	return true
+}
@@ -0,0 +1,157 @@
+package poison_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/poison"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+const poisonTopic = "poison"
+
+func newPubSub() message.PubSub {
+	return gochannel.NewGoChannel(gochannel.Config{Persistent: true}, watermill.NopLogger{})
+}
+
+func poisonedMessage(uuid string, key string, topic string) *message.Message {
+	msg := message.NewMessage(uuid, []byte(uuid))
+	msg.Metadata.Set(key, topic)
+	msg.Metadata.Set(middleware.ReasonForPoisonedKey, "handler failed")
+	return msg
+}
+
+func TestRequeuer(t *testing.T) {
+	pubSub := newPubSub()
+
+	require.NoError(t, pubSub.Publish(
+		poisonTopic,
+		poisonedMessage("1", middleware.PoisonedTopicKey, "orders"),
+		poisonedMessage("2", message.DeadLetterTopicMetadataKey, "payments"),
+		poisonedMessage("3", middleware.PoisonedTopicKey, "orders"),
+	))
+
+	requeuer, err := poison.NewRequeuer(poison.Config{
+		Subscriber:  pubSub,
+		PoisonTopic: poisonTopic,
+		Publisher:   pubSub,
+		Transform: func(msg *message.Message) (*message.Message, error) {
+			if msg.UUID == "3" {
+				return nil, nil
+			}
+			msg.Payload = []byte("fixed")
+			return msg, nil
+		},
+		RateLimit:   100,
+		IdleTimeout: time.Millisecond * 100,
+	})
+	require.NoError(t, err)
+
+	stats, err := requeuer.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, poison.Stats{Requeued: 2, Dropped: 1}, stats)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for topic, uuid := range map[string]string{"orders": "1", "payments": "2"} {
+		messages, err := pubSub.Subscribe(ctx, topic)
+		require.NoError(t, err)
+
+		select {
+		case msg := <-messages:
+			assert.Equal(t, uuid, msg.UUID)
+			assert.Equal(t, message.Payload("fixed"), msg.Payload)
+			assert.Equal(t, "1", msg.Metadata.Get(poison.RequeueCountKey))
+			assert.Empty(t, msg.Metadata.Get(middleware.ReasonForPoisonedKey))
+			assert.Empty(t, msg.Metadata.Get(middleware.PoisonedTopicKey))
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatalf("message not requeued to %s", topic)
+		}
+	}
+}
+
+func TestRequeuer_missing_original_topic(t *testing.T) {
+	pubSub := newPubSub()
+
+	require.NoError(t, pubSub.Publish(poisonTopic, message.NewMessage("1", nil)))
+
+	requeuer, err := poison.NewRequeuer(poison.Config{
+		Subscriber:  pubSub,
+		PoisonTopic: poisonTopic,
+		Publisher:   pubSub,
+		MaxMessages: 1,
+	})
+	require.NoError(t, err)
+
+	stats, err := requeuer.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, poison.Stats{Failed: 1, FailedMessages: []string{"1"}}, stats)
+}
+
+func TestRequeuer_redelivered_failed_message(t *testing.T) {
+	pubSub := newPubSub()
+
+	// GoChannel redelivers the nacked message immediately, like Kafka
+	require.NoError(t, pubSub.Publish(poisonTopic, message.NewMessage("1", nil)))
+
+	requeuer, err := poison.NewRequeuer(poison.Config{
+		Subscriber:  pubSub,
+		PoisonTopic: poisonTopic,
+		Publisher:   pubSub,
+		IdleTimeout: time.Second * 30,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	stats, err := requeuer.Run(ctx)
+	require.NoError(t, err, "Run should stop when the failed message is redelivered, before IdleTimeout")
+	assert.Equal(t, poison.Stats{Failed: 1, FailedMessages: []string{"1"}}, stats)
+}
+
+func TestRequeuer_dry_run(t *testing.T) {
+	pubSub := newPubSub()
+
+	require.NoError(t, pubSub.Publish(poisonTopic, poisonedMessage("1", middleware.PoisonedTopicKey, "orders")))
+
+	requeuer, err := poison.NewRequeuer(poison.Config{
+		Subscriber:  pubSub,
+		PoisonTopic: poisonTopic,
+		Publisher:   pubSub,
+		DryRun:      true,
+		IdleTimeout: time.Millisecond * 100,
+	})
+	require.NoError(t, err)
+
+	stats, err := requeuer.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, poison.Stats{Requeued: 1}, stats)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	orders, err := pubSub.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	select {
+	case msg := <-orders:
+		t.Fatalf("message %s should not be requeued in the dry run", msg.UUID)
+	case <-ctx.Done():
+		// ok
+	}
+}
+
+func TestNewRequeuer_invalid_config(t *testing.T) {
+	_, err := poison.NewRequeuer(poison.Config{PoisonTopic: poisonTopic})
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package privacy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// document is the JSON payload with the fields addressed by dot-separated paths, like "customer.email".
+type document map[string]interface{}
+
+func parseDocument(payload []byte) (document, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	// numbers are kept as they are, instead of converting to float64
+	decoder.UseNumber()
+
+	doc := document{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "payload is not a JSON object")
+	}
+
+	return doc, nil
+}
+
+// get returns the value of the field, or false when the field doesn't exist.
+func (d document) get(path string) (interface{}, bool) {
+	parent, name, ok := d.parent(path)
+	if !ok {
+		return nil, false
+	}
+
+	value, ok := parent[name]
+	return value, ok
+}
+
+// set sets the value of the existing field.
+func (d document) set(path string, value interface{}) {
+	parent, name, ok := d.parent(path)
+	if !ok {
+		return
+	}
+	if _, ok := parent[name]; ok {
+		parent[name] = value
+	}
+}
+
+func (d document) parent(path string) (map[string]interface{}, string, bool) {
+	parts := strings.Split(path, ".")
+
+	current := map[string]interface{}(d)
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return nil, "", false
+		}
+		current = next
+	}
+
+	return current, parts[len(parts)-1], true
+}
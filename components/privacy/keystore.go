@@ -0,0 +1,77 @@
+package privacy
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrKeyNotFound is returned by KeyStore.Key, when the subject has no key, for example because it was deleted.
+var ErrKeyNotFound = errors.New("subject key not found")
+
+// KeyStore stores the encryption keys of subjects (for example users).
+//
+// Deleting the subject's key makes all its encrypted fields unreadable (crypto-shredding),
+// without the need of changing messages already stored in the Pub/Sub.
+type KeyStore interface {
+	// Key returns the key of the subject, or ErrKeyNotFound.
+	Key(ctx context.Context, subjectID string) ([]byte, error)
+
+	// GetOrCreateKey returns the key of the subject and creates it, when it doesn't exist.
+	// The key must be 32 bytes long (AES-256).
+	GetOrCreateKey(ctx context.Context, subjectID string) ([]byte, error)
+
+	// DeleteKey deletes the key of the subject.
+	DeleteKey(ctx context.Context, subjectID string) error
+}
+
+// MemoryKeyStore is a KeyStore which keeps the keys in memory. It's useful for tests.
+type MemoryKeyStore struct {
+	keys map[string][]byte
+	lock sync.Mutex
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: map[string][]byte{}}
+}
+
+func (s *MemoryKeyStore) Key(ctx context.Context, subjectID string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key, ok := s.keys[subjectID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+func (s *MemoryKeyStore) GetOrCreateKey(ctx context.Context, subjectID string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if key, ok := s.keys[subjectID]; ok {
+		return key, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Wrap(err, "cannot generate key")
+	}
+	s.keys[subjectID] = key
+
+	return key, nil
+}
+
+func (s *MemoryKeyStore) DeleteKey(ctx context.Context, subjectID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.keys, subjectID)
+
+	return nil
+}
@@ -0,0 +1,360 @@
+// Package privacy provides field-level encryption of personal data in messages' payloads.
+//
+// The fields are encrypted with the keys of subjects (for example users), so deleting the subject's key
+// makes its data unreadable in all messages (crypto-shredding). On public topics the fields are redacted instead.
+//
+// Only JSON object payloads are supported.
+package privacy
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// encryptedPrefix marks the encrypted values.
+	encryptedPrefix = "privacy:v1:"
+
+	// RedactedValue replaces the fields on public topics.
+	RedactedValue = "[REDACTED]"
+)
+
+// TopicPolicy defines which fields of the messages on the topic contain personal data.
+type TopicPolicy struct {
+	// Fields are dot-separated paths of the JSON fields with personal data, for example "customer.email".
+	// Fields missing in the payload are skipped.
+	Fields []string
+
+	// SubjectIDField is the path of the JSON field with the ID of the subject, whose key encrypts the Fields.
+	SubjectIDField string
+
+	// SubjectIDMetadataKey is the metadata key with the ID of the subject.
+	// It's used when SubjectIDField is empty.
+	SubjectIDMetadataKey string
+
+	// Public topics are read by consumers which must not see personal data, so the Fields are redacted
+	// (replaced with RedactedValue) instead of encrypted.
+	Public bool
+}
+
+func (p TopicPolicy) validate() error {
+	if len(p.Fields) == 0 {
+		return errors.New("missing Fields")
+	}
+	if !p.Public && p.SubjectIDField == "" && p.SubjectIDMetadataKey == "" {
+		return errors.New("missing SubjectIDField or SubjectIDMetadataKey")
+	}
+
+	return nil
+}
+
+type Config struct {
+	// KeyStore stores the keys of subjects.
+	KeyStore KeyStore
+
+	// Topics contains the policies of the topics with personal data. Messages on other topics are passed as they are.
+	Topics map[string]TopicPolicy
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.KeyStore == nil {
+		return errors.New("missing KeyStore")
+	}
+	for topic, policy := range c.Topics {
+		if err := policy.validate(); err != nil {
+			return errors.Wrapf(err, "invalid policy of topic %s", topic)
+		}
+	}
+
+	return nil
+}
+
+// Privacy provides the publisher decorator, which encrypts (or redacts) the fields of published messages,
+// and the handler middleware, which decrypts them.
+type Privacy struct {
+	config Config
+}
+
+func NewPrivacy(config Config) (*Privacy, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid privacy config")
+	}
+
+	return &Privacy{config}, nil
+}
+
+// ForgetSubject deletes the key of the subject, so its encrypted fields can't be decrypted anymore.
+func (p *Privacy) ForgetSubject(ctx context.Context, subjectID string) error {
+	return p.config.KeyStore.DeleteKey(ctx, subjectID)
+}
+
+// PublisherDecorator encrypts the fields of messages published to topics with a policy.
+// On public topics the fields are redacted.
+//
+// When the fields cannot be encrypted (for example the subject ID is missing), Publish fails,
+// so personal data never leaves the service unencrypted.
+//
+// Messages passed to Publish are not modified, their encrypted copies are published instead.
+func (p *Privacy) PublisherDecorator(pub message.Publisher) (message.Publisher, error) {
+	return &encryptingPublisher{Publisher: pub, privacy: p}, nil
+}
+
+type encryptingPublisher struct {
+	message.Publisher
+	privacy *Privacy
+}
+
+func (e *encryptingPublisher) Publish(topic string, messages ...*message.Message) error {
+	policy, ok := e.privacy.config.Topics[topic]
+	if !ok {
+		return e.Publisher.Publish(topic, messages...)
+	}
+
+	protected := make([]*message.Message, 0, len(messages))
+	for _, msg := range messages {
+		protectedMsg, err := e.privacy.protect(msg, policy)
+		if err != nil {
+			return errors.Wrapf(err, "cannot protect personal data of message %s", msg.UUID)
+		}
+		protected = append(protected, protectedMsg)
+	}
+
+	return e.Publisher.Publish(topic, protected...)
+}
+
+// Middleware decrypts the fields of messages received from topics with a policy.
+//
+// Fields of forgotten subjects (with deleted keys) are set to null.
+func (p *Privacy) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		policy, ok := p.config.Topics[message.SubscribeTopicFromCtx(msg.Context())]
+		if ok && !policy.Public {
+			if err := p.reveal(msg, policy); err != nil {
+				return nil, errors.Wrapf(err, "cannot decrypt personal data of message %s", msg.UUID)
+			}
+		}
+
+		return h(msg)
+	}
+}
+
+// protect returns a copy of the message with the fields encrypted (or redacted), so the message is left untouched
+// when one of the fields cannot be encrypted.
+func (p *Privacy) protect(msg *message.Message, policy TopicPolicy) (*message.Message, error) {
+	doc, err := parseDocument(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var aead cipher.AEAD
+	var subject string
+	if !policy.Public {
+		subject, err = subjectID(msg, doc, policy)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := p.config.KeyStore.GetOrCreateKey(msg.Context(), subject)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get key of subject %s", subject)
+		}
+
+		aead, err = newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, field := range policy.Fields {
+		value, ok := doc.get(field)
+		if !ok {
+			continue
+		}
+
+		if policy.Public {
+			doc.set(field, RedactedValue)
+			continue
+		}
+
+		associatedData := associatedData(subject, field)
+
+		if s, ok := value.(string); ok && strings.HasPrefix(s, encryptedPrefix) {
+			if _, err := decrypt(aead, s, associatedData); err == nil {
+				// already encrypted for this subject and field, for example when the message is republished
+				continue
+			}
+			// plaintext which only looks like an encrypted value
+		}
+
+		encrypted, err := encrypt(aead, value, associatedData)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot encrypt field %s", field)
+		}
+		doc.set(field, encrypted)
+	}
+
+	protected := msg.Copy()
+	protected.SetContext(msg.Context())
+	if err := marshalDocument(protected, doc); err != nil {
+		return nil, err
+	}
+
+	return protected, nil
+}
+
+func (p *Privacy) reveal(msg *message.Message, policy TopicPolicy) error {
+	doc, err := parseDocument(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	subjectID, err := subjectID(msg, doc, policy)
+	if err != nil {
+		return err
+	}
+
+	var aead cipher.AEAD
+	key, err := p.config.KeyStore.Key(msg.Context(), subjectID)
+	if err == ErrKeyNotFound {
+		p.config.Logger.Trace("Subject forgotten, clearing personal data", watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"subject_id":   subjectID,
+		})
+	} else if err != nil {
+		return errors.Wrapf(err, "cannot get key of subject %s", subjectID)
+	} else if aead, err = newAEAD(key); err != nil {
+		return err
+	}
+
+	for _, field := range policy.Fields {
+		value, ok := doc.get(field)
+		if !ok {
+			continue
+		}
+		s, ok := value.(string)
+		if !ok || !strings.HasPrefix(s, encryptedPrefix) {
+			continue
+		}
+
+		if aead == nil {
+			doc.set(field, nil)
+			continue
+		}
+
+		decrypted, err := decrypt(aead, s, associatedData(subjectID, field))
+		if err != nil {
+			return errors.Wrapf(err, "cannot decrypt field %s", field)
+		}
+		doc.set(field, decrypted)
+	}
+
+	return marshalDocument(msg, doc)
+}
+
+func subjectID(msg *message.Message, doc document, policy TopicPolicy) (string, error) {
+	if policy.SubjectIDField == "" {
+		subjectID := msg.Metadata.Get(policy.SubjectIDMetadataKey)
+		if subjectID == "" {
+			return "", errors.Errorf("missing subject ID in metadata %s", policy.SubjectIDMetadataKey)
+		}
+		return subjectID, nil
+	}
+
+	value, ok := doc.get(policy.SubjectIDField)
+	if !ok || value == nil {
+		return "", errors.Errorf("missing subject ID in field %s", policy.SubjectIDField)
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+func marshalDocument(msg *message.Message, doc document) error {
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal payload")
+	}
+	msg.Payload = payload
+
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid subject key")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// associatedData binds the encrypted value to the subject and the field, so the value copied
+// to another field or another subject's message cannot be decrypted.
+func associatedData(subjectID string, field string) []byte {
+	// JSON array keeps the boundary between the subject ID and the field unambiguous
+	data, _ := json.Marshal([]string{subjectID, field})
+	return data
+}
+
+// encrypt encrypts the JSON representation of the value, so the type of the value is restored after decryption.
+func encrypt(aead cipher.AEAD, value interface{}, associatedData []byte) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := aead.Seal(nonce, nonce, plaintext, associatedData)
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func decrypt(aead cipher.AEAD, encrypted string, associatedData []byte) (interface{}, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, encryptedPrefix))
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("encrypted value too short")
+	}
+
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], associatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(plaintext))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
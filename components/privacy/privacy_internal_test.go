@@ -0,0 +1,86 @@
+package privacy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func newTestPrivacy(t *testing.T) *Privacy {
+	p, err := NewPrivacy(Config{
+		KeyStore: NewMemoryKeyStore(),
+		Topics: map[string]TopicPolicy{
+			"users": {
+				Fields:               []string{"email", "phone"},
+				SubjectIDMetadataKey: "user_id",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	return p
+}
+
+func newUserMessage(userID string, payload string) *message.Message {
+	msg := message.NewMessage(watermill.NewUUID(), []byte(payload))
+	msg.Metadata.Set("user_id", userID)
+	return msg
+}
+
+func TestPrivacy_encrypted_value_bound_to_field_and_subject(t *testing.T) {
+	p := newTestPrivacy(t)
+	policy := p.config.Topics["users"]
+
+	// both subjects share the key, so only the associated data prevents moving the values
+	key, err := p.config.KeyStore.GetOrCreateKey(context.Background(), "1")
+	require.NoError(t, err)
+	p.config.KeyStore.(*MemoryKeyStore).keys["2"] = key
+
+	protected, err := p.protect(newUserMessage("1", `{"email": "john@example.com", "phone": "123"}`), policy)
+	require.NoError(t, err)
+
+	doc, err := parseDocument(protected.Payload)
+	require.NoError(t, err)
+	email, _ := doc.get("email")
+
+	testCases := []struct {
+		Name   string
+		UserID string
+		Field  string
+	}{
+		{Name: "another_field", UserID: "1", Field: "phone"},
+		{Name: "another_subject", UserID: "2", Field: "email"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			moved := document{tc.Field: email}
+			msg := newUserMessage(tc.UserID, "")
+			require.NoError(t, marshalDocument(msg, moved))
+
+			assert.Error(t, p.reveal(msg, policy))
+		})
+	}
+}
+
+func TestPrivacy_plaintext_with_encrypted_prefix(t *testing.T) {
+	p := newTestPrivacy(t)
+	policy := p.config.Topics["users"]
+
+	protected, err := p.protect(newUserMessage("1", `{"email": "privacy:v1:john@example.com"}`), policy)
+	require.NoError(t, err)
+	assert.NotContains(t, string(protected.Payload), "john@example.com")
+
+	republished, err := p.protect(protected, policy)
+	require.NoError(t, err)
+	assert.Equal(t, string(protected.Payload), string(republished.Payload), "encrypted value should not be encrypted twice")
+
+	require.NoError(t, p.reveal(republished, policy))
+	assert.JSONEq(t, `{"email": "privacy:v1:john@example.com"}`, string(republished.Payload))
+}
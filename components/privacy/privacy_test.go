@@ -0,0 +1,177 @@
+package privacy_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/privacy"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+)
+
+type publisherMock struct {
+	published map[string][]*message.Message
+}
+
+func (p *publisherMock) Publish(topic string, messages ...*message.Message) error {
+	p.published[topic] = append(p.published[topic], messages...)
+	return nil
+}
+
+func (p *publisherMock) Close() error {
+	return nil
+}
+
+type userRegistered struct {
+	UserID  string  `json:"user_id"`
+	Email   *string `json:"email"`
+	Address struct {
+		Street *string `json:"street"`
+		City   string  `json:"city"`
+	} `json:"address"`
+}
+
+func newPrivacy(t *testing.T) *privacy.Privacy {
+	fields := []string{"email", "address.street"}
+
+	p, err := privacy.NewPrivacy(privacy.Config{
+		KeyStore: privacy.NewMemoryKeyStore(),
+		Topics: map[string]privacy.TopicPolicy{
+			"users": {
+				Fields:         fields,
+				SubjectIDField: "user_id",
+			},
+			"users_public": {
+				Fields: fields,
+				Public: true,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	return p
+}
+
+func newMessage() *message.Message {
+	return message.NewMessage(
+		watermill.NewUUID(),
+		[]byte(`{"user_id": "1", "email": "john@example.com", "address": {"street": "Main St", "city": "Warsaw"}}`),
+	)
+}
+
+func publish(t *testing.T, p *privacy.Privacy, topic string) *message.Message {
+	pub := &publisherMock{published: map[string][]*message.Message{}}
+	decoratedPub, err := p.PublisherDecorator(pub)
+	require.NoError(t, err)
+
+	require.NoError(t, decoratedPub.Publish(topic, newMessage()))
+	require.Len(t, pub.published[topic], 1)
+
+	return pub.published[topic][0]
+}
+
+func handle(t *testing.T, p *privacy.Privacy, topic string, msg *message.Message) userRegistered {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{Persistent: true}, watermill.NopLogger{})
+	require.NoError(t, pubSub.Publish(topic, msg))
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+	router.AddMiddleware(p.Middleware)
+
+	received := make(chan userRegistered, 1)
+	router.AddNoPublisherHandler("handler", topic, pubSub, func(msg *message.Message) ([]*message.Message, error) {
+		var event userRegistered
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			return nil, err
+		}
+		received <- event
+		return nil, nil
+	})
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		require.NoError(t, router.Close())
+	}()
+
+	select {
+	case event := <-received:
+		return event
+	case <-time.After(time.Second * 5):
+		t.Fatal("message not handled")
+		return userRegistered{}
+	}
+}
+
+func TestPrivacy_encrypt_decrypt(t *testing.T) {
+	p := newPrivacy(t)
+
+	published := publish(t, p, "users")
+	assert.NotContains(t, string(published.Payload), "john@example.com")
+	assert.NotContains(t, string(published.Payload), "Main St")
+	assert.Contains(t, string(published.Payload), "Warsaw")
+
+	received := handle(t, p, "users", published)
+	require.NotNil(t, received.Email)
+	assert.Equal(t, "john@example.com", *received.Email)
+	require.NotNil(t, received.Address.Street)
+	assert.Equal(t, "Main St", *received.Address.Street)
+}
+
+func TestPrivacy_ForgetSubject(t *testing.T) {
+	p := newPrivacy(t)
+
+	published := publish(t, p, "users")
+	require.NoError(t, p.ForgetSubject(context.Background(), "1"))
+
+	received := handle(t, p, "users", published)
+	assert.Equal(t, "1", received.UserID)
+	assert.Nil(t, received.Email)
+	assert.Nil(t, received.Address.Street)
+	assert.Equal(t, "Warsaw", received.Address.City)
+}
+
+func TestPrivacy_public_topic(t *testing.T) {
+	p := newPrivacy(t)
+
+	published := publish(t, p, "users_public")
+
+	received := handle(t, p, "users_public", published)
+	require.NotNil(t, received.Email)
+	assert.Equal(t, privacy.RedactedValue, *received.Email)
+	assert.Equal(t, "Warsaw", received.Address.City)
+}
+
+func TestPrivacy_missing_subject_id(t *testing.T) {
+	p := newPrivacy(t)
+
+	pub, err := p.PublisherDecorator(&publisherMock{published: map[string][]*message.Message{}})
+	require.NoError(t, err)
+
+	err = pub.Publish("users", message.NewMessage(watermill.NewUUID(), []byte(`{"email": "john@example.com"}`)))
+	assert.Error(t, err)
+}
+
+func TestPrivacy_messages_not_modified_on_error(t *testing.T) {
+	p := newPrivacy(t)
+
+	pub := &publisherMock{published: map[string][]*message.Message{}}
+	decoratedPub, err := p.PublisherDecorator(pub)
+	require.NoError(t, err)
+
+	valid := newMessage()
+	validPayload := string(valid.Payload)
+	missingSubject := message.NewMessage(watermill.NewUUID(), []byte(`{"email": "john@example.com"}`))
+
+	assert.Error(t, decoratedPub.Publish("users", valid, missingSubject))
+
+	assert.Equal(t, validPayload, string(valid.Payload), "message should not be partially encrypted")
+	assert.Empty(t, pub.published["users"])
+}
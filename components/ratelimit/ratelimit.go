@@ -0,0 +1,166 @@
+// Package ratelimit provides the middleware limiting the rate of handled messages across all replicas
+// of the consumer, with the token bucket kept in a shared Store (for example Redis).
+//
+// When the shared Store is not available, the limit falls back to the local, in-memory token bucket,
+// so the messages are still handled, with the limit divided by the number of replicas.
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type Config struct {
+	// Store is the shared store of the token buckets, for example RedisStore. Required.
+	Store Store
+
+	// Limit is the rate of messages for all replicas. Required.
+	Limit Limit
+
+	// Key is the key of the token bucket. Defaults to "default".
+	Key string
+
+	// KeyFunc is optional and returns the key of the message's token bucket,
+	// for example to limit each tenant separately. It overrides Key.
+	KeyFunc func(msg *message.Message) string
+
+	// FallbackReplicas is the expected number of replicas. When Store is not available, every replica
+	// limits the messages locally to Limit divided by FallbackReplicas. Defaults to 1.
+	FallbackReplicas int
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	c.Limit.setDefaults()
+	if c.Key == "" {
+		c.Key = "default"
+	}
+	if c.KeyFunc == nil {
+		key := c.Key
+		c.KeyFunc = func(*message.Message) string {
+			return key
+		}
+	}
+	if c.FallbackReplicas == 0 {
+		c.FallbackReplicas = 1
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Store == nil {
+		return errors.New("missing Store")
+	}
+	if err := c.Limit.Validate(); err != nil {
+		return errors.Wrap(err, "invalid Limit")
+	}
+	if c.FallbackReplicas < 0 {
+		return errors.New("FallbackReplicas cannot be negative")
+	}
+
+	return nil
+}
+
+// RateLimiter limits the rate of handled messages with the token bucket kept in the Store.
+type RateLimiter struct {
+	config Config
+
+	fallbackStore *MemoryStore
+	fallbackLimit Limit
+
+	// degraded is 1, when the Store is not available and the fallback is used
+	degraded int32
+}
+
+func NewRateLimiter(config Config) (*RateLimiter, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid RateLimiter config")
+	}
+
+	return &RateLimiter{
+		config:        config,
+		fallbackStore: NewMemoryStore(),
+		fallbackLimit: Limit{
+			Events:   atLeastOne(config.Limit.Events / config.FallbackReplicas),
+			Interval: config.Limit.Interval,
+			Burst:    atLeastOne(config.Limit.Burst / config.FallbackReplicas),
+		},
+	}, nil
+}
+
+// Middleware waits until the message is allowed by the limit.
+// It returns the message's context error, when the context is canceled while waiting.
+func (r *RateLimiter) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		if err := r.wait(msg.Context(), r.config.KeyFunc(msg)); err != nil {
+			return nil, err
+		}
+
+		return h(msg)
+	}
+}
+
+// Degraded returns true, when the Store is not available and messages are limited locally.
+func (r *RateLimiter) Degraded() bool {
+	return atomic.LoadInt32(&r.degraded) == 1
+}
+
+func (r *RateLimiter) wait(ctx context.Context, key string) error {
+	for {
+		wait, err := r.take(ctx, key)
+		if err != nil {
+			return err
+		}
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *RateLimiter) take(ctx context.Context, key string) (time.Duration, error) {
+	wait, err := r.config.Store.Take(ctx, key, r.config.Limit)
+	if err == nil {
+		if atomic.CompareAndSwapInt32(&r.degraded, 1, 0) {
+			r.config.Logger.Info("Rate limit store is available again", watermill.LogFields{"key": key})
+		}
+		return wait, nil
+	}
+
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	if atomic.CompareAndSwapInt32(&r.degraded, 0, 1) {
+		r.config.Logger.Error("Rate limit store is not available, falling back to the local limit", err, watermill.LogFields{
+			"key":          key,
+			"local_events": r.fallbackLimit.Events,
+		})
+	}
+
+	return r.fallbackStore.Take(ctx, key, r.fallbackLimit)
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
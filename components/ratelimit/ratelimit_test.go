@@ -0,0 +1,169 @@
+package ratelimit_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/components/ratelimit"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Events: 2, Interval: time.Second}
+
+	for i := 0; i < 2; i++ {
+		wait, err := store.Take(context.Background(), "key", limit)
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+
+	wait, err := store.Take(context.Background(), "key", limit)
+	require.NoError(t, err)
+	assert.True(t, wait > 0 && wait <= time.Millisecond*500, "unexpected wait: %s", wait)
+
+	wait, err = store.Take(context.Background(), "other_key", limit)
+	require.NoError(t, err)
+	assert.Zero(t, wait, "buckets of other keys should be independent")
+}
+
+type evalerMock struct {
+	lock   sync.Mutex
+	keys   []string
+	args   []interface{}
+	result interface{}
+	err    error
+}
+
+func (e *evalerMock) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.keys = keys
+	e.args = args
+	return e.result, e.err
+}
+
+func TestRedisStore_Take(t *testing.T) {
+	evaler := &evalerMock{result: int64(250)}
+	store := ratelimit.NewRedisStore(evaler)
+
+	wait, err := store.Take(context.Background(), "key", ratelimit.Limit{Events: 4})
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Millisecond*250, wait)
+	assert.Equal(t, []string{"watermill_ratelimit:key"}, evaler.keys)
+	require.Len(t, evaler.args, 3)
+	assert.Equal(t, 4, evaler.args[0], "burst should default to events")
+	assert.Equal(t, "0.004", evaler.args[1], "4 tokens per second is 0.004 per millisecond")
+}
+
+func TestRedisStore_Take_unexpected_result(t *testing.T) {
+	store := ratelimit.NewRedisStore(&evalerMock{result: "OK"})
+
+	_, err := store.Take(context.Background(), "key", ratelimit.Limit{Events: 4})
+	assert.Error(t, err)
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	limiter, err := ratelimit.NewRateLimiter(ratelimit.Config{
+		Store: ratelimit.NewMemoryStore(),
+		Limit: ratelimit.Limit{Events: 10, Interval: time.Second, Burst: 1},
+	})
+	require.NoError(t, err)
+
+	handled := 0
+	h := limiter.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		handled++
+		return nil, nil
+	})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := h(message.NewMessage("1", nil))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 3, handled)
+	assert.True(t, time.Since(start) >= time.Millisecond*150, "messages should be limited to 10 per second")
+}
+
+func TestRateLimiter_Middleware_context_canceled(t *testing.T) {
+	limiter, err := ratelimit.NewRateLimiter(ratelimit.Config{
+		Store: ratelimit.NewMemoryStore(),
+		Limit: ratelimit.Limit{Events: 1, Interval: time.Hour},
+	})
+	require.NoError(t, err)
+
+	h := limiter.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	})
+
+	_, err = h(message.NewMessage("1", nil))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	msg := message.NewMessage("2", nil)
+	msg.SetContext(ctx)
+
+	_, err = h(msg)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestRateLimiter_fallback_to_local_limit(t *testing.T) {
+	evaler := &evalerMock{err: errors.New("connection refused")}
+
+	limiter, err := ratelimit.NewRateLimiter(ratelimit.Config{
+		Store:            ratelimit.NewRedisStore(evaler),
+		Limit:            ratelimit.Limit{Events: 4, Interval: time.Hour},
+		FallbackReplicas: 2,
+	})
+	require.NoError(t, err)
+
+	handled := 0
+	h := limiter.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		handled++
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		msg := message.NewMessage("1", nil)
+		msg.SetContext(ctx)
+		_, _ = h(msg)
+	}
+
+	assert.True(t, limiter.Degraded())
+	assert.Equal(t, 2, handled, "local limit should be divided by the number of replicas")
+
+	evaler.lock.Lock()
+	evaler.err = nil
+	evaler.result = int64(0)
+	evaler.lock.Unlock()
+
+	_, err = h(message.NewMessage("1", nil))
+	require.NoError(t, err)
+	assert.False(t, limiter.Degraded())
+}
+
+func TestNewRateLimiter_invalid_config(t *testing.T) {
+	_, err := ratelimit.NewRateLimiter(ratelimit.Config{
+		Limit: ratelimit.Limit{Events: 1},
+	})
+	assert.Error(t, err, "missing Store")
+
+	_, err = ratelimit.NewRateLimiter(ratelimit.Config{
+		Store: ratelimit.NewMemoryStore(),
+	})
+	assert.Error(t, err, "missing Limit")
+}
@@ -0,0 +1,223 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limit is the rate of the token bucket.
+type Limit struct {
+	// Events is the number of events allowed per Interval.
+	Events int
+
+	// Interval defaults to one second.
+	Interval time.Duration
+
+	// Burst is the maximum number of events allowed at once. Defaults to Events.
+	Burst int
+}
+
+func (l *Limit) setDefaults() {
+	if l.Interval == 0 {
+		l.Interval = time.Second
+	}
+	if l.Burst == 0 {
+		l.Burst = l.Events
+	}
+}
+
+func (l Limit) Validate() error {
+	if l.Events <= 0 {
+		return errors.New("Events must be greater than 0")
+	}
+	if l.Interval < 0 {
+		return errors.New("Interval cannot be negative")
+	}
+	if l.Burst < 0 {
+		return errors.New("Burst cannot be negative")
+	}
+
+	return nil
+}
+
+// tokensPerNanosecond returns the refill rate of the bucket.
+func (l Limit) tokensPerNanosecond() float64 {
+	return float64(l.Events) / float64(l.Interval)
+}
+
+// Store keeps the token buckets.
+//
+// Take takes one token from the bucket of the key. When the bucket is empty, no token is taken
+// and the time after which the token will be available is returned.
+//
+// Implementations must be safe for concurrent use.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (wait time.Duration, err error)
+}
+
+// memoryStoreSweepInterval is how often MemoryStore looks for expired buckets.
+const memoryStoreSweepInterval = time.Minute
+
+// MemoryStore keeps the token buckets in memory, so the limit applies only to the current process.
+//
+// Like in RedisStore, a bucket expires when it would be full again, because it's the same as a new bucket.
+// Expired buckets are removed during Take, so keys which are not used anymore (for example of removed tenants)
+// don't grow the memory.
+type MemoryStore struct {
+	buckets   map[string]*memoryBucket
+	nextSweep time.Time
+	lock      sync.Mutex
+
+	now func() time.Time
+}
+
+type memoryBucket struct {
+	tokens  float64
+	last    time.Time
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*memoryBucket{},
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	limit.setDefaults()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = bucket
+	}
+
+	rate := limit.tokensPerNanosecond()
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+float64(now.Sub(bucket.last))*rate)
+	bucket.last = now
+
+	var wait time.Duration
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+	} else {
+		wait = time.Duration(math.Ceil((1 - bucket.tokens) / rate))
+	}
+
+	bucket.expires = now.Add(time.Duration(math.Ceil((float64(limit.Burst) - bucket.tokens) / rate)))
+
+	return wait, nil
+}
+
+// sweep removes the expired buckets, at most once per memoryStoreSweepInterval.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(memoryStoreSweepInterval)
+
+	for key, bucket := range s.buckets {
+		if !now.Before(bucket.expires) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RedisEvaler runs Lua scripts in Redis. It can be implemented with any Redis client, for example
+// with github.com/go-redis/redis:
+//
+//	type goRedisEvaler struct {
+//		client *redis.Client
+//	}
+//
+//	func (e goRedisEvaler) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return e.client.WithContext(ctx).Eval(script, keys, args...).Result()
+//	}
+type RedisEvaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// tokenBucketScript takes one token from the bucket stored in the hash.
+// It returns 0, when the token was taken, otherwise the wait time in milliseconds.
+//
+// The current time is passed by the client, because older versions of Redis
+// don't allow writes after calling TIME in the script.
+const tokenBucketScript = `
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(bucket[1])
+local last = tonumber(bucket[2])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "last", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate) + 1000)
+
+return wait
+`
+
+// RedisStore keeps the token buckets in Redis, so the limit applies to all processes using the same Redis.
+type RedisStore struct {
+	client RedisEvaler
+
+	// KeyPrefix is prepended to the keys of the buckets. Defaults to "watermill_ratelimit:".
+	KeyPrefix string
+}
+
+func NewRedisStore(client RedisEvaler) *RedisStore {
+	return &RedisStore{
+		client:    client,
+		KeyPrefix: "watermill_ratelimit:",
+	}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	limit.setDefaults()
+
+	tokensPerMillisecond := limit.tokensPerNanosecond() * float64(time.Millisecond)
+	nowMilliseconds := time.Now().UnixNano() / int64(time.Millisecond)
+
+	result, err := s.client.Eval(
+		ctx,
+		tokenBucketScript,
+		[]string{s.KeyPrefix + key},
+		limit.Burst,
+		strconv.FormatFloat(tokensPerMillisecond, 'f', -1, 64),
+		nowMilliseconds,
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot take token from Redis")
+	}
+
+	waitMilliseconds, ok := result.(int64)
+	if !ok {
+		return 0, errors.Errorf("unexpected result of the token bucket script: %#v", result)
+	}
+
+	return time.Duration(waitMilliseconds) * time.Millisecond, nil
+}
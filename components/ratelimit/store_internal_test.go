@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_expired_buckets_removed(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time {
+		return now
+	}
+
+	take := func(key string, limit Limit) time.Duration {
+		wait, err := store.Take(context.Background(), key, limit)
+		require.NoError(t, err)
+		return wait
+	}
+
+	take("short", Limit{Events: 1, Interval: time.Second})
+	take("long", Limit{Events: 1, Interval: time.Hour})
+	assert.Len(t, store.buckets, 2)
+
+	now = now.Add(memoryStoreSweepInterval)
+	take("other", Limit{Events: 1, Interval: time.Second})
+
+	assert.NotContains(t, store.buckets, "short", "refilled bucket should be removed")
+	assert.Contains(t, store.buckets, "long", "bucket should be kept until it's refilled")
+	assert.Contains(t, store.buckets, "other")
+
+	assert.NotZero(t, take("long", Limit{Events: 1, Interval: time.Hour}), "limit should still apply to kept bucket")
+}
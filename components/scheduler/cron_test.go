@@ -0,0 +1,58 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/components/scheduler"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	// Monday
+	now := time.Date(2019, 2, 18, 10, 7, 30, 0, time.UTC)
+
+	testCases := []struct {
+		Expr string
+		Next time.Time
+	}{
+		{Expr: "* * * * *", Next: time.Date(2019, 2, 18, 10, 8, 0, 0, time.UTC)},
+		{Expr: "*/5 * * * *", Next: time.Date(2019, 2, 18, 10, 10, 0, 0, time.UTC)},
+		{Expr: "0 * * * *", Next: time.Date(2019, 2, 18, 11, 0, 0, 0, time.UTC)},
+		{Expr: "30 9 * * *", Next: time.Date(2019, 2, 19, 9, 30, 0, 0, time.UTC)},
+		{Expr: "0 8-9,12 * * *", Next: time.Date(2019, 2, 18, 12, 0, 0, 0, time.UTC)},
+		{Expr: "0 0 * * 5", Next: time.Date(2019, 2, 22, 0, 0, 0, 0, time.UTC)},
+		{Expr: "0 0 1 * *", Next: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Expr: "0 0 29 2 *", Next: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{Expr: "0 0 1 * 3", Next: time.Date(2019, 2, 20, 0, 0, 0, 0, time.UTC)},
+		{Expr: "@daily", Next: time.Date(2019, 2, 19, 0, 0, 0, 0, time.UTC)},
+		{Expr: "0 0 30 2 *", Next: time.Time{}},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.Expr, func(t *testing.T) {
+			schedule, err := scheduler.ParseCron(c.Expr)
+			require.NoError(t, err)
+
+			assert.Equal(t, c.Next, schedule.Next(now))
+		})
+	}
+}
+
+func TestParseCron_invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		_, err := scheduler.ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
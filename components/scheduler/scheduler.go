@@ -0,0 +1,217 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// ScheduledAtMetadataKey is the metadata key with the time for which the message was scheduled, in RFC3339 format.
+const ScheduledAtMetadataKey = "scheduled_at"
+
+// MessageFunc creates the message published at the scheduled time.
+type MessageFunc func(scheduledAt time.Time) (*message.Message, error)
+
+// LeaderElector decides if this instance should publish the scheduled messages.
+// It allows running the scheduler in multiple instances, with only one of them publishing.
+type LeaderElector interface {
+	// IsLeader is called before every publish. When it returns false or an error, the message is not published.
+	IsLeader(ctx context.Context) (bool, error)
+}
+
+// LeaderElectorFunc allows to use a function as LeaderElector.
+type LeaderElectorFunc func(ctx context.Context) (bool, error)
+
+func (f LeaderElectorFunc) IsLeader(ctx context.Context) (bool, error) {
+	return f(ctx)
+}
+
+type Config struct {
+	// LeaderElector is optional. When nil, the instance always publishes the scheduled messages.
+	LeaderElector LeaderElector
+
+	// Location is the time zone in which cron expressions are evaluated. Defaults to time.Local.
+	Location *time.Location
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.Location == nil {
+		c.Location = time.Local
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+// Cron publishes messages at the times defined by cron expressions or intervals.
+//
+// It replaces ad-hoc tickers publishing messages, which trigger the Router's handlers.
+type Cron struct {
+	publisher message.Publisher
+	config    Config
+
+	jobs     []*job
+	jobsLock sync.Mutex
+
+	runCtx  context.Context
+	running bool
+	jobsWg  sync.WaitGroup
+}
+
+type job struct {
+	schedule   Schedule
+	topic      string
+	newMessage MessageFunc
+}
+
+func NewCron(publisher message.Publisher, config Config) (*Cron, error) {
+	if publisher == nil {
+		return nil, errors.New("missing publisher")
+	}
+	config.setDefaults()
+
+	return &Cron{
+		publisher: publisher,
+		config:    config,
+	}, nil
+}
+
+// Add publishes the message created by newMessage to the topic, according to the cron expression (see ParseCron).
+func (c *Cron) Add(cronExpr string, topic string, newMessage MessageFunc) error {
+	schedule, err := ParseCron(cronExpr)
+	if err != nil {
+		return err
+	}
+
+	return c.AddSchedule(schedule, topic, newMessage)
+}
+
+// Every publishes the message created by newMessage to the topic every interval.
+func (c *Cron) Every(interval time.Duration, topic string, newMessage MessageFunc) error {
+	if interval <= 0 {
+		return errors.Errorf("interval must be positive, got %s", interval)
+	}
+
+	return c.AddSchedule(IntervalSchedule{interval}, topic, newMessage)
+}
+
+// AddSchedule publishes the message created by newMessage to the topic, according to the schedule.
+//
+// Jobs can be added also when Cron is running.
+func (c *Cron) AddSchedule(schedule Schedule, topic string, newMessage MessageFunc) error {
+	if newMessage == nil {
+		return errors.New("missing MessageFunc")
+	}
+
+	c.jobsLock.Lock()
+	defer c.jobsLock.Unlock()
+
+	j := &job{schedule: schedule, topic: topic, newMessage: newMessage}
+	c.jobs = append(c.jobs, j)
+
+	if c.running {
+		c.startJob(c.runCtx, j)
+	}
+
+	return nil
+}
+
+// Run starts publishing scheduled messages. It blocks until the context is canceled.
+func (c *Cron) Run(ctx context.Context) error {
+	c.jobsLock.Lock()
+	if c.running {
+		c.jobsLock.Unlock()
+		return errors.New("cron is already running")
+	}
+	c.running = true
+	c.runCtx = ctx
+
+	for _, j := range c.jobs {
+		c.startJob(ctx, j)
+	}
+	jobsCount := len(c.jobs)
+	c.jobsLock.Unlock()
+
+	c.config.Logger.Info("Cron started", watermill.LogFields{"jobs": jobsCount})
+
+	<-ctx.Done()
+	c.jobsWg.Wait()
+
+	c.jobsLock.Lock()
+	c.running = false
+	c.jobsLock.Unlock()
+
+	c.config.Logger.Info("Cron stopped", nil)
+
+	return nil
+}
+
+// startJob runs the job in the background. jobsLock must be held by the caller.
+func (c *Cron) startJob(ctx context.Context, j *job) {
+	c.jobsWg.Add(1)
+
+	go func() {
+		defer c.jobsWg.Done()
+
+		for {
+			now := time.Now().In(c.config.Location)
+			next := j.schedule.Next(now)
+			if next.IsZero() {
+				c.config.Logger.Info("Schedule has no next activation, stopping job", watermill.LogFields{"topic": j.topic})
+				return
+			}
+
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+
+			c.fire(ctx, j, next)
+		}
+	}()
+}
+
+func (c *Cron) fire(ctx context.Context, j *job, scheduledAt time.Time) {
+	logFields := watermill.LogFields{
+		"topic":        j.topic,
+		"scheduled_at": scheduledAt,
+	}
+
+	if c.config.LeaderElector != nil {
+		leader, err := c.config.LeaderElector.IsLeader(ctx)
+		if err != nil {
+			c.config.Logger.Error("Cannot check leadership, message not published", err, logFields)
+			return
+		}
+		if !leader {
+			c.config.Logger.Trace("Not a leader, message not published", logFields)
+			return
+		}
+	}
+
+	msg, err := j.newMessage(scheduledAt)
+	if err != nil {
+		c.config.Logger.Error("Cannot create scheduled message", err, logFields)
+		return
+	}
+	if msg.Metadata.Get(ScheduledAtMetadataKey) == "" {
+		msg.Metadata.Set(ScheduledAtMetadataKey, scheduledAt.Format(time.RFC3339))
+	}
+
+	if err := c.publisher.Publish(j.topic, msg); err != nil {
+		c.config.Logger.Error("Cannot publish scheduled message", err, logFields)
+		return
+	}
+
+	c.config.Logger.Trace("Scheduled message published", logFields.Add(watermill.LogFields{"message_uuid": msg.UUID}))
+}
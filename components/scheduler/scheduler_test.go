@@ -0,0 +1,96 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/scheduler"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+)
+
+func TestCron_Every(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	defer pubSub.Close()
+
+	messages, err := pubSub.Subscribe(context.Background(), "ticks")
+	require.NoError(t, err)
+
+	cron, err := scheduler.NewCron(pubSub, scheduler.Config{})
+	require.NoError(t, err)
+
+	require.NoError(t, cron.Every(time.Millisecond*10, "ticks", func(scheduledAt time.Time) (*message.Message, error) {
+		return message.NewMessage(watermill.NewUUID(), []byte("tick")), nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		assert.NoError(t, cron.Run(ctx))
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-messages:
+			assert.Equal(t, []byte("tick"), []byte(msg.Payload))
+			assert.NotEmpty(t, msg.Metadata.Get(scheduler.ScheduledAtMetadataKey))
+			msg.Ack()
+		case <-time.After(time.Second):
+			t.Fatal("scheduled message not received")
+		}
+	}
+}
+
+func TestCron_not_leader(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	defer pubSub.Close()
+
+	messages, err := pubSub.Subscribe(context.Background(), "ticks")
+	require.NoError(t, err)
+
+	leaderChecked := make(chan struct{}, 10)
+	cron, err := scheduler.NewCron(pubSub, scheduler.Config{
+		LeaderElector: scheduler.LeaderElectorFunc(func(ctx context.Context) (bool, error) {
+			leaderChecked <- struct{}{}
+			return false, nil
+		}),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cron.Every(time.Millisecond*10, "ticks", func(scheduledAt time.Time) (*message.Message, error) {
+		return message.NewMessage(watermill.NewUUID(), nil), nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		assert.NoError(t, cron.Run(ctx))
+	}()
+
+	<-leaderChecked
+	<-leaderChecked
+
+	select {
+	case <-messages:
+		t.Fatal("message should not be published, when the instance is not a leader")
+	case <-time.After(time.Millisecond * 50):
+		// ok
+	}
+}
+
+func TestCron_Add_invalid_expression(t *testing.T) {
+	cron, err := scheduler.NewCron(gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{}), scheduler.Config{})
+	require.NoError(t, err)
+
+	err = cron.Add("invalid", "topic", func(scheduledAt time.Time) (*message.Message, error) {
+		return message.NewMessage(watermill.NewUUID(), nil), nil
+	})
+	assert.Error(t, err)
+}
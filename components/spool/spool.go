@@ -0,0 +1,537 @@
+// Package spool provides a publisher, which stores messages in a local write-ahead log, when the broker is unavailable,
+// and publishes them later, when the broker is back.
+package spool
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Names of the metrics reported to Config.MetricsSink.
+const (
+	MetricMessagesSpooled  = "spool_messages_spooled_total"
+	MetricMessagesReplayed = "spool_messages_replayed_total"
+	MetricMessagesRejected = "spool_messages_rejected_total"
+	// MetricMessagesCorrupted counts the unparsable records moved out of the write-ahead log.
+	MetricMessagesCorrupted = "spool_messages_corrupted_total"
+	// MetricMessagesFailed counts the records moved out of the write-ahead log, because they can't be published.
+	MetricMessagesFailed = "spool_messages_failed_total"
+)
+
+const (
+	walFileName    = "spool.wal"
+	offsetFileName = "spool.offset"
+	// corruptFileName is the file, to which the unparsable records of the write-ahead log are moved.
+	corruptFileName = "spool.corrupt"
+	// failedFileName is the file, to which the records which can't be published are moved.
+	failedFileName = "spool.failed"
+)
+
+// ErrSpoolFull is returned by Publish, when the broker is unavailable and the spool reached Config.MaxSizeBytes.
+var ErrSpoolFull = errors.New("spool is full")
+
+type Config struct {
+	// Dir is the directory in which the write-ahead log is stored. It is created, when it doesn't exist.
+	// Messages spooled before the restart are replayed after the Publisher is created again with the same Dir.
+	Dir string
+
+	// MaxSizeBytes limits the size of the write-ahead log. When 0, the size is not limited.
+	MaxSizeBytes int64
+
+	// ReplayInterval is the interval, in which publishing of the spooled messages is retried. Defaults to 5s.
+	ReplayInterval time.Duration
+
+	// IsRetryable tells if publishing which failed with the error may succeed later, for example
+	// googlecloud.IsRetryableError. Messages failed with other errors are not spooled and Publish returns the error.
+	// Defaults to treating all errors as retryable.
+	IsRetryable func(err error) bool
+
+	// MaxReplayAttempts limits the attempts of replaying a spooled message. When exceeded, the message
+	// is moved to the spool.failed file in Dir, so it doesn't block the messages spooled after it.
+	// When 0, the attempts are not limited.
+	MaxReplayAttempts int
+
+	// MetricsSink is optional and receives counters of spooled, replayed and rejected messages.
+	MetricsSink metrics.MetricsSink
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.ReplayInterval == 0 {
+		c.ReplayInterval = time.Second * 5
+	}
+	if c.IsRetryable == nil {
+		c.IsRetryable = func(err error) bool { return true }
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Dir == "" {
+		return errors.New("missing Dir")
+	}
+	if c.MaxSizeBytes < 0 {
+		return errors.New("MaxSizeBytes cannot be negative")
+	}
+	if c.ReplayInterval < 0 {
+		return errors.New("ReplayInterval cannot be negative")
+	}
+	if c.MaxReplayAttempts < 0 {
+		return errors.New("MaxReplayAttempts cannot be negative")
+	}
+
+	return nil
+}
+
+// Stats are the current statistics of the spool.
+type Stats struct {
+	// PendingMessages is the number of spooled messages, which were not replayed yet.
+	PendingMessages int
+	// SizeBytes is the size of the write-ahead log.
+	SizeBytes int64
+}
+
+// Publisher decorates the publisher with the local spool.
+//
+// When publishing fails with a retryable error (see Config.IsRetryable), the messages are appended
+// to the write-ahead log and Publish returns no error.
+// The spooled messages are replayed in order in the background. As long as there are spooled messages,
+// all new messages are spooled as well, to keep the order of messages.
+// Publish calls are serialized with the replay, so a new message never overtakes the spooled ones.
+//
+// Delivery is at-least-once: when publishing of a batch fails in the middle, the whole batch is spooled.
+// Records of the write-ahead log which can't be parsed are skipped and moved to the spool.corrupt file in Config.Dir.
+// Records which fail with a non-retryable error or exceed Config.MaxReplayAttempts are moved to the spool.failed file.
+type Publisher struct {
+	pub    message.Publisher
+	config Config
+
+	wal          *os.File
+	walSize      int64
+	readOffset   int64
+	pendingCount int
+	lock         sync.Mutex
+
+	// publishLock is held while deciding between publishing directly and spooling and while publishing,
+	// so the messages are published in the order in which they were spooled or published.
+	publishLock sync.Mutex
+	// replayAttempts is the number of failed replays of the oldest spooled message, guarded by publishLock.
+	replayAttempts int
+
+	closing chan struct{}
+	closed  chan struct{}
+}
+
+// spooledMessage is a single record of the write-ahead log.
+type spooledMessage struct {
+	Topic    string           `json:"topic"`
+	UUID     string           `json:"uuid"`
+	Metadata message.Metadata `json:"metadata,omitempty"`
+	Payload  message.Payload  `json:"payload"`
+}
+
+func NewPublisher(pub message.Publisher, config Config) (*Publisher, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid spool config")
+	}
+
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "cannot create spool dir")
+	}
+
+	wal, err := os.OpenFile(filepath.Join(config.Dir, walFileName), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open spool write-ahead log")
+	}
+
+	p := &Publisher{
+		pub:     pub,
+		config:  config,
+		wal:     wal,
+		closing: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+
+	if err := p.load(); err != nil {
+		_ = wal.Close()
+		return nil, err
+	}
+	if p.pendingCount > 0 {
+		config.Logger.Info("Found spooled messages", watermill.LogFields{"pending_messages": p.pendingCount})
+	}
+
+	go p.replayLoop()
+
+	return p, nil
+}
+
+// PublisherDecorator creates a publisher decorator, which adds the spool to the publisher.
+func PublisherDecorator(config Config) message.PublisherDecorator {
+	return func(pub message.Publisher) (message.Publisher, error) {
+		return NewPublisher(pub, config)
+	}
+}
+
+// load restores the state of the spool from the files.
+func (p *Publisher) load() error {
+	info, err := p.wal.Stat()
+	if err != nil {
+		return errors.Wrap(err, "cannot stat spool write-ahead log")
+	}
+	p.walSize = info.Size()
+
+	offset, err := ioutil.ReadFile(p.offsetFilePath())
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "cannot read spool offset")
+	}
+	if len(offset) > 0 {
+		p.readOffset, err = strconv.ParseInt(strings.TrimSpace(string(offset)), 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "invalid spool offset")
+		}
+	}
+	if p.readOffset > p.walSize {
+		return errors.Errorf("spool offset %d exceeds the write-ahead log size %d", p.readOffset, p.walSize)
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(p.wal, p.readOffset, p.walSize-p.readOffset))
+	recordsEnd := p.readOffset
+	for {
+		record, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot read spool write-ahead log")
+		}
+		recordsEnd += int64(len(record))
+		p.pendingCount++
+	}
+
+	if recordsEnd < p.walSize {
+		// the last record was not fully written, for example because of a crash
+		p.config.Logger.Info("Removing incomplete record from spool write-ahead log", nil)
+		if err := p.wal.Truncate(recordsEnd); err != nil {
+			return errors.Wrap(err, "cannot truncate spool write-ahead log")
+		}
+		p.walSize = recordsEnd
+	}
+
+	return nil
+}
+
+func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	p.publishLock.Lock()
+	defer p.publishLock.Unlock()
+
+	p.lock.Lock()
+	pending := p.pendingCount
+	p.lock.Unlock()
+
+	if pending == 0 {
+		// the lock is not held while publishing, so a slow broker doesn't block Stats
+		err := p.pub.Publish(topic, messages...)
+		if err == nil {
+			return nil
+		}
+		if !p.config.IsRetryable(err) {
+			// replaying of the messages would fail as well and block the messages spooled after them
+			return err
+		}
+
+		p.config.Logger.Error("Publish failed, spooling messages", err, watermill.LogFields{
+			"topic":          topic,
+			"messages_count": len(messages),
+		})
+	}
+
+	return p.spool(topic, messages)
+}
+
+// spool appends the messages to the write-ahead log.
+func (p *Publisher) spool(topic string, messages []*message.Message) error {
+	var records []byte
+	for _, msg := range messages {
+		record, err := json.Marshal(spooledMessage{
+			Topic:    topic,
+			UUID:     msg.UUID,
+			Metadata: msg.Metadata,
+			Payload:  msg.Payload,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal message %s", msg.UUID)
+		}
+		records = append(records, record...)
+		records = append(records, '\n')
+	}
+
+	if err := p.appendRecords(topic, records, len(messages)); err != nil {
+		return err
+	}
+
+	// the records are already visible to the replay, so the lock doesn't need to be held during fsync
+	if err := p.wal.Sync(); err != nil {
+		return errors.Wrap(err, "cannot sync spool write-ahead log")
+	}
+
+	p.incCounter(MetricMessagesSpooled, topic, len(messages))
+
+	return nil
+}
+
+// appendRecords writes the records to the write-ahead log and adds them to the pending messages.
+func (p *Publisher) appendRecords(topic string, records []byte, count int) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.config.MaxSizeBytes > 0 && p.walSize+int64(len(records)) > p.config.MaxSizeBytes {
+		p.incCounter(MetricMessagesRejected, topic, count)
+		return ErrSpoolFull
+	}
+
+	n, err := p.wal.Write(records)
+	if err != nil {
+		if n > 0 {
+			// the incomplete record would corrupt the next one appended after it
+			if truncateErr := p.wal.Truncate(p.walSize); truncateErr != nil {
+				p.config.Logger.Error("Cannot remove incomplete record from spool write-ahead log", truncateErr, nil)
+				p.walSize += int64(n)
+			}
+		}
+		return errors.Wrap(err, "cannot write to spool write-ahead log")
+	}
+
+	p.walSize += int64(n)
+	p.pendingCount += count
+
+	return nil
+}
+
+func (p *Publisher) replayLoop() {
+	defer close(p.closed)
+
+	ticker := time.NewTicker(p.config.ReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closing:
+			return
+		case <-ticker.C:
+		}
+
+		if err := p.replay(); err != nil {
+			p.config.Logger.Error("Cannot replay spooled messages", err, nil)
+		}
+	}
+}
+
+// replay publishes the spooled messages in order, until all are published or publishing fails.
+func (p *Publisher) replay() error {
+	for {
+		select {
+		case <-p.closing:
+			return nil
+		default:
+		}
+
+		done, err := p.replayNext()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// replayNext publishes the oldest spooled message. It returns true, when there are no more spooled messages.
+func (p *Publisher) replayNext() (bool, error) {
+	p.publishLock.Lock()
+	defer p.publishLock.Unlock()
+
+	p.lock.Lock()
+	if p.pendingCount == 0 {
+		p.lock.Unlock()
+		return true, nil
+	}
+
+	offset := p.readOffset
+	reader := bufio.NewReader(io.NewSectionReader(p.wal, offset, p.walSize-offset))
+	line, err := reader.ReadBytes('\n')
+	p.lock.Unlock()
+	if err != nil {
+		return false, errors.Wrap(err, "cannot read spool write-ahead log")
+	}
+
+	spooled := spooledMessage{}
+	if err := json.Unmarshal(line, &spooled); err != nil {
+		// the record would block the replay forever, so it's moved aside
+		if err := p.quarantine(line, p.corruptFilePath(), MetricMessagesCorrupted, ""); err != nil {
+			return false, err
+		}
+		p.config.Logger.Error("Moved unparsable record out of spool write-ahead log", err, watermill.LogFields{
+			"offset":       offset,
+			"corrupt_file": p.corruptFilePath(),
+		})
+		return p.advance(line)
+	}
+
+	msg := message.NewMessage(spooled.UUID, spooled.Payload)
+	for k, v := range spooled.Metadata {
+		msg.Metadata.Set(k, v)
+	}
+
+	// only the replay loop advances the read offset, so the lock is not held while publishing;
+	// publishLock keeps new messages spooled until the record is published and the offset advanced
+	if err := p.pub.Publish(spooled.Topic, msg); err != nil {
+		p.replayAttempts++
+		if p.config.IsRetryable(err) && (p.config.MaxReplayAttempts == 0 || p.replayAttempts < p.config.MaxReplayAttempts) {
+			return false, errors.Wrapf(err, "cannot publish spooled message %s", msg.UUID)
+		}
+
+		// the record would block the replay forever, so it's moved aside
+		if err := p.quarantine(line, p.failedFilePath(), MetricMessagesFailed, spooled.Topic); err != nil {
+			return false, err
+		}
+		p.config.Logger.Error("Moved spooled message which can't be published out of spool write-ahead log", err, watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"topic":        spooled.Topic,
+			"attempts":     p.replayAttempts,
+			"failed_file":  p.failedFilePath(),
+		})
+		return p.advance(line)
+	}
+
+	p.incCounter(MetricMessagesReplayed, spooled.Topic, 1)
+
+	return p.advance(line)
+}
+
+// advance moves the read offset past the replayed record.
+func (p *Publisher) advance(record []byte) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.readOffset += int64(len(record))
+	p.pendingCount--
+	p.replayAttempts = 0
+
+	if p.pendingCount == 0 {
+		p.config.Logger.Info("All spooled messages replayed", nil)
+		return true, p.truncate()
+	}
+
+	return false, p.writeOffset()
+}
+
+// quarantine appends the record, which can't be replayed, to the file.
+func (p *Publisher) quarantine(record []byte, path string, metric string, topic string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "cannot open %s", path)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(record); err != nil {
+		return errors.Wrapf(err, "cannot write to %s", path)
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrapf(err, "cannot sync %s", path)
+	}
+
+	p.incCounter(metric, topic, 1)
+
+	return nil
+}
+
+// truncate removes the replayed messages from the write-ahead log. lock must be held by the caller.
+func (p *Publisher) truncate() error {
+	if err := p.wal.Truncate(0); err != nil {
+		return errors.Wrap(err, "cannot truncate spool write-ahead log")
+	}
+	p.walSize = 0
+	p.readOffset = 0
+
+	return p.writeOffset()
+}
+
+// writeOffset persists the offset of the first not replayed message. lock must be held by the caller.
+func (p *Publisher) writeOffset() error {
+	if err := ioutil.WriteFile(p.offsetFilePath(), []byte(strconv.FormatInt(p.readOffset, 10)), 0600); err != nil {
+		return errors.Wrap(err, "cannot write spool offset")
+	}
+
+	return nil
+}
+
+func (p *Publisher) offsetFilePath() string {
+	return filepath.Join(p.config.Dir, offsetFileName)
+}
+
+func (p *Publisher) corruptFilePath() string {
+	return filepath.Join(p.config.Dir, corruptFileName)
+}
+
+func (p *Publisher) failedFilePath() string {
+	return filepath.Join(p.config.Dir, failedFileName)
+}
+
+func (p *Publisher) incCounter(name string, topic string, count int) {
+	if p.config.MetricsSink == nil {
+		return
+	}
+
+	labels := map[string]string{"topic": topic}
+	for i := 0; i < count; i++ {
+		p.config.MetricsSink.IncCounter(name, labels)
+	}
+}
+
+// Stats returns the current statistics of the spool.
+func (p *Publisher) Stats() Stats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return Stats{
+		PendingMessages: p.pendingCount,
+		SizeBytes:       p.walSize,
+	}
+}
+
+// Close stops replaying and closes the decorated publisher.
+// The messages which were not replayed stay in the write-ahead log and are replayed after restart.
+func (p *Publisher) Close() error {
+	select {
+	case <-p.closing:
+		return nil
+	default:
+	}
+
+	close(p.closing)
+	<-p.closed
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if err := p.wal.Close(); err != nil {
+		return errors.Wrap(err, "cannot close spool write-ahead log")
+	}
+
+	return p.pub.Close()
+}
@@ -0,0 +1,380 @@
+package spool_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/components/spool"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type flakyPublisher struct {
+	available bool
+	published []*message.Message
+	topics    []string
+	lock      sync.Mutex
+}
+
+func (p *flakyPublisher) setAvailable(available bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.available = available
+}
+
+func (p *flakyPublisher) Publish(topic string, messages ...*message.Message) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.available {
+		return errors.New("broker unavailable")
+	}
+
+	for _, msg := range messages {
+		p.published = append(p.published, msg)
+		p.topics = append(p.topics, topic)
+	}
+	return nil
+}
+
+func (p *flakyPublisher) publishedUUIDs() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var uuids []string
+	for _, msg := range p.published {
+		uuids = append(uuids, msg.UUID)
+	}
+	return uuids
+}
+
+func (p *flakyPublisher) Close() error {
+	return nil
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "watermill-spool")
+	require.NoError(t, err)
+	return dir
+}
+
+func waitForReplay(t *testing.T, spoolPub *spool.Publisher) {
+	timeout := time.After(time.Second)
+	for spoolPub.Stats().PendingMessages > 0 {
+		select {
+		case <-timeout:
+			t.Fatal("spooled messages not replayed")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func TestPublisher_spools_and_replays_in_order(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &flakyPublisher{available: true}
+	spoolPub, err := spool.NewPublisher(pub, spool.Config{Dir: dir, ReplayInterval: time.Millisecond * 10})
+	require.NoError(t, err)
+	defer spoolPub.Close()
+
+	require.NoError(t, spoolPub.Publish("topic", message.NewMessage("1", []byte("1"))))
+
+	pub.setAvailable(false)
+	msg2 := message.NewMessage("2", []byte("2"))
+	msg2.Metadata.Set("key", "value")
+	require.NoError(t, spoolPub.Publish("topic", msg2))
+	require.NoError(t, spoolPub.Publish("other_topic", message.NewMessage("3", []byte("3"))))
+
+	assert.Equal(t, 2, spoolPub.Stats().PendingMessages)
+
+	pub.setAvailable(true)
+	waitForReplay(t, spoolPub)
+
+	require.NoError(t, spoolPub.Publish("topic", message.NewMessage("4", []byte("4"))))
+
+	assert.Equal(t, []string{"1", "2", "3", "4"}, pub.publishedUUIDs())
+	assert.Equal(t, []string{"topic", "topic", "other_topic", "topic"}, pub.topics)
+	assert.Equal(t, "value", pub.published[1].Metadata.Get("key"))
+	assert.Equal(t, "2", string(pub.published[1].Payload))
+	assert.EqualValues(t, 0, spoolPub.Stats().SizeBytes)
+}
+
+func TestPublisher_replays_after_restart(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &flakyPublisher{available: false}
+	spoolPub, err := spool.NewPublisher(pub, spool.Config{Dir: dir, ReplayInterval: time.Hour})
+	require.NoError(t, err)
+
+	require.NoError(t, spoolPub.Publish("topic", message.NewMessage("1", nil), message.NewMessage("2", nil)))
+	require.NoError(t, spoolPub.Close())
+
+	pub.setAvailable(true)
+	spoolPub, err = spool.NewPublisher(pub, spool.Config{Dir: dir, ReplayInterval: time.Millisecond * 10})
+	require.NoError(t, err)
+	defer spoolPub.Close()
+
+	assert.Equal(t, 2, spoolPub.Stats().PendingMessages)
+
+	waitForReplay(t, spoolPub)
+	assert.Equal(t, []string{"1", "2"}, pub.publishedUUIDs())
+}
+
+func TestPublisher_max_size(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &flakyPublisher{available: false}
+	spoolPub, err := spool.NewPublisher(pub, spool.Config{Dir: dir, MaxSizeBytes: 100, ReplayInterval: time.Hour})
+	require.NoError(t, err)
+	defer spoolPub.Close()
+
+	require.NoError(t, spoolPub.Publish("topic", message.NewMessage("1", nil)))
+
+	err = spoolPub.Publish("topic", message.NewMessage("2", make([]byte, 100)))
+	assert.Equal(t, spool.ErrSpoolFull, err)
+	assert.Equal(t, 1, spoolPub.Stats().PendingMessages)
+}
+
+func TestPublisher_quarantines_unparsable_record(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &flakyPublisher{available: false}
+	spoolPub, err := spool.NewPublisher(pub, spool.Config{Dir: dir, ReplayInterval: time.Hour})
+	require.NoError(t, err)
+
+	require.NoError(t, spoolPub.Publish("topic", message.NewMessage("1", nil)))
+	require.NoError(t, spoolPub.Close())
+
+	walPath := filepath.Join(dir, "spool.wal")
+	wal, err := ioutil.ReadFile(walPath)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(walPath, append([]byte("not a record\n"), wal...), 0600))
+
+	pub.setAvailable(true)
+	spoolPub, err = spool.NewPublisher(pub, spool.Config{Dir: dir, ReplayInterval: time.Millisecond * 10})
+	require.NoError(t, err)
+	defer spoolPub.Close()
+
+	assert.Equal(t, 2, spoolPub.Stats().PendingMessages)
+
+	waitForReplay(t, spoolPub)
+	assert.Equal(t, []string{"1"}, pub.publishedUUIDs())
+
+	corrupted, err := ioutil.ReadFile(filepath.Join(dir, "spool.corrupt"))
+	require.NoError(t, err)
+	assert.Equal(t, "not a record\n", string(corrupted))
+}
+
+type blockingPublisher struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (p blockingPublisher) Publish(topic string, messages ...*message.Message) error {
+	close(p.started)
+	<-p.unblock
+	return nil
+}
+
+func (p blockingPublisher) Close() error {
+	return nil
+}
+
+func TestPublisher_lock_not_held_while_publishing(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := blockingPublisher{started: make(chan struct{}), unblock: make(chan struct{})}
+	spoolPub, err := spool.NewPublisher(pub, spool.Config{Dir: dir, ReplayInterval: time.Hour})
+	require.NoError(t, err)
+	defer spoolPub.Close()
+
+	unblockOnce := sync.Once{}
+	unblock := func() { unblockOnce.Do(func() { close(pub.unblock) }) }
+	defer unblock()
+
+	published := make(chan error)
+	go func() {
+		published <- spoolPub.Publish("topic", message.NewMessage("1", nil))
+	}()
+
+	<-pub.started
+
+	statsReturned := make(chan struct{})
+	go func() {
+		spoolPub.Stats()
+		close(statsReturned)
+	}()
+
+	select {
+	case <-statsReturned:
+	case <-time.After(time.Second):
+		t.Fatal("Stats blocked by the publish in progress")
+	}
+
+	unblock()
+	require.NoError(t, <-published)
+}
+
+// failingOncePublisher blocks the first publish until unblocked and fails it.
+type failingOncePublisher struct {
+	flakyPublisher
+
+	started chan struct{}
+	unblock chan struct{}
+	once    sync.Once
+}
+
+func (p *failingOncePublisher) Publish(topic string, messages ...*message.Message) error {
+	failed := false
+	p.once.Do(func() {
+		close(p.started)
+		<-p.unblock
+		failed = true
+	})
+	if failed {
+		return errors.New("broker unavailable")
+	}
+
+	return p.flakyPublisher.Publish(topic, messages...)
+}
+
+func TestPublisher_concurrent_publish_keeps_order(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &failingOncePublisher{
+		flakyPublisher: flakyPublisher{available: true},
+		started:        make(chan struct{}),
+		unblock:        make(chan struct{}),
+	}
+	spoolPub, err := spool.NewPublisher(pub, spool.Config{Dir: dir, ReplayInterval: time.Millisecond * 10})
+	require.NoError(t, err)
+	defer spoolPub.Close()
+
+	firstPublished := make(chan error)
+	go func() {
+		firstPublished <- spoolPub.Publish("topic", message.NewMessage("1", nil))
+	}()
+	<-pub.started
+
+	// the second message is published while the failing publish of the first one is in progress
+	secondPublished := make(chan error)
+	go func() {
+		secondPublished <- spoolPub.Publish("topic", message.NewMessage("2", nil))
+	}()
+
+	select {
+	case err := <-secondPublished:
+		t.Fatalf("second message published before the first one was spooled, err: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(pub.unblock)
+	require.NoError(t, <-firstPublished)
+	require.NoError(t, <-secondPublished)
+
+	waitForReplay(t, spoolPub)
+	assert.Equal(t, []string{"1", "2"}, pub.publishedUUIDs())
+}
+
+var errTopicRejected = errors.New("topic rejected")
+
+// rejectingPublisher fails to publish to the "rejected" topic, when the broker is available.
+type rejectingPublisher struct {
+	flakyPublisher
+}
+
+func (p *rejectingPublisher) Publish(topic string, messages ...*message.Message) error {
+	p.lock.Lock()
+	available := p.available
+	p.lock.Unlock()
+
+	if available && topic == "rejected" {
+		return errTopicRejected
+	}
+
+	return p.flakyPublisher.Publish(topic, messages...)
+}
+
+func isRetryable(err error) bool {
+	return err != errTopicRejected
+}
+
+func TestPublisher_non_retryable_error_not_spooled(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &rejectingPublisher{flakyPublisher{available: true}}
+	spoolPub, err := spool.NewPublisher(pub, spool.Config{Dir: dir, IsRetryable: isRetryable})
+	require.NoError(t, err)
+	defer spoolPub.Close()
+
+	err = spoolPub.Publish("rejected", message.NewMessage("1", nil))
+	assert.Equal(t, errTopicRejected, err)
+	assert.Equal(t, 0, spoolPub.Stats().PendingMessages)
+
+	require.NoError(t, spoolPub.Publish("topic", message.NewMessage("2", nil)))
+	assert.Equal(t, []string{"2"}, pub.publishedUUIDs())
+}
+
+func TestPublisher_moves_failed_records_aside(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config spool.Config
+	}{
+		{
+			Name:   "non_retryable",
+			Config: spool.Config{IsRetryable: isRetryable},
+		},
+		{
+			Name:   "max_replay_attempts",
+			Config: spool.Config{MaxReplayAttempts: 3},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+
+			pub := &rejectingPublisher{flakyPublisher{available: false}}
+
+			config := tc.Config
+			config.Dir = dir
+			config.ReplayInterval = time.Hour
+			spoolPub, err := spool.NewPublisher(pub, config)
+			require.NoError(t, err)
+
+			// the broker is unavailable, so the message is spooled even to the rejected topic
+			require.NoError(t, spoolPub.Publish("rejected", message.NewMessage("1", nil)))
+			require.NoError(t, spoolPub.Publish("topic", message.NewMessage("2", nil)))
+			require.NoError(t, spoolPub.Close())
+
+			pub.setAvailable(true)
+			config.ReplayInterval = time.Millisecond * 10
+			spoolPub, err = spool.NewPublisher(pub, config)
+			require.NoError(t, err)
+			defer spoolPub.Close()
+
+			waitForReplay(t, spoolPub)
+			assert.Equal(t, []string{"2"}, pub.publishedUUIDs())
+
+			failed, err := ioutil.ReadFile(filepath.Join(dir, "spool.failed"))
+			require.NoError(t, err)
+			assert.Contains(t, string(failed), `"uuid":"1"`)
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package sqlutil
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UniqueViolationFunc returns true, when the error is a violation of a unique index.
+type UniqueViolationFunc func(err error) bool
+
+// IsUniqueViolation returns true, when the error of MySQL, PostgreSQL or SQLite driver is a violation
+// of a unique index. It checks the error message, so it doesn't depend on any driver.
+func IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := strings.ToLower(errors.Cause(err).Error())
+
+	return strings.Contains(msg, "duplicate entry") || // MySQL
+		strings.Contains(msg, "duplicate key value") || // PostgreSQL
+		strings.Contains(msg, "unique constraint failed") // SQLite
+}
@@ -0,0 +1,22 @@
+package sqlutil_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThreeDotsLabs/watermill/components/sqlutil"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	assert.True(t, sqlutil.IsUniqueViolation(errors.New("Error 1062: Duplicate entry 'stream-1' for key 'stream_version'")))
+	assert.True(t, sqlutil.IsUniqueViolation(errors.Wrap(
+		errors.New(`pq: duplicate key value violates unique constraint "events_stream_id_version_key"`),
+		"cannot insert event",
+	)))
+	assert.True(t, sqlutil.IsUniqueViolation(errors.New("UNIQUE constraint failed: events.stream_id, events.version")))
+
+	assert.False(t, sqlutil.IsUniqueViolation(errors.New("connection refused")))
+	assert.False(t, sqlutil.IsUniqueViolation(nil))
+}
@@ -0,0 +1,33 @@
+// Package sqlutil contains the helpers shared by the components keeping their data in a SQL database.
+package sqlutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Placeholder returns the placeholder of the query argument with the index (starting from 1).
+//
+// Placeholders differ between the database/sql drivers: MySQL and SQLite use QuestionMarkPlaceholder,
+// PostgreSQL uses DollarPlaceholder.
+type Placeholder func(i int) string
+
+// QuestionMarkPlaceholder is the placeholder used by MySQL and SQLite. It's the default of all components.
+func QuestionMarkPlaceholder(int) string {
+	return "?"
+}
+
+// DollarPlaceholder is the placeholder used by PostgreSQL.
+func DollarPlaceholder(i int) string {
+	return fmt.Sprintf("$%d", i)
+}
+
+// List returns the comma separated placeholders of n arguments, starting with the index 1.
+func (p Placeholder) List(n int) string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = p(i + 1)
+	}
+
+	return strings.Join(placeholders, ", ")
+}
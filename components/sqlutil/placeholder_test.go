@@ -0,0 +1,15 @@
+package sqlutil_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThreeDotsLabs/watermill/components/sqlutil"
+)
+
+func TestPlaceholder_List(t *testing.T) {
+	assert.Equal(t, "?, ?, ?", sqlutil.Placeholder(sqlutil.QuestionMarkPlaceholder).List(3))
+	assert.Equal(t, "$1, $2", sqlutil.Placeholder(sqlutil.DollarPlaceholder).List(2))
+	assert.Equal(t, "", sqlutil.Placeholder(sqlutil.DollarPlaceholder).List(0))
+}
@@ -0,0 +1,201 @@
+// Package stateful provides effectively-once processing of messages, for handlers which keep their state
+// in a SQL database.
+//
+// The handler's state mutations and the UUID of the processed message are committed in one transaction,
+// so the state is changed exactly once per message, regardless of the Pub/Sub delivery guarantees.
+package stateful
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/sqlutil"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// TxProvider begins the transactions of handlers. It's implemented by *sql.DB.
+type TxProvider interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// HandlerFunc handles the message within the transaction.
+// All state mutations must be done with tx, so they are committed together with the processed message.
+type HandlerFunc func(ctx context.Context, tx *sql.Tx, msg *message.Message) ([]*message.Message, error)
+
+type Config struct {
+	// DB is the database with the processed messages table and the handlers' state tables, usually it's *sql.DB.
+	//
+	// The processed messages table needs to have the following columns:
+	//
+	//	handler_name  VARCHAR(255) NOT NULL
+	//	message_uuid  VARCHAR(36) NOT NULL
+	//
+	// and a unique index on (handler_name, message_uuid), which protects from concurrent processing
+	// of the same message.
+	DB TxProvider
+
+	// ProcessedMessagesTable is the name of the processed messages table. Defaults to "processed_messages".
+	ProcessedMessagesTable string
+
+	// HandlerNameColumn is the column of the processed messages table with the handler name.
+	// Defaults to "handler_name".
+	HandlerNameColumn string
+
+	// Placeholder of the query arguments. Defaults to sqlutil.QuestionMarkPlaceholder,
+	// use sqlutil.DollarPlaceholder for PostgreSQL.
+	Placeholder sqlutil.Placeholder
+
+	// TxOptions are used to begin the transaction. Optional.
+	TxOptions *sql.TxOptions
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *Config) setDefaults() {
+	if c.ProcessedMessagesTable == "" {
+		c.ProcessedMessagesTable = "processed_messages"
+	}
+	if c.HandlerNameColumn == "" {
+		c.HandlerNameColumn = "handler_name"
+	}
+	if c.Placeholder == nil {
+		c.Placeholder = sqlutil.QuestionMarkPlaceholder
+	}
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c Config) Validate() error {
+	if c.DB == nil {
+		return errors.New("missing DB")
+	}
+
+	return nil
+}
+
+// Processor wraps the stateful handlers with the transaction and deduplication of messages.
+type Processor struct {
+	config Config
+
+	selectQuery string
+	insertQuery string
+}
+
+func NewProcessor(config Config) (*Processor, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid stateful Processor config")
+	}
+
+	return &Processor{
+		config: config,
+		selectQuery: fmt.Sprintf(
+			"SELECT COUNT(*) FROM %s WHERE %s = %s AND message_uuid = %s",
+			config.ProcessedMessagesTable, config.HandlerNameColumn, config.Placeholder(1), config.Placeholder(2),
+		),
+		insertQuery: fmt.Sprintf(
+			"INSERT INTO %s (%s, message_uuid) VALUES (%s, %s)",
+			config.ProcessedMessagesTable, config.HandlerNameColumn, config.Placeholder(1), config.Placeholder(2),
+		),
+	}, nil
+}
+
+// HandlerFunc returns the message.HandlerFunc, which calls fn in the transaction with Process.
+func (p *Processor) HandlerFunc(handlerName string, fn HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		return p.Process(handlerName, msg, fn)
+	}
+}
+
+// Process calls fn with the message in the transaction, in which the message is marked as processed
+// by the handler with handlerName.
+//
+// The transaction is committed only when fn returns no error. When fn panics, the transaction is rolled back
+// and the panic is propagated. When the message was already processed by the handler with handlerName,
+// fn is not called and the message is acked.
+//
+// Messages produced by fn are published after the commit. When publishing fails, the redelivered message
+// is detected as already processed, so they are not published again. Use an outbox table written with tx,
+// when the produced messages must not be lost.
+func (p *Processor) Process(
+	handlerName string,
+	msg *message.Message,
+	fn HandlerFunc,
+) (producedMessages []*message.Message, err error) {
+	ctx := msg.Context()
+	logFields := watermill.LogFields{
+		"handler_name": handlerName,
+		"message_uuid": msg.UUID,
+	}
+
+	tx, err := p.config.DB.BeginTx(ctx, p.config.TxOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer func() {
+		// when fn panics, the processed message must not be committed,
+		// otherwise the message nacked by the Recoverer would be skipped after the redelivery
+		if r := recover(); r != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				p.config.Logger.Error("Cannot rollback transaction", rollbackErr, logFields)
+			}
+			panic(r)
+		}
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				p.config.Logger.Error("Cannot rollback transaction", rollbackErr, logFields)
+			}
+			return
+		}
+		if commitErr := tx.Commit(); commitErr != nil {
+			producedMessages = nil
+			err = errors.Wrap(commitErr, "cannot commit transaction")
+		}
+	}()
+
+	var processed int
+	if err := tx.QueryRowContext(ctx, p.selectQuery, handlerName, msg.UUID).Scan(&processed); err != nil {
+		return nil, errors.Wrap(err, "cannot check if message was processed")
+	}
+	if processed > 0 {
+		p.config.Logger.Debug("Message already processed, skipping", logFields)
+		return nil, nil
+	}
+
+	// when the message is processed concurrently, the unique index makes one of the transactions fail
+	if _, err := tx.ExecContext(ctx, p.insertQuery, handlerName, msg.UUID); err != nil {
+		return nil, errors.Wrap(err, "cannot mark message as processed")
+	}
+
+	return fn(ctx, tx, msg)
+}
+
+// AddHandler adds the stateful handler to the router, like message.Router.AddHandler.
+func (p *Processor) AddHandler(
+	r *message.Router,
+	handlerName string,
+	subscribeTopic string,
+	subscriber message.Subscriber,
+	publishTopic string,
+	publisher message.Publisher,
+	fn HandlerFunc,
+) *message.Handler {
+	return r.AddHandler(handlerName, subscribeTopic, subscriber, publishTopic, publisher, p.HandlerFunc(handlerName, fn))
+}
+
+// AddNoPublisherHandler adds the stateful handler, which doesn't publish messages, to the router,
+// like message.Router.AddNoPublisherHandler.
+func (p *Processor) AddNoPublisherHandler(
+	r *message.Router,
+	handlerName string,
+	subscribeTopic string,
+	subscriber message.Subscriber,
+	fn HandlerFunc,
+) *message.Handler {
+	return r.AddNoPublisherHandler(handlerName, subscribeTopic, subscriber, p.HandlerFunc(handlerName, fn))
+}
@@ -0,0 +1,226 @@
+package stateful_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/stateful"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// fakeDB is a minimal database/sql driver, which supports only the queries used in the tests.
+// Changes are visible after the commit.
+type fakeDB struct {
+	lock      sync.Mutex
+	processed map[string]bool
+	counter   int
+}
+
+var db = &fakeDB{processed: map[string]bool{}}
+
+func init() {
+	sql.Register("stateful_fake", db)
+}
+
+func (d *fakeDB) Open(name string) (driver.Conn, error) {
+	return &fakeConn{db: d}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+
+	pendingProcessed []string
+	pendingCounter   int
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.pendingProcessed = nil
+	c.pendingCounter = 0
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.lock.Lock()
+	defer c.db.lock.Unlock()
+
+	for _, key := range c.pendingProcessed {
+		c.db.processed[key] = true
+	}
+	c.db.counter += c.pendingCounter
+
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s fakeStmt) Close() error {
+	return nil
+}
+
+func (s fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch {
+	case strings.HasPrefix(s.query, "INSERT INTO processed_messages"):
+		s.conn.pendingProcessed = append(s.conn.pendingProcessed, args[0].(string)+"/"+args[1].(string))
+	case strings.HasPrefix(s.query, "UPDATE counter"):
+		s.conn.pendingCounter++
+	default:
+		return nil, errors.Errorf("unsupported query %s", s.query)
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT COUNT(*) FROM processed_messages") {
+		return nil, errors.Errorf("unsupported query %s", s.query)
+	}
+
+	s.conn.db.lock.Lock()
+	defer s.conn.db.lock.Unlock()
+
+	count := int64(0)
+	if s.conn.db.processed[args[0].(string)+"/"+args[1].(string)] {
+		count = 1
+	}
+
+	return &fakeRows{values: []driver.Value{count}}, nil
+}
+
+type fakeRows struct {
+	values []driver.Value
+	read   bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"count"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.read {
+		return io.EOF
+	}
+	r.read = true
+	copy(dest, r.values)
+	return nil
+}
+
+func (d *fakeDB) counterValue() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.counter
+}
+
+func TestProcessor_HandlerFunc(t *testing.T) {
+	sqlDB, err := sql.Open("stateful_fake", "")
+	require.NoError(t, err)
+
+	processor, err := stateful.NewProcessor(stateful.Config{DB: sqlDB})
+	require.NoError(t, err)
+
+	failHandler := true
+	handler := processor.HandlerFunc("handler", func(ctx context.Context, tx *sql.Tx, msg *message.Message) ([]*message.Message, error) {
+		if _, err := tx.ExecContext(ctx, "UPDATE counter SET value = value + 1"); err != nil {
+			return nil, err
+		}
+		if failHandler {
+			return nil, errors.New("handler failed")
+		}
+
+		return []*message.Message{message.NewMessage(watermill.NewUUID(), nil)}, nil
+	})
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	msg.SetContext(context.Background())
+
+	// the state of the failed handler is rolled back
+	_, err = handler(msg)
+	require.Error(t, err)
+	assert.Equal(t, 0, db.counterValue())
+
+	failHandler = false
+	producedMessages, err := handler(msg)
+	require.NoError(t, err)
+	assert.Len(t, producedMessages, 1)
+	assert.Equal(t, 1, db.counterValue())
+
+	// redelivered message doesn't change the state again
+	producedMessages, err = handler(msg)
+	require.NoError(t, err)
+	assert.Empty(t, producedMessages)
+	assert.Equal(t, 1, db.counterValue())
+}
+
+func TestProcessor_HandlerFunc_panic(t *testing.T) {
+	sqlDB, err := sql.Open("stateful_fake", "")
+	require.NoError(t, err)
+
+	processor, err := stateful.NewProcessor(stateful.Config{DB: sqlDB})
+	require.NoError(t, err)
+
+	counterBefore := db.counterValue()
+
+	panicHandler := true
+	handler := processor.HandlerFunc("panic_handler", func(ctx context.Context, tx *sql.Tx, msg *message.Message) ([]*message.Message, error) {
+		if _, err := tx.ExecContext(ctx, "UPDATE counter SET value = value + 1"); err != nil {
+			return nil, err
+		}
+		if panicHandler {
+			panic("handler panicked")
+		}
+
+		return nil, nil
+	})
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	msg.SetContext(context.Background())
+
+	assert.PanicsWithValue(t, "handler panicked", func() {
+		_, _ = handler(msg)
+	})
+	assert.Equal(t, counterBefore, db.counterValue())
+
+	// redelivered message is not skipped, because the panicked transaction was rolled back
+	panicHandler = false
+	_, err = handler(msg)
+	require.NoError(t, err)
+	assert.Equal(t, counterBefore+1, db.counterValue())
+}
+
+func TestNewProcessor_missing_db(t *testing.T) {
+	_, err := stateful.NewProcessor(stateful.Config{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,232 @@
+// Command bench runs the same publish and consume scenarios against all Pub/Subs,
+// so the performance of adapters can be compared between releases.
+//
+// Brokers are started with `docker-compose up` from the root of the repository. Example usage:
+//
+//	go run . -pubsubs kafka,nats -messages 50000 -format json > results.json
+//	go run . -pubsubs kafka,nats -messages 50000 -baseline results.json
+//	go run . -pubsubs kafka -scenarios consume -cpuprofile profiles/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/renstrom/shortuuid"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+var (
+	pubSubsFlag   = flag.String("pubsubs", "gochannel,kafka,googlecloud,nats", "comma separated Pub/Subs to benchmark")
+	scenariosFlag = flag.String("scenarios", "", "comma separated scenarios to run (publish, consume, end_to_end), all by default")
+	messages      = flag.Int("messages", 10000, "number of messages in every scenario")
+	payloadSize   = flag.Int("payload", 256, "payload size in bytes")
+	publishers    = flag.Int("publishers", 1, "number of goroutines publishing concurrently")
+	timeout       = flag.Duration("timeout", time.Minute*5, "timeout of a single scenario")
+	format        = flag.String("format", "text", "report format: text or json")
+	baselinePath  = flag.String("baseline", "", "JSON report of the previous run, to compare the throughput with")
+	cpuProfileDir = flag.String("cpuprofile", "", "directory for CPU profiles of every scenario")
+	memProfileDir = flag.String("memprofile", "", "directory for heap profiles of every scenario")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	config := scenarioConfig{
+		Messages:    *messages,
+		PayloadSize: *payloadSize,
+		Publishers:  *publishers,
+		Timeout:     *timeout,
+	}
+	if config.Messages <= 0 || config.Publishers <= 0 || config.PayloadSize < 0 {
+		return errors.New("messages and publishers must be positive, payload cannot be negative")
+	}
+	if *format != "text" && *format != "json" {
+		return errors.Errorf("unknown format %s", *format)
+	}
+
+	baseline, err := readBaseline(*baselinePath)
+	if err != nil {
+		return err
+	}
+
+	chosenScenarios := map[string]bool{}
+	for _, name := range split(*scenariosFlag) {
+		chosenScenarios[name] = true
+	}
+
+	var results []Result
+
+	for _, pubSubName := range split(*pubSubsFlag) {
+		constructor, ok := pubSubs[pubSubName]
+		if !ok {
+			return errors.Errorf("unknown Pub/Sub %s, available: %s", pubSubName, strings.Join(pubSubNames(), ", "))
+		}
+
+		for _, s := range scenarios {
+			if len(chosenScenarios) > 0 && !chosenScenarios[s.Name] {
+				continue
+			}
+
+			fmt.Fprintf(os.Stderr, "Running %s/%s\n", pubSubName, s.Name)
+
+			result, err := runScenario(pubSubName, constructor, s.Name, s.Run, config)
+			if err != nil {
+				return errors.Wrapf(err, "%s/%s failed", pubSubName, s.Name)
+			}
+			results = append(results, result)
+		}
+	}
+
+	if *format == "json" {
+		return writeJSON(os.Stdout, results)
+	}
+	return writeText(os.Stdout, results, baseline)
+}
+
+func runScenario(
+	pubSubName string,
+	constructor pubSubConstructor,
+	scenarioName string,
+	run scenario,
+	config scenarioConfig,
+) (result Result, err error) {
+	runID := shortuuid.New()
+
+	pub, sub, err := constructor(runID)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "cannot create Pub/Sub")
+	}
+	defer func() {
+		if closeErr := closePubSub(pub, sub); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	profileName := pubSubName + "_" + scenarioName
+	stopCPUProfile, err := startCPUProfile(profileName)
+	if err != nil {
+		return Result{}, err
+	}
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	scenarioResult, err := run(ctx, pub, sub, "bench_"+scenarioName+"_"+runID, config)
+
+	runtime.ReadMemStats(&after)
+	stopCPUProfile()
+
+	if err != nil {
+		return Result{}, err
+	}
+	if err := writeHeapProfile(profileName); err != nil {
+		return Result{}, err
+	}
+
+	return newResult(
+		pubSubName,
+		scenarioName,
+		config,
+		scenarioResult,
+		after.Mallocs-before.Mallocs,
+		after.TotalAlloc-before.TotalAlloc,
+	), nil
+}
+
+func closePubSub(pub message.Publisher, sub message.Subscriber) error {
+	pubErr := pub.Close()
+	subErr := sub.Close()
+
+	if pubErr != nil {
+		return errors.Wrap(pubErr, "cannot close publisher")
+	}
+	return errors.Wrap(subErr, "cannot close subscriber")
+}
+
+func startCPUProfile(name string) (stop func(), err error) {
+	if *cpuProfileDir == "" {
+		return func() {}, nil
+	}
+
+	f, err := createProfile(*cpuProfileDir, name+".cpu.pprof")
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "cannot start CPU profile")
+	}
+
+	return func() {
+		pprof.StopCPUProfile()
+		f.Close()
+	}, nil
+}
+
+func writeHeapProfile(name string) error {
+	if *memProfileDir == "" {
+		return nil
+	}
+
+	f, err := createProfile(*memProfileDir, name+".heap.pprof")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return errors.Wrap(pprof.WriteHeapProfile(f), "cannot write heap profile")
+}
+
+func createProfile(dir string, name string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "cannot create profiles directory")
+	}
+
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create profile")
+	}
+
+	return f, nil
+}
+
+func split(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func pubSubNames() []string {
+	names := make([]string, 0, len(pubSubs))
+	for name := range pubSubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/nats-io/go-nats-streaming"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/googlecloud"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/kafka"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/nats"
+)
+
+// pubSubConstructor creates the Pub/Sub used by a single run of the scenario.
+// runID is unique for every run, so runs don't consume messages of each other.
+type pubSubConstructor func(runID string) (message.Publisher, message.Subscriber, error)
+
+// pubSubs are the benchmarked Pub/Subs, started with `docker-compose up` from the root of the repository.
+var pubSubs = map[string]pubSubConstructor{
+	"gochannel":   newGoChannel,
+	"kafka":       newKafka,
+	"googlecloud": newGoogleCloud,
+	"nats":        newNats,
+}
+
+func env(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func newGoChannel(string) (message.Publisher, message.Subscriber, error) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{Persistent: true}, watermill.NopLogger{})
+	return pubSub, pubSub, nil
+}
+
+func newKafka(runID string) (message.Publisher, message.Subscriber, error) {
+	brokers := strings.Split(env("WATERMILL_BENCH_KAFKA_BROKERS", "localhost:9092"), ",")
+
+	pub, err := kafka.NewPublisher(brokers, kafka.DefaultMarshaler{}, nil, watermill.NopLogger{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	saramaConfig := kafka.DefaultSaramaSubscriberConfig()
+	saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	sub, err := kafka.NewSubscriber(
+		kafka.SubscriberConfig{
+			Brokers:       brokers,
+			ConsumerGroup: "bench_" + runID,
+		},
+		saramaConfig,
+		kafka.DefaultMarshaler{},
+		watermill.NopLogger{},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pub, sub, nil
+}
+
+func newGoogleCloud(runID string) (message.Publisher, message.Subscriber, error) {
+	emulatorHost := env("WATERMILL_BENCH_PUBSUB_EMULATOR_HOST", googlecloud.DefaultEmulatorHost)
+
+	pub, err := googlecloud.NewPublisher(context.Background(), googlecloud.PublisherConfig{
+		ProjectID:    "bench",
+		EmulatorHost: emulatorHost,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sub, err := googlecloud.NewSubscriber(
+		context.Background(),
+		googlecloud.SubscriberConfig{
+			ProjectID:                "bench",
+			EmulatorHost:             emulatorHost,
+			GenerateSubscriptionName: googlecloud.TopicSubscriptionNameWithSuffix("_" + runID),
+		},
+		watermill.NopLogger{},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pub, sub, nil
+}
+
+func newNats(runID string) (message.Publisher, message.Subscriber, error) {
+	stanOptions := []stan.Option{
+		stan.NatsURL(env("WATERMILL_BENCH_NATS_URL", "nats://localhost:4222")),
+	}
+
+	pub, err := nats.NewStreamingPublisher(nats.StreamingPublisherConfig{
+		ClusterID:   "test-cluster",
+		ClientID:    "bench_pub_" + runID,
+		Marshaler:   nats.GobMarshaler{},
+		StanOptions: stanOptions,
+	}, watermill.NopLogger{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sub, err := nats.NewStreamingSubscriber(nats.StreamingSubscriberConfig{
+		ClusterID:        "test-cluster",
+		ClientID:         "bench_sub_" + runID,
+		QueueGroup:       "bench",
+		DurableName:      "bench_" + runID,
+		SubscribersCount: 1,
+		AckWaitTimeout:   time.Second * 30,
+		Unmarshaler:      nats.GobMarshaler{},
+		StanOptions:      stanOptions,
+		// messages published before subscribing are consumed in the consume scenario
+		StanSubscriptionOptions: []stan.SubscriptionOption{stan.DeliverAllAvailable()},
+	}, watermill.NopLogger{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pub, sub, nil
+}
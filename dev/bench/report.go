@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Result is a single row of the report. Results are stored in JSON, so runs of different releases can be compared.
+type Result struct {
+	PubSub      string `json:"pubsub"`
+	Scenario    string `json:"scenario"`
+	Messages    int    `json:"messages"`
+	PayloadSize int    `json:"payload_size"`
+
+	Duration      time.Duration `json:"duration"`
+	MessagesPerS  float64       `json:"messages_per_second"`
+	MegabytesPerS float64       `json:"megabytes_per_second"`
+
+	// Latencies are empty, when they are not measured by the scenario.
+	LatencyP50 time.Duration `json:"latency_p50,omitempty"`
+	LatencyP95 time.Duration `json:"latency_p95,omitempty"`
+	LatencyP99 time.Duration `json:"latency_p99,omitempty"`
+
+	// Allocations are measured for the whole process, so they include allocations of the client libraries.
+	AllocsPerMessage float64 `json:"allocs_per_message"`
+	BytesPerMessage  float64 `json:"bytes_per_message"`
+}
+
+func newResult(
+	pubSub string,
+	scenarioName string,
+	config scenarioConfig,
+	scenarioResult scenarioResult,
+	allocs uint64,
+	allocatedBytes uint64,
+) Result {
+	seconds := scenarioResult.Duration.Seconds()
+	messages := float64(config.Messages)
+
+	result := Result{
+		PubSub:      pubSub,
+		Scenario:    scenarioName,
+		Messages:    config.Messages,
+		PayloadSize: config.PayloadSize,
+
+		Duration:      scenarioResult.Duration,
+		MessagesPerS:  messages / seconds,
+		MegabytesPerS: messages * float64(config.PayloadSize) / seconds / 1024 / 1024,
+
+		AllocsPerMessage: float64(allocs) / messages,
+		BytesPerMessage:  float64(allocatedBytes) / messages,
+	}
+
+	if len(scenarioResult.Latencies) > 0 {
+		latencies := scenarioResult.Latencies
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		result.LatencyP50 = percentile(latencies, 50)
+		result.LatencyP95 = percentile(latencies, 95)
+		result.LatencyP99 = percentile(latencies, 99)
+	}
+
+	return result
+}
+
+// percentile returns the percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func (r Result) key() string {
+	return r.PubSub + "/" + r.Scenario
+}
+
+func writeText(w io.Writer, results []Result, baseline map[string]Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintln(tw, "pubsub\tscenario\tmessages\tduration\tmsg/s\tMB/s\tp50\tp95\tp99\tallocs/msg\tB/msg\t")
+	for _, r := range results {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%d\t%s\t%s\t%.2f\t%s\t%s\t%s\t%.1f\t%.0f\t\n",
+			r.PubSub, r.Scenario, r.Messages, r.Duration.Round(time.Millisecond),
+			withChange(fmt.Sprintf("%.0f", r.MessagesPerS), r.MessagesPerS, baseline, r.key()),
+			r.MegabytesPerS,
+			formatLatency(r.LatencyP50), formatLatency(r.LatencyP95), formatLatency(r.LatencyP99),
+			r.AllocsPerMessage, r.BytesPerMessage,
+		)
+	}
+
+	return tw.Flush()
+}
+
+// withChange adds the change of the throughput against the baseline, when the baseline has the result.
+func withChange(value string, messagesPerS float64, baseline map[string]Result, key string) string {
+	base, ok := baseline[key]
+	if !ok || base.MessagesPerS == 0 {
+		return value
+	}
+
+	return fmt.Sprintf("%s (%+.1f%%)", value, (messagesPerS/base.MessagesPerS-1)*100)
+}
+
+func formatLatency(latency time.Duration) string {
+	if latency == 0 {
+		return "-"
+	}
+	return latency.Round(time.Microsecond).String()
+}
+
+func writeJSON(w io.Writer, results []Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
+
+// readBaseline reads results written with the JSON format.
+func readBaseline(path string) (map[string]Result, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open baseline")
+	}
+	defer f.Close()
+
+	var results []Result
+	if err := json.NewDecoder(f).Decode(&results); err != nil {
+		return nil, errors.Wrap(err, "cannot decode baseline")
+	}
+
+	baseline := make(map[string]Result, len(results))
+	for _, r := range results {
+		baseline[r.key()] = r
+	}
+
+	return baseline, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// publishedAtKey is the metadata key with the time of publishing, used to measure the end to end latency.
+const publishedAtKey = "bench_published_at"
+
+type scenarioConfig struct {
+	// Messages is the number of messages published and consumed by the scenario.
+	Messages int
+	// PayloadSize is the size of the payload of every message, in bytes.
+	PayloadSize int
+	// Publishers is the number of goroutines publishing messages concurrently.
+	Publishers int
+	// Timeout limits the time of the scenario.
+	Timeout time.Duration
+}
+
+type scenarioResult struct {
+	// Duration is the measured time of the scenario.
+	Duration time.Duration
+	// Latencies are the latencies of single messages, when they are measured by the scenario.
+	Latencies []time.Duration
+}
+
+// scenario runs the benchmark with the publisher and the subscriber. Only the measured part
+// of the scenario should be included in Duration.
+type scenario func(
+	ctx context.Context,
+	pub message.Publisher,
+	sub message.Subscriber,
+	topic string,
+	config scenarioConfig,
+) (scenarioResult, error)
+
+// scenarios are run in this order, when no scenario is chosen.
+var scenarios = []struct {
+	Name string
+	Run  scenario
+}{
+	{"publish", runPublish},
+	{"consume", runConsume},
+	{"end_to_end", runEndToEnd},
+}
+
+// runPublish measures publishing of messages, with the latency of every Publish call.
+func runPublish(
+	ctx context.Context,
+	pub message.Publisher,
+	_ message.Subscriber,
+	topic string,
+	config scenarioConfig,
+) (scenarioResult, error) {
+	start := time.Now()
+	latencies, err := publishMessages(pub, topic, config, false)
+	if err != nil {
+		return scenarioResult{}, err
+	}
+
+	return scenarioResult{
+		Duration:  time.Since(start),
+		Latencies: latencies,
+	}, nil
+}
+
+// runConsume measures consuming of messages, which were published before subscribing.
+func runConsume(
+	ctx context.Context,
+	pub message.Publisher,
+	sub message.Subscriber,
+	topic string,
+	config scenarioConfig,
+) (scenarioResult, error) {
+	if err := initializeSubscription(sub, topic); err != nil {
+		return scenarioResult{}, err
+	}
+	if _, err := publishMessages(pub, topic, config, false); err != nil {
+		return scenarioResult{}, err
+	}
+
+	start := time.Now()
+
+	messages, err := sub.Subscribe(ctx, topic)
+	if err != nil {
+		return scenarioResult{}, errors.Wrap(err, "cannot subscribe")
+	}
+	if err := consumeMessages(ctx, messages, config.Messages, nil); err != nil {
+		return scenarioResult{}, err
+	}
+
+	return scenarioResult{Duration: time.Since(start)}, nil
+}
+
+// runEndToEnd measures publishing and consuming at the same time,
+// with the latency between publishing and receiving of every message.
+func runEndToEnd(
+	ctx context.Context,
+	pub message.Publisher,
+	sub message.Subscriber,
+	topic string,
+	config scenarioConfig,
+) (scenarioResult, error) {
+	if err := initializeSubscription(sub, topic); err != nil {
+		return scenarioResult{}, err
+	}
+
+	messages, err := sub.Subscribe(ctx, topic)
+	if err != nil {
+		return scenarioResult{}, errors.Wrap(err, "cannot subscribe")
+	}
+
+	start := time.Now()
+
+	publishErr := make(chan error, 1)
+	go func() {
+		_, err := publishMessages(pub, topic, config, true)
+		publishErr <- err
+	}()
+
+	latencies := make([]time.Duration, 0, config.Messages)
+	err = consumeMessages(ctx, messages, config.Messages, func(msg *message.Message) {
+		publishedAt, err := strconv.ParseInt(msg.Metadata.Get(publishedAtKey), 10, 64)
+		if err == nil {
+			latencies = append(latencies, time.Since(time.Unix(0, publishedAt)))
+		}
+	})
+	if err != nil {
+		return scenarioResult{}, err
+	}
+	if err := <-publishErr; err != nil {
+		return scenarioResult{}, err
+	}
+
+	return scenarioResult{
+		Duration:  time.Since(start),
+		Latencies: latencies,
+	}, nil
+}
+
+// initializeSubscription creates the subscription, so messages published before subscribing are not lost.
+func initializeSubscription(sub message.Subscriber, topic string) error {
+	initializer, ok := sub.(message.SubscribeInitializer)
+	if !ok {
+		return nil
+	}
+
+	return errors.Wrap(initializer.SubscribeInitialize(topic), "cannot initialize subscription")
+}
+
+// publishMessages publishes config.Messages messages with config.Publishers goroutines
+// and returns latencies of all Publish calls.
+func publishMessages(
+	pub message.Publisher,
+	topic string,
+	config scenarioConfig,
+	withPublishTime bool,
+) ([]time.Duration, error) {
+	payload := make([]byte, config.PayloadSize)
+
+	latencies := make([]time.Duration, config.Messages)
+	errs := make(chan error, config.Publishers)
+	wg := sync.WaitGroup{}
+
+	for publisher := 0; publisher < config.Publishers; publisher++ {
+		wg.Add(1)
+		go func(publisher int) {
+			defer wg.Done()
+
+			// every publisher publishes every config.Publishers-th message
+			for i := publisher; i < config.Messages; i += config.Publishers {
+				msg := message.NewMessage(watermill.NewUUID(), payload)
+
+				start := time.Now()
+				if withPublishTime {
+					msg.Metadata.Set(publishedAtKey, strconv.FormatInt(start.UnixNano(), 10))
+				}
+
+				if err := pub.Publish(topic, msg); err != nil {
+					errs <- errors.Wrap(err, "cannot publish message")
+					return
+				}
+				latencies[i] = time.Since(start)
+			}
+		}(publisher)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+
+	return latencies, nil
+}
+
+// consumeMessages acks count messages, calling onMessage with every message.
+func consumeMessages(
+	ctx context.Context,
+	messages <-chan *message.Message,
+	count int,
+	onMessage func(msg *message.Message),
+) error {
+	for received := 0; received < count; received++ {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return errors.Errorf("subscription closed after %d of %d messages", received, count)
+			}
+			if onMessage != nil {
+				onMessage(msg)
+			}
+			msg.Ack()
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "received %d of %d messages", received, count)
+		}
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/backoff"
 	"github.com/ThreeDotsLabs/watermill/message"
 
 	"github.com/pkg/errors"
@@ -18,7 +19,11 @@ type RetryPublisherConfig struct {
 	MaxRetries int
 	// each subsequent retry doubles the time to next retry.
 	TimeToFirstRetry time.Duration
-	Logger           watermill.LoggerAdapter
+
+	// Backoff is optional. When set, MaxRetries and TimeToFirstRetry are ignored.
+	Backoff backoff.Strategy
+
+	Logger watermill.LoggerAdapter
 }
 
 func (c *RetryPublisherConfig) setDefaults() {
@@ -30,6 +35,11 @@ func (c *RetryPublisherConfig) setDefaults() {
 		c.TimeToFirstRetry = time.Second
 	}
 
+	if c.Backoff == nil {
+		// the first publish is not a retry
+		c.Backoff = backoff.MaxAttempts(backoff.Exponential{Initial: c.TimeToFirstRetry}, c.MaxRetries-1)
+	}
+
 	if c.Logger == nil {
 		c.Logger = watermill.NopLogger{}
 	}
@@ -88,20 +98,20 @@ func (p RetryPublisher) Close() error {
 
 // send sends one message at a time to prevent sending a successful message more than once.
 func (p RetryPublisher) send(topic string, msg *message.Message) error {
-	var err error
-	timeToNextRetry := p.config.TimeToFirstRetry
-
-	for i := 0; i < p.config.MaxRetries; i++ {
-		err = p.pub.Publish(topic, msg)
+	for attempt := 1; ; attempt++ {
+		err := p.pub.Publish(topic, msg)
 		if err == nil {
 			return nil
 		}
 
+		timeToNextRetry, ok := p.config.Backoff.Next(attempt)
+		if !ok {
+			return err
+		}
+
 		p.config.Logger.Info("Publish failed, retrying in "+timeToNextRetry.String(), watermill.LogFields{
 			"error": err,
 		})
 		time.Sleep(timeToNextRetry)
-		timeToNextRetry *= 2
 	}
-	return err
 }
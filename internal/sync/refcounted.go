@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"sync"
+)
+
+// RefCounted is a resource shared by many users, like a connection to the broker.
+// It's opened by the first Acquire and closed by the Release of the last user.
+type RefCounted struct {
+	open  func() (interface{}, error)
+	close func(resource interface{}) error
+
+	lock     sync.Mutex
+	resource interface{}
+	refs     int
+}
+
+func NewRefCounted(open func() (interface{}, error), close func(resource interface{}) error) *RefCounted {
+	return &RefCounted{
+		open:  open,
+		close: close,
+	}
+}
+
+// Acquire returns the resource, opening it when there are no other users.
+// Every successful Acquire must be followed by Release.
+func (r *RefCounted) Acquire() (interface{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.refs == 0 {
+		resource, err := r.open()
+		if err != nil {
+			return nil, err
+		}
+		r.resource = resource
+	}
+	r.refs++
+
+	return r.resource, nil
+}
+
+// Release closes the resource, when it was released by all users.
+func (r *RefCounted) Release() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.refs == 0 {
+		return nil
+	}
+
+	r.refs--
+	if r.refs > 0 {
+		return nil
+	}
+
+	resource := r.resource
+	r.resource = nil
+
+	return r.close(resource)
+}
+
+// Refs returns the number of the current users of the resource.
+func (r *RefCounted) Refs() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.refs
+}
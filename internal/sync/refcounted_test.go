@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefCounted(t *testing.T) {
+	opened := 0
+	closed := 0
+
+	r := NewRefCounted(
+		func() (interface{}, error) {
+			opened++
+			return opened, nil
+		},
+		func(resource interface{}) error {
+			closed++
+			return nil
+		},
+	)
+
+	first, err := r.Acquire()
+	require.NoError(t, err)
+	second, err := r.Acquire()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, first)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, opened)
+	assert.Equal(t, 2, r.Refs())
+
+	require.NoError(t, r.Release())
+	assert.Equal(t, 0, closed)
+
+	require.NoError(t, r.Release())
+	assert.Equal(t, 1, closed)
+	assert.Equal(t, 0, r.Refs())
+
+	// released too many times
+	require.NoError(t, r.Release())
+	assert.Equal(t, 1, closed)
+
+	// opened again after it was closed
+	third, err := r.Acquire()
+	require.NoError(t, err)
+	assert.Equal(t, 2, third)
+}
+
+func TestRefCounted_open_error(t *testing.T) {
+	r := NewRefCounted(
+		func() (interface{}, error) {
+			return nil, errors.New("cannot open")
+		},
+		func(resource interface{}) error {
+			return nil
+		},
+	)
+
+	_, err := r.Acquire()
+	assert.EqualError(t, err, "cannot open")
+	assert.Equal(t, 0, r.Refs())
+}
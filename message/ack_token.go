@@ -0,0 +1,110 @@
+package message
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// ErrUnknownAckToken is returned, when the message of the ack token is not pending,
+// for example because it was already acked or nacked, or the token was issued by another process.
+var ErrUnknownAckToken = errors.New("unknown ack token")
+
+// AckToken is an opaque reference to the pending message. It allows acking or nacking the message later
+// with AckByToken or NackByToken, for example when the processing is completed by another goroutine
+// which knows only the token.
+//
+// The token is not the message itself: pending messages are kept in memory of the process which received them,
+// and AckByToken and NackByToken look them up there. A token can be passed to another process
+// (for example in a reply message), but it must be redeemed back in the process which issued it.
+// Tokens don't extend the ack deadline of the Pub/Sub and they are not durable, so they are lost on restart.
+//
+// Tokens are valid until the message is acked or nacked, or its context is done
+// (for example because the subscriber was closed).
+type AckToken string
+
+// pendingAckTokens is shared by all subscribers of the process, so the token is enough to find the message.
+var pendingAckTokens = struct {
+	messages map[AckToken]*Message
+	lock     sync.Mutex
+}{messages: map[AckToken]*Message{}}
+
+// AckToken returns the ack token of the message. Every call returns the same token.
+//
+// It should be used with Handler.SetAckMode(AckManual), so the message is not acked when the handler returns.
+func (m *Message) AckToken() AckToken {
+	m.ackMutex.Lock()
+	defer m.ackMutex.Unlock()
+
+	if m.ackToken != "" {
+		return m.ackToken
+	}
+
+	m.ackToken = AckToken(watermill.NewULID())
+	if m.ackSentType != noAckSent {
+		// already acked or nacked, there is nothing to redeem
+		return m.ackToken
+	}
+
+	pendingAckTokens.lock.Lock()
+	pendingAckTokens.messages[m.ackToken] = m
+	pendingAckTokens.lock.Unlock()
+
+	// subscribers cancel the context of messages which are dropped, so they are not kept forever
+	go func(token AckToken, ctx context.Context) {
+		select {
+		case <-m.Acked():
+		case <-m.Nacked():
+		case <-ctx.Done():
+		}
+
+		pendingAckTokens.lock.Lock()
+		delete(pendingAckTokens.messages, token)
+		pendingAckTokens.lock.Unlock()
+	}(m.ackToken, m.Context())
+
+	return m.ackToken
+}
+
+// AckByToken acks the message of the token (see Message.AckToken).
+func AckByToken(token AckToken) error {
+	msg, err := pendingMessage(token)
+	if err != nil {
+		return err
+	}
+
+	if !msg.Ack() {
+		return errors.New("message was already nacked")
+	}
+
+	return nil
+}
+
+// NackByToken nacks the message of the token (see Message.AckToken).
+func NackByToken(token AckToken) error {
+	msg, err := pendingMessage(token)
+	if err != nil {
+		return err
+	}
+
+	if !msg.Nack() {
+		return errors.New("message was already acked")
+	}
+
+	return nil
+}
+
+func pendingMessage(token AckToken) (*Message, error) {
+	pendingAckTokens.lock.Lock()
+	defer pendingAckTokens.lock.Unlock()
+
+	msg, ok := pendingAckTokens.messages[token]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownAckToken, string(token))
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,87 @@
+package message_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func TestAckByToken(t *testing.T) {
+	msg := message.NewMessage("1", nil)
+
+	token := msg.AckToken()
+	assert.NotEmpty(t, token)
+	assert.Equal(t, token, msg.AckToken(), "token should be stable")
+
+	require.NoError(t, message.AckByToken(token))
+
+	select {
+	case <-msg.Acked():
+	default:
+		t.Fatal("message should be acked")
+	}
+}
+
+func TestNackByToken(t *testing.T) {
+	msg := message.NewMessage("1", nil)
+
+	token := msg.AckToken()
+	require.NoError(t, message.NackByToken(token))
+
+	select {
+	case <-msg.Nacked():
+	default:
+		t.Fatal("message should be nacked")
+	}
+}
+
+func TestAckByToken_already_acked(t *testing.T) {
+	msg := message.NewMessage("1", nil)
+	token := msg.AckToken()
+	msg.Ack()
+
+	// the token is released in the background
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = message.AckByToken(token); err != nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, message.ErrUnknownAckToken, errors.Cause(err))
+}
+
+func TestAckByToken_discarded_message(t *testing.T) {
+	msg := message.NewMessage("1", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	msg.SetContext(ctx)
+
+	token := msg.AckToken()
+
+	// the subscriber cancels the context of the message, which is dropped without the ack
+	cancel()
+
+	// the token is released in the background
+	time.Sleep(time.Millisecond * 100)
+
+	err := message.AckByToken(token)
+	assert.Equal(t, message.ErrUnknownAckToken, errors.Cause(err))
+
+	select {
+	case <-msg.Acked():
+		t.Fatal("discarded message should not be acked")
+	default:
+	}
+}
+
+func TestAckByToken_unknown_token(t *testing.T) {
+	err := message.AckByToken("unknown")
+	assert.Equal(t, message.ErrUnknownAckToken, errors.Cause(err))
+}
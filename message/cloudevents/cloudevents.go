@@ -0,0 +1,281 @@
+// Package cloudevents marshals Watermill messages to CloudEvents 1.0 in the structured content mode (JSON format).
+//
+// The codec is not bound to any Pub/Sub, it is used by the marshalers of googlecloud, nats and http.
+package cloudevents
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// SpecVersion is the version of the CloudEvents specification implemented by the Codec.
+const SpecVersion = "1.0"
+
+// ContentType is the content type of the CloudEvents JSON format, in the structured mode.
+const ContentType = "application/cloudevents+json"
+
+// MetadataPrefix is the prefix of metadata keys, which are mapped to CloudEvents context attributes.
+// For example, the "ce_subject" metadata is mapped to the "subject" attribute.
+const MetadataPrefix = "ce_"
+
+// Metadata keys of the CloudEvents context attributes.
+const (
+	SourceMetadataKey          = MetadataPrefix + "source"
+	TypeMetadataKey            = MetadataPrefix + "type"
+	TimeMetadataKey            = MetadataPrefix + "time"
+	SubjectMetadataKey         = MetadataPrefix + "subject"
+	DataContentTypeMetadataKey = MetadataPrefix + "datacontenttype"
+	DataSchemaMetadataKey      = MetadataPrefix + "dataschema"
+)
+
+const (
+	specVersionAttribute = "specversion"
+	idAttribute          = "id"
+	dataAttribute        = "data"
+	dataBase64Attribute  = "data_base64"
+)
+
+// contextAttributes are mapped to the metadata with MetadataPrefix.
+var contextAttributes = map[string]struct{}{
+	"source":          {},
+	"type":            {},
+	"time":            {},
+	"subject":         {},
+	"datacontenttype": {},
+	"dataschema":      {},
+}
+
+// ErrUnsupportedSpecVersion happens when the unmarshaled event was written with an unknown specification version.
+var ErrUnsupportedSpecVersion = errors.New("unsupported CloudEvents spec version")
+
+// AttributeFunc derives a context attribute of the event from the topic and the message.
+type AttributeFunc func(topic string, msg *message.Message) string
+
+// Topic is an AttributeFunc returning the topic name.
+func Topic(topic string, msg *message.Message) string {
+	return topic
+}
+
+// Static returns an AttributeFunc which always returns the value.
+func Static(value string) AttributeFunc {
+	return func(topic string, msg *message.Message) string {
+		return value
+	}
+}
+
+// HandlerName returns an AttributeFunc which returns the name of the handler, which is stored in the message's context.
+// When the message has no handler name in the context, fallback is called.
+func HandlerName(fallback AttributeFunc) AttributeFunc {
+	return func(topic string, msg *message.Message) string {
+		if handlerName := message.HandlerNameFromCtx(msg.Context()); handlerName != "" {
+			return handlerName
+		}
+		return fallback(topic, msg)
+	}
+}
+
+// Codec marshals messages to CloudEvents JSON and vice versa.
+//
+// Message's UUID is mapped to the id attribute and the payload to data (or data_base64, when the payload is not JSON).
+// Metadata with MetadataPrefix is mapped to the context attributes; the rest of metadata is mapped to extension attributes.
+type Codec struct {
+	// Source derives the source attribute, when the message has no SourceMetadataKey metadata.
+	// Defaults to the topic name.
+	Source AttributeFunc
+
+	// Type derives the type attribute, when the message has no TypeMetadataKey metadata.
+	// Defaults to the topic name.
+	Type AttributeFunc
+
+	// Now is used to generate the time attribute, when the message has no TimeMetadataKey metadata.
+	// Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Marshal marshals the message to the CloudEvent, published to the topic.
+func (c Codec) Marshal(topic string, msg *message.Message) ([]byte, error) {
+	event := make(map[string]interface{}, len(msg.Metadata)+5)
+
+	for key, value := range msg.Metadata {
+		if strings.HasPrefix(key, MetadataPrefix) {
+			event[strings.TrimPrefix(key, MetadataPrefix)] = value
+			continue
+		}
+
+		if isReservedAttribute(key) {
+			return nil, errors.Errorf("metadata %s conflicts with the CloudEvents attribute", key)
+		}
+		event[key] = value
+	}
+
+	event[specVersionAttribute] = SpecVersion
+	event[idAttribute] = msg.UUID
+
+	if _, ok := event["source"]; !ok {
+		event["source"] = c.attribute(c.Source, topic, msg)
+	}
+	if _, ok := event["type"]; !ok {
+		event["type"] = c.attribute(c.Type, topic, msg)
+	}
+	if _, ok := event["time"]; !ok {
+		event["time"] = c.now().UTC().Format(time.RFC3339Nano)
+	}
+
+	if len(msg.Payload) > 0 {
+		if isJSON(event["datacontenttype"]) && json.Valid(msg.Payload) {
+			event[dataAttribute] = json.RawMessage(msg.Payload)
+		} else {
+			event[dataBase64Attribute] = base64.StdEncoding.EncodeToString(msg.Payload)
+		}
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal CloudEvent of message %s", msg.UUID)
+	}
+
+	return b, nil
+}
+
+// Unmarshal unmarshals the CloudEvent to the message.
+func (c Codec) Unmarshal(data []byte) (*message.Message, error) {
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal CloudEvent")
+	}
+
+	var specVersion, id string
+	if err := unmarshalAttribute(event, specVersionAttribute, &specVersion); err != nil {
+		return nil, err
+	}
+	if specVersion != SpecVersion {
+		return nil, errors.Wrap(ErrUnsupportedSpecVersion, specVersion)
+	}
+	if err := unmarshalAttribute(event, idAttribute, &id); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, errors.New("missing CloudEvent id")
+	}
+
+	var payload message.Payload
+	if data, ok := event[dataBase64Attribute]; ok {
+		var encoded string
+		if err := json.Unmarshal(data, &encoded); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s attribute", dataBase64Attribute)
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode %s attribute", dataBase64Attribute)
+		}
+		payload = decoded
+	} else if data, ok := event[dataAttribute]; ok {
+		payload = message.Payload(data)
+	}
+
+	msg := message.NewMessage(id, payload)
+
+	for key := range event {
+		if key == specVersionAttribute || key == idAttribute || key == dataAttribute || key == dataBase64Attribute {
+			continue
+		}
+
+		if _, ok := contextAttributes[key]; ok {
+			var value string
+			if err := unmarshalAttribute(event, key, &value); err != nil {
+				return nil, err
+			}
+			msg.Metadata.Set(MetadataPrefix+key, value)
+			continue
+		}
+
+		value, ok, err := unmarshalExtension(event, key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			msg.Metadata.Set(key, value)
+		}
+	}
+
+	return msg, nil
+}
+
+func (c Codec) attribute(f AttributeFunc, topic string, msg *message.Message) string {
+	if f == nil {
+		return Topic(topic, msg)
+	}
+	return f(topic, msg)
+}
+
+func (c Codec) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+func unmarshalAttribute(event map[string]json.RawMessage, key string, value *string) error {
+	raw, ok := event[key]
+	if !ok {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, value); err != nil {
+		return errors.Wrapf(err, "invalid CloudEvent attribute %s", key)
+	}
+
+	return nil
+}
+
+// unmarshalExtension returns the value of the extension attribute formatted as a string.
+// Extensions may be JSON strings, numbers or booleans. Null extensions are treated as not set.
+func unmarshalExtension(event map[string]json.RawMessage, key string) (string, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(event[key]))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", false, errors.Wrapf(err, "invalid CloudEvent attribute %s", key)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, true, nil
+	case json.Number:
+		return v.String(), true, nil
+	case bool:
+		return strconv.FormatBool(v), true, nil
+	default:
+		return "", false, errors.Errorf("invalid CloudEvent attribute %s: should be a string, number or boolean", key)
+	}
+}
+
+func isReservedAttribute(key string) bool {
+	if _, ok := contextAttributes[key]; ok {
+		return true
+	}
+
+	return key == specVersionAttribute || key == idAttribute || key == dataAttribute || key == dataBase64Attribute
+}
+
+func isJSON(contentType interface{}) bool {
+	if contentType == nil {
+		// data is JSON, when datacontenttype is omitted in the JSON format
+		return true
+	}
+
+	s, _ := contentType.(string)
+	return strings.HasPrefix(s, "application/json") || strings.HasSuffix(strings.SplitN(s, ";", 2)[0], "+json")
+}
@@ -0,0 +1,145 @@
+package cloudevents_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/cloudevents"
+)
+
+var now = time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestCodec_Marshal(t *testing.T) {
+	codec := cloudevents.Codec{
+		Source: cloudevents.Static("/orders-service"),
+		Now:    func() time.Time { return now },
+	}
+
+	msg := message.NewMessage("1", []byte(`{"order_id":"1"}`))
+	msg.Metadata.Set(cloudevents.SubjectMetadataKey, "order-1")
+	msg.Metadata.Set("traceparent", "00-trace")
+
+	b, err := codec.Marshal("orders", msg)
+	require.NoError(t, err)
+
+	event := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(b, &event))
+
+	assert.Equal(t, map[string]interface{}{
+		"specversion": "1.0",
+		"id":          "1",
+		"source":      "/orders-service",
+		"type":        "orders",
+		"time":        "2019-01-01T12:00:00Z",
+		"subject":     "order-1",
+		"traceparent": "00-trace",
+		"data":        map[string]interface{}{"order_id": "1"},
+	}, event)
+}
+
+func TestCodec_MarshalUnmarshal(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		Payload         message.Payload
+		DataContentType string
+	}{
+		{
+			Name:    "json",
+			Payload: message.Payload(`{"order_id":"1"}`),
+		},
+		{
+			Name:            "binary",
+			Payload:         message.Payload{0x00, 0xff, 0x10},
+			DataContentType: "application/octet-stream",
+		},
+		{
+			Name:            "text",
+			Payload:         message.Payload("not json"),
+			DataContentType: "text/plain",
+		},
+		{
+			Name: "empty",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			codec := cloudevents.Codec{Now: func() time.Time { return now }}
+
+			msg := message.NewMessage(watermill.NewUUID(), tc.Payload)
+			msg.Metadata.Set("foo", "bar")
+			if tc.DataContentType != "" {
+				msg.Metadata.Set(cloudevents.DataContentTypeMetadataKey, tc.DataContentType)
+			}
+
+			b, err := codec.Marshal("orders", msg)
+			require.NoError(t, err)
+
+			unmarshaledMsg, err := codec.Unmarshal(b)
+			require.NoError(t, err)
+
+			assert.Equal(t, msg.UUID, unmarshaledMsg.UUID)
+			assert.EqualValues(t, tc.Payload, unmarshaledMsg.Payload)
+			assert.Equal(t, "bar", unmarshaledMsg.Metadata.Get("foo"))
+			assert.Equal(t, "orders", unmarshaledMsg.Metadata.Get(cloudevents.SourceMetadataKey))
+			assert.Equal(t, "orders", unmarshaledMsg.Metadata.Get(cloudevents.TypeMetadataKey))
+			assert.Equal(t, "2019-01-01T12:00:00Z", unmarshaledMsg.Metadata.Get(cloudevents.TimeMetadataKey))
+			assert.Equal(t, tc.DataContentType, unmarshaledMsg.Metadata.Get(cloudevents.DataContentTypeMetadataKey))
+
+			// re-marshaling keeps the context attributes
+			b2, err := codec.Marshal("other_topic", unmarshaledMsg)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(b), string(b2))
+		})
+	}
+}
+
+func TestCodec_Marshal_reserved_metadata(t *testing.T) {
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	msg.Metadata.Set("id", "2")
+
+	_, err := cloudevents.Codec{}.Marshal("orders", msg)
+	assert.Error(t, err)
+}
+
+func TestCodec_Unmarshal_extensions(t *testing.T) {
+	msg, err := cloudevents.Codec{}.Unmarshal([]byte(`{
+		"specversion": "1.0",
+		"id": "1",
+		"source": "orders",
+		"type": "order.created",
+		"traceparent": "00-trace",
+		"sequence": 5,
+		"ratio": 0.5,
+		"replayed": true,
+		"partitionkey": null
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "00-trace", msg.Metadata.Get("traceparent"))
+	assert.Equal(t, "5", msg.Metadata.Get("sequence"))
+	assert.Equal(t, "0.5", msg.Metadata.Get("ratio"))
+	assert.Equal(t, "true", msg.Metadata.Get("replayed"))
+	assert.NotContains(t, msg.Metadata, "partitionkey")
+
+	_, err = cloudevents.Codec{}.Unmarshal([]byte(`{"specversion":"1.0","id":"1","nested":{"a":1}}`))
+	assert.Error(t, err, "extensions can't be objects")
+}
+
+func TestCodec_Unmarshal_unsupported_spec_version(t *testing.T) {
+	_, err := cloudevents.Codec{}.Unmarshal([]byte(`{"specversion":"0.3","id":"1"}`))
+	assert.Error(t, err)
+}
+
+func TestHandlerName(t *testing.T) {
+	attribute := cloudevents.HandlerName(cloudevents.Topic)
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	assert.Equal(t, "topic", attribute("topic", msg))
+}
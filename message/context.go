@@ -10,6 +10,7 @@ const (
 	handlerNameKey    ctxKey = "handler_name"
 	publisherNameKey  ctxKey = "publisher_name"
 	subscriberNameKey ctxKey = "subscriber_name"
+	subscribeTopicKey ctxKey = "subscribe_topic"
 )
 
 func valFromCtx(ctx context.Context, key ctxKey) string {
@@ -31,3 +32,8 @@ func PublisherNameFromCtx(ctx context.Context) string {
 func SubscriberNameFromCtx(ctx context.Context) string {
 	return valFromCtx(ctx, subscriberNameKey)
 }
+
+// SubscribeTopicFromCtx returns the topic from which the handler receives messages.
+func SubscribeTopicFromCtx(ctx context.Context) string {
+	return valFromCtx(ctx, subscribeTopicKey)
+}
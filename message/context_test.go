@@ -42,7 +42,7 @@ func TestRouter_Context_Stringer(t *testing.T) {
 	handlerName := "handler_name_stringer_test"
 	router.AddHandler(
 		handlerName,
-		"",
+		"subscribe_topic",
 		sub,
 		"",
 		pub,
@@ -71,6 +71,7 @@ func TestRouter_Context_Stringer(t *testing.T) {
 	require.Equal(t, handlerName, message.HandlerNameFromCtx(ctx))
 	require.Equal(t, sub.String(), message.SubscriberNameFromCtx(ctx))
 	require.Equal(t, pub.String(), message.PublisherNameFromCtx(ctx))
+	require.Equal(t, "subscribe_topic", message.SubscribeTopicFromCtx(ctx))
 }
 
 type unnamedMockPublisher struct{}
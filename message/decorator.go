@@ -3,6 +3,8 @@ package message
 import (
 	"context"
 	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
 )
 
 // MessageTransformSubscriberDecorator creates a subscriber decorator that calls transform
@@ -79,3 +81,16 @@ func (d messageTransformPublisherDecorator) Publish(topic string, messages ...*M
 	}
 	return d.Publisher.Publish(topic, messages...)
 }
+
+// GenerateMissingUUIDs creates a publisher decorator that sets the UUID generated with the generator
+// to each published message without the UUID. It allows to use a different UUIDGenerator per publisher.
+func GenerateMissingUUIDs(generator watermill.UUIDGenerator) PublisherDecorator {
+	if generator == nil {
+		panic("generator is nil")
+	}
+	return MessageTransformPublisherDecorator(func(msg *Message) {
+		if msg.UUID == "" {
+			msg.UUID = generator()
+		}
+	})
+}
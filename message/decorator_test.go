@@ -247,3 +247,15 @@ func TestMessageTransformer_nil_panics(t *testing.T) {
 		"expected to panic if transform is nil",
 	)
 }
+
+func TestGenerateMissingUUIDs(t *testing.T) {
+	pub := &mockPublisher{message.Messages{}}
+	decorated, err := message.GenerateMissingUUIDs(watermill.NewSequentialUUIDGenerator("msg"))(pub)
+	require.NoError(t, err)
+
+	require.NoError(t, decorated.Publish("topic", message.NewMessage("", nil), message.NewMessage("uuid", nil)))
+
+	require.Len(t, pub.published, 2)
+	assert.Equal(t, "msg-00000000000000000001", pub.published[0].UUID)
+	assert.Equal(t, "uuid", pub.published[1].UUID, "existing UUIDs should not be changed")
+}
@@ -0,0 +1,119 @@
+package message
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// EnvelopeFormatVersion is the version of the envelope format written by EnvelopeCodec.
+const EnvelopeFormatVersion = 1
+
+// SchemaVersionMetadataKey is the metadata key with the version of the message payload's schema.
+// It is stored in the envelope's SchemaVersion.
+const SchemaVersionMetadataKey = "schema_version"
+
+// ErrUnsupportedEnvelopeFormat happens when the envelope was written in an unknown format version.
+var ErrUnsupportedEnvelopeFormat = errors.New("unsupported envelope format version")
+
+// Envelope is the on-the-wire representation of a message.
+type Envelope struct {
+	// FormatVersion is the version of the envelope format.
+	FormatVersion int `json:"format_version"`
+
+	UUID     string   `json:"uuid"`
+	Metadata Metadata `json:"metadata,omitempty"`
+	Payload  Payload  `json:"payload"`
+
+	// SchemaVersion is the version of the payload's schema.
+	SchemaVersion int `json:"schema_version"`
+}
+
+// EnvelopeUpcaster upgrades the envelope with the schema version N to the schema version N+1.
+type EnvelopeUpcaster func(envelope *Envelope) error
+
+// UpcastEnvelope returns a MigrateEnvelope hook, which applies the upcasters to the envelope,
+// until there is no upcaster for its schema version.
+//
+// upcasters are keyed by the schema version which they upgrade.
+func UpcastEnvelope(upcasters map[int]EnvelopeUpcaster) func(envelope *Envelope) error {
+	return func(envelope *Envelope) error {
+		for {
+			upcaster, ok := upcasters[envelope.SchemaVersion]
+			if !ok {
+				return nil
+			}
+
+			if err := upcaster(envelope); err != nil {
+				return errors.Wrapf(err, "cannot upcast envelope from schema version %d", envelope.SchemaVersion)
+			}
+			envelope.SchemaVersion++
+		}
+	}
+}
+
+// EnvelopeCodec marshals messages to versioned envelopes and vice versa.
+//
+// It can be used by marshalers of Pub/Subs, which are not able to transport metadata natively
+// or to keep the same wire format across Pub/Subs.
+type EnvelopeCodec struct {
+	// MigrateEnvelope is called with every unmarshaled envelope.
+	// It allows to transparently upgrade messages published with the old payload's schema, for example with UpcastEnvelope.
+	MigrateEnvelope func(envelope *Envelope) error
+}
+
+// Marshal marshals the message to the envelope.
+// The schema version is taken from the SchemaVersionMetadataKey metadata.
+func (c EnvelopeCodec) Marshal(msg *Message) ([]byte, error) {
+	envelope := Envelope{
+		FormatVersion: EnvelopeFormatVersion,
+		UUID:          msg.UUID,
+		Metadata:      make(Metadata, len(msg.Metadata)),
+		Payload:       msg.Payload,
+	}
+
+	for k, v := range msg.Metadata {
+		if k == SchemaVersionMetadataKey {
+			schemaVersion, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s metadata", SchemaVersionMetadataKey)
+			}
+			envelope.SchemaVersion = schemaVersion
+			continue
+		}
+		envelope.Metadata.Set(k, v)
+	}
+
+	return json.Marshal(envelope)
+}
+
+// Unmarshal unmarshals the envelope to the message.
+// The schema version (after migration) is set in the SchemaVersionMetadataKey metadata.
+func (c EnvelopeCodec) Unmarshal(data []byte) (*Message, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal envelope")
+	}
+
+	if envelope.FormatVersion != EnvelopeFormatVersion {
+		return nil, errors.Wrapf(ErrUnsupportedEnvelopeFormat, "version %d", envelope.FormatVersion)
+	}
+	if envelope.Metadata == nil {
+		envelope.Metadata = make(Metadata)
+	}
+
+	if c.MigrateEnvelope != nil {
+		if err := c.MigrateEnvelope(&envelope); err != nil {
+			return nil, errors.Wrapf(err, "cannot migrate envelope of message %s", envelope.UUID)
+		}
+	}
+
+	msg := NewMessage(envelope.UUID, envelope.Payload)
+	for k, v := range envelope.Metadata {
+		msg.Metadata.Set(k, v)
+	}
+	msg.Metadata.Set(SchemaVersionMetadataKey, strconv.Itoa(envelope.SchemaVersion))
+
+	return msg, nil
+}
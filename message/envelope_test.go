@@ -0,0 +1,57 @@
+package message_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func TestEnvelopeCodec(t *testing.T) {
+	codec := message.EnvelopeCodec{}
+
+	msg := message.NewMessage("1", []byte("payload"))
+	msg.Metadata.Set("foo", "bar")
+	msg.Metadata.Set(message.SchemaVersionMetadataKey, "3")
+
+	data, err := codec.Marshal(msg)
+	require.NoError(t, err)
+
+	unmarshaled, err := codec.Unmarshal(data)
+	require.NoError(t, err)
+
+	assert.True(t, msg.Equals(unmarshaled))
+}
+
+func TestEnvelopeCodec_upcast(t *testing.T) {
+	codec := message.EnvelopeCodec{
+		MigrateEnvelope: message.UpcastEnvelope(map[int]message.EnvelopeUpcaster{
+			0: func(envelope *message.Envelope) error {
+				envelope.Payload = append(envelope.Payload, []byte("_v1")...)
+				return nil
+			},
+			1: func(envelope *message.Envelope) error {
+				envelope.Metadata.Set("upcasted", "true")
+				return nil
+			},
+		}),
+	}
+
+	data, err := codec.Marshal(message.NewMessage("1", []byte("payload")))
+	require.NoError(t, err)
+
+	msg, err := codec.Unmarshal(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, "payload_v1", string(msg.Payload))
+	assert.Equal(t, "true", msg.Metadata.Get("upcasted"))
+	assert.Equal(t, "2", msg.Metadata.Get(message.SchemaVersionMetadataKey))
+}
+
+func TestEnvelopeCodec_unsupported_format(t *testing.T) {
+	_, err := message.EnvelopeCodec{}.Unmarshal([]byte(`{"format_version": 2, "uuid": "1"}`))
+	assert.Equal(t, message.ErrUnsupportedEnvelopeFormat, errors.Cause(err))
+}
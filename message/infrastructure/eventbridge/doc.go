@@ -0,0 +1,12 @@
+// Amazon EventBridge implementation of Watermill's Publisher interface.
+//
+// Messages are sent to event buses with the PutEvents API. Watermill's topic is mapped to the event bus
+// and the detail-type of the event by the Marshaler, and the UUID, the metadata and the payload
+// of the message become fields of the event's detail, so they can be matched by EventBridge rules.
+//
+// The events are consumed by the targets of the rules, so there is no Subscriber.
+//
+// Supported features:
+// - publishing in batches of up to 10 events, split by the PutEvents size limit
+// - requests signed with AWS Signature Version 4, with credentials from any aws.CredentialsProvider
+package eventbridge
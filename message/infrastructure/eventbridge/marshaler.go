@@ -0,0 +1,128 @@
+package eventbridge
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Metadata keys which override the fields of the event set by DefaultMarshaler.
+// They are not added to the event's detail.
+const (
+	SourceMetadataKey      = "eventbridge_source"
+	DetailTypeMetadataKey  = "eventbridge_detail_type"
+	TraceHeaderMetadataKey = "eventbridge_trace_header"
+
+	// ResourcesMetadataKey is the comma separated list of the ARNs of resources involved in the event.
+	ResourcesMetadataKey = "eventbridge_resources"
+)
+
+// DefaultEventBus is the name of the event bus of the AWS account.
+const DefaultEventBus = "default"
+
+// Entry is the event of the PutEvents request.
+type Entry struct {
+	Source       string   `json:"Source"`
+	DetailType   string   `json:"DetailType"`
+	Detail       string   `json:"Detail"`
+	EventBusName string   `json:"EventBusName,omitempty"`
+	Resources    []string `json:"Resources,omitempty"`
+	TraceHeader  string   `json:"TraceHeader,omitempty"`
+}
+
+// size returns the size of the entry counted to the PutEvents limit.
+// See https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-putevent-size.html.
+func (e Entry) size() int {
+	size := len(e.Source) + len(e.DetailType) + len(e.Detail)
+	for _, r := range e.Resources {
+		size += len(r)
+	}
+
+	return size
+}
+
+type Marshaler interface {
+	Marshal(topic string, msg *message.Message) (Entry, error)
+}
+
+// Detail is the detail of the events created by DefaultMarshaler.
+//
+// JSON payloads are sent in Data, so EventBridge rules can match their fields.
+// Other payloads are sent base64 encoded in DataBase64.
+type Detail struct {
+	UUID       string            `json:"uuid"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Data       json.RawMessage   `json:"data,omitempty"`
+	DataBase64 []byte            `json:"data_base64,omitempty"`
+}
+
+// DefaultMarshaler maps the topic to the event bus and the detail-type of the event.
+type DefaultMarshaler struct {
+	// Source is the source of the events, for example "com.example.orders".
+	// It's required, unless SourceMetadataKey is set on all messages.
+	Source string
+
+	// EventBus returns the name or ARN of the event bus of the topic. When nil, DefaultEventBus is used.
+	EventBus func(topic string) string
+
+	// DetailType returns the detail-type of the events of the topic. When nil, the topic is the detail-type.
+	DetailType func(topic string) string
+}
+
+func (m DefaultMarshaler) Marshal(topic string, msg *message.Message) (Entry, error) {
+	entry := Entry{
+		Source:       m.Source,
+		DetailType:   topic,
+		EventBusName: DefaultEventBus,
+	}
+	if m.EventBus != nil {
+		entry.EventBusName = m.EventBus(topic)
+	}
+	if m.DetailType != nil {
+		entry.DetailType = m.DetailType(topic)
+	}
+
+	detail := Detail{UUID: msg.UUID}
+
+	for key, value := range msg.Metadata {
+		switch key {
+		case SourceMetadataKey:
+			entry.Source = value
+		case DetailTypeMetadataKey:
+			entry.DetailType = value
+		case TraceHeaderMetadataKey:
+			entry.TraceHeader = value
+		case ResourcesMetadataKey:
+			entry.Resources = strings.Split(value, ",")
+		default:
+			if detail.Metadata == nil {
+				detail.Metadata = map[string]string{}
+			}
+			detail.Metadata[key] = value
+		}
+	}
+
+	if entry.Source == "" {
+		return Entry{}, errors.New("missing source of the event")
+	}
+	if entry.DetailType == "" {
+		return Entry{}, errors.New("missing detail-type of the event")
+	}
+
+	if json.Valid(msg.Payload) {
+		detail.Data = json.RawMessage(msg.Payload)
+	} else {
+		detail.DataBase64 = msg.Payload
+	}
+
+	b, err := json.Marshal(detail)
+	if err != nil {
+		return Entry{}, errors.Wrap(err, "cannot marshal event detail")
+	}
+	entry.Detail = string(b)
+
+	return entry, nil
+}
@@ -0,0 +1,59 @@
+package eventbridge_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/eventbridge"
+)
+
+func TestDefaultMarshaler(t *testing.T) {
+	marshaler := eventbridge.DefaultMarshaler{Source: "com.example.orders"}
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte(`{"order_id": "1"}`))
+	msg.Metadata.Set("tenant", "acme")
+	msg.Metadata.Set(eventbridge.DetailTypeMetadataKey, "OrderCreated")
+	msg.Metadata.Set(eventbridge.ResourcesMetadataKey, "arn:aws:a,arn:aws:b")
+	msg.Metadata.Set(eventbridge.TraceHeaderMetadataKey, "Root=1-5759e988-bd862e3fe1be46a994272793")
+
+	entry, err := marshaler.Marshal("orders", msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "com.example.orders", entry.Source)
+	assert.Equal(t, "OrderCreated", entry.DetailType, "metadata should override the detail-type")
+	assert.Equal(t, eventbridge.DefaultEventBus, entry.EventBusName)
+	assert.Equal(t, []string{"arn:aws:a", "arn:aws:b"}, entry.Resources)
+	assert.Equal(t, "Root=1-5759e988-bd862e3fe1be46a994272793", entry.TraceHeader)
+	assert.JSONEq(t, fmt.Sprintf(
+		`{"uuid": %q, "metadata": {"tenant": "acme"}, "data": {"order_id": "1"}}`,
+		msg.UUID,
+	), entry.Detail)
+}
+
+func TestDefaultMarshaler_binary_payload(t *testing.T) {
+	msg := message.NewMessage(watermill.NewUUID(), []byte{0x00, 0xff})
+
+	entry, err := eventbridge.DefaultMarshaler{
+		Source:     "com.example.orders",
+		DetailType: func(topic string) string { return "detail_" + topic },
+	}.Marshal("orders", msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "detail_orders", entry.DetailType)
+	assert.JSONEq(t, fmt.Sprintf(
+		`{"uuid": %q, "data_base64": %q}`,
+		msg.UUID,
+		base64.StdEncoding.EncodeToString([]byte{0x00, 0xff}),
+	), entry.Detail)
+}
+
+func TestDefaultMarshaler_missing_source(t *testing.T) {
+	_, err := eventbridge.DefaultMarshaler{}.Marshal("orders", message.NewMessage(watermill.NewUUID(), nil))
+	assert.Error(t, err)
+}
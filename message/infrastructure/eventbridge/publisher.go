@@ -0,0 +1,279 @@
+package eventbridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// MaxBatchSize is the maximum number of events in one PutEvents request.
+	MaxBatchSize = 10
+
+	// MaxRequestSize is the maximum size of the events in one PutEvents request, 256 KiB.
+	MaxRequestSize = 256 * 1024
+)
+
+type PublisherConfig struct {
+	// Region is the AWS region of the event buses, for example "eu-west-1". Required.
+	Region string
+
+	// Credentials sign the PutEvents requests. Required.
+	//
+	// Credentials of the AWS SDK config (aws.Config.Credentials) can be used,
+	// or static credentials wrapped with aws.CredentialsProviderFunc.
+	Credentials aws.CredentialsProvider
+
+	// Endpoint of the EventBridge API. Defaults to https://events.<Region>.amazonaws.com.
+	Endpoint string
+
+	// HTTPClient sends the PutEvents requests. Defaults to the client with 30 seconds timeout.
+	HTTPClient *http.Client
+
+	// BatchSize is the maximum number of events sent in one PutEvents request.
+	// Defaults to MaxBatchSize, which is also its maximum.
+	BatchSize int
+
+	Marshaler Marshaler
+}
+
+func (c *PublisherConfig) setDefaults() {
+	if c.Endpoint == "" {
+		c.Endpoint = fmt.Sprintf("https://events.%s.amazonaws.com", c.Region)
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: time.Second * 30}
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = MaxBatchSize
+	}
+}
+
+func (c PublisherConfig) Validate() error {
+	if c.Region == "" {
+		return errors.New("missing Region")
+	}
+	if c.Credentials == nil {
+		return errors.New("missing Credentials")
+	}
+	if c.BatchSize < 0 || c.BatchSize > MaxBatchSize {
+		return errors.Errorf("BatchSize must be between 1 and %d", MaxBatchSize)
+	}
+	if c.Marshaler == nil {
+		return errors.New("missing Marshaler")
+	}
+
+	return nil
+}
+
+// Publisher publishes messages to EventBridge event buses.
+type Publisher struct {
+	config PublisherConfig
+	signer *v4.Signer
+	logger watermill.LoggerAdapter
+
+	closed     bool
+	closedLock sync.RWMutex
+}
+
+func NewPublisher(config PublisherConfig, logger watermill.LoggerAdapter) (*Publisher, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid EventBridge publisher config")
+	}
+
+	return &Publisher{
+		config: config,
+		signer: v4.NewSigner(),
+		logger: logger,
+	}, nil
+}
+
+// Publish sends the messages to EventBridge in batches of up to PublisherConfig.BatchSize events.
+//
+// EventBridge accepts or rejects every event of the batch separately. Publish returns an error
+// with the UUIDs of the rejected messages, after all batches are sent.
+// Messages larger than MaxRequestSize are rejected before sending.
+func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	p.closedLock.RLock()
+	defer p.closedLock.RUnlock()
+
+	if p.closed {
+		return errors.New("publisher closed")
+	}
+
+	batches, err := p.batches(topic, messages)
+	if err != nil {
+		return err
+	}
+
+	var result error
+	for _, b := range batches {
+		logFields := watermill.LogFields{"topic": topic, "messages_count": len(b.messages)}
+		p.logger.Trace("Sending events to EventBridge", logFields)
+
+		if err := p.putEvents(context.Background(), b); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return result
+}
+
+type batch struct {
+	messages []*message.Message
+	entries  []Entry
+	size     int
+}
+
+func (p *Publisher) batches(topic string, messages []*message.Message) ([]*batch, error) {
+	var batches []*batch
+	current := &batch{}
+
+	for _, msg := range messages {
+		entry, err := p.config.Marshaler.Marshal(topic, msg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot marshal message %s", msg.UUID)
+		}
+
+		size := entry.size()
+		if size > MaxRequestSize {
+			return nil, errors.Errorf("message %s is too large: %d bytes exceeds the limit of %d bytes", msg.UUID, size, MaxRequestSize)
+		}
+
+		if len(current.entries) == p.config.BatchSize || current.size+size > MaxRequestSize {
+			batches = append(batches, current)
+			current = &batch{}
+		}
+
+		current.messages = append(current.messages, msg)
+		current.entries = append(current.entries, entry)
+		current.size += size
+	}
+
+	if len(current.entries) > 0 {
+		batches = append(batches, current)
+	}
+
+	return batches, nil
+}
+
+type putEventsRequest struct {
+	Entries []Entry `json:"Entries"`
+}
+
+type putEventsResponse struct {
+	FailedEntryCount int `json:"FailedEntryCount"`
+	Entries          []struct {
+		EventID      string `json:"EventId"`
+		ErrorCode    string `json:"ErrorCode"`
+		ErrorMessage string `json:"ErrorMessage"`
+	} `json:"Entries"`
+}
+
+type errorResponse struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (p *Publisher) putEvents(ctx context.Context, b *batch) error {
+	body, err := json.Marshal(putEventsRequest{Entries: b.entries})
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal PutEvents request")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "cannot create PutEvents request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSEvents.PutEvents")
+
+	credentials, err := p.config.Credentials.Retrieve(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot retrieve AWS credentials")
+	}
+
+	payloadHash := sha256.Sum256(body)
+	if err := p.signer.SignHTTP(
+		ctx, credentials, req, hex.EncodeToString(payloadHash[:]), "events", p.config.Region, time.Now(),
+	); err != nil {
+		return errors.Wrap(err, "cannot sign PutEvents request")
+	}
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "cannot send messages %v", messageUUIDs(b.messages))
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read PutEvents response of messages %v", messageUUIDs(b.messages))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp errorResponse
+		_ = json.Unmarshal(respBody, &errResp)
+
+		return errors.Errorf(
+			"PutEvents of messages %v failed with status %d: %s: %s",
+			messageUUIDs(b.messages), resp.StatusCode, errResp.Type, errResp.Message,
+		)
+	}
+
+	var putEventsResp putEventsResponse
+	if err := json.Unmarshal(respBody, &putEventsResp); err != nil {
+		return errors.Wrap(err, "cannot unmarshal PutEvents response")
+	}
+	if putEventsResp.FailedEntryCount == 0 {
+		return nil
+	}
+
+	// entries of the response are in the same order as the entries of the request
+	var result error
+	for i, entry := range putEventsResp.Entries {
+		if entry.ErrorCode == "" || i >= len(b.messages) {
+			continue
+		}
+		result = multierror.Append(result, errors.Errorf(
+			"message %s rejected by EventBridge: %s: %s", b.messages[i].UUID, entry.ErrorCode, entry.ErrorMessage,
+		))
+	}
+
+	return result
+}
+
+func messageUUIDs(messages []*message.Message) []string {
+	uuids := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		uuids = append(uuids, msg.UUID)
+	}
+
+	return uuids
+}
+
+func (p *Publisher) Close() error {
+	p.closedLock.Lock()
+	defer p.closedLock.Unlock()
+
+	p.closed = true
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package eventbridge_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/eventbridge"
+)
+
+var credentials = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+	return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+})
+
+type putEventsRequest struct {
+	Entries []eventbridge.Entry
+}
+
+// eventBridgeMock accepts PutEvents requests and rejects the events with the detail containing rejectedPayload.
+type eventBridgeMock struct {
+	t               *testing.T
+	rejectedPayload string
+
+	lock     sync.Mutex
+	requests []putEventsRequest
+}
+
+func (m *eventBridgeMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(m.t, "AWSEvents.PutEvents", r.Header.Get("X-Amz-Target"))
+	assert.Equal(m.t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+	assert.True(
+		m.t,
+		strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"),
+		"request should be signed",
+	)
+	assert.Contains(m.t, r.Header.Get("Authorization"), "/eu-west-1/events/aws4_request")
+
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(m.t, err)
+
+	var req putEventsRequest
+	require.NoError(m.t, json.Unmarshal(body, &req))
+
+	m.lock.Lock()
+	m.requests = append(m.requests, req)
+	m.lock.Unlock()
+
+	type responseEntry struct {
+		EventId      string `json:",omitempty"`
+		ErrorCode    string `json:",omitempty"`
+		ErrorMessage string `json:",omitempty"`
+	}
+	resp := struct {
+		FailedEntryCount int
+		Entries          []responseEntry
+	}{}
+
+	for i, entry := range req.Entries {
+		if m.rejectedPayload != "" && strings.Contains(entry.Detail, m.rejectedPayload) {
+			resp.FailedEntryCount++
+			resp.Entries = append(resp.Entries, responseEntry{
+				ErrorCode:    "MalformedDetail",
+				ErrorMessage: "Detail is malformed.",
+			})
+			continue
+		}
+		resp.Entries = append(resp.Entries, responseEntry{EventId: fmt.Sprintf("event-%d", i)})
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	require.NoError(m.t, json.NewEncoder(w).Encode(resp))
+}
+
+func (m *eventBridgeMock) Requests() []putEventsRequest {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return append([]putEventsRequest{}, m.requests...)
+}
+
+func newPublisher(t *testing.T, endpoint string) *eventbridge.Publisher {
+	pub, err := eventbridge.NewPublisher(eventbridge.PublisherConfig{
+		Region:      "eu-west-1",
+		Credentials: credentials,
+		Endpoint:    endpoint,
+		Marshaler: eventbridge.DefaultMarshaler{
+			Source: "com.example.orders",
+			EventBus: func(topic string) string {
+				return "orders-bus"
+			},
+		},
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	return pub
+}
+
+func TestPublisher_Publish(t *testing.T) {
+	mock := &eventBridgeMock{t: t}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	pub := newPublisher(t, server.URL)
+	defer func() {
+		assert.NoError(t, pub.Close())
+	}()
+
+	var messages message.Messages
+	for i := 0; i < 12; i++ {
+		messages = append(messages, message.NewMessage(watermill.NewUUID(), []byte(fmt.Sprintf(`{"order_id": %d}`, i))))
+	}
+
+	require.NoError(t, pub.Publish("order_created", messages...))
+
+	requests := mock.Requests()
+	require.Len(t, requests, 2, "messages should be sent in batches of 10")
+	assert.Len(t, requests[0].Entries, 10)
+	assert.Len(t, requests[1].Entries, 2)
+
+	entry := requests[0].Entries[0]
+	assert.Equal(t, "com.example.orders", entry.Source)
+	assert.Equal(t, "order_created", entry.DetailType)
+	assert.Equal(t, "orders-bus", entry.EventBusName)
+	assert.JSONEq(t, fmt.Sprintf(`{"uuid": %q, "data": {"order_id": 0}}`, messages[0].UUID), entry.Detail)
+}
+
+func TestPublisher_Publish_rejected_events(t *testing.T) {
+	mock := &eventBridgeMock{t: t, rejectedPayload: "rejected"}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	pub := newPublisher(t, server.URL)
+	defer func() {
+		assert.NoError(t, pub.Close())
+	}()
+
+	accepted := message.NewMessage(watermill.NewUUID(), []byte(`{"status": "accepted"}`))
+	rejected := message.NewMessage(watermill.NewUUID(), []byte(`{"status": "rejected"}`))
+
+	err := pub.Publish("order_created", accepted, rejected)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), rejected.UUID)
+	assert.Contains(t, err.Error(), "MalformedDetail")
+	assert.NotContains(t, err.Error(), accepted.UUID)
+}
+
+func TestPublisher_Publish_error_response(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type": "ResourceNotFoundException", "message": "Event bus orders-bus does not exist."}`))
+	}))
+	defer server.Close()
+
+	pub := newPublisher(t, server.URL)
+
+	err := pub.Publish("order_created", message.NewMessage(watermill.NewUUID(), nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ResourceNotFoundException")
+}
+
+func TestPublisher_Publish_too_large_message(t *testing.T) {
+	mock := &eventBridgeMock{t: t}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	pub := newPublisher(t, server.URL)
+
+	payload := fmt.Sprintf(`{"data": %q}`, strings.Repeat("a", eventbridge.MaxRequestSize))
+	err := pub.Publish("order_created", message.NewMessage(watermill.NewUUID(), []byte(payload)))
+	assert.Error(t, err)
+	assert.Empty(t, mock.Requests(), "message should be rejected before sending")
+}
+
+func TestPublisher_Publish_closed(t *testing.T) {
+	pub := newPublisher(t, "http://localhost")
+	require.NoError(t, pub.Close())
+
+	assert.Error(t, pub.Publish("order_created", message.NewMessage(watermill.NewUUID(), nil)))
+}
+
+func TestNewPublisher_invalid_config(t *testing.T) {
+	_, err := eventbridge.NewPublisher(eventbridge.PublisherConfig{
+		Credentials: credentials,
+		Marshaler:   eventbridge.DefaultMarshaler{Source: "com.example.orders"},
+	}, watermill.NopLogger{})
+	assert.Error(t, err, "missing Region")
+
+	_, err = eventbridge.NewPublisher(eventbridge.PublisherConfig{
+		Region:      "eu-west-1",
+		Credentials: credentials,
+		BatchSize:   11,
+		Marshaler:   eventbridge.DefaultMarshaler{Source: "com.example.orders"},
+	}, watermill.NopLogger{})
+	assert.Error(t, err, "BatchSize above the PutEvents limit")
+}
@@ -0,0 +1,136 @@
+package gochannel
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// ErrOutputBufferFull is returned by Publish with OverflowError, when the subscriber's buffer is full.
+var ErrOutputBufferFull = errors.New("subscriber output buffer is full")
+
+// OverflowPolicy determines what happens when a message is published
+// and the subscriber's buffer (Config.OutputChannelBuffer) is full.
+type OverflowPolicy int
+
+const (
+	// OverflowUnbounded doesn't limit the number of messages waiting for the subscriber.
+	// Every published message waits in a separate goroutine, until the subscriber receives it.
+	OverflowUnbounded OverflowPolicy = iota
+
+	// OverflowBlock blocks Publish until there is free space in the buffer.
+	OverflowBlock
+
+	// OverflowDropOldest discards the oldest message from the buffer to make space for the new message.
+	OverflowDropOldest
+
+	// OverflowDropNewest discards the new message.
+	OverflowDropNewest
+
+	// OverflowError discards the new message and returns ErrOutputBufferFull from Publish.
+	OverflowError
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowUnbounded:
+		return "unbounded"
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowDropNewest:
+		return "drop_newest"
+	case OverflowError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// queuedMessage is a message waiting in the subscriber's buffer.
+// delivered is closed when the message is acked by the subscriber, or is discarded.
+type queuedMessage struct {
+	msg       *message.Message
+	delivered chan struct{}
+}
+
+// enqueue puts the message into the subscriber's buffer, according to the overflow policy.
+// The returned channel is closed when the message is processed by the subscriber or discarded.
+func (s *subscriber) enqueue(msg *message.Message, policy OverflowPolicy) (<-chan struct{}, error) {
+	queued := queuedMessage{msg: msg, delivered: make(chan struct{})}
+	logFields := watermill.LogFields{
+		"message_uuid":    msg.UUID,
+		"pubsub_uuid":     s.uuid,
+		"overflow_policy": policy.String(),
+	}
+
+	select {
+	case s.queue <- queued:
+		return queued.delivered, nil
+	case <-s.closing:
+		close(queued.delivered)
+		return queued.delivered, nil
+	default:
+		// the buffer is full
+	}
+
+	switch policy {
+	case OverflowBlock:
+		select {
+		case s.queue <- queued:
+		case <-s.closing:
+			close(queued.delivered)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.queue <- queued:
+				return queued.delivered, nil
+			case oldest := <-s.queue:
+				s.logger.Info("Subscriber buffer full, oldest message dropped", logFields.Add(
+					watermill.LogFields{"dropped_message_uuid": oldest.msg.UUID},
+				))
+				close(oldest.delivered)
+			default:
+				// with no buffer, the new message is the oldest one
+				s.logger.Info("Subscriber buffer full, message dropped", logFields)
+				close(queued.delivered)
+				return queued.delivered, nil
+			}
+		}
+	case OverflowDropNewest:
+		s.logger.Info("Subscriber buffer full, message dropped", logFields)
+		close(queued.delivered)
+	case OverflowError:
+		return nil, errors.Wrapf(ErrOutputBufferFull, "cannot send message %s to subscriber %s", msg.UUID, s.uuid)
+	}
+
+	return queued.delivered, nil
+}
+
+// deliverQueued sends messages from the subscriber's buffer to the output channel, one by one.
+func (s *subscriber) deliverQueued() {
+	for {
+		select {
+		case queued := <-s.queue:
+			s.sendMessageToSubscriber(queued.msg)
+			close(queued.delivered)
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// discardQueued discards messages left in the buffer of the closed subscriber.
+func (s *subscriber) discardQueued() {
+	for {
+		select {
+		case queued := <-s.queue:
+			close(queued.delivered)
+		default:
+			return
+		}
+	}
+}
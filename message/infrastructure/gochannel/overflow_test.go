@@ -0,0 +1,122 @@
+package gochannel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+)
+
+// subscribeWithFullBuffer returns the subscription of the Pub/Sub with buffer of one message,
+// with the first message received (but not acked) and the second message waiting in the buffer.
+func subscribeWithFullBuffer(t *testing.T, policy gochannel.OverflowPolicy) (message.PubSub, <-chan *message.Message, *message.Message) {
+	pubSub := gochannel.NewGoChannel(
+		gochannel.Config{
+			OutputChannelBuffer: 1,
+			OverflowPolicy:      policy,
+		},
+		watermill.NewStdLogger(true, true),
+	)
+
+	msgs, err := pubSub.Subscribe(context.Background(), "topic")
+	require.NoError(t, err)
+
+	require.NoError(t, pubSub.Publish("topic", message.NewMessage("1", nil)))
+	msg1 := <-msgs
+	require.Equal(t, "1", msg1.UUID)
+
+	require.NoError(t, pubSub.Publish("topic", message.NewMessage("2", nil)))
+
+	return pubSub, msgs, msg1
+}
+
+func receiveAndAck(t *testing.T, msgs <-chan *message.Message) string {
+	select {
+	case msg := <-msgs:
+		msg.Ack()
+		return msg.UUID
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+		return ""
+	}
+}
+
+func assertNoMessage(t *testing.T, msgs <-chan *message.Message) {
+	select {
+	case msg := <-msgs:
+		t.Fatalf("unexpected message %s", msg.UUID)
+	case <-time.After(time.Millisecond * 50):
+		// ok
+	}
+}
+
+func TestGoChannel_OverflowDropNewest(t *testing.T) {
+	pubSub, msgs, msg1 := subscribeWithFullBuffer(t, gochannel.OverflowDropNewest)
+	defer pubSub.Close()
+
+	require.NoError(t, pubSub.Publish("topic", message.NewMessage("3", nil)))
+
+	msg1.Ack()
+	assert.Equal(t, "2", receiveAndAck(t, msgs))
+	assertNoMessage(t, msgs)
+}
+
+func TestGoChannel_OverflowDropOldest(t *testing.T) {
+	pubSub, msgs, msg1 := subscribeWithFullBuffer(t, gochannel.OverflowDropOldest)
+	defer pubSub.Close()
+
+	require.NoError(t, pubSub.Publish("topic", message.NewMessage("3", nil)))
+
+	msg1.Ack()
+	assert.Equal(t, "3", receiveAndAck(t, msgs))
+	assertNoMessage(t, msgs)
+}
+
+func TestGoChannel_OverflowError(t *testing.T) {
+	pubSub, msgs, msg1 := subscribeWithFullBuffer(t, gochannel.OverflowError)
+	defer pubSub.Close()
+
+	err := pubSub.Publish("topic", message.NewMessage("3", nil))
+	assert.Equal(t, gochannel.ErrOutputBufferFull, errors.Cause(err))
+
+	msg1.Ack()
+	assert.Equal(t, "2", receiveAndAck(t, msgs))
+	assertNoMessage(t, msgs)
+}
+
+func TestGoChannel_OverflowBlock(t *testing.T) {
+	pubSub, msgs, msg1 := subscribeWithFullBuffer(t, gochannel.OverflowBlock)
+	defer pubSub.Close()
+
+	published := make(chan struct{})
+	go func() {
+		assert.NoError(t, pubSub.Publish("topic", message.NewMessage("3", nil)))
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("publish should be blocked until there is space in the buffer")
+	case <-time.After(time.Millisecond * 50):
+		// ok
+	}
+
+	msg1.Ack()
+	assert.Equal(t, "2", receiveAndAck(t, msgs))
+
+	select {
+	case <-published:
+		// ok
+	case <-time.After(time.Second):
+		t.Fatal("publish should be unblocked")
+	}
+
+	assert.Equal(t, "3", receiveAndAck(t, msgs))
+}
@@ -2,7 +2,9 @@ package gochannel
 
 import (
 	"context"
+	"math/rand"
 	"sync"
+	"time"
 
 	"github.com/renstrom/shortuuid"
 
@@ -14,8 +16,15 @@ import (
 
 type Config struct {
 	// Output channel buffer size.
+	//
+	// With OverflowPolicy other than OverflowUnbounded, it is also the maximum number of messages
+	// waiting for every subscriber, until they are received.
 	OutputChannelBuffer int64
 
+	// OverflowPolicy determines what happens when the subscriber's buffer is full.
+	// Defaults to OverflowUnbounded, which doesn't limit the number of waiting messages.
+	OverflowPolicy OverflowPolicy
+
 	// If persistent is set to true, when subscriber subscribes to the topic,
 	// it will receive all previously produced messages.
 	//
@@ -26,6 +35,32 @@ type Config struct {
 	// When true, Publish will block until subscriber Ack's the message.
 	// If there are no subscribers, Publish will not block (also when Persistent is true).
 	BlockPublishUntilSubscriberAck bool
+
+	// The settings below are intended for tests, which need to simulate the behaviour of a real broker.
+
+	// OnPublish is called for every published message, before it is sent to subscribers.
+	OnPublish func(topic string, msg *message.Message)
+
+	// OnDeliver is called every time the message is sent to a subscriber, including redeliveries.
+	OnDeliver func(topic string, msg *message.Message)
+
+	// DeliveryLatency delays every delivery of the message to the subscriber.
+	DeliveryLatency time.Duration
+
+	// DropRate is the probability (from 0 to 1) that the message is not delivered to the subscriber.
+	DropRate float64
+
+	// RedeliveryRate is the probability (from 0 to 1) that an acked message is delivered to the subscriber again,
+	// simulating at-least-once delivery.
+	RedeliveryRate float64
+
+	// Clock is used to wait for DeliveryLatency. Use ManualClock to control it from the test.
+	// Defaults to the real clock.
+	Clock Clock
+
+	// RandSource is used for DropRate and RedeliveryRate. Use a source with a fixed seed for deterministic tests.
+	// Defaults to a source seeded with the current time.
+	RandSource rand.Source
 }
 
 // GoChannel is the simplest Pub/Sub implementation.
@@ -50,6 +85,11 @@ type GoChannel struct {
 
 	persistedMessages     map[string][]*message.Message
 	persistedMessagesLock sync.RWMutex
+
+	consumerGroupsOffsets     map[string]int
+	consumerGroupsOffsetsLock sync.Mutex
+
+	simulator *deliverySimulator
 }
 
 func (g *GoChannel) Publisher() message.Publisher {
@@ -77,11 +117,17 @@ func NewGoChannel(config Config, logger watermill.LoggerAdapter) message.PubSub
 		closing: make(chan struct{}),
 
 		persistedMessages: map[string][]*message.Message{},
+
+		consumerGroupsOffsets: map[string]int{},
+
+		simulator: newDeliverySimulator(config),
 	}
 }
 
 // Publish in GoChannel is NOT blocking until all consumers consume.
 // Messages will be send in background.
+// With Config.OverflowPolicy set, Publish may block, drop messages or return an error,
+// when the subscriber's buffer is full (see OverflowPolicy).
 //
 // Messages may be persisted or not, depending of persistent attribute.
 func (g *GoChannel) Publish(topic string, messages ...*message.Message) error {
@@ -91,6 +137,7 @@ func (g *GoChannel) Publish(topic string, messages ...*message.Message) error {
 
 	for i, msg := range messages {
 		messages[i] = msg.Copy()
+		g.simulator.onPublish(topic, messages[i])
 	}
 
 	g.subscribersLock.RLock()
@@ -138,7 +185,7 @@ func (g *GoChannel) waitForAckFromSubscribers(msg *message.Message, ackedByConsu
 }
 
 func (g *GoChannel) sendMessage(topic string, message *message.Message) (<-chan struct{}, error) {
-	subscribers := g.topicSubscribers(topic)
+	subscribers := g.messageReceivers(topic)
 	ackedBySubscribers := make(chan struct{})
 
 	if len(subscribers) == 0 {
@@ -146,6 +193,10 @@ func (g *GoChannel) sendMessage(topic string, message *message.Message) (<-chan
 		return ackedBySubscribers, nil
 	}
 
+	if g.config.OverflowPolicy != OverflowUnbounded {
+		return g.enqueueMessage(subscribers, message)
+	}
+
 	go func(subscribers []*subscriber) {
 		for i := range subscribers {
 			subscriber := subscribers[i]
@@ -157,11 +208,120 @@ func (g *GoChannel) sendMessage(topic string, message *message.Message) (<-chan
 	return ackedBySubscribers, nil
 }
 
+// enqueueMessage puts the message into the buffers of the subscribers, according to Config.OverflowPolicy.
+func (g *GoChannel) enqueueMessage(subscribers []*subscriber, msg *message.Message) (<-chan struct{}, error) {
+	var delivered []<-chan struct{}
+	for _, s := range subscribers {
+		d, err := s.enqueue(msg, g.config.OverflowPolicy)
+		if err != nil {
+			return nil, err
+		}
+		delivered = append(delivered, d)
+	}
+
+	ackedBySubscribers := make(chan struct{})
+	go func() {
+		for _, d := range delivered {
+			<-d
+		}
+		close(ackedBySubscribers)
+	}()
+
+	return ackedBySubscribers, nil
+}
+
+// messageReceivers returns subscribers which should receive the next message published to the topic.
+//
+// Every subscriber without consumer group receives the message.
+// Within every consumer group, only one subscriber receives the message (subscribers are chosen in round-robin).
+func (g *GoChannel) messageReceivers(topic string) []*subscriber {
+	subscribers := g.topicSubscribers(topic)
+	if len(subscribers) == 0 {
+		return nil
+	}
+
+	var receivers []*subscriber
+	groups := map[string][]*subscriber{}
+	var groupsOrder []string
+
+	for _, s := range subscribers {
+		if s.consumerGroup == "" {
+			receivers = append(receivers, s)
+			continue
+		}
+
+		if _, ok := groups[s.consumerGroup]; !ok {
+			groupsOrder = append(groupsOrder, s.consumerGroup)
+		}
+		groups[s.consumerGroup] = append(groups[s.consumerGroup], s)
+	}
+
+	g.consumerGroupsOffsetsLock.Lock()
+	defer g.consumerGroupsOffsetsLock.Unlock()
+
+	for _, consumerGroup := range groupsOrder {
+		groupSubscribers := groups[consumerGroup]
+		offsetKey := topic + "/" + consumerGroup
+
+		offset := g.consumerGroupsOffsets[offsetKey]
+		receivers = append(receivers, groupSubscribers[offset%len(groupSubscribers)])
+		g.consumerGroupsOffsets[offsetKey] = offset + 1
+	}
+
+	return receivers
+}
+
 // Subscribe returns channel to which all published messages are sent.
 // Messages are not persisted. If there are no subscribers and message is produced it will be gone.
 //
-// There are no consumer groups support etc. Every consumer will receive every produced message.
+// Every consumer will receive every produced message.
+// To share messages between multiple consumers, use SubscribeWithConsumerGroup.
+//
+// The subscription lasts until ctx is canceled or the Pub/Sub is closed.
+// When ctx is canceled, only this subscription is closed: the output channel is closed,
+// messages waiting for the subscriber are discarded and all its goroutines are stopped.
 func (g *GoChannel) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	return g.SubscribeWithConsumerGroup(ctx, topic, "")
+}
+
+// SubscribeWithConsumerGroup works like Subscribe, but subscribers with the same consumerGroup
+// share messages from the topic competitively. Every message is delivered to only one
+// subscriber within the consumer group, while each consumer group (and every subscriber
+// without consumer group) receives its own copy of the message.
+//
+// When consumerGroup is empty, SubscribeWithConsumerGroup behaves exactly like Subscribe.
+//
+// When Persistent is enabled, previously published messages are sent only to the first
+// subscriber of the consumer group.
+func (g *GoChannel) SubscribeWithConsumerGroup(ctx context.Context, topic string, consumerGroup string) (<-chan *message.Message, error) {
+	return g.subscribe(ctx, topic, consumerGroup, true)
+}
+
+// SubscribeWithOptions works like Subscribe, with the subscription's settings overridden by opts.
+//
+// ConsumerGroup works like in SubscribeWithConsumerGroup.
+// With message.StartPositionNewest, persisted messages are not sent to the subscriber.
+// message.StartPositionOldest is supported only when Persistent is enabled.
+func (g *GoChannel) SubscribeWithOptions(
+	ctx context.Context,
+	topic string,
+	opts ...message.SubscribeOption,
+) (<-chan *message.Message, error) {
+	options := message.NewSubscribeOptions(opts...)
+
+	if options.StartPosition == message.StartPositionOldest && !g.config.Persistent {
+		return nil, errors.New("StartPositionOldest is supported only by persistent GoChannel")
+	}
+
+	return g.subscribe(ctx, topic, options.ConsumerGroup, options.StartPosition != message.StartPositionNewest)
+}
+
+func (g *GoChannel) subscribe(
+	ctx context.Context,
+	topic string,
+	consumerGroup string,
+	sendPersistedMessages bool,
+) (<-chan *message.Message, error) {
 	if g.closed {
 		return nil, errors.New("Pub/Sub closed")
 	}
@@ -174,12 +334,20 @@ func (g *GoChannel) Subscribe(ctx context.Context, topic string) (<-chan *messag
 	s := &subscriber{
 		ctx:           ctx,
 		uuid:          watermill.NewUUID(),
+		topic:         topic,
+		consumerGroup: consumerGroup,
+		simulator:     g.simulator,
 		outputChannel: make(chan *message.Message, g.config.OutputChannelBuffer),
+		queue:         make(chan queuedMessage, g.config.OutputChannelBuffer),
 		logger:        g.logger,
 		closing:       make(chan struct{}),
 	}
 	g.subscribersWg.Add(1)
 
+	if g.config.OverflowPolicy != OverflowUnbounded {
+		go s.deliverQueued()
+	}
+
 	go func(s *subscriber, g *GoChannel) {
 		select {
 		case <-ctx.Done():
@@ -198,6 +366,7 @@ func (g *GoChannel) Subscribe(ctx context.Context, topic string) (<-chan *messag
 		defer subLock.(*sync.Mutex).Unlock()
 
 		g.removeSubscriber(topic, s)
+		s.discardQueued()
 		g.subscribersWg.Done()
 	}(s, g)
 
@@ -218,7 +387,7 @@ func (g *GoChannel) Subscribe(ctx context.Context, topic string) (<-chan *messag
 		messages, ok := g.persistedMessages[topic]
 		g.persistedMessagesLock.RUnlock()
 
-		if ok {
+		if ok && sendPersistedMessages && !g.consumerGroupSubscribed(topic, consumerGroup) {
 			for i := range messages {
 				msg := g.persistedMessages[topic][i]
 
@@ -239,6 +408,21 @@ func (g *GoChannel) addSubscriber(topic string, s *subscriber) {
 	g.subscribers[topic] = append(g.subscribers[topic], s)
 }
 
+// consumerGroupSubscribed returns true if there is already a subscriber of the topic within consumerGroup.
+func (g *GoChannel) consumerGroupSubscribed(topic string, consumerGroup string) bool {
+	if consumerGroup == "" {
+		return false
+	}
+
+	for _, s := range g.subscribers[topic] {
+		if s.consumerGroup == consumerGroup {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (g *GoChannel) removeSubscriber(topic string, toRemove *subscriber) {
 	removed := false
 	for i, sub := range g.subscribers[topic] {
@@ -251,6 +435,16 @@ func (g *GoChannel) removeSubscriber(topic string, toRemove *subscriber) {
 	if !removed {
 		panic("cannot remove subscriber, not found " + toRemove.uuid)
 	}
+
+	// releasing the topic's state, so short-lived subscriptions don't accumulate it until Close
+	if len(g.subscribers[topic]) == 0 {
+		delete(g.subscribers, topic)
+	}
+	if toRemove.consumerGroup != "" && !g.consumerGroupSubscribed(topic, toRemove.consumerGroup) {
+		g.consumerGroupsOffsetsLock.Lock()
+		delete(g.consumerGroupsOffsets, topic+"/"+toRemove.consumerGroup)
+		g.consumerGroupsOffsetsLock.Unlock()
+	}
 }
 
 func (g *GoChannel) topicSubscribers(topic string) []*subscriber {
@@ -285,11 +479,18 @@ func (g *GoChannel) Close() error {
 type subscriber struct {
 	ctx context.Context
 
-	uuid string
+	uuid          string
+	topic         string
+	consumerGroup string
+
+	simulator *deliverySimulator
 
 	sending       sync.Mutex
 	outputChannel chan *message.Message
 
+	// queue is the buffer of messages waiting for the subscriber, used with OverflowPolicy other than OverflowUnbounded
+	queue chan queuedMessage
+
 	logger  watermill.LoggerAdapter
 	closed  bool
 	closing chan struct{}
@@ -339,6 +540,16 @@ SendToSubscriber:
 			return
 		}
 
+		if !s.simulator.waitForDelivery(s.closing) {
+			s.logger.Trace("Closing, message discarded", subscriberLogFields)
+			return
+		}
+		if s.simulator.shouldDrop() {
+			s.logger.Trace("Message dropped (simulated)", subscriberLogFields)
+			return
+		}
+		s.simulator.onDeliver(s.topic, msgToSend)
+
 		select {
 		case s.outputChannel <- msgToSend:
 			s.logger.Trace("Sent message to subscriber", subscriberLogFields)
@@ -350,6 +561,11 @@ SendToSubscriber:
 		select {
 		case <-msgToSend.Acked():
 			s.logger.Trace("Message acked", subscriberLogFields)
+
+			if s.simulator.shouldRedeliver() {
+				s.logger.Trace("Redelivering acked message (simulated)", subscriberLogFields)
+				continue SendToSubscriber
+			}
 			return
 		case <-msgToSend.Nacked():
 			s.logger.Trace("Nack received, resending message", subscriberLogFields)
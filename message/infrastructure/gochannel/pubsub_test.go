@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -184,3 +185,117 @@ func testPublishSubscribeSubRace(t *testing.T) {
 		tests.AssertAllMessagesReceived(t, sentMessages, subMsgs)
 	}
 }
+
+func TestPublishSubscribe_consumer_groups(t *testing.T) {
+	messagesCount := 100
+	pubSub := gochannel.NewGoChannel(
+		gochannel.Config{OutputChannelBuffer: int64(messagesCount)},
+		watermill.NewStdLogger(true, true),
+	).(*gochannel.GoChannel)
+	topicName := "test_topic_" + watermill.NewUUID()
+
+	group1Sub1, err := pubSub.SubscribeWithConsumerGroup(context.Background(), topicName, "group_1")
+	require.NoError(t, err)
+	group1Sub2, err := pubSub.SubscribeWithConsumerGroup(context.Background(), topicName, "group_1")
+	require.NoError(t, err)
+	group2Sub, err := pubSub.SubscribeWithConsumerGroup(context.Background(), topicName, "group_2")
+	require.NoError(t, err)
+
+	sendMessages := infrastructure.AddSimpleMessages(t, messagesCount, pubSub, topicName)
+
+	group1Sub1Received, _ := subscriber.BulkRead(group1Sub1, messagesCount/2, time.Second)
+	group1Sub2Received, _ := subscriber.BulkRead(group1Sub2, messagesCount/2, time.Second)
+	group2Received, _ := subscriber.BulkRead(group2Sub, messagesCount, time.Second)
+
+	assert.Len(t, group1Sub1Received, messagesCount/2)
+	assert.Len(t, group1Sub2Received, messagesCount/2)
+	tests.AssertAllMessagesReceived(t, sendMessages, append(group1Sub1Received, group1Sub2Received...))
+	tests.AssertAllMessagesReceived(t, sendMessages, group2Received)
+
+	assert.NoError(t, pubSub.Close())
+}
+
+func TestSubscribeWithOptions_start_position(t *testing.T) {
+	messagesCount := 10
+	pubSub := gochannel.NewGoChannel(
+		gochannel.Config{Persistent: true, OutputChannelBuffer: int64(messagesCount)},
+		watermill.NewStdLogger(true, true),
+	)
+	defer func() {
+		assert.NoError(t, pubSub.Close())
+	}()
+	topicName := "test_topic_" + watermill.NewUUID()
+
+	sendMessages := infrastructure.AddSimpleMessages(t, messagesCount, pubSub, topicName)
+
+	oldestMessages, err := message.Subscribe(
+		context.Background(), pubSub, topicName,
+		message.WithStartPosition(message.StartPositionOldest),
+	)
+	require.NoError(t, err)
+	newestMessages, err := message.Subscribe(
+		context.Background(), pubSub, topicName,
+		message.WithStartPosition(message.StartPositionNewest),
+	)
+	require.NoError(t, err)
+
+	oldestReceived, all := subscriber.BulkRead(oldestMessages, messagesCount, time.Second)
+	assert.True(t, all)
+	tests.AssertAllMessagesReceived(t, sendMessages, oldestReceived)
+
+	newestReceived, _ := subscriber.BulkRead(newestMessages, 1, time.Millisecond*100)
+	assert.Empty(t, newestReceived)
+}
+
+func TestSubscribe_context_canceled(t *testing.T) {
+	for _, policy := range []gochannel.OverflowPolicy{gochannel.OverflowUnbounded, gochannel.OverflowBlock} {
+		t.Run(policy.String(), func(t *testing.T) {
+			pubSub := gochannel.NewGoChannel(
+				gochannel.Config{OutputChannelBuffer: 10, OverflowPolicy: policy},
+				watermill.NopLogger{},
+			)
+			defer func() {
+				assert.NoError(t, pubSub.Close())
+			}()
+
+			goroutinesBefore := runtime.NumGoroutine()
+
+			for i := 0; i < 10; i++ {
+				topic := "topic_" + watermill.NewShortUUID()
+
+				ctx, cancel := context.WithCancel(context.Background())
+				messages, err := pubSub.Subscribe(ctx, topic)
+				require.NoError(t, err)
+
+				// messages are left unacked and waiting in the buffer
+				infrastructure.AddSimpleMessages(t, 5, pubSub, topic)
+				<-messages
+
+				cancel()
+
+				for range messages {
+					// draining until the channel is closed
+				}
+			}
+
+			deadline := time.Now().Add(time.Second * 5)
+			for runtime.NumGoroutine() > goroutinesBefore && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond * 10)
+			}
+			assert.True(
+				t,
+				runtime.NumGoroutine() <= goroutinesBefore,
+				"goroutines of canceled subscriptions should be stopped",
+			)
+
+			// the Pub/Sub is still usable after canceling subscriptions
+			messages, err := pubSub.Subscribe(context.Background(), "topic")
+			require.NoError(t, err)
+
+			sent := infrastructure.AddSimpleMessages(t, 1, pubSub, "topic")
+			received, all := subscriber.BulkRead(messages, 1, time.Second)
+			assert.True(t, all)
+			tests.AssertAllMessagesReceived(t, sent, received)
+		})
+	}
+}
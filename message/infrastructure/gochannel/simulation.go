@@ -0,0 +1,155 @@
+package gochannel
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Clock is used by GoChannel to wait for Config.DeliveryLatency.
+// ManualClock can be used to control the time in tests.
+type Clock interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// ManualClock is a Clock which moves forward only when Advance is called.
+// It makes tests using Config.DeliveryLatency deterministic.
+type ManualClock struct {
+	now    time.Time
+	timers []manualTimer
+	lock   sync.Mutex
+}
+
+type manualTimer struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ch := make(chan time.Time, 1)
+	deadline := c.now.Add(d)
+
+	if d <= 0 {
+		ch <- deadline
+		return ch
+	}
+
+	c.timers = append(c.timers, manualTimer{deadline, ch})
+	return ch
+}
+
+// Advance moves the clock forward and fires all timers with the deadline passed.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+
+	sort.Slice(c.timers, func(i, j int) bool {
+		return c.timers[i].deadline.Before(c.timers[j].deadline)
+	})
+
+	var pending []manualTimer
+	for _, timer := range c.timers {
+		if timer.deadline.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// deliverySimulator applies the hooks and the faults from the Config to message deliveries.
+type deliverySimulator struct {
+	config Config
+
+	rand     *rand.Rand
+	randLock sync.Mutex
+}
+
+func newDeliverySimulator(config Config) *deliverySimulator {
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+	if config.RandSource == nil {
+		config.RandSource = rand.NewSource(time.Now().UnixNano())
+	}
+
+	return &deliverySimulator{
+		config: config,
+		rand:   rand.New(config.RandSource),
+	}
+}
+
+func (d *deliverySimulator) onPublish(topic string, msg *message.Message) {
+	if d.config.OnPublish != nil {
+		d.config.OnPublish(topic, msg)
+	}
+}
+
+func (d *deliverySimulator) onDeliver(topic string, msg *message.Message) {
+	if d.config.OnDeliver != nil {
+		d.config.OnDeliver(topic, msg)
+	}
+}
+
+// waitForDelivery waits for the DeliveryLatency. It returns false, when closing was closed before.
+func (d *deliverySimulator) waitForDelivery(closing chan struct{}) bool {
+	if d.config.DeliveryLatency <= 0 {
+		return true
+	}
+
+	select {
+	case <-d.config.Clock.After(d.config.DeliveryLatency):
+		return true
+	case <-closing:
+		return false
+	}
+}
+
+func (d *deliverySimulator) shouldDrop() bool {
+	return d.chance(d.config.DropRate)
+}
+
+func (d *deliverySimulator) shouldRedeliver() bool {
+	return d.chance(d.config.RedeliveryRate)
+}
+
+func (d *deliverySimulator) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+
+	d.randLock.Lock()
+	defer d.randLock.Unlock()
+
+	return d.rand.Float64() < rate
+}
@@ -0,0 +1,96 @@
+package gochannel_test
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+	"github.com/ThreeDotsLabs/watermill/message/subscriber"
+)
+
+func TestGoChannel_hooks(t *testing.T) {
+	lock := sync.Mutex{}
+	var published, delivered []string
+
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		OnPublish: func(topic string, msg *message.Message) {
+			lock.Lock()
+			defer lock.Unlock()
+			published = append(published, topic+"/"+msg.UUID)
+		},
+		OnDeliver: func(topic string, msg *message.Message) {
+			lock.Lock()
+			defer lock.Unlock()
+			delivered = append(delivered, topic+"/"+msg.UUID)
+		},
+	}, watermill.NewStdLogger(true, true))
+	defer func() {
+		assert.NoError(t, pubSub.Close())
+	}()
+
+	messages, err := pubSub.Subscribe(context.Background(), "topic")
+	require.NoError(t, err)
+
+	require.NoError(t, pubSub.Publish("topic", message.NewMessage("1", nil)))
+
+	received, all := subscriber.BulkRead(messages, 1, time.Second)
+	require.True(t, all)
+	received[0].Ack()
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"topic/1"}, published)
+	assert.Equal(t, []string{"topic/1"}, delivered)
+}
+
+func TestGoChannel_DropRate(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		DropRate:   1,
+		RandSource: rand.NewSource(1),
+	}, watermill.NewStdLogger(true, true))
+	defer func() {
+		assert.NoError(t, pubSub.Close())
+	}()
+
+	messages, err := pubSub.Subscribe(context.Background(), "topic")
+	require.NoError(t, err)
+
+	require.NoError(t, pubSub.Publish("topic", message.NewMessage("1", nil)))
+
+	received, _ := subscriber.BulkRead(messages, 1, time.Millisecond*100)
+	assert.Empty(t, received)
+}
+
+func TestGoChannel_DeliveryLatency(t *testing.T) {
+	clock := gochannel.NewManualClock(time.Now())
+
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		DeliveryLatency: time.Minute,
+		Clock:           clock,
+	}, watermill.NewStdLogger(true, true))
+	defer func() {
+		assert.NoError(t, pubSub.Close())
+	}()
+
+	messages, err := pubSub.Subscribe(context.Background(), "topic")
+	require.NoError(t, err)
+
+	require.NoError(t, pubSub.Publish("topic", message.NewMessage("1", nil)))
+
+	received, _ := subscriber.BulkRead(messages, 1, time.Millisecond*100)
+	assert.Empty(t, received)
+
+	clock.Advance(time.Minute)
+
+	received, all := subscriber.BulkRead(messages, 1, time.Second)
+	assert.True(t, all)
+	received[0].Ack()
+}
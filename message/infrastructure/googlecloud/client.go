@@ -0,0 +1,85 @@
+package googlecloud
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// ClientConfig contains settings of the connection to Google Cloud Pub/Sub, common for Publisher and Subscriber.
+type ClientConfig struct {
+	// Endpoint is the address of the Pub/Sub service, for example "us-east1-pubsub.googleapis.com:443".
+	// It allows to pin the client to a region, instead of the global endpoint.
+	Endpoint string
+
+	// Region is a shortcut for the regional Endpoint, for example "us-east1".
+	// Only one of Endpoint and Region can be set.
+	Region string
+
+	// KeepaliveTime is the interval of gRPC keepalive pings, sent when the connection is idle.
+	// When 0, keepalive pings are not sent.
+	KeepaliveTime time.Duration
+
+	// KeepaliveTimeout is the time after which the connection is closed, when the keepalive ping is not acknowledged.
+	KeepaliveTimeout time.Duration
+
+	// CallTimeout is the timeout of a single call to Pub/Sub, like checking if the topic exists, creating
+	// the subscription or publishing the message. When 0, calls are limited only by the context.
+	CallTimeout time.Duration
+}
+
+func (c ClientConfig) Validate() error {
+	if c.Endpoint != "" && c.Region != "" {
+		return errors.New("only one of Endpoint and Region can be set")
+	}
+	if c.KeepaliveTime < 0 || c.KeepaliveTimeout < 0 {
+		return errors.New("keepalive durations cannot be negative")
+	}
+	if c.CallTimeout < 0 {
+		return errors.New("CallTimeout cannot be negative")
+	}
+
+	return nil
+}
+
+// RegionalEndpoint returns the address of the Pub/Sub endpoint in the region.
+func RegionalEndpoint(region string) string {
+	return fmt.Sprintf("%s-pubsub.googleapis.com:443", region)
+}
+
+// clientOptions returns the client options for the config.
+// The endpoint is not set, when the client connects to the emulator.
+func (c ClientConfig) clientOptions(emulator bool) []option.ClientOption {
+	var opts []option.ClientOption
+
+	if !emulator {
+		if c.Endpoint != "" {
+			opts = append(opts, option.WithEndpoint(c.Endpoint))
+		} else if c.Region != "" {
+			opts = append(opts, option.WithEndpoint(RegionalEndpoint(c.Region)))
+		}
+	}
+
+	if c.KeepaliveTime > 0 {
+		opts = append(opts, option.WithGRPCDialOption(grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    c.KeepaliveTime,
+			Timeout: c.KeepaliveTimeout,
+		})))
+	}
+
+	return opts
+}
+
+// callContext returns the context of a single call, limited by CallTimeout.
+func (c ClientConfig) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.CallTimeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, c.CallTimeout)
+}
@@ -0,0 +1,115 @@
+package googlecloud
+
+import (
+	"context"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+
+	internalSync "github.com/ThreeDotsLabs/watermill/internal/sync"
+)
+
+type ClientPoolConfig struct {
+	// ProjectID is the Google Cloud Engine project ID.
+	ProjectID string
+
+	// Client contains settings of the connection, like the regional endpoint and keepalive.
+	Client        ClientConfig
+	ClientOptions []option.ClientOption
+
+	// EmulatorHost is the address of the Pub/Sub emulator, for example DefaultEmulatorHost.
+	// When empty, the PUBSUB_EMULATOR_HOST env is respected by the client library.
+	EmulatorHost string
+
+	// If true, the pool fails with `ErrEmulatorRequired` when neither EmulatorHost
+	// nor the PUBSUB_EMULATOR_HOST env is set.
+	RequireEmulator bool
+}
+
+// ClientPool shares a single Pub/Sub client between Publishers and Subscribers of the process,
+// so the number of connections doesn't grow with the number of handlers.
+//
+// The client is created, when the first Publisher or Subscriber is created with the pool
+// and it's closed, when all of them are closed.
+type ClientPool struct {
+	config ClientPoolConfig
+	client *internalSync.RefCounted
+}
+
+// NewClientPool creates a new ClientPool.
+//
+// The client is created lazily and created again after all users released it, so it's not bound to ctx.
+func NewClientPool(ctx context.Context, config ClientPoolConfig) (*ClientPool, error) {
+	opts, err := clientOptions(config.EmulatorHost, config.RequireEmulator, config.Client, config.ClientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientPool{
+		config: config,
+		client: internalSync.NewRefCounted(
+			func() (interface{}, error) {
+				// ctx of NewClientPool may be already done, when the client is created again
+				return pubsub.NewClient(context.Background(), config.ProjectID, opts...)
+			},
+			func(client interface{}) error {
+				return client.(*pubsub.Client).Close()
+			},
+		),
+	}, nil
+}
+
+// ProjectID returns the project of the shared client.
+func (p *ClientPool) ProjectID() string {
+	return p.config.ProjectID
+}
+
+func (p *ClientPool) acquire() (*pubsub.Client, error) {
+	client, err := p.client.Acquire()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create shared Pub/Sub client")
+	}
+
+	return client.(*pubsub.Client), nil
+}
+
+func (p *ClientPool) release() error {
+	return p.client.Release()
+}
+
+// newClient returns the client from the pool, when it's set, or a new client. The returned function closes
+// the client or releases it to the pool.
+func newClient(
+	ctx context.Context,
+	pool *ClientPool,
+	projectID string,
+	opts func() ([]option.ClientOption, error),
+) (*pubsub.Client, func() error, error) {
+	if pool != nil {
+		if projectID != pool.ProjectID() {
+			return nil, nil, errors.Errorf(
+				"ProjectID %s is different than ProjectID %s of the ClientPool", projectID, pool.ProjectID(),
+			)
+		}
+
+		client, err := pool.acquire()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return client, pool.release, nil
+	}
+
+	options, err := opts()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := pubsub.NewClient(ctx, projectID, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, client.Close, nil
+}
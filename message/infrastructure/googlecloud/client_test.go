@@ -0,0 +1,62 @@
+package googlecloud_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/googlecloud"
+)
+
+func TestClientConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config googlecloud.ClientConfig
+		Valid  bool
+	}{
+		{
+			Name:   "empty",
+			Config: googlecloud.ClientConfig{},
+			Valid:  true,
+		},
+		{
+			Name: "regional",
+			Config: googlecloud.ClientConfig{
+				Region:           "us-east1",
+				KeepaliveTime:    time.Second * 30,
+				KeepaliveTimeout: time.Second * 10,
+				CallTimeout:      time.Second * 5,
+			},
+			Valid: true,
+		},
+		{
+			Name: "endpoint_and_region",
+			Config: googlecloud.ClientConfig{
+				Endpoint: googlecloud.RegionalEndpoint("us-east1"),
+				Region:   "us-east1",
+			},
+			Valid: false,
+		},
+		{
+			Name:   "negative_call_timeout",
+			Config: googlecloud.ClientConfig{CallTimeout: -time.Second},
+			Valid:  false,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := c.Config.Validate()
+			if c.Valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestRegionalEndpoint(t *testing.T) {
+	assert.Equal(t, "us-east1-pubsub.googleapis.com:443", googlecloud.RegionalEndpoint("us-east1"))
+}
@@ -0,0 +1,129 @@
+package googlecloud
+
+import (
+	"context"
+	"os"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+const (
+	// EmulatorHostEnv is the environment variable which points the client library to the Pub/Sub emulator.
+	EmulatorHostEnv = "PUBSUB_EMULATOR_HOST"
+
+	// DefaultEmulatorHost is the address of the emulator started by Watermill's docker-compose.yml.
+	DefaultEmulatorHost = "localhost:8085"
+)
+
+// ErrEmulatorRequired happens when the emulator is required by the config, but no emulator host is configured.
+var ErrEmulatorRequired = errors.New("Pub/Sub emulator is required, but no emulator host is configured")
+
+// EmulatorHost returns the emulator address from the PUBSUB_EMULATOR_HOST env.
+// It returns an empty string when the env is not set, which means that the real Google Cloud Pub/Sub is used.
+func EmulatorHost() string {
+	return os.Getenv(EmulatorHostEnv)
+}
+
+// resolveEmulatorHost returns the configured emulator host, falling back to the PUBSUB_EMULATOR_HOST env.
+func resolveEmulatorHost(configuredHost string) string {
+	if configuredHost != "" {
+		return configuredHost
+	}
+
+	return EmulatorHost()
+}
+
+// EmulatorClientOptions returns client options which connect the client to the emulator at the provided host,
+// without the need of setting the PUBSUB_EMULATOR_HOST env.
+func EmulatorClientOptions(host string) []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(host),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+	}
+}
+
+// clientOptions returns options for the client, taking the emulator config and the client config into account.
+// opts are applied last, so they override the options from the configs.
+func clientOptions(
+	emulatorHost string,
+	requireEmulator bool,
+	clientConfig ClientConfig,
+	opts []option.ClientOption,
+) ([]option.ClientOption, error) {
+	if err := clientConfig.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid client config")
+	}
+
+	emulator := resolveEmulatorHost(emulatorHost) != ""
+	opts = append(clientConfig.clientOptions(emulator), opts...)
+
+	if emulatorHost != "" {
+		return append(EmulatorClientOptions(emulatorHost), opts...), nil
+	}
+
+	if requireEmulator && !emulator {
+		return nil, ErrEmulatorRequired
+	}
+
+	// the client library connects to the emulator itself, when PUBSUB_EMULATOR_HOST is set
+	return opts, nil
+}
+
+// ResetEmulator deletes all subscriptions and topics of the project in the emulator.
+// It is useful to start every test with a clean emulator state.
+//
+// When host is empty, the PUBSUB_EMULATOR_HOST env is used.
+// ResetEmulator refuses to work without an emulator host, so it won't ever delete anything in the real Google Cloud.
+func ResetEmulator(ctx context.Context, host string, projectID string) (err error) {
+	host = resolveEmulatorHost(host)
+	if host == "" {
+		return ErrEmulatorRequired
+	}
+
+	client, err := pubsub.NewClient(ctx, projectID, EmulatorClientOptions(host)...)
+	if err != nil {
+		return errors.Wrap(err, "cannot create client")
+	}
+	defer func() {
+		if closeErr := client.Close(); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "cannot close client")
+		}
+	}()
+
+	subscriptions := client.Subscriptions(ctx)
+	for {
+		sub, err := subscriptions.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot list subscriptions")
+		}
+
+		if err := sub.Delete(ctx); err != nil {
+			return errors.Wrapf(err, "cannot delete subscription %s", sub.ID())
+		}
+	}
+
+	topics := client.Topics(ctx)
+	for {
+		t, err := topics.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot list topics")
+		}
+
+		if err := t.Delete(ctx); err != nil {
+			return errors.Wrapf(err, "cannot delete topic %s", t.ID())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package googlecloud_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/googlecloud"
+)
+
+func TestRequireEmulator_no_emulator_host(t *testing.T) {
+	emulatorHost := os.Getenv(googlecloud.EmulatorHostEnv)
+	defer os.Setenv(googlecloud.EmulatorHostEnv, emulatorHost)
+	os.Unsetenv(googlecloud.EmulatorHostEnv)
+
+	_, err := googlecloud.NewPublisher(context.Background(), googlecloud.PublisherConfig{
+		RequireEmulator: true,
+	})
+	assert.Equal(t, googlecloud.ErrEmulatorRequired, err)
+
+	_, err = googlecloud.NewSubscriber(context.Background(), googlecloud.SubscriberConfig{
+		RequireEmulator: true,
+	}, watermill.NopLogger{})
+	assert.Equal(t, googlecloud.ErrEmulatorRequired, err)
+
+	err = googlecloud.ResetEmulator(context.Background(), "", "project")
+	assert.Equal(t, googlecloud.ErrEmulatorRequired, err)
+}
@@ -1,10 +1,16 @@
 package googlecloud
 
 import (
+	"encoding/json"
+	"sort"
+	"strings"
+
 	"cloud.google.com/go/pubsub"
 	"github.com/pkg/errors"
 
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/cloudevents"
 )
 
 // Marshaler transforms a Waterfall Message into the Google Cloud client library Message.
@@ -20,10 +26,34 @@ type Unmarshaler interface {
 // UUIDHeaderKey is the key of the Pub/Sub attribute that carries Waterfall UUID.
 const UUIDHeaderKey = "_watermill_message_uuid"
 
+// MetadataEnvelopeHeaderKey is the key of the Pub/Sub attribute which marks,
+// that the message's data is an envelope (message.Envelope) with the metadata which doesn't fit in attributes.
+const MetadataEnvelopeHeaderKey = "_watermill_metadata_envelope"
+
+// Limits of Google Cloud Pub/Sub attributes, see https://cloud.google.com/pubsub/quotas#resource_limits.
+const (
+	maxAttributes          = 100
+	maxAttributeKeyBytes   = 256
+	maxAttributeValueBytes = 1024
+
+	// reservedAttributePrefix is the prefix of attribute keys reserved by Google
+	reservedAttributePrefix = "goog"
+)
+
 // DefaultMarshalerUnmarshaler implements Marshaler and Unmarshaler in the following way:
 // All Google Cloud Pub/Sub attributes are equivalent to Waterfall Message metadata.
 // Waterfall Message UUID is equivalent to an attribute with `UUIDHeaderKey` as key.
-type DefaultMarshalerUnmarshaler struct{}
+// Messages without this attribute get the UUID generated with watermill.NewMessageUUID.
+//
+// Metadata which cannot be stored in attributes (because of the Pub/Sub limits of attributes count and size,
+// or a reserved key) or is not listed in AttributeKeys is stored with the payload in an envelope
+// in the message's data, and it's transparently restored by Unmarshal.
+type DefaultMarshalerUnmarshaler struct {
+	// AttributeKeys are the metadata keys stored in attributes, for example to use them in subscription filters.
+	// The rest of metadata is stored in the message's data.
+	// When empty, all metadata is stored in attributes, as long as it fits within the limits.
+	AttributeKeys []string
+}
 
 type MarshalerUnmarshaler interface {
 	Marshaler
@@ -38,9 +68,24 @@ func (m DefaultMarshalerUnmarshaler) Marshal(topic string, msg *message.Message)
 	attributes := map[string]string{
 		UUIDHeaderKey: msg.UUID,
 	}
+	overflow := message.Metadata{}
 
-	for k, v := range msg.Metadata {
-		attributes[k] = v
+	// keys are sorted, so the same metadata is always stored in attributes, when the count limit is exceeded
+	keys := make([]string, 0, len(msg.Metadata))
+	for k := range msg.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := msg.Metadata[k]
+
+		// one attribute is left for MetadataEnvelopeHeaderKey
+		if m.inAttributes(k) && fitsInAttribute(k, v) && len(attributes) < maxAttributes-1 {
+			attributes[k] = v
+		} else {
+			overflow[k] = v
+		}
 	}
 
 	marshaledMsg := &pubsub.Message{
@@ -48,25 +93,135 @@ func (m DefaultMarshalerUnmarshaler) Marshal(topic string, msg *message.Message)
 		Attributes: attributes,
 	}
 
+	if len(overflow) > 0 {
+		data, err := json.Marshal(message.Envelope{
+			FormatVersion: message.EnvelopeFormatVersion,
+			UUID:          msg.UUID,
+			Metadata:      overflow,
+			Payload:       msg.Payload,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot marshal metadata envelope")
+		}
+
+		marshaledMsg.Data = data
+		attributes[MetadataEnvelopeHeaderKey] = "1"
+	}
+
 	return marshaledMsg, nil
 }
 
+func (m DefaultMarshalerUnmarshaler) inAttributes(key string) bool {
+	if len(m.AttributeKeys) == 0 {
+		return true
+	}
+
+	for _, k := range m.AttributeKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fitsInAttribute(key string, value string) bool {
+	return key != "" &&
+		!strings.HasPrefix(key, reservedAttributePrefix) &&
+		key != MetadataEnvelopeHeaderKey &&
+		len(key) <= maxAttributeKeyBytes &&
+		len(value) <= maxAttributeValueBytes
+}
+
 func (u DefaultMarshalerUnmarshaler) Unmarshal(pubsubMsg *pubsub.Message) (*message.Message, error) {
 	metadata := make(message.Metadata, len(pubsubMsg.Attributes))
 
 	var id string
 	for k, attr := range pubsubMsg.Attributes {
-		if k == UUIDHeaderKey {
+		switch k {
+		case UUIDHeaderKey:
 			id = attr
-			continue
+		case MetadataEnvelopeHeaderKey:
+			// it's not a part of metadata
+		default:
+			metadata.Set(k, attr)
+		}
+	}
+
+	payload := pubsubMsg.Data
+
+	if pubsubMsg.Attributes[MetadataEnvelopeHeaderKey] != "" {
+		var envelope message.Envelope
+		if err := json.Unmarshal(pubsubMsg.Data, &envelope); err != nil {
+			return nil, errors.Wrap(err, "cannot unmarshal metadata envelope")
+		}
+		if envelope.FormatVersion != message.EnvelopeFormatVersion {
+			return nil, errors.Wrapf(message.ErrUnsupportedEnvelopeFormat, "version %d", envelope.FormatVersion)
+		}
+
+		for k, v := range envelope.Metadata {
+			metadata.Set(k, v)
 		}
-		metadata.Set(k, attr)
+		payload = envelope.Payload
 	}
 
 	metadata.Set("publishTime", pubsubMsg.PublishTime.String())
 
-	msg := message.NewMessage(id, pubsubMsg.Data)
+	if id == "" {
+		// the message wasn't published by Watermill
+		id = watermill.NewMessageUUID()
+	}
+
+	msg := message.NewMessage(id, payload)
 	msg.Metadata = metadata
 
 	return msg, nil
 }
+
+// EnvelopeMarshalerUnmarshaler marshals messages to versioned envelopes (message.EnvelopeCodec)
+// stored in the Google Cloud Pub/Sub message's data.
+type EnvelopeMarshalerUnmarshaler struct {
+	Codec message.EnvelopeCodec
+}
+
+func (m EnvelopeMarshalerUnmarshaler) Marshal(topic string, msg *message.Message) (*pubsub.Message, error) {
+	envelope, err := m.Codec.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pubsub.Message{Data: envelope}, nil
+}
+
+func (m EnvelopeMarshalerUnmarshaler) Unmarshal(pubsubMsg *pubsub.Message) (*message.Message, error) {
+	msg, err := m.Codec.Unmarshal(pubsubMsg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Metadata.Set("publishTime", pubsubMsg.PublishTime.String())
+
+	return msg, nil
+}
+
+// CloudEventsMarshalerUnmarshaler marshals messages to CloudEvents in the structured content mode (cloudevents.Codec),
+// stored in the Google Cloud Pub/Sub message's data.
+type CloudEventsMarshalerUnmarshaler struct {
+	Codec cloudevents.Codec
+}
+
+func (m CloudEventsMarshalerUnmarshaler) Marshal(topic string, msg *message.Message) (*pubsub.Message, error) {
+	event, err := m.Codec.Marshal(topic, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pubsub.Message{
+		Data:       event,
+		Attributes: map[string]string{"content-type": cloudevents.ContentType},
+	}, nil
+}
+
+func (m CloudEventsMarshalerUnmarshaler) Unmarshal(pubsubMsg *pubsub.Message) (*message.Message, error) {
+	return m.Codec.Unmarshal(pubsubMsg.Data)
+}
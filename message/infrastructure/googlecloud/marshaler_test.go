@@ -0,0 +1,89 @@
+package googlecloud_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/googlecloud"
+)
+
+func TestDefaultMarshalerUnmarshaler(t *testing.T) {
+	m := googlecloud.DefaultMarshalerUnmarshaler{}
+
+	msg := message.NewMessage("uuid", []byte("payload"))
+	msg.Metadata.Set("foo", "bar")
+
+	pubsubMsg, err := m.Marshal("topic", msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("payload"), pubsubMsg.Data)
+	assert.Equal(t, map[string]string{"foo": "bar", googlecloud.UUIDHeaderKey: "uuid"}, pubsubMsg.Attributes)
+
+	unmarshaled, err := m.Unmarshal(pubsubMsg)
+	require.NoError(t, err)
+
+	delete(unmarshaled.Metadata, "publishTime")
+	assert.True(t, msg.Equals(unmarshaled))
+}
+
+func TestDefaultMarshalerUnmarshaler_metadata_overflow(t *testing.T) {
+	m := googlecloud.DefaultMarshalerUnmarshaler{}
+
+	msg := message.NewMessage("uuid", []byte("payload"))
+	msg.Metadata.Set("googReserved", "1")
+	msg.Metadata.Set("large_value", strings.Repeat("a", 2048))
+	for i := 0; i < 150; i++ {
+		msg.Metadata.Set(fmt.Sprintf("key_%03d", i), "value")
+	}
+
+	pubsubMsg, err := m.Marshal("topic", msg)
+	require.NoError(t, err)
+
+	assert.True(t, len(pubsubMsg.Attributes) <= 100)
+	assert.NotContains(t, pubsubMsg.Attributes, "googReserved")
+	assert.NotContains(t, pubsubMsg.Attributes, "large_value")
+	assert.Equal(t, "value", pubsubMsg.Attributes["key_000"])
+
+	unmarshaled, err := m.Unmarshal(pubsubMsg)
+	require.NoError(t, err)
+
+	delete(unmarshaled.Metadata, "publishTime")
+	assert.True(t, msg.Equals(unmarshaled))
+}
+
+func TestDefaultMarshalerUnmarshaler_AttributeKeys(t *testing.T) {
+	m := googlecloud.DefaultMarshalerUnmarshaler{AttributeKeys: []string{"event_type"}}
+
+	msg := message.NewMessage("uuid", []byte("payload"))
+	msg.Metadata.Set("event_type", "created")
+	msg.Metadata.Set("correlation_id", "1")
+
+	pubsubMsg, err := m.Marshal("topic", msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "created", pubsubMsg.Attributes["event_type"])
+	assert.NotContains(t, pubsubMsg.Attributes, "correlation_id")
+
+	unmarshaled, err := m.Unmarshal(pubsubMsg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "1", unmarshaled.Metadata.Get("correlation_id"))
+	assert.Equal(t, []byte("payload"), []byte(unmarshaled.Payload))
+}
+
+func TestDefaultMarshalerUnmarshaler_Unmarshal_generates_missing_uuid(t *testing.T) {
+	defer watermill.SetMessageUUIDGenerator(watermill.NewUUID)
+	watermill.SetMessageUUIDGenerator(watermill.NewSequentialUUIDGenerator("pubsub"))
+
+	unmarshaled, err := googlecloud.DefaultMarshalerUnmarshaler{}.Unmarshal(&pubsub.Message{Data: []byte("payload")})
+	require.NoError(t, err)
+
+	assert.Equal(t, "pubsub-00000000000000000001", unmarshaled.UUID)
+}
@@ -0,0 +1,47 @@
+package googlecloud
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// TopicProjectFn returns the project of the topic, which is not in the projects/<project>/topics/<topic> format.
+// When it returns an empty string, the topic belongs to the project of the Publisher or Subscriber (ProjectID).
+type TopicProjectFn func(topic string) string
+
+// FullyQualifiedTopic returns the name of the topic in another project, which can be passed to Publish and Subscribe.
+func FullyQualifiedTopic(projectID, topic string) string {
+	return fmt.Sprintf("projects/%s/topics/%s", projectID, topic)
+}
+
+// splitTopic returns the project and the ID of the topic.
+// The project is empty, when the topic belongs to the project of the client.
+func splitTopic(topic string, topicProject TopicProjectFn) (projectID string, topicID string) {
+	parts := strings.Split(topic, "/")
+	if len(parts) == 4 && parts[0] == "projects" && parts[2] == "topics" && parts[1] != "" && parts[3] != "" {
+		return parts[1], parts[3]
+	}
+
+	if topicProject != nil {
+		return topicProject(topic), topic
+	}
+
+	return "", topic
+}
+
+// clientTopic returns the topic of the project, or of the client's project when projectID is empty.
+func clientTopic(client *pubsub.Client, projectID string, topicID string) *pubsub.Topic {
+	if projectID == "" {
+		return client.Topic(topicID)
+	}
+
+	return client.TopicInProject(topicID, projectID)
+}
+
+// isOtherProject returns true, when the topic's project is not the client's project.
+// Topics of other projects are never created.
+func isOtherProject(projectID string, clientProjectID string) bool {
+	return projectID != "" && projectID != clientProjectID
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	"google.golang.org/api/option"
 
+	"github.com/ThreeDotsLabs/watermill/backoff"
 	"github.com/ThreeDotsLabs/watermill/message"
 )
 
@@ -25,8 +26,9 @@ type Publisher struct {
 	topicsLock sync.RWMutex
 	closed     bool
 
-	client *pubsub.Client
-	config PublisherConfig
+	client      *pubsub.Client
+	closeClient func() error
+	config      PublisherConfig
 }
 
 type PublisherConfig struct {
@@ -37,17 +39,78 @@ type PublisherConfig struct {
 	// Otherwise, trying to subscribe to non-existent subscription results in `ErrTopicDoesNotExist`.
 	DoNotCreateTopicIfMissing bool
 
+	// If true, `Publisher` doesn't check if the topic exists, so the Exists call is not made before the first publish.
+	// It lowers the latency of the first publish and doesn't require the pubsub.topics.get permission.
+	// Topics are never created and publishing to a non-existent topic fails with the NotFound error.
+	DoNotCheckTopicExistence bool
+
 	// Settings for cloud.google.com/go/pubsub client library.
 	PublishSettings *pubsub.PublishSettings
 	ClientOptions   []option.ClientOption
 
+	// Client contains settings of the connection, like the regional endpoint, keepalive and timeouts of calls.
+	// ClientOptions are applied after them, so they can override these settings.
+	Client ClientConfig
+
+	// ClientPool is optional. When set, the Publisher uses the client shared by the pool,
+	// instead of creating its own, and ClientOptions, EmulatorHost and RequireEmulator are ignored.
+	// CallTimeout of Client is still respected. ProjectID defaults to the project of the pool.
+	ClientPool *ClientPool
+
+	// PublishBackoff is the strategy of retries, when publishing of the message fails with a transient error
+	// (see IsRetryableError). The client library retries on its own as well, so it's optional.
+	PublishBackoff backoff.Strategy
+
+	// Topics contains per-topic settings, which override the global settings.
+	Topics map[string]TopicConfig
+
+	// TopicConfigFunc returns settings of topics which are not present in Topics.
+	// It is optional.
+	TopicConfigFunc func(topic string) TopicConfig
+
+	// TopicProject is optional and returns the project of the topic, so one Publisher can publish
+	// to topics of many projects. Topics can also be passed in the projects/<project>/topics/<topic> format
+	// (see FullyQualifiedTopic). Topics of projects other than ProjectID are never created.
+	TopicProject TopicProjectFn
+
+	// EmulatorHost is the address of the Pub/Sub emulator, for example DefaultEmulatorHost.
+	// When empty, the PUBSUB_EMULATOR_HOST env is respected by the client library.
+	EmulatorHost string
+
+	// If true, `NewPublisher` fails with `ErrEmulatorRequired` when neither EmulatorHost
+	// nor the PUBSUB_EMULATOR_HOST env is set. Use it in tests to never talk to the real Google Cloud.
+	RequireEmulator bool
+
 	Marshaler Marshaler
 }
 
+// TopicConfig contains settings of a single topic.
+type TopicConfig struct {
+	// PublishSettings overrides PublisherConfig.PublishSettings for the topic.
+	PublishSettings *pubsub.PublishSettings
+
+	// Labels are set on the topic, when it is created by the Publisher.
+	Labels map[string]string
+}
+
+func (c PublisherConfig) topicConfig(topic string) TopicConfig {
+	if topicConfig, ok := c.Topics[topic]; ok {
+		return topicConfig
+	}
+	if c.TopicConfigFunc != nil {
+		return c.TopicConfigFunc(topic)
+	}
+
+	return TopicConfig{}
+}
+
 func (c *PublisherConfig) setDefaults() {
 	if c.Marshaler == nil {
 		c.Marshaler = DefaultMarshalerUnmarshaler{}
 	}
+	if c.ClientPool != nil && c.ProjectID == "" {
+		c.ProjectID = c.ClientPool.ProjectID()
+	}
 }
 
 func NewPublisher(ctx context.Context, config PublisherConfig) (*Publisher, error) {
@@ -60,7 +123,9 @@ func NewPublisher(ctx context.Context, config PublisherConfig) (*Publisher, erro
 	}
 
 	var err error
-	pub.client, err = pubsub.NewClient(ctx, config.ProjectID, config.ClientOptions...)
+	pub.client, pub.closeClient, err = newClient(ctx, config.ClientPool, config.ProjectID, func() ([]option.ClientOption, error) {
+		return clientOptions(config.EmulatorHost, config.RequireEmulator, config.Client, config.ClientOptions)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -76,33 +141,69 @@ func NewPublisher(ctx context.Context, config PublisherConfig) (*Publisher, erro
 //
 // See https://cloud.google.com/pubsub/docs/publisher to find out more about how Google Cloud Pub/Sub Publishers work.
 func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	_, err := p.PublishWithResults(topic, messages...)
+	return err
+}
+
+// PublishWithResults works like Publish, but it returns the server-assigned ID of every published message
+// as the BrokerMessageID.
+func (p *Publisher) PublishWithResults(topic string, messages ...*message.Message) ([]message.PublishResult, error) {
 	if p.closed {
-		return ErrPublisherClosed
+		return nil, ErrPublisherClosed
 	}
 
 	ctx := p.ctx
 
 	t, err := p.topic(ctx, topic)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	results := make([]message.PublishResult, 0, len(messages))
+
 	for _, msg := range messages {
 		googlecloudMsg, err := p.config.Marshaler.Marshal(topic, msg)
 		if err != nil {
-			return errors.Wrapf(err, "cannot marshal message %s", msg.UUID)
+			return results, errors.Wrapf(err, "cannot marshal message %s", msg.UUID)
 		}
 
-		result := t.Publish(ctx, googlecloudMsg)
-		<-result.Ready()
-
-		_, err = result.Get(ctx)
+		serverID, err := p.publish(ctx, t, googlecloudMsg)
 		if err != nil {
-			return errors.Wrapf(err, "publishing message %s failed", msg.UUID)
+			return results, errors.Wrapf(err, "publishing message %s failed", msg.UUID)
+		}
+
+		results = append(results, message.PublishResult{
+			MessageUUID:     msg.UUID,
+			BrokerMessageID: serverID,
+		})
+	}
+
+	return results, nil
+}
+
+// publish publishes the message, retrying transient errors according to PublishBackoff.
+func (p *Publisher) publish(ctx context.Context, t *pubsub.Topic, googlecloudMsg *pubsub.Message) (string, error) {
+	for attempt := 1; ; attempt++ {
+		serverID, err := p.publishAttempt(ctx, t, googlecloudMsg)
+		if err == nil || p.config.PublishBackoff == nil || !IsRetryableError(err) {
+			return serverID, err
+		}
+
+		retrying, waitErr := backoff.Wait(ctx, p.config.PublishBackoff, attempt)
+		if !retrying || waitErr != nil {
+			return "", err
 		}
 	}
+}
+
+func (p *Publisher) publishAttempt(ctx context.Context, t *pubsub.Topic, googlecloudMsg *pubsub.Message) (string, error) {
+	ctx, cancel := p.config.Client.callContext(ctx)
+	defer cancel()
 
-	return nil
+	result := t.Publish(ctx, googlecloudMsg)
+	<-result.Ready()
+
+	return result.Get(ctx)
 }
 
 // Close notifies the Publisher to stop processing messages, send all the remaining messages and close the connection.
@@ -119,7 +220,7 @@ func (p *Publisher) Close() error {
 	}
 	p.topicsLock.Unlock()
 
-	return p.client.Close()
+	return p.closeClient()
 }
 
 func (p *Publisher) topic(ctx context.Context, topic string) (t *pubsub.Topic, err error) {
@@ -138,12 +239,17 @@ func (p *Publisher) topic(ctx context.Context, topic string) (t *pubsub.Topic, e
 		p.topicsLock.Unlock()
 	}()
 
-	t = p.client.Topic(topic)
+	topicConfig := p.config.topicConfig(topic)
 
-	// todo: theoretically, one could want different publish settings per topic, which is supported by the client lib
-	// different instances of publisher may be used then
-	if p.config.PublishSettings != nil {
-		t.PublishSettings = *p.config.PublishSettings
+	ctx, cancel := p.config.Client.callContext(ctx)
+	defer cancel()
+
+	projectID, topicID := splitTopic(topic, p.config.TopicProject)
+	t = clientTopic(p.client, projectID, topicID)
+
+	if p.config.DoNotCheckTopicExistence {
+		p.applyPublishSettings(t, topicConfig)
+		return t, nil
 	}
 
 	exists, err := t.Exists(ctx)
@@ -151,18 +257,42 @@ func (p *Publisher) topic(ctx context.Context, topic string) (t *pubsub.Topic, e
 		return nil, errors.Wrapf(err, "could not check if topic %s exists", topic)
 	}
 
-	if exists {
-		return t, nil
+	if !exists {
+		if p.config.DoNotCreateTopicIfMissing || isOtherProject(projectID, p.config.ProjectID) {
+			return nil, errors.Wrap(ErrTopicDoesNotExist, topic)
+		}
+
+		t, err = p.createTopic(ctx, topicID, topicConfig)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if p.config.DoNotCreateTopicIfMissing {
-		return nil, errors.Wrap(ErrTopicDoesNotExist, topic)
+	p.applyPublishSettings(t, topicConfig)
+
+	return t, nil
+}
+
+func (p *Publisher) applyPublishSettings(t *pubsub.Topic, topicConfig TopicConfig) {
+	if topicConfig.PublishSettings != nil {
+		t.PublishSettings = *topicConfig.PublishSettings
+	} else if p.config.PublishSettings != nil {
+		t.PublishSettings = *p.config.PublishSettings
 	}
+}
 
-	t, err = p.client.CreateTopic(ctx, topic)
+func (p *Publisher) createTopic(ctx context.Context, topic string, topicConfig TopicConfig) (*pubsub.Topic, error) {
+	t, err := p.client.CreateTopic(ctx, topic)
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not create topic %s", topic)
 	}
 
+	if len(topicConfig.Labels) > 0 {
+		_, err := t.Update(ctx, pubsub.TopicConfigToUpdate{Labels: topicConfig.Labels})
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not set labels of topic %s", topic)
+		}
+	}
+
 	return t, nil
 }
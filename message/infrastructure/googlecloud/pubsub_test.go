@@ -9,6 +9,7 @@ import (
 
 	"cloud.google.com/go/pubsub"
 	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/ThreeDotsLabs/watermill"
@@ -136,3 +137,189 @@ func produceMessages(t *testing.T, ctx context.Context, topic string, howMany in
 
 	require.NoError(t, pub.Publish(topic, messages...))
 }
+
+func TestSubscriber_SeekToSnapshot(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sub, err := googlecloud.NewSubscriber(ctx, googlecloud.SubscriberConfig{}, watermill.NewStdLogger(true, true))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	topic := "seek_" + watermill.NewShortUUID()
+	snapshotName := "snapshot_" + watermill.NewShortUUID()
+
+	require.NoError(t, sub.SubscribeInitialize(topic))
+	require.NoError(t, sub.CreateSnapshot(ctx, topic, snapshotName))
+	defer func() {
+		require.NoError(t, sub.DeleteSnapshot(context.Background(), snapshotName))
+	}()
+
+	howManyMessages := 10
+	produceMessages(t, ctx, topic, howManyMessages)
+
+	messages, err := sub.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	receiveAll := func() map[string]struct{} {
+		received := map[string]struct{}{}
+		for len(received) < howManyMessages {
+			select {
+			case msg := <-messages:
+				received[msg.UUID] = struct{}{}
+				msg.Ack()
+			case <-ctx.Done():
+				t.Fatal("Test timed out")
+			}
+		}
+		return received
+	}
+
+	firstDelivery := receiveAll()
+
+	require.NoError(t, sub.SeekToSnapshot(ctx, topic, snapshotName))
+
+	require.Equal(t, firstDelivery, receiveAll(), "messages should be redelivered after seeking to the snapshot")
+}
+
+func TestSubscriber_topic_of_other_project(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	topicProject := "topic-project-" + watermill.NewShortUUID()
+	topic := "topic_" + watermill.NewShortUUID()
+
+	pub, err := googlecloud.NewPublisher(ctx, googlecloud.PublisherConfig{ProjectID: topicProject})
+	require.NoError(t, err)
+	defer pub.Close()
+
+	sub, err := googlecloud.NewSubscriber(ctx, googlecloud.SubscriberConfig{
+		ProjectID: "subscription-project-" + watermill.NewShortUUID(),
+	}, watermill.NewStdLogger(true, true))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	otherProjectTopic := googlecloud.FullyQualifiedTopic(topicProject, topic)
+
+	err = sub.SubscribeInitialize(otherProjectTopic)
+	require.Error(t, err, "topics of other projects should not be created")
+
+	// the topic is created by the publisher in its own project
+	require.NoError(t, pub.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+
+	messages, err := sub.Subscribe(ctx, otherProjectTopic)
+	require.NoError(t, err)
+
+	sent := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, pub.Publish(topic, sent))
+
+	select {
+	case msg := <-messages:
+		require.Equal(t, sent.UUID, msg.UUID)
+		msg.Ack()
+	case <-ctx.Done():
+		t.Fatal("Test timed out")
+	}
+}
+
+func TestPublisher_DoNotCheckTopicExistence(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pub, err := googlecloud.NewPublisher(ctx, googlecloud.PublisherConfig{
+		DoNotCheckTopicExistence: true,
+	})
+	require.NoError(t, err)
+	defer pub.Close()
+
+	err = pub.Publish("missing_topic_"+watermill.NewShortUUID(), message.NewMessage(watermill.NewUUID(), nil))
+	require.Error(t, err, "the topic should not be created")
+
+	topic := "topic_" + watermill.NewShortUUID()
+
+	creatingPub, err := googlecloud.NewPublisher(ctx, googlecloud.PublisherConfig{})
+	require.NoError(t, err)
+	defer creatingPub.Close()
+
+	require.NoError(t, creatingPub.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+	require.NoError(t, pub.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+}
+
+func TestClientPool(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := googlecloud.NewClientPool(ctx, googlecloud.ClientPoolConfig{})
+	require.NoError(t, err)
+
+	firstPub, err := googlecloud.NewPublisher(ctx, googlecloud.PublisherConfig{ClientPool: pool})
+	require.NoError(t, err)
+	secondPub, err := googlecloud.NewPublisher(ctx, googlecloud.PublisherConfig{ClientPool: pool})
+	require.NoError(t, err)
+
+	sub, err := googlecloud.NewSubscriber(ctx, googlecloud.SubscriberConfig{ClientPool: pool}, watermill.NopLogger{})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	topic := "topic_" + watermill.NewShortUUID()
+	require.NoError(t, sub.SubscribeInitialize(topic))
+
+	messages, err := sub.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	// the shared client is still used by the second publisher and the subscriber
+	require.NoError(t, firstPub.Close())
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	require.NoError(t, secondPub.Publish(topic, msg))
+	require.NoError(t, secondPub.Close())
+
+	select {
+	case received := <-messages:
+		assert.Equal(t, msg.UUID, received.UUID)
+		received.Ack()
+	case <-ctx.Done():
+		t.Fatal("Test timed out")
+	}
+}
+
+func TestSubscriber_Stats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sub, err := googlecloud.NewSubscriber(ctx, googlecloud.SubscriberConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	topic := "topic_" + watermill.NewShortUUID()
+	require.NoError(t, sub.SubscribeInitialize(topic))
+
+	messages, err := sub.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	stats := sub.Stats()
+	require.Contains(t, stats.Subscriptions, topic)
+	assert.Equal(t, 1, stats.Subscriptions[topic].Receivers)
+	assert.Equal(t, pubsub.DefaultReceiveSettings.NumGoroutines, stats.StreamingPullConnections)
+
+	produceMessages(t, ctx, topic, 1)
+
+	select {
+	case received := <-messages:
+		subscriptionStats := sub.Stats().Subscriptions[topic]
+		assert.EqualValues(t, 1, subscriptionStats.OutstandingMessages)
+		assert.EqualValues(t, 0, subscriptionStats.Acked)
+
+		received.Ack()
+	case <-ctx.Done():
+		t.Fatal("Test timed out")
+	}
+
+	require.Eventually(t, func() bool {
+		return sub.Stats().Subscriptions[topic].Acked == 1
+	}, 10*time.Second, 10*time.Millisecond)
+
+	subscriptionStats := sub.Stats().Subscriptions[topic]
+	assert.EqualValues(t, 0, subscriptionStats.OutstandingMessages)
+	assert.True(t, subscriptionStats.AckLatencyP99 > 0)
+}
@@ -0,0 +1,243 @@
+package googlecloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// PushHandlerConfig is the configuration of PushHandler.
+type PushHandlerConfig struct {
+	// GenerateSubscriptionName generates the name of the push subscription for a given topic.
+	// Requests of the subscription are passed to the output channel of Subscribe called with the topic.
+	GenerateSubscriptionName SubscriptionNameFn
+
+	// VerifyToken verifies the token from the Authorization header of the push request,
+	// for example with GoogleIDTokenVerifier. Requests for which it returns an error are rejected.
+	//
+	// When nil, the token is not verified.
+	// It is fine only if the endpoint is not accessible publicly, for example in tests.
+	VerifyToken func(ctx context.Context, token string) error
+
+	// AckTimeout is the maximum time of waiting for Ack or Nack of the message.
+	// After the timeout, the message is nacked (and redelivered by Pub/Sub).
+	// When zero, the handler waits until the request is canceled.
+	AckTimeout time.Duration
+
+	// Unmarshaler transforms the client library format into watermill/message.Message.
+	Unmarshaler Unmarshaler
+}
+
+func (c *PushHandlerConfig) setDefaults() {
+	if c.GenerateSubscriptionName == nil {
+		c.GenerateSubscriptionName = TopicSubscriptionName
+	}
+	if c.Unmarshaler == nil {
+		c.Unmarshaler = DefaultMarshalerUnmarshaler{}
+	}
+}
+
+// PushHandler receives messages of Google Cloud Pub/Sub push subscriptions over HTTP.
+// It implements http.Handler and message.Subscriber, so the same Router handlers can be used
+// with pull subscriptions (Subscriber) and push subscriptions, for example on Cloud Run.
+//
+// The response is sent after the message is acked (2xx) or nacked (non-2xx, Pub/Sub redelivers the message).
+//
+// See https://cloud.google.com/pubsub/docs/push to find out more about push subscriptions.
+type PushHandler struct {
+	config PushHandlerConfig
+
+	subscriptions     map[string]*pushSubscription
+	subscriptionsLock sync.RWMutex
+
+	closing chan struct{}
+	closed  bool
+
+	logger watermill.LoggerAdapter
+}
+
+func NewPushHandler(config PushHandlerConfig, logger watermill.LoggerAdapter) *PushHandler {
+	config.setDefaults()
+
+	return &PushHandler{
+		config:        config,
+		subscriptions: map[string]*pushSubscription{},
+		closing:       make(chan struct{}),
+		logger:        logger,
+	}
+}
+
+type pushSubscription struct {
+	output chan *message.Message
+	done   chan struct{}
+}
+
+// pushRequest is the body of the push request.
+type pushRequest struct {
+	Message struct {
+		Attributes  map[string]string `json:"attributes"`
+		Data        []byte            `json:"data"`
+		ID          string            `json:"messageId"`
+		PublishTime time.Time         `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// Subscribe returns the channel with messages pushed to the subscription generated with GenerateSubscriptionName.
+// The channel is closed when the context is canceled or the PushHandler is closed.
+func (h *PushHandler) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	if h.closed {
+		return nil, ErrSubscriberClosed
+	}
+
+	subscriptionName := h.config.GenerateSubscriptionName(topic)
+
+	h.subscriptionsLock.Lock()
+	defer h.subscriptionsLock.Unlock()
+
+	if _, ok := h.subscriptions[subscriptionName]; ok {
+		return nil, errors.Errorf("already subscribed to push subscription %s", subscriptionName)
+	}
+
+	sub := &pushSubscription{
+		output: make(chan *message.Message),
+		done:   make(chan struct{}),
+	}
+	h.subscriptions[subscriptionName] = sub
+
+	h.logger.Info("Subscribing to Google Cloud PubSub push subscription", watermill.LogFields{
+		"provider":          ProviderName,
+		"topic":             topic,
+		"subscription_name": subscriptionName,
+	})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-h.closing:
+		}
+
+		// unblocks pending sends, before the lock is taken
+		close(sub.done)
+
+		h.subscriptionsLock.Lock()
+		delete(h.subscriptions, subscriptionName)
+		close(sub.output)
+		h.subscriptionsLock.Unlock()
+	}()
+
+	return sub.output, nil
+}
+
+func (h *PushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.config.VerifyToken != nil {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if err := h.config.VerifyToken(r.Context(), token); err != nil {
+			h.logger.Info("Push request rejected, invalid token", watermill.LogFields{"err": err.Error()})
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var req pushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error("Cannot decode push request", err, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	subscriptionName := req.Subscription[strings.LastIndex(req.Subscription, "/")+1:]
+	logFields := watermill.LogFields{
+		"provider":          ProviderName,
+		"subscription_name": subscriptionName,
+		"message_id":        req.Message.ID,
+	}
+
+	msg, err := h.config.Unmarshaler.Unmarshal(&pubsub.Message{
+		ID:          req.Message.ID,
+		Data:        req.Message.Data,
+		Attributes:  req.Message.Attributes,
+		PublishTime: req.Message.PublishTime,
+	})
+	if err != nil {
+		h.logger.Error("Could not unmarshal Google Cloud PubSub message", err, logFields)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if h.config.AckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.config.AckTimeout)
+		defer cancel()
+	}
+	msg.SetContext(ctx)
+
+	if !h.send(ctx, subscriptionName, msg) {
+		h.logger.Info("Message not consumed, no active subscriber", logFields)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	select {
+	case <-msg.Acked():
+		h.logger.Trace("Msg acked", logFields)
+		w.WriteHeader(http.StatusNoContent)
+	case <-msg.Nacked():
+		h.logger.Trace("Msg nacked", logFields)
+		w.WriteHeader(http.StatusInternalServerError)
+	case <-ctx.Done():
+		h.logger.Trace("Ctx done, nacking message", logFields)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case <-h.closing:
+		h.logger.Trace("Closing, nacking message", logFields)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// send passes the message to the output of the subscription.
+// It returns false, when nobody is subscribed to the subscription or the message was not consumed.
+func (h *PushHandler) send(ctx context.Context, subscriptionName string, msg *message.Message) bool {
+	h.subscriptionsLock.RLock()
+	defer h.subscriptionsLock.RUnlock()
+
+	sub, ok := h.subscriptions[subscriptionName]
+	if !ok {
+		return false
+	}
+
+	select {
+	case sub.output <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-sub.done:
+		return false
+	}
+}
+
+// Close closes all the output channels. Pending push requests are responded with an error status.
+func (h *PushHandler) Close() error {
+	if h.closed {
+		return nil
+	}
+
+	h.closed = true
+	close(h.closing)
+
+	return nil
+}
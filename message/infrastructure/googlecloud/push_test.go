@@ -0,0 +1,95 @@
+package googlecloud_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/googlecloud"
+)
+
+func newPushRequest(t *testing.T, subscription string, uuid string, payload []byte) *http.Request {
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"attributes": map[string]string{googlecloud.UUIDHeaderKey: uuid, "foo": "bar"},
+			"data":       payload,
+			"messageId":  "1",
+		},
+		"subscription": "projects/test/subscriptions/" + subscription,
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer token")
+
+	return req
+}
+
+func TestPushHandler(t *testing.T) {
+	handler := googlecloud.NewPushHandler(googlecloud.PushHandlerConfig{}, watermill.NopLogger{})
+	defer handler.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := handler.Subscribe(ctx, "topic")
+	require.NoError(t, err)
+
+	ackedMessages := make(chan *message.Message, 1)
+	go func() {
+		msg := <-messages
+		ackedMessages <- msg
+		msg.Ack()
+
+		msg = <-messages
+		msg.Nack()
+	}()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newPushRequest(t, "topic", "uuid-1", []byte("payload")))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newPushRequest(t, "topic", "uuid-2", []byte("payload")))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	msg := <-ackedMessages
+	assert.Equal(t, "uuid-1", msg.UUID)
+	assert.Equal(t, "bar", msg.Metadata.Get("foo"))
+	assert.Equal(t, message.Payload("payload"), msg.Payload)
+}
+
+func TestPushHandler_no_subscriber(t *testing.T) {
+	handler := googlecloud.NewPushHandler(googlecloud.PushHandlerConfig{
+		AckTimeout: time.Second,
+	}, watermill.NopLogger{})
+	defer handler.Close()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newPushRequest(t, "topic", "uuid", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestPushHandler_invalid_token(t *testing.T) {
+	handler := googlecloud.NewPushHandler(googlecloud.PushHandlerConfig{
+		VerifyToken: func(ctx context.Context, token string) error {
+			assert.Equal(t, "token", token)
+			return errors.New("invalid token")
+		},
+	}, watermill.NopLogger{})
+	defer handler.Close()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newPushRequest(t, "topic", "uuid", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
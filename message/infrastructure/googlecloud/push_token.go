@@ -0,0 +1,226 @@
+package googlecloud
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GoogleCertsURL is the URL of the public keys used to sign Google ID tokens (in the JWK format).
+const GoogleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// GoogleIDTokenVerifier verifies the OpenID Connect tokens (JWT) sent by Pub/Sub with push requests.
+// Its Verify method can be used as PushHandlerConfig.VerifyToken.
+//
+// See https://cloud.google.com/pubsub/docs/push#authentication_and_authorization.
+type GoogleIDTokenVerifier struct {
+	// Audience is the expected audience of the token, configured in the push subscription.
+	// By default, it is the URL of the push endpoint.
+	Audience string
+
+	// ServiceAccountEmail is the expected email of the service account, configured in the push subscription.
+	// When empty, the email is not verified.
+	ServiceAccountEmail string
+
+	// CertsURL is the URL of the signing keys. Defaults to GoogleCertsURL.
+	CertsURL string
+
+	// CertsCacheTime is how long the signing keys are cached. Defaults to one hour.
+	CertsCacheTime time.Duration
+
+	// Client is the HTTP client used to fetch the signing keys. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	// Now returns the current time, it is used to check the token's expiration. Defaults to time.Now.
+	Now func() time.Time
+
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+	keysLock      sync.Mutex
+}
+
+var googleIDTokenIssuers = map[string]struct{}{
+	"accounts.google.com":         {},
+	"https://accounts.google.com": {},
+}
+
+type idTokenClaims struct {
+	Issuer        string `json:"iss"`
+	Audience      string `json:"aud"`
+	Expiry        int64  `json:"exp"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// Verify verifies the signature and the claims of the token.
+func (v *GoogleIDTokenVerifier) Verify(ctx context.Context, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return errors.Wrap(err, "invalid token header")
+	}
+	if header.Algorithm != "RS256" {
+		return errors.Errorf("unsupported token algorithm %s", header.Algorithm)
+	}
+
+	key, err := v.key(ctx, header.KeyID)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.Wrap(err, "invalid token signature encoding")
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err != nil {
+		return errors.Wrap(err, "invalid token signature")
+	}
+
+	var claims idTokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return errors.Wrap(err, "invalid token claims")
+	}
+
+	return v.verifyClaims(claims)
+}
+
+func (v *GoogleIDTokenVerifier) verifyClaims(claims idTokenClaims) error {
+	if _, ok := googleIDTokenIssuers[claims.Issuer]; !ok {
+		return errors.Errorf("unexpected token issuer %s", claims.Issuer)
+	}
+	if claims.Audience != v.Audience {
+		return errors.Errorf("unexpected token audience %s", claims.Audience)
+	}
+	if !v.now().Before(time.Unix(claims.Expiry, 0)) {
+		return errors.New("token expired")
+	}
+	if v.ServiceAccountEmail != "" && (claims.Email != v.ServiceAccountEmail || !claims.EmailVerified) {
+		return errors.Errorf("unexpected token email %s", claims.Email)
+	}
+
+	return nil
+}
+
+func (v *GoogleIDTokenVerifier) key(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	v.keysLock.Lock()
+	defer v.keysLock.Unlock()
+
+	cacheTime := v.CertsCacheTime
+	if cacheTime == 0 {
+		cacheTime = time.Hour
+	}
+
+	key, ok := v.keys[keyID]
+	if ok && v.now().Sub(v.keysFetchedAt) < cacheTime {
+		return key, nil
+	}
+
+	keys, err := v.fetchKeys(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch token signing keys")
+	}
+	v.keys = keys
+	v.keysFetchedAt = v.now()
+
+	key, ok = v.keys[keyID]
+	if !ok {
+		return nil, errors.Errorf("unknown token signing key %s", keyID)
+	}
+
+	return key, nil
+}
+
+func (v *GoogleIDTokenVerifier) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	certsURL := v.CertsURL
+	if certsURL == "" {
+		certsURL = GoogleCertsURL
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodGet, certsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			KeyID    string `json:"kid"`
+			KeyType  string `json:"kty"`
+			Modulus  string `json:"n"`
+			Exponent string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, errors.Wrap(err, "cannot decode keys")
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.KeyType != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.Modulus)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid modulus of key %s", k.KeyID)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.Exponent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid exponent of key %s", k.KeyID)
+		}
+
+		keys[k.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+func (v *GoogleIDTokenVerifier) now() time.Time {
+	if v.Now == nil {
+		return time.Now()
+	}
+	return v.Now()
+}
+
+func decodeTokenPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,109 @@
+package googlecloud
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// Seek replays (or skips) messages of the topic's subscription, so all messages published after t are redelivered
+// and all messages published before t are marked as acknowledged.
+//
+// The subscription name is generated like in Subscribe, with the configured GenerateSubscriptionName function.
+// Seeking to a time before the subscription was created requires retain_acked_messages to be enabled
+// on the subscription (see SubscriberConfig.SubscriptionConfig).
+//
+// See https://cloud.google.com/pubsub/docs/replay-overview to find out more about replaying messages.
+func (s *Subscriber) Seek(ctx context.Context, topic string, t time.Time) error {
+	if s.closed {
+		return ErrSubscriberClosed
+	}
+
+	subscriptionName := s.subscriptionName(topic)
+	s.logger.Info("Seeking Google Cloud PubSub subscription", watermill.LogFields{
+		"provider":          ProviderName,
+		"topic":             topic,
+		"subscription_name": subscriptionName,
+		"time":              t,
+	})
+
+	callCtx, cancel := s.config.Client.callContext(ctx)
+	defer cancel()
+
+	if err := s.client.Subscription(subscriptionName).SeekToTime(callCtx, t); err != nil {
+		return errors.Wrapf(err, "cannot seek subscription %s to %s", subscriptionName, t)
+	}
+
+	return nil
+}
+
+// CreateSnapshot creates a snapshot of the topic's subscription with the provided name.
+// The snapshot keeps the acknowledgment state of the subscription, so it can be restored with SeekToSnapshot,
+// for example before a risky deployment.
+func (s *Subscriber) CreateSnapshot(ctx context.Context, topic string, snapshotName string) error {
+	if s.closed {
+		return ErrSubscriberClosed
+	}
+
+	subscriptionName := s.subscriptionName(topic)
+	s.logger.Info("Creating Google Cloud PubSub snapshot", watermill.LogFields{
+		"provider":          ProviderName,
+		"topic":             topic,
+		"subscription_name": subscriptionName,
+		"snapshot_name":     snapshotName,
+	})
+
+	callCtx, cancel := s.config.Client.callContext(ctx)
+	defer cancel()
+
+	if _, err := s.client.Subscription(subscriptionName).CreateSnapshot(callCtx, snapshotName); err != nil {
+		return errors.Wrapf(err, "cannot create snapshot %s of subscription %s", snapshotName, subscriptionName)
+	}
+
+	return nil
+}
+
+// SeekToSnapshot restores the acknowledgment state of the topic's subscription from the snapshot
+// created with CreateSnapshot.
+func (s *Subscriber) SeekToSnapshot(ctx context.Context, topic string, snapshotName string) error {
+	if s.closed {
+		return ErrSubscriberClosed
+	}
+
+	subscriptionName := s.subscriptionName(topic)
+	s.logger.Info("Seeking Google Cloud PubSub subscription to snapshot", watermill.LogFields{
+		"provider":          ProviderName,
+		"topic":             topic,
+		"subscription_name": subscriptionName,
+		"snapshot_name":     snapshotName,
+	})
+
+	callCtx, cancel := s.config.Client.callContext(ctx)
+	defer cancel()
+
+	snapshot := s.client.Snapshot(snapshotName)
+	if err := s.client.Subscription(subscriptionName).SeekToSnapshot(callCtx, snapshot); err != nil {
+		return errors.Wrapf(err, "cannot seek subscription %s to snapshot %s", subscriptionName, snapshotName)
+	}
+
+	return nil
+}
+
+// DeleteSnapshot deletes the snapshot created with CreateSnapshot.
+func (s *Subscriber) DeleteSnapshot(ctx context.Context, snapshotName string) error {
+	if s.closed {
+		return ErrSubscriberClosed
+	}
+
+	callCtx, cancel := s.config.Client.callContext(ctx)
+	defer cancel()
+
+	if err := s.client.Snapshot(snapshotName).Delete(callCtx); err != nil {
+		return errors.Wrapf(err, "cannot delete snapshot %s", snapshotName)
+	}
+
+	return nil
+}
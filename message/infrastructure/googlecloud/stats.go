@@ -0,0 +1,271 @@
+package googlecloud
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
+)
+
+// Names of the metrics reported to SubscriberConfig.MetricsSink.
+// All of them have the subscription and topic labels.
+const (
+	// MetricProcessedMessages is the counter of processed messages, with the result label (acked or nacked).
+	MetricProcessedMessages = "googlecloud_subscriber_messages_processed_total"
+
+	// MetricAckLatency is the time between sending the message to the output channel and its ack or nack.
+	MetricAckLatency = "googlecloud_subscriber_ack_latency_seconds"
+)
+
+// AckLatencySamples is the number of the most recent acks and nacks of a subscription,
+// from which the percentiles of SubscriptionStats are calculated.
+const AckLatencySamples = 1024
+
+// SubscriberStats are the current statistics of the Subscriber, returned by Subscriber.Stats.
+type SubscriberStats struct {
+	// Subscriptions are the statistics of subscriptions which are currently received, by the subscription name.
+	Subscriptions map[string]SubscriptionStats `json:"subscriptions"`
+
+	// OutstandingMessages is the number of messages received from Pub/Sub, which are not acked or nacked yet.
+	// The client library runs a goroutine for every outstanding message.
+	OutstandingMessages int64 `json:"outstanding_messages"`
+	// OutstandingBytes is the size of payloads of the outstanding messages.
+	OutstandingBytes int64 `json:"outstanding_bytes"`
+
+	// StreamingPullConnections is the number of streaming pull streams of all subscriptions.
+	StreamingPullConnections int `json:"streaming_pull_connections"`
+}
+
+// SubscriptionStats are the statistics of a single subscription.
+type SubscriptionStats struct {
+	Topic string `json:"topic"`
+
+	// Receivers is the number of Subscribe calls, which are currently receiving messages from the subscription.
+	Receivers int `json:"receivers"`
+
+	// StreamingPullConnections is the number of streaming pull streams opened by the client library
+	// (ReceiveSettings.NumGoroutines for every receiver). Subscriptions with ReceiveSettings.Synchronous
+	// use the Pull call instead of streams.
+	StreamingPullConnections int `json:"streaming_pull_connections"`
+
+	OutstandingMessages int64 `json:"outstanding_messages"`
+	OutstandingBytes    int64 `json:"outstanding_bytes"`
+
+	// Acked and Nacked are the numbers of processed messages, since the subscription started receiving.
+	// Messages nacked because of closing the Subscriber are counted as nacked.
+	Acked  int64 `json:"acked"`
+	Nacked int64 `json:"nacked"`
+
+	// AckLatencyP50, AckLatencyP95 and AckLatencyP99 are the percentiles of the time between sending the message
+	// to the output channel and its ack or nack, from the last AckLatencySamples messages.
+	AckLatencyP50 time.Duration `json:"ack_latency_p50"`
+	AckLatencyP95 time.Duration `json:"ack_latency_p95"`
+	AckLatencyP99 time.Duration `json:"ack_latency_p99"`
+}
+
+// Stats returns the current statistics of the Subscriber's subscriptions.
+func (s *Subscriber) Stats() SubscriberStats {
+	s.subscriptionStatsLock.Lock()
+	defer s.subscriptionStatsLock.Unlock()
+
+	stats := SubscriberStats{
+		Subscriptions:       make(map[string]SubscriptionStats, len(s.subscriptionStats)),
+		OutstandingMessages: s.OutstandingMessages(),
+		OutstandingBytes:    s.OutstandingBytes(),
+	}
+
+	for name, subStats := range s.subscriptionStats {
+		subscriptionStats := subStats.snapshot()
+
+		stats.Subscriptions[name] = subscriptionStats
+		stats.StreamingPullConnections += subscriptionStats.StreamingPullConnections
+	}
+
+	return stats
+}
+
+// Expvar returns the variable with the Subscriber's Stats, which can be published with expvar.Publish:
+//
+//	expvar.Publish("googlecloud_subscriber", subscriber.Expvar())
+func (s *Subscriber) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return s.Stats()
+	})
+}
+
+// startReceiving returns the statistics of the subscription, which are kept as long as any receiver uses it.
+func (s *Subscriber) startReceiving(subscriptionName string, topic string, settings pubsub.ReceiveSettings) *subscriptionStats {
+	s.subscriptionStatsLock.Lock()
+	defer s.subscriptionStatsLock.Unlock()
+
+	stats, ok := s.subscriptionStats[subscriptionName]
+	if !ok {
+		stats = newSubscriptionStats(subscriptionName, topic, s.config.MetricsSink)
+		s.subscriptionStats[subscriptionName] = stats
+	}
+
+	stats.lock.Lock()
+	stats.receivers++
+	stats.streamingPullConnections += streamingPullConnections(settings)
+	stats.lock.Unlock()
+
+	return stats
+}
+
+func (s *Subscriber) finishReceiving(subscriptionName string, settings pubsub.ReceiveSettings) {
+	s.subscriptionStatsLock.Lock()
+	defer s.subscriptionStatsLock.Unlock()
+
+	stats, ok := s.subscriptionStats[subscriptionName]
+	if !ok {
+		return
+	}
+
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+
+	stats.receivers--
+	stats.streamingPullConnections -= streamingPullConnections(settings)
+
+	if stats.receivers == 0 {
+		delete(s.subscriptionStats, subscriptionName)
+	}
+}
+
+// streamingPullConnections returns the number of streams opened by pubsub.Subscription.Receive.
+func streamingPullConnections(settings pubsub.ReceiveSettings) int {
+	switch {
+	case settings.Synchronous:
+		return 0
+	case settings.NumGoroutines >= 1:
+		return settings.NumGoroutines
+	default:
+		return pubsub.DefaultReceiveSettings.NumGoroutines
+	}
+}
+
+type subscriptionStats struct {
+	subscription string
+	topic        string
+	sink         metrics.MetricsSink
+
+	lock sync.Mutex
+
+	receivers                int
+	streamingPullConnections int
+
+	outstandingMessages int64
+	outstandingBytes    int64
+
+	acked  int64
+	nacked int64
+
+	// ackLatencies is the ring buffer of the last AckLatencySamples latencies
+	ackLatencies   []time.Duration
+	nextAckLatency int
+}
+
+func newSubscriptionStats(subscription string, topic string, sink metrics.MetricsSink) *subscriptionStats {
+	return &subscriptionStats{
+		subscription: subscription,
+		topic:        topic,
+		sink:         sink,
+		ackLatencies: make([]time.Duration, 0, AckLatencySamples),
+	}
+}
+
+func (s *subscriptionStats) received(size int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.outstandingMessages++
+	s.outstandingBytes += int64(size)
+}
+
+// processed records the ack or nack of the message. latency is zero, when the message was not sent to the output channel.
+func (s *subscriptionStats) processed(size int, acked bool, latency time.Duration) {
+	s.lock.Lock()
+
+	s.outstandingMessages--
+	s.outstandingBytes -= int64(size)
+
+	if acked {
+		s.acked++
+	} else {
+		s.nacked++
+	}
+
+	if latency > 0 {
+		if len(s.ackLatencies) < AckLatencySamples {
+			s.ackLatencies = append(s.ackLatencies, latency)
+		} else {
+			s.ackLatencies[s.nextAckLatency] = latency
+		}
+		s.nextAckLatency = (s.nextAckLatency + 1) % AckLatencySamples
+	}
+
+	s.lock.Unlock()
+
+	s.report(acked, latency)
+}
+
+func (s *subscriptionStats) report(acked bool, latency time.Duration) {
+	if s.sink == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"subscription": s.subscription,
+		"topic":        s.topic,
+	}
+	if latency > 0 {
+		s.sink.ObserveDuration(MetricAckLatency, labels, latency)
+	}
+
+	result := "nacked"
+	if acked {
+		result = "acked"
+	}
+	labels["result"] = result
+	s.sink.IncCounter(MetricProcessedMessages, labels)
+}
+
+func (s *subscriptionStats) snapshot() SubscriptionStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := SubscriptionStats{
+		Topic:                    s.topic,
+		Receivers:                s.receivers,
+		StreamingPullConnections: s.streamingPullConnections,
+		OutstandingMessages:      s.outstandingMessages,
+		OutstandingBytes:         s.outstandingBytes,
+		Acked:                    s.acked,
+		Nacked:                   s.nacked,
+	}
+
+	if len(s.ackLatencies) > 0 {
+		latencies := make([]time.Duration, len(s.ackLatencies))
+		copy(latencies, s.ackLatencies)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		stats.AckLatencyP50 = percentile(latencies, 50)
+		stats.AckLatencyP95 = percentile(latencies, 95)
+		stats.AckLatencyP99 = percentile(latencies, 99)
+	}
+
+	return stats
+}
+
+// percentile returns the percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
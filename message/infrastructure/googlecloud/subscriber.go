@@ -3,16 +3,23 @@ package googlecloud
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/pkg/errors"
 	"google.golang.org/api/option"
 
 	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/backoff"
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
 	"github.com/ThreeDotsLabs/watermill/message"
 )
 
@@ -30,15 +37,23 @@ var (
 //
 // For more info on how Google Cloud Pub/Sub Subscribers work, check https://cloud.google.com/pubsub/docs/subscriber.
 type Subscriber struct {
+	// accessed atomically, kept first for 64-bit alignment
+	outstandingMessages int64
+	outstandingBytes    int64
+
 	closing chan struct{}
 	closed  bool
 
 	allSubscriptionsWaitGroup sync.WaitGroup
-	activeSubscriptions       map[string]*pubsub.Subscription
+	activeSubscriptions       map[string]activeSubscription
 	activeSubscriptionsLock   sync.RWMutex
 
-	client *pubsub.Client
-	config SubscriberConfig
+	subscriptionStats     map[string]*subscriptionStats
+	subscriptionStatsLock sync.Mutex
+
+	client      *pubsub.Client
+	closeClient func() error
+	config      SubscriberConfig
 
 	logger watermill.LoggerAdapter
 }
@@ -65,16 +80,80 @@ type SubscriberConfig struct {
 	// Otherwise, trying to create a subscription on non-existent topic results in `ErrTopicDoesNotExist`.
 	DoNotCreateTopicIfMissing bool
 
+	// If true, the client library stops pulling messages from Pub/Sub when ReceiveSettings.MaxOutstandingMessages
+	// messages are not acked yet (for example, because Router's handlers are slow),
+	// instead of buffering pulled messages in memory.
+	//
+	// It enables ReceiveSettings.Synchronous. When ReceiveSettings.MaxOutstandingMessages is not set,
+	// DefaultBlockingMaxOutstandingMessages is used.
+	BlockPullWhenHandlerBusy bool
+
 	// Settings for cloud.google.com/go/pubsub client library.
 	ReceiveSettings    pubsub.ReceiveSettings
 	SubscriptionConfig pubsub.SubscriptionConfig
 	ClientOptions      []option.ClientOption
 
+	// Client contains settings of the connection, like the regional endpoint, keepalive and timeouts of calls.
+	// ClientOptions are applied after them, so they can override these settings.
+	Client ClientConfig
+
+	// ClientPool is optional. When set, the Subscriber uses the client shared by the pool,
+	// instead of creating its own, and ClientOptions, EmulatorHost and RequireEmulator are ignored.
+	// CallTimeout of Client is still respected. ProjectID defaults to the project of the pool.
+	ClientPool *ClientPool
+
+	// If true, settings of an already existing subscription are compared with SubscriptionConfig
+	// and the subscription is updated, when they differ.
+	// Otherwise (default), differences are only logged and the existing subscription is used as it is.
+	//
+	// AckDeadline, RetentionDuration, PushConfig, Labels and RetainAckedMessages are compared only
+	// when they are set in SubscriptionConfig.
+	ReconcileExistingSubscription bool
+
+	// If true, RetainAckedMessages of SubscriptionConfig is compared with the existing subscription
+	// also when it is false, so retaining of acked messages can be disabled by ReconcileExistingSubscription.
+	CompareRetainAckedMessages bool
+
+	// TopicProject is optional and returns the project of the topic, so one Subscriber can subscribe
+	// to topics of many projects. Topics can also be passed in the projects/<project>/topics/<topic> format
+	// (see FullyQualifiedTopic).
+	//
+	// Subscriptions are always created in ProjectID. Their names are generated from the topic ID,
+	// prefixed with "<project>_" for topics of projects other than ProjectID. Topics of other projects are never created.
+	TopicProject TopicProjectFn
+
+	// EmulatorHost is the address of the Pub/Sub emulator, for example DefaultEmulatorHost.
+	// When empty, the PUBSUB_EMULATOR_HOST env is respected by the client library.
+	EmulatorHost string
+
+	// If true, `NewSubscriber` fails with `ErrEmulatorRequired` when neither EmulatorHost
+	// nor the PUBSUB_EMULATOR_HOST env is set. Use it in tests to never talk to the real Google Cloud.
+	RequireEmulator bool
+
+	// SubscriptionBackoff is the strategy of retries, when checking or creating the subscription (or its topic)
+	// fails with a transient error (see IsRetryableError). Defaults to DefaultSubscriptionBackoff.
+	SubscriptionBackoff backoff.Strategy
+
+	// OnSubscriptionError is optional and it's called, when checking or creating the subscription fails.
+	// retrying is false, when the error is permanent or there are no more retries, so Subscribe fails.
+	// It allows to alert on problems with subscriptions, for example on missing permissions.
+	OnSubscriptionError func(subscriptionName string, err error, retrying bool)
+
+	// MetricsSink is optional and receives per-subscription ack latencies and counters of processed messages.
+	// The current statistics of subscriptions are also available with Subscriber.Stats.
+	MetricsSink metrics.MetricsSink
+
 	// Unmarshaler transforms the client library format into watermill/message.Message.
 	// Use a custom unmarshaler if needed, otherwise the default Unmarshaler should cover most use cases.
 	Unmarshaler Unmarshaler
 }
 
+// DefaultSubscriptionBackoff is the default SubscriberConfig.SubscriptionBackoff.
+var DefaultSubscriptionBackoff = backoff.MaxAttempts(
+	backoff.Jitter(backoff.Exponential{Initial: time.Millisecond * 500, Max: time.Second * 10}, 0.2),
+	5,
+)
+
 type SubscriptionNameFn func(topic string) string
 
 // TopicSubscriptionName uses the topic name as the subscription name.
@@ -89,6 +168,10 @@ func TopicSubscriptionNameWithSuffix(suffix string) SubscriptionNameFn {
 	}
 }
 
+// DefaultBlockingMaxOutstandingMessages is the default ReceiveSettings.MaxOutstandingMessages
+// used with SubscriberConfig.BlockPullWhenHandlerBusy.
+const DefaultBlockingMaxOutstandingMessages = 1
+
 func (c *SubscriberConfig) setDefaults() {
 	if c.GenerateSubscriptionName == nil {
 		c.GenerateSubscriptionName = TopicSubscriptionName
@@ -96,6 +179,19 @@ func (c *SubscriberConfig) setDefaults() {
 	if c.Unmarshaler == nil {
 		c.Unmarshaler = DefaultMarshalerUnmarshaler{}
 	}
+	if c.SubscriptionBackoff == nil {
+		c.SubscriptionBackoff = DefaultSubscriptionBackoff
+	}
+	if c.ClientPool != nil && c.ProjectID == "" {
+		c.ProjectID = c.ClientPool.ProjectID()
+	}
+	if c.BlockPullWhenHandlerBusy {
+		c.ReceiveSettings.Synchronous = true
+
+		if c.ReceiveSettings.MaxOutstandingMessages == 0 {
+			c.ReceiveSettings.MaxOutstandingMessages = DefaultBlockingMaxOutstandingMessages
+		}
+	}
 }
 
 func NewSubscriber(
@@ -105,7 +201,9 @@ func NewSubscriber(
 ) (*Subscriber, error) {
 	config.setDefaults()
 
-	client, err := pubsub.NewClient(ctx, config.ProjectID, config.ClientOptions...)
+	client, closeClient, err := newClient(ctx, config.ClientPool, config.ProjectID, func() ([]option.ClientOption, error) {
+		return clientOptions(config.EmulatorHost, config.RequireEmulator, config.Client, config.ClientOptions)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -115,11 +213,14 @@ func NewSubscriber(
 		closed:  false,
 
 		allSubscriptionsWaitGroup: sync.WaitGroup{},
-		activeSubscriptions:       map[string]*pubsub.Subscription{},
+		activeSubscriptions:       map[string]activeSubscription{},
 		activeSubscriptionsLock:   sync.RWMutex{},
 
-		client: client,
-		config: config,
+		subscriptionStats: map[string]*subscriptionStats{},
+
+		client:      client,
+		closeClient: closeClient,
+		config:      config,
 
 		logger: logger,
 	}, nil
@@ -137,12 +238,36 @@ func NewSubscriber(
 //
 // See https://cloud.google.com/pubsub/docs/subscriber to find out more about how Google Cloud Pub/Sub Subscriptions work.
 func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	return s.SubscribeWithOptions(ctx, topic)
+}
+
+// SubscribeWithOptions works like Subscribe, with the subscription's settings overridden by opts.
+//
+// ConsumerGroup is used as the subscription name, instead of the name generated by GenerateSubscriptionName.
+// Subscribers using the same subscription share its messages.
+//
+// Google Cloud Pub/Sub delivers only messages published after the subscription was created,
+// so message.StartPositionOldest is not supported.
+func (s *Subscriber) SubscribeWithOptions(
+	ctx context.Context,
+	topic string,
+	opts ...message.SubscribeOption,
+) (<-chan *message.Message, error) {
 	if s.closed {
 		return nil, ErrSubscriberClosed
 	}
 
+	options := message.NewSubscribeOptions(opts...)
+	if options.StartPosition == message.StartPositionOldest {
+		return nil, errors.New("StartPositionOldest is not supported by Google Cloud Pub/Sub")
+	}
+
+	subscriptionName := s.subscriptionName(topic)
+	if options.ConsumerGroup != "" {
+		subscriptionName = options.ConsumerGroup
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
-	subscriptionName := s.config.GenerateSubscriptionName(topic)
 
 	logFields := watermill.LogFields{
 		"provider":          ProviderName,
@@ -155,16 +280,21 @@ func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *messa
 
 	sub, err := s.subscription(ctx, subscriptionName, topic)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
+	receiveSettings := sub.ReceiveSettings
+	stats := s.startReceiving(subscriptionName, topic, receiveSettings)
+
 	receiveFinished := make(chan struct{})
 	s.allSubscriptionsWaitGroup.Add(1)
 	go func() {
-		err := s.receive(ctx, sub, logFields, output)
+		err := s.receive(ctx, sub, stats, logFields, output)
 		if err != nil {
 			s.logger.Error("Receiving messages failed", err, logFields)
 		}
+		s.finishReceiving(subscriptionName, receiveSettings)
 		close(receiveFinished)
 	}()
 
@@ -187,7 +317,7 @@ func (s *Subscriber) SubscribeInitialize(topic string) (err error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	subscriptionName := s.config.GenerateSubscriptionName(topic)
+	subscriptionName := s.subscriptionName(topic)
 	logFields := watermill.LogFields{
 		"provider":          ProviderName,
 		"topic":             topic,
@@ -213,7 +343,7 @@ func (s *Subscriber) Close() error {
 	close(s.closing)
 	s.allSubscriptionsWaitGroup.Wait()
 
-	err := s.client.Close()
+	err := s.closeClient()
 	if err != nil {
 		return err
 	}
@@ -225,10 +355,28 @@ func (s *Subscriber) Close() error {
 func (s *Subscriber) receive(
 	ctx context.Context,
 	sub *pubsub.Subscription,
+	stats *subscriptionStats,
 	logFields watermill.LogFields,
 	output chan *message.Message,
 ) error {
 	err := sub.Receive(ctx, func(ctx context.Context, pubsubMsg *pubsub.Message) {
+		atomic.AddInt64(&s.outstandingMessages, 1)
+		atomic.AddInt64(&s.outstandingBytes, int64(len(pubsubMsg.Data)))
+		stats.received(len(pubsubMsg.Data))
+
+		acked := false
+		var sentAt time.Time
+		defer func() {
+			atomic.AddInt64(&s.outstandingMessages, -1)
+			atomic.AddInt64(&s.outstandingBytes, -int64(len(pubsubMsg.Data)))
+
+			var latency time.Duration
+			if !sentAt.IsZero() {
+				latency = time.Since(sentAt)
+			}
+			stats.processed(len(pubsubMsg.Data), acked, latency)
+		}()
+
 		msg, err := s.config.Unmarshaler.Unmarshal(pubsubMsg)
 		if err != nil {
 			s.logger.Error("Could not unmarshal Google Cloud PubSub message", err, logFields)
@@ -257,22 +405,26 @@ func (s *Subscriber) receive(
 			return
 		case output <- msg:
 			// message consumed, wait for ack (or nack)
+			sentAt = time.Now()
 		}
 
 		select {
 		case <-s.closing:
+			sentAt = time.Time{}
 			pubsubMsg.Nack()
 			s.logger.Trace(
 				"Closing, nacking message",
 				logFields,
 			)
 		case <-ctx.Done():
+			sentAt = time.Time{}
 			pubsubMsg.Nack()
 			s.logger.Trace(
 				"Ctx done, nacking message",
 				logFields,
 			)
 		case <-msg.Acked():
+			acked = true
 			s.logger.Trace(
 				"Msg acked",
 				logFields,
@@ -297,23 +449,112 @@ func (s *Subscriber) receive(
 
 // subscription obtains a subscription object.
 // If subscription doesn't exist on PubSub, create it, unless config variable DoNotCreateSubscriptionWhenMissing is set.
-func (s *Subscriber) subscription(ctx context.Context, subscriptionName, topicName string) (sub *pubsub.Subscription, err error) {
+// activeSubscription is the subscription obtained by the Subscriber, with the fully qualified name of its topic.
+type activeSubscription struct {
+	sub   *pubsub.Subscription
+	topic string
+}
+
+func (s *Subscriber) subscription(ctx context.Context, subscriptionName, topicName string) (*pubsub.Subscription, error) {
+	topic := s.fullyQualifiedTopic(topicName)
+
 	s.activeSubscriptionsLock.RLock()
-	sub, ok := s.activeSubscriptions[subscriptionName]
+	active, ok := s.activeSubscriptions[subscriptionName]
 	s.activeSubscriptionsLock.RUnlock()
 	if ok {
-		return sub, nil
+		return active.subscriptionOf(topic)
+	}
+
+	// retries are done without the lock, so one unavailable topic doesn't block subscribing to other topics
+	sub, err := s.getOrCreateSubscriptionWithRetry(ctx, subscriptionName, topicName)
+	if err != nil {
+		return nil, err
 	}
 
 	s.activeSubscriptionsLock.Lock()
 	defer s.activeSubscriptionsLock.Unlock()
-	defer func() {
+
+	if active, ok := s.activeSubscriptions[subscriptionName]; ok {
+		// the subscription was obtained concurrently
+		return active.subscriptionOf(topic)
+	}
+	s.activeSubscriptions[subscriptionName] = activeSubscription{sub: sub, topic: topic}
+
+	return sub, nil
+}
+
+// subscriptionOf returns the subscription, when it's the subscription of the topic.
+func (a activeSubscription) subscriptionOf(topic string) (*pubsub.Subscription, error) {
+	if a.topic != topic {
+		return nil, errors.Wrap(
+			ErrUnexpectedTopic,
+			fmt.Sprintf("topic of active sub: %s; expecting: %s", a.topic, topic),
+		)
+	}
+
+	return a.sub, nil
+}
+
+// getOrCreateSubscriptionWithRetry calls getOrCreateSubscription, retrying transient errors with SubscriptionBackoff.
+func (s *Subscriber) getOrCreateSubscriptionWithRetry(
+	ctx context.Context,
+	subscriptionName, topicName string,
+) (*pubsub.Subscription, error) {
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := s.config.Client.callContext(ctx)
+		sub, err := s.getOrCreateSubscription(callCtx, subscriptionName, topicName)
+		cancel()
 		if err == nil {
-			s.activeSubscriptions[subscriptionName] = sub
+			return sub, nil
 		}
-	}()
 
-	sub = s.client.Subscription(subscriptionName)
+		delay, retrying := s.config.SubscriptionBackoff.Next(attempt)
+		retrying = retrying && IsRetryableError(err)
+
+		if s.config.OnSubscriptionError != nil {
+			s.config.OnSubscriptionError(subscriptionName, err, retrying)
+		}
+		if !retrying {
+			return nil, err
+		}
+
+		s.logger.Info("Cannot get subscription, retrying", watermill.LogFields{
+			"subscription": subscriptionName,
+			"attempt":      attempt,
+			"retry_in":     delay,
+			"err":          err.Error(),
+		})
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, err
+		case <-s.closing:
+			return nil, err
+		}
+	}
+}
+
+// IsRetryableError returns true, when the error returned by Google Cloud Pub/Sub is transient,
+// for example when the service is unavailable or the deadline was exceeded.
+// Errors like PermissionDenied, NotFound or InvalidArgument are permanent.
+func IsRetryableError(err error) bool {
+	st, ok := status.FromError(errors.Cause(err))
+	if !ok {
+		return false
+	}
+
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// getOrCreateSubscription returns the subscription and creates it (and its topic), when it doesn't exist.
+func (s *Subscriber) getOrCreateSubscription(ctx context.Context, subscriptionName, topicName string) (*pubsub.Subscription, error) {
+	sub := s.client.Subscription(subscriptionName)
 	exists, err := sub.Exists(ctx)
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not check if subscription %s exists", subscriptionName)
@@ -327,22 +568,23 @@ func (s *Subscriber) subscription(ctx context.Context, subscriptionName, topicNa
 		return nil, errors.Wrap(ErrSubscriptionDoesNotExist, subscriptionName)
 	}
 
-	t := s.client.Topic(topicName)
+	projectID, topicID := splitTopic(topicName, s.config.TopicProject)
+	t := clientTopic(s.client, projectID, topicID)
 	exists, err = t.Exists(ctx)
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not check if topic %s exists", topicName)
 	}
 
-	if !exists && s.config.DoNotCreateTopicIfMissing {
+	if !exists && (s.config.DoNotCreateTopicIfMissing || isOtherProject(projectID, s.config.ProjectID)) {
 		return nil, errors.Wrap(ErrTopicDoesNotExist, topicName)
 	}
 
 	if !exists {
-		t, err = s.client.CreateTopic(ctx, topicName)
+		t, err = s.client.CreateTopic(ctx, topicID)
 
 		if grpc.Code(err) == codes.AlreadyExists {
 			s.logger.Debug("Topic already exists", watermill.LogFields{"topic": topicName})
-			t = s.client.Topic(topicName)
+			t = s.client.Topic(topicID)
 		} else if err != nil {
 			return nil, errors.Wrap(err, "could not create topic for subscription")
 		}
@@ -364,13 +606,48 @@ func (s *Subscriber) subscription(ctx context.Context, subscriptionName, topicNa
 	return sub, nil
 }
 
-func (s Subscriber) existingSubscription(ctx context.Context, sub *pubsub.Subscription, topic string) (*pubsub.Subscription, error) {
+// subscriptionName generates the name of the topic's subscription from the topic ID,
+// so topics of other projects result in valid subscription names.
+// subscriptionName generates the name of the topic's subscription.
+// Names of subscriptions of other projects' topics contain the project, so topics with the same ID
+// in different projects don't share the subscription.
+func (s *Subscriber) subscriptionName(topic string) string {
+	projectID, topicID := splitTopic(topic, s.config.TopicProject)
+	if isOtherProject(projectID, s.config.ProjectID) {
+		return s.config.GenerateSubscriptionName(projectID + "_" + topicID)
+	}
+
+	return s.config.GenerateSubscriptionName(topicID)
+}
+
+// fullyQualifiedTopic returns the topic in the projects/<project>/topics/<topic> format.
+func (s *Subscriber) fullyQualifiedTopic(topic string) string {
+	projectID, topicID := splitTopic(topic, s.config.TopicProject)
+	if projectID == "" {
+		projectID = s.config.ProjectID
+	}
+
+	return FullyQualifiedTopic(projectID, topicID)
+}
+
+// OutstandingMessages returns the number of messages received from Pub/Sub, which are not acked or nacked yet.
+// It can be exposed as a metric, for example with prometheus.NewGaugeFunc.
+func (s *Subscriber) OutstandingMessages() int64 {
+	return atomic.LoadInt64(&s.outstandingMessages)
+}
+
+// OutstandingBytes returns the size of payloads of messages received from Pub/Sub, which are not acked or nacked yet.
+func (s *Subscriber) OutstandingBytes() int64 {
+	return atomic.LoadInt64(&s.outstandingBytes)
+}
+
+func (s *Subscriber) existingSubscription(ctx context.Context, sub *pubsub.Subscription, topic string) (*pubsub.Subscription, error) {
 	config, err := sub.Config(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not fetch config for existing subscription")
 	}
 
-	fullyQualifiedTopicName := fmt.Sprintf("projects/%s/topics/%s", s.config.ProjectID, topic)
+	fullyQualifiedTopicName := s.fullyQualifiedTopic(topic)
 
 	if config.Topic.String() != fullyQualifiedTopicName {
 		return nil, errors.Wrap(
@@ -379,5 +656,73 @@ func (s Subscriber) existingSubscription(ctx context.Context, sub *pubsub.Subscr
 		)
 	}
 
+	if err := s.reconcileSubscription(ctx, sub, config); err != nil {
+		return nil, err
+	}
+
+	sub.ReceiveSettings = s.config.ReceiveSettings
+
 	return sub, nil
 }
+
+func (s *Subscriber) reconcileSubscription(ctx context.Context, sub *pubsub.Subscription, existing pubsub.SubscriptionConfig) error {
+	update, drift := subscriptionConfigDrift(existing, s.config.SubscriptionConfig, s.config.CompareRetainAckedMessages)
+	if len(drift) == 0 {
+		return nil
+	}
+
+	logFields := watermill.LogFields{
+		"provider":          ProviderName,
+		"subscription_name": sub.ID(),
+		"drift":             strings.Join(drift, ", "),
+	}
+
+	if !s.config.ReconcileExistingSubscription {
+		s.logger.Info("Existing subscription differs from SubscriptionConfig", logFields)
+		return nil
+	}
+
+	s.logger.Info("Updating existing subscription to match SubscriptionConfig", logFields)
+
+	if _, err := sub.Update(ctx, update); err != nil {
+		return errors.Wrapf(err, "could not update subscription %s", sub.ID())
+	}
+
+	return nil
+}
+
+// subscriptionConfigDrift returns the update, which makes the existing subscription match the desired config,
+// and the names of the settings which differ.
+// RetainAckedMessages is compared only when it's enabled in the desired config or compareRetainAckedMessages is true.
+func subscriptionConfigDrift(
+	existing, desired pubsub.SubscriptionConfig,
+	compareRetainAckedMessages bool,
+) (pubsub.SubscriptionConfigToUpdate, []string) {
+	var update pubsub.SubscriptionConfigToUpdate
+	var drift []string
+
+	if desired.AckDeadline != 0 && desired.AckDeadline != existing.AckDeadline {
+		update.AckDeadline = desired.AckDeadline
+		drift = append(drift, fmt.Sprintf("AckDeadline: %s != %s", existing.AckDeadline, desired.AckDeadline))
+	}
+	retainAckedMessagesSet := desired.RetainAckedMessages || compareRetainAckedMessages
+	if retainAckedMessagesSet && desired.RetainAckedMessages != existing.RetainAckedMessages {
+		update.RetainAckedMessages = desired.RetainAckedMessages
+		drift = append(drift, fmt.Sprintf("RetainAckedMessages: %t != %t", existing.RetainAckedMessages, desired.RetainAckedMessages))
+	}
+	if desired.RetentionDuration != 0 && desired.RetentionDuration != existing.RetentionDuration {
+		update.RetentionDuration = desired.RetentionDuration
+		drift = append(drift, fmt.Sprintf("RetentionDuration: %s != %s", existing.RetentionDuration, desired.RetentionDuration))
+	}
+	if desired.PushConfig.Endpoint != "" && !reflect.DeepEqual(desired.PushConfig, existing.PushConfig) {
+		pushConfig := desired.PushConfig
+		update.PushConfig = &pushConfig
+		drift = append(drift, fmt.Sprintf("PushConfig: %+v != %+v", existing.PushConfig, desired.PushConfig))
+	}
+	if desired.Labels != nil && !reflect.DeepEqual(desired.Labels, existing.Labels) {
+		update.Labels = desired.Labels
+		drift = append(drift, fmt.Sprintf("Labels: %v != %v", existing.Labels, desired.Labels))
+	}
+
+	return update, drift
+}
@@ -0,0 +1,135 @@
+package googlecloud
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// subscribeFakeServer subscribes to the topic of the in-memory Pub/Sub server and publishes the messages to it.
+func subscribeFakeServer(t *testing.T, config SubscriberConfig, messagesCount int) (*Subscriber, <-chan *message.Message) {
+	srv := pstest.NewServer()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	config.ProjectID = "project"
+	config.ClientOptions = EmulatorClientOptions(srv.Addr)
+
+	sub, err := NewSubscriber(context.Background(), config, watermill.NopLogger{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, sub.Close())
+	})
+
+	messages, err := sub.Subscribe(context.Background(), "topic")
+	require.NoError(t, err)
+
+	for i := 0; i < messagesCount; i++ {
+		srv.Publish(FullyQualifiedTopic("project", "topic"), []byte("payload"), nil)
+	}
+
+	return sub, messages
+}
+
+func receiveMessage(t *testing.T, messages <-chan *message.Message) *message.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second * 10):
+		t.Fatal("message not received")
+		return nil
+	}
+}
+
+func TestSubscriber_outstanding_messages(t *testing.T) {
+	sub, messages := subscribeFakeServer(t, SubscriberConfig{}, 3)
+
+	// the next messages are pulled, while the first one is not acked, and they wait for the output channel
+	msg := receiveMessage(t, messages)
+	assert.Eventually(t, func() bool {
+		return sub.OutstandingMessages() == 3
+	}, time.Second*10, time.Millisecond*10)
+	assert.EqualValues(t, 3*len("payload"), sub.OutstandingBytes())
+
+	msg.Ack()
+	receiveMessage(t, messages).Ack()
+	receiveMessage(t, messages).Nack()
+
+	assert.Eventually(t, func() bool {
+		return sub.OutstandingMessages() == 0
+	}, time.Second*10, time.Millisecond*10)
+	assert.Zero(t, sub.OutstandingBytes())
+
+	stats := sub.Stats().Subscriptions["topic"]
+	assert.EqualValues(t, 2, stats.Acked)
+	assert.EqualValues(t, 1, stats.Nacked)
+}
+
+func TestSubscriber_BlockPullWhenHandlerBusy(t *testing.T) {
+	sub, messages := subscribeFakeServer(t, SubscriberConfig{BlockPullWhenHandlerBusy: true}, 2)
+
+	msg := receiveMessage(t, messages)
+
+	// the client library doesn't pull the next message, until the outstanding one is acked
+	time.Sleep(time.Millisecond * 200)
+	assert.EqualValues(t, 1, sub.OutstandingMessages())
+	assert.Zero(t, sub.Stats().StreamingPullConnections, "synchronous pull should be used")
+
+	msg.Ack()
+	receiveMessage(t, messages).Ack()
+}
+
+func TestSubscriberConfig_setDefaults_receive_settings(t *testing.T) {
+	testCases := []struct {
+		Name                     string
+		BlockPullWhenHandlerBusy bool
+		ReceiveSettings          pubsub.ReceiveSettings
+		ExpectedReceiveSettings  pubsub.ReceiveSettings
+	}{
+		{
+			Name:                    "not_blocking",
+			ReceiveSettings:         pubsub.ReceiveSettings{MaxOutstandingMessages: 10},
+			ExpectedReceiveSettings: pubsub.ReceiveSettings{MaxOutstandingMessages: 10},
+		},
+		{
+			Name:                     "blocking_with_default_max_outstanding_messages",
+			BlockPullWhenHandlerBusy: true,
+			ExpectedReceiveSettings: pubsub.ReceiveSettings{
+				Synchronous:            true,
+				MaxOutstandingMessages: DefaultBlockingMaxOutstandingMessages,
+			},
+		},
+		{
+			Name:                     "blocking_with_custom_max_outstanding_messages",
+			BlockPullWhenHandlerBusy: true,
+			ReceiveSettings:          pubsub.ReceiveSettings{MaxOutstandingMessages: 5, MaxOutstandingBytes: 1024},
+			ExpectedReceiveSettings: pubsub.ReceiveSettings{
+				Synchronous:            true,
+				MaxOutstandingMessages: 5,
+				MaxOutstandingBytes:    1024,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			config := SubscriberConfig{
+				BlockPullWhenHandlerBusy: tc.BlockPullWhenHandlerBusy,
+				ReceiveSettings:          tc.ReceiveSettings,
+			}
+			config.setDefaults()
+
+			assert.Equal(t, tc.ExpectedReceiveSettings, config.ReceiveSettings)
+		})
+	}
+}
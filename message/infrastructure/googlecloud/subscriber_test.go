@@ -0,0 +1,47 @@
+package googlecloud_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/googlecloud"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	testCases := []struct {
+		Name      string
+		Err       error
+		Retryable bool
+	}{
+		{
+			Name:      "unavailable",
+			Err:       status.Error(codes.Unavailable, "unavailable"),
+			Retryable: true,
+		},
+		{
+			Name:      "wrapped_deadline_exceeded",
+			Err:       errors.Wrap(status.Error(codes.DeadlineExceeded, "deadline exceeded"), "could not check if subscription exists"),
+			Retryable: true,
+		},
+		{
+			Name:      "permission_denied",
+			Err:       status.Error(codes.PermissionDenied, "permission denied"),
+			Retryable: false,
+		},
+		{
+			Name:      "not_grpc_error",
+			Err:       googlecloud.ErrSubscriptionDoesNotExist,
+			Retryable: false,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.Name, func(t *testing.T) {
+			assert.Equal(t, c.Retryable, googlecloud.IsRetryableError(c.Err))
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package googlecloud
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_subscriptionName(t *testing.T) {
+	s := &Subscriber{config: SubscriberConfig{
+		ProjectID:                "project",
+		GenerateSubscriptionName: TopicSubscriptionNameWithSuffix("_sub"),
+		TopicProject: func(topic string) string {
+			if topic == "mapped_topic" {
+				return "mapped-project"
+			}
+			return ""
+		},
+	}}
+
+	assert.Equal(t, "orders_sub", s.subscriptionName("orders"))
+	assert.Equal(t, "orders_sub", s.subscriptionName(FullyQualifiedTopic("project", "orders")))
+	assert.Equal(t, "a_orders_sub", s.subscriptionName(FullyQualifiedTopic("a", "orders")))
+	assert.Equal(t, "b_orders_sub", s.subscriptionName(FullyQualifiedTopic("b", "orders")))
+	assert.Equal(t, "mapped-project_mapped_topic_sub", s.subscriptionName("mapped_topic"))
+}
+
+func TestActiveSubscription_subscriptionOf(t *testing.T) {
+	sub := &pubsub.Subscription{}
+	active := activeSubscription{sub: sub, topic: FullyQualifiedTopic("a", "orders")}
+
+	activeSub, err := active.subscriptionOf(FullyQualifiedTopic("a", "orders"))
+	require.NoError(t, err)
+	assert.Equal(t, sub, activeSub)
+
+	_, err = active.subscriptionOf(FullyQualifiedTopic("b", "orders"))
+	assert.Equal(t, ErrUnexpectedTopic, errors.Cause(err))
+}
+
+func TestSubscriptionConfigDrift(t *testing.T) {
+	existing := pubsub.SubscriptionConfig{
+		AckDeadline:         time.Second * 10,
+		RetainAckedMessages: true,
+		RetentionDuration:   time.Hour * 24,
+		PushConfig:          pubsub.PushConfig{Endpoint: "https://example.com/push"},
+		Labels:              map[string]string{"team": "orders"},
+	}
+
+	otherPushConfig := pubsub.PushConfig{Endpoint: "https://example.com/other"}
+
+	testCases := []struct {
+		Name                       string
+		Existing                   pubsub.SubscriptionConfig
+		Desired                    pubsub.SubscriptionConfig
+		CompareRetainAckedMessages bool
+
+		ExpectedUpdate pubsub.SubscriptionConfigToUpdate
+		ExpectedDrift  []string
+	}{
+		{
+			Name:     "same",
+			Existing: existing,
+			Desired:  existing,
+		},
+		{
+			Name:     "unset",
+			Existing: existing,
+			Desired:  pubsub.SubscriptionConfig{},
+		},
+		{
+			Name:           "ack_deadline",
+			Existing:       existing,
+			Desired:        pubsub.SubscriptionConfig{AckDeadline: time.Second * 30},
+			ExpectedUpdate: pubsub.SubscriptionConfigToUpdate{AckDeadline: time.Second * 30},
+			ExpectedDrift:  []string{"AckDeadline"},
+		},
+		{
+			Name:           "ack_deadline_set_on_unset",
+			Existing:       pubsub.SubscriptionConfig{},
+			Desired:        pubsub.SubscriptionConfig{AckDeadline: time.Second * 10},
+			ExpectedUpdate: pubsub.SubscriptionConfigToUpdate{AckDeadline: time.Second * 10},
+			ExpectedDrift:  []string{"AckDeadline"},
+		},
+		{
+			Name:           "retain_acked_messages_enabled",
+			Existing:       pubsub.SubscriptionConfig{},
+			Desired:        pubsub.SubscriptionConfig{RetainAckedMessages: true},
+			ExpectedUpdate: pubsub.SubscriptionConfigToUpdate{RetainAckedMessages: true},
+			ExpectedDrift:  []string{"RetainAckedMessages"},
+		},
+		{
+			// false can't be distinguished from not set, so it's not compared by default
+			Name:     "retain_acked_messages_disabled_not_compared",
+			Existing: pubsub.SubscriptionConfig{RetainAckedMessages: true},
+			Desired:  pubsub.SubscriptionConfig{RetainAckedMessages: false},
+		},
+		{
+			Name:                       "retain_acked_messages_disabled_compared",
+			Existing:                   pubsub.SubscriptionConfig{RetainAckedMessages: true},
+			Desired:                    pubsub.SubscriptionConfig{RetainAckedMessages: false},
+			CompareRetainAckedMessages: true,
+			ExpectedUpdate:             pubsub.SubscriptionConfigToUpdate{RetainAckedMessages: false},
+			ExpectedDrift:              []string{"RetainAckedMessages"},
+		},
+		{
+			Name:                       "retain_acked_messages_same_compared",
+			Existing:                   pubsub.SubscriptionConfig{RetainAckedMessages: false},
+			Desired:                    pubsub.SubscriptionConfig{RetainAckedMessages: false},
+			CompareRetainAckedMessages: true,
+		},
+		{
+			Name:           "retention_duration",
+			Existing:       existing,
+			Desired:        pubsub.SubscriptionConfig{RetentionDuration: time.Hour},
+			ExpectedUpdate: pubsub.SubscriptionConfigToUpdate{RetentionDuration: time.Hour},
+			ExpectedDrift:  []string{"RetentionDuration"},
+		},
+		{
+			Name:           "push_config",
+			Existing:       existing,
+			Desired:        pubsub.SubscriptionConfig{PushConfig: otherPushConfig},
+			ExpectedUpdate: pubsub.SubscriptionConfigToUpdate{PushConfig: &otherPushConfig},
+			ExpectedDrift:  []string{"PushConfig"},
+		},
+		{
+			Name:     "push_config_without_endpoint",
+			Existing: existing,
+			Desired: pubsub.SubscriptionConfig{
+				PushConfig: pubsub.PushConfig{Attributes: map[string]string{"x-goog-version": "v1"}},
+			},
+		},
+		{
+			Name:           "labels",
+			Existing:       existing,
+			Desired:        pubsub.SubscriptionConfig{Labels: map[string]string{"team": "payments"}},
+			ExpectedUpdate: pubsub.SubscriptionConfigToUpdate{Labels: map[string]string{"team": "payments"}},
+			ExpectedDrift:  []string{"Labels"},
+		},
+		{
+			Name:           "labels_removed",
+			Existing:       existing,
+			Desired:        pubsub.SubscriptionConfig{Labels: map[string]string{}},
+			ExpectedUpdate: pubsub.SubscriptionConfigToUpdate{Labels: map[string]string{}},
+			ExpectedDrift:  []string{"Labels"},
+		},
+		{
+			Name:     "all",
+			Existing: pubsub.SubscriptionConfig{},
+			Desired:  existing,
+			ExpectedUpdate: pubsub.SubscriptionConfigToUpdate{
+				AckDeadline:         existing.AckDeadline,
+				RetainAckedMessages: true,
+				RetentionDuration:   existing.RetentionDuration,
+				PushConfig:          &existing.PushConfig,
+				Labels:              existing.Labels,
+			},
+			ExpectedDrift: []string{"AckDeadline", "RetainAckedMessages", "RetentionDuration", "PushConfig", "Labels"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			update, drift := subscriptionConfigDrift(tc.Existing, tc.Desired, tc.CompareRetainAckedMessages)
+
+			assert.Equal(t, tc.ExpectedUpdate, update)
+
+			var driftedSettings []string
+			for _, d := range drift {
+				driftedSettings = append(driftedSettings, strings.SplitN(d, ":", 2)[0])
+			}
+			assert.Equal(t, tc.ExpectedDrift, driftedSettings)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/cloudevents"
+)
+
+// CloudEventsMarshalMessageFunc returns a MarshalMessageFunc, which transforms the message into a HTTP POST request
+// with the CloudEvent in the structured content mode as the body.
+//
+// The url is passed to the codec as the topic.
+func CloudEventsMarshalMessageFunc(codec cloudevents.Codec) MarshalMessageFunc {
+	return func(url string, msg *message.Message) (*http.Request, error) {
+		event, err := codec.Marshal(url, msg)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(event))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", cloudevents.ContentType)
+		return req, nil
+	}
+}
+
+// CloudEventsUnmarshalMessageFunc returns an UnmarshalMessageFunc, which reads the CloudEvent
+// in the structured content mode from the request's body, as encoded by CloudEventsMarshalMessageFunc.
+func CloudEventsUnmarshalMessageFunc(codec cloudevents.Codec) UnmarshalMessageFunc {
+	return func(topic string, req *http.Request) (*message.Message, error) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		msg, err := codec.Unmarshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not unmarshal CloudEvent from request")
+		}
+
+		return msg, nil
+	}
+}
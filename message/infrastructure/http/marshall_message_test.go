@@ -1,6 +1,7 @@
 package http_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -9,7 +10,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/cloudevents"
 	watermill_http "github.com/ThreeDotsLabs/watermill/message/infrastructure/http"
 )
 
@@ -45,3 +48,37 @@ func TestDefaultMarshalMessageFunc(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, metadataValue, metadata.Get(metadataKey))
 }
+
+func TestCloudEventsMarshalMessageFunc(t *testing.T) {
+	codec := cloudevents.Codec{Source: cloudevents.Static("/orders-service")}
+
+	url := "http://some-server.domain/topic"
+	req, err := watermill_http.CloudEventsMarshalMessageFunc(codec)(url, msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, url, req.URL.String())
+	assert.Equal(t, cloudevents.ContentType, req.Header.Get("Content-Type"))
+
+	unmarshaledMsg, err := watermill_http.CloudEventsUnmarshalMessageFunc(codec)("topic", req)
+	require.NoError(t, err)
+
+	assert.Equal(t, msgUUID, unmarshaledMsg.UUID)
+	assert.EqualValues(t, msgPayload, unmarshaledMsg.Payload)
+	assert.Equal(t, metadataValue, unmarshaledMsg.Metadata.Get(metadataKey))
+	assert.Equal(t, "/orders-service", unmarshaledMsg.Metadata.Get(cloudevents.SourceMetadataKey))
+}
+
+func TestDefaultUnmarshalMessageFunc_generates_missing_uuid(t *testing.T) {
+	defer watermill.SetMessageUUIDGenerator(watermill.NewUUID)
+	watermill.SetMessageUUIDGenerator(watermill.NewSequentialUUIDGenerator("http"))
+
+	req, err := http.NewRequest(http.MethodPost, "http://some-server.domain/topic", bytes.NewReader(msgPayload))
+	require.NoError(t, err)
+
+	unmarshaledMsg, err := watermill_http.DefaultUnmarshalMessageFunc("topic", req)
+	require.NoError(t, err)
+
+	assert.Equal(t, "http-00000000000000000001", unmarshaledMsg.UUID)
+	assert.EqualValues(t, msgPayload, unmarshaledMsg.Payload)
+}
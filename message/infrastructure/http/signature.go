@@ -0,0 +1,192 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidSignature is returned by SignatureVerifier, when the request's signature is missing or invalid.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// ErrEmptySecret is returned by the signature verifiers configured without Secret,
+// so all requests are rejected instead of accepting signatures made with an empty key.
+var ErrEmptySecret = errors.New("empty signature secret")
+
+// SignatureVerifier verifies the signature of the webhook request.
+// Requests which fail the verification are rejected with 401 HTTP status, before the message is created.
+type SignatureVerifier interface {
+	// Verify returns an error, when the signature of the request with the provided body is invalid.
+	Verify(r *http.Request, body []byte) error
+}
+
+// SignatureVerifierFunc is a function implementing SignatureVerifier.
+type SignatureVerifierFunc func(r *http.Request, body []byte) error
+
+func (f SignatureVerifierFunc) Verify(r *http.Request, body []byte) error {
+	return f(r, body)
+}
+
+// DefaultSignatureHeader is the header with the signature checked by HMACSHA256Verifier.
+const DefaultSignatureHeader = "X-Signature"
+
+// HMACSHA256Verifier verifies hex encoded HMAC-SHA256 signature of the request's body, sent in the Header.
+type HMACSHA256Verifier struct {
+	Secret []byte
+
+	// Header with the signature. DefaultSignatureHeader is used when empty.
+	Header string
+}
+
+func (v HMACSHA256Verifier) Verify(r *http.Request, body []byte) error {
+	if len(v.Secret) == 0 {
+		return ErrEmptySecret
+	}
+
+	header := v.Header
+	if header == "" {
+		header = DefaultSignatureHeader
+	}
+
+	signature := r.Header.Get(header)
+	if signature == "" {
+		return errors.Wrapf(ErrInvalidSignature, "missing %s header", header)
+	}
+
+	return verifyHexSignature(sha256.New, v.Secret, body, signature)
+}
+
+// GitHubVerifier verifies the signatures of GitHub webhooks.
+//
+// The X-Hub-Signature-256 header (HMAC-SHA256) is checked when present,
+// otherwise the legacy X-Hub-Signature header (HMAC-SHA1) is checked.
+//
+// See https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries.
+type GitHubVerifier struct {
+	Secret []byte
+}
+
+func (v GitHubVerifier) Verify(r *http.Request, body []byte) error {
+	if len(v.Secret) == 0 {
+		return ErrEmptySecret
+	}
+
+	if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+		if !strings.HasPrefix(signature, "sha256=") {
+			return errors.Wrap(ErrInvalidSignature, "X-Hub-Signature-256 header should start with sha256=")
+		}
+		return verifyHexSignature(sha256.New, v.Secret, body, strings.TrimPrefix(signature, "sha256="))
+	}
+
+	if signature := r.Header.Get("X-Hub-Signature"); signature != "" {
+		if !strings.HasPrefix(signature, "sha1=") {
+			return errors.Wrap(ErrInvalidSignature, "X-Hub-Signature header should start with sha1=")
+		}
+		return verifyHexSignature(sha1.New, v.Secret, body, strings.TrimPrefix(signature, "sha1="))
+	}
+
+	return errors.Wrap(ErrInvalidSignature, "missing X-Hub-Signature-256 and X-Hub-Signature headers")
+}
+
+// DefaultStripeTolerance is the default maximum age of Stripe webhooks.
+const DefaultStripeTolerance = time.Minute * 5
+
+// StripeVerifier verifies the signatures of Stripe webhooks, sent in the Stripe-Signature header.
+//
+// The signature covers the timestamp of the request, so requests older than Tolerance are rejected
+// to prevent replay attacks.
+//
+// See https://stripe.com/docs/webhooks/signatures.
+type StripeVerifier struct {
+	Secret []byte
+
+	// Tolerance is the maximum difference between the timestamp of the request and the current time.
+	// DefaultStripeTolerance is used when empty.
+	Tolerance time.Duration
+
+	// Now returns the current time. time.Now is used when nil.
+	Now func() time.Time
+}
+
+func (v StripeVerifier) Verify(r *http.Request, body []byte) error {
+	if len(v.Secret) == 0 {
+		return ErrEmptySecret
+	}
+
+	header := r.Header.Get("Stripe-Signature")
+	if header == "" {
+		return errors.Wrap(ErrInvalidSignature, "missing Stripe-Signature header")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.Wrap(ErrInvalidSignature, "Stripe-Signature header should contain t and v1 values")
+	}
+
+	unixTimestamp, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Wrap(ErrInvalidSignature, "invalid timestamp")
+	}
+
+	tolerance := v.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultStripeTolerance
+	}
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+
+	age := now().Sub(time.Unix(unixTimestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return errors.Wrapf(ErrInvalidSignature, "timestamp is outside of the tolerance of %s", tolerance)
+	}
+
+	signedPayload := append([]byte(timestamp+"."), body...)
+	for _, signature := range signatures {
+		if err := verifyHexSignature(sha256.New, v.Secret, signedPayload, signature); err == nil {
+			return nil
+		}
+	}
+
+	return errors.Wrap(ErrInvalidSignature, "no matching v1 signature")
+}
+
+func verifyHexSignature(h func() hash.Hash, secret []byte, payload []byte, signature string) error {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(ErrInvalidSignature, "signature is not hex encoded")
+	}
+
+	mac := hmac.New(h, secret)
+	_, _ = mac.Write(payload)
+
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	stdHttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/http"
+)
+
+var (
+	webhookSecret = []byte("secret")
+	webhookBody   = []byte(`{"event":"created"}`)
+)
+
+func sign(h func() hash.Hash, payload []byte) string {
+	mac := hmac.New(h, webhookSecret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookRequest(headers map[string]string) *stdHttp.Request {
+	r := httptest.NewRequest(stdHttp.MethodPost, "/webhook", bytes.NewReader(webhookBody))
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestHMACSHA256Verifier(t *testing.T) {
+	verifier := http.HMACSHA256Verifier{Secret: webhookSecret}
+
+	assert.NoError(t, verifier.Verify(
+		webhookRequest(map[string]string{http.DefaultSignatureHeader: sign(sha256.New, webhookBody)}),
+		webhookBody,
+	))
+
+	err := verifier.Verify(
+		webhookRequest(map[string]string{http.DefaultSignatureHeader: sign(sha256.New, []byte("other"))}),
+		webhookBody,
+	)
+	assert.Equal(t, http.ErrInvalidSignature, errors.Cause(err))
+
+	err = verifier.Verify(webhookRequest(nil), webhookBody)
+	assert.Equal(t, http.ErrInvalidSignature, errors.Cause(err))
+}
+
+func TestGitHubVerifier(t *testing.T) {
+	verifier := http.GitHubVerifier{Secret: webhookSecret}
+
+	assert.NoError(t, verifier.Verify(
+		webhookRequest(map[string]string{"X-Hub-Signature-256": "sha256=" + sign(sha256.New, webhookBody)}),
+		webhookBody,
+	))
+	assert.NoError(t, verifier.Verify(
+		webhookRequest(map[string]string{"X-Hub-Signature": "sha1=" + sign(sha1.New, webhookBody)}),
+		webhookBody,
+	))
+
+	err := verifier.Verify(
+		webhookRequest(map[string]string{"X-Hub-Signature-256": sign(sha256.New, webhookBody)}),
+		webhookBody,
+	)
+	assert.Equal(t, http.ErrInvalidSignature, errors.Cause(err), "missing sha256= prefix")
+}
+
+func TestStripeVerifier(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	verifier := http.StripeVerifier{
+		Secret:    webhookSecret,
+		Tolerance: time.Minute,
+		Now:       func() time.Time { return now },
+	}
+
+	stripeHeader := func(timestamp time.Time) string {
+		t := strconv.FormatInt(timestamp.Unix(), 10)
+		signature := sign(sha256.New, append([]byte(t+"."), webhookBody...))
+		return fmt.Sprintf("t=%s,v1=%s,v0=ignored", t, signature)
+	}
+
+	assert.NoError(t, verifier.Verify(
+		webhookRequest(map[string]string{"Stripe-Signature": stripeHeader(now.Add(-time.Second * 30))}),
+		webhookBody,
+	))
+
+	err := verifier.Verify(
+		webhookRequest(map[string]string{"Stripe-Signature": stripeHeader(now.Add(-time.Minute * 2))}),
+		webhookBody,
+	)
+	assert.Equal(t, http.ErrInvalidSignature, errors.Cause(err), "timestamp outside of the tolerance")
+
+	err = verifier.Verify(
+		webhookRequest(map[string]string{"Stripe-Signature": "t=1500000000,v1=abcd"}),
+		webhookBody,
+	)
+	assert.Equal(t, http.ErrInvalidSignature, errors.Cause(err))
+}
+
+func TestSignatureVerifiers_empty_secret(t *testing.T) {
+	emptyKeySignature := func(h func() hash.Hash, payload []byte) string {
+		mac := hmac.New(h, nil)
+		mac.Write(payload)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	testCases := []struct {
+		Name     string
+		Verifier http.SignatureVerifier
+		Headers  map[string]string
+	}{
+		{
+			Name:     "hmac_sha256",
+			Verifier: http.HMACSHA256Verifier{},
+			Headers:  map[string]string{http.DefaultSignatureHeader: emptyKeySignature(sha256.New, webhookBody)},
+		},
+		{
+			Name:     "github",
+			Verifier: http.GitHubVerifier{Secret: []byte{}},
+			Headers:  map[string]string{"X-Hub-Signature-256": "sha256=" + emptyKeySignature(sha256.New, webhookBody)},
+		},
+		{
+			Name:     "stripe",
+			Verifier: http.StripeVerifier{},
+			Headers: map[string]string{"Stripe-Signature": fmt.Sprintf(
+				"t=%s,v1=%s",
+				timestamp,
+				emptyKeySignature(sha256.New, append([]byte(timestamp+"."), webhookBody...)),
+			)},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			err := tc.Verifier.Verify(webhookRequest(tc.Headers), webhookBody)
+			assert.Equal(t, http.ErrEmptySecret, errors.Cause(err))
+		})
+	}
+}
+
+func TestSubscriber_rejects_invalid_signature(t *testing.T) {
+	sub, err := http.NewSubscriber(":0", http.SubscriberConfig{
+		SignatureVerifier: http.HMACSHA256Verifier{Secret: webhookSecret},
+	}, watermill.NewStdLogger(true, true))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, sub.Close())
+	}()
+
+	msgs, err := sub.Subscribe(context.Background(), "/webhook")
+	require.NoError(t, err)
+
+	go sub.StartHTTPServer()
+	waitForHTTP(t, sub, time.Second*10)
+
+	url := fmt.Sprintf("http://%s/webhook", sub.Addr())
+
+	resp, err := stdHttp.Post(url, "application/json", bytes.NewReader(webhookBody))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, stdHttp.StatusUnauthorized, resp.StatusCode)
+
+	go func() {
+		msg := <-msgs
+		assert.Equal(t, webhookBody, []byte(msg.Payload))
+		msg.Ack()
+	}()
+
+	req, err := stdHttp.NewRequest(stdHttp.MethodPost, url, bytes.NewReader(webhookBody))
+	require.NoError(t, err)
+	req.Header.Set(http.DefaultSignatureHeader, sign(sha256.New, webhookBody))
+
+	resp, err = stdHttp.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, stdHttp.StatusOK, resp.StatusCode)
+}
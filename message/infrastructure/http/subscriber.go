@@ -1,6 +1,7 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io/ioutil"
@@ -20,6 +21,7 @@ type UnmarshalMessageFunc func(topic string, request *http.Request) (*message.Me
 
 // DefaultUnmarshalMessageFunc retrieves the UUID and Metadata from request headers,
 // as encoded by DefaultMarshalMessageFunc.
+// When the request has no UUID header, the UUID is generated with watermill.NewMessageUUID.
 func DefaultUnmarshalMessageFunc(topic string, req *http.Request) (*message.Message, error) {
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
@@ -27,6 +29,9 @@ func DefaultUnmarshalMessageFunc(topic string, req *http.Request) (*message.Mess
 	}
 
 	uuid := req.Header.Get(HeaderUUID)
+	if uuid == "" {
+		uuid = watermill.NewMessageUUID()
+	}
 	msg := message.NewMessage(uuid, body)
 
 	metadata := req.Header.Get(HeaderMetadata)
@@ -43,6 +48,11 @@ func DefaultUnmarshalMessageFunc(topic string, req *http.Request) (*message.Mess
 type SubscriberConfig struct {
 	Router               chi.Router
 	UnmarshalMessageFunc UnmarshalMessageFunc
+
+	// SignatureVerifier is optional. When set, requests with invalid signatures are rejected
+	// with 401 HTTP status before UnmarshalMessageFunc is called.
+	// See HMACSHA256Verifier, GitHubVerifier and StripeVerifier.
+	SignatureVerifier SignatureVerifier
 }
 
 func (s *SubscriberConfig) setDefaults() {
@@ -110,6 +120,14 @@ func (s *Subscriber) Subscribe(ctx context.Context, url string) (<-chan *message
 	}
 
 	s.config.Router.Post(url, func(w http.ResponseWriter, r *http.Request) {
+		if s.config.SignatureVerifier != nil {
+			if err := s.verifySignature(r); err != nil {
+				s.logger.Info("Invalid request signature", baseLogFields.Add(watermill.LogFields{"err": err}))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
 		msg, err := s.config.UnmarshalMessageFunc(url, r)
 
 		ctx, cancelCtx := context.WithCancel(ctx)
@@ -148,6 +166,17 @@ func (s *Subscriber) Subscribe(ctx context.Context, url string) (<-chan *message
 	return messages, nil
 }
 
+// verifySignature verifies the request's signature, leaving the body readable for UnmarshalMessageFunc.
+func (s *Subscriber) verifySignature(r *http.Request) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.Wrap(err, "cannot read request body")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return s.config.SignatureVerifier.Verify(r, body)
+}
+
 // StartHTTPServer starts http server.
 // It must be called after all Subscribe calls have completed.
 // Just like http.Server.Serve(), it returns http.ErrServerClosed after the server's been closed.
@@ -0,0 +1,219 @@
+package kafka
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type AsyncPublisherConfig struct {
+	// FlushFrequency overrides Producer.Flush.Frequency of the Sarama config.
+	// It is the best-effort frequency of flushing batched messages.
+	FlushFrequency time.Duration
+
+	// FlushMessages overrides Producer.Flush.Messages of the Sarama config.
+	// It is the best-effort number of messages which triggers a flush.
+	FlushMessages int
+
+	// OnError is called for every message which failed to be published.
+	// When nil, failures are only logged.
+	OnError func(msg *message.Message, err error)
+
+	// ProducerInterceptors are called in order with every marshaled record, before it's passed to the producer.
+	// See PublisherConfig.ProducerInterceptors.
+	ProducerInterceptors []ProducerInterceptor
+
+	// TopicMapper is optional and maps topics passed to the AsyncPublisher to names of Kafka topics.
+	TopicMapper TopicMapper
+}
+
+func (c AsyncPublisherConfig) Validate() error {
+	if c.FlushFrequency < 0 {
+		return errors.New("FlushFrequency cannot be negative")
+	}
+	if c.FlushMessages < 0 {
+		return errors.New("FlushMessages cannot be negative")
+	}
+
+	return nil
+}
+
+// overwriteSaramaConfig returns a copy of saramaConfig with the flush settings from the config applied.
+func (c AsyncPublisherConfig) overwriteSaramaConfig(saramaConfig *sarama.Config) *sarama.Config {
+	overwritten := *saramaConfig
+
+	if c.FlushFrequency != 0 {
+		overwritten.Producer.Flush.Frequency = c.FlushFrequency
+	}
+	if c.FlushMessages != 0 {
+		overwritten.Producer.Flush.Messages = c.FlushMessages
+	}
+
+	// errors are required to call OnError, successes are not read by AsyncPublisher
+	overwritten.Producer.Return.Errors = true
+	overwritten.Producer.Return.Successes = false
+
+	return &overwritten
+}
+
+// AsyncPublisher publishes messages to Kafka in batches, using Sarama's AsyncProducer.
+//
+// In contrast to Publisher, Publish doesn't wait for ack from Kafka, so it should be used
+// when latency matters more than the per-message confirmation.
+// Failures are reported to AsyncPublisherConfig.OnError.
+type AsyncPublisher struct {
+	producer     sarama.AsyncProducer
+	marshaler    Marshaler
+	config       AsyncPublisherConfig
+	saramaConfig *sarama.Config
+
+	logger watermill.LoggerAdapter
+
+	// closing releases Publish calls blocked on the producer's input, so Close doesn't wait for them,
+	// for example when OnError publishes again while the input is full.
+	closing    chan struct{}
+	closed     bool
+	closedLock sync.Mutex
+	publishWg  sync.WaitGroup
+	errorsWg   sync.WaitGroup
+}
+
+// NewAsyncPublisher creates a new AsyncPublisher.
+func NewAsyncPublisher(
+	brokers []string,
+	config AsyncPublisherConfig,
+	marshaler Marshaler,
+	overwriteSaramaConfig *sarama.Config,
+	logger watermill.LoggerAdapter,
+) (*AsyncPublisher, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid AsyncPublisher config")
+	}
+
+	if overwriteSaramaConfig == nil {
+		overwriteSaramaConfig = DefaultSaramaAsyncPublisherConfig()
+	}
+	overwriteSaramaConfig = config.overwriteSaramaConfig(overwriteSaramaConfig)
+
+	producer, err := sarama.NewAsyncProducer(brokers, overwriteSaramaConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create Kafka producer")
+	}
+
+	return newAsyncPublisher(producer, config, marshaler, overwriteSaramaConfig, logger), nil
+}
+
+func newAsyncPublisher(
+	producer sarama.AsyncProducer,
+	config AsyncPublisherConfig,
+	marshaler Marshaler,
+	saramaConfig *sarama.Config,
+	logger watermill.LoggerAdapter,
+) *AsyncPublisher {
+	p := &AsyncPublisher{
+		producer:     producer,
+		marshaler:    interceptedMarshaler(marshaler, config.ProducerInterceptors),
+		config:       config,
+		saramaConfig: saramaConfig,
+		logger:       logger,
+		closing:      make(chan struct{}),
+	}
+
+	p.errorsWg.Add(1)
+	go p.handleErrors()
+
+	return p
+}
+
+func DefaultSaramaAsyncPublisherConfig() *sarama.Config {
+	config := DefaultSaramaSyncPublisherConfig()
+	config.Producer.Return.Successes = false
+
+	return config
+}
+
+// Publish passes messages to the producer and returns immediately, without waiting for ack from Kafka.
+// It blocks only when the producer's input is full.
+func (p *AsyncPublisher) Publish(topic string, msgs ...*message.Message) error {
+	p.closedLock.Lock()
+	if p.closed {
+		p.closedLock.Unlock()
+		return errors.New("publisher closed")
+	}
+	p.publishWg.Add(1)
+	p.closedLock.Unlock()
+	defer p.publishWg.Done()
+
+	kafkaTopic := p.config.TopicMapper.kafkaTopic(topic)
+
+	for _, msg := range msgs {
+		kafkaMsg, err := p.marshaler.Marshal(kafkaTopic, msg)
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal message %s", msg.UUID)
+		}
+		// checked before sending, because errors returned by the producer are reported only to OnError
+		if err := checkMessageSize(msg.UUID, kafkaMsg, p.saramaConfig); err != nil {
+			return err
+		}
+		kafkaMsg.Metadata = msg
+
+		p.logger.Trace("Sending message to Kafka asynchronously", watermill.LogFields{
+			"topic":        topic,
+			"kafka_topic":  kafkaTopic,
+			"message_uuid": msg.UUID,
+		})
+
+		select {
+		case p.producer.Input() <- kafkaMsg:
+		case <-p.closing:
+			return errors.Errorf("publisher closed before message %s was sent", msg.UUID)
+		}
+	}
+
+	return nil
+}
+
+func (p *AsyncPublisher) handleErrors() {
+	defer p.errorsWg.Done()
+
+	for producerErr := range p.producer.Errors() {
+		msg, _ := producerErr.Msg.Metadata.(*message.Message)
+
+		logFields := watermill.LogFields{"topic": producerErr.Msg.Topic}
+		if msg != nil {
+			logFields["message_uuid"] = msg.UUID
+		}
+		p.logger.Error("Cannot produce message", producerErr.Err, logFields)
+
+		if p.config.OnError != nil && msg != nil {
+			p.config.OnError(msg, producerErr.Err)
+		}
+	}
+}
+
+// Close flushes all buffered messages and closes the producer.
+// Publish calls blocked on the full producer's input return an error.
+func (p *AsyncPublisher) Close() error {
+	p.closedLock.Lock()
+	if p.closed {
+		p.closedLock.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.closing)
+	p.closedLock.Unlock()
+
+	// the producer's input can't be used after AsyncClose
+	p.publishWg.Wait()
+
+	// errors are read by handleErrors, so AsyncClose is used instead of Close
+	p.producer.AsyncClose()
+	p.errorsWg.Wait()
+
+	return nil
+}
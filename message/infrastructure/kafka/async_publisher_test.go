@@ -0,0 +1,138 @@
+package kafka
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func newMockedAsyncPublisher(t *testing.T, config AsyncPublisherConfig) (*AsyncPublisher, *mocks.AsyncProducer) {
+	saramaConfig := config.overwriteSaramaConfig(DefaultSaramaAsyncPublisherConfig())
+	producer := mocks.NewAsyncProducer(t, saramaConfig)
+
+	return newAsyncPublisher(producer, config, DefaultMarshaler{}, saramaConfig, watermill.NopLogger{}), producer
+}
+
+func TestAsyncPublisher_OnError(t *testing.T) {
+	var failedLock sync.Mutex
+	failed := map[string]error{}
+
+	pub, producer := newMockedAsyncPublisher(t, AsyncPublisherConfig{
+		OnError: func(msg *message.Message, err error) {
+			failedLock.Lock()
+			defer failedLock.Unlock()
+			failed[msg.UUID] = err
+		},
+	})
+
+	produceErr := errors.New("leader not available")
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(produceErr)
+
+	succeededMsg := message.NewMessage(watermill.NewUUID(), []byte("1"))
+	failedMsg := message.NewMessage(watermill.NewUUID(), []byte("2"))
+	require.NoError(t, pub.Publish("topic", succeededMsg, failedMsg))
+
+	require.NoError(t, pub.Close())
+
+	assert.Equal(t, map[string]error{failedMsg.UUID: produceErr}, failed)
+}
+
+func TestAsyncPublisher_ProducerInterceptors(t *testing.T) {
+	pub, producer := newMockedAsyncPublisher(t, AsyncPublisherConfig{
+		ProducerInterceptors: []ProducerInterceptor{
+			ProducerInterceptorFunc(func(msg *sarama.ProducerMessage) error {
+				msg.Value = sarama.ByteEncoder("scrubbed")
+				return nil
+			}),
+		},
+	})
+
+	producer.ExpectInputWithCheckerFunctionAndSucceed(func(val []byte) error {
+		if string(val) != "scrubbed" {
+			return errors.Errorf("unexpected value %s", val)
+		}
+		return nil
+	})
+
+	require.NoError(t, pub.Publish("topic", message.NewMessage(watermill.NewUUID(), []byte("secret"))))
+	require.NoError(t, pub.Close())
+}
+
+func TestAsyncPublisher_Close_flushes_messages(t *testing.T) {
+	pub, producer := newMockedAsyncPublisher(t, AsyncPublisherConfig{})
+
+	var messages message.Messages
+	for i := 0; i < 100; i++ {
+		producer.ExpectInputAndSucceed()
+		messages = append(messages, message.NewMessage(watermill.NewUUID(), nil))
+	}
+	require.NoError(t, pub.Publish("topic", messages...))
+
+	// the mock reports the messages left in the input as unmet expectations
+	require.NoError(t, pub.Close())
+	require.NoError(t, pub.Close(), "closing again should be a no-op")
+}
+
+func TestAsyncPublisher_publish_after_close(t *testing.T) {
+	pub, _ := newMockedAsyncPublisher(t, AsyncPublisherConfig{})
+	require.NoError(t, pub.Close())
+
+	err := pub.Publish("topic", message.NewMessage(watermill.NewUUID(), nil))
+	assert.Error(t, err)
+}
+
+// blockedAsyncProducer never reads its input, like a producer with the input full.
+type blockedAsyncProducer struct {
+	sarama.AsyncProducer
+	input  chan *sarama.ProducerMessage
+	errors chan *sarama.ProducerError
+}
+
+func (p blockedAsyncProducer) Input() chan<- *sarama.ProducerMessage { return p.input }
+func (p blockedAsyncProducer) Errors() <-chan *sarama.ProducerError  { return p.errors }
+func (p blockedAsyncProducer) AsyncClose()                           { close(p.errors) }
+
+func TestAsyncPublisher_Close_with_blocked_Publish(t *testing.T) {
+	producer := blockedAsyncProducer{
+		input:  make(chan *sarama.ProducerMessage),
+		errors: make(chan *sarama.ProducerError),
+	}
+	pub := newAsyncPublisher(producer, AsyncPublisherConfig{}, DefaultMarshaler{}, DefaultSaramaAsyncPublisherConfig(), watermill.NopLogger{})
+
+	published := make(chan error, 1)
+	go func() {
+		published <- pub.Publish("topic", message.NewMessage(watermill.NewUUID(), nil))
+	}()
+
+	// waiting for Publish to block on the input
+	time.Sleep(time.Millisecond * 50)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- pub.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Close blocked by Publish")
+	}
+
+	select {
+	case err := <-published:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Publish not released by Close")
+	}
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	internalSync "github.com/ThreeDotsLabs/watermill/internal/sync"
+)
+
+// ClientPool shares a single Sarama client between Publishers and Subscribers of the process,
+// so the number of connections to the brokers doesn't grow with the number of handlers.
+//
+// The client is created, when the first Publisher or Subscription uses the pool,
+// and it's closed, when all of them are closed.
+//
+// The Sarama config of the pool is used by all of them, so settings overriding the Sarama config
+// in PublisherConfig and SubscriberConfig cannot be used together with the pool.
+type ClientPool struct {
+	brokers      []string
+	saramaConfig *sarama.Config
+
+	client *internalSync.RefCounted
+}
+
+// NewClientPool creates a new ClientPool.
+//
+// saramaConfig defaults to DefaultSaramaClientPoolConfig(). It must have Producer.Return.Successes enabled,
+// when the pool is used by the Publisher.
+func NewClientPool(brokers []string, saramaConfig *sarama.Config) (*ClientPool, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("missing brokers")
+	}
+	if saramaConfig == nil {
+		saramaConfig = DefaultSaramaClientPoolConfig()
+	}
+	if err := saramaConfig.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Sarama config")
+	}
+
+	return &ClientPool{
+		brokers:      brokers,
+		saramaConfig: saramaConfig,
+		client: internalSync.NewRefCounted(
+			func() (interface{}, error) {
+				return sarama.NewClient(brokers, saramaConfig)
+			},
+			func(client interface{}) error {
+				return client.(sarama.Client).Close()
+			},
+		),
+	}, nil
+}
+
+// DefaultSaramaClientPoolConfig returns the Sarama config usable by both the Publisher and the Subscriber.
+func DefaultSaramaClientPoolConfig() *sarama.Config {
+	config := DefaultSaramaSyncPublisherConfig()
+	config.Consumer.Return.Errors = true
+
+	return config
+}
+
+func (p *ClientPool) acquire() (sarama.Client, error) {
+	client, err := p.client.Acquire()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create shared Sarama client")
+	}
+
+	return client.(sarama.Client), nil
+}
+
+func (p *ClientPool) release() error {
+	return p.client.Release()
+}
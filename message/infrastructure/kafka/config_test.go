@@ -0,0 +1,225 @@
+package kafka_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/kafka"
+)
+
+type subscriberConfigTestCase struct {
+	Name        string
+	Config      kafka.SubscriberConfig
+	ExpectedErr bool
+}
+
+func testSubscriberConfigValidate(t *testing.T, testCases []subscriberConfigTestCase) {
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.Config.Brokers = []string{"localhost:9092"}
+
+			err := tc.Config.Validate()
+			if tc.ExpectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSubscriberConfig_Validate_group_settings(t *testing.T) {
+	testSubscriberConfigValidate(t, []subscriberConfigTestCase{
+		{
+			Name: "valid",
+			Config: kafka.SubscriberConfig{
+				ConsumerGroup:     "group",
+				SessionTimeout:    time.Second * 30,
+				HeartbeatInterval: time.Second * 10,
+				RebalanceStrategy: kafka.RebalanceStrategyRoundRobin,
+			},
+		},
+		{
+			Name: "missing_consumer_group",
+			Config: kafka.SubscriberConfig{
+				SessionTimeout: time.Second * 30,
+			},
+			ExpectedErr: true,
+		},
+		{
+			Name: "heartbeat_interval_greater_than_session_timeout",
+			Config: kafka.SubscriberConfig{
+				ConsumerGroup:     "group",
+				SessionTimeout:    time.Second * 10,
+				HeartbeatInterval: time.Second * 30,
+			},
+			ExpectedErr: true,
+		},
+		{
+			Name: "unknown_rebalance_strategy",
+			Config: kafka.SubscriberConfig{
+				ConsumerGroup:     "group",
+				RebalanceStrategy: "unknown",
+			},
+			ExpectedErr: true,
+		},
+	})
+}
+
+func TestSubscriberConfig_Validate_partition_offsets(t *testing.T) {
+	testSubscriberConfigValidate(t, []subscriberConfigTestCase{
+		{
+			Name: "partition_offsets",
+			Config: kafka.SubscriberConfig{
+				PartitionOffsets: map[int32]int64{0: 10, 1: sarama.OffsetOldest},
+			},
+		},
+		{
+			Name: "partition_offsets_with_consumer_group",
+			Config: kafka.SubscriberConfig{
+				ConsumerGroup:    "group",
+				PartitionOffsets: map[int32]int64{0: 10},
+			},
+			ExpectedErr: true,
+		},
+		{
+			Name: "negative_partition",
+			Config: kafka.SubscriberConfig{
+				PartitionOffsets: map[int32]int64{-1: 10},
+			},
+			ExpectedErr: true,
+		},
+	})
+}
+
+func TestSubscriberConfig_Validate_slow_message(t *testing.T) {
+	testSubscriberConfigValidate(t, []subscriberConfigTestCase{
+		{
+			Name: "slow_message_dead_letter_without_publisher",
+			Config: kafka.SubscriberConfig{
+				SlowMessage: kafka.SlowMessageConfig{
+					MaxProcessingTime: time.Minute,
+					Action:            kafka.SlowMessageDeadLetter,
+				},
+			},
+			ExpectedErr: true,
+		},
+		{
+			Name: "slow_message_negative_pause_duration",
+			Config: kafka.SubscriberConfig{
+				SlowMessage: kafka.SlowMessageConfig{
+					MaxProcessingTime: time.Minute,
+					PauseDuration:     -1,
+				},
+			},
+			ExpectedErr: true,
+		},
+	})
+}
+
+func TestSubscriberConfig_Validate_fetch(t *testing.T) {
+	testSubscriberConfigValidate(t, []subscriberConfigTestCase{
+		{
+			Name: "fetch",
+			Config: kafka.SubscriberConfig{
+				Fetch: kafka.FetchConfig{
+					MinBytes:          1024 * 1024,
+					MaxWait:           time.Millisecond * 500,
+					MaxPartitionBytes: 10 * 1024 * 1024,
+					MaxBytes:          50 * 1024 * 1024,
+					ChannelBufferSize: 1024,
+				},
+			},
+		},
+		{
+			Name: "fetch_negative_max_wait",
+			Config: kafka.SubscriberConfig{
+				Fetch: kafka.FetchConfig{MaxWait: -1},
+			},
+			ExpectedErr: true,
+		},
+		{
+			Name: "fetch_partition_bytes_greater_than_max_bytes",
+			Config: kafka.SubscriberConfig{
+				Fetch: kafka.FetchConfig{MaxPartitionBytes: 2048, MaxBytes: 1024},
+			},
+			ExpectedErr: true,
+		},
+	})
+}
+
+func TestAsyncPublisherConfig_Validate(t *testing.T) {
+	assert.NoError(t, kafka.AsyncPublisherConfig{FlushFrequency: time.Millisecond * 10, FlushMessages: 100}.Validate())
+	assert.Error(t, kafka.AsyncPublisherConfig{FlushFrequency: -1}.Validate())
+	assert.Error(t, kafka.AsyncPublisherConfig{FlushMessages: -1}.Validate())
+}
+
+func TestPublisherConfig_Validate(t *testing.T) {
+	validConfig := func() kafka.PublisherConfig {
+		return kafka.PublisherConfig{
+			Brokers:               []string{"localhost:9092"},
+			Marshaler:             kafka.DefaultMarshaler{},
+			OverwriteSaramaConfig: kafka.DefaultSaramaSyncPublisherConfig(),
+		}
+	}
+
+	assert.NoError(t, validConfig().Validate())
+
+	missingBrokers := validConfig()
+	missingBrokers.Brokers = nil
+	assert.Error(t, missingBrokers.Validate())
+
+	missingMarshaler := validConfig()
+	missingMarshaler.Marshaler = nil
+	assert.Error(t, missingMarshaler.Validate())
+
+	negativeRefresh := validConfig()
+	negativeRefresh.MetadataRefreshFrequency = -1
+	assert.Error(t, negativeRefresh.Validate())
+
+	oldVersion := validConfig()
+	oldVersion.OverwriteSaramaConfig.Version = sarama.V0_10_0_0
+	assert.Error(t, oldVersion.Validate(), "checking if topic exists without auto-creation requires a newer version")
+
+	oldVersion.AllowAutoTopicCreation = true
+	assert.NoError(t, oldVersion.Validate())
+
+	pool, err := kafka.NewClientPool([]string{"localhost:9092"}, nil)
+	require.NoError(t, err)
+
+	withPool := validConfig()
+	withPool.ClientPool = pool
+	assert.Error(t, withPool.Validate(), "Sarama config cannot be overwritten, when the client is shared")
+
+	withPool.OverwriteSaramaConfig = nil
+	assert.NoError(t, withPool.Validate())
+}
+
+func TestSubscriberConfig_Validate_client_pool(t *testing.T) {
+	pool, err := kafka.NewClientPool([]string{"localhost:9092"}, nil)
+	require.NoError(t, err)
+
+	config := kafka.SubscriberConfig{
+		Brokers:    []string{"localhost:9092"},
+		ClientPool: pool,
+	}
+	assert.NoError(t, config.Validate())
+
+	config.Fetch.MinBytes = 1024
+	assert.Error(t, config.Validate(), "fetch settings overwrite the Sarama config of the pool")
+}
+
+func TestNewClientPool(t *testing.T) {
+	_, err := kafka.NewClientPool(nil, nil)
+	assert.Error(t, err)
+
+	invalidConfig := kafka.DefaultSaramaClientPoolConfig()
+	invalidConfig.ClientID = ""
+	_, err = kafka.NewClientPool([]string{"localhost:9092"}, invalidConfig)
+	assert.Error(t, err)
+}
@@ -0,0 +1,348 @@
+package kafka
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// ClusterMetadataKey is the metadata key with the name of the cluster which served the publish.
+// It is set by FailoverPublisher.
+const ClusterMetadataKey = "kafka_cluster"
+
+const (
+	PrimaryCluster   = "primary"
+	SecondaryCluster = "secondary"
+)
+
+type FailoverConfig struct {
+	// HealthCheckInterval determines how often the primary cluster is probed,
+	// when messages are published to the secondary cluster.
+	HealthCheckInterval time.Duration
+
+	// ShouldFailover decides, if the publish error means that the primary cluster is unavailable.
+	// Other errors (like MessageTooLargeError or marshaling errors) are returned without switching
+	// to the secondary cluster. Defaults to IsClusterUnavailableError.
+	ShouldFailover func(err error) bool
+}
+
+func (c *FailoverConfig) setDefaults() {
+	if c.HealthCheckInterval <= 0 {
+		c.HealthCheckInterval = time.Second * 10
+	}
+	if c.ShouldFailover == nil {
+		c.ShouldFailover = IsClusterUnavailableError
+	}
+}
+
+// IsClusterUnavailableError returns true, when the publish error is caused by unavailable brokers
+// (like the network error or the partition without a leader), not by the published message.
+func IsClusterUnavailableError(err error) bool {
+	err = errors.Cause(err)
+	if producerErr, ok := err.(*sarama.ProducerError); ok {
+		err = producerErr.Err
+	}
+
+	switch err {
+	case sarama.ErrOutOfBrokers,
+		sarama.ErrNotConnected,
+		sarama.ErrClosedClient,
+		sarama.ErrShuttingDown,
+		sarama.ErrControllerNotAvailable,
+		sarama.ErrLeaderNotAvailable,
+		sarama.ErrNotLeaderForPartition,
+		sarama.ErrRequestTimedOut,
+		sarama.ErrBrokerNotAvailable,
+		sarama.ErrNetworkException,
+		sarama.ErrNotEnoughReplicas,
+		sarama.ErrNotEnoughReplicasAfterAppend:
+		return true
+	}
+
+	_, isNetErr := err.(net.Error)
+	return isNetErr
+}
+
+// FailoverPublisher publishes messages to the primary Kafka cluster
+// and switches to the secondary cluster when the primary cluster is unavailable.
+//
+// Only errors caused by unavailable brokers (see FailoverConfig.ShouldFailover) switch the cluster.
+//
+// When the secondary cluster is used, the primary cluster is probed every HealthCheckInterval.
+// When the primary cluster is healthy again, FailoverPublisher switches back to it.
+//
+// The cluster which served the publish is stored in the message's metadata, under ClusterMetadataKey.
+type FailoverPublisher struct {
+	config FailoverConfig
+	logger watermill.LoggerAdapter
+
+	newPrimary         func() (message.Publisher, error)
+	checkPrimaryHealth func() error
+
+	primary        *clusterPublisher
+	secondary      *clusterPublisher
+	usingSecondary bool
+	lock           sync.RWMutex
+
+	closing  chan struct{}
+	closed   bool
+	probesWg sync.WaitGroup
+}
+
+// NewFailoverPublisher creates a new FailoverPublisher.
+//
+// When the primary cluster is not available during creation, the secondary cluster is used from the start.
+func NewFailoverPublisher(
+	primaryBrokers []string,
+	secondaryBrokers []string,
+	marshaler Marshaler,
+	overwriteSaramaConfig *sarama.Config,
+	config FailoverConfig,
+	logger watermill.LoggerAdapter,
+) (*FailoverPublisher, error) {
+	if overwriteSaramaConfig == nil {
+		overwriteSaramaConfig = DefaultSaramaSyncPublisherConfig()
+	}
+
+	secondary, err := NewPublisher(secondaryBrokers, marshaler, overwriteSaramaConfig, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publisher for the secondary cluster")
+	}
+
+	return newFailoverPublisher(
+		func() (message.Publisher, error) {
+			return NewPublisher(primaryBrokers, marshaler, overwriteSaramaConfig, logger)
+		},
+		secondary,
+		func() error {
+			client, err := sarama.NewClient(primaryBrokers, overwriteSaramaConfig)
+			if err != nil {
+				return err
+			}
+			return client.Close()
+		},
+		config,
+		logger,
+	), nil
+}
+
+func newFailoverPublisher(
+	newPrimary func() (message.Publisher, error),
+	secondary message.Publisher,
+	checkPrimaryHealth func() error,
+	config FailoverConfig,
+	logger watermill.LoggerAdapter,
+) *FailoverPublisher {
+	config.setDefaults()
+
+	p := &FailoverPublisher{
+		config: config,
+		logger: logger,
+
+		newPrimary:         newPrimary,
+		checkPrimaryHealth: checkPrimaryHealth,
+
+		secondary: &clusterPublisher{Publisher: secondary},
+
+		closing: make(chan struct{}),
+	}
+
+	primary, err := newPrimary()
+	if err != nil {
+		logger.Error("Primary cluster is not available, using secondary cluster", err, nil)
+		p.switchToSecondary()
+	} else {
+		p.primary = &clusterPublisher{Publisher: primary}
+	}
+
+	return p
+}
+
+// clusterPublisher is the publisher of one cluster, which tracks the publishes in progress,
+// so it's not closed in the middle of a publish.
+type clusterPublisher struct {
+	message.Publisher
+	inFlight sync.WaitGroup
+}
+
+// closeWhenIdle closes the publisher, after all publishes in progress are finished.
+func (c *clusterPublisher) closeWhenIdle() error {
+	c.inFlight.Wait()
+	return c.Close()
+}
+
+// Publish publishes messages to the active cluster.
+//
+// When publishing to the primary cluster fails because it's unavailable, FailoverPublisher switches
+// to the secondary cluster and publishes the remaining messages there.
+func (p *FailoverPublisher) Publish(topic string, msgs ...*message.Message) error {
+	for _, msg := range msgs {
+		if err := p.publish(topic, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *FailoverPublisher) publish(topic string, msg *message.Message) error {
+	cluster, name, err := p.acquireActiveCluster()
+	if err != nil {
+		return err
+	}
+
+	msg.Metadata.Set(ClusterMetadataKey, name)
+	err = cluster.Publish(topic, msg)
+	cluster.inFlight.Done()
+
+	if err == nil || name == SecondaryCluster || !p.config.ShouldFailover(err) {
+		return err
+	}
+
+	p.logger.Error("Cannot publish to primary cluster, switching to secondary cluster", err, watermill.LogFields{
+		"message_uuid": msg.UUID,
+		"topic":        topic,
+	})
+	p.switchToSecondary()
+
+	secondary, name, err := p.acquireActiveCluster()
+	if err != nil {
+		return err
+	}
+	defer secondary.inFlight.Done()
+
+	msg.Metadata.Set(ClusterMetadataKey, name)
+	return secondary.Publish(topic, msg)
+}
+
+// acquireActiveCluster returns the publisher of the active cluster, which is not closed
+// until inFlight.Done is called.
+func (p *FailoverPublisher) acquireActiveCluster() (*clusterPublisher, string, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if p.closed {
+		return nil, "", errors.New("publisher closed")
+	}
+
+	if p.usingSecondary {
+		p.secondary.inFlight.Add(1)
+		return p.secondary, SecondaryCluster, nil
+	}
+
+	p.primary.inFlight.Add(1)
+	return p.primary, PrimaryCluster, nil
+}
+
+// ActiveCluster returns the name of the cluster to which messages are published.
+func (p *FailoverPublisher) ActiveCluster() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if p.usingSecondary {
+		return SecondaryCluster
+	}
+
+	return PrimaryCluster
+}
+
+func (p *FailoverPublisher) switchToSecondary() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.usingSecondary || p.closed {
+		return
+	}
+	p.usingSecondary = true
+
+	p.probesWg.Add(1)
+	go p.probePrimary()
+}
+
+// probePrimary checks the health of the primary cluster, until it is possible to switch back to it.
+func (p *FailoverPublisher) probePrimary() {
+	defer p.probesWg.Done()
+
+	ticker := time.NewTicker(p.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closing:
+			return
+		case <-ticker.C:
+		}
+
+		if err := p.checkPrimaryHealth(); err != nil {
+			p.logger.Debug("Primary cluster is still unavailable", watermill.LogFields{"err": err.Error()})
+			continue
+		}
+
+		if err := p.switchToPrimary(); err != nil {
+			p.logger.Error("Cannot switch back to primary cluster", err, nil)
+			continue
+		}
+
+		p.logger.Info("Switched back to primary cluster", nil)
+		return
+	}
+}
+
+func (p *FailoverPublisher) switchToPrimary() error {
+	// the producer is re-created, because the old one may be in a broken state
+	primary, err := p.newPrimary()
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return primary.Close()
+	}
+	old := p.primary
+	p.primary = &clusterPublisher{Publisher: primary}
+	p.usingSecondary = false
+	p.lock.Unlock()
+
+	// publishes to the old primary may be still in progress
+	if old != nil {
+		if err := old.closeWhenIdle(); err != nil {
+			p.logger.Error("Cannot close old primary publisher", err, nil)
+		}
+	}
+
+	return nil
+}
+
+func (p *FailoverPublisher) Close() error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.closing)
+	p.lock.Unlock()
+
+	p.probesWg.Wait()
+
+	var result error
+	if p.primary != nil {
+		if err := p.primary.closeWhenIdle(); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "cannot close primary publisher"))
+		}
+	}
+	if err := p.secondary.closeWhenIdle(); err != nil {
+		result = multierror.Append(result, errors.Wrap(err, "cannot close secondary publisher"))
+	}
+
+	return result
+}
@@ -0,0 +1,282 @@
+package kafka
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type fakeClusterPublisher struct {
+	lock      sync.Mutex
+	err       error
+	published []string
+	closed    bool
+
+	publishStarted chan struct{}
+	publishBlocked chan struct{}
+}
+
+func (p *fakeClusterPublisher) Publish(topic string, msgs ...*message.Message) error {
+	if p.publishStarted != nil {
+		p.publishStarted <- struct{}{}
+		<-p.publishBlocked
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return errors.New("publishing to closed publisher")
+	}
+	if p.err != nil {
+		return p.err
+	}
+	for _, msg := range msgs {
+		p.published = append(p.published, msg.UUID)
+	}
+
+	return nil
+}
+
+func (p *fakeClusterPublisher) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	return nil
+}
+
+func (p *fakeClusterPublisher) setErr(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.err = err
+}
+
+func (p *fakeClusterPublisher) publishedUUIDs() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return append([]string(nil), p.published...)
+}
+
+func (p *fakeClusterPublisher) isClosed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.closed
+}
+
+type fakeClusters struct {
+	lock      sync.Mutex
+	primaries []*fakeClusterPublisher
+	healthErr error
+
+	secondary *fakeClusterPublisher
+}
+
+func (c *fakeClusters) newPrimary() (message.Publisher, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.healthErr != nil {
+		return nil, c.healthErr
+	}
+
+	primary := &fakeClusterPublisher{}
+	c.primaries = append(c.primaries, primary)
+
+	return primary, nil
+}
+
+func (c *fakeClusters) checkPrimaryHealth() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.healthErr
+}
+
+func (c *fakeClusters) setHealthErr(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.healthErr = err
+}
+
+func (c *fakeClusters) primary(i int) *fakeClusterPublisher {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.primaries[i]
+}
+
+func (c *fakeClusters) primariesCount() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.primaries)
+}
+
+func newTestFailoverPublisher(clusters *fakeClusters, healthCheckInterval time.Duration) *FailoverPublisher {
+	clusters.secondary = &fakeClusterPublisher{}
+
+	return newFailoverPublisher(
+		clusters.newPrimary,
+		clusters.secondary,
+		clusters.checkPrimaryHealth,
+		FailoverConfig{HealthCheckInterval: healthCheckInterval},
+		watermill.NopLogger{},
+	)
+}
+
+func TestFailoverPublisher_switches_to_secondary(t *testing.T) {
+	clusters := &fakeClusters{}
+	p := newTestFailoverPublisher(clusters, time.Hour)
+	defer p.Close()
+
+	msg := message.NewMessage("1", nil)
+	require.NoError(t, p.Publish("topic", msg))
+	assert.Equal(t, PrimaryCluster, msg.Metadata.Get(ClusterMetadataKey))
+	assert.Equal(t, []string{"1"}, clusters.primary(0).publishedUUIDs())
+
+	clusters.primary(0).setErr(&sarama.ProducerError{Err: sarama.ErrOutOfBrokers})
+
+	msg = message.NewMessage("2", nil)
+	require.NoError(t, p.Publish("topic", msg))
+	assert.Equal(t, SecondaryCluster, msg.Metadata.Get(ClusterMetadataKey))
+	assert.Equal(t, SecondaryCluster, p.ActiveCluster())
+	assert.Equal(t, []string{"2"}, clusters.secondary.publishedUUIDs())
+}
+
+func TestFailoverPublisher_message_errors_dont_switch(t *testing.T) {
+	testCases := []struct {
+		Name string
+		Err  error
+	}{
+		{
+			Name: "message_too_large",
+			Err:  MessageTooLargeError{MessageUUID: "1", MaxMessageBytes: 1},
+		},
+		{
+			Name: "marshal_error",
+			Err:  errors.Wrap(errors.New("invalid metadata"), "cannot marshal message 1"),
+		},
+		{
+			Name: "invalid_message",
+			Err:  errors.Wrap(&sarama.ProducerError{Err: sarama.ErrInvalidMessage}, "cannot produce message 1"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			clusters := &fakeClusters{}
+			p := newTestFailoverPublisher(clusters, time.Hour)
+			defer p.Close()
+
+			clusters.primary(0).setErr(tc.Err)
+
+			err := p.Publish("topic", message.NewMessage("1", nil))
+			assert.Equal(t, tc.Err, err)
+			assert.Equal(t, PrimaryCluster, p.ActiveCluster())
+			assert.Empty(t, clusters.secondary.publishedUUIDs())
+		})
+	}
+}
+
+func TestIsClusterUnavailableError(t *testing.T) {
+	assert.True(t, IsClusterUnavailableError(errors.Wrap(&sarama.ProducerError{Err: sarama.ErrNotLeaderForPartition}, "cannot produce")))
+	assert.True(t, IsClusterUnavailableError(sarama.ErrOutOfBrokers))
+	assert.True(t, IsClusterUnavailableError(&sarama.ProducerError{Err: timeoutError{}}))
+	assert.False(t, IsClusterUnavailableError(MessageTooLargeError{}))
+	assert.False(t, IsClusterUnavailableError(&sarama.ProducerError{Err: sarama.ErrMessageSizeTooLarge}))
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestFailoverPublisher_probes_primary(t *testing.T) {
+	clusters := &fakeClusters{healthErr: errors.New("primary unavailable")}
+	p := newTestFailoverPublisher(clusters, time.Millisecond*10)
+	defer p.Close()
+
+	assert.Equal(t, SecondaryCluster, p.ActiveCluster(), "primary unavailable during creation")
+
+	msg := message.NewMessage("1", nil)
+	require.NoError(t, p.Publish("topic", msg))
+	assert.Equal(t, SecondaryCluster, msg.Metadata.Get(ClusterMetadataKey))
+
+	clusters.setHealthErr(nil)
+
+	require.Eventually(t, func() bool {
+		return p.ActiveCluster() == PrimaryCluster
+	}, time.Second*5, time.Millisecond*10)
+
+	msg = message.NewMessage("2", nil)
+	require.NoError(t, p.Publish("topic", msg))
+	assert.Equal(t, PrimaryCluster, msg.Metadata.Get(ClusterMetadataKey))
+	assert.Equal(t, []string{"2"}, clusters.primary(0).publishedUUIDs())
+
+	// the primary fails again, the broken producer is replaced after the next probe
+	clusters.primary(0).setErr(sarama.ErrOutOfBrokers)
+	require.NoError(t, p.Publish("topic", message.NewMessage("3", nil)))
+	assert.Equal(t, []string{"1", "3"}, clusters.secondary.publishedUUIDs())
+
+	require.Eventually(t, func() bool {
+		return p.ActiveCluster() == PrimaryCluster
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, 2, clusters.primariesCount())
+	assert.True(t, clusters.primary(0).isClosed(), "broken primary producer should be closed")
+}
+
+func TestFailoverPublisher_switch_doesnt_close_primary_during_publish(t *testing.T) {
+	clusters := &fakeClusters{}
+	p := newTestFailoverPublisher(clusters, time.Millisecond*10)
+
+	primary := clusters.primary(0)
+	primary.publishStarted = make(chan struct{})
+	primary.publishBlocked = make(chan struct{})
+
+	published := make(chan error, 1)
+	go func() {
+		published <- p.Publish("topic", message.NewMessage("1", nil))
+	}()
+	<-primary.publishStarted
+
+	// the probe replaces the primary publisher, while the publish is in progress
+	p.lock.Lock()
+	p.usingSecondary = true
+	p.lock.Unlock()
+	p.probesWg.Add(1)
+	go p.probePrimary()
+
+	require.Eventually(t, func() bool {
+		return clusters.primariesCount() == 2
+	}, time.Second*5, time.Millisecond*10)
+	assert.False(t, primary.isClosed(), "primary should not be closed during publish")
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- p.Close()
+	}()
+
+	close(primary.publishBlocked)
+	require.NoError(t, <-published)
+	require.NoError(t, <-closed)
+
+	assert.True(t, primary.isClosed())
+	assert.True(t, clusters.primary(1).isClosed())
+	assert.True(t, clusters.secondary.isClosed())
+
+	assert.Error(t, p.Publish("topic", message.NewMessage("2", nil)), "publish after close should fail")
+}
@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
+)
+
+// FetchConfig contains the fetch and buffering settings of the consumer.
+// Zero values keep the settings of the Sarama config.
+//
+// Higher MinBytes and MaxWait increase the throughput of high-volume consumers, with fewer and bigger fetch requests,
+// at the cost of the latency of low-volume topics.
+type FetchConfig struct {
+	// MinBytes overrides Consumer.Fetch.Min of the Sarama config (fetch.min.bytes).
+	// It is the minimum number of bytes the broker waits for, before answering the fetch request.
+	MinBytes int32
+
+	// MaxWait overrides Consumer.MaxWaitTime of the Sarama config (fetch.max.wait.ms).
+	// It is the maximum time the broker waits for MinBytes, before answering the fetch request.
+	MaxWait time.Duration
+
+	// MaxPartitionBytes overrides Consumer.Fetch.Default of the Sarama config (max.partition.fetch.bytes).
+	// It is the number of bytes fetched from a single partition in one request.
+	MaxPartitionBytes int32
+
+	// MaxBytes overrides Consumer.Fetch.Max of the Sarama config (fetch.max.bytes).
+	MaxBytes int32
+
+	// ChannelBufferSize overrides ChannelBufferSize of the Sarama config.
+	// It is the number of messages buffered in memory for every partition.
+	ChannelBufferSize int
+}
+
+func (c FetchConfig) Validate() error {
+	if c.MinBytes < 0 || c.MaxPartitionBytes < 0 || c.MaxBytes < 0 {
+		return errors.New("MinBytes, MaxPartitionBytes and MaxBytes cannot be negative")
+	}
+	if c.MaxWait < 0 {
+		return errors.New("MaxWait cannot be negative")
+	}
+	if c.ChannelBufferSize < 0 {
+		return errors.New("ChannelBufferSize cannot be negative")
+	}
+	if c.MaxBytes != 0 && c.MaxPartitionBytes > c.MaxBytes {
+		return errors.Errorf("MaxPartitionBytes (%d) cannot be greater than MaxBytes (%d)", c.MaxPartitionBytes, c.MaxBytes)
+	}
+
+	return nil
+}
+
+func (c FetchConfig) set() bool {
+	return c != FetchConfig{}
+}
+
+func (c FetchConfig) overwriteSaramaConfig(saramaConfig *sarama.Config) {
+	if c.MinBytes != 0 {
+		saramaConfig.Consumer.Fetch.Min = c.MinBytes
+	}
+	if c.MaxWait != 0 {
+		saramaConfig.Consumer.MaxWaitTime = c.MaxWait
+	}
+	if c.MaxPartitionBytes != 0 {
+		saramaConfig.Consumer.Fetch.Default = c.MaxPartitionBytes
+	}
+	if c.MaxBytes != 0 {
+		saramaConfig.Consumer.Fetch.Max = c.MaxBytes
+	}
+	if c.ChannelBufferSize != 0 {
+		saramaConfig.ChannelBufferSize = c.ChannelBufferSize
+	}
+}
+
+// Names of the metrics reported to SubscriberConfig.MetricsSink.
+// All of them have the topic, partition and consumer_group labels.
+const (
+	// MetricConsumedMessages is the counter of processed messages, with the result label (acked, nacked or skipped).
+	// The rate of the counter is the throughput of the partition.
+	MetricConsumedMessages = "kafka_subscriber_messages_consumed_total"
+
+	// MetricConsumeLatency is the time between producing the message (the Kafka message's timestamp)
+	// and receiving it by the subscriber. It is reported only for messages with the timestamp (Kafka >= 0.10).
+	MetricConsumeLatency = "kafka_subscriber_consume_latency_seconds"
+
+	// MetricProcessingTime is the time between sending the message to the output channel and its ack or nack.
+	MetricProcessingTime = "kafka_subscriber_processing_time_seconds"
+)
+
+// consumeMetrics reports per-partition metrics of consumed messages. The zero value reports nothing.
+type consumeMetrics struct {
+	sink          metrics.MetricsSink
+	consumerGroup string
+}
+
+func newConsumeMetrics(sink metrics.MetricsSink, consumerGroup string) consumeMetrics {
+	return consumeMetrics{sink: sink, consumerGroup: consumerGroup}
+}
+
+func (m consumeMetrics) labels(kafkaMsg *sarama.ConsumerMessage) map[string]string {
+	return map[string]string{
+		"topic":          kafkaMsg.Topic,
+		"partition":      strconv.Itoa(int(kafkaMsg.Partition)),
+		"consumer_group": m.consumerGroup,
+	}
+}
+
+func (m consumeMetrics) received(kafkaMsg *sarama.ConsumerMessage) {
+	if m.sink == nil || kafkaMsg.Timestamp.IsZero() {
+		return
+	}
+
+	m.sink.ObserveDuration(MetricConsumeLatency, m.labels(kafkaMsg), time.Since(kafkaMsg.Timestamp))
+}
+
+func (m consumeMetrics) processed(kafkaMsg *sarama.ConsumerMessage, processingTime time.Duration, result string) {
+	if m.sink == nil {
+		return
+	}
+
+	labels := m.labels(kafkaMsg)
+	m.sink.ObserveDuration(MetricProcessingTime, labels, processingTime)
+
+	labels["result"] = result
+	m.sink.IncCounter(MetricConsumedMessages, labels)
+}
@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// ProducerInterceptor is called with the raw Sarama record, after the message is marshaled and before it's sent.
+// It can modify the record, for example to inject headers or scrub the value.
+// When it returns an error, the message is not sent and Publish fails.
+type ProducerInterceptor interface {
+	OnSend(msg *sarama.ProducerMessage) error
+}
+
+// ProducerInterceptorFunc allows to use a function as ProducerInterceptor.
+type ProducerInterceptorFunc func(msg *sarama.ProducerMessage) error
+
+func (f ProducerInterceptorFunc) OnSend(msg *sarama.ProducerMessage) error {
+	return f(msg)
+}
+
+// ConsumerInterceptor is called with the raw Sarama record, after it's received and before it's unmarshaled.
+// It can modify the record, for example to decrypt the value or record custom telemetry.
+// The error is handled like the error of the Unmarshaler.
+type ConsumerInterceptor interface {
+	OnConsume(msg *sarama.ConsumerMessage) error
+}
+
+// ConsumerInterceptorFunc allows to use a function as ConsumerInterceptor.
+type ConsumerInterceptorFunc func(msg *sarama.ConsumerMessage) error
+
+func (f ConsumerInterceptorFunc) OnConsume(msg *sarama.ConsumerMessage) error {
+	return f(msg)
+}
+
+// InterceptingMarshaler decorates the Marshaler, so the interceptors are called in order with every marshaled record.
+//
+// The Marshaler is the extension point shared by Publisher, AsyncPublisher and FailoverPublisher,
+// so it can be passed to any of them:
+//
+//	marshaler := kafka.InterceptingMarshaler(kafka.DefaultMarshaler{}, tracingInterceptor)
+//	publisher, err := kafka.NewPublisher(brokers, marshaler, nil, logger)
+func InterceptingMarshaler(marshaler Marshaler, interceptors ...ProducerInterceptor) Marshaler {
+	return interceptingMarshaler{marshaler, interceptors}
+}
+
+// interceptedMarshaler decorates the marshaler only when there are interceptors from the config.
+func interceptedMarshaler(marshaler Marshaler, interceptors []ProducerInterceptor) Marshaler {
+	if len(interceptors) == 0 {
+		return marshaler
+	}
+
+	return InterceptingMarshaler(marshaler, interceptors...)
+}
+
+type interceptingMarshaler struct {
+	Marshaler
+	interceptors []ProducerInterceptor
+}
+
+func (m interceptingMarshaler) Marshal(topic string, msg *message.Message) (*sarama.ProducerMessage, error) {
+	kafkaMsg, err := m.Marshaler.Marshal(topic, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, interceptor := range m.interceptors {
+		if err := interceptor.OnSend(kafkaMsg); err != nil {
+			return nil, errors.Wrap(err, "producer interceptor failed")
+		}
+	}
+
+	return kafkaMsg, nil
+}
+
+// InterceptingUnmarshaler decorates the Unmarshaler, so the interceptors are called in order with every received
+// record, before it's unmarshaled.
+func InterceptingUnmarshaler(unmarshaler Unmarshaler, interceptors ...ConsumerInterceptor) Unmarshaler {
+	return interceptingUnmarshaler{unmarshaler, interceptors}
+}
+
+// interceptedUnmarshaler decorates the unmarshaler only when there are interceptors from the config.
+func interceptedUnmarshaler(unmarshaler Unmarshaler, interceptors []ConsumerInterceptor) Unmarshaler {
+	if len(interceptors) == 0 {
+		return unmarshaler
+	}
+
+	return InterceptingUnmarshaler(unmarshaler, interceptors...)
+}
+
+type interceptingUnmarshaler struct {
+	Unmarshaler
+	interceptors []ConsumerInterceptor
+}
+
+func (u interceptingUnmarshaler) Unmarshal(kafkaMsg *sarama.ConsumerMessage) (*message.Message, error) {
+	for _, interceptor := range u.interceptors {
+		if err := interceptor.OnConsume(kafkaMsg); err != nil {
+			return nil, errors.Wrap(err, "consumer interceptor failed")
+		}
+	}
+
+	return u.Unmarshaler.Unmarshal(kafkaMsg)
+}
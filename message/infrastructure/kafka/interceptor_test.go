@@ -0,0 +1,62 @@
+package kafka_test
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/kafka"
+)
+
+func TestInterceptingMarshaler(t *testing.T) {
+	injectHeader := kafka.ProducerInterceptorFunc(func(msg *sarama.ProducerMessage) error {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte("injected"), Value: []byte("1")})
+		return nil
+	})
+	var consumedHeaders []*sarama.RecordHeader
+	recordHeaders := kafka.ConsumerInterceptorFunc(func(msg *sarama.ConsumerMessage) error {
+		consumedHeaders = msg.Headers
+		return nil
+	})
+
+	m := kafka.InterceptingMarshaler(kafka.DefaultMarshaler{}, injectHeader)
+	u := kafka.InterceptingUnmarshaler(kafka.DefaultMarshaler{}, recordHeaders)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+
+	marshaled, err := m.Marshal("topic", msg)
+	require.NoError(t, err)
+
+	unmarshaledMsg, err := u.Unmarshal(producerToConsumerMessage(marshaled))
+	require.NoError(t, err)
+
+	assert.Equal(t, "1", unmarshaledMsg.Metadata.Get("injected"))
+	assert.NotEmpty(t, consumedHeaders)
+}
+
+func TestInterceptingMarshaler_error(t *testing.T) {
+	interceptorErr := errors.New("rejected")
+
+	m := kafka.InterceptingMarshaler(
+		kafka.DefaultMarshaler{},
+		kafka.ProducerInterceptorFunc(func(msg *sarama.ProducerMessage) error {
+			return interceptorErr
+		}),
+	)
+	_, err := m.Marshal("topic", message.NewMessage(watermill.NewUUID(), nil))
+	assert.Equal(t, interceptorErr, errors.Cause(err))
+
+	u := kafka.InterceptingUnmarshaler(
+		kafka.DefaultMarshaler{},
+		kafka.ConsumerInterceptorFunc(func(msg *sarama.ConsumerMessage) error {
+			return interceptorErr
+		}),
+	)
+	_, err = u.Unmarshal(&sarama.ConsumerMessage{})
+	assert.Equal(t, interceptorErr, errors.Cause(err))
+}
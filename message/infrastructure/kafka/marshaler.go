@@ -1,13 +1,38 @@
 package kafka
 
 import (
+	"time"
+
 	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/pkg/errors"
 )
 
 const UUIDHeaderKey = "_watermill_message_uuid"
 
+// KeyMetadataKey is the metadata key, to which DefaultMarshaler unmarshals the key of the Kafka message.
+// It is not set, when the Kafka message has no key.
+const KeyMetadataKey = "kafka_key"
+
+// TimestampMetadataKey is the metadata key with the timestamp of the Kafka message, in time.RFC3339Nano format.
+//
+// DefaultMarshaler sets it on consumed messages, when the broker returned the timestamp (Kafka 0.10+).
+// Depending on message.timestamp.type of the topic, it is the time of producing (CreateTime)
+// or the time of appending the message to the log (LogAppendTime).
+//
+// DefaultMarshaler doesn't publish it, so copies of consumed messages (for example requeued
+// or dead-lettered messages) get a new timestamp. Use PublishTimestampMetadataKey to set the timestamp.
+const TimestampMetadataKey = "kafka_timestamp"
+
+// PublishTimestampMetadataKey is the metadata key with the timestamp of the published Kafka message,
+// in time.RFC3339Nano format.
+//
+// When it's set, DefaultMarshaler sends it as the Kafka message's timestamp instead of a header.
+// It is used only by topics with CreateTime, the broker overwrites it with LogAppendTime.
+// When it's not set, the timestamp is set by the producer.
+const PublishTimestampMetadataKey = "kafka_publish_timestamp"
+
 // Marshaler marshals Watermill's message to Kafka message.
 type Marshaler interface {
 	Marshal(topic string, msg *message.Message) (*sarama.ProducerMessage, error)
@@ -23,6 +48,8 @@ type MarshalerUnmarshaler interface {
 	Unmarshaler
 }
 
+// DefaultMarshaler stores the UUID and the metadata of the message in Kafka headers.
+// Messages without the UUID header (not published by Watermill) get the UUID generated with watermill.NewMessageUUID.
 type DefaultMarshaler struct{}
 
 func (DefaultMarshaler) Marshal(topic string, msg *message.Message) (*sarama.ProducerMessage, error) {
@@ -35,19 +62,44 @@ func (DefaultMarshaler) Marshal(topic string, msg *message.Message) (*sarama.Pro
 		Value: []byte(msg.UUID),
 	}}
 	for key, value := range msg.Metadata {
+		if key == TimestampMetadataKey || key == PublishTimestampMetadataKey {
+			continue
+		}
 		headers = append(headers, sarama.RecordHeader{
 			Key:   []byte(key),
 			Value: []byte(value),
 		})
 	}
 
+	timestamp, err := timestampFromMetadata(msg.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
 	return &sarama.ProducerMessage{
-		Topic:   topic,
-		Value:   sarama.ByteEncoder(msg.Payload),
-		Headers: headers,
+		Topic:     topic,
+		Value:     sarama.ByteEncoder(msg.Payload),
+		Headers:   headers,
+		Timestamp: timestamp,
 	}, nil
 }
 
+// timestampFromMetadata returns the zero time, when PublishTimestampMetadataKey is not set,
+// so the timestamp is set by the producer.
+func timestampFromMetadata(metadata message.Metadata) (time.Time, error) {
+	value := metadata.Get(PublishTimestampMetadataKey)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid %s metadata", PublishTimestampMetadataKey)
+	}
+
+	return timestamp, nil
+}
+
 func (DefaultMarshaler) Unmarshal(kafkaMsg *sarama.ConsumerMessage) (*message.Message, error) {
 	var messageID string
 	metadata := make(message.Metadata, len(kafkaMsg.Headers))
@@ -60,6 +112,18 @@ func (DefaultMarshaler) Unmarshal(kafkaMsg *sarama.ConsumerMessage) (*message.Me
 		}
 	}
 
+	if kafkaMsg.Key != nil {
+		metadata.Set(KeyMetadataKey, string(kafkaMsg.Key))
+	}
+	if !kafkaMsg.Timestamp.IsZero() {
+		metadata.Set(TimestampMetadataKey, kafkaMsg.Timestamp.UTC().Format(time.RFC3339Nano))
+	}
+
+	if messageID == "" {
+		// the message wasn't published by Watermill
+		messageID = watermill.NewMessageUUID()
+	}
+
 	msg := message.NewMessage(messageID, kafkaMsg.Value)
 	msg.Metadata = metadata
 
@@ -92,3 +156,24 @@ func (j kafkaJsonWithPartitioning) Marshal(topic string, msg *message.Message) (
 
 	return kafkaMsg, nil
 }
+
+// EnvelopeMarshaler marshals messages to versioned envelopes (message.EnvelopeCodec) stored in the Kafka message's value.
+type EnvelopeMarshaler struct {
+	Codec message.EnvelopeCodec
+}
+
+func (m EnvelopeMarshaler) Marshal(topic string, msg *message.Message) (*sarama.ProducerMessage, error) {
+	envelope, err := m.Codec.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(envelope),
+	}, nil
+}
+
+func (m EnvelopeMarshaler) Unmarshal(kafkaMsg *sarama.ConsumerMessage) (*message.Message, error) {
+	return m.Codec.Unmarshal(kafkaMsg.Value)
+}
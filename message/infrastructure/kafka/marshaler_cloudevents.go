@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// CloudEvents 1.0 context attributes headers, used by CloudEventsMarshaler.
+// They can be also set in the message's metadata, to override the values generated by CloudEventsMarshaler.
+const (
+	CloudEventsSpecVersionHeader = "ce_specversion"
+	CloudEventsIDHeader          = "ce_id"
+	CloudEventsTypeHeader        = "ce_type"
+	CloudEventsSourceHeader      = "ce_source"
+	CloudEventsTimeHeader        = "ce_time"
+	CloudEventsSubjectHeader     = "ce_subject"
+)
+
+// CloudEventsSpecVersion is the version of the CloudEvents specification implemented by CloudEventsMarshaler.
+const CloudEventsSpecVersion = "1.0"
+
+// CloudEventsMarshaler marshals messages according to the CloudEvents 1.0 Kafka protocol binding, in binary content mode.
+// It allows to interoperate with Knative Eventing and other CloudEvents-compliant systems.
+//
+// The message's UUID is mapped to ce_id and the payload to the Kafka message's value.
+// Metadata is mapped to headers with the same keys, so CloudEvents attributes and extensions
+// can be set with the "ce_" prefixed metadata, for example ce_subject.
+type CloudEventsMarshaler struct {
+	// Source is used as ce_source, when the message has no ce_source metadata.
+	Source string
+
+	// Type generates ce_type, when the message has no ce_type metadata. Defaults to the topic name.
+	Type func(topic string, msg *message.Message) string
+
+	// Now is used to generate ce_time, when the message has no ce_time metadata. Defaults to time.Now.
+	Now func() time.Time
+}
+
+func (m CloudEventsMarshaler) Marshal(topic string, msg *message.Message) (*sarama.ProducerMessage, error) {
+	for _, reserved := range []string{CloudEventsIDHeader, CloudEventsSpecVersionHeader} {
+		if value := msg.Metadata.Get(reserved); value != "" {
+			return nil, errors.Errorf("metadata %s is reserved by watermill for CloudEvents", reserved)
+		}
+	}
+
+	headers := []sarama.RecordHeader{
+		{Key: []byte(CloudEventsSpecVersionHeader), Value: []byte(CloudEventsSpecVersion)},
+		{Key: []byte(CloudEventsIDHeader), Value: []byte(msg.UUID)},
+	}
+
+	addDefault := func(key string, value func() string) {
+		if msg.Metadata.Get(key) == "" {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value())})
+		}
+	}
+
+	if msg.Metadata.Get(CloudEventsSourceHeader) == "" && m.Source == "" {
+		return nil, errors.Errorf("missing %s: set it in the metadata or in CloudEventsMarshaler.Source", CloudEventsSourceHeader)
+	}
+	addDefault(CloudEventsSourceHeader, func() string {
+		return m.Source
+	})
+	addDefault(CloudEventsTypeHeader, func() string {
+		if m.Type != nil {
+			return m.Type(topic, msg)
+		}
+		return topic
+	})
+	addDefault(CloudEventsTimeHeader, func() string {
+		now := time.Now
+		if m.Now != nil {
+			now = m.Now
+		}
+		return now().UTC().Format(time.RFC3339Nano)
+	})
+
+	for key, value := range msg.Metadata {
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(key),
+			Value: []byte(value),
+		})
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(msg.Payload),
+		Headers: headers,
+	}, nil
+}
+
+func (m CloudEventsMarshaler) Unmarshal(kafkaMsg *sarama.ConsumerMessage) (*message.Message, error) {
+	var id string
+	metadata := make(message.Metadata, len(kafkaMsg.Headers))
+
+	for _, header := range kafkaMsg.Headers {
+		switch string(header.Key) {
+		case CloudEventsIDHeader:
+			id = string(header.Value)
+		case CloudEventsSpecVersionHeader:
+			if string(header.Value) != CloudEventsSpecVersion {
+				return nil, errors.Errorf("unsupported CloudEvents spec version %s", header.Value)
+			}
+		default:
+			metadata.Set(string(header.Key), string(header.Value))
+		}
+	}
+
+	if id == "" {
+		return nil, errors.Errorf("missing %s header", CloudEventsIDHeader)
+	}
+
+	msg := message.NewMessage(id, kafkaMsg.Value)
+	msg.Metadata = metadata
+
+	return msg, nil
+}
@@ -2,6 +2,7 @@ package kafka_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 
@@ -28,6 +29,60 @@ func TestDefaultMarshaler_MarshalUnmarshal(t *testing.T) {
 	assert.True(t, msg.Equals(unmarshaledMsg))
 }
 
+func TestDefaultMarshaler_timestamp(t *testing.T) {
+	m := kafka.DefaultMarshaler{}
+
+	timestamp := time.Date(2019, 1, 1, 12, 0, 0, 500, time.UTC)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	msg.Metadata.Set(kafka.PublishTimestampMetadataKey, timestamp.Format(time.RFC3339Nano))
+
+	marshaled, err := m.Marshal("topic", msg)
+	require.NoError(t, err)
+
+	assert.True(t, timestamp.Equal(marshaled.Timestamp))
+	for _, header := range marshaled.Headers {
+		assert.NotEqual(t, kafka.PublishTimestampMetadataKey, string(header.Key), "timestamp should not be sent as header")
+	}
+
+	unmarshaledMsg, err := m.Unmarshal(producerToConsumerMessage(marshaled))
+	require.NoError(t, err)
+
+	assert.Equal(t, timestamp.Format(time.RFC3339Nano), unmarshaledMsg.Metadata.Get(kafka.TimestampMetadataKey))
+	assert.Empty(t, unmarshaledMsg.Metadata.Get(kafka.PublishTimestampMetadataKey))
+}
+
+func TestDefaultMarshaler_republished_message_gets_new_timestamp(t *testing.T) {
+	m := kafka.DefaultMarshaler{}
+
+	consumed, err := m.Unmarshal(&sarama.ConsumerMessage{
+		Value:     []byte("payload"),
+		Timestamp: time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(kafka.UUIDHeaderKey), Value: []byte(watermill.NewUUID())},
+			{Key: []byte("foo"), Value: []byte("bar")},
+		},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, consumed.Metadata.Get(kafka.TimestampMetadataKey))
+
+	republished, err := m.Marshal("dead_letter_topic", consumed.Copy())
+	require.NoError(t, err)
+
+	assert.True(t, republished.Timestamp.IsZero(), "timestamp should be set by the producer")
+	for _, header := range republished.Headers {
+		assert.NotEqual(t, kafka.TimestampMetadataKey, string(header.Key), "consumed timestamp should not be sent")
+	}
+}
+
+func TestDefaultMarshaler_invalid_timestamp(t *testing.T) {
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	msg.Metadata.Set(kafka.PublishTimestampMetadataKey, "yesterday")
+
+	_, err := kafka.DefaultMarshaler{}.Marshal("topic", msg)
+	assert.Error(t, err)
+}
+
 func BenchmarkDefaultMarshaler_Marshal(b *testing.B) {
 	m := kafka.DefaultMarshaler{}
 
@@ -72,6 +127,9 @@ func TestWithPartitioningMarshaler_MarshalUnmarshal(t *testing.T) {
 	unmarshaledMsg, err := m.Unmarshal(producerToConsumerMessage(producerMsg))
 	require.NoError(t, err)
 
+	assert.Equal(t, partitionKey, unmarshaledMsg.Metadata.Get(kafka.KeyMetadataKey))
+
+	msg.Metadata.Set(kafka.KeyMetadataKey, partitionKey)
 	assert.True(t, msg.Equals(unmarshaledMsg))
 
 	assert.NoError(t, err)
@@ -117,3 +175,54 @@ func producerToConsumerMessage(producerMessage *sarama.ProducerMessage) *sarama.
 		Headers:   headers,
 	}
 }
+
+func TestCloudEventsMarshaler_MarshalUnmarshal(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	m := kafka.CloudEventsMarshaler{
+		Source: "/orders-service",
+		Now:    func() time.Time { return now },
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	msg.Metadata.Set(kafka.CloudEventsSubjectHeader, "order-1")
+
+	marshaled, err := m.Marshal("orders", msg)
+	require.NoError(t, err)
+
+	headers := map[string]string{}
+	for _, header := range marshaled.Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+	assert.Equal(t, map[string]string{
+		kafka.CloudEventsSpecVersionHeader: "1.0",
+		kafka.CloudEventsIDHeader:          msg.UUID,
+		kafka.CloudEventsSourceHeader:      "/orders-service",
+		kafka.CloudEventsTypeHeader:        "orders",
+		kafka.CloudEventsTimeHeader:        "2019-01-01T12:00:00Z",
+		kafka.CloudEventsSubjectHeader:     "order-1",
+	}, headers)
+
+	unmarshaledMsg, err := m.Unmarshal(producerToConsumerMessage(marshaled))
+	require.NoError(t, err)
+
+	assert.Equal(t, msg.UUID, unmarshaledMsg.UUID)
+	assert.Equal(t, msg.Payload, unmarshaledMsg.Payload)
+	assert.Equal(t, "order-1", unmarshaledMsg.Metadata.Get(kafka.CloudEventsSubjectHeader))
+	assert.Equal(t, "orders", unmarshaledMsg.Metadata.Get(kafka.CloudEventsTypeHeader))
+}
+
+func TestCloudEventsMarshaler_missing_source(t *testing.T) {
+	_, err := kafka.CloudEventsMarshaler{}.Marshal("orders", message.NewMessage(watermill.NewUUID(), nil))
+	assert.Error(t, err)
+}
+
+func TestDefaultMarshaler_Unmarshal_generates_missing_uuid(t *testing.T) {
+	defer watermill.SetMessageUUIDGenerator(watermill.NewUUID)
+	watermill.SetMessageUUIDGenerator(watermill.NewSequentialUUIDGenerator("kafka"))
+
+	unmarshaledMsg, err := kafka.DefaultMarshaler{}.Unmarshal(&sarama.ConsumerMessage{Value: []byte("payload")})
+	require.NoError(t, err)
+
+	assert.Equal(t, "kafka-00000000000000000001", unmarshaledMsg.UUID)
+}
@@ -0,0 +1,222 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// ProducerPreset is a named set of producer settings with well-defined durability semantics.
+type ProducerPreset string
+
+const (
+	// ExactlyOnceSafe enables the idempotent producer: every message is written exactly once to the partition,
+	// even when the producer retries. It waits for all in-sync replicas and allows only one in-flight request.
+	// It requires Version >= V0_11_0_0.
+	ExactlyOnceSafe ProducerPreset = "exactly_once_safe"
+
+	// HighThroughput waits only for the partition leader, batches messages and compresses them with LZ4.
+	// Messages may be lost, when the leader fails before replicating them.
+	HighThroughput ProducerPreset = "high_throughput"
+
+	// LowLatency waits only for the partition leader and sends every message immediately, without batching.
+	// Messages may be lost, when the leader fails before replicating them.
+	LowLatency ProducerPreset = "low_latency"
+)
+
+// ProducerConfig configures the durability, the compression and the maximum message size of publishers.
+//
+// It can be applied to the Sarama config passed to NewPublisher and NewAsyncPublisher:
+//
+//	compression := sarama.CompressionZSTD
+//	saramaConfig, err := ProducerConfig{
+//		Preset:          ExactlyOnceSafe,
+//		Compression:     &compression,
+//		MaxMessageBytes: 5 * 1024 * 1024,
+//	}.OverwriteSaramaConfig(DefaultSaramaSyncPublisherConfig())
+//	// ...
+//	publisher, err := NewPublisher(brokers, marshaler, saramaConfig, logger)
+type ProducerConfig struct {
+	// Preset is optional and is applied before other settings of the config, so they can override it.
+	Preset ProducerPreset
+
+	// RequiredAcks overrides Producer.RequiredAcks of the Sarama config, when not nil.
+	RequiredAcks *sarama.RequiredAcks
+
+	// Idempotent enables the idempotent producer. It requires RequiredAcks to be sarama.WaitForAll
+	// and MaxOpenRequests to be 1.
+	Idempotent bool
+
+	// MaxOpenRequests overrides Net.MaxOpenRequests of the Sarama config, when not 0.
+	MaxOpenRequests int
+
+	// RetryMax overrides Producer.Retry.Max of the Sarama config, when not 0.
+	RetryMax int
+
+	// RetryBackoff overrides Producer.Retry.Backoff of the Sarama config, when not 0.
+	RetryBackoff time.Duration
+
+	// Compression overrides Producer.Compression of the Sarama config (and the compression of the Preset), when not nil.
+	// For example sarama.CompressionZSTD, sarama.CompressionLZ4, sarama.CompressionSnappy or sarama.CompressionGZIP.
+	Compression *sarama.CompressionCodec
+
+	// CompressionLevel overrides Producer.CompressionLevel of the Sarama config, when not 0.
+	CompressionLevel int
+
+	// MaxMessageBytes overrides Producer.MaxMessageBytes of the Sarama config, when not 0.
+	// It should not be greater than `message.max.bytes` of the broker (or `max.message.bytes` of the topic).
+	MaxMessageBytes int
+}
+
+func (c ProducerConfig) Validate() error {
+	switch c.Preset {
+	case "", ExactlyOnceSafe, HighThroughput, LowLatency:
+	default:
+		return errors.Errorf("unknown Preset %s", c.Preset)
+	}
+	if c.MaxOpenRequests < 0 {
+		return errors.New("MaxOpenRequests cannot be negative")
+	}
+	if c.RetryMax < 0 {
+		return errors.New("RetryMax cannot be negative")
+	}
+	if c.MaxMessageBytes < 0 {
+		return errors.New("MaxMessageBytes cannot be negative")
+	}
+	if c.MaxMessageBytes >= int(sarama.MaxRequestSize) {
+		return errors.Errorf("MaxMessageBytes must be lower than %d", sarama.MaxRequestSize)
+	}
+
+	return nil
+}
+
+// OverwriteSaramaConfig returns a copy of saramaConfig with the producer settings from the config applied.
+func (c ProducerConfig) OverwriteSaramaConfig(saramaConfig *sarama.Config) (*sarama.Config, error) {
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid producer config")
+	}
+
+	overwritten := *saramaConfig
+
+	c.applyPreset(&overwritten)
+
+	if c.RequiredAcks != nil {
+		overwritten.Producer.RequiredAcks = *c.RequiredAcks
+	}
+	if c.Idempotent {
+		overwritten.Producer.Idempotent = true
+	}
+	if c.MaxOpenRequests != 0 {
+		overwritten.Net.MaxOpenRequests = c.MaxOpenRequests
+	}
+	if c.RetryMax != 0 {
+		overwritten.Producer.Retry.Max = c.RetryMax
+	}
+	if c.RetryBackoff != 0 {
+		overwritten.Producer.Retry.Backoff = c.RetryBackoff
+	}
+
+	if c.Compression != nil {
+		overwritten.Producer.Compression = *c.Compression
+	}
+	if c.CompressionLevel != 0 {
+		overwritten.Producer.CompressionLevel = c.CompressionLevel
+	}
+	if c.MaxMessageBytes != 0 {
+		overwritten.Producer.MaxMessageBytes = c.MaxMessageBytes
+	}
+
+	// Sarama doesn't validate it, the broker rejects zstd compressed messages with an unclear error
+	if overwritten.Producer.Compression == sarama.CompressionZSTD && !overwritten.Version.IsAtLeast(sarama.V2_1_0_0) {
+		return nil, errors.New("zstd compression requires Version >= V2_1_0_0")
+	}
+	if err := overwritten.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Sarama config")
+	}
+
+	return &overwritten, nil
+}
+
+func (c ProducerConfig) applyPreset(saramaConfig *sarama.Config) {
+	switch c.Preset {
+	case ExactlyOnceSafe:
+		saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+		saramaConfig.Producer.Idempotent = true
+		saramaConfig.Net.MaxOpenRequests = 1
+		if saramaConfig.Producer.Retry.Max < 1 {
+			saramaConfig.Producer.Retry.Max = 10
+		}
+	case HighThroughput:
+		saramaConfig.Producer.RequiredAcks = sarama.WaitForLocal
+		saramaConfig.Producer.Compression = sarama.CompressionLZ4
+		saramaConfig.Producer.Flush.Frequency = time.Millisecond * 50
+		saramaConfig.Producer.Flush.Bytes = 1024 * 1024
+	case LowLatency:
+		saramaConfig.Producer.RequiredAcks = sarama.WaitForLocal
+		saramaConfig.Producer.Flush.Frequency = 0
+		saramaConfig.Producer.Flush.Bytes = 0
+		saramaConfig.Producer.Flush.Messages = 0
+	}
+}
+
+// MessageTooLargeError is returned by publishers, when the marshaled message exceeds
+// Producer.MaxMessageBytes of the Sarama config.
+type MessageTooLargeError struct {
+	MessageUUID     string
+	Topic           string
+	Size            int
+	MaxMessageBytes int
+}
+
+func (e MessageTooLargeError) Error() string {
+	return fmt.Sprintf(
+		"message %s published to %s is too large: %d bytes exceeds the limit of %d bytes (Producer.MaxMessageBytes)",
+		e.MessageUUID, e.Topic, e.Size, e.MaxMessageBytes,
+	)
+}
+
+// maximumRecordOverhead is the same as in Sarama
+const maximumRecordOverhead = 5*binary.MaxVarintLen32 + binary.MaxVarintLen64 + 1
+
+// producerMessageOverhead is the same as in Sarama
+const producerMessageOverhead = 26
+
+// producerMessageSize estimates the size of the message in the same way as Sarama,
+// when checking Producer.MaxMessageBytes.
+func producerMessageSize(msg *sarama.ProducerMessage, saramaConfig *sarama.Config) int {
+	var size int
+	if saramaConfig.Version.IsAtLeast(sarama.V0_11_0_0) {
+		size = maximumRecordOverhead
+		for _, h := range msg.Headers {
+			size += len(h.Key) + len(h.Value) + 2*binary.MaxVarintLen32
+		}
+	} else {
+		size = producerMessageOverhead
+	}
+	if msg.Key != nil {
+		size += msg.Key.Length()
+	}
+	if msg.Value != nil {
+		size += msg.Value.Length()
+	}
+
+	return size
+}
+
+// checkMessageSize returns MessageTooLargeError, when Sarama would reject the message because of its size.
+func checkMessageSize(messageUUID string, msg *sarama.ProducerMessage, saramaConfig *sarama.Config) error {
+	size := producerMessageSize(msg, saramaConfig)
+	if size > saramaConfig.Producer.MaxMessageBytes {
+		return MessageTooLargeError{
+			MessageUUID:     messageUUID,
+			Topic:           msg.Topic,
+			Size:            size,
+			MaxMessageBytes: saramaConfig.Producer.MaxMessageBytes,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package kafka_test
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/kafka"
+)
+
+func TestProducerConfig_OverwriteSaramaConfig(t *testing.T) {
+	original := kafka.DefaultSaramaSyncPublisherConfig()
+	original.Version = sarama.V2_1_0_0
+
+	zstd := sarama.CompressionZSTD
+	overwritten, err := kafka.ProducerConfig{
+		Compression:     &zstd,
+		MaxMessageBytes: 5 * 1024 * 1024,
+	}.OverwriteSaramaConfig(original)
+	require.NoError(t, err)
+
+	assert.Equal(t, sarama.CompressionZSTD, overwritten.Producer.Compression)
+	assert.Equal(t, 5*1024*1024, overwritten.Producer.MaxMessageBytes)
+	assert.Equal(t, sarama.CompressionNone, original.Producer.Compression, "original config should be not modified")
+}
+
+func TestProducerConfig_OverwriteSaramaConfig_keeps_compression(t *testing.T) {
+	original := kafka.DefaultSaramaSyncPublisherConfig()
+	original.Producer.Compression = sarama.CompressionGZIP
+
+	overwritten, err := kafka.ProducerConfig{
+		Preset:          kafka.ExactlyOnceSafe,
+		MaxMessageBytes: 1024,
+	}.OverwriteSaramaConfig(original)
+	require.NoError(t, err)
+
+	assert.Equal(t, sarama.CompressionGZIP, overwritten.Producer.Compression)
+
+	none := sarama.CompressionNone
+	overwritten, err = kafka.ProducerConfig{
+		Compression: &none,
+	}.OverwriteSaramaConfig(original)
+	require.NoError(t, err)
+
+	assert.Equal(t, sarama.CompressionNone, overwritten.Producer.Compression, "compression should be disabled explicitly")
+}
+
+func TestProducerConfig_OverwriteSaramaConfig_presets(t *testing.T) {
+	exactlyOnce, err := kafka.ProducerConfig{
+		Preset: kafka.ExactlyOnceSafe,
+	}.OverwriteSaramaConfig(kafka.DefaultSaramaSyncPublisherConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, sarama.WaitForAll, exactlyOnce.Producer.RequiredAcks)
+	assert.True(t, exactlyOnce.Producer.Idempotent)
+	assert.Equal(t, 1, exactlyOnce.Net.MaxOpenRequests)
+
+	highThroughput, err := kafka.ProducerConfig{
+		Preset: kafka.HighThroughput,
+	}.OverwriteSaramaConfig(kafka.DefaultSaramaSyncPublisherConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, sarama.WaitForLocal, highThroughput.Producer.RequiredAcks)
+	assert.Equal(t, sarama.CompressionLZ4, highThroughput.Producer.Compression)
+
+	snappy := sarama.CompressionSnappy
+	highThroughputSnappy, err := kafka.ProducerConfig{
+		Preset:      kafka.HighThroughput,
+		Compression: &snappy,
+	}.OverwriteSaramaConfig(kafka.DefaultSaramaSyncPublisherConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, sarama.CompressionSnappy, highThroughputSnappy.Producer.Compression, "Compression should override the preset")
+
+	noResponse := sarama.NoResponse
+	lowLatency, err := kafka.ProducerConfig{
+		Preset:       kafka.LowLatency,
+		RequiredAcks: &noResponse,
+	}.OverwriteSaramaConfig(kafka.DefaultSaramaSyncPublisherConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, sarama.NoResponse, lowLatency.Producer.RequiredAcks, "RequiredAcks should override the preset")
+}
+
+func TestProducerConfig_OverwriteSaramaConfig_invalid(t *testing.T) {
+	zstd := sarama.CompressionZSTD
+	gzip := sarama.CompressionGZIP
+
+	testCases := []struct {
+		Name   string
+		Config kafka.ProducerConfig
+	}{
+		{
+			Name:   "zstd_with_old_version",
+			Config: kafka.ProducerConfig{Compression: &zstd},
+		},
+		{
+			Name:   "invalid_gzip_level",
+			Config: kafka.ProducerConfig{Compression: &gzip, CompressionLevel: 100},
+		},
+		{
+			Name:   "unknown_preset",
+			Config: kafka.ProducerConfig{Preset: "unknown"},
+		},
+		{
+			Name:   "idempotent_with_many_open_requests",
+			Config: kafka.ProducerConfig{Preset: kafka.ExactlyOnceSafe, MaxOpenRequests: 5},
+		},
+		{
+			Name:   "negative_max_message_bytes",
+			Config: kafka.ProducerConfig{MaxMessageBytes: -1},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.Name, func(t *testing.T) {
+			_, err := c.Config.OverwriteSaramaConfig(kafka.DefaultSaramaSyncPublisherConfig())
+			assert.Error(t, err)
+		})
+	}
+}
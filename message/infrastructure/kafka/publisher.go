@@ -1,6 +1,9 @@
 package kafka
 
 import (
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
@@ -8,12 +11,18 @@ import (
 	"github.com/Shopify/sarama"
 
 	"github.com/ThreeDotsLabs/watermill/message"
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 )
 
 type Publisher struct {
-	producer  sarama.SyncProducer
-	marshaler Marshaler
+	producer     sarama.SyncProducer
+	marshaler    Marshaler
+	saramaConfig *sarama.Config
+	config       PublisherConfig
+
+	knownTopics     map[string]struct{}
+	knownTopicsLock sync.RWMutex
 
 	logger watermill.LoggerAdapter
 
@@ -21,22 +30,26 @@ type Publisher struct {
 }
 
 // NewPublisher creates a new Kafka Publisher.
+//
+// Topics are auto-created by the broker, when it's enabled. To control the creation of topics,
+// use NewPublisherWithConfig.
 func NewPublisher(
 	brokers []string,
 	marshaler Marshaler,
 	overwriteSaramaConfig *sarama.Config,
 	logger watermill.LoggerAdapter,
 ) (message.Publisher, error) {
-	if overwriteSaramaConfig == nil {
-		overwriteSaramaConfig = DefaultSaramaSyncPublisherConfig()
-	}
-
-	producer, err := sarama.NewSyncProducer(brokers, overwriteSaramaConfig)
+	pub, err := NewPublisherWithConfig(PublisherConfig{
+		Brokers:                brokers,
+		Marshaler:              marshaler,
+		OverwriteSaramaConfig:  overwriteSaramaConfig,
+		AllowAutoTopicCreation: true,
+	}, logger)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot create Kafka producer")
+		return nil, err
 	}
 
-	return &Publisher{producer, marshaler, logger, false}, nil
+	return pub, nil
 }
 
 func DefaultSaramaSyncPublisherConfig() *sarama.Config {
@@ -55,35 +68,67 @@ func DefaultSaramaSyncPublisherConfig() *sarama.Config {
 //
 // Publish is blocking and wait for ack from Kafka.
 // When one of messages delivery fails - function is interrupted.
+//
+// Messages exceeding Producer.MaxMessageBytes of the Sarama config are not sent, MessageTooLargeError is returned instead.
 func (p *Publisher) Publish(topic string, msgs ...*message.Message) error {
+	_, err := p.PublishWithResults(topic, msgs...)
+	return err
+}
+
+// PublishWithResults works like Publish, but it returns the partition and the offset of every published message.
+// BrokerMessageID of the result has the "partition/offset" format.
+func (p *Publisher) PublishWithResults(topic string, msgs ...*message.Message) ([]message.PublishResult, error) {
 	if p.closed {
-		return errors.New("publisher closed")
+		return nil, errors.New("publisher closed")
+	}
+
+	if err := p.ensureTopicBeforePublish(topic); err != nil {
+		return nil, err
 	}
 
-	logFields := make(watermill.LogFields, 4)
+	kafkaTopic := p.config.TopicMapper.kafkaTopic(topic)
+
+	logFields := make(watermill.LogFields, 5)
 	logFields["topic"] = topic
+	if kafkaTopic != topic {
+		logFields["kafka_topic"] = kafkaTopic
+	}
+
+	results := make([]message.PublishResult, 0, len(msgs))
 
 	for _, msg := range msgs {
 		logFields["message_uuid"] = msg.UUID
 		p.logger.Trace("Sending message to Kafka", logFields)
 
-		kafkaMsg, err := p.marshaler.Marshal(topic, msg)
+		kafkaMsg, err := p.marshaler.Marshal(kafkaTopic, msg)
 		if err != nil {
-			return errors.Wrapf(err, "cannot marshal message %s", msg.UUID)
+			return results, errors.Wrapf(err, "cannot marshal message %s", msg.UUID)
+		}
+		if err := checkMessageSize(msg.UUID, kafkaMsg, p.saramaConfig); err != nil {
+			return results, err
 		}
 
 		partition, offset, err := p.producer.SendMessage(kafkaMsg)
 		if err != nil {
-			return errors.Wrapf(err, "cannot produce message %s", msg.UUID)
+			return results, errors.Wrapf(err, "cannot produce message %s", msg.UUID)
 		}
 
 		logFields["kafka_partition"] = partition
 		logFields["kafka_partition_offset"] = offset
 
 		p.logger.Trace("Message sent to Kafka", logFields)
+
+		results = append(results, message.PublishResult{
+			MessageUUID:     msg.UUID,
+			BrokerMessageID: fmt.Sprintf("%d/%d", partition, offset),
+			Details: map[string]string{
+				"kafka_partition":        strconv.FormatInt(int64(partition), 10),
+				"kafka_partition_offset": strconv.FormatInt(offset, 10),
+			},
+		})
 	}
 
-	return nil
+	return results, nil
 }
 
 func (p *Publisher) Close() error {
@@ -92,9 +137,16 @@ func (p *Publisher) Close() error {
 	}
 	p.closed = true
 
+	var result error
 	if err := p.producer.Close(); err != nil {
-		return errors.Wrap(err, "cannot close Kafka producer")
+		result = multierror.Append(result, errors.Wrap(err, "cannot close Kafka producer"))
+	}
+	if p.config.ClientPool != nil {
+		// the shared client is released also when closing of the producer failed, so it doesn't leak
+		if err := p.config.ClientPool.release(); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "cannot release shared Kafka client"))
+		}
 	}
 
-	return nil
+	return result
 }
@@ -0,0 +1,52 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	internalSync "github.com/ThreeDotsLabs/watermill/internal/sync"
+)
+
+// failingCloseProducer implements only Close of sarama.SyncProducer.
+type failingCloseProducer struct {
+	sarama.SyncProducer
+}
+
+func (failingCloseProducer) Close() error {
+	return errors.New("cannot flush messages")
+}
+
+func TestPublisher_Close_releases_ClientPool_when_producer_close_fails(t *testing.T) {
+	closedClients := 0
+	pool := &ClientPool{client: internalSync.NewRefCounted(
+		func() (interface{}, error) {
+			return nil, nil
+		},
+		func(interface{}) error {
+			closedClients++
+			return nil
+		},
+	)}
+
+	_, err := pool.client.Acquire()
+	require.NoError(t, err)
+
+	pub := &Publisher{
+		producer: failingCloseProducer{},
+		config:   PublisherConfig{ClientPool: pool},
+	}
+
+	err = pub.Close()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot flush messages")
+
+	assert.Equal(t, 0, pool.client.Refs())
+	assert.Equal(t, 1, closedClients)
+
+	require.NoError(t, pub.Close())
+	assert.Equal(t, 1, closedClients)
+}
@@ -1,19 +1,24 @@
 package kafka_test
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill/internal"
 
 	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/message/infrastructure"
 	"github.com/ThreeDotsLabs/watermill/message/infrastructure/kafka"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -145,3 +150,196 @@ func TestNoGroupSubscriber(t *testing.T) {
 
 	infrastructure.TestNoGroupSubscriber(t, createPubSub, createNoGroupSubscriberConstructor)
 }
+
+func TestSubscribePartitions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long tests")
+	}
+
+	pubSub := createPartitionedPubSub(t)
+	defer pubSub.Close()
+
+	topic := "topic_" + watermill.NewUUID()
+	require.NoError(t, pubSub.Subscriber().(message.SubscribeInitializer).SubscribeInitialize(topic))
+
+	partitionKeys := []string{"a", "b", "c"}
+	messagesPerKey := 20
+
+	for i := 0; i < messagesPerKey; i++ {
+		for _, key := range partitionKeys {
+			msg := message.NewMessage(fmt.Sprintf("%s_%d", key, i), nil)
+			msg.Metadata.Set("partition_key", key)
+			require.NoError(t, pubSub.Publish(topic, msg))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	partitions, err := pubSub.Subscriber().(*kafka.Subscriber).SubscribePartitions(ctx, topic)
+	require.NoError(t, err)
+
+	received := map[string][]string{}
+	receivedLock := sync.Mutex{}
+	allReceived := make(chan struct{})
+
+	go func() {
+		for partition := range partitions {
+			go func(partition kafka.PartitionMessages) {
+				for msg := range partition.Messages {
+					receivedLock.Lock()
+					key := msg.Metadata.Get("partition_key")
+					received[key] = append(received[key], msg.UUID)
+					if len(received[key]) == messagesPerKey && len(received) == len(partitionKeys) {
+						select {
+						case <-allReceived:
+						default:
+							close(allReceived)
+						}
+					}
+					receivedLock.Unlock()
+
+					msg.Ack()
+				}
+			}(partition)
+		}
+	}()
+
+	select {
+	case <-allReceived:
+	case <-time.After(time.Second * 30):
+		t.Fatal("not all messages received")
+	}
+
+	receivedLock.Lock()
+	defer receivedLock.Unlock()
+
+	for _, key := range partitionKeys {
+		for i, uuid := range received[key] {
+			assert.Equal(t, fmt.Sprintf("%s_%d", key, i), uuid, "messages of the partition should be ordered")
+		}
+	}
+}
+
+func TestPublisher_message_too_large(t *testing.T) {
+	snappy := sarama.CompressionSnappy
+	saramaConfig, err := kafka.ProducerConfig{
+		Compression:     &snappy,
+		MaxMessageBytes: 1024,
+	}.OverwriteSaramaConfig(kafka.DefaultSaramaSyncPublisherConfig())
+	require.NoError(t, err)
+
+	publisher, err := kafka.NewPublisher(kafkaBrokers(), kafka.DefaultMarshaler{}, saramaConfig, watermill.NopLogger{})
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	msg := message.NewMessage(watermill.NewUUID(), make([]byte, 2048))
+
+	err = publisher.Publish("too_large_"+watermill.NewShortUUID(), msg)
+	require.Error(t, err)
+
+	tooLargeErr, ok := err.(kafka.MessageTooLargeError)
+	require.True(t, ok, "expected MessageTooLargeError, got %T", err)
+	assert.Equal(t, msg.UUID, tooLargeErr.MessageUUID)
+	assert.Equal(t, 1024, tooLargeErr.MaxMessageBytes)
+}
+
+func TestSubscriber_slow_message_skip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long tests")
+	}
+
+	logger := watermill.NewStdLogger(true, true)
+
+	publisher, err := kafka.NewPublisher(kafkaBrokers(), kafka.DefaultMarshaler{}, nil, logger)
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	saramaConfig := kafka.DefaultSaramaSubscriberConfig()
+	saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	slowMessages := make(chan kafka.SlowMessage, 1)
+	subscriber, err := kafka.NewSubscriber(
+		kafka.SubscriberConfig{
+			Brokers:       kafkaBrokers(),
+			ConsumerGroup: "test",
+			InitializeTopicDetails: &sarama.TopicDetail{
+				NumPartitions:     1,
+				ReplicationFactor: 1,
+			},
+			SlowMessage: kafka.SlowMessageConfig{
+				MaxProcessingTime: time.Millisecond * 500,
+				Action:            kafka.SlowMessageSkip,
+				OnSlowMessage: func(slowMessage kafka.SlowMessage) {
+					slowMessages <- slowMessage
+				},
+			},
+		},
+		saramaConfig,
+		kafka.DefaultMarshaler{},
+		logger,
+	)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	topic := "slow_message_" + watermill.NewShortUUID()
+	require.NoError(t, subscriber.(message.SubscribeInitializer).SubscribeInitialize(topic))
+
+	stuckMsg := message.NewMessage(watermill.NewUUID(), nil)
+	nextMsg := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, publisher.Publish(topic, stuckMsg, nextMsg))
+
+	messages, err := subscriber.Subscribe(context.Background(), topic)
+	require.NoError(t, err)
+
+	select {
+	case msg := <-messages:
+		// not acked, so it's skipped after MaxProcessingTime
+		assert.Equal(t, stuckMsg.UUID, msg.UUID)
+	case <-time.After(time.Second * 30):
+		t.Fatal("message not received")
+	}
+
+	select {
+	case slowMessage := <-slowMessages:
+		assert.Equal(t, stuckMsg.UUID, slowMessage.Message.UUID)
+		assert.Equal(t, kafka.SlowMessageSkip, slowMessage.Action)
+	case <-time.After(time.Second * 5):
+		t.Fatal("slow message not reported")
+	}
+
+	select {
+	case msg := <-messages:
+		assert.Equal(t, nextMsg.UUID, msg.UUID)
+		msg.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("next message not received after skipping the slow message")
+	}
+}
+
+func TestPublisher_auto_topic_creation_disabled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long tests")
+	}
+
+	ensuredTopic := "ensured_" + watermill.NewShortUUID()
+
+	publisher, err := kafka.NewPublisherWithConfig(kafka.PublisherConfig{
+		Brokers:   kafkaBrokers(),
+		Marshaler: kafka.DefaultMarshaler{},
+		Topics: map[string]*sarama.TopicDetail{
+			ensuredTopic: {NumPartitions: 3, ReplicationFactor: 1},
+		},
+	}, watermill.NewStdLogger(true, true))
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	err = publisher.Publish("missing_"+watermill.NewShortUUID(), message.NewMessage(watermill.NewUUID(), nil))
+	assert.Equal(t, kafka.ErrTopicDoesNotExist, errors.Cause(err))
+
+	// the topic with details is created before publishing
+	require.NoError(t, publisher.Publish(ensuredTopic, message.NewMessage(watermill.NewUUID(), nil)))
+
+	// EnsureTopic is idempotent
+	require.NoError(t, publisher.EnsureTopic(ensuredTopic, &sarama.TopicDetail{NumPartitions: 3, ReplicationFactor: 1}))
+}
@@ -0,0 +1,174 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// SlowMessageAction is the action taken, when the message is not acked or nacked within the MaxProcessingTime.
+type SlowMessageAction int
+
+const (
+	// SlowMessageWait keeps waiting for the ack or nack. The slow message is only reported.
+	SlowMessageWait SlowMessageAction = iota
+	// SlowMessageSkip marks the message as consumed and continues with the next message of the partition.
+	// The message's context is canceled.
+	SlowMessageSkip
+	// SlowMessageDeadLetter publishes the message to SlowMessageConfig.DeadLetterTopic and then skips it.
+	SlowMessageDeadLetter
+)
+
+func (a SlowMessageAction) String() string {
+	switch a {
+	case SlowMessageWait:
+		return "wait"
+	case SlowMessageSkip:
+		return "skip"
+	case SlowMessageDeadLetter:
+		return "dead_letter"
+	default:
+		return "unknown"
+	}
+}
+
+// SlowMessageOriginMetadataKey is the metadata key with the topic, partition and offset of the dead-lettered message,
+// in the "topic/partition/offset" format.
+const SlowMessageOriginMetadataKey = "kafka_origin"
+
+// SlowMessage describes the message, which exceeded SlowMessageConfig.MaxProcessingTime.
+type SlowMessage struct {
+	Message   *message.Message
+	Topic     string
+	Partition int32
+	Offset    int64
+
+	ProcessingTime time.Duration
+	Action         SlowMessageAction
+}
+
+// SlowMessageConfig limits the time of processing a single message.
+//
+// Messages of the partition are delivered one by one, so a message which is never acked stalls the partition
+// (and blocks the consumer group rebalance) indefinitely. No more messages of the partition are delivered,
+// until the slow message is acked, nacked or skipped.
+//
+// Sarama 1.20.1 can't pause fetching of the partition (PartitionConsumer.Pause was added in later versions),
+// so the partition is paused by holding its next messages in the Subscriber, like with Subscriber.Pause.
+// Sarama keeps fetching until Fetch.ChannelBufferSize messages are buffered. The session is kept alive,
+// so pausing doesn't trigger the rebalance.
+type SlowMessageConfig struct {
+	// MaxProcessingTime is the time after which the message, which was not acked or nacked, is considered slow.
+	// When 0, the processing time is not limited.
+	MaxProcessingTime time.Duration
+
+	// Action is the action taken on the slow message. Defaults to SlowMessageWait.
+	Action SlowMessageAction
+
+	// DeadLetterPublisher and DeadLetterTopic are required by SlowMessageDeadLetter.
+	DeadLetterPublisher message.Publisher
+	DeadLetterTopic     string
+
+	// OnSlowMessage is optional and it's called with every slow message, for example to record metrics.
+	OnSlowMessage func(slowMessage SlowMessage)
+
+	// PauseDuration is optional. When set, the partition stays paused for PauseDuration after the slow message
+	// is acked, nacked or skipped, so the handler (or the service it depends on) can recover
+	// before the next message of the partition is delivered.
+	// The pause ends earlier, when the consumer group rebalances or the Subscriber is closed.
+	PauseDuration time.Duration
+}
+
+func (c SlowMessageConfig) Validate() error {
+	if c.MaxProcessingTime < 0 {
+		return errors.New("MaxProcessingTime cannot be negative")
+	}
+	if c.PauseDuration < 0 {
+		return errors.New("PauseDuration cannot be negative")
+	}
+	if c.Action == SlowMessageDeadLetter && (c.DeadLetterPublisher == nil || c.DeadLetterTopic == "") {
+		return errors.New("SlowMessageDeadLetter requires DeadLetterPublisher and DeadLetterTopic")
+	}
+
+	return nil
+}
+
+// handleSlowMessage takes the configured action. It returns true, when the message should be skipped.
+func (h messageHandler) handleSlowMessage(
+	msg *message.Message,
+	kafkaMsg *sarama.ConsumerMessage,
+	processingTime time.Duration,
+	logFields watermill.LogFields,
+) bool {
+	config := h.slowMessage
+
+	logFields = logFields.Add(watermill.LogFields{
+		"processing_time": processingTime,
+		"action":          config.Action.String(),
+	})
+	h.logger.Info("Message processing time exceeded", logFields)
+
+	if config.OnSlowMessage != nil {
+		config.OnSlowMessage(SlowMessage{
+			Message:        msg,
+			Topic:          kafkaMsg.Topic,
+			Partition:      kafkaMsg.Partition,
+			Offset:         kafkaMsg.Offset,
+			ProcessingTime: processingTime,
+			Action:         config.Action,
+		})
+	}
+
+	switch config.Action {
+	case SlowMessageSkip:
+		return true
+	case SlowMessageDeadLetter:
+		deadLetterMsg := msg.Copy()
+		deadLetterMsg.Metadata.Set(message.DeadLetterReasonMetadataKey, "max processing time exceeded")
+		deadLetterMsg.Metadata.Set(
+			SlowMessageOriginMetadataKey,
+			fmt.Sprintf("%s/%d/%d", kafkaMsg.Topic, kafkaMsg.Partition, kafkaMsg.Offset),
+		)
+
+		if err := config.DeadLetterPublisher.Publish(config.DeadLetterTopic, deadLetterMsg); err != nil {
+			h.logger.Error("Cannot publish slow message to dead letter topic, waiting for ack", err, logFields)
+			return false
+		}
+
+		return true
+	default:
+		return false
+	}
+}
+
+// pausePartition holds the next messages of the partition of the slow message for SlowMessageConfig.PauseDuration.
+// It returns false, when the session or the subscription is done before the pause ends.
+func (h messageHandler) pausePartition(
+	ctx context.Context,
+	sessionDone <-chan struct{},
+	logFields watermill.LogFields,
+) bool {
+	h.logger.Info("Partition paused after slow message", logFields.Add(watermill.LogFields{
+		"pause_duration": h.slowMessage.PauseDuration,
+	}))
+
+	timer := time.NewTimer(h.slowMessage.PauseDuration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-sessionDone:
+		return false
+	case <-ctx.Done():
+		return false
+	case <-h.closing:
+		return false
+	}
+}
@@ -12,11 +12,19 @@ import (
 	"github.com/Shopify/sarama"
 
 	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/backoff"
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
 	"github.com/ThreeDotsLabs/watermill/message"
 
 	"github.com/pkg/errors"
 )
 
+var closedChan = make(chan struct{})
+
+func init() {
+	close(closedChan)
+}
+
 type Subscriber struct {
 	config       SubscriberConfig
 	saramaConfig *sarama.Config
@@ -27,6 +35,9 @@ type Subscriber struct {
 	closing       chan struct{}
 	subscribersWg sync.WaitGroup
 
+	pausedTopics     map[string]chan struct{}
+	pausedTopicsLock sync.Mutex
+
 	closed bool
 }
 
@@ -43,9 +54,20 @@ func NewSubscriber(
 		return nil, err
 	}
 
+	if config.ClientPool != nil {
+		if overwriteSaramaConfig != nil {
+			return nil, errors.New("overwriteSaramaConfig cannot be used together with SubscriberConfig.ClientPool")
+		}
+		overwriteSaramaConfig = config.ClientPool.saramaConfig
+	}
 	if overwriteSaramaConfig == nil {
 		overwriteSaramaConfig = DefaultSaramaSubscriberConfig()
 	}
+	overwriteSaramaConfig = config.overwriteSaramaConfig(overwriteSaramaConfig)
+
+	if err := overwriteSaramaConfig.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Sarama config")
+	}
 
 	logger = logger.With(watermill.LogFields{
 		"subscriber_uuid": shortuuid.New(),
@@ -55,10 +77,12 @@ func NewSubscriber(
 		config:       config,
 		saramaConfig: overwriteSaramaConfig,
 
-		unmarshaler: unmarshaler,
+		unmarshaler: interceptedUnmarshaler(unmarshaler, config.ConsumerInterceptors),
 		logger:      logger,
 
 		closing: make(chan struct{}),
+
+		pausedTopics: map[string]chan struct{}{},
 	}, nil
 }
 
@@ -70,25 +94,97 @@ type SubscriberConfig struct {
 	// When empty, all messages from all partitions will be returned.
 	ConsumerGroup string
 
+	// SessionTimeout overrides Consumer.Group.Session.Timeout of the Sarama config.
+	// When no heartbeat is received before the timeout, the consumer is removed from the group and a rebalance starts.
+	SessionTimeout time.Duration
+
+	// HeartbeatInterval overrides Consumer.Group.Heartbeat.Interval of the Sarama config.
+	// It must be lower than SessionTimeout, typically not higher than 1/3 of it.
+	HeartbeatInterval time.Duration
+
+	// RebalanceStrategy overrides Consumer.Group.Rebalance.Strategy of the Sarama config.
+	RebalanceStrategy RebalanceStrategy
+
+	// RebalanceTimeout overrides Consumer.Group.Rebalance.Timeout of the Sarama config.
+	RebalanceTimeout time.Duration
+
+	// PartitionOffsets enables the partition reader mode: only the specified partitions of the topic are consumed,
+	// starting at the specified offsets, without joining a consumer group.
+	// sarama.OffsetOldest and sarama.OffsetNewest can be used as offsets.
+	//
+	// Offsets are not committed to Kafka. After reconnect, consuming is resumed after the last consumed message.
+	// It cannot be used together with ConsumerGroup.
+	PartitionOffsets map[int32]int64
+
+	// KeyFilter is called with the key of every consumed Kafka message, before the message is unmarshaled.
+	// Messages for which it returns false are skipped (and marked as consumed).
+	// It is optional.
+	KeyFilter func(key []byte) bool
+
+	// ConsumerInterceptors are called in order with every received record, before it's unmarshaled.
+	// They can modify the raw Sarama record, for example to decrypt the value or record custom telemetry.
+	// Records filtered out by KeyFilter are not passed to them. See InterceptingUnmarshaler.
+	ConsumerInterceptors []ConsumerInterceptor
+
 	// How long after Nack message should be redelivered.
 	NackResendSleep time.Duration
 
 	// How long about unsuccessful reconnecting next reconnect will occur.
 	ReconnectRetrySleep time.Duration
 
+	// ReconnectBackoff is the strategy of delays between unsuccessful reconnects.
+	// When set, ReconnectRetrySleep is ignored.
+	// When the strategy stops retrying, the subscription is closed.
+	ReconnectBackoff backoff.Strategy
+
+	// SlowMessage limits the time of processing a single message, so a stuck message doesn't stall the partition.
+	SlowMessage SlowMessageConfig
+
+	// Fetch overrides the fetch and buffering settings of the Sarama config,
+	// which allow to tune the throughput and the latency of high-volume consumers.
+	Fetch FetchConfig
+
+	// MetricsSink is optional and receives per-partition consumption metrics
+	// (MetricConsumedMessages, MetricConsumeLatency and MetricProcessingTime).
+	MetricsSink metrics.MetricsSink
+
+	// TopicMapper is optional and maps topics passed to the Subscriber to names of Kafka topics.
+	TopicMapper TopicMapper
+
+	// ClientPool is optional. When set, subscriptions use the client shared by the pool, instead of creating their own.
+	// Brokers default to the ones of the pool. The Sarama config of the pool is used, so it cannot be overwritten
+	// by NewSubscriber, the group and fetch settings of the config or the StartPosition subscribe option.
+	ClientPool *ClientPool
+
 	InitializeTopicDetails *sarama.TopicDetail
+
+	// InitializeTopicBackoff is optional. When set, creating the topic in SubscribeInitialize is retried with it.
+	InitializeTopicBackoff backoff.Strategy
 }
 
 // NoSleep can be set to SubscriberConfig.NackResendSleep and SubscriberConfig.ReconnectRetrySleep.
 const NoSleep time.Duration = -1
 
 func (c *SubscriberConfig) setDefaults() {
+	if c.ClientPool != nil && len(c.Brokers) == 0 {
+		c.Brokers = c.ClientPool.brokers
+	}
 	if c.NackResendSleep == 0 {
 		c.NackResendSleep = time.Millisecond * 100
 	}
 	if c.ReconnectRetrySleep == 0 {
 		c.ReconnectRetrySleep = time.Second
 	}
+	if c.ReconnectBackoff == nil {
+		if c.ReconnectRetrySleep == NoSleep {
+			c.ReconnectBackoff = backoff.Constant(0)
+		} else {
+			c.ReconnectBackoff = backoff.Constant(c.ReconnectRetrySleep)
+		}
+	}
+	if c.InitializeTopicBackoff == nil {
+		c.InitializeTopicBackoff = backoff.MaxAttempts(backoff.Constant(0), 0)
+	}
 }
 
 func (c SubscriberConfig) Validate() error {
@@ -96,53 +192,247 @@ func (c SubscriberConfig) Validate() error {
 		return errors.New("missing brokers")
 	}
 
+	if c.ConsumerGroup == "" && c.groupSettingsSet() {
+		return errors.New("SessionTimeout, HeartbeatInterval, RebalanceStrategy and RebalanceTimeout require ConsumerGroup")
+	}
+	if c.ConsumerGroup != "" && len(c.PartitionOffsets) > 0 {
+		return errors.New("PartitionOffsets cannot be used together with ConsumerGroup")
+	}
+	for partition := range c.PartitionOffsets {
+		if partition < 0 {
+			return errors.Errorf("invalid partition %d in PartitionOffsets", partition)
+		}
+	}
+	if c.SessionTimeout < 0 || c.HeartbeatInterval < 0 || c.RebalanceTimeout < 0 {
+		return errors.New("SessionTimeout, HeartbeatInterval and RebalanceTimeout cannot be negative")
+	}
+	if c.SessionTimeout != 0 && c.HeartbeatInterval != 0 && c.HeartbeatInterval >= c.SessionTimeout {
+		return errors.Errorf(
+			"HeartbeatInterval (%s) must be lower than SessionTimeout (%s)",
+			c.HeartbeatInterval, c.SessionTimeout,
+		)
+	}
+	if err := c.SlowMessage.Validate(); err != nil {
+		return errors.Wrap(err, "invalid SlowMessage config")
+	}
+	if err := c.Fetch.Validate(); err != nil {
+		return errors.Wrap(err, "invalid Fetch config")
+	}
+	if c.ClientPool != nil && (c.groupSettingsSet() || c.Fetch.set()) {
+		return errors.New("group and Fetch settings cannot be used together with ClientPool")
+	}
+	if c.RebalanceStrategy != "" {
+		if _, ok := rebalanceStrategies[c.RebalanceStrategy]; !ok {
+			return errors.Errorf(
+				"unsupported RebalanceStrategy %s, supported strategies: %s, %s",
+				c.RebalanceStrategy, RebalanceStrategyRange, RebalanceStrategyRoundRobin,
+			)
+		}
+	}
+
 	return nil
 }
 
+func (c SubscriberConfig) groupSettingsSet() bool {
+	return c.SessionTimeout != 0 || c.HeartbeatInterval != 0 || c.RebalanceStrategy != "" || c.RebalanceTimeout != 0
+}
+
+// RebalanceStrategy is the strategy of allocating topic partitions to members of the consumer group.
+type RebalanceStrategy string
+
+const (
+	RebalanceStrategyRange      RebalanceStrategy = "range"
+	RebalanceStrategyRoundRobin RebalanceStrategy = "roundrobin"
+)
+
+var rebalanceStrategies = map[RebalanceStrategy]sarama.BalanceStrategy{
+	RebalanceStrategyRange:      sarama.BalanceStrategyRange,
+	RebalanceStrategyRoundRobin: sarama.BalanceStrategyRoundRobin,
+}
+
+// overwriteSaramaConfig returns a copy of saramaConfig with the group and fetch settings from the config applied.
+func (c SubscriberConfig) overwriteSaramaConfig(saramaConfig *sarama.Config) *sarama.Config {
+	if !c.groupSettingsSet() && !c.Fetch.set() {
+		return saramaConfig
+	}
+
+	overwritten := *saramaConfig
+	c.Fetch.overwriteSaramaConfig(&overwritten)
+
+	if c.SessionTimeout != 0 {
+		overwritten.Consumer.Group.Session.Timeout = c.SessionTimeout
+	}
+	if c.HeartbeatInterval != 0 {
+		overwritten.Consumer.Group.Heartbeat.Interval = c.HeartbeatInterval
+	}
+	if c.RebalanceStrategy != "" {
+		overwritten.Consumer.Group.Rebalance.Strategy = rebalanceStrategies[c.RebalanceStrategy]
+	}
+	if c.RebalanceTimeout != 0 {
+		overwritten.Consumer.Group.Rebalance.Timeout = c.RebalanceTimeout
+	}
+
+	return &overwritten
+}
+
 // Subscribe subscribers for messages in Kafka.
 //
 // There are multiple subscribers spawned
 func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	return s.SubscribeWithOptions(ctx, topic)
+}
+
+// SubscribeWithOptions works like Subscribe, with the subscription's settings overridden by opts.
+//
+// ConsumerGroup overrides SubscriberConfig.ConsumerGroup.
+// StartPosition overrides Consumer.Offsets.Initial of the Sarama config.
+func (s *Subscriber) SubscribeWithOptions(
+	ctx context.Context,
+	topic string,
+	opts ...message.SubscribeOption,
+) (<-chan *message.Message, error) {
+	sub := s.newSubscription(topic, message.NewSubscribeOptions(opts...))
+
+	// we don't want to have buffered channel to not consume message from Kafka when consumer is not consuming
+	output := make(chan *message.Message, 0)
+
+	if err := s.subscribe(ctx, sub, output, func() { close(output) }); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// PartitionMessages are messages from a single partition of the topic, returned by SubscribePartitions.
+type PartitionMessages struct {
+	Topic     string
+	Partition int32
+
+	// Messages are sent in the order of the partition, the next message is sent after the previous one is acked.
+	// The channel is closed when the partition is revoked (for example during the consumer group rebalance)
+	// or the subscription is closed.
+	Messages <-chan *message.Message
+}
+
+// SubscribePartitions works like SubscribeWithOptions, but messages of every consumed partition
+// are sent to a separate channel. The channel is sent as PartitionMessages every time the partition is assigned.
+//
+// Handling every partition's channel in a separate goroutine allows processing messages concurrently,
+// while preserving the order of messages within the partition.
+func (s *Subscriber) SubscribePartitions(
+	ctx context.Context,
+	topic string,
+	opts ...message.SubscribeOption,
+) (<-chan PartitionMessages, error) {
+	sub := s.newSubscription(topic, message.NewSubscribeOptions(opts...))
+
+	partitions := make(chan PartitionMessages)
+	sub.partitions = partitions
+
+	if err := s.subscribe(ctx, sub, nil, func() { close(partitions) }); err != nil {
+		return nil, err
+	}
+
+	return partitions, nil
+}
+
+// subscribe starts consuming the subscription. onClose is called after consuming is stopped.
+func (s *Subscriber) subscribe(
+	ctx context.Context,
+	sub subscription,
+	output chan *message.Message,
+	onClose func(),
+) error {
 	if s.closed {
-		return nil, errors.New("subscriber closed")
+		return errors.New("subscriber closed")
+	}
+
+	if sub.consumerGroup != "" && sub.partitionOffsets != nil {
+		return errors.New("consumer group cannot be used together with SubscriberConfig.PartitionOffsets")
+	}
+	if s.config.ClientPool != nil && sub.saramaConfig != s.saramaConfig {
+		return errors.New("StartPosition cannot be used together with SubscriberConfig.ClientPool")
 	}
 
 	s.subscribersWg.Add(1)
 
 	logFields := watermill.LogFields{
 		"provider":            "kafka",
-		"topic":               topic,
-		"consumer_group":      s.config.ConsumerGroup,
+		"topic":               sub.topic,
+		"kafka_topic":         sub.kafkaTopic,
+		"consumer_group":      sub.consumerGroup,
 		"kafka_consumer_uuid": shortuuid.New(),
 	}
 	s.logger.Info("Subscribing to Kafka topic", logFields)
 
-	// we don't want to have buffered channel to not consume message from Kafka when consumer is not consuming
-	output := make(chan *message.Message, 0)
-
-	consumeClosed, err := s.consumeMessages(ctx, topic, output, logFields)
+	consumeClosed, err := s.consumeMessages(ctx, sub, output, logFields)
 	if err != nil {
 		s.subscribersWg.Done()
-		return nil, err
+		return err
 	}
 
 	go func() {
 		// blocking, until s.closing is closed
-		s.handleReconnects(ctx, topic, output, consumeClosed, logFields)
-		close(output)
+		s.handleReconnects(ctx, sub, output, consumeClosed, logFields)
+		onClose()
 		s.subscribersWg.Done()
 	}()
 
-	return output, nil
+	return nil
+}
+
+// subscription contains settings of a single Subscribe call.
+type subscription struct {
+	topic         string
+	kafkaTopic    string
+	consumerGroup string
+	saramaConfig  *sarama.Config
+
+	// partitionOffsets is set in the partition reader mode
+	partitionOffsets *partitionOffsets
+
+	// partitions is set by SubscribePartitions, messages are sent to a separate channel for every partition
+	partitions chan<- PartitionMessages
+}
+
+func (s *Subscriber) newSubscription(topic string, options message.SubscribeOptions) subscription {
+	sub := subscription{
+		topic:         topic,
+		kafkaTopic:    s.config.TopicMapper.kafkaTopic(topic),
+		consumerGroup: s.config.ConsumerGroup,
+		saramaConfig:  s.saramaConfig,
+	}
+
+	if len(s.config.PartitionOffsets) > 0 {
+		sub.partitionOffsets = newPartitionOffsets(s.config.PartitionOffsets)
+	}
+
+	if options.ConsumerGroup != "" {
+		sub.consumerGroup = options.ConsumerGroup
+	}
+
+	if options.StartPosition != message.StartPositionDefault {
+		saramaConfig := *s.saramaConfig
+		if options.StartPosition == message.StartPositionOldest {
+			saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+		} else {
+			saramaConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+		}
+		sub.saramaConfig = &saramaConfig
+	}
+
+	return sub
 }
 
 func (s *Subscriber) handleReconnects(
 	ctx context.Context,
-	topic string,
+	sub subscription,
 	output chan *message.Message,
 	consumeClosed chan struct{},
 	logFields watermill.LogFields,
 ) {
+	reconnectAttempt := 0
+
 	for {
 		// nil channel will cause deadlock
 		if consumeClosed != nil {
@@ -167,52 +457,86 @@ func (s *Subscriber) handleReconnects(
 		s.logger.Info("Reconnecting consumer", logFields)
 
 		var err error
-		consumeClosed, err = s.consumeMessages(ctx, topic, output, logFields)
+		consumeClosed, err = s.consumeMessages(ctx, sub, output, logFields)
 		if err != nil {
 			s.logger.Error("Cannot reconnect messages consumer", err, logFields)
 
-			if s.config.ReconnectRetrySleep != NoSleep {
-				time.Sleep(s.config.ReconnectRetrySleep)
+			reconnectAttempt++
+			retry, waitErr := backoff.Wait(ctx, s.config.ReconnectBackoff, reconnectAttempt)
+			if waitErr != nil {
+				// ctx is canceled, handled at the beginning of the loop
+				continue
+			}
+			if !retry {
+				s.logger.Error("Giving up reconnecting consumer", err, logFields)
+				return
 			}
 			continue
 		}
+
+		reconnectAttempt = 0
 	}
 }
 
 func (s *Subscriber) consumeMessages(
 	ctx context.Context,
-	topic string,
+	sub subscription,
 	output chan *message.Message,
 	logFields watermill.LogFields,
 ) (consumeMessagesClosed chan struct{}, err error) {
 	s.logger.Info("Starting consuming", logFields)
 
 	// Start with a client
-	client, err := sarama.NewClient(s.config.Brokers, s.saramaConfig)
+	client, closeClient, err := s.newClient(sub)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot create new Sarama client")
+		return nil, err
 	}
 
-	if s.config.ConsumerGroup == "" {
-		consumeMessagesClosed, err = s.consumeWithoutConsumerGroups(ctx, client, topic, output, logFields)
+	if sub.consumerGroup == "" {
+		consumeMessagesClosed, err = s.consumeWithoutConsumerGroups(ctx, client, sub, output, logFields)
 	} else {
-		consumeMessagesClosed, err = s.consumeGroupMessages(ctx, client, topic, output, logFields)
+		consumeMessagesClosed, err = s.consumeGroupMessages(ctx, client, sub, output, logFields)
+	}
+	if err != nil {
+		if err := closeClient(); err != nil {
+			s.logger.Error("Cannot close client", err, logFields)
+		}
+		return nil, err
 	}
 
 	go func() {
 		<-consumeMessagesClosed
-		if err := client.Close(); err != nil {
+		if err := closeClient(); err != nil {
 			s.logger.Error("Cannot close client", err, logFields)
 		}
 	}()
 
-	return consumeMessagesClosed, err
+	return consumeMessagesClosed, nil
+}
+
+// newClient returns the client from the pool, when it's set, or a new client.
+// The returned function closes the client or releases it to the pool.
+func (s *Subscriber) newClient(sub subscription) (sarama.Client, func() error, error) {
+	if s.config.ClientPool != nil {
+		client, err := s.config.ClientPool.acquire()
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, s.config.ClientPool.release, nil
+	}
+
+	client, err := sarama.NewClient(s.config.Brokers, sub.saramaConfig)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot create new Sarama client")
+	}
+
+	return client, client.Close, nil
 }
 
 func (s *Subscriber) consumeGroupMessages(
 	ctx context.Context,
 	client sarama.Client,
-	topic string,
+	sub subscription,
 	output chan *message.Message,
 	logFields watermill.LogFields,
 ) (chan struct{}, error) {
@@ -223,7 +547,7 @@ func (s *Subscriber) consumeGroupMessages(
 	}()
 
 	// Start a new consumer group
-	group, err := sarama.NewConsumerGroupFromClient(s.config.ConsumerGroup, client)
+	group, err := sarama.NewConsumerGroupFromClient(sub.consumerGroup, client)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot create consumer group client")
 	}
@@ -235,15 +559,17 @@ func (s *Subscriber) consumeGroupMessages(
 
 	handler := consumerGroupHandler{
 		ctx:              ctx,
+		topic:            sub.topic,
 		messageHandler:   s.createMessagesHandler(output),
 		logger:           s.logger,
 		closing:          s.closing,
+		partitions:       sub.partitions,
 		messageLogFields: logFields,
 	}
 
 	closed := make(chan struct{})
 	go func() {
-		if err := group.Consume(ctx, []string{topic}, handler); err != nil && err != sarama.ErrUnknown {
+		if err := group.Consume(ctx, []string{sub.kafkaTopic}, handler); err != nil && err != sarama.ErrUnknown {
 			s.logger.Error("Group consume error", err, logFields)
 		}
 
@@ -261,7 +587,7 @@ func (s *Subscriber) consumeGroupMessages(
 func (s *Subscriber) consumeWithoutConsumerGroups(
 	ctx context.Context,
 	client sarama.Client,
-	topic string,
+	sub subscription,
 	output chan *message.Message,
 	logFields watermill.LogFields,
 ) (chan struct{}, error) {
@@ -270,27 +596,38 @@ func (s *Subscriber) consumeWithoutConsumerGroups(
 		return nil, errors.Wrap(err, "cannot create client")
 	}
 
-	partitions, err := consumer.Partitions(topic)
+	offsets, err := s.partitionsToConsume(consumer, sub)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot get partitions")
+		return nil, err
 	}
 
 	partitionConsumersWg := &sync.WaitGroup{}
+	var partitionConsumers []sarama.PartitionConsumer
 
-	for _, partition := range partitions {
+	for partition, offset := range offsets {
 		partitionConsumersWg.Add(1)
 
-		partitionConsumer, err := consumer.ConsumePartition(topic, partition, s.saramaConfig.Consumer.Offsets.Initial)
+		partitionConsumer, err := consumer.ConsumePartition(sub.kafkaTopic, partition, offset)
 		if err != nil {
-			if err := client.Close(); err != nil && err != sarama.ErrClosedClient {
-				s.logger.Error("Cannot close client", err, logFields)
+			// the client may be shared by ClientPool, so already started consumers are closed one by one
+			for _, started := range partitionConsumers {
+				started.AsyncClose()
 			}
 			return nil, errors.Wrap(err, "failed to start consumer for partition")
 		}
+		partitionConsumers = append(partitionConsumers, partitionConsumer)
 
 		messageHandler := s.createMessagesHandler(output)
 
-		go s.consumePartition(ctx, partitionConsumer, messageHandler, partitionConsumersWg, logFields)
+		go s.consumePartition(
+			ctx,
+			sub,
+			partition,
+			partitionConsumer,
+			messageHandler,
+			partitionConsumersWg,
+			logFields,
+		)
 	}
 
 	closed := make(chan struct{})
@@ -302,8 +639,64 @@ func (s *Subscriber) consumeWithoutConsumerGroups(
 	return closed, nil
 }
 
+// partitionsToConsume returns partitions of the topic to consume, with offsets from which consuming should start.
+func (s *Subscriber) partitionsToConsume(consumer sarama.Consumer, sub subscription) (map[int32]int64, error) {
+	if sub.partitionOffsets != nil {
+		return sub.partitionOffsets.next(), nil
+	}
+
+	partitions, err := consumer.Partitions(sub.kafkaTopic)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get partitions")
+	}
+
+	offsets := make(map[int32]int64, len(partitions))
+	for _, partition := range partitions {
+		offsets[partition] = sub.saramaConfig.Consumer.Offsets.Initial
+	}
+
+	return offsets, nil
+}
+
+// partitionOffsets tracks offsets of the next messages to consume in the partition reader mode,
+// so consuming can be resumed after reconnect.
+type partitionOffsets struct {
+	offsets map[int32]int64
+	lock    sync.Mutex
+}
+
+func newPartitionOffsets(initialOffsets map[int32]int64) *partitionOffsets {
+	offsets := make(map[int32]int64, len(initialOffsets))
+	for partition, offset := range initialOffsets {
+		offsets[partition] = offset
+	}
+
+	return &partitionOffsets{offsets: offsets}
+}
+
+func (p *partitionOffsets) next() map[int32]int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	offsets := make(map[int32]int64, len(p.offsets))
+	for partition, offset := range p.offsets {
+		offsets[partition] = offset
+	}
+
+	return offsets
+}
+
+func (p *partitionOffsets) consumed(kafkaMsg *sarama.ConsumerMessage) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.offsets[kafkaMsg.Partition] = kafkaMsg.Offset + 1
+}
+
 func (s *Subscriber) consumePartition(
 	ctx context.Context,
+	sub subscription,
+	partition int32,
 	partitionConsumer sarama.PartitionConsumer,
 	messageHandler messageHandler,
 	partitionConsumersWg *sync.WaitGroup,
@@ -316,6 +709,18 @@ func (s *Subscriber) consumePartition(
 		partitionConsumersWg.Done()
 	}()
 
+	if sub.partitions != nil {
+		output, ok := announcePartition(ctx, s.closing, sub.partitions, sub.topic, partition)
+		if !ok {
+			return
+		}
+		defer close(output)
+
+		messageHandler.outputChannel = output
+	}
+
+	offsets := sub.partitionOffsets
+
 	kafkaMessages := partitionConsumer.Messages()
 
 	for {
@@ -332,6 +737,9 @@ func (s *Subscriber) consumePartition(
 			if err := messageHandler.processMessage(ctx, kafkaMsg, nil, logFields); err != nil {
 				return
 			}
+			if offsets != nil {
+				offsets.consumed(kafkaMsg)
+			}
 		}
 	}
 }
@@ -340,12 +748,71 @@ func (s *Subscriber) createMessagesHandler(output chan *message.Message) message
 	return messageHandler{
 		outputChannel:   output,
 		unmarshaler:     s.unmarshaler,
+		keyFilter:       s.config.KeyFilter,
 		nackResendSleep: s.config.NackResendSleep,
+		slowMessage:     s.config.SlowMessage,
+		metrics:         newConsumeMetrics(s.config.MetricsSink, s.config.ConsumerGroup),
+		topicResumed:    s.topicResumed,
 		logger:          s.logger,
 		closing:         s.closing,
 	}
 }
 
+// Pause stops passing messages from the topic to the output channels, without closing the subscription.
+//
+// Partitions stay assigned to the consumer and the session is kept alive,
+// so pausing doesn't trigger the consumer group rebalance. When the rebalance is triggered by other members,
+// paused partitions are released without waiting for Resume.
+// Messages which were already sent to the output channel are not affected.
+//
+// Pause is idempotent.
+func (s *Subscriber) Pause(topic string) {
+	// consumed messages carry names of Kafka topics
+	topic = s.config.TopicMapper.kafkaTopic(topic)
+
+	s.pausedTopicsLock.Lock()
+	defer s.pausedTopicsLock.Unlock()
+
+	if _, ok := s.pausedTopics[topic]; ok {
+		return
+	}
+	s.pausedTopics[topic] = make(chan struct{})
+
+	s.logger.Info("Topic consumption paused", watermill.LogFields{"topic": topic})
+}
+
+// Resume resumes consuming messages from the topic paused with Pause.
+//
+// Resume is idempotent.
+func (s *Subscriber) Resume(topic string) {
+	// consumed messages carry names of Kafka topics
+	topic = s.config.TopicMapper.kafkaTopic(topic)
+
+	s.pausedTopicsLock.Lock()
+	defer s.pausedTopicsLock.Unlock()
+
+	resumed, ok := s.pausedTopics[topic]
+	if !ok {
+		return
+	}
+	close(resumed)
+	delete(s.pausedTopics, topic)
+
+	s.logger.Info("Topic consumption resumed", watermill.LogFields{"topic": topic})
+}
+
+// topicResumed returns channel which is closed when the topic is not paused.
+func (s *Subscriber) topicResumed(topic string) <-chan struct{} {
+	s.pausedTopicsLock.Lock()
+	defer s.pausedTopicsLock.Unlock()
+
+	if resumed, ok := s.pausedTopics[topic]; ok {
+		return resumed
+	}
+
+	return closedChan
+}
+
 func (s *Subscriber) Close() error {
 	if s.closed {
 		return nil
@@ -362,9 +829,11 @@ func (s *Subscriber) Close() error {
 
 type consumerGroupHandler struct {
 	ctx              context.Context
+	topic            string
 	messageHandler   messageHandler
 	logger           watermill.LoggerAdapter
 	closing          chan struct{}
+	partitions       chan<- PartitionMessages
 	messageLogFields watermill.LogFields
 }
 
@@ -382,6 +851,17 @@ func (h consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cla
 
 	h.logger.Debug("Consume claimed", logFields)
 
+	messageHandler := h.messageHandler
+	if h.partitions != nil {
+		output, ok := announcePartition(h.ctx, h.closing, h.partitions, h.topic, claim.Partition())
+		if !ok {
+			return nil
+		}
+		defer close(output)
+
+		messageHandler.outputChannel = output
+	}
+
 	for {
 		select {
 		case kafkaMsg := <-kafkaMessages:
@@ -389,7 +869,7 @@ func (h consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cla
 				// kafkaMessages is closed
 				return nil
 			}
-			if err := h.messageHandler.processMessage(h.ctx, kafkaMsg, sess, logFields); err != nil {
+			if err := messageHandler.processMessage(h.ctx, kafkaMsg, sess, logFields); err != nil {
 				// error will stop consumerGroupHandler
 				return err
 			}
@@ -399,16 +879,48 @@ func (h consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cla
 
 		case <-h.ctx.Done():
 			return nil
+
+		case <-sess.Context().Done():
+			// the session ends with the rebalance, claims must be released as soon as possible
+			return nil
 		}
 	}
 }
 
+// announcePartition creates the output channel of the partition and sends it to partitions.
+// It returns false, when the subscriber is closing before the partition's channel is received.
+func announcePartition(
+	ctx context.Context,
+	closing chan struct{},
+	partitions chan<- PartitionMessages,
+	topic string,
+	partition int32,
+) (chan *message.Message, bool) {
+	output := make(chan *message.Message, 0)
+
+	select {
+	case partitions <- PartitionMessages{Topic: topic, Partition: partition, Messages: output}:
+		return output, true
+	case <-closing:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
 type messageHandler struct {
 	outputChannel chan<- *message.Message
 	unmarshaler   Unmarshaler
+	keyFilter     func(key []byte) bool
 
 	nackResendSleep time.Duration
 
+	slowMessage SlowMessageConfig
+
+	metrics consumeMetrics
+
+	topicResumed func(topic string) <-chan struct{}
+
 	logger  watermill.LoggerAdapter
 	closing chan struct{}
 }
@@ -425,6 +937,15 @@ func (h messageHandler) processMessage(
 	})
 
 	h.logger.Trace("Received message from Kafka", receivedMsgLogFields)
+	h.metrics.received(kafkaMsg)
+
+	if h.keyFilter != nil && !h.keyFilter(kafkaMsg.Key) {
+		if sess != nil {
+			sess.MarkMessage(kafkaMsg, "")
+		}
+		h.logger.Trace("Message skipped by KeyFilter", receivedMsgLogFields)
+		return nil
+	}
 
 	msg, err := h.unmarshaler.Unmarshal(kafkaMsg)
 	if err != nil {
@@ -432,51 +953,141 @@ func (h messageHandler) processMessage(
 		return errors.Wrap(err, "message unmarshal failed")
 	}
 
-	ctx, cancelCtx := context.WithCancel(ctx)
-	msg.SetContext(ctx)
+	msgCtx, cancelCtx := context.WithCancel(ctx)
+	msg.SetContext(msgCtx)
 	defer cancelCtx()
 
 	receivedMsgLogFields = receivedMsgLogFields.Add(watermill.LogFields{
 		"message_uuid": msg.UUID,
 	})
 
+	// when the consumer group rebalances, the session is done and the message must be released without marking,
+	// so it's consumed by the new owner of the partition
+	var sessionDone <-chan struct{}
+	if sess != nil {
+		sessionDone = sess.Context().Done()
+	}
+
 ResendLoop:
 	for {
+		select {
+		case <-h.topicResumed(kafkaMsg.Topic):
+			// topic is not paused
+		case <-sessionDone:
+			h.logger.Trace("Session done while topic paused, message discarded", receivedMsgLogFields)
+			return nil
+		case <-ctx.Done():
+			h.logger.Trace("Subscription closed while topic paused, message discarded", receivedMsgLogFields)
+			return nil
+		case <-h.closing:
+			h.logger.Trace("Closing, message discarded", receivedMsgLogFields)
+			return nil
+		}
+
 		select {
 		case h.outputChannel <- msg:
 			h.logger.Trace("Message sent to consumer", receivedMsgLogFields)
+		case <-sessionDone:
+			h.logger.Trace("Session done, message discarded", receivedMsgLogFields)
+			return nil
 		case <-h.closing:
 			h.logger.Trace("Closing, message discarded", receivedMsgLogFields)
 			return nil
 		}
+		processingStarted := time.Now()
 
-		select {
-		case <-msg.Acked():
+		result, slow := h.waitForAck(msg, kafkaMsg, receivedMsgLogFields)
+		switch result {
+		case ackResultAcked:
 			if sess != nil {
 				sess.MarkMessage(kafkaMsg, "")
 			}
 			h.logger.Trace("Message Acked", receivedMsgLogFields)
-			break ResendLoop
-		case <-msg.Nacked():
+			h.metrics.processed(kafkaMsg, time.Since(processingStarted), "acked")
+		case ackResultSkipped:
+			if sess != nil {
+				sess.MarkMessage(kafkaMsg, "")
+			}
+			h.logger.Trace("Slow message skipped", receivedMsgLogFields)
+			h.metrics.processed(kafkaMsg, time.Since(processingStarted), "skipped")
+			// the handler may still process the skipped message, it shouldn't wait for the pause
+			cancelCtx()
+		case ackResultNacked:
 			h.logger.Trace("Message Nacked", receivedMsgLogFields)
+			h.metrics.processed(kafkaMsg, time.Since(processingStarted), "nacked")
 
 			// reset acks, etc.
 			msg = msg.Copy()
 			if h.nackResendSleep != NoSleep {
 				time.Sleep(h.nackResendSleep)
 			}
-
-			continue ResendLoop
-		case <-h.closing:
+		case ackResultClosing:
 			h.logger.Trace("Closing, message discarded before ack", receivedMsgLogFields)
 			return nil
 		}
+
+		if slow && h.slowMessage.PauseDuration > 0 && !h.pausePartition(ctx, sessionDone, receivedMsgLogFields) {
+			h.logger.Trace("Session done or closing while partition paused", receivedMsgLogFields)
+			return nil
+		}
+
+		if result != ackResultNacked {
+			break ResendLoop
+		}
 	}
 
 	return nil
 }
 
+type ackResult int
+
+const (
+	ackResultAcked ackResult = iota
+	ackResultNacked
+	ackResultSkipped
+	ackResultClosing
+)
+
+// waitForAck waits until the message is acked or nacked, taking SlowMessageConfig into account.
+// slow is true, when the message exceeded SlowMessageConfig.MaxProcessingTime.
+func (h messageHandler) waitForAck(
+	msg *message.Message,
+	kafkaMsg *sarama.ConsumerMessage,
+	logFields watermill.LogFields,
+) (result ackResult, slow bool) {
+	processingStarted := time.Now()
+
+	var processingTimeout <-chan time.Time
+	if h.slowMessage.MaxProcessingTime > 0 {
+		timer := time.NewTimer(h.slowMessage.MaxProcessingTime)
+		defer timer.Stop()
+		processingTimeout = timer.C
+	}
+
+	for {
+		select {
+		case <-msg.Acked():
+			return ackResultAcked, slow
+		case <-msg.Nacked():
+			return ackResultNacked, slow
+		case <-processingTimeout:
+			// the slow message is handled only once
+			processingTimeout = nil
+			slow = true
+			if h.handleSlowMessage(msg, kafkaMsg, time.Since(processingStarted), logFields) {
+				return ackResultSkipped, slow
+			}
+		case <-h.closing:
+			return ackResultClosing, slow
+		}
+	}
+}
+
+// SubscribeInitialize creates the topic with SubscriberConfig.InitializeTopicDetails.
+// The topic is mapped with SubscriberConfig.TopicMapper, like in Subscribe.
 func (s *Subscriber) SubscribeInitialize(topic string) (err error) {
+	topic = s.config.TopicMapper.kafkaTopic(topic)
+
 	clusterAdmin, err := sarama.NewClusterAdmin(s.config.Brokers, s.saramaConfig)
 	if err != nil {
 		return errors.Wrap(err, "cannot create cluster admin")
@@ -487,7 +1098,18 @@ func (s *Subscriber) SubscribeInitialize(topic string) (err error) {
 		}
 	}()
 
-	if err := clusterAdmin.CreateTopic(topic, s.config.InitializeTopicDetails, false); err != nil {
+	err = backoff.Retry(context.Background(), s.config.InitializeTopicBackoff, func() error {
+		err := clusterAdmin.CreateTopic(topic, s.config.InitializeTopicDetails, false)
+		if err == sarama.ErrTopicAlreadyExists {
+			s.logger.Debug("Kafka topic already exists", watermill.LogFields{"topic": topic})
+			return nil
+		}
+		if err != nil {
+			s.logger.Info("Cannot create Kafka topic", watermill.LogFields{"topic": topic, "err": err.Error()})
+		}
+		return err
+	})
+	if err != nil {
 		return errors.Wrap(err, "cannot create topic")
 	}
 
@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+func TestNewSubscriber_ConsumerInterceptors(t *testing.T) {
+	var intercepted []string
+
+	sub, err := NewSubscriber(
+		SubscriberConfig{
+			Brokers: []string{"localhost:9092"},
+			ConsumerInterceptors: []ConsumerInterceptor{
+				ConsumerInterceptorFunc(func(msg *sarama.ConsumerMessage) error {
+					intercepted = append(intercepted, "first")
+					msg.Value = []byte("decrypted")
+					return nil
+				}),
+				ConsumerInterceptorFunc(func(msg *sarama.ConsumerMessage) error {
+					intercepted = append(intercepted, "second")
+					return nil
+				}),
+			},
+		},
+		nil,
+		DefaultMarshaler{},
+		watermill.NopLogger{},
+	)
+	require.NoError(t, err)
+
+	kafkaMsg := &sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{{Key: []byte(UUIDHeaderKey), Value: []byte(watermill.NewUUID())}},
+		Value:   []byte("encrypted"),
+	}
+	msg, err := sub.(*Subscriber).unmarshaler.Unmarshal(kafkaMsg)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"first", "second"}, intercepted)
+	assert.Equal(t, "decrypted", string(msg.Payload))
+}
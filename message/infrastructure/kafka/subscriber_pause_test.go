@@ -0,0 +1,252 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// fakeConsumerGroupSession implements only the methods of sarama.ConsumerGroupSession used by messageHandler.
+type fakeConsumerGroupSession struct {
+	sarama.ConsumerGroupSession
+
+	ctx context.Context
+
+	lock   sync.Mutex
+	marked []int64
+}
+
+func (s *fakeConsumerGroupSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeConsumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeConsumerGroupSession) markedOffsets() []int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]int64(nil), s.marked...)
+}
+
+func newPauseTestSubscriber(t *testing.T) *Subscriber {
+	sub, err := NewSubscriber(
+		SubscriberConfig{Brokers: []string{"localhost:9092"}, ConsumerGroup: "test"},
+		nil,
+		DefaultMarshaler{},
+		watermill.NopLogger{},
+	)
+	require.NoError(t, err)
+
+	return sub.(*Subscriber)
+}
+
+func processMessageAsync(
+	h messageHandler,
+	sess sarama.ConsumerGroupSession,
+	kafkaMsg *sarama.ConsumerMessage,
+) <-chan error {
+	processed := make(chan error, 1)
+	go func() {
+		processed <- h.processMessage(context.Background(), kafkaMsg, sess, watermill.LogFields{})
+	}()
+
+	return processed
+}
+
+func TestSubscriber_Pause_Resume(t *testing.T) {
+	sub := newPauseTestSubscriber(t)
+	defer sub.Close()
+
+	output := make(chan *message.Message)
+	h := sub.createMessagesHandler(output)
+	sess := &fakeConsumerGroupSession{ctx: context.Background()}
+
+	sub.Pause("topic")
+	sub.Pause("topic")
+
+	processed := processMessageAsync(h, sess, &sarama.ConsumerMessage{Topic: "topic", Offset: 1})
+
+	select {
+	case <-output:
+		t.Fatal("message of the paused topic should be not sent")
+	case <-time.After(time.Millisecond * 100):
+		// ok
+	}
+
+	sub.Resume("topic")
+	sub.Resume("topic")
+
+	select {
+	case msg := <-output:
+		msg.Ack()
+	case <-time.After(time.Second):
+		t.Fatal("message not sent after resume")
+	}
+
+	require.NoError(t, <-processed)
+	assert.Equal(t, []int64{1}, sess.markedOffsets())
+}
+
+func TestSubscriber_Pause_other_topic(t *testing.T) {
+	sub := newPauseTestSubscriber(t)
+	defer sub.Close()
+
+	output := make(chan *message.Message)
+	h := sub.createMessagesHandler(output)
+	sess := &fakeConsumerGroupSession{ctx: context.Background()}
+
+	sub.Pause("paused_topic")
+
+	processed := processMessageAsync(h, sess, &sarama.ConsumerMessage{Topic: "topic", Offset: 1})
+
+	select {
+	case msg := <-output:
+		msg.Ack()
+	case <-time.After(time.Second):
+		t.Fatal("message of not paused topic should be sent")
+	}
+
+	require.NoError(t, <-processed)
+}
+
+func TestSubscriber_Pause_session_done(t *testing.T) {
+	sub := newPauseTestSubscriber(t)
+	defer sub.Close()
+
+	output := make(chan *message.Message)
+	h := sub.createMessagesHandler(output)
+
+	sessCtx, endSession := context.WithCancel(context.Background())
+	sess := &fakeConsumerGroupSession{ctx: sessCtx}
+
+	sub.Pause("topic")
+	processed := processMessageAsync(h, sess, &sarama.ConsumerMessage{Topic: "topic", Offset: 1})
+
+	// rebalance ends the session
+	endSession()
+
+	select {
+	case err := <-processed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("paused message should be released when the session is done")
+	}
+
+	assert.Empty(t, sess.markedOffsets(), "released message should be not marked")
+}
+
+func TestSubscriber_Pause_closing(t *testing.T) {
+	sub := newPauseTestSubscriber(t)
+
+	output := make(chan *message.Message)
+	h := sub.createMessagesHandler(output)
+	sess := &fakeConsumerGroupSession{ctx: context.Background()}
+
+	sub.Pause("topic")
+	processed := processMessageAsync(h, sess, &sarama.ConsumerMessage{Topic: "topic", Offset: 1})
+
+	require.NoError(t, sub.Close())
+
+	select {
+	case err := <-processed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("paused message should be released when the subscriber is closed")
+	}
+}
+
+func TestSubscriber_slow_message_pauses_partition(t *testing.T) {
+	sub := newPauseTestSubscriber(t)
+	defer sub.Close()
+
+	sub.config.SlowMessage = SlowMessageConfig{
+		MaxProcessingTime: time.Millisecond * 50,
+		Action:            SlowMessageSkip,
+		PauseDuration:     time.Millisecond * 300,
+	}
+
+	output := make(chan *message.Message)
+	h := sub.createMessagesHandler(output)
+	sess := &fakeConsumerGroupSession{ctx: context.Background()}
+
+	start := time.Now()
+	processed := processMessageAsync(h, sess, &sarama.ConsumerMessage{Topic: "topic", Offset: 1})
+
+	var slowMsg *message.Message
+	select {
+	case slowMsg = <-output:
+		// not acked
+	case <-time.After(time.Second):
+		t.Fatal("message not sent")
+	}
+
+	select {
+	case <-slowMsg.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("context of the skipped message should be canceled")
+	}
+	assert.Equal(t, []int64{1}, sess.markedOffsets(), "skipped message should be marked before the pause")
+
+	select {
+	case err := <-processed:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 2):
+		t.Fatal("partition should be resumed after the pause")
+	}
+	assert.True(t, time.Since(start) >= time.Millisecond*350, "partition should be paused after the slow message")
+}
+
+func TestSubscriber_slow_message_pause_session_done(t *testing.T) {
+	sub := newPauseTestSubscriber(t)
+	defer sub.Close()
+
+	sub.config.SlowMessage = SlowMessageConfig{
+		MaxProcessingTime: time.Millisecond * 10,
+		PauseDuration:     time.Hour,
+	}
+
+	output := make(chan *message.Message)
+	h := sub.createMessagesHandler(output)
+
+	sessCtx, endSession := context.WithCancel(context.Background())
+	sess := &fakeConsumerGroupSession{ctx: sessCtx}
+
+	processed := processMessageAsync(h, sess, &sarama.ConsumerMessage{Topic: "topic", Offset: 1})
+
+	select {
+	case msg := <-output:
+		// acked after exceeding MaxProcessingTime
+		time.Sleep(time.Millisecond * 50)
+		msg.Ack()
+	case <-time.After(time.Second):
+		t.Fatal("message not sent")
+	}
+
+	assert.Eventually(t, func() bool {
+		return len(sess.markedOffsets()) == 1
+	}, time.Second, time.Millisecond*10)
+
+	// rebalance ends the session
+	endSession()
+
+	select {
+	case err := <-processed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("pause should end when the session is done")
+	}
+}
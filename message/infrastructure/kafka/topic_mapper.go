@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// TopicMapper maps the topic used by the application to the name of the Kafka topic.
+//
+// It allows to keep the environment naming (like the "staging." prefix or the tenant suffix) out of the application code.
+// The Publisher and the Subscriber apply it to every topic they receive, so the application uses the same topic names
+// in all environments.
+type TopicMapper func(topic string) string
+
+// TopicPrefix returns TopicMapper adding the prefix to topics.
+func TopicPrefix(prefix string) TopicMapper {
+	return func(topic string) string {
+		return prefix + topic
+	}
+}
+
+// TopicSuffix returns TopicMapper adding the suffix to topics.
+func TopicSuffix(suffix string) TopicMapper {
+	return func(topic string) string {
+		return topic + suffix
+	}
+}
+
+// TopicRegexpRewrite returns TopicMapper replacing matches of the pattern with the replacement.
+// The replacement can refer to submatches, like in regexp.Regexp.ReplaceAllString.
+// Topics not matching the pattern are not changed.
+func TopicRegexpRewrite(pattern string, replacement string) (TopicMapper, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid topic pattern %s", pattern)
+	}
+
+	return func(topic string) string {
+		return re.ReplaceAllString(topic, replacement)
+	}, nil
+}
+
+// ChainTopicMappers returns TopicMapper applying the mappers in order.
+func ChainTopicMappers(mappers ...TopicMapper) TopicMapper {
+	return func(topic string) string {
+		for _, mapper := range mappers {
+			topic = mapper(topic)
+		}
+		return topic
+	}
+}
+
+// kafkaTopic returns the name of the Kafka topic, it's safe to call with nil mapper.
+func (m TopicMapper) kafkaTopic(topic string) string {
+	if m == nil {
+		return topic
+	}
+
+	return m(topic)
+}
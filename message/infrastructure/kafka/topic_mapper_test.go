@@ -0,0 +1,64 @@
+package kafka_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/kafka"
+)
+
+func TestTopicMappers(t *testing.T) {
+	tenantRewrite, err := kafka.TopicRegexpRewrite(`^tenant_(\w+)\.(.+)$`, "${2}.${1}")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name          string
+		Mapper        kafka.TopicMapper
+		Topic         string
+		ExpectedTopic string
+	}{
+		{
+			Name:          "prefix",
+			Mapper:        kafka.TopicPrefix("staging."),
+			Topic:         "orders",
+			ExpectedTopic: "staging.orders",
+		},
+		{
+			Name:          "suffix",
+			Mapper:        kafka.TopicSuffix(".tenant_1"),
+			Topic:         "orders",
+			ExpectedTopic: "orders.tenant_1",
+		},
+		{
+			Name:          "regexp_rewrite",
+			Mapper:        tenantRewrite,
+			Topic:         "tenant_1.orders",
+			ExpectedTopic: "orders.1",
+		},
+		{
+			Name:          "regexp_rewrite_not_matching",
+			Mapper:        tenantRewrite,
+			Topic:         "orders",
+			ExpectedTopic: "orders",
+		},
+		{
+			Name:          "chain",
+			Mapper:        kafka.ChainTopicMappers(kafka.TopicPrefix("staging."), kafka.TopicSuffix(".v2")),
+			Topic:         "orders",
+			ExpectedTopic: "staging.orders.v2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.ExpectedTopic, tc.Mapper(tc.Topic))
+		})
+	}
+}
+
+func TestTopicRegexpRewrite_invalid_pattern(t *testing.T) {
+	_, err := kafka.TopicRegexpRewrite("(", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,273 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// ErrTopicDoesNotExist is returned by the Publisher with AllowAutoTopicCreation disabled,
+// when the topic doesn't exist and there are no details to create it.
+var ErrTopicDoesNotExist = errors.New("topic does not exist")
+
+type PublisherConfig struct {
+	Brokers []string
+
+	Marshaler Marshaler
+
+	// ProducerInterceptors are called in order with every record marshaled by Marshaler, before it's sent.
+	// They can modify the raw Sarama record, for example to inject headers or scrub the value.
+	// See InterceptingMarshaler.
+	ProducerInterceptors []ProducerInterceptor
+
+	// OverwriteSaramaConfig defaults to DefaultSaramaSyncPublisherConfig().
+	OverwriteSaramaConfig *sarama.Config
+
+	// MetadataRefreshFrequency overrides Metadata.RefreshFrequency of the Sarama config, when not 0.
+	// It is how often the producer refreshes the metadata of the cluster in the background,
+	// for example to find out about new partitions.
+	MetadataRefreshFrequency time.Duration
+
+	// AllowAutoTopicCreation allows the broker to create missing topics on publish,
+	// when `auto.create.topics.enable` is enabled on the broker.
+	//
+	// When false, the Publisher checks that the topic exists before the first publish to it,
+	// without triggering the auto-creation. Missing topics are created with details from Topics
+	// or DefaultTopicDetails. When there are no details for the topic, ErrTopicDoesNotExist is returned.
+	// It requires Version >= V1_0_0_0 in the Sarama config.
+	AllowAutoTopicCreation bool
+
+	// Topics contains details of topics created by the Publisher, when AllowAutoTopicCreation is false.
+	Topics map[string]*sarama.TopicDetail
+
+	// DefaultTopicDetails are used to create topics not present in Topics, when AllowAutoTopicCreation is false.
+	DefaultTopicDetails *sarama.TopicDetail
+
+	// TopicMapper is optional and maps topics passed to the Publisher to names of Kafka topics.
+	// Keys of Topics are topics before the mapping.
+	TopicMapper TopicMapper
+
+	// ClientPool is optional. When set, the Publisher uses the client shared by the pool, instead of creating its own.
+	// Brokers and the Sarama config default to the ones of the pool and they cannot be overwritten.
+	ClientPool *ClientPool
+}
+
+func (c *PublisherConfig) setDefaults() {
+	if c.ClientPool != nil {
+		if len(c.Brokers) == 0 {
+			c.Brokers = c.ClientPool.brokers
+		}
+		if c.OverwriteSaramaConfig == nil {
+			c.OverwriteSaramaConfig = c.ClientPool.saramaConfig
+		}
+	}
+	if c.OverwriteSaramaConfig == nil {
+		c.OverwriteSaramaConfig = DefaultSaramaSyncPublisherConfig()
+	}
+}
+
+func (c PublisherConfig) Validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("missing Brokers")
+	}
+	if c.Marshaler == nil {
+		return errors.New("missing Marshaler")
+	}
+	if c.MetadataRefreshFrequency < 0 {
+		return errors.New("MetadataRefreshFrequency cannot be negative")
+	}
+	if c.ClientPool != nil {
+		overwritten := c.OverwriteSaramaConfig != nil && c.OverwriteSaramaConfig != c.ClientPool.saramaConfig
+		if overwritten || c.MetadataRefreshFrequency != 0 {
+			return errors.New("OverwriteSaramaConfig and MetadataRefreshFrequency cannot be used together with ClientPool")
+		}
+		if !c.ClientPool.saramaConfig.Producer.Return.Successes {
+			return errors.New("Sarama config of ClientPool must have Producer.Return.Successes enabled")
+		}
+	}
+	if !c.AllowAutoTopicCreation && c.OverwriteSaramaConfig != nil &&
+		!c.OverwriteSaramaConfig.Version.IsAtLeast(sarama.V1_0_0_0) {
+		return errors.New("disabling AllowAutoTopicCreation requires Version >= V1_0_0_0")
+	}
+
+	return nil
+}
+
+func (c PublisherConfig) topicDetails(topic string) *sarama.TopicDetail {
+	if details, ok := c.Topics[topic]; ok {
+		return details
+	}
+
+	return c.DefaultTopicDetails
+}
+
+// NewPublisherWithConfig creates a new Kafka Publisher, with control over the creation of topics.
+func NewPublisherWithConfig(config PublisherConfig, logger watermill.LoggerAdapter) (*Publisher, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Kafka publisher config")
+	}
+
+	saramaConfig := config.OverwriteSaramaConfig
+	if config.MetadataRefreshFrequency != 0 {
+		overwritten := *saramaConfig
+		overwritten.Metadata.RefreshFrequency = config.MetadataRefreshFrequency
+		saramaConfig = &overwritten
+	}
+
+	producer, err := newSyncProducer(config, saramaConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create Kafka producer")
+	}
+
+	return &Publisher{
+		producer:     producer,
+		marshaler:    interceptedMarshaler(config.Marshaler, config.ProducerInterceptors),
+		saramaConfig: saramaConfig,
+		config:       config,
+		knownTopics:  map[string]struct{}{},
+		logger:       logger,
+	}, nil
+}
+
+// newSyncProducer creates the producer with the client from the pool, when it's set.
+func newSyncProducer(config PublisherConfig, saramaConfig *sarama.Config) (sarama.SyncProducer, error) {
+	if config.ClientPool == nil {
+		return sarama.NewSyncProducer(config.Brokers, saramaConfig)
+	}
+
+	client, err := config.ClientPool.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		if releaseErr := config.ClientPool.release(); releaseErr != nil {
+			err = multierror.Append(err, releaseErr)
+		}
+		return nil, err
+	}
+
+	return producer, nil
+}
+
+// EnsureTopic creates the topic with the details, when it doesn't exist.
+// It allows to provision topics in tests and deployments.
+//
+// The topic is mapped with PublisherConfig.TopicMapper, like in Publish.
+func (p *Publisher) EnsureTopic(topic string, details *sarama.TopicDetail) (err error) {
+	topic = p.config.TopicMapper.kafkaTopic(topic)
+
+	clusterAdmin, err := sarama.NewClusterAdmin(p.config.Brokers, p.saramaConfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot create cluster admin")
+	}
+	defer func() {
+		if closeErr := clusterAdmin.Close(); closeErr != nil {
+			err = multierror.Append(err, closeErr)
+		}
+	}()
+
+	err = clusterAdmin.CreateTopic(topic, details, false)
+	if err == sarama.ErrTopicAlreadyExists {
+		p.logger.Debug("Kafka topic already exists", watermill.LogFields{"topic": topic})
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "cannot create topic %s", topic)
+	}
+
+	p.logger.Info("Created Kafka topic", watermill.LogFields{
+		"topic":              topic,
+		"num_partitions":     details.NumPartitions,
+		"replication_factor": details.ReplicationFactor,
+	})
+
+	return nil
+}
+
+// ensureTopicBeforePublish checks that the topic exists, when AllowAutoTopicCreation is disabled.
+func (p *Publisher) ensureTopicBeforePublish(topic string) error {
+	if p.config.AllowAutoTopicCreation {
+		return nil
+	}
+
+	p.knownTopicsLock.RLock()
+	_, known := p.knownTopics[topic]
+	p.knownTopicsLock.RUnlock()
+	if known {
+		return nil
+	}
+
+	exists, err := p.topicExists(p.config.TopicMapper.kafkaTopic(topic))
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		details := p.config.topicDetails(topic)
+		if details == nil {
+			return errors.Wrap(ErrTopicDoesNotExist, topic)
+		}
+
+		if err := p.EnsureTopic(topic, details); err != nil {
+			return err
+		}
+	}
+
+	p.knownTopicsLock.Lock()
+	p.knownTopics[topic] = struct{}{}
+	p.knownTopicsLock.Unlock()
+
+	return nil
+}
+
+// topicExists checks if the topic exists with the metadata request, which doesn't trigger
+// the auto-creation of the topic by the broker.
+func (p *Publisher) topicExists(topic string) (exists bool, err error) {
+	client, err := sarama.NewClient(p.config.Brokers, p.saramaConfig)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot create Kafka client")
+	}
+	defer func() {
+		if closeErr := client.Close(); closeErr != nil {
+			err = multierror.Append(err, closeErr)
+		}
+	}()
+
+	broker, err := client.Controller()
+	if err != nil {
+		return false, errors.Wrap(err, "cannot get Kafka controller")
+	}
+
+	response, err := broker.GetMetadata(&sarama.MetadataRequest{
+		Version:                4,
+		Topics:                 []string{topic},
+		AllowAutoTopicCreation: false,
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot get metadata of topic %s", topic)
+	}
+
+	for _, topicMetadata := range response.Topics {
+		if topicMetadata.Name != topic {
+			continue
+		}
+
+		switch topicMetadata.Err {
+		case sarama.ErrNoError:
+			return true, nil
+		case sarama.ErrUnknownTopicOrPartition:
+			return false, nil
+		default:
+			return false, errors.Wrapf(topicMetadata.Err, "cannot get metadata of topic %s", topic)
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,57 @@
+package nats_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/nats"
+)
+
+func TestStreamingPublisherConfig_Validate_security(t *testing.T) {
+	config := nats.StreamingPublisherConfig{
+		Marshaler: nats.GobMarshaler{},
+	}
+	assert.NoError(t, config.Validate())
+
+	config.Token = "token"
+	assert.NoError(t, config.Validate())
+
+	config.NkeySeedFile = "seed.nk"
+	assert.Error(t, config.Validate(), "Token and NkeySeedFile cannot be used together")
+
+	config.Token = ""
+	assert.Error(t, config.Validate(), "NkeySeedFile doesn't exist")
+}
+
+func TestStreamingSubscriberConfig_Validate_security(t *testing.T) {
+	config := nats.StreamingSubscriberConfig{
+		Unmarshaler:     nats.GobMarshaler{},
+		CredentialsFile: "user.creds",
+		NkeySeedFile:    "seed.nk",
+	}
+	assert.Error(t, config.Validate(), "CredentialsFile and NkeySeedFile cannot be used together")
+}
+
+func TestStreamingPublisherConfig_Validate_connection_pool(t *testing.T) {
+	pool, err := nats.NewConnectionPool(nats.ConnectionPoolConfig{
+		ClusterID: "test-cluster",
+		ClientID:  "shared_pub",
+	})
+	require.NoError(t, err)
+
+	config := nats.StreamingPublisherConfig{
+		Marshaler:      nats.GobMarshaler{},
+		ConnectionPool: pool,
+	}
+	assert.NoError(t, config.Validate())
+
+	config.ClientID = "pub"
+	assert.Error(t, config.Validate(), "connection settings cannot be used together with ConnectionPool")
+}
+
+func TestNewConnectionPool_missing_client_id(t *testing.T) {
+	_, err := nats.NewConnectionPool(nats.ConnectionPoolConfig{ClusterID: "test-cluster"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package nats
+
+import (
+	"crypto/tls"
+	"os"
+
+	nats "github.com/nats-io/go-nats"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/pkg/errors"
+)
+
+// connectionSecurity contains the TLS and authentication settings of the NATS connection.
+type connectionSecurity struct {
+	TLSConfig       *tls.Config
+	CredentialsFile string
+	NkeySeedFile    string
+	Token           string
+}
+
+func (c connectionSecurity) enabled() bool {
+	return c.TLSConfig != nil || c.CredentialsFile != "" || c.NkeySeedFile != "" || c.Token != ""
+}
+
+func (c connectionSecurity) validate(stanOptions []stan.Option) error {
+	if !c.enabled() {
+		return nil
+	}
+
+	if c.CredentialsFile != "" && c.NkeySeedFile != "" {
+		return errors.New("CredentialsFile and NkeySeedFile cannot be used together")
+	}
+	if c.Token != "" && (c.CredentialsFile != "" || c.NkeySeedFile != "") {
+		return errors.New("Token cannot be used together with CredentialsFile or NkeySeedFile")
+	}
+
+	if c.CredentialsFile != "" {
+		if _, err := os.Stat(c.CredentialsFile); err != nil {
+			return errors.Wrap(err, "invalid CredentialsFile")
+		}
+	}
+	if c.NkeySeedFile != "" {
+		if _, err := os.Stat(c.NkeySeedFile); err != nil {
+			return errors.Wrap(err, "invalid NkeySeedFile")
+		}
+	}
+
+	if stanOptionsFromList(stanOptions).NatsConn != nil {
+		return errors.New(
+			"TLS and authentication settings cannot be used together with stan.NatsConn option, " +
+				"configure them on your NATS connection instead",
+		)
+	}
+
+	return nil
+}
+
+func (c connectionSecurity) natsOptions() ([]nats.Option, error) {
+	var options []nats.Option
+
+	if c.TLSConfig != nil {
+		options = append(options, nats.Secure(c.TLSConfig))
+	}
+	if c.CredentialsFile != "" {
+		options = append(options, nats.UserCredentials(c.CredentialsFile))
+	}
+	if c.NkeySeedFile != "" {
+		nkeyOption, err := nats.NkeyOptionFromSeed(c.NkeySeedFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read NkeySeedFile")
+		}
+		options = append(options, nkeyOption)
+	}
+	if c.Token != "" {
+		options = append(options, nats.Token(c.Token))
+	}
+
+	return options, nil
+}
+
+func stanOptionsFromList(stanOptions []stan.Option) stan.Options {
+	options := stan.DefaultOptions
+	for _, option := range stanOptions {
+		_ = option(&options)
+	}
+
+	return options
+}
+
+// connect connects to NATS Streaming.
+//
+// When TLS or authentication is configured, the underlying NATS connection is created by Watermill
+// and it is returned, so it can be closed together with the NATS Streaming connection.
+func connect(
+	clusterID string,
+	clientID string,
+	stanOptions []stan.Option,
+	security connectionSecurity,
+) (stan.Conn, *nats.Conn, error) {
+	if !security.enabled() {
+		conn, err := stan.Connect(clusterID, clientID, stanOptions...)
+		return conn, nil, err
+	}
+
+	natsOptions, err := security.natsOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	natsConn, err := nats.Connect(stanOptionsFromList(stanOptions).NatsURL, natsOptions...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot connect to NATS")
+	}
+
+	conn, err := stan.Connect(
+		clusterID,
+		clientID,
+		append(stanOptions, stan.NatsConn(natsConn))...,
+	)
+	if err != nil {
+		natsConn.Close()
+		return nil, nil, err
+	}
+
+	return conn, natsConn, nil
+}
@@ -0,0 +1,122 @@
+package nats
+
+import (
+	"crypto/tls"
+
+	nats "github.com/nats-io/go-nats"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/pkg/errors"
+
+	internalSync "github.com/ThreeDotsLabs/watermill/internal/sync"
+)
+
+type ConnectionPoolConfig struct {
+	// ClusterID is the NATS Streaming cluster ID.
+	ClusterID string
+
+	// ClientID is the NATS Streaming client ID of the shared connection.
+	// ClientID can contain only alphanumeric and `-` or `_` characters.
+	ClientID string
+
+	// StanOptions are custom options for a connection.
+	StanOptions []stan.Option
+
+	// TLSConfig enables TLS for the connection to NATS.
+	TLSConfig *tls.Config
+
+	// CredentialsFile is the path to the user credentials file, containing the user JWT and nkey seed.
+	// It cannot be used together with NkeySeedFile or Token.
+	CredentialsFile string
+
+	// NkeySeedFile is the path to the file with the nkey seed, used for nkey authentication.
+	// It cannot be used together with CredentialsFile or Token.
+	NkeySeedFile string
+
+	// Token is the token used for token authentication.
+	Token string
+}
+
+func (c ConnectionPoolConfig) Validate() error {
+	if c.ClientID == "" {
+		return errors.New("ConnectionPoolConfig.ClientID is missing")
+	}
+
+	if err := c.security().validate(c.StanOptions); err != nil {
+		return errors.Wrap(err, "invalid ConnectionPoolConfig security settings")
+	}
+
+	return nil
+}
+
+func (c ConnectionPoolConfig) security() connectionSecurity {
+	return connectionSecurity{
+		TLSConfig:       c.TLSConfig,
+		CredentialsFile: c.CredentialsFile,
+		NkeySeedFile:    c.NkeySeedFile,
+		Token:           c.Token,
+	}
+}
+
+// ConnectionPool shares a single NATS Streaming connection between StreamingPublishers of the process,
+// so the number of connections doesn't grow with the number of publishers.
+//
+// The connection is created, when the first StreamingPublisher is created with the pool,
+// and it's closed, when all of them are closed.
+//
+// StreamingSubscribers always use their own connections, because they reconnect on their own,
+// when the connection is lost.
+type ConnectionPool struct {
+	conn *internalSync.RefCounted
+}
+
+// pooledConnection is the connection shared by ConnectionPool.
+type pooledConnection struct {
+	conn     stan.Conn
+	natsConn *nats.Conn
+}
+
+// NewConnectionPool creates a new ConnectionPool.
+func NewConnectionPool(config ConnectionPoolConfig) (*ConnectionPool, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &ConnectionPool{
+		conn: internalSync.NewRefCounted(
+			func() (interface{}, error) {
+				conn, natsConn, err := connect(config.ClusterID, config.ClientID, config.StanOptions, config.security())
+				if err != nil {
+					return nil, err
+				}
+				return pooledConnection{conn: conn, natsConn: natsConn}, nil
+			},
+			func(conn interface{}) error {
+				return conn.(pooledConnection).close()
+			},
+		),
+	}, nil
+}
+
+func (p *ConnectionPool) acquire() (pooledConnection, error) {
+	conn, err := p.conn.Acquire()
+	if err != nil {
+		return pooledConnection{}, errors.Wrap(err, "cannot create shared NATS Streaming connection")
+	}
+
+	return conn.(pooledConnection), nil
+}
+
+func (p *ConnectionPool) release() error {
+	return p.conn.Release()
+}
+
+func (c pooledConnection) close() error {
+	if err := c.conn.Close(); err != nil {
+		return errors.Wrap(err, "closing NATS conn failed")
+	}
+	if c.natsConn != nil {
+		c.natsConn.Close()
+	}
+
+	return nil
+}
@@ -3,10 +3,14 @@ package nats
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strconv"
 
 	"github.com/pkg/errors"
 
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/cloudevents"
 	"github.com/nats-io/go-nats-streaming"
 )
 
@@ -60,3 +64,83 @@ func (GobMarshaler) Unmarshal(stanMsg *stan.Msg) (*message.Message, error) {
 
 	return msg, nil
 }
+
+// EnvelopeMarshaler marshals messages to versioned envelopes (message.EnvelopeCodec).
+// NATS Streaming messages have no headers, so the UUID and the metadata are stored in the envelope,
+// next to the payload.
+//
+// Unlike GobMarshaler, the envelope is plain JSON, so it can be produced and consumed by non-Go services.
+type EnvelopeMarshaler struct {
+	Codec message.EnvelopeCodec
+
+	// AcceptPlainMessages enables the interop mode: messages which are not envelopes
+	// (for example published by services not using Watermill) are unmarshaled with the whole data
+	// as the payload, instead of failing.
+	//
+	// The UUID of such messages is returned by PlainMessageUUID.
+	AcceptPlainMessages bool
+
+	// PlainMessageUUID returns the UUID of the message which is not an envelope.
+	// Defaults to DefaultPlainMessageUUID.
+	PlainMessageUUID func(stanMsg *stan.Msg) string
+}
+
+// DefaultPlainMessageUUID returns the UUID built from the channel and the sequence number of the message,
+// so it is the same when the message is redelivered.
+func DefaultPlainMessageUUID(stanMsg *stan.Msg) string {
+	return fmt.Sprintf("%s-%d", stanMsg.Subject, stanMsg.Sequence)
+}
+
+// PlainMessageSequenceKey is the metadata key with the sequence number of the message,
+// set on messages which are not envelopes, when AcceptPlainMessages is enabled.
+const PlainMessageSequenceKey = "nats_sequence"
+
+func (m EnvelopeMarshaler) Marshal(topic string, msg *message.Message) ([]byte, error) {
+	return m.Codec.Marshal(msg)
+}
+
+func (m EnvelopeMarshaler) Unmarshal(stanMsg *stan.Msg) (*message.Message, error) {
+	if m.AcceptPlainMessages && !isEnvelope(stanMsg.Data) {
+		return m.unmarshalPlainMessage(stanMsg), nil
+	}
+
+	return m.Codec.Unmarshal(stanMsg.Data)
+}
+
+func (m EnvelopeMarshaler) unmarshalPlainMessage(stanMsg *stan.Msg) *message.Message {
+	plainMessageUUID := m.PlainMessageUUID
+	if plainMessageUUID == nil {
+		plainMessageUUID = DefaultPlainMessageUUID
+	}
+
+	msg := message.NewMessage(plainMessageUUID(stanMsg), stanMsg.Data)
+	msg.Metadata.Set(PlainMessageSequenceKey, strconv.FormatUint(stanMsg.Sequence, 10))
+
+	return msg
+}
+
+// isEnvelope returns true, when the data is a JSON object with the envelope's format version.
+// Envelopes of unsupported format versions are still envelopes, so they are not consumed as plain messages.
+func isEnvelope(data []byte) bool {
+	var header struct {
+		FormatVersion int `json:"format_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return false
+	}
+
+	return header.FormatVersion != 0
+}
+
+// CloudEventsMarshaler marshals messages to CloudEvents in the structured content mode (cloudevents.Codec).
+type CloudEventsMarshaler struct {
+	Codec cloudevents.Codec
+}
+
+func (m CloudEventsMarshaler) Marshal(topic string, msg *message.Message) ([]byte, error) {
+	return m.Codec.Marshal(topic, msg)
+}
+
+func (m CloudEventsMarshaler) Unmarshal(stanMsg *stan.Msg) (*message.Message, error) {
+	return m.Codec.Unmarshal(stanMsg.Data)
+}
@@ -64,3 +64,57 @@ func TestGobMarshaler_multiple_messages_async(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestEnvelopeMarshaler(t *testing.T) {
+	msg := message.NewMessage("1", []byte("zag"))
+	msg.Metadata.Set("foo", "bar")
+
+	marshaler := nats.EnvelopeMarshaler{}
+
+	b, err := marshaler.Marshal("topic", msg)
+	require.NoError(t, err)
+
+	unmarshaledMsg, err := marshaler.Unmarshal(&stan.Msg{MsgProto: pb.MsgProto{Data: b}})
+	require.NoError(t, err)
+
+	assert.Equal(t, msg.UUID, unmarshaledMsg.UUID)
+	assert.Equal(t, msg.Payload, unmarshaledMsg.Payload)
+	assert.Equal(t, "bar", unmarshaledMsg.Metadata.Get("foo"))
+}
+
+func TestEnvelopeMarshaler_plain_messages(t *testing.T) {
+	plainMsg := &stan.Msg{MsgProto: pb.MsgProto{
+		Subject:  "topic",
+		Sequence: 42,
+		Data:     []byte(`{"name": "plain"}`),
+	}}
+
+	_, err := nats.EnvelopeMarshaler{}.Unmarshal(plainMsg)
+	assert.Error(t, err, "plain messages should be rejected without the interop mode")
+
+	marshaler := nats.EnvelopeMarshaler{AcceptPlainMessages: true}
+
+	unmarshaledMsg, err := marshaler.Unmarshal(plainMsg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "topic-42", unmarshaledMsg.UUID)
+	assert.Equal(t, plainMsg.Data, []byte(unmarshaledMsg.Payload))
+	assert.Equal(t, "42", unmarshaledMsg.Metadata.Get(nats.PlainMessageSequenceKey))
+
+	notJSONMsg := &stan.Msg{MsgProto: pb.MsgProto{Data: []byte("not json")}}
+	unmarshaledMsg, err = marshaler.Unmarshal(notJSONMsg)
+	require.NoError(t, err)
+	assert.Equal(t, notJSONMsg.Data, []byte(unmarshaledMsg.Payload))
+
+	// envelopes are still unmarshaled in the interop mode
+	msg := message.NewMessage("1", []byte("zag"))
+	msg.Metadata.Set("foo", "bar")
+
+	b, err := marshaler.Marshal("topic", msg)
+	require.NoError(t, err)
+
+	unmarshaledMsg, err = marshaler.Unmarshal(&stan.Msg{MsgProto: pb.MsgProto{Data: b}})
+	require.NoError(t, err)
+	assert.Equal(t, "1", unmarshaledMsg.UUID)
+	assert.Equal(t, "bar", unmarshaledMsg.Metadata.Get("foo"))
+}
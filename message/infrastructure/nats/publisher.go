@@ -1,8 +1,11 @@
 package nats
 
 import (
+	"crypto/tls"
+
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
+	nats "github.com/nats-io/go-nats"
 	"github.com/nats-io/go-nats-streaming"
 	"github.com/pkg/errors"
 )
@@ -18,8 +21,26 @@ type StreamingPublisherConfig struct {
 	// StanOptions are custom options for a connection.
 	StanOptions []stan.Option
 
+	// TLSConfig enables TLS for the connection to NATS.
+	TLSConfig *tls.Config
+
+	// CredentialsFile is the path to the user credentials file, containing the user JWT and nkey seed.
+	// It cannot be used together with NkeySeedFile or Token.
+	CredentialsFile string
+
+	// NkeySeedFile is the path to the file with the nkey seed, used for nkey authentication.
+	// It cannot be used together with CredentialsFile or Token.
+	NkeySeedFile string
+
+	// Token is the token used for token authentication.
+	Token string
+
 	// Marshaler is marshaler used to marshal messages to stan format.
 	Marshaler Marshaler
+
+	// ConnectionPool is optional. When set, the publisher uses the connection shared by the pool,
+	// instead of creating its own, and the connection settings of the config cannot be used.
+	ConnectionPool *ConnectionPool
 }
 
 func (c StreamingPublisherConfig) Validate() error {
@@ -27,13 +48,34 @@ func (c StreamingPublisherConfig) Validate() error {
 		return errors.New("StreamingPublisherConfig.Marshaler is missing")
 	}
 
+	if c.ConnectionPool != nil && (c.ClusterID != "" || c.ClientID != "" || len(c.StanOptions) > 0 || c.security().enabled()) {
+		return errors.New("connection settings of StreamingPublisherConfig cannot be used together with ConnectionPool")
+	}
+
+	if err := c.security().validate(c.StanOptions); err != nil {
+		return errors.Wrap(err, "invalid StreamingPublisherConfig security settings")
+	}
+
 	return nil
 }
 
+func (c StreamingPublisherConfig) security() connectionSecurity {
+	return connectionSecurity{
+		TLSConfig:       c.TLSConfig,
+		CredentialsFile: c.CredentialsFile,
+		NkeySeedFile:    c.NkeySeedFile,
+		Token:           c.Token,
+	}
+}
+
 type StreamingPublisher struct {
-	conn   stan.Conn
+	conn     stan.Conn
+	natsConn *nats.Conn
+
 	config StreamingPublisherConfig
 	logger watermill.LoggerAdapter
+
+	closed bool
 }
 
 // NewStreamingPublisher creates a new StreamingPublisher.
@@ -49,15 +91,30 @@ func NewStreamingPublisher(config StreamingPublisherConfig, logger watermill.Log
 		return nil, err
 	}
 
-	conn, err := stan.Connect(config.ClusterID, config.ClientID, config.StanOptions...)
+	if config.ConnectionPool != nil {
+		conn, err := config.ConnectionPool.acquire()
+		if err != nil {
+			return nil, err
+		}
+
+		return &StreamingPublisher{
+			conn:     conn.conn,
+			natsConn: conn.natsConn,
+			config:   config,
+			logger:   logger,
+		}, nil
+	}
+
+	conn, natsConn, err := connect(config.ClusterID, config.ClientID, config.StanOptions, config.security())
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot connect to nats")
 	}
 
 	return &StreamingPublisher{
-		conn:   conn,
-		config: config,
-		logger: logger,
+		conn:     conn,
+		natsConn: natsConn,
+		config:   config,
+		logger:   logger,
 	}, nil
 }
 
@@ -65,35 +122,69 @@ func NewStreamingPublisher(config StreamingPublisherConfig, logger watermill.Log
 //
 // Publish will not return until an ack has been received from NATS Streaming.
 // When one of messages delivery fails - function is interrupted.
-func (p StreamingPublisher) Publish(topic string, messages ...*message.Message) error {
+//
+// The topic can be a template with `{key}` segments, expanded with the message's metadata (see ExpandSubject).
+func (p *StreamingPublisher) Publish(topic string, messages ...*message.Message) error {
+	_, err := p.PublishWithResults(topic, messages...)
+	return err
+}
+
+// PublishWithResults works like Publish, but it returns the NATS Streaming GUID of every published message
+// as the BrokerMessageID.
+func (p *StreamingPublisher) PublishWithResults(topic string, messages ...*message.Message) ([]message.PublishResult, error) {
+	results := make([]message.PublishResult, 0, len(messages))
+
 	for _, msg := range messages {
+		subject, err := ExpandSubject(topic, msg)
+		if err != nil {
+			return results, err
+		}
+
 		messageFields := watermill.LogFields{
 			"message_uuid": msg.UUID,
-			"topic_name":   topic,
+			"topic_name":   subject,
 		}
 
 		p.logger.Trace("Publishing message", messageFields)
 
-		b, err := p.config.Marshaler.Marshal(topic, msg)
+		b, err := p.config.Marshaler.Marshal(subject, msg)
 		if err != nil {
-			return err
+			return results, err
 		}
 
-		if err := p.conn.Publish(topic, b); err != nil {
-			return errors.Wrap(err, "sending message failed")
+		acked := make(chan error, 1)
+		guid, err := p.conn.PublishAsync(subject, b, func(_ string, err error) {
+			acked <- err
+		})
+		if err != nil {
+			return results, errors.Wrap(err, "sending message failed")
 		}
+		if err := <-acked; err != nil {
+			return results, errors.Wrap(err, "sending message failed")
+		}
+
+		results = append(results, message.PublishResult{
+			MessageUUID:     msg.UUID,
+			BrokerMessageID: guid,
+		})
 	}
 
-	return nil
+	return results, nil
 }
 
-func (p StreamingPublisher) Close() error {
+// Close closes the connection, or releases it to the ConnectionPool. Closing again is a no-op.
+func (p *StreamingPublisher) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
 	p.logger.Trace("Closing publisher", nil)
 	defer p.logger.Trace("StreamingPublisher closed", nil)
 
-	if err := p.conn.Close(); err != nil {
-		return errors.Wrap(err, "closing NATS conn failed")
+	if p.config.ConnectionPool != nil {
+		return p.config.ConnectionPool.release()
 	}
 
-	return nil
+	return pooledConnection{conn: p.conn, natsConn: p.natsConn}.close()
 }
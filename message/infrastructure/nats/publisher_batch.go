@@ -0,0 +1,108 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// FailedMessage describes a message of the batch, which was not published by PublishBatch.
+type FailedMessage struct {
+	// Index is the index of the message in the batch.
+	Index       int
+	MessageUUID string
+	Err         error
+}
+
+// BatchPublishError is returned by PublishBatch, when any message of the batch was not published.
+type BatchPublishError struct {
+	Topic          string
+	FailedMessages []FailedMessage
+}
+
+func (e *BatchPublishError) Error() string {
+	msgs := make([]string, 0, len(e.FailedMessages))
+	for _, failed := range e.FailedMessages {
+		msgs = append(msgs, fmt.Sprintf("message %s (%d): %s", failed.MessageUUID, failed.Index, failed.Err))
+	}
+
+	return fmt.Sprintf(
+		"%d messages not published to %s: %s",
+		len(e.FailedMessages), e.Topic, strings.Join(msgs, "; "),
+	)
+}
+
+// PublishBatch publishes messages without waiting for the ack of every message before sending the next one,
+// and waits for acks of all messages at the end. It saves a round trip per message compared to Publish.
+//
+// In contrast to Publish, the batch is not interrupted, when publishing of a message fails.
+// Results of the published messages are returned (in order of the batch) with *BatchPublishError,
+// which contains errors of all failed messages.
+//
+// The number of messages waiting for ack is limited by stan.MaxPubAcksInflight of the connection.
+func (p *StreamingPublisher) PublishBatch(topic string, messages ...*message.Message) ([]message.PublishResult, error) {
+	guids := make([]string, len(messages))
+	errs := make([]error, len(messages))
+	acksWg := sync.WaitGroup{}
+
+	for i, msg := range messages {
+		subject, err := ExpandSubject(topic, msg)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		p.logger.Trace("Publishing message in batch", watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"topic_name":   subject,
+		})
+
+		b, err := p.config.Marshaler.Marshal(subject, msg)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		i := i
+		acksWg.Add(1)
+		guids[i], err = p.conn.PublishAsync(subject, b, func(_ string, err error) {
+			if err != nil {
+				errs[i] = errors.Wrap(err, "sending message failed")
+			}
+			acksWg.Done()
+		})
+		if err != nil {
+			// the ack handler is not called, when the message was not sent
+			errs[i] = errors.Wrap(err, "sending message failed")
+			acksWg.Done()
+		}
+	}
+
+	acksWg.Wait()
+
+	results := make([]message.PublishResult, 0, len(messages))
+	var failedMessages []FailedMessage
+
+	for i, msg := range messages {
+		if errs[i] != nil {
+			failedMessages = append(failedMessages, FailedMessage{Index: i, MessageUUID: msg.UUID, Err: errs[i]})
+			continue
+		}
+
+		results = append(results, message.PublishResult{
+			MessageUUID:     msg.UUID,
+			BrokerMessageID: guids[i],
+		})
+	}
+
+	if len(failedMessages) > 0 {
+		return results, &BatchPublishError{Topic: topic, FailedMessages: failedMessages}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,57 @@
+package nats_test
+
+import (
+	"os"
+	"testing"
+
+	stan "github.com/nats-io/go-nats-streaming"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/nats"
+)
+
+func TestStreamingPublisher_PublishBatch(t *testing.T) {
+	natsURL := os.Getenv("WATERMILL_TEST_NATS_URL")
+	if natsURL == "" {
+		natsURL = "nats://localhost:4222"
+	}
+
+	pub, err := nats.NewStreamingPublisher(nats.StreamingPublisherConfig{
+		ClusterID: "test-cluster",
+		ClientID:  watermill.NewUUID() + "_pub",
+		Marshaler: nats.GobMarshaler{},
+		StanOptions: []stan.Option{
+			stan.NatsURL(natsURL),
+		},
+	}, watermill.NewStdLogger(true, true))
+	require.NoError(t, err)
+	defer pub.Close()
+
+	var messages []*message.Message
+	for i := 0; i < 100; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+		msg.Metadata.Set("kind", "batch")
+		messages = append(messages, msg)
+	}
+	// the subject template cannot be expanded, because of the missing metadata
+	delete(messages[50].Metadata, "kind")
+
+	results, err := pub.PublishBatch("publish_batch_"+watermill.NewShortUUID()+".{kind}", messages...)
+	require.Error(t, err)
+
+	batchErr, ok := err.(*nats.BatchPublishError)
+	require.True(t, ok, "expected *BatchPublishError, got %T", err)
+	require.Len(t, batchErr.FailedMessages, 1)
+	assert.Equal(t, 50, batchErr.FailedMessages[0].Index)
+	assert.Equal(t, messages[50].UUID, batchErr.FailedMessages[0].MessageUUID)
+
+	require.Len(t, results, 99)
+	for _, result := range results {
+		assert.NotEmpty(t, result.BrokerMessageID)
+	}
+	assert.Equal(t, messages[0].UUID, results[0].MessageUUID)
+	assert.Equal(t, messages[51].UUID, results[50].MessageUUID)
+}
@@ -0,0 +1,46 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	internalSync "github.com/ThreeDotsLabs/watermill/internal/sync"
+)
+
+func TestStreamingPublisher_Close_twice_with_ConnectionPool(t *testing.T) {
+	closedConnections := 0
+	pool := &ConnectionPool{conn: internalSync.NewRefCounted(
+		func() (interface{}, error) {
+			return pooledConnection{}, nil
+		},
+		func(interface{}) error {
+			closedConnections++
+			return nil
+		},
+	)}
+
+	var publishers []*StreamingPublisher
+	for i := 0; i < 2; i++ {
+		conn, err := pool.acquire()
+		require.NoError(t, err)
+
+		publishers = append(publishers, &StreamingPublisher{
+			conn:     conn.conn,
+			natsConn: conn.natsConn,
+			config:   StreamingPublisherConfig{ConnectionPool: pool},
+			logger:   watermill.NopLogger{},
+		})
+	}
+
+	require.NoError(t, publishers[0].Close())
+	require.NoError(t, publishers[0].Close())
+
+	assert.Equal(t, 1, pool.conn.Refs(), "the connection should be still used by the second publisher")
+	assert.Equal(t, 0, closedConnections)
+
+	require.NoError(t, publishers[1].Close())
+	assert.Equal(t, 1, closedConnections)
+}
@@ -0,0 +1,90 @@
+package nats
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// SubjectMetadataKey is the metadata key, to which the concrete subject (channel) of the message is set,
+// when the message is received with a wildcard subscription.
+const SubjectMetadataKey = "nats_subject"
+
+// IsWildcardSubject returns true, when the subject contains `*` or `>` tokens.
+func IsWildcardSubject(subject string) bool {
+	for _, token := range strings.Split(subject, ".") {
+		if token == "*" || token == ">" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchSubject checks if the subject matches the pattern, according to the NATS subject rules:
+// `*` matches a single token and `>` (only as the last token) matches one or more tokens.
+func MatchSubject(pattern string, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" && i == len(patternTokens)-1 {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// MatchingChannels can be used as StreamingSubscriberConfig.ResolveWildcard, when all channels are known upfront.
+// It resolves the pattern to the channels matching it.
+func MatchingChannels(channels ...string) func(pattern string) ([]string, error) {
+	return func(pattern string) ([]string, error) {
+		var matching []string
+		for _, channel := range channels {
+			if MatchSubject(pattern, channel) {
+				matching = append(matching, channel)
+			}
+		}
+
+		return matching, nil
+	}
+}
+
+// ExpandSubject replaces `{key}` segments of the subject template with the values of the message's metadata,
+// for example `orders.{region}.{event}` may be expanded to `orders.eu.created`.
+//
+// It returns an error, when the metadata value is missing or is not a valid subject token.
+func ExpandSubject(template string, msg *message.Message) (string, error) {
+	if !strings.Contains(template, "{") {
+		return template, nil
+	}
+
+	tokens := strings.Split(template, ".")
+	for i, token := range tokens {
+		if !strings.HasPrefix(token, "{") || !strings.HasSuffix(token, "}") {
+			continue
+		}
+
+		key := token[1 : len(token)-1]
+		value := msg.Metadata.Get(key)
+		if value == "" {
+			return "", errors.Errorf("missing metadata %s required by subject %s", key, template)
+		}
+		if strings.ContainsAny(value, ".*> \t") {
+			return "", errors.Errorf("metadata %s value %q is not a valid subject token", key, value)
+		}
+
+		tokens[i] = value
+	}
+
+	return strings.Join(tokens, "."), nil
+}
@@ -0,0 +1,68 @@
+package nats_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/nats"
+)
+
+func TestMatchSubject(t *testing.T) {
+	testCases := []struct {
+		Pattern string
+		Subject string
+		Match   bool
+	}{
+		{Pattern: "orders", Subject: "orders", Match: true},
+		{Pattern: "orders", Subject: "orders.created", Match: false},
+		{Pattern: "orders.*", Subject: "orders.created", Match: true},
+		{Pattern: "orders.*", Subject: "orders", Match: false},
+		{Pattern: "orders.*", Subject: "orders.eu.created", Match: false},
+		{Pattern: "orders.*.created", Subject: "orders.eu.created", Match: true},
+		{Pattern: "orders.>", Subject: "orders.eu.created", Match: true},
+		{Pattern: "orders.>", Subject: "orders", Match: false},
+		{Pattern: "orders.>", Subject: "payments.eu", Match: false},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.Pattern+"_"+c.Subject, func(t *testing.T) {
+			assert.Equal(t, c.Match, nats.MatchSubject(c.Pattern, c.Subject))
+		})
+	}
+}
+
+func TestMatchingChannels(t *testing.T) {
+	resolve := nats.MatchingChannels("orders.created", "orders.paid", "payments.created")
+
+	channels, err := resolve("orders.*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders.created", "orders.paid"}, channels)
+
+	assert.True(t, nats.IsWildcardSubject("orders.*"))
+	assert.True(t, nats.IsWildcardSubject("orders.>"))
+	assert.False(t, nats.IsWildcardSubject("orders.created"))
+}
+
+func TestExpandSubject(t *testing.T) {
+	msg := message.NewMessage("1", nil)
+	msg.Metadata.Set("region", "eu")
+	msg.Metadata.Set("event", "created")
+
+	subject, err := nats.ExpandSubject("orders.{region}.{event}", msg)
+	require.NoError(t, err)
+	assert.Equal(t, "orders.eu.created", subject)
+
+	subject, err = nats.ExpandSubject("orders", msg)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", subject)
+
+	_, err = nats.ExpandSubject("orders.{missing}", msg)
+	assert.Error(t, err)
+
+	msg.Metadata.Set("region", "eu.west")
+	_, err = nats.ExpandSubject("orders.{region}", msg)
+	assert.Error(t, err)
+}
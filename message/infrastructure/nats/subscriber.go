@@ -2,15 +2,20 @@ package nats
 
 import (
 	"context"
+	"crypto/tls"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	internalSync "github.com/ThreeDotsLabs/watermill/internal/sync"
 
 	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/backoff"
 
 	"github.com/ThreeDotsLabs/watermill/message"
+	nats "github.com/nats-io/go-nats"
 	"github.com/nats-io/go-nats-streaming"
+	"github.com/nats-io/go-nats-streaming/pb"
 	"github.com/pkg/errors"
 )
 
@@ -67,6 +72,45 @@ type StreamingSubscriberConfig struct {
 	// 		stan.NatsURL("nats://localhost:4222")
 	StanOptions []stan.Option
 
+	// TLSConfig enables TLS for the connection to NATS.
+	TLSConfig *tls.Config
+
+	// CredentialsFile is the path to the user credentials file, containing the user JWT and nkey seed.
+	// It cannot be used together with NkeySeedFile or Token.
+	CredentialsFile string
+
+	// NkeySeedFile is the path to the file with the nkey seed, used for nkey authentication.
+	// It cannot be used together with CredentialsFile or Token.
+	NkeySeedFile string
+
+	// Token is the token used for token authentication.
+	Token string
+
+	// DisableReconnect disables re-connecting, when the connection to NATS Streaming is lost.
+	//
+	// When the connection is lost and re-connecting is disabled, the subscriber stops receiving messages.
+	DisableReconnect bool
+
+	// ReconnectInterval is the initial interval between re-connect attempts.
+	// It is doubled after every failed attempt, up to MaxReconnectInterval.
+	ReconnectInterval time.Duration
+
+	// MaxReconnectInterval is the maximum interval between re-connect attempts.
+	MaxReconnectInterval time.Duration
+
+	// ReconnectBackoff is the strategy of delays between re-connect attempts.
+	// When set, ReconnectInterval and MaxReconnectInterval are ignored.
+	// When the strategy stops retrying, the subscriber stops receiving messages.
+	ReconnectBackoff backoff.Strategy
+
+	// ResolveWildcard resolves a wildcard topic passed to Subscribe (for example `orders.*` or `orders.>`)
+	// to the concrete channels, for example with MatchingChannels.
+	// NATS Streaming doesn't support wildcard subscriptions, so every resolved channel is subscribed
+	// and the messages are merged into one output channel, with the channel set in SubjectMetadataKey metadata.
+	//
+	// When nil, subscribing to a wildcard topic returns an error.
+	ResolveWildcard func(pattern string) ([]string, error)
+
 	// StanSubscriptionOptions are custom []stan.SubscriptionOption passed to subscription.
 	StanSubscriptionOptions []stan.SubscriptionOption
 
@@ -84,6 +128,18 @@ func (c *StreamingSubscriberConfig) setDefaults() {
 	if c.AckWaitTimeout <= 0 {
 		c.AckWaitTimeout = time.Second * 30
 	}
+	if c.ReconnectInterval <= 0 {
+		c.ReconnectInterval = time.Second
+	}
+	if c.MaxReconnectInterval <= 0 {
+		c.MaxReconnectInterval = time.Second * 30
+	}
+	if c.ReconnectBackoff == nil {
+		c.ReconnectBackoff = backoff.Exponential{
+			Initial: c.ReconnectInterval,
+			Max:     c.MaxReconnectInterval,
+		}
+	}
 
 	c.StanSubscriptionOptions = append(
 		c.StanSubscriptionOptions,
@@ -109,16 +165,34 @@ func (c *StreamingSubscriberConfig) Validate() error {
 		)
 	}
 
+	if err := c.security().validate(c.StanOptions); err != nil {
+		return errors.Wrap(err, "invalid StreamingSubscriberConfig security settings")
+	}
+
 	return nil
 }
 
+func (c *StreamingSubscriberConfig) security() connectionSecurity {
+	return connectionSecurity{
+		TLSConfig:       c.TLSConfig,
+		CredentialsFile: c.CredentialsFile,
+		NkeySeedFile:    c.NkeySeedFile,
+		Token:           c.Token,
+	}
+}
+
 type StreamingSubscriber struct {
-	conn   stan.Conn
-	logger watermill.LoggerAdapter
+	// connected is accessed atomically, so it must be the first field for the 64-bit alignment
+	connected int64
+
+	conn     stan.Conn
+	natsConn *nats.Conn
+	logger   watermill.LoggerAdapter
 
 	config StreamingSubscriberConfig
 
-	subs     []stan.Subscription
+	// subs are the active subscriptions, which are re-created after re-connect
+	subs     map[*activeSubscription]struct{}
 	subsLock sync.Mutex
 
 	closed  bool
@@ -143,70 +217,274 @@ func NewStreamingSubscriber(config StreamingSubscriberConfig, logger watermill.L
 		return nil, err
 	}
 
-	conn, err := stan.Connect(config.ClusterID, config.ClientID, config.StanOptions...)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot connect to NATS")
-	}
-
-	return &StreamingSubscriber{
-		conn:    conn,
+	s := &StreamingSubscriber{
 		logger:  logger,
 		config:  config,
+		subs:    map[*activeSubscription]struct{}{},
 		closing: make(chan struct{}),
-	}, nil
+	}
+
+	if err := s.connect(); err != nil {
+		return nil, errors.Wrap(err, "cannot connect to NATS")
+	}
+
+	return s, nil
+}
+
+// Connected returns false, when the connection to NATS Streaming is lost and the subscriber is re-connecting.
+// It can be used by health checks.
+func (s *StreamingSubscriber) Connected() bool {
+	return atomic.LoadInt64(&s.connected) == 1
+}
+
+func (s *StreamingSubscriber) connect() error {
+	stanOptions := s.config.StanOptions
+	if !s.config.DisableReconnect {
+		userConnectionLostHandler := stanOptionsFromList(stanOptions).ConnectionLostCB
+
+		// options are copied, to not modify options from the config
+		stanOptions = append(
+			append([]stan.Option{}, stanOptions...),
+			stan.SetConnectionLostHandler(func(conn stan.Conn, reason error) {
+				if userConnectionLostHandler != nil {
+					userConnectionLostHandler(conn, reason)
+				}
+				s.onConnectionLost(reason)
+			}),
+		)
+	}
+
+	conn, natsConn, err := connect(s.config.ClusterID, s.config.ClientID, stanOptions, s.config.security())
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	s.natsConn = natsConn
+	atomic.StoreInt64(&s.connected, 1)
+
+	return nil
+}
+
+func (s *StreamingSubscriber) onConnectionLost(reason error) {
+	atomic.StoreInt64(&s.connected, 0)
+	s.logger.Error("Connection to NATS Streaming lost, re-connecting", reason, nil)
+
+	go s.reconnect()
+}
+
+// reconnect re-connects to NATS Streaming with backoff and re-creates all active subscriptions.
+//
+// Durable subscriptions are resumed from the last acknowledged message.
+func (s *StreamingSubscriber) reconnect() {
+	for attempt := 1; ; attempt++ {
+		interval, ok := s.config.ReconnectBackoff.Next(attempt)
+		if !ok {
+			s.logger.Error("Giving up re-connecting to NATS Streaming", errors.New("reconnect attempts exhausted"), nil)
+			return
+		}
+
+		select {
+		case <-s.closing:
+			return
+		case <-time.After(interval):
+		}
+
+		err := s.reconnectAndResubscribe()
+		if err == nil {
+			s.logger.Info("Re-connected to NATS Streaming", nil)
+			return
+		}
+
+		s.logger.Error("Cannot re-connect to NATS Streaming", err, watermill.LogFields{"attempt": attempt})
+	}
+}
+
+func (s *StreamingSubscriber) reconnectAndResubscribe() error {
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	if s.conn != nil {
+		// the connection is lost, so closing it fails, but it releases its resources
+		_ = s.conn.Close()
+	}
+	if s.natsConn != nil {
+		// NATS connection created by the subscriber is not closed by NATS Streaming
+		s.natsConn.Close()
+	}
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	for activeSub := range s.subs {
+		stanSub, err := s.subscribe(
+			activeSub.ctx,
+			activeSub.output,
+			activeSub.sub,
+			activeSub.logFields,
+			activeSub.processMessagesWg,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "cannot re-subscribe to %s", activeSub.sub.topic)
+		}
+
+		activeSub.stanSub = stanSub
+	}
+
+	return nil
+}
+
+// activeSubscription is a NATS Streaming subscription started by Subscribe,
+// with everything which is needed to re-create it after re-connect.
+type activeSubscription struct {
+	ctx               context.Context
+	output            chan *message.Message
+	sub               subscription
+	logFields         watermill.LogFields
+	processMessagesWg *sync.WaitGroup
+
+	stanSub stan.Subscription
 }
 
 // Subscribe subscribes messages from NATS Streaming.
 //
 // Subscribe will spawn SubscribersCount goroutines making subscribe.
 func (s *StreamingSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	return s.SubscribeWithOptions(ctx, topic)
+}
+
+// SubscribeWithOptions works like Subscribe, with the subscription's settings overridden by opts.
+//
+// ConsumerGroup overrides StreamingSubscriberConfig.QueueGroup.
+// StartPosition is mapped to stan.DeliverAllAvailable or stan.StartAt(pb.StartPosition_NewOnly).
+func (s *StreamingSubscriber) SubscribeWithOptions(
+	ctx context.Context,
+	topic string,
+	opts ...message.SubscribeOption,
+) (<-chan *message.Message, error) {
+	channels, err := s.resolveChannels(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	options := message.NewSubscribeOptions(opts...)
+
 	output := make(chan *message.Message, 0)
 	s.outputsWg.Add(1)
 
+	subscribersWg := &sync.WaitGroup{}
+
+	for _, channel := range channels {
+		sub := s.newSubscription(channel, options)
+		sub.wildcard = channel != topic
+
+		if err := s.startSubscribers(ctx, output, sub, subscribersWg); err != nil {
+			return nil, err
+		}
+	}
+
+	go func() {
+		subscribersWg.Wait()
+		close(output)
+		s.outputsWg.Done()
+	}()
+
+	return output, nil
+}
+
+func (s *StreamingSubscriber) resolveChannels(topic string) ([]string, error) {
+	if !IsWildcardSubject(topic) {
+		return []string{topic}, nil
+	}
+
+	if s.config.ResolveWildcard == nil {
+		return nil, errors.Errorf(
+			"cannot subscribe to wildcard topic %s, StreamingSubscriberConfig.ResolveWildcard is missing",
+			topic,
+		)
+	}
+
+	channels, err := s.config.ResolveWildcard(topic)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot resolve wildcard topic %s", topic)
+	}
+	if len(channels) == 0 {
+		return nil, errors.Errorf("no channels matching wildcard topic %s", topic)
+	}
+
+	return channels, nil
+}
+
+// startSubscribers starts SubscribersCount subscriptions of sub, sending messages to output.
+func (s *StreamingSubscriber) startSubscribers(
+	ctx context.Context,
+	output chan *message.Message,
+	sub subscription,
+	subscribersWg *sync.WaitGroup,
+) error {
 	for i := 0; i < s.config.SubscribersCount; i++ {
 		subscriberLogFields := watermill.LogFields{
 			"subscriber_num": i,
-			"topic":          topic,
+			"topic":          sub.topic,
 		}
 
 		s.logger.Debug("Starting subscriber", subscriberLogFields)
 
-		processMessagesWg := &sync.WaitGroup{}
+		activeSub := &activeSubscription{
+			ctx:               ctx,
+			output:            output,
+			sub:               sub,
+			logFields:         subscriberLogFields,
+			processMessagesWg: &sync.WaitGroup{},
+		}
 
-		sub, err := s.subscribe(ctx, output, topic, subscriberLogFields, processMessagesWg)
+		s.subsLock.Lock()
+		stanSub, err := s.subscribe(ctx, output, sub, subscriberLogFields, activeSub.processMessagesWg)
 		if err != nil {
-			return nil, errors.Wrap(err, "cannot subscribe")
+			s.subsLock.Unlock()
+			return errors.Wrap(err, "cannot subscribe")
 		}
+		activeSub.stanSub = stanSub
+		s.subs[activeSub] = struct{}{}
+		s.subsLock.Unlock()
 
-		go func(subscriber stan.Subscription, subscriberLogFields watermill.LogFields) {
+		subscribersWg.Add(1)
+		go func(activeSub *activeSubscription) {
 			select {
 			case <-s.closing:
 				// unblock
 			case <-ctx.Done():
 				// unblock
 			}
-			if err := sub.Close(); err != nil {
-				s.logger.Error("Cannot close subscriber", err, subscriberLogFields)
-			}
 
-			processMessagesWg.Wait()
-			close(output)
-			s.outputsWg.Done()
-		}(sub, subscriberLogFields)
+			s.subsLock.Lock()
+			delete(s.subs, activeSub)
+			if err := activeSub.stanSub.Close(); err != nil {
+				s.logger.Error("Cannot close subscriber", err, activeSub.logFields)
+			}
+			s.subsLock.Unlock()
 
-		s.subsLock.Lock()
-		s.subs = append(s.subs, sub)
-		s.subsLock.Unlock()
+			activeSub.processMessagesWg.Wait()
+			subscribersWg.Done()
+		}(activeSub)
 	}
 
-	return output, nil
+	return nil
 }
 
 func (s *StreamingSubscriber) SubscribeInitialize(topic string) (err error) {
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
 	sub, err := s.subscribe(
 		context.Background(),
 		make(chan *message.Message),
-		topic,
+		s.newSubscription(topic, message.SubscribeOptions{}),
 		nil,
 		&sync.WaitGroup{},
 	)
@@ -217,36 +495,77 @@ func (s *StreamingSubscriber) SubscribeInitialize(topic string) (err error) {
 	return errors.Wrap(sub.Close(), "cannot close after subscribe initialize")
 }
 
+// subscription contains settings of a single Subscribe call.
+type subscription struct {
+	topic               string
+	queueGroup          string
+	subscriptionOptions []stan.SubscriptionOption
+
+	// wildcard is true, when the subscription was resolved from a wildcard topic
+	wildcard bool
+}
+
+func (s *StreamingSubscriber) newSubscription(topic string, options message.SubscribeOptions) subscription {
+	sub := subscription{
+		topic:               topic,
+		queueGroup:          s.config.QueueGroup,
+		subscriptionOptions: s.config.StanSubscriptionOptions,
+	}
+
+	if options.ConsumerGroup != "" {
+		sub.queueGroup = options.ConsumerGroup
+	}
+
+	var startOption stan.SubscriptionOption
+	switch options.StartPosition {
+	case message.StartPositionOldest:
+		startOption = stan.DeliverAllAvailable()
+	case message.StartPositionNewest:
+		startOption = stan.StartAt(pb.StartPosition_NewOnly)
+	}
+
+	if startOption != nil {
+		// options are copied, to not modify options from the config
+		sub.subscriptionOptions = append(
+			append([]stan.SubscriptionOption{}, s.config.StanSubscriptionOptions...),
+			startOption,
+		)
+	}
+
+	return sub
+}
+
+// subscribe creates a NATS Streaming subscription. subsLock must be held by the caller.
 func (s *StreamingSubscriber) subscribe(
 	ctx context.Context,
 	output chan *message.Message,
-	topic string,
+	sub subscription,
 	subscriberLogFields watermill.LogFields,
 	processMessagesWg *sync.WaitGroup,
 ) (stan.Subscription, error) {
-	if s.config.QueueGroup != "" {
+	if sub.queueGroup != "" {
 		return s.conn.QueueSubscribe(
-			topic,
-			s.config.QueueGroup,
+			sub.topic,
+			sub.queueGroup,
 			func(m *stan.Msg) {
 				processMessagesWg.Add(1)
 				defer processMessagesWg.Done()
 
-				s.processMessage(ctx, m, output, subscriberLogFields)
+				s.processMessage(ctx, m, output, sub.wildcard, subscriberLogFields)
 			},
-			s.config.StanSubscriptionOptions...,
+			sub.subscriptionOptions...,
 		)
 	}
 
 	return s.conn.Subscribe(
-		topic,
+		sub.topic,
 		func(m *stan.Msg) {
 			processMessagesWg.Add(1)
 			defer processMessagesWg.Done()
 
-			s.processMessage(ctx, m, output, subscriberLogFields)
+			s.processMessage(ctx, m, output, sub.wildcard, subscriberLogFields)
 		},
-		s.config.StanSubscriptionOptions...,
+		sub.subscriptionOptions...,
 	)
 }
 
@@ -254,6 +573,7 @@ func (s *StreamingSubscriber) processMessage(
 	ctx context.Context,
 	m *stan.Msg,
 	output chan *message.Message,
+	setSubject bool,
 	logFields watermill.LogFields,
 ) {
 	if s.closed {
@@ -271,6 +591,10 @@ func (s *StreamingSubscriber) processMessage(
 		return
 	}
 
+	if setSubject {
+		msg.Metadata.Set(SubjectMetadataKey, m.Subject)
+	}
+
 	ctx, cancelCtx := context.WithCancel(ctx)
 	msg.SetContext(ctx)
 	defer cancelCtx()
@@ -312,24 +636,30 @@ func (s *StreamingSubscriber) processMessage(
 
 func (s *StreamingSubscriber) Close() error {
 	s.subsLock.Lock()
-	defer s.subsLock.Unlock()
-
 	if s.closed {
+		s.subsLock.Unlock()
 		return nil
 	}
 	s.closed = true
+	close(s.closing)
+	s.subsLock.Unlock()
 
 	s.logger.Debug("Closing subscriber", nil)
 	defer s.logger.Info("StreamingSubscriber closed", nil)
 
 	var result error
 
-	close(s.closing)
 	internalSync.WaitGroupTimeout(&s.outputsWg, s.config.CloseTimeout)
 
-	if err := s.conn.Close(); err != nil {
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	if err := s.conn.Close(); err != nil && err != stan.ErrConnectionClosed {
 		return errors.Wrap(err, "cannot close conn")
 	}
+	if s.natsConn != nil {
+		s.natsConn.Close()
+	}
 
 	return result
 }
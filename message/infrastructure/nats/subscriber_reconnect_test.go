@@ -0,0 +1,43 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// lostConn is a stan.Conn, which lost the connection to the server.
+type lostConn struct {
+	stan.Conn
+	closed int
+}
+
+func (c *lostConn) Close() error {
+	c.closed++
+	return errors.New("connection lost")
+}
+
+func TestStreamingSubscriber_reconnect_closes_lost_connection(t *testing.T) {
+	conn := &lostConn{}
+
+	s := &StreamingSubscriber{
+		conn:   conn,
+		logger: watermill.NopLogger{},
+		config: StreamingSubscriberConfig{
+			ClusterID:        "test-cluster",
+			ClientID:         "test-client",
+			StanOptions:      []stan.Option{stan.NatsURL("nats://127.0.0.1:1")},
+			DisableReconnect: true,
+		},
+		subs:    map[*activeSubscription]struct{}{},
+		closing: make(chan struct{}),
+	}
+
+	// the server is not available, so only the lost connection is closed
+	assert.Error(t, s.reconnectAndResubscribe())
+	assert.Equal(t, 1, conn.closed)
+}
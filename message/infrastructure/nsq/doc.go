@@ -0,0 +1,14 @@
+// NSQ implementation of Watermill's Pub/Sub interface.
+//
+// Watermill's topic is mapped to the NSQ topic and the consumer group to the NSQ channel:
+// every channel receives a copy of all messages of the topic, and messages of a channel are distributed
+// between its subscribers.
+//
+// NSQ messages have no headers, so the UUID and the metadata of the message are stored
+// in the message body by the Marshaler.
+//
+// Supported features:
+// - publishing to nsqd, with batches sent with MPUB
+// - consuming from nsqd instances discovered with nsqlookupd, or from nsqd directly
+// - Nack mapped to requeue with SubscriberConfig.RequeueDelay
+package nsq
@@ -0,0 +1,15 @@
+package nsq
+
+import (
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// nsqLogger passes the logs of the NSQ client to the Watermill logger.
+type nsqLogger struct {
+	logger watermill.LoggerAdapter
+}
+
+func (l nsqLogger) Output(calldepth int, s string) error {
+	l.logger.Debug(s, nil)
+	return nil
+}
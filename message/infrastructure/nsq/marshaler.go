@@ -0,0 +1,46 @@
+package nsq
+
+import (
+	"strconv"
+
+	"github.com/nsqio/go-nsq"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// AttemptsMetadataKey is the metadata key with the number of delivery attempts of the received message.
+const AttemptsMetadataKey = "nsq_attempts"
+
+type Marshaler interface {
+	Marshal(topic string, msg *message.Message) ([]byte, error)
+}
+
+type Unmarshaler interface {
+	Unmarshal(*nsq.Message) (*message.Message, error)
+}
+
+type MarshalerUnmarshaler interface {
+	Marshaler
+	Unmarshaler
+}
+
+// EnvelopeMarshaler marshals messages to versioned JSON envelopes (message.EnvelopeCodec),
+// containing the UUID, the metadata and the payload.
+type EnvelopeMarshaler struct {
+	Codec message.EnvelopeCodec
+}
+
+func (m EnvelopeMarshaler) Marshal(topic string, msg *message.Message) ([]byte, error) {
+	return m.Codec.Marshal(msg)
+}
+
+func (m EnvelopeMarshaler) Unmarshal(nsqMsg *nsq.Message) (*message.Message, error) {
+	msg, err := m.Codec.Unmarshal(nsqMsg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Metadata.Set(AttemptsMetadataKey, strconv.Itoa(int(nsqMsg.Attempts)))
+
+	return msg, nil
+}
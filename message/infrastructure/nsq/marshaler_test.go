@@ -0,0 +1,38 @@
+package nsq_test
+
+import (
+	"testing"
+
+	"github.com/nsqio/go-nsq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	watermillNSQ "github.com/ThreeDotsLabs/watermill/message/infrastructure/nsq"
+)
+
+func TestEnvelopeMarshaler(t *testing.T) {
+	msg := message.NewMessage("1", []byte("zag"))
+	msg.Metadata.Set("foo", "bar")
+
+	marshaler := watermillNSQ.EnvelopeMarshaler{}
+
+	b, err := marshaler.Marshal("topic", msg)
+	require.NoError(t, err)
+
+	nsqMsg := nsq.NewMessage(nsq.MessageID{}, b)
+	nsqMsg.Attempts = 2
+
+	unmarshaledMsg, err := marshaler.Unmarshal(nsqMsg)
+	require.NoError(t, err)
+
+	assert.Equal(t, msg.UUID, unmarshaledMsg.UUID)
+	assert.Equal(t, msg.Payload, unmarshaledMsg.Payload)
+	assert.Equal(t, "bar", unmarshaledMsg.Metadata.Get("foo"))
+	assert.Equal(t, "2", unmarshaledMsg.Metadata.Get(watermillNSQ.AttemptsMetadataKey))
+}
+
+func TestEnvelopeMarshaler_not_envelope(t *testing.T) {
+	_, err := watermillNSQ.EnvelopeMarshaler{}.Unmarshal(nsq.NewMessage(nsq.MessageID{}, []byte("plain")))
+	assert.Error(t, err)
+}
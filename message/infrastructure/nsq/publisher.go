@@ -0,0 +1,123 @@
+package nsq
+
+import (
+	"sync"
+
+	"github.com/nsqio/go-nsq"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type PublisherConfig struct {
+	// NsqdAddr is the TCP address of the nsqd, to which the messages are published, for example "localhost:4150".
+	NsqdAddr string
+
+	// NsqConfig is the configuration of the NSQ producer. Defaults to nsq.NewConfig().
+	NsqConfig *nsq.Config
+
+	Marshaler Marshaler
+}
+
+func (c *PublisherConfig) setDefaults() {
+	if c.NsqConfig == nil {
+		c.NsqConfig = nsq.NewConfig()
+	}
+}
+
+func (c PublisherConfig) Validate() error {
+	if c.NsqdAddr == "" {
+		return errors.New("missing NsqdAddr")
+	}
+	if c.Marshaler == nil {
+		return errors.New("missing Marshaler")
+	}
+
+	return nil
+}
+
+// Publisher publishes messages to nsqd.
+type Publisher struct {
+	config   PublisherConfig
+	producer *nsq.Producer
+	logger   watermill.LoggerAdapter
+
+	closed     bool
+	closedLock sync.RWMutex
+}
+
+func NewPublisher(config PublisherConfig, logger watermill.LoggerAdapter) (*Publisher, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid NSQ publisher config")
+	}
+
+	producer, err := nsq.NewProducer(config.NsqdAddr, config.NsqConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create NSQ producer")
+	}
+	producer.SetLogger(nsqLogger{logger}, nsq.LogLevelInfo)
+
+	return &Publisher{
+		config:   config,
+		producer: producer,
+		logger:   logger,
+	}, nil
+}
+
+// Publish publishes the messages to the NSQ topic. Multiple messages are published in one MPUB batch,
+// so either all or none of them are published.
+//
+// Publish is blocking until nsqd confirms the messages.
+func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	p.closedLock.RLock()
+	defer p.closedLock.RUnlock()
+
+	if p.closed {
+		return errors.New("publisher closed")
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	bodies := make([][]byte, 0, len(messages))
+	for _, msg := range messages {
+		body, err := p.config.Marshaler.Marshal(topic, msg)
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal message %s", msg.UUID)
+		}
+		bodies = append(bodies, body)
+	}
+
+	logFields := watermill.LogFields{"topic": topic, "messages_count": len(messages)}
+	p.logger.Trace("Publishing messages", logFields)
+
+	if len(bodies) == 1 {
+		if err := p.producer.Publish(topic, bodies[0]); err != nil {
+			return errors.Wrapf(err, "cannot publish message %s", messages[0].UUID)
+		}
+		return nil
+	}
+
+	if err := p.producer.MultiPublish(topic, bodies); err != nil {
+		return errors.Wrap(err, "cannot publish messages")
+	}
+
+	return nil
+}
+
+func (p *Publisher) Close() error {
+	p.closedLock.Lock()
+	defer p.closedLock.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	p.producer.Stop()
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package nsq_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure"
+	watermillNSQ "github.com/ThreeDotsLabs/watermill/message/infrastructure/nsq"
+)
+
+func nsqdAddr() string {
+	addr := os.Getenv("WATERMILL_TEST_NSQD_ADDR")
+	if addr != "" {
+		return addr
+	}
+	return "localhost:4150"
+}
+
+func newPubSub(t *testing.T, channel string) message.PubSub {
+	logger := watermill.NewStdLogger(true, true)
+
+	pub, err := watermillNSQ.NewPublisher(watermillNSQ.PublisherConfig{
+		NsqdAddr:  nsqdAddr(),
+		Marshaler: watermillNSQ.EnvelopeMarshaler{},
+	}, logger)
+	require.NoError(t, err)
+
+	sub, err := watermillNSQ.NewSubscriber(watermillNSQ.SubscriberConfig{
+		NsqdAddrs:   []string{nsqdAddr()},
+		Channel:     channel,
+		Unmarshaler: watermillNSQ.EnvelopeMarshaler{},
+	}, logger)
+	require.NoError(t, err)
+
+	return message.NewPubSub(pub, sub)
+}
+
+func createPubSub(t *testing.T) infrastructure.PubSub {
+	return newPubSub(t, "test").(infrastructure.PubSub)
+}
+
+func createPubSubWithConsumerGroup(t *testing.T, consumerGroup string) infrastructure.PubSub {
+	return newPubSub(t, consumerGroup).(infrastructure.PubSub)
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	infrastructure.TestPubSub(
+		t,
+		infrastructure.Features{
+			ConsumerGroups:      true,
+			ExactlyOnceDelivery: false,
+			GuaranteedOrder:     false,
+			Persistent:          true,
+		},
+		createPubSub,
+		createPubSubWithConsumerGroup,
+	)
+}
+
+func TestSubscriberConfig_Validate(t *testing.T) {
+	valid := watermillNSQ.SubscriberConfig{
+		NsqLookupdAddrs: []string{"localhost:4161"},
+		Unmarshaler:     watermillNSQ.EnvelopeMarshaler{},
+	}
+	require.NoError(t, valid.Validate())
+
+	missingAddrs := valid
+	missingAddrs.NsqLookupdAddrs = nil
+	require.Error(t, missingAddrs.Validate())
+
+	invalidChannel := valid
+	invalidChannel.Channel = "invalid channel"
+	require.Error(t, invalidChannel.Validate())
+}
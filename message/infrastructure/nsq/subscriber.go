@@ -0,0 +1,347 @@
+package nsq
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nsqio/go-nsq"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	internalSync "github.com/ThreeDotsLabs/watermill/internal/sync"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type SubscriberConfig struct {
+	// NsqdAddrs are the TCP addresses of nsqd instances to consume from directly, for example "localhost:4150".
+	NsqdAddrs []string
+
+	// NsqLookupdAddrs are the HTTP addresses of nsqlookupd instances, for example "localhost:4161".
+	// They are used to discover the nsqd instances with the topic, also the ones which start producing it later.
+	NsqLookupdAddrs []string
+
+	// Channel is the NSQ channel to consume from.
+	// Every channel receives a copy of all messages of the topic and messages of the channel are distributed
+	// between its subscribers, so the channel is the consumer group of the subscriber.
+	//
+	// It may be left empty, when the channel is set for every subscription with message.WithConsumerGroup.
+	Channel string
+
+	// RequeueDelay is the delay after which the nacked message is delivered again.
+	RequeueDelay time.Duration
+
+	// NsqConfig is the configuration of the NSQ consumer. Defaults to nsq.NewConfig().
+	//
+	// Messages which are not acked within the message timeout (NsqConfig.MsgTimeout, or the default of nsqd)
+	// are delivered again by nsqd.
+	NsqConfig *nsq.Config
+
+	// TouchInterval is how often the messages waiting for ack are touched, which resets their message timeout,
+	// so they are not delivered again while they are handled.
+	// Defaults to half of NsqConfig.MsgTimeout, or 30s when MsgTimeout is not set.
+	TouchInterval time.Duration
+
+	// CloseTimeout determines how long Close waits for the subscriptions to stop. Defaults to 30s.
+	CloseTimeout time.Duration
+
+	Unmarshaler Unmarshaler
+}
+
+func (c *SubscriberConfig) setDefaults() {
+	if c.NsqConfig == nil {
+		c.NsqConfig = nsq.NewConfig()
+	}
+	if c.TouchInterval == 0 {
+		if c.NsqConfig.MsgTimeout > 0 {
+			c.TouchInterval = c.NsqConfig.MsgTimeout / 2
+		} else {
+			// half of the default message timeout of nsqd
+			c.TouchInterval = time.Second * 30
+		}
+	}
+	if c.CloseTimeout == 0 {
+		c.CloseTimeout = time.Second * 30
+	}
+}
+
+func (c SubscriberConfig) Validate() error {
+	if len(c.NsqdAddrs) == 0 && len(c.NsqLookupdAddrs) == 0 {
+		return errors.New("missing NsqdAddrs or NsqLookupdAddrs")
+	}
+	if c.Channel != "" && !nsq.IsValidChannelName(c.Channel) {
+		return errors.Errorf("invalid channel name %s", c.Channel)
+	}
+	if c.RequeueDelay < 0 {
+		return errors.New("RequeueDelay cannot be negative")
+	}
+	if c.TouchInterval < 0 {
+		return errors.New("TouchInterval cannot be negative")
+	}
+	if c.Unmarshaler == nil {
+		return errors.New("missing Unmarshaler")
+	}
+
+	return nil
+}
+
+// Subscriber consumes messages from NSQ. Every Subscribe call creates a separate NSQ consumer.
+type Subscriber struct {
+	config SubscriberConfig
+	logger watermill.LoggerAdapter
+
+	closing       chan struct{}
+	closed        bool
+	closedLock    sync.Mutex
+	subscribersWg sync.WaitGroup
+}
+
+func NewSubscriber(config SubscriberConfig, logger watermill.LoggerAdapter) (*Subscriber, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid NSQ subscriber config")
+	}
+
+	return &Subscriber{
+		config:  config,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// Subscribe consumes messages of the topic from SubscriberConfig.Channel.
+func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	return s.SubscribeWithOptions(ctx, topic)
+}
+
+// SubscribeWithOptions works like Subscribe, with the subscription's settings overridden by opts.
+//
+// ConsumerGroup overrides SubscriberConfig.Channel.
+// StartPosition is not supported, because NSQ channels can't be rewound:
+// a new channel receives the messages published after it was created.
+func (s *Subscriber) SubscribeWithOptions(
+	ctx context.Context,
+	topic string,
+	opts ...message.SubscribeOption,
+) (<-chan *message.Message, error) {
+	options := message.NewSubscribeOptions(opts...)
+	if options.StartPosition != message.StartPositionDefault {
+		return nil, errors.New("NSQ subscriber doesn't support StartPosition")
+	}
+
+	channel, err := s.channel(options)
+	if err != nil {
+		return nil, err
+	}
+
+	s.closedLock.Lock()
+	if s.closed {
+		s.closedLock.Unlock()
+		return nil, errors.New("subscriber closed")
+	}
+	s.subscribersWg.Add(1)
+	s.closedLock.Unlock()
+
+	logFields := watermill.LogFields{"topic": topic, "channel": channel}
+	output := make(chan *message.Message)
+
+	consumer, err := s.newConsumer(topic, channel, s.config.NsqConfig)
+	if err != nil {
+		s.subscribersWg.Done()
+		return nil, err
+	}
+	consumer.AddHandler(nsq.HandlerFunc(func(nsqMsg *nsq.Message) error {
+		s.handleMessage(ctx, nsqMsg, output, logFields)
+		return nil
+	}))
+
+	if err := s.connect(consumer); err != nil {
+		consumer.Stop()
+		s.subscribersWg.Done()
+		return nil, err
+	}
+
+	s.logger.Info("Subscribed to NSQ topic", logFields)
+
+	go func() {
+		select {
+		case <-s.closing:
+		case <-ctx.Done():
+		}
+
+		consumer.Stop()
+		<-consumer.StopChan
+
+		close(output)
+		s.subscribersWg.Done()
+	}()
+
+	return output, nil
+}
+
+// SubscribeInitialize creates SubscriberConfig.Channel on the nsqd instances of SubscriberConfig.NsqdAddrs,
+// so the messages published before the first Subscribe are kept for the channel.
+//
+// nsqlookupd knows only the topics which already exist, so SubscribeInitialize requires NsqdAddrs.
+func (s *Subscriber) SubscribeInitialize(topic string) error {
+	channel, err := s.channel(message.SubscribeOptions{})
+	if err != nil {
+		return err
+	}
+	if len(s.config.NsqdAddrs) == 0 {
+		return errors.New("SubscribeInitialize requires SubscriberConfig.NsqdAddrs")
+	}
+
+	// with max in flight 0 nsqd doesn't send any messages to the consumer
+	config := *s.config.NsqConfig
+	config.MaxInFlight = 0
+
+	consumer, err := s.newConsumer(topic, channel, &config)
+	if err != nil {
+		return err
+	}
+	consumer.AddHandler(nsq.HandlerFunc(func(*nsq.Message) error {
+		return nil
+	}))
+
+	// subscribing creates the topic and the channel
+	err = consumer.ConnectToNSQDs(s.config.NsqdAddrs)
+
+	consumer.Stop()
+	<-consumer.StopChan
+
+	return errors.Wrapf(err, "cannot initialize channel %s of topic %s", channel, topic)
+}
+
+func (s *Subscriber) channel(options message.SubscribeOptions) (string, error) {
+	channel := s.config.Channel
+	if options.ConsumerGroup != "" {
+		channel = options.ConsumerGroup
+	}
+
+	if channel == "" {
+		return "", errors.New("missing NSQ channel, set SubscriberConfig.Channel or use message.WithConsumerGroup")
+	}
+	if !nsq.IsValidChannelName(channel) {
+		return "", errors.Errorf("invalid channel name %s", channel)
+	}
+
+	return channel, nil
+}
+
+func (s *Subscriber) newConsumer(topic string, channel string, config *nsq.Config) (*nsq.Consumer, error) {
+	consumer, err := nsq.NewConsumer(topic, channel, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create NSQ consumer")
+	}
+	consumer.SetLogger(nsqLogger{s.logger}, nsq.LogLevelInfo)
+
+	return consumer, nil
+}
+
+func (s *Subscriber) connect(consumer *nsq.Consumer) error {
+	if len(s.config.NsqdAddrs) > 0 {
+		if err := consumer.ConnectToNSQDs(s.config.NsqdAddrs); err != nil {
+			return errors.Wrap(err, "cannot connect to nsqd")
+		}
+	}
+	if len(s.config.NsqLookupdAddrs) > 0 {
+		if err := consumer.ConnectToNSQLookupds(s.config.NsqLookupdAddrs); err != nil {
+			return errors.Wrap(err, "cannot connect to nsqlookupd")
+		}
+	}
+
+	return nil
+}
+
+// handleMessage sends the message to the output and waits for the ack, so the messages of a subscription
+// are processed one by one.
+func (s *Subscriber) handleMessage(
+	ctx context.Context,
+	nsqMsg *nsq.Message,
+	output chan *message.Message,
+	logFields watermill.LogFields,
+) {
+	nsqMsg.DisableAutoResponse()
+
+	msg, err := s.config.Unmarshaler.Unmarshal(nsqMsg)
+	if err != nil {
+		// the message is discarded by the consumer after NsqConfig.MaxAttempts
+		s.logger.Error("Cannot unmarshal message", err, logFields)
+		nsqMsg.RequeueWithoutBackoff(s.config.RequeueDelay)
+		return
+	}
+
+	ctx, cancelCtx := context.WithCancel(ctx)
+	msg.SetContext(ctx)
+	defer cancelCtx()
+
+	messageLogFields := logFields.Add(watermill.LogFields{"message_uuid": msg.UUID})
+	s.logger.Trace("Received message", messageLogFields)
+
+	// the message is touched also while it waits for the consumer, which may be busy with other messages
+	touch := time.NewTicker(s.config.TouchInterval)
+	defer touch.Stop()
+
+SendLoop:
+	for {
+		select {
+		case output <- msg:
+			s.logger.Trace("Message sent to consumer", messageLogFields)
+			break SendLoop
+		case <-touch.C:
+			nsqMsg.Touch()
+		case <-s.closing:
+			s.logger.Trace("Closing, message requeued", messageLogFields)
+			nsqMsg.RequeueWithoutBackoff(0)
+			return
+		case <-ctx.Done():
+			s.logger.Trace("Context cancelled, message requeued", messageLogFields)
+			nsqMsg.RequeueWithoutBackoff(0)
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-msg.Acked():
+			nsqMsg.Finish()
+			s.logger.Trace("Message acked", messageLogFields)
+			return
+		case <-msg.Nacked():
+			nsqMsg.RequeueWithoutBackoff(s.config.RequeueDelay)
+			s.logger.Trace("Message nacked, requeued", messageLogFields)
+			return
+		case <-touch.C:
+			nsqMsg.Touch()
+			s.logger.Trace("Message touched", messageLogFields)
+		case <-s.closing:
+			s.logger.Trace("Closing, message requeued before ack", messageLogFields)
+			nsqMsg.RequeueWithoutBackoff(0)
+			return
+		case <-ctx.Done():
+			s.logger.Trace("Context cancelled, message requeued before ack", messageLogFields)
+			nsqMsg.RequeueWithoutBackoff(0)
+			return
+		}
+	}
+}
+
+func (s *Subscriber) Close() error {
+	s.closedLock.Lock()
+	if s.closed {
+		s.closedLock.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.closing)
+	s.closedLock.Unlock()
+
+	if timeouted := internalSync.WaitGroupTimeout(&s.subscribersWg, s.config.CloseTimeout); timeouted {
+		return errors.New("subscriptions not stopped within CloseTimeout")
+	}
+
+	s.logger.Debug("NSQ subscriber closed", nil)
+
+	return nil
+}
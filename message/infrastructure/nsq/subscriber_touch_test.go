@@ -0,0 +1,67 @@
+package nsq
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nsqio/go-nsq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type countingDelegate struct {
+	finished int64
+	touched  int64
+}
+
+func (d *countingDelegate) OnFinish(*nsq.Message)                       { atomic.AddInt64(&d.finished, 1) }
+func (d *countingDelegate) OnRequeue(*nsq.Message, time.Duration, bool) {}
+func (d *countingDelegate) OnTouch(*nsq.Message)                        { atomic.AddInt64(&d.touched, 1) }
+
+func TestSubscriber_handleMessage_touches_message_until_ack(t *testing.T) {
+	marshaler := EnvelopeMarshaler{}
+
+	s := &Subscriber{
+		config: SubscriberConfig{
+			TouchInterval: time.Millisecond * 10,
+			Unmarshaler:   marshaler,
+		},
+		logger:  watermill.NopLogger{},
+		closing: make(chan struct{}),
+	}
+
+	body, err := marshaler.Marshal("topic", message.NewMessage(watermill.NewUUID(), []byte("payload")))
+	require.NoError(t, err)
+
+	delegate := &countingDelegate{}
+	var id nsq.MessageID
+	copy(id[:], "0123456789abcdef")
+	nsqMsg := nsq.NewMessage(id, body)
+	nsqMsg.Delegate = delegate
+
+	output := make(chan *message.Message)
+	handled := make(chan struct{})
+	go func() {
+		s.handleMessage(context.Background(), nsqMsg, output, watermill.LogFields{})
+		close(handled)
+	}()
+
+	msg := <-output
+	// handling takes longer than a few touch intervals
+	time.Sleep(time.Millisecond * 100)
+	msg.Ack()
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("message not handled")
+	}
+
+	assert.True(t, atomic.LoadInt64(&delegate.touched) >= 2, "message should be touched while it's handled")
+	assert.EqualValues(t, 1, atomic.LoadInt64(&delegate.finished))
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
 )
 
 var closedchan = make(chan struct{})
@@ -37,6 +39,7 @@ type Message struct {
 
 	ackMutex    sync.Mutex
 	ackSentType ackType
+	ackToken    AckToken
 
 	ctx context.Context
 }
@@ -51,6 +54,12 @@ func NewMessage(uuid string, payload Payload) *Message {
 	}
 }
 
+// NewMessageWithGeneratedUUID creates the message with the UUID generated by watermill.NewMessageUUID,
+// so the format of UUIDs can be configured globally with watermill.SetMessageUUIDGenerator.
+func NewMessageWithGeneratedUUID(payload Payload) *Message {
+	return NewMessage(watermill.NewMessageUUID(), payload)
+}
+
 type ackType int
 
 const (
@@ -172,9 +181,20 @@ func (m *Message) SetContext(ctx context.Context) {
 }
 
 // Copy copies all message without Acks/Nacks.
+// The payload and the metadata are copied as well, so the copy can be modified
+// without affecting the original message (and other copies).
 // The context is not propagated to the copy.
 func (m *Message) Copy() *Message {
-	msg := NewMessage(m.UUID, m.Payload)
-	msg.Metadata = m.Metadata
+	var payload Payload
+	if m.Payload != nil {
+		payload = make(Payload, len(m.Payload))
+		copy(payload, m.Payload)
+	}
+
+	msg := NewMessage(m.UUID, payload)
+	for k, v := range m.Metadata {
+		msg.Metadata.Set(k, v)
+	}
+
 	return msg
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 )
 
@@ -113,6 +114,18 @@ func TestMessage_Copy(t *testing.T) {
 	assert.True(t, msg.Equals(msgCopy))
 }
 
+func TestMessage_Copy_is_independent(t *testing.T) {
+	msg := message.NewMessage("1", []byte("foo"))
+	msg.Metadata.Set("key", "value")
+
+	msgCopy := msg.Copy()
+	msgCopy.Metadata.Set("key", "changed")
+	msgCopy.Payload[0] = 'b'
+
+	assert.Equal(t, "value", msg.Metadata.Get("key"))
+	assert.Equal(t, "foo", string(msg.Payload))
+}
+
 func assertAcked(t *testing.T, msg *message.Message) {
 	select {
 	case <-msg.Acked():
@@ -148,3 +161,13 @@ func assertNoNack(t *testing.T, msg *message.Message) {
 		// ok
 	}
 }
+
+func TestNewMessageWithGeneratedUUID(t *testing.T) {
+	defer watermill.SetMessageUUIDGenerator(watermill.NewUUID)
+	watermill.SetMessageUUIDGenerator(watermill.NewSequentialUUIDGenerator("msg"))
+
+	msg := message.NewMessageWithGeneratedUUID(message.Payload("payload"))
+
+	assert.Equal(t, "msg-00000000000000000001", msg.UUID)
+	assert.Equal(t, message.Payload("payload"), msg.Payload)
+}
@@ -0,0 +1,42 @@
+package message
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrPublishResultsNotSupported happens when PublishWithResults is called with a Publisher,
+// which doesn't implement ResultsPublisher.
+var ErrPublishResultsNotSupported = errors.New("publisher doesn't support publish results")
+
+// PublishResult is the result of publishing a single message.
+type PublishResult struct {
+	// MessageUUID is the UUID of the published message.
+	MessageUUID string
+
+	// BrokerMessageID is the ID assigned to the message by the broker,
+	// for example the Kafka partition and offset, the Google Cloud Pub/Sub message ID or the NATS Streaming GUID.
+	BrokerMessageID string
+
+	// Details contains broker specific details of the published message.
+	Details map[string]string
+}
+
+type ResultsPublisher interface {
+	// PublishWithResults works like Publish, but it returns a result for every published message.
+	//
+	// When publishing of one of messages fails, results of the messages published before are returned with the error.
+	PublishWithResults(topic string, messages ...*Message) ([]PublishResult, error)
+}
+
+// PublishWithResults publishes messages with the publisher and returns per-message results.
+//
+// When the publisher doesn't implement ResultsPublisher, ErrPublishResultsNotSupported is returned
+// and no messages are published.
+func PublishWithResults(pub Publisher, topic string, messages ...*Message) ([]PublishResult, error) {
+	resultsPublisher, ok := pub.(ResultsPublisher)
+	if !ok {
+		return nil, ErrPublishResultsNotSupported
+	}
+
+	return resultsPublisher.PublishWithResults(topic, messages...)
+}
@@ -0,0 +1,46 @@
+package message_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type resultsMockPublisher struct {
+	nopPublisher
+}
+
+func (resultsMockPublisher) PublishWithResults(topic string, messages ...*message.Message) ([]message.PublishResult, error) {
+	var results []message.PublishResult
+	for i, msg := range messages {
+		results = append(results, message.PublishResult{
+			MessageUUID:     msg.UUID,
+			BrokerMessageID: topic + "_" + string(rune('a'+i)),
+		})
+	}
+
+	return results, nil
+}
+
+func TestPublishWithResults(t *testing.T) {
+	results, err := message.PublishWithResults(
+		resultsMockPublisher{},
+		"topic",
+		message.NewMessage("1", nil),
+		message.NewMessage("2", nil),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []message.PublishResult{
+		{MessageUUID: "1", BrokerMessageID: "topic_a"},
+		{MessageUUID: "2", BrokerMessageID: "topic_b"},
+	}, results)
+}
+
+func TestPublishWithResults_not_supported(t *testing.T) {
+	_, err := message.PublishWithResults(nopPublisher{}, "topic", message.NewMessage("1", nil))
+	assert.Equal(t, message.ErrPublishResultsNotSupported, err)
+}
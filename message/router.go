@@ -21,8 +21,9 @@ var (
 
 // HandlerFunc is function called when message is received.
 //
-// msg.Ack() is called automatically when HandlerFunc doesn't return error.
-// When HandlerFunc returns error, msg.Nack() is called.
+// msg.Ack() is called automatically when HandlerFunc doesn't return error (see Handler.SetAckMode to change it).
+// When HandlerFunc returns error, msg.Nack() is called, unless the ErrorHandler decides otherwise
+// (see Router.SetErrorHandler).
 // When msg.Ack() was called in handler and HandlerFunc returns error,
 // msg.Nack() will be not sent because Ack was already sent.
 //
@@ -60,15 +61,38 @@ type SubscriberDecorator func(sub Subscriber) (Subscriber, error)
 type RouterConfig struct {
 	// CloseTimeout determines how long router should work for handlers when closing.
 	CloseTimeout time.Duration
+
+	// Authorizer is optional. When set, it's called for the subscribe and the publish topic of every handler,
+	// when the router is started. When access to any topic is denied, the router is not started.
+	// Topics chosen with SendTo are authorized before the produced messages are published.
+	Authorizer Authorizer
+
+	// StartupTimeout limits how long the router waits for handlers started after other handlers
+	// (see Handler.StartAfter and Handler.StartWhen). When exceeded, Run returns ErrStartupTimeout.
+	// When 0, the router waits without a limit.
+	StartupTimeout time.Duration
+
+	// ReadinessCheckInterval is how often readiness predicates are checked during the startup. Defaults to 100ms.
+	ReadinessCheckInterval time.Duration
 }
 
 func (c *RouterConfig) setDefaults() {
 	if c.CloseTimeout == 0 {
 		c.CloseTimeout = time.Second * 30
 	}
+	if c.ReadinessCheckInterval == 0 {
+		c.ReadinessCheckInterval = time.Millisecond * 100
+	}
 }
 
 func (c RouterConfig) Validate() error {
+	if c.StartupTimeout < 0 {
+		return errors.New("StartupTimeout cannot be negative")
+	}
+	if c.ReadinessCheckInterval < 0 {
+		return errors.New("ReadinessCheckInterval cannot be negative")
+	}
+
 	return nil
 }
 
@@ -116,6 +140,10 @@ type Router struct {
 	publisherDecorators  []PublisherDecorator
 	subscriberDecorators []SubscriberDecorator
 
+	errorHandler        ErrorHandler
+	deadLetterPublisher Publisher
+	deadLetterTopic     string
+
 	isRunning bool
 	running   chan struct{}
 }
@@ -170,9 +198,8 @@ func (d DuplicateHandlerNameError) Error() string {
 // subscribeTopic is a topic from which handler will receive messages.
 //
 // publishTopic is a topic to which router will produce messages returned by handlerFunc.
-// When handler needs to publish to multiple topics,
-// it is recommended to just inject Publisher to Handler or implement middleware
-// which will catch messages and publish to topic based on metadata for example.
+// When handler needs to publish to multiple topics, it can mark the returned messages with SendTo.
+// publishTopic can be empty, when all returned messages are marked with SendTo.
 //
 // pubSub is PubSub from which messages will be consumed and to which created messages will be published.
 // If you have separated Publisher and Subscriber object,
@@ -184,7 +211,7 @@ func (r *Router) AddHandler(
 	publishTopic string,
 	publisher Publisher,
 	handlerFunc HandlerFunc,
-) {
+) *Handler {
 	r.logger.Info("Adding handler", watermill.LogFields{
 		"handler_name": handlerName,
 		"topic":        subscribeTopic,
@@ -196,7 +223,7 @@ func (r *Router) AddHandler(
 
 	publisherName, subscriberName := internal.StructName(publisher), internal.StructName(subscriber)
 
-	r.handlers[handlerName] = &handler{
+	newHandler := &handler{
 		name:   handlerName,
 		logger: r.logger,
 
@@ -208,11 +235,28 @@ func (r *Router) AddHandler(
 		publishTopic:  publishTopic,
 		publisherName: publisherName,
 
+		authorizer: r.config.Authorizer,
+
 		handlerFunc:       handlerFunc,
 		runningHandlersWg: r.runningHandlersWg,
 		messagesCh:        nil,
 		closeCh:           r.closeCh,
 	}
+	r.handlers[handlerName] = newHandler
+
+	return &Handler{
+		router:  r,
+		handler: newHandler,
+	}
+}
+
+// Handler is a handler added to the Router by AddHandler or AddNoPublisherHandler.
+// It can be used to change the settings of a single handler.
+//
+// Handler's settings should be changed before the Router is started.
+type Handler struct {
+	router  *Router
+	handler *handler
 }
 
 // AddNoPublisherHandler adds a new handler.
@@ -229,8 +273,8 @@ func (r *Router) AddNoPublisherHandler(
 	subscribeTopic string,
 	subscriber Subscriber,
 	handlerFunc HandlerFunc,
-) {
-	r.AddHandler(handlerName, subscribeTopic, subscriber, "", disabledPublisher{}, handlerFunc)
+) *Handler {
+	return r.AddHandler(handlerName, subscribeTopic, subscriber, "", disabledPublisher{}, handlerFunc)
 }
 
 // Run runs all plugins and handlers and starts subscribing to provided topics.
@@ -252,6 +296,10 @@ func (r *Router) Run() (err error) {
 		}
 	}()
 
+	if err := r.authorizeHandlers(); err != nil {
+		return errors.Wrap(err, "handlers authorization failed")
+	}
+
 	r.logger.Debug("Loading plugins", nil)
 	for _, plugin := range r.plugins {
 		if err := plugin(r); err != nil {
@@ -270,6 +318,68 @@ func (r *Router) Run() (err error) {
 	}
 
 	for _, h := range r.handlers {
+		if h.errorHandler == nil {
+			h.errorHandler = r.errorHandler
+		}
+		h.deadLetterPublisher = r.deadLetterPublisher
+		h.deadLetterTopic = r.deadLetterTopic
+	}
+
+	phases, err := r.startupPhases()
+	if err != nil {
+		return errors.Wrap(err, "invalid startup order of handlers")
+	}
+
+	startupCtx, cancelStartup := r.startupContext()
+	defer cancelStartup()
+
+	for i, phase := range phases {
+		if i > 0 {
+			r.logger.Info("Starting next phase of handlers", watermill.LogFields{
+				"phase": i,
+			})
+		}
+
+		if err := r.waitForPhase(startupCtx, phase); err != nil {
+			if errors.Cause(err) == errClosedDuringStartup {
+				<-r.closedCh
+				return nil
+			}
+
+			if i > 0 {
+				r.closeAfterFailedStartup()
+			}
+			return err
+		}
+
+		if err := r.startHandlers(phase); err != nil {
+			if i > 0 {
+				r.closeAfterFailedStartup()
+			}
+			return err
+		}
+	}
+
+	close(r.running)
+
+	go r.closeWhenAllHandlersStopped()
+
+	<-r.closeCh
+
+	r.logger.Info("Waiting for messages", watermill.LogFields{
+		"timeout": r.config.CloseTimeout,
+	})
+
+	<-r.closedCh
+
+	r.logger.Info("All messages processed", nil)
+
+	return nil
+}
+
+// startHandlers subscribes to topics of the handlers and runs them.
+func (r *Router) startHandlers(handlers []*handler) error {
+	for _, h := range handlers {
 		r.logger.Debug("Subscribing to topic", watermill.LogFields{
 			"subscriber_name": h.name,
 			"topic":           h.subscribeTopic,
@@ -281,10 +391,14 @@ func (r *Router) Run() (err error) {
 		}
 
 		h.messagesCh = messages
+
+		if h.idleTracker != nil {
+			h.idleTracker.start()
+		}
 	}
 
-	for i := range r.handlers {
-		handler := r.handlers[i]
+	for i := range handlers {
+		handler := handlers[i]
 
 		r.handlersWg.Add(1)
 
@@ -299,23 +413,16 @@ func (r *Router) Run() (err error) {
 		}()
 	}
 
-	close(r.running)
-
-	go r.closeWhenAllHandlersStopped()
-
-	<-r.closeCh
-
-	r.logger.Info("Waiting for messages", watermill.LogFields{
-		"timeout": r.config.CloseTimeout,
-	})
-
-	<-r.closedCh
-
-	r.logger.Info("All messages processed", nil)
-
 	return nil
 }
 
+// closeAfterFailedStartup closes handlers started in the previous startup phases.
+func (r *Router) closeAfterFailedStartup() {
+	if err := r.Close(); err != nil {
+		r.logger.Error("Cannot close router after failed startup", err, nil)
+	}
+}
+
 // closeWhenAllHandlersStopped closed router, when all handlers has stopped,
 // because for example all subscriptions are closed.
 func (r *Router) closeWhenAllHandlersStopped() {
@@ -374,8 +481,26 @@ type handler struct {
 	publishTopic  string
 	publisherName string
 
+	authorizer Authorizer
+
 	handlerFunc HandlerFunc
 
+	orderingKey          OrderingKeyFunc
+	orderingWorkersCount int
+
+	copyMessages bool
+
+	ackMode AckMode
+
+	errorHandler        ErrorHandler
+	deadLetterPublisher Publisher
+	deadLetterTopic     string
+
+	startAfter  []string
+	startWhen   []ReadinessPredicate
+	readiness   ReadinessPredicate
+	idleTracker *idleTracker
+
 	runningHandlersWg *sync.WaitGroup
 
 	messagesCh <-chan *Message
@@ -398,11 +523,33 @@ func (h *handler) run(middlewares []HandlerMiddleware) {
 
 	go h.handleClose()
 
+	var workers *orderedWorkers
+	if h.orderingKey != nil {
+		workers = newOrderedWorkers(h.orderingWorkersCount, func(msg *Message) {
+			h.handleMessage(msg, middlewareHandler)
+		})
+	}
+
 	for msg := range h.messagesCh {
 		h.runningHandlersWg.Add(1)
+		if h.idleTracker != nil {
+			h.idleTracker.received()
+		}
+
+		if workers != nil {
+			if key := h.orderingKey(msg); key != "" {
+				workers.dispatch(key, msg)
+				continue
+			}
+		}
+
 		go h.handleMessage(msg, middlewareHandler)
 	}
 
+	if workers != nil {
+		workers.close()
+	}
+
 	if h.publisher != nil {
 		h.logger.Debug("Waiting for publisher to close", nil)
 		if err := h.publisher.Close(); err != nil {
@@ -436,6 +583,11 @@ func (r *Router) decorateHandlerSubscriber(h *handler) error {
 	var err error
 	sub := h.subscriber
 
+	if h.copyMessages {
+		// copies are created before the context is changed, so the original message is not modified at all
+		sub = newCopyMessagesSubscriberDecorator(sub)
+	}
+
 	// add values to message context to subscriber
 	// it goes before other decorators, so that they may take advantage of these values
 	messageTransform := func(msg *Message) {
@@ -472,6 +624,9 @@ func (h *handler) addHandlerContext(messages ...*Message) {
 		if h.subscriberName != "" {
 			ctx = context.WithValue(ctx, subscriberNameKey, h.subscriberName)
 		}
+		if h.subscribeTopic != "" {
+			ctx = context.WithValue(ctx, subscribeTopicKey, h.subscribeTopic)
+		}
 		messages[i].SetContext(ctx)
 	}
 }
@@ -490,6 +645,9 @@ func (h *handler) handleClose() {
 
 func (h *handler) handleMessage(msg *Message, handler HandlerFunc) {
 	defer h.runningHandlersWg.Done()
+	if h.idleTracker != nil {
+		defer h.idleTracker.processed()
+	}
 	msgFields := watermill.LogFields{"message_uuid": msg.UUID}
 
 	defer func() {
@@ -499,17 +657,29 @@ func (h *handler) handleMessage(msg *Message, handler HandlerFunc) {
 			return
 		}
 
+		if h.ackMode == AckManual {
+			return
+		}
+
 		msg.Ack()
 		h.logger.Trace("Message acked", msgFields)
 	}()
 
 	h.logger.Trace("Received message", msgFields)
 
+	if h.ackMode == AckOnReceive {
+		msg.Ack()
+		h.logger.Trace("Message acked on receive", msgFields)
+	}
+
 	producedMessages, err := handler(msg)
-	if err != nil {
-		h.logger.Error("Handler returned error", err, nil)
-		msg.Nack()
-		return
+	for err != nil {
+		if retry := h.handleError(msg, err, msgFields); !retry {
+			return
+		}
+
+		h.logger.Trace("Retrying handler", msgFields)
+		producedMessages, err = handler(msg)
 	}
 
 	h.addHandlerContext(producedMessages...)
@@ -528,16 +698,18 @@ func (h *handler) publishProducedMessages(producedMessages Messages, msgFields w
 		return nil
 	}
 
-	if h.publishTopic == "" {
-		return ErrOutputInNoPublisherHandler
+	// topics are resolved before publishing, so nothing is published when any message has no topic
+	topics, err := h.destinationTopics(producedMessages)
+	if err != nil {
+		return err
 	}
 
 	h.logger.Trace("Sending produced messages", msgFields.Add(watermill.LogFields{
 		"produced_messages_count": len(producedMessages),
 	}))
 
-	for _, msg := range producedMessages {
-		if err := h.publisher.Publish(h.publishTopic, msg); err != nil {
+	for i, msg := range producedMessages {
+		if err := h.publisher.Publish(topics[i], msg); err != nil {
 			// todo - how to deal with it better/transactional/retry?
 			h.logger.Error("Cannot publish message", err, msgFields.Add(watermill.LogFields{
 				"not_sent_message": fmt.Sprintf("%#v", producedMessages),
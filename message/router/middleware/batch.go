@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// BatchHandlerFunc handles a batch of messages at once, for example with a bulk database insert.
+// Messages returned by BatchHandlerFunc are published by the router.
+type BatchHandlerFunc func(msgs []*message.Message) ([]*message.Message, error)
+
+// Batch creates a HandlerFunc, which collects up to maxSize messages or messages received within maxWait
+// and calls h once with the whole batch.
+// When h returns an error, all messages of the batch are nacked, otherwise all of them are acked.
+//
+// Messages are collected from concurrently handled messages, so Batch is useful only with subscribers
+// which deliver multiple messages without waiting for ack of the previous one
+// (for example Google Cloud Pub/Sub or NATS Streaming with MaxInflight greater than 1).
+// For subscribers which wait for ack, every batch will contain a single message, delivered after maxWait.
+func Batch(maxSize int, maxWait time.Duration, h BatchHandlerFunc) message.HandlerFunc {
+	if maxSize <= 0 {
+		panic("maxSize must be greater than 0")
+	}
+
+	b := &batcher{
+		maxSize: maxSize,
+		maxWait: maxWait,
+		h:       h,
+	}
+
+	return b.handle
+}
+
+type batcher struct {
+	maxSize int
+	maxWait time.Duration
+	h       BatchHandlerFunc
+
+	current     *batch
+	currentLock sync.Mutex
+}
+
+type batch struct {
+	msgs    []*message.Message
+	timer   *time.Timer
+	flushed bool
+
+	done     chan struct{}
+	produced []*message.Message
+	err      error
+}
+
+func (b *batcher) handle(msg *message.Message) ([]*message.Message, error) {
+	b.currentLock.Lock()
+	if b.current == nil {
+		newBatch := &batch{done: make(chan struct{})}
+		newBatch.timer = time.AfterFunc(b.maxWait, func() { b.flush(newBatch) })
+		b.current = newBatch
+	}
+	currentBatch := b.current
+
+	currentBatch.msgs = append(currentBatch.msgs, msg)
+	first := len(currentBatch.msgs) == 1
+	full := len(currentBatch.msgs) >= b.maxSize
+	b.currentLock.Unlock()
+
+	if full {
+		b.flush(currentBatch)
+	}
+	<-currentBatch.done
+
+	// produced messages are returned only once, so they are not published multiple times
+	if first {
+		return currentBatch.produced, currentBatch.err
+	}
+	return nil, currentBatch.err
+}
+
+func (b *batcher) flush(batchToFlush *batch) {
+	b.currentLock.Lock()
+	if batchToFlush.flushed {
+		b.currentLock.Unlock()
+		return
+	}
+	batchToFlush.flushed = true
+	batchToFlush.timer.Stop()
+	if b.current == batchToFlush {
+		b.current = nil
+	}
+	b.currentLock.Unlock()
+
+	defer close(batchToFlush.done)
+	defer func() {
+		// flush may be called by the timer, outside of the handler's goroutine
+		if r := recover(); r != nil {
+			batchToFlush.err = errors.WithStack(RecoveredPanicError{V: r, Stacktrace: string(debug.Stack())})
+		}
+	}()
+
+	batchToFlush.produced, batchToFlush.err = b.h(batchToFlush.msgs)
+}
@@ -0,0 +1,91 @@
+package middleware_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+type batchResult struct {
+	produced []*message.Message
+	err      error
+}
+
+func handleConcurrently(h message.HandlerFunc, count int) []batchResult {
+	results := make([]batchResult, count)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			produced, err := h(message.NewMessage(fmt.Sprintf("%d", i), nil))
+			results[i] = batchResult{produced, err}
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func TestBatch_max_size(t *testing.T) {
+	var batchSizes []int
+	lock := sync.Mutex{}
+
+	h := middleware.Batch(5, time.Hour, func(msgs []*message.Message) ([]*message.Message, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		batchSizes = append(batchSizes, len(msgs))
+		return []*message.Message{message.NewMessage("produced", nil)}, nil
+	})
+
+	results := handleConcurrently(h, 10)
+
+	assert.Equal(t, []int{5, 5}, batchSizes)
+
+	producedCount := 0
+	for _, result := range results {
+		assert.NoError(t, result.err)
+		producedCount += len(result.produced)
+	}
+	assert.Equal(t, 2, producedCount, "produced messages should be returned once per batch")
+}
+
+func TestBatch_max_wait(t *testing.T) {
+	handled := make(chan int, 1)
+
+	h := middleware.Batch(100, time.Millisecond*50, func(msgs []*message.Message) ([]*message.Message, error) {
+		handled <- len(msgs)
+		return nil, nil
+	})
+
+	handleConcurrently(h, 3)
+
+	assert.Equal(t, 3, <-handled)
+}
+
+func TestBatch_error(t *testing.T) {
+	h := middleware.Batch(3, time.Hour, func(msgs []*message.Message) ([]*message.Message, error) {
+		return nil, errFailed
+	})
+
+	for _, result := range handleConcurrently(h, 3) {
+		assert.Equal(t, errFailed, result.err)
+	}
+}
+
+func TestBatch_panic(t *testing.T) {
+	h := middleware.Batch(1, time.Hour, func(msgs []*message.Message) ([]*message.Message, error) {
+		panic("batch panic")
+	})
+
+	_, err := h(message.NewMessage("1", nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+var (
+	// ErrChaosFailure is returned by the Chaos middleware after the message was handled,
+	// to simulate a lost ack.
+	ErrChaosFailure = errors.New("chaos failure injected")
+	// ErrChaosReorder is returned by the Chaos middleware before the message is handled,
+	// so the message is redelivered later, after the messages following it.
+	ErrChaosReorder = errors.New("chaos reorder injected")
+)
+
+type ChaosConfig struct {
+	// Enabled must be set to true to inject any chaos. When false, the middleware does nothing,
+	// so it's safe to keep it in the code and enable it only in staging environments.
+	Enabled bool
+
+	// DelayProbability is the probability (from 0 to 1) that handling of the message is delayed by up to MaxDelay.
+	DelayProbability float64
+	MaxDelay         time.Duration
+
+	// DuplicateProbability is the probability (from 0 to 1) that the message is handled twice,
+	// like when it's delivered twice by the Pub/Sub.
+	DuplicateProbability float64
+
+	// ReorderProbability is the probability (from 0 to 1) that the message is nacked before handling
+	// with ErrChaosReorder, so it's redelivered after the following messages.
+	ReorderProbability float64
+
+	// FailProbability is the probability (from 0 to 1) that ErrChaosFailure is returned,
+	// after the message was handled successfully. The message is redelivered, like when the ack is lost.
+	FailProbability float64
+
+	// RandSource is used to draw the probabilities. Use a source with a fixed seed for repeatable runs.
+	// Defaults to a source seeded with the current time.
+	RandSource rand.Source
+}
+
+func (c *ChaosConfig) setDefaults() {
+	if c.RandSource == nil {
+		c.RandSource = rand.NewSource(time.Now().UnixNano())
+	}
+}
+
+func (c ChaosConfig) validate() error {
+	for name, p := range map[string]float64{
+		"DelayProbability":     c.DelayProbability,
+		"DuplicateProbability": c.DuplicateProbability,
+		"ReorderProbability":   c.ReorderProbability,
+		"FailProbability":      c.FailProbability,
+	} {
+		if p < 0 || p > 1 {
+			return errors.Errorf("%s must be in [0, 1] range, got %f", name, p)
+		}
+	}
+	if c.DelayProbability > 0 && c.MaxDelay <= 0 {
+		return errors.New("MaxDelay must be positive, when DelayProbability is set")
+	}
+
+	return nil
+}
+
+// Chaos returns a middleware, which randomly delays, duplicates, reorders or fails messages.
+// It allows checking if handlers are really idempotent and safe to retry.
+//
+// Chaos does nothing unless ChaosConfig.Enabled is true.
+func Chaos(config ChaosConfig) (message.HandlerMiddleware, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Chaos config")
+	}
+
+	random := &lockedRand{rand: rand.New(config.RandSource)}
+
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		if !config.Enabled {
+			return h
+		}
+
+		return func(msg *message.Message) ([]*message.Message, error) {
+			if random.chance(config.ReorderProbability) {
+				return nil, ErrChaosReorder
+			}
+
+			if random.chance(config.DelayProbability) {
+				select {
+				case <-time.After(random.duration(config.MaxDelay)):
+				case <-msg.Context().Done():
+					return nil, msg.Context().Err()
+				}
+			}
+
+			producedMessages, err := h(msg)
+			if err != nil {
+				return producedMessages, err
+			}
+
+			if random.chance(config.DuplicateProbability) {
+				duplicateProducedMessages, err := h(msg.Copy())
+				if err != nil {
+					return nil, err
+				}
+				producedMessages = append(producedMessages, duplicateProducedMessages...)
+			}
+
+			if random.chance(config.FailProbability) {
+				return nil, ErrChaosFailure
+			}
+
+			return producedMessages, nil
+		}
+	}, nil
+}
+
+// lockedRand is safe for concurrent use by multiple handlers.
+type lockedRand struct {
+	rand *rand.Rand
+	lock sync.Mutex
+}
+
+func (r *lockedRand) chance(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.rand.Float64() < probability
+}
+
+func (r *lockedRand) duration(max time.Duration) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return time.Duration(r.rand.Int63n(int64(max) + 1))
+}
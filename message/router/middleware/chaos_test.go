@@ -0,0 +1,134 @@
+package middleware_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+func TestChaos_disabled(t *testing.T) {
+	chaos, err := middleware.Chaos(middleware.ChaosConfig{
+		Enabled:         false,
+		FailProbability: 1,
+	})
+	require.NoError(t, err)
+
+	calls := 0
+	h := chaos(func(msg *message.Message) ([]*message.Message, error) {
+		calls++
+		return nil, nil
+	})
+
+	for i := 0; i < 10; i++ {
+		_, err := h(message.NewMessage("1", nil))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 10, calls)
+}
+
+func TestChaos_fail(t *testing.T) {
+	chaos, err := middleware.Chaos(middleware.ChaosConfig{
+		Enabled:         true,
+		FailProbability: 1,
+	})
+	require.NoError(t, err)
+
+	calls := 0
+	_, err = chaos(func(msg *message.Message) ([]*message.Message, error) {
+		calls++
+		return nil, nil
+	})(message.NewMessage("1", nil))
+
+	assert.Equal(t, middleware.ErrChaosFailure, err)
+	assert.Equal(t, 1, calls, "message should be handled before failing")
+}
+
+func TestChaos_reorder(t *testing.T) {
+	chaos, err := middleware.Chaos(middleware.ChaosConfig{
+		Enabled:            true,
+		ReorderProbability: 1,
+	})
+	require.NoError(t, err)
+
+	calls := 0
+	_, err = chaos(func(msg *message.Message) ([]*message.Message, error) {
+		calls++
+		return nil, nil
+	})(message.NewMessage("1", nil))
+
+	assert.Equal(t, middleware.ErrChaosReorder, err)
+	assert.Equal(t, 0, calls, "message should not be handled")
+}
+
+func TestChaos_duplicate(t *testing.T) {
+	chaos, err := middleware.Chaos(middleware.ChaosConfig{
+		Enabled:              true,
+		DuplicateProbability: 1,
+	})
+	require.NoError(t, err)
+
+	var handledUUIDs []string
+	produced, err := chaos(func(msg *message.Message) ([]*message.Message, error) {
+		handledUUIDs = append(handledUUIDs, msg.UUID)
+		return []*message.Message{message.NewMessage("produced", nil)}, nil
+	})(message.NewMessage("1", nil))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "1"}, handledUUIDs)
+	assert.Len(t, produced, 2)
+}
+
+func TestChaos_delay(t *testing.T) {
+	chaos, err := middleware.Chaos(middleware.ChaosConfig{
+		Enabled:          true,
+		DelayProbability: 1,
+		MaxDelay:         time.Millisecond * 50,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = chaos(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	})(message.NewMessage("1", nil))
+	require.NoError(t, err)
+
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestChaos_deterministic(t *testing.T) {
+	run := func() []bool {
+		chaos, err := middleware.Chaos(middleware.ChaosConfig{
+			Enabled:         true,
+			FailProbability: 0.5,
+			RandSource:      rand.NewSource(42),
+		})
+		require.NoError(t, err)
+
+		h := chaos(func(msg *message.Message) ([]*message.Message, error) {
+			return nil, nil
+		})
+
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			_, err := h(message.NewMessage("1", nil))
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	assert.Equal(t, run(), run())
+}
+
+func TestChaos_invalid_config(t *testing.T) {
+	_, err := middleware.Chaos(middleware.ChaosConfig{FailProbability: 1.5})
+	assert.Error(t, err)
+
+	_, err = middleware.Chaos(middleware.ChaosConfig{DelayProbability: 0.5})
+	assert.Error(t, err)
+}
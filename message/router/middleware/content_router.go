@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// ErrMissingRoutingValue happens when the message doesn't contain a value required by the topic template.
+var ErrMissingRoutingValue = errors.New("missing routing value")
+
+// RoutingValuesExtractor extracts values from the message, which are used to fill the topic template.
+type RoutingValuesExtractor func(msg *message.Message) (map[string]string, error)
+
+var topicTemplatePlaceholder = regexp.MustCompile(`{([^{}]+)}`)
+
+// RouteByMetadata provides a middleware which republishes messages to the topic derived from the message's metadata.
+//
+// The topicTemplate placeholder {key} is replaced with the value of the metadata key,
+// for example with key "country" and template "orders.{country}",
+// a message with "country" metadata equal to "pl" is published to "orders.pl".
+//
+// The wrapped handler is not called. The original message is acked only after it was successfully republished,
+// otherwise it is nacked.
+func RouteByMetadata(pub message.Publisher, key string, topicTemplate string) message.HandlerMiddleware {
+	return RouteByPayload(pub, func(msg *message.Message) (map[string]string, error) {
+		return map[string]string{key: msg.Metadata.Get(key)}, nil
+	}, topicTemplate)
+}
+
+// RouteByPayload works like RouteByMetadata, but values of the topicTemplate placeholders are provided by the extractor.
+// It allows to route messages based on the payload's content.
+func RouteByPayload(pub message.Publisher, extractor RoutingValuesExtractor, topicTemplate string) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			values, err := extractor(msg)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot extract routing values")
+			}
+
+			topic, err := renderTopicTemplate(topicTemplate, values)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := pub.Publish(topic, msg); err != nil {
+				return nil, errors.Wrapf(err, "cannot republish message to %s", topic)
+			}
+
+			return nil, nil
+		}
+	}
+}
+
+func renderTopicTemplate(topicTemplate string, values map[string]string) (string, error) {
+	var err error
+
+	topic := topicTemplatePlaceholder.ReplaceAllStringFunc(topicTemplate, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+
+		value := values[name]
+		if value == "" && err == nil {
+			err = errors.Wrap(ErrMissingRoutingValue, name)
+		}
+
+		return value
+	})
+
+	return topic, err
+}
@@ -0,0 +1,86 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+type topicsPublisher struct {
+	mockPublisher
+	topics []string
+}
+
+func (p *topicsPublisher) Publish(topic string, messages ...*message.Message) error {
+	if err := p.mockPublisher.Publish(topic, messages...); err != nil {
+		return err
+	}
+
+	p.topics = append(p.topics, topic)
+	return nil
+}
+
+func TestRouteByMetadata(t *testing.T) {
+	pub := &topicsPublisher{mockPublisher: mockPublisher{behaviour: BehaviourAlwaysOK}}
+
+	handlerCalled := false
+	h := middleware.RouteByMetadata(pub, "country", "orders.{country}")(func(msg *message.Message) ([]*message.Message, error) {
+		handlerCalled = true
+		return nil, nil
+	})
+
+	msg := message.NewMessage("1", nil)
+	msg.Metadata.Set("country", "pl")
+
+	produced, err := h(msg)
+	require.NoError(t, err)
+
+	assert.Empty(t, produced)
+	assert.False(t, handlerCalled)
+	assert.Equal(t, []string{"orders.pl"}, pub.topics)
+	assert.Equal(t, []*message.Message{msg}, pub.PopMessages())
+}
+
+func TestRouteByMetadata_missing_value(t *testing.T) {
+	pub := &topicsPublisher{mockPublisher: mockPublisher{behaviour: BehaviourAlwaysOK}}
+
+	_, err := middleware.RouteByMetadata(pub, "country", "orders.{country}")(handlerFuncAlwaysOK)(message.NewMessage("1", nil))
+	assert.Equal(t, middleware.ErrMissingRoutingValue, errors.Cause(err))
+	assert.Empty(t, pub.topics)
+}
+
+func TestRouteByMetadata_publish_failed(t *testing.T) {
+	pub := &topicsPublisher{mockPublisher: mockPublisher{behaviour: BehaviourAlwaysFail}}
+
+	msg := message.NewMessage("1", nil)
+	msg.Metadata.Set("country", "pl")
+
+	_, err := middleware.RouteByMetadata(pub, "country", "orders.{country}")(handlerFuncAlwaysOK)(msg)
+	assert.Equal(t, errFailed, errors.Cause(err))
+}
+
+func TestRouteByPayload(t *testing.T) {
+	pub := &topicsPublisher{mockPublisher: mockPublisher{behaviour: BehaviourAlwaysOK}}
+
+	extractor := func(msg *message.Message) (map[string]string, error) {
+		values := map[string]string{}
+		err := json.Unmarshal(msg.Payload, &values)
+		return values, err
+	}
+
+	h := middleware.RouteByPayload(pub, extractor, "{type}.{country}")(handlerFuncAlwaysOK)
+
+	_, err := h(message.NewMessage("1", []byte(`{"type": "orders", "country": "de"}`)))
+	require.NoError(t, err)
+
+	_, err = h(message.NewMessage("2", []byte(`not json`)))
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"orders.de"}, pub.topics)
+}
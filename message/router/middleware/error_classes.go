@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/backoff"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// ErrorClass is the class of the handler's error.
+type ErrorClass string
+
+const (
+	// ErrorClassValidation is the class of errors caused by invalid messages. Retrying them makes no sense.
+	ErrorClassValidation ErrorClass = "validation"
+	// ErrorClassTransient is the class of temporary errors, like timeouts.
+	ErrorClassTransient ErrorClass = "transient"
+	// ErrorClassDependency is the class of errors of external dependencies, like databases or other services.
+	ErrorClassDependency ErrorClass = "dependency"
+	// ErrorClassUnknown is the class of errors not matched by any rule.
+	ErrorClassUnknown ErrorClass = "unknown"
+)
+
+// ErrorClassMetadataKey is the metadata key with the class of the last handler's error.
+const ErrorClassMetadataKey = "error_class"
+
+// MetricHandlerErrors is the name of the counter of classified errors reported to ErrorClassesConfig.MetricsSink.
+const MetricHandlerErrors = "handler_errors_total"
+
+// ErrorCounterSink receives the MetricHandlerErrors counter.
+// It is implemented by metrics.MetricsSink, without making the middleware depend on the metrics package.
+type ErrorCounterSink interface {
+	IncCounter(name string, labels map[string]string)
+}
+
+// ErrorRule returns the class of the error, or false when the rule doesn't match the error.
+type ErrorRule func(err error) (ErrorClass, bool)
+
+// ErrorIs returns the rule matching the target error, also when it's wrapped with github.com/pkg/errors.
+func ErrorIs(target error, class ErrorClass) ErrorRule {
+	return func(err error) (ErrorClass, bool) {
+		return class, err == target || errors.Cause(err) == target
+	}
+}
+
+// ErrorMatches returns the rule matching errors for which match returns true.
+func ErrorMatches(match func(err error) bool, class ErrorClass) ErrorRule {
+	return func(err error) (ErrorClass, bool) {
+		return class, match(err)
+	}
+}
+
+// ErrorClassPolicy defines what to do with the messages, which failed with the error of the class.
+type ErrorClassPolicy struct {
+	// Retry is optional. When set, the handler is retried with the strategy, as long as it fails with the error
+	// of the same class. Attempts are counted from 1 again, when the class of the error changes.
+	Retry backoff.Strategy
+
+	// Topic is optional. When set, messages which still fail after the retries are published to the topic
+	// and acked. Otherwise, the error is returned, so the message is nacked.
+	Topic string
+}
+
+type ErrorClassesConfig struct {
+	// Rules classify the errors. The first matching rule wins. Errors not matched by any rule are ErrorClassUnknown.
+	Rules []ErrorRule
+
+	// Policies of the error classes. Errors of classes without the policy are returned as they are.
+	Policies map[ErrorClass]ErrorClassPolicy
+
+	// Publisher publishes the messages to the ErrorClassPolicy.Topic. Required, when any policy has a Topic.
+	Publisher message.Publisher
+
+	// MetricsSink is optional and receives the MetricHandlerErrors counter with the error class.
+	MetricsSink ErrorCounterSink
+
+	Logger watermill.LoggerAdapter
+}
+
+func (c *ErrorClassesConfig) setDefaults() {
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func (c ErrorClassesConfig) Validate() error {
+	for class, policy := range c.Policies {
+		if policy.Topic != "" && c.Publisher == nil {
+			return errors.Errorf("policy of %s errors has a Topic, but Publisher is missing", class)
+		}
+	}
+
+	return nil
+}
+
+// ErrorClasses returns the middleware, which classifies the handler's errors with the rules
+// and handles them according to the policy of the class.
+//
+// The class of the error is stored in the message's metadata under ErrorClassMetadataKey.
+func ErrorClasses(config ErrorClassesConfig) (message.HandlerMiddleware, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid ErrorClasses config")
+	}
+
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			attempt := 0
+			var previousClass ErrorClass
+
+			for {
+				producedMessages, err := h(msg)
+				if err == nil {
+					return producedMessages, nil
+				}
+
+				class := config.classify(err)
+				if class != previousClass {
+					attempt = 0
+					previousClass = class
+				}
+				attempt++
+
+				msg.Metadata.Set(ErrorClassMetadataKey, string(class))
+				config.reportError(msg, class)
+
+				policy, ok := config.Policies[class]
+				if !ok {
+					return nil, err
+				}
+
+				logFields := watermill.LogFields{
+					"message_uuid": msg.UUID,
+					"error_class":  class,
+					"attempt":      attempt,
+				}
+
+				if policy.Retry != nil {
+					retrying, waitErr := backoff.Wait(msg.Context(), policy.Retry, attempt)
+					if retrying && waitErr == nil {
+						config.Logger.Debug("Retrying handler", logFields.Add(watermill.LogFields{"err": err.Error()}))
+						continue
+					}
+				}
+
+				if policy.Topic == "" {
+					return nil, err
+				}
+
+				msg.Metadata.Set(message.DeadLetterReasonMetadataKey, err.Error())
+				if publishErr := config.Publisher.Publish(policy.Topic, msg); publishErr != nil {
+					config.Logger.Error("Cannot publish message to error class topic", publishErr, logFields)
+					return nil, err
+				}
+
+				config.Logger.Info("Message published to error class topic", logFields.Add(watermill.LogFields{
+					"topic": policy.Topic,
+					"err":   err.Error(),
+				}))
+
+				return nil, nil
+			}
+		}
+	}, nil
+}
+
+func (c ErrorClassesConfig) classify(err error) ErrorClass {
+	for _, rule := range c.Rules {
+		if class, ok := rule(err); ok {
+			return class
+		}
+	}
+
+	return ErrorClassUnknown
+}
+
+func (c ErrorClassesConfig) reportError(msg *message.Message, class ErrorClass) {
+	if c.MetricsSink == nil {
+		return
+	}
+
+	c.MetricsSink.IncCounter(MetricHandlerErrors, map[string]string{
+		"handler_name": message.HandlerNameFromCtx(msg.Context()),
+		"error_class":  string(class),
+	})
+}
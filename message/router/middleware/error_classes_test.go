@@ -0,0 +1,188 @@
+package middleware_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/backoff"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+var (
+	errInvalidPayload = errors.New("invalid payload")
+	errTimeout        = errors.New("timeout")
+)
+
+type counterSink struct {
+	lock     sync.Mutex
+	counters []map[string]string
+}
+
+func (s *counterSink) ObserveDuration(name string, labels map[string]string, d time.Duration) {}
+
+func (s *counterSink) IncCounter(name string, labels map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if name == middleware.MetricHandlerErrors {
+		s.counters = append(s.counters, labels)
+	}
+}
+
+var errorRules = []middleware.ErrorRule{
+	middleware.ErrorIs(errInvalidPayload, middleware.ErrorClassValidation),
+	middleware.ErrorIs(errTimeout, middleware.ErrorClassTransient),
+}
+
+func TestErrorClasses_validation_error_published_to_topic(t *testing.T) {
+	pub := &mockPublisher{behaviour: BehaviourAlwaysOK}
+	sink := &counterSink{}
+
+	errorClasses, err := middleware.ErrorClasses(middleware.ErrorClassesConfig{
+		Rules: errorRules,
+		Policies: map[middleware.ErrorClass]middleware.ErrorClassPolicy{
+			middleware.ErrorClassValidation: {Topic: "invalid_messages"},
+		},
+		Publisher:   pub,
+		MetricsSink: sink,
+	})
+	require.NoError(t, err)
+
+	msg := message.NewMessage("1", []byte("payload"))
+	produced, err := errorClasses(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, errors.Wrap(errInvalidPayload, "cannot unmarshal")
+	})(msg)
+
+	assert.NoError(t, err)
+	assert.Empty(t, produced)
+
+	published := pub.PopMessages()
+	require.Len(t, published, 1)
+	assert.Equal(t, "validation", published[0].Metadata.Get(middleware.ErrorClassMetadataKey))
+	assert.Equal(t, "cannot unmarshal: invalid payload", published[0].Metadata.Get(message.DeadLetterReasonMetadataKey))
+
+	require.Len(t, sink.counters, 1)
+	assert.Equal(t, "validation", sink.counters[0]["error_class"])
+}
+
+func TestErrorClasses_transient_error_retried(t *testing.T) {
+	errorClasses, err := middleware.ErrorClasses(middleware.ErrorClassesConfig{
+		Rules: errorRules,
+		Policies: map[middleware.ErrorClass]middleware.ErrorClassPolicy{
+			middleware.ErrorClassTransient: {Retry: backoff.MaxAttempts(backoff.Constant(time.Millisecond), 3)},
+		},
+	})
+	require.NoError(t, err)
+
+	attempts := 0
+	_, err = errorClasses(func(msg *message.Message) ([]*message.Message, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errTimeout
+		}
+		return nil, nil
+	})(message.NewMessage("1", nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestErrorClasses_retry_stops_when_class_changes(t *testing.T) {
+	pub := &mockPublisher{behaviour: BehaviourAlwaysOK}
+
+	errorClasses, err := middleware.ErrorClasses(middleware.ErrorClassesConfig{
+		Rules: errorRules,
+		Policies: map[middleware.ErrorClass]middleware.ErrorClassPolicy{
+			middleware.ErrorClassTransient:  {Retry: backoff.Constant(time.Millisecond)},
+			middleware.ErrorClassValidation: {Topic: "invalid_messages"},
+		},
+		Publisher: pub,
+	})
+	require.NoError(t, err)
+
+	attempts := 0
+	_, err = errorClasses(func(msg *message.Message) ([]*message.Message, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errTimeout
+		}
+		return nil, errInvalidPayload
+	})(message.NewMessage("1", nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	published := pub.PopMessages()
+	require.Len(t, published, 1)
+	assert.Equal(t, "validation", published[0].Metadata.Get(middleware.ErrorClassMetadataKey))
+}
+
+func TestErrorClasses_attempts_counted_per_class(t *testing.T) {
+	errDatabase := errors.New("database unavailable")
+
+	errorClasses, err := middleware.ErrorClasses(middleware.ErrorClassesConfig{
+		Rules: append(errorRules, middleware.ErrorIs(errDatabase, middleware.ErrorClassDependency)),
+		Policies: map[middleware.ErrorClass]middleware.ErrorClassPolicy{
+			middleware.ErrorClassTransient:  {Retry: backoff.MaxAttempts(backoff.Constant(time.Millisecond), 3)},
+			middleware.ErrorClassDependency: {Retry: backoff.MaxAttempts(backoff.Constant(time.Millisecond), 3)},
+		},
+	})
+	require.NoError(t, err)
+
+	handlerErrors := []error{errTimeout, errTimeout, errDatabase, errDatabase, nil}
+	attempts := 0
+	_, err = errorClasses(func(msg *message.Message) ([]*message.Message, error) {
+		err := handlerErrors[attempts]
+		attempts++
+		return nil, err
+	})(message.NewMessage("1", nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, attempts)
+}
+
+func TestErrorClasses_unknown_error_returned(t *testing.T) {
+	errorClasses, err := middleware.ErrorClasses(middleware.ErrorClassesConfig{
+		Rules: errorRules,
+	})
+	require.NoError(t, err)
+
+	msg := message.NewMessage("1", nil)
+	_, err = errorClasses(handlerFuncAlwaysFailing)(msg)
+
+	assert.Equal(t, errFailed, err)
+	assert.Equal(t, "unknown", msg.Metadata.Get(middleware.ErrorClassMetadataKey))
+}
+
+func TestErrorClasses_publisher_failing(t *testing.T) {
+	errorClasses, err := middleware.ErrorClasses(middleware.ErrorClassesConfig{
+		Rules: errorRules,
+		Policies: map[middleware.ErrorClass]middleware.ErrorClassPolicy{
+			middleware.ErrorClassValidation: {Topic: "invalid_messages"},
+		},
+		Publisher: &mockPublisher{behaviour: BehaviourAlwaysFail},
+	})
+	require.NoError(t, err)
+
+	_, err = errorClasses(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, errInvalidPayload
+	})(message.NewMessage("1", nil))
+
+	// the message should be nacked, so it's not lost
+	assert.Equal(t, errInvalidPayload, err)
+}
+
+func TestErrorClasses_missing_publisher(t *testing.T) {
+	_, err := middleware.ErrorClasses(middleware.ErrorClassesConfig{
+		Policies: map[middleware.ErrorClass]middleware.ErrorClassPolicy{
+			middleware.ErrorClassValidation: {Topic: "invalid_messages"},
+		},
+	})
+	assert.Error(t, err)
+}
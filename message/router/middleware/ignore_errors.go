@@ -1,11 +1,20 @@
 package middleware
 
-import "github.com/ThreeDotsLabs/watermill/message"
+import (
+	"github.com/pkg/errors"
 
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// IgnoreErrors acks messages, when the handler returned one of the ignored errors.
+// It prevents expected business errors (like "entity already exists") from being redelivered infinitely.
 type IgnoreErrors struct {
 	ignoredErrors map[string]struct{}
+	shouldIgnore  func(err error) bool
 }
 
+// NewIgnoreErrors creates IgnoreErrors, which ignores errs.
+// Errors are compared by their messages, errors wrapped with github.com/pkg/errors are compared by their cause.
 func NewIgnoreErrors(errs []error) IgnoreErrors {
 	errsMap := make(map[string]struct{}, len(errs))
 
@@ -13,14 +22,19 @@ func NewIgnoreErrors(errs []error) IgnoreErrors {
 		errsMap[err.Error()] = struct{}{}
 	}
 
-	return IgnoreErrors{errsMap}
+	return IgnoreErrors{ignoredErrors: errsMap}
+}
+
+// NewIgnoreErrorsFunc creates IgnoreErrors, which ignores errors for which shouldIgnore returns true.
+func NewIgnoreErrorsFunc(shouldIgnore func(err error) bool) IgnoreErrors {
+	return IgnoreErrors{shouldIgnore: shouldIgnore}
 }
 
 func (i IgnoreErrors) Middleware(h message.HandlerFunc) message.HandlerFunc {
 	return func(msg *message.Message) ([]*message.Message, error) {
 		events, err := h(msg)
 		if err != nil {
-			if _, ok := i.ignoredErrors[err.Error()]; ok {
+			if i.isIgnored(err) {
 				return events, nil
 			}
 
@@ -30,3 +44,16 @@ func (i IgnoreErrors) Middleware(h message.HandlerFunc) message.HandlerFunc {
 		return events, nil
 	}
 }
+
+func (i IgnoreErrors) isIgnored(err error) bool {
+	if i.shouldIgnore != nil {
+		return i.shouldIgnore(err)
+	}
+
+	if _, ok := i.ignoredErrors[err.Error()]; ok {
+		return true
+	}
+
+	_, ok := i.ignoredErrors[errors.Cause(err).Error()]
+	return ok
+}
@@ -28,6 +28,12 @@ func TestIgnoreErrors_Middleware(t *testing.T) {
 			TestError:       errors.New("not_ignored"),
 			ShouldBeIgnored: false,
 		},
+		{
+			Name:            "wrapped_ignored_error",
+			IgnoredErrors:   []error{errors.New("test")},
+			TestError:       errors.Wrap(errors.New("test"), "wrapped"),
+			ShouldBeIgnored: true,
+		},
 	}
 
 	for _, c := range testCases {
@@ -50,3 +56,22 @@ func TestIgnoreErrors_Middleware(t *testing.T) {
 		})
 	}
 }
+
+func TestNewIgnoreErrorsFunc(t *testing.T) {
+	errAlreadyExists := errors.New("entity already exists")
+
+	m := middleware.NewIgnoreErrorsFunc(func(err error) bool {
+		return errors.Cause(err) == errAlreadyExists
+	})
+
+	_, err := m.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, errors.Wrap(errAlreadyExists, "cannot create entity")
+	})(nil)
+	assert.NoError(t, err)
+
+	testErr := errors.New("test")
+	_, err = m.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, testErr
+	})(nil)
+	assert.Equal(t, testErr, err)
+}
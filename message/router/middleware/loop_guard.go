@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// HopCountMetadataKey is the metadata key with the number of handlers which produced the message chain.
+	HopCountMetadataKey = "hop_count"
+	// HandlersChainMetadataKey is the metadata key with comma separated names of handlers
+	// which produced the message chain, starting from the originating handler.
+	HandlersChainMetadataKey = "handlers_chain"
+	// ReasonForLoopKey is the metadata key which marks why the message was dead-lettered by LoopGuard.
+	ReasonForLoopKey = "reason_loop"
+)
+
+// ErrHopLimitExceeded is set as the reason of messages dead-lettered by LoopGuard.
+var ErrHopLimitExceeded = errors.New("message exceeded hop limit")
+
+// DefaultMaxHops is the default LoopGuard.MaxHops.
+const DefaultMaxHops = 16
+
+// LoopGuard protects router topologies from infinite loops,
+// for example when a handler publishes to a topic from which it's subscribing.
+//
+// LoopGuard increments the hop count of every produced message and appends the handler's name
+// to the handlers chain in metadata. A message with the hop count greater or equal to MaxHops is not handled,
+// but dead-lettered to DeadLetterTopic or dropped, when no DeadLetterPublisher is set.
+type LoopGuard struct {
+	// MaxHops is the max hop count of the handled message. Defaults to DefaultMaxHops.
+	MaxHops int
+
+	// DeadLetterPublisher and DeadLetterTopic are optional.
+	// When set, messages exceeding MaxHops are published to DeadLetterTopic, instead of being dropped.
+	DeadLetterPublisher message.Publisher
+	DeadLetterTopic     string
+
+	Logger watermill.LoggerAdapter
+}
+
+func (l LoopGuard) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	maxHops := l.MaxHops
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+
+	logger := l.Logger
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return func(msg *message.Message) ([]*message.Message, error) {
+		hops := MessageHopCount(msg)
+		chain := msg.Metadata.Get(HandlersChainMetadataKey)
+
+		if hops >= maxHops {
+			logger.Error("Message exceeded hop limit", ErrHopLimitExceeded, watermill.LogFields{
+				"message_uuid":   msg.UUID,
+				"hop_count":      hops,
+				"handlers_chain": chain,
+			})
+
+			if l.DeadLetterPublisher == nil {
+				return nil, nil
+			}
+
+			msg.Metadata.Set(ReasonForLoopKey, ErrHopLimitExceeded.Error())
+			return nil, l.DeadLetterPublisher.Publish(l.DeadLetterTopic, msg)
+		}
+
+		producedMessages, err := h(msg)
+
+		if handlerName := message.HandlerNameFromCtx(msg.Context()); handlerName != "" {
+			if chain == "" {
+				chain = handlerName
+			} else {
+				chain += "," + handlerName
+			}
+		}
+
+		for _, producedMsg := range producedMessages {
+			producedMsg.Metadata.Set(HopCountMetadataKey, strconv.Itoa(hops+1))
+			producedMsg.Metadata.Set(HandlersChainMetadataKey, chain)
+		}
+
+		return producedMessages, err
+	}
+}
+
+// MessageHopCount returns the hop count of the message.
+// Messages without a valid hop count are treated as not produced by any handler.
+func MessageHopCount(msg *message.Message) int {
+	hops, err := strconv.Atoi(msg.Metadata.Get(HopCountMetadataKey))
+	if err != nil {
+		return 0
+	}
+
+	return hops
+}
+
+// MessageHandlersChain returns names of handlers which produced the message chain.
+func MessageHandlersChain(msg *message.Message) []string {
+	chain := msg.Metadata.Get(HandlersChainMetadataKey)
+	if chain == "" {
+		return nil
+	}
+
+	return strings.Split(chain, ",")
+}
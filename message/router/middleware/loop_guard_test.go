@@ -0,0 +1,59 @@
+package middleware_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+func TestLoopGuard_increments_hop_count(t *testing.T) {
+	h := middleware.LoopGuard{MaxHops: 3}.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return []*message.Message{message.NewMessage("2", nil)}, nil
+	})
+
+	msg := message.NewMessage("1", nil)
+	msg.Metadata.Set(middleware.HopCountMetadataKey, "1")
+	msg.Metadata.Set(middleware.HandlersChainMetadataKey, "handler_1")
+
+	produced, err := h(msg)
+	require.NoError(t, err)
+	require.Len(t, produced, 1)
+
+	assert.Equal(t, 2, middleware.MessageHopCount(produced[0]))
+	assert.Equal(t, []string{"handler_1"}, middleware.MessageHandlersChain(produced[0]))
+}
+
+func TestLoopGuard_hop_limit_exceeded(t *testing.T) {
+	handlerCalled := false
+	handler := func(msg *message.Message) ([]*message.Message, error) {
+		handlerCalled = true
+		return nil, nil
+	}
+
+	msg := message.NewMessage("1", nil)
+	msg.Metadata.Set(middleware.HopCountMetadataKey, "3")
+
+	produced, err := middleware.LoopGuard{MaxHops: 3}.Middleware(handler)(msg)
+	assert.NoError(t, err)
+	assert.Empty(t, produced)
+	assert.False(t, handlerCalled)
+
+	pub := &mockPublisher{behaviour: BehaviourAlwaysOK}
+	loopGuard := middleware.LoopGuard{
+		MaxHops:             3,
+		DeadLetterPublisher: pub,
+		DeadLetterTopic:     "dead_letter",
+	}
+
+	_, err = loopGuard.Middleware(handler)(msg)
+	assert.NoError(t, err)
+	assert.False(t, handlerCalled)
+
+	deadLettered := pub.PopMessages()
+	require.Len(t, deadLettered, 1)
+	assert.Equal(t, middleware.ErrHopLimitExceeded.Error(), deadLettered[0].Metadata.Get(middleware.ReasonForLoopKey))
+}
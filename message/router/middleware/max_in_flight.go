@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// InFlightKey returns the key of the message, for which the MaxInFlightLimiter's limit is applied.
+type InFlightKey func(msg *message.Message) string
+
+// InFlightKeyTopic limits the messages per the topic from which they were received.
+func InFlightKeyTopic(msg *message.Message) string {
+	return message.SubscribeTopicFromCtx(msg.Context())
+}
+
+// InFlightKeyMetadata limits the messages per the value of the metadata key.
+func InFlightKeyMetadata(key string) InFlightKey {
+	return func(msg *message.Message) string {
+		return msg.Metadata.Get(key)
+	}
+}
+
+type MaxInFlightConfig struct {
+	// Limit is the maximum total weight of messages processed concurrently (per key, when Key is set).
+	Limit int64
+
+	// Key is optional. When set, the limit is applied separately for every key.
+	// Be aware that a limiter is kept in the memory for every key.
+	Key InFlightKey
+
+	// Weight is optional and returns the weight of the message, by default it's 1.
+	// It allows, for example, to count a batch message as many messages.
+	Weight func(msg *message.Message) int64
+}
+
+func (c MaxInFlightConfig) validate() error {
+	if c.Limit <= 0 {
+		return errors.New("Limit must be greater than 0")
+	}
+
+	return nil
+}
+
+// MaxInFlightLimiter provides a middleware which limits the number of messages processed concurrently.
+// The limit is shared by all handlers to which the middleware is added,
+// so it can protect a downstream service (like a database) used by many handlers.
+//
+// When the limit is reached, the message waits for the free slot, or until its context is canceled
+// (in that case the message is nacked).
+type MaxInFlightLimiter struct {
+	config MaxInFlightConfig
+
+	semaphores     map[string]*weightedSemaphore
+	semaphoresLock sync.Mutex
+}
+
+func NewMaxInFlightLimiter(config MaxInFlightConfig) (*MaxInFlightLimiter, error) {
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid MaxInFlight config")
+	}
+
+	return &MaxInFlightLimiter{
+		config:     config,
+		semaphores: map[string]*weightedSemaphore{},
+	}, nil
+}
+
+// MaxInFlight returns a middleware which limits the number of messages processed concurrently
+// by all handlers, to which it is added, to n. It panics, when n is not greater than 0.
+func MaxInFlight(n int64) message.HandlerMiddleware {
+	limiter, err := NewMaxInFlightLimiter(MaxInFlightConfig{Limit: n})
+	if err != nil {
+		panic(err)
+	}
+
+	return limiter.Middleware
+}
+
+func (l *MaxInFlightLimiter) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		var key string
+		if l.config.Key != nil {
+			key = l.config.Key(msg)
+		}
+
+		weight := int64(1)
+		if l.config.Weight != nil {
+			weight = l.config.Weight(msg)
+		}
+
+		semaphore := l.semaphore(key)
+		if err := semaphore.Acquire(msg.Context(), weight); err != nil {
+			return nil, errors.Wrapf(err, "cannot acquire in-flight slot for key %q", key)
+		}
+		defer semaphore.Release(weight)
+
+		return h(msg)
+	}
+}
+
+func (l *MaxInFlightLimiter) semaphore(key string) *weightedSemaphore {
+	l.semaphoresLock.Lock()
+	defer l.semaphoresLock.Unlock()
+
+	s, ok := l.semaphores[key]
+	if !ok {
+		s = newWeightedSemaphore(l.config.Limit)
+		l.semaphores[key] = s
+	}
+
+	return s
+}
+
+// weightedSemaphore is a semaphore which can be acquired with a weight.
+// Waiters are served in FIFO order, so heavy messages are not starved by lighter ones.
+type weightedSemaphore struct {
+	size    int64
+	current int64
+	waiters []semaphoreWaiter
+	lock    sync.Mutex
+}
+
+type semaphoreWaiter struct {
+	weight int64
+	ready  chan struct{}
+}
+
+func newWeightedSemaphore(size int64) *weightedSemaphore {
+	return &weightedSemaphore{size: size}
+}
+
+func (s *weightedSemaphore) Acquire(ctx context.Context, weight int64) error {
+	s.lock.Lock()
+	if weight > s.size {
+		s.lock.Unlock()
+		return errors.Errorf("weight %d exceeds the limit %d", weight, s.size)
+	}
+	if s.size-s.current >= weight && len(s.waiters) == 0 {
+		s.current += weight
+		s.lock.Unlock()
+		return nil
+	}
+
+	waiter := semaphoreWaiter{weight: weight, ready: make(chan struct{})}
+	s.waiters = append(s.waiters, waiter)
+	s.lock.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	select {
+	case <-waiter.ready:
+		// acquired in the meantime, the context is canceled anyway
+		s.current -= weight
+	default:
+		for i, w := range s.waiters {
+			if w.ready == waiter.ready {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				break
+			}
+		}
+	}
+	s.notifyWaiters()
+
+	return ctx.Err()
+}
+
+func (s *weightedSemaphore) Release(weight int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.current -= weight
+	s.notifyWaiters()
+}
+
+// notifyWaiters wakes up the waiters which fit into the free space. lock must be held by the caller.
+func (s *weightedSemaphore) notifyWaiters() {
+	for len(s.waiters) > 0 {
+		w := s.waiters[0]
+		if s.size-s.current < w.weight {
+			return
+		}
+
+		s.current += w.weight
+		s.waiters = s.waiters[1:]
+		close(w.ready)
+	}
+}
@@ -0,0 +1,106 @@
+package middleware_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	const limit = 3
+
+	var inFlight, maxInFlight int64
+	h := func(msg *message.Message) ([]*message.Message, error) {
+		current := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+
+		for {
+			max := atomic.LoadInt64(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+
+		return nil, nil
+	}
+
+	maxInFlightMiddleware := middleware.MaxInFlight(limit)
+	// the limit is shared by both handlers
+	handler1 := maxInFlightMiddleware(h)
+	handler2 := maxInFlightMiddleware(h)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			handler := handler1
+			if i%2 == 0 {
+				handler = handler2
+			}
+			_, err := handler(message.NewMessage("1", nil))
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, limit, maxInFlight)
+}
+
+func TestMaxInFlightLimiter_key(t *testing.T) {
+	limiter, err := middleware.NewMaxInFlightLimiter(middleware.MaxInFlightConfig{
+		Limit: 1,
+		Key:   middleware.InFlightKeyMetadata("key"),
+	})
+	require.NoError(t, err)
+
+	blocked := make(chan struct{})
+	unblock := make(chan struct{})
+
+	handler := limiter.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		if msg.UUID == "blocking" {
+			close(blocked)
+			<-unblock
+		}
+		return nil, nil
+	})
+
+	newMsg := func(uuid string, key string) *message.Message {
+		msg := message.NewMessage(uuid, nil)
+		msg.Metadata.Set("key", key)
+		return msg
+	}
+
+	go func() {
+		_, _ = handler(newMsg("blocking", "a"))
+	}()
+	<-blocked
+
+	_, err = handler(newMsg("other_key", "b"))
+	assert.NoError(t, err, "message with other key should not be limited")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	msg := newMsg("same_key", "a")
+	msg.SetContext(ctx)
+	_, err = handler(msg)
+	assert.Error(t, err, "message with the same key should wait until the context is canceled")
+
+	close(unblock)
+}
+
+func TestNewMaxInFlightLimiter_invalid_limit(t *testing.T) {
+	_, err := middleware.NewMaxInFlightLimiter(middleware.MaxInFlightConfig{})
+	assert.Error(t, err)
+}
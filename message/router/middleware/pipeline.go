@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// ErrDropMessage can be returned by TransformFunc to drop the message.
+// Dropped message is not passed to the next stages nor to the handler and it is acked.
+var ErrDropMessage = errors.New("message dropped by pipeline stage")
+
+// TransformFunc is a single stage of the Pipeline.
+//
+// It can modify payload and metadata of the message, return additional messages which will be produced
+// together with messages returned by the handler, or drop the message by returning ErrDropMessage.
+type TransformFunc func(msg *message.Message) ([]*message.Message, error)
+
+// PipelineErrorPolicy determines what happens when a pipeline stage returns an error.
+type PipelineErrorPolicy int
+
+const (
+	// PipelineFailOnError stops the pipeline and returns the error, so the message is nacked.
+	// It is the default policy.
+	PipelineFailOnError PipelineErrorPolicy = iota
+	// PipelineSkipStageOnError ignores the error and passes the message to the next stage.
+	PipelineSkipStageOnError
+	// PipelineDropOnError drops the message, like the stage returned ErrDropMessage.
+	PipelineDropOnError
+)
+
+// WithErrorPolicy wraps the stage, so errors returned by it are handled according to the policy.
+func WithErrorPolicy(policy PipelineErrorPolicy, stage TransformFunc) TransformFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		produced, err := stage(msg)
+		if err == nil || err == ErrDropMessage {
+			return produced, err
+		}
+
+		switch policy {
+		case PipelineSkipStageOnError:
+			return produced, nil
+		case PipelineDropOnError:
+			return produced, ErrDropMessage
+		default:
+			return produced, err
+		}
+	}
+}
+
+// Pipeline creates a middleware which passes the message through stages, in order, before it reaches the handler.
+//
+// Messages emitted by the stages are returned together with messages produced by the handler.
+// When a stage drops the message, the handler is not called and messages emitted so far are returned.
+//
+// By default, an error returned by a stage stops the pipeline. To change this behaviour use WithErrorPolicy.
+func Pipeline(stages ...TransformFunc) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			var emitted []*message.Message
+
+			for i, stage := range stages {
+				produced, err := stage(msg)
+				emitted = append(emitted, produced...)
+
+				if err == ErrDropMessage {
+					return emitted, nil
+				}
+				if err != nil {
+					return nil, errors.Wrapf(err, "pipeline stage %d failed", i)
+				}
+			}
+
+			produced, err := h(msg)
+			if err != nil {
+				return produced, err
+			}
+
+			return append(emitted, produced...), nil
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package middleware_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+func TestPipeline(t *testing.T) {
+	emittedMsg := message.NewMessage("emitted", nil)
+
+	pipeline := middleware.Pipeline(
+		func(msg *message.Message) ([]*message.Message, error) {
+			msg.Metadata.Set("stage", "1")
+			return nil, nil
+		},
+		func(msg *message.Message) ([]*message.Message, error) {
+			msg.Payload = append(msg.Payload, []byte("_transformed")...)
+			return []*message.Message{emittedMsg}, nil
+		},
+	)
+
+	var handledMsg *message.Message
+	produced, err := pipeline(func(msg *message.Message) ([]*message.Message, error) {
+		handledMsg = msg
+		return handlerFuncAlwaysOKMessages, nil
+	})(message.NewMessage("1", []byte("payload")))
+	require.NoError(t, err)
+
+	require.NotNil(t, handledMsg)
+	assert.Equal(t, "1", handledMsg.Metadata.Get("stage"))
+	assert.Equal(t, []byte("payload_transformed"), []byte(handledMsg.Payload))
+	assert.Equal(t, append([]*message.Message{emittedMsg}, handlerFuncAlwaysOKMessages...), produced)
+}
+
+func TestPipeline_drop(t *testing.T) {
+	handlerCalled := false
+	secondStageCalled := false
+
+	pipeline := middleware.Pipeline(
+		func(msg *message.Message) ([]*message.Message, error) {
+			return nil, middleware.ErrDropMessage
+		},
+		func(msg *message.Message) ([]*message.Message, error) {
+			secondStageCalled = true
+			return nil, nil
+		},
+	)
+
+	produced, err := pipeline(func(msg *message.Message) ([]*message.Message, error) {
+		handlerCalled = true
+		return nil, nil
+	})(message.NewMessage("1", nil))
+
+	assert.NoError(t, err)
+	assert.Empty(t, produced)
+	assert.False(t, secondStageCalled)
+	assert.False(t, handlerCalled)
+}
+
+func TestPipeline_error_policies(t *testing.T) {
+	stageErr := errors.New("stage failed")
+	failingStage := func(msg *message.Message) ([]*message.Message, error) {
+		return nil, stageErr
+	}
+
+	testCases := []struct {
+		Name                  string
+		Policy                middleware.PipelineErrorPolicy
+		ExpectedError         bool
+		ExpectedHandlerCalled bool
+	}{
+		{
+			Name:                  "fail",
+			Policy:                middleware.PipelineFailOnError,
+			ExpectedError:         true,
+			ExpectedHandlerCalled: false,
+		},
+		{
+			Name:                  "skip",
+			Policy:                middleware.PipelineSkipStageOnError,
+			ExpectedError:         false,
+			ExpectedHandlerCalled: true,
+		},
+		{
+			Name:                  "drop",
+			Policy:                middleware.PipelineDropOnError,
+			ExpectedError:         false,
+			ExpectedHandlerCalled: false,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.Name, func(t *testing.T) {
+			handlerCalled := false
+
+			pipeline := middleware.Pipeline(middleware.WithErrorPolicy(c.Policy, failingStage))
+			_, err := pipeline(func(msg *message.Message) ([]*message.Message, error) {
+				handlerCalled = true
+				return nil, nil
+			})(message.NewMessage("1", nil))
+
+			if c.ExpectedError {
+				assert.Equal(t, stageErr, errors.Cause(err))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, c.ExpectedHandlerCalled, handlerCalled)
+		})
+	}
+}
@@ -19,6 +19,13 @@ type PoisonQueue struct {
 // ReasonForPoisonedKey is the metadata key which marks the reason (error) why the message was deemed poisoned.
 var ReasonForPoisonedKey = "reason_poisoned"
 
+// PoisonedTopicKey is the metadata key with the topic, from which the poisoned message was received.
+// It allows to requeue the message to its original topic.
+var PoisonedTopicKey = "topic_poisoned"
+
+// PoisonedHandlerKey is the metadata key with the name of the handler, which failed to handle the message.
+var PoisonedHandlerKey = "handler_poisoned"
+
 func (pq PoisonQueue) publishPoisonMessage(msg *message.Message, err error) error {
 	// no problems encountered, carry on
 	if err == nil {
@@ -27,6 +34,12 @@ func (pq PoisonQueue) publishPoisonMessage(msg *message.Message, err error) erro
 
 	// add context why it was poisoned
 	msg.Metadata.Set(ReasonForPoisonedKey, err.Error())
+	if topic := message.SubscribeTopicFromCtx(msg.Context()); topic != "" {
+		msg.Metadata.Set(PoisonedTopicKey, topic)
+	}
+	if handlerName := message.HandlerNameFromCtx(msg.Context()); handlerName != "" {
+		msg.Metadata.Set(PoisonedHandlerKey, handlerName)
+	}
 
 	// don't intercept error from publish. Can't help you if the publisher is down as well.
 	return pq.pub.Publish(pq.topic, msg)
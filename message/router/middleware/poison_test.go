@@ -1,9 +1,13 @@
 package middleware_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
 
 	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
 	"github.com/pkg/errors"
@@ -92,3 +96,37 @@ func TestPoisonQueue_handler_failing_publisher_panicking(t *testing.T) {
 		)
 	})
 }
+
+func TestPoisonQueue_original_topic_and_handler(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	poisonQueue, err := middleware.NewPoisonQueue(pubSub, topic)
+	require.NoError(t, err)
+	router.AddMiddleware(poisonQueue.Middleware)
+
+	router.AddNoPublisherHandler("poisoning_handler", "orders", pubSub, handlerFuncAlwaysFailing)
+
+	poisoned, err := pubSub.Subscribe(context.Background(), topic)
+	require.NoError(t, err)
+
+	go func() {
+		_ = router.Run()
+	}()
+	defer router.Close()
+	<-router.Running()
+
+	require.NoError(t, pubSub.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+
+	select {
+	case msg := <-poisoned:
+		assert.Equal(t, "orders", msg.Metadata.Get(middleware.PoisonedTopicKey))
+		assert.Equal(t, "poisoning_handler", msg.Metadata.Get(middleware.PoisonedHandlerKey))
+		assert.Equal(t, errFailed.Error(), msg.Metadata.Get(middleware.ReasonForPoisonedKey))
+		msg.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("poisoned message not received")
+	}
+}
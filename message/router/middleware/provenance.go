@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"os"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Metadata keys set by Provenance on the produced messages.
+const (
+	ProvenanceHandlerMetadataKey         = "provenance_handler"
+	ProvenanceConsumedMessageMetadataKey = "provenance_consumed_message_uuid"
+	ProvenanceRouterIDMetadataKey        = "provenance_router_id"
+	ProvenanceHostnameMetadataKey        = "provenance_hostname"
+	ProvenanceTimestampMetadataKey       = "provenance_timestamp"
+)
+
+// Provenance stamps the messages produced by the handler with the metadata describing where they come from:
+// the handler's name, the UUID of the consumed message, the router instance, the hostname and the time.
+//
+// Unlike the correlation ID, the provenance of every hop overwrites the previous one,
+// so the lineage across services can be reconstructed by following ProvenanceConsumedMessageMetadataKey.
+type Provenance struct {
+	// RouterID identifies the router instance. NewProvenance generates a random one.
+	RouterID string
+
+	// Hostname defaults to os.Hostname() in NewProvenance.
+	Hostname string
+}
+
+// NewProvenance creates Provenance with a random RouterID and the hostname of the machine.
+func NewProvenance() Provenance {
+	hostname, _ := os.Hostname()
+
+	return Provenance{
+		RouterID: watermill.NewShortUUID(),
+		Hostname: hostname,
+	}
+}
+
+func (p Provenance) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		producedMessages, err := h(msg)
+
+		for _, produced := range producedMessages {
+			p.Stamp(msg, produced)
+		}
+
+		return producedMessages, err
+	}
+}
+
+// Stamp sets the provenance metadata of the message produced from the consumed message.
+// It can be used for messages published by the handler directly with the publisher.
+func (p Provenance) Stamp(consumed *message.Message, produced *message.Message) {
+	produced.Metadata.Set(ProvenanceHandlerMetadataKey, message.HandlerNameFromCtx(consumed.Context()))
+	produced.Metadata.Set(ProvenanceConsumedMessageMetadataKey, consumed.UUID)
+	produced.Metadata.Set(ProvenanceRouterIDMetadataKey, p.RouterID)
+	produced.Metadata.Set(ProvenanceHostnameMetadataKey, p.Hostname)
+	produced.Metadata.Set(ProvenanceTimestampMetadataKey, time.Now().UTC().Format(time.RFC3339Nano))
+}
@@ -0,0 +1,79 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+func TestProvenance(t *testing.T) {
+	provenance := middleware.Provenance{RouterID: "router-1", Hostname: "host-1"}
+
+	handler := provenance.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return message.Messages{message.NewMessage("2", nil)}, nil
+	})
+
+	before := time.Now()
+	produced, err := handler(message.NewMessage("1", nil))
+	require.NoError(t, err)
+	require.Len(t, produced, 1)
+
+	assert.Equal(t, "1", produced[0].Metadata.Get(middleware.ProvenanceConsumedMessageMetadataKey))
+	assert.Equal(t, "router-1", produced[0].Metadata.Get(middleware.ProvenanceRouterIDMetadataKey))
+	assert.Equal(t, "host-1", produced[0].Metadata.Get(middleware.ProvenanceHostnameMetadataKey))
+
+	timestamp, err := time.Parse(time.RFC3339Nano, produced[0].Metadata.Get(middleware.ProvenanceTimestampMetadataKey))
+	require.NoError(t, err)
+	assert.False(t, timestamp.Before(before.Truncate(time.Second)))
+}
+
+func TestProvenance_handler_name(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	provenance := middleware.NewProvenance()
+	assert.NotEmpty(t, provenance.RouterID)
+	router.AddMiddleware(provenance.Middleware)
+
+	router.AddHandler(
+		"provenance_handler",
+		"in",
+		pubSub,
+		"out",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) {
+			return message.Messages{message.NewMessage(watermill.NewUUID(), nil)}, nil
+		},
+	)
+
+	out, err := pubSub.Subscribe(context.Background(), "out")
+	require.NoError(t, err)
+
+	go func() {
+		_ = router.Run()
+	}()
+	defer router.Close()
+	<-router.Running()
+
+	consumed := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, pubSub.Publish("in", consumed))
+
+	select {
+	case produced := <-out:
+		assert.Equal(t, "provenance_handler", produced.Metadata.Get(middleware.ProvenanceHandlerMetadataKey))
+		assert.Equal(t, consumed.UUID, produced.Metadata.Get(middleware.ProvenanceConsumedMessageMetadataKey))
+		produced.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("produced message not received")
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"runtime/pprof"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Keys of the pprof labels set by SlowHandlerDetector.
+const (
+	HandlerNameProfilerLabel = "watermill_handler"
+	TopicProfilerLabel       = "watermill_topic"
+	MessageUUIDProfilerLabel = "watermill_message_uuid"
+)
+
+// SlowHandler describes the handling of a message which took longer than the SLO.
+type SlowHandler struct {
+	HandlerName string
+	Topic       string
+	MessageUUID string
+
+	Duration time.Duration
+	SLO      time.Duration
+
+	// Err is the error returned by the handler, if any.
+	Err error
+}
+
+// SlowHandlerDetector tags the goroutine handling the message with pprof labels
+// (the handler name, the topic and the message UUID) and reports the handlers which exceed the latency SLO.
+//
+// The labels are visible in CPU and goroutine profiles of the live consumer
+// (for example `go tool pprof -tagfocus watermill_handler=my_handler`), so it's easy to find out
+// which handler and which message is hot. Goroutines started by the handler inherit the labels.
+type SlowHandlerDetector struct {
+	// SLO is the max expected duration of the handler. Handlers running longer are reported.
+	// When 0, only the pprof labels are set.
+	SLO time.Duration
+
+	// OnSlowHandler is called after the handler exceeded the SLO. It is optional.
+	OnSlowHandler func(slow SlowHandler)
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	// Logger is optional. Slow handlers are logged with the Info level.
+	Logger watermill.LoggerAdapter
+}
+
+func (d SlowHandlerDetector) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	now := d.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	logger := d.Logger
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return func(msg *message.Message) (producedMessages []*message.Message, err error) {
+		handlerName := message.HandlerNameFromCtx(msg.Context())
+		topic := message.SubscribeTopicFromCtx(msg.Context())
+
+		labels := pprof.Labels(
+			HandlerNameProfilerLabel, handlerName,
+			TopicProfilerLabel, topic,
+			MessageUUIDProfilerLabel, msg.UUID,
+		)
+
+		start := now()
+
+		originalCtx := msg.Context()
+		pprof.Do(originalCtx, labels, func(ctx context.Context) {
+			// the handler can add its own labels with pprof.Do and the message's context
+			msg.SetContext(ctx)
+			producedMessages, err = h(msg)
+		})
+		msg.SetContext(originalCtx)
+
+		duration := now().Sub(start)
+		if d.SLO <= 0 || duration <= d.SLO {
+			return producedMessages, err
+		}
+
+		logger.Info("Handler exceeded the latency SLO", watermill.LogFields{
+			"handler":      handlerName,
+			"topic":        topic,
+			"message_uuid": msg.UUID,
+			"duration":     duration,
+			"slo":          d.SLO,
+		})
+
+		if d.OnSlowHandler != nil {
+			d.OnSlowHandler(SlowHandler{
+				HandlerName: handlerName,
+				Topic:       topic,
+				MessageUUID: msg.UUID,
+				Duration:    duration,
+				SLO:         d.SLO,
+				Err:         err,
+			})
+		}
+
+		return producedMessages, err
+	}
+}
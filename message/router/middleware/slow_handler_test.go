@@ -0,0 +1,95 @@
+package middleware_test
+
+import (
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+// fakeClock returns now, which is moved forward by the handler
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestSlowHandlerDetector(t *testing.T) {
+	testCases := []struct {
+		Name             string
+		HandlerDuration  time.Duration
+		ExpectedReported bool
+	}{
+		{
+			Name:             "fast",
+			HandlerDuration:  time.Millisecond * 50,
+			ExpectedReported: false,
+		},
+		{
+			Name:             "slow",
+			HandlerDuration:  time.Millisecond * 150,
+			ExpectedReported: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+			var reported []middleware.SlowHandler
+			detector := middleware.SlowHandlerDetector{
+				SLO: time.Millisecond * 100,
+				OnSlowHandler: func(slow middleware.SlowHandler) {
+					reported = append(reported, slow)
+				},
+				Now: clock.Now,
+			}
+
+			h := detector.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+				clock.now = clock.now.Add(tc.HandlerDuration)
+				return nil, errFailed
+			})
+
+			_, err := h(message.NewMessage("uuid", nil))
+			assert.Equal(t, errFailed, err)
+
+			if !tc.ExpectedReported {
+				assert.Empty(t, reported)
+				return
+			}
+
+			require.Len(t, reported, 1)
+			assert.Equal(t, "uuid", reported[0].MessageUUID)
+			assert.Equal(t, tc.HandlerDuration, reported[0].Duration)
+			assert.Equal(t, time.Millisecond*100, reported[0].SLO)
+			assert.Equal(t, errFailed, reported[0].Err)
+		})
+	}
+}
+
+func TestSlowHandlerDetector_profiler_labels(t *testing.T) {
+	msg := message.NewMessage("uuid", nil)
+	originalCtx := msg.Context()
+
+	var labelValue string
+	var labelFound bool
+
+	h := middleware.SlowHandlerDetector{}.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		labelValue, labelFound = pprof.Label(msg.Context(), middleware.MessageUUIDProfilerLabel)
+		return nil, nil
+	})
+
+	_, err := h(msg)
+	require.NoError(t, err)
+
+	assert.True(t, labelFound)
+	assert.Equal(t, "uuid", labelValue)
+	assert.Equal(t, originalCtx, msg.Context(), "context of the message should be restored")
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// ProducedAtMetadataKey is the metadata key with the time when the message was produced, in RFC3339Nano format.
+	ProducedAtMetadataKey = "produced_at"
+	// ReasonForStaleKey is the metadata key which marks why the message was dead-lettered by StaleGuard.
+	ReasonForStaleKey = "reason_stale"
+)
+
+// ErrMessageStale is set as the reason of messages dead-lettered by StaleGuard.
+var ErrMessageStale = errors.New("message is stale")
+
+// MessageTimestamp returns the time when the message was produced.
+// It returns false, when the message has no valid timestamp.
+type MessageTimestamp func(msg *message.Message) (time.Time, bool)
+
+// MetadataTimestamp returns MessageTimestamp which parses the metadata value of the key with the layout.
+//
+// For example, the publish time of Google Cloud Pub/Sub messages can be read with:
+//
+//	MetadataTimestamp("publishTime", "2006-01-02 15:04:05.999999999 -0700 MST")
+func MetadataTimestamp(key string, layout string) MessageTimestamp {
+	return func(msg *message.Message) (time.Time, bool) {
+		value := msg.Metadata.Get(key)
+		if value == "" {
+			return time.Time{}, false
+		}
+
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		return t, true
+	}
+}
+
+// SetProducedAt sets the time when the message was produced, which is used by StaleGuard by default.
+func SetProducedAt(msg *message.Message, producedAt time.Time) {
+	msg.Metadata.Set(ProducedAtMetadataKey, producedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// StaleGuard discards messages which were produced more than MaxAge ago,
+// so consumers recovering from long outages can skip expired work.
+//
+// Stale messages are not handled, but acked and dead-lettered to DeadLetterTopic or dropped,
+// when no DeadLetterPublisher is set. Messages without a timestamp are always handled.
+type StaleGuard struct {
+	// MaxAge is the max age of the handled message.
+	MaxAge time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	// Timestamp returns the time when the message was produced.
+	// Defaults to the time stored in ProducedAtMetadataKey.
+	Timestamp MessageTimestamp
+
+	// DeadLetterPublisher and DeadLetterTopic are optional.
+	// When set, stale messages are published to DeadLetterTopic, instead of being dropped.
+	DeadLetterPublisher message.Publisher
+	DeadLetterTopic     string
+
+	Logger watermill.LoggerAdapter
+}
+
+// DiscardStale provides a middleware which drops messages produced more than maxAge ago.
+// now returns the current time, when nil, time.Now is used.
+func DiscardStale(maxAge time.Duration, now func() time.Time) message.HandlerMiddleware {
+	return StaleGuard{MaxAge: maxAge, Now: now}.Middleware
+}
+
+func (s StaleGuard) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	now := s.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	timestamp := s.Timestamp
+	if timestamp == nil {
+		timestamp = MetadataTimestamp(ProducedAtMetadataKey, time.RFC3339Nano)
+	}
+
+	logger := s.Logger
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return func(msg *message.Message) ([]*message.Message, error) {
+		producedAt, ok := timestamp(msg)
+		if !ok {
+			return h(msg)
+		}
+
+		age := now().Sub(producedAt)
+		if age <= s.MaxAge {
+			return h(msg)
+		}
+
+		logger.Info("Discarding stale message", watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"age":          age,
+			"max_age":      s.MaxAge,
+		})
+
+		if s.DeadLetterPublisher == nil {
+			return nil, nil
+		}
+
+		msg.Metadata.Set(ReasonForStaleKey, ErrMessageStale.Error())
+		return nil, s.DeadLetterPublisher.Publish(s.DeadLetterTopic, msg)
+	}
+}
@@ -0,0 +1,95 @@
+package middleware_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+var staleTestNow = time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newProducedMessage(producedAt time.Time) *message.Message {
+	msg := message.NewMessage("1", nil)
+	middleware.SetProducedAt(msg, producedAt)
+	return msg
+}
+
+func TestDiscardStale(t *testing.T) {
+	now := func() time.Time { return staleTestNow }
+
+	testCases := []struct {
+		Name            string
+		Msg             *message.Message
+		ExpectedHandled bool
+	}{
+		{
+			Name:            "fresh",
+			Msg:             newProducedMessage(staleTestNow.Add(-time.Minute)),
+			ExpectedHandled: true,
+		},
+		{
+			Name:            "stale",
+			Msg:             newProducedMessage(staleTestNow.Add(-time.Hour)),
+			ExpectedHandled: false,
+		},
+		{
+			Name:            "no_timestamp",
+			Msg:             message.NewMessage("1", nil),
+			ExpectedHandled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			handled := false
+			h := middleware.DiscardStale(time.Minute*5, now)(func(msg *message.Message) ([]*message.Message, error) {
+				handled = true
+				return nil, nil
+			})
+
+			_, err := h(tc.Msg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.ExpectedHandled, handled)
+		})
+	}
+}
+
+func TestStaleGuard_dead_letter(t *testing.T) {
+	pub := &mockPublisher{behaviour: BehaviourAlwaysOK}
+
+	h := middleware.StaleGuard{
+		MaxAge:              time.Minute,
+		Now:                 func() time.Time { return staleTestNow },
+		DeadLetterPublisher: pub,
+		DeadLetterTopic:     "stale",
+	}.Middleware(handlerFuncAlwaysOK)
+
+	msg := newProducedMessage(staleTestNow.Add(-time.Hour))
+
+	produced, err := h(msg)
+	require.NoError(t, err)
+	assert.Empty(t, produced)
+
+	assert.Equal(t, []*message.Message{msg}, pub.PopMessages())
+	assert.Equal(t, middleware.ErrMessageStale.Error(), msg.Metadata.Get(middleware.ReasonForStaleKey))
+}
+
+func TestStaleGuard_custom_timestamp(t *testing.T) {
+	h := middleware.StaleGuard{
+		MaxAge:    time.Minute,
+		Now:       func() time.Time { return staleTestNow },
+		Timestamp: middleware.MetadataTimestamp("publishTime", "2006-01-02 15:04:05.999999999 -0700 MST"),
+	}.Middleware(handlerFuncAlwaysOK)
+
+	msg := message.NewMessage("1", nil)
+	msg.Metadata.Set("publishTime", staleTestNow.Add(-time.Hour).String())
+
+	produced, err := h(msg)
+	require.NoError(t, err)
+	assert.Empty(t, produced)
+}
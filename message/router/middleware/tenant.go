@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// TenantIDMetadataKey is the default metadata key which carries the tenant ID.
+const TenantIDMetadataKey = "tenant_id"
+
+var (
+	// ErrMissingTenantID happens when a message has no tenant ID and no default tenant is configured.
+	ErrMissingTenantID = errors.New("message has no tenant id")
+	// ErrInvalidTenantRouterConfig happens when both per-tenant handlers and per-tenant topics are configured.
+	ErrInvalidTenantRouterConfig = errors.New("TenantHandlerFactory and TenantTopic cannot be used together")
+)
+
+// TenantHandlerFactory creates a handler instance for the tenant.
+// It is called once per tenant, when the first message of the tenant is received.
+type TenantHandlerFactory func(tenantID string, h message.HandlerFunc) (message.HandlerFunc, error)
+
+// TenantRateLimiter limits the processing rate of messages per tenant.
+type TenantRateLimiter interface {
+	// Wait blocks until a message of the tenant can be processed.
+	// An error returned by Wait is returned from the handler, so the message is nacked.
+	Wait(ctx context.Context, tenantID string) error
+}
+
+type TenantRouterConfig struct {
+	// MetadataKey is the metadata key with the tenant ID. Defaults to TenantIDMetadataKey.
+	MetadataKey string
+
+	// DefaultTenantID is used for messages without the tenant ID.
+	// When empty, messages without the tenant ID are failing with ErrMissingTenantID.
+	DefaultTenantID string
+
+	// HandlerFactory creates a separate handler instance for every tenant.
+	// When nil, the handler wrapped by the middleware is used for all tenants.
+	HandlerFactory TenantHandlerFactory
+
+	// TenantTopic returns a per-tenant topic.
+	// When set, messages are not handled, but republished with Publisher to the tenant's topic.
+	TenantTopic func(tenantID string) string
+	Publisher   message.Publisher
+
+	// RateLimiter is optional and limits the processing rate per tenant.
+	RateLimiter TenantRateLimiter
+}
+
+func (c *TenantRouterConfig) setDefaults() {
+	if c.MetadataKey == "" {
+		c.MetadataKey = TenantIDMetadataKey
+	}
+}
+
+func (c TenantRouterConfig) validate() error {
+	if c.HandlerFactory != nil && c.TenantTopic != nil {
+		return ErrInvalidTenantRouterConfig
+	}
+	if c.TenantTopic != nil && c.Publisher == nil {
+		return errors.New("Publisher is required when TenantTopic is set")
+	}
+
+	return nil
+}
+
+// TenantRouter provides a middleware which dispatches messages based on the tenant ID from the metadata.
+//
+// Messages can be dispatched to per-tenant handler instances (HandlerFactory)
+// or republished to per-tenant topics (TenantTopic).
+// The tenant ID is propagated to all messages produced by the handler.
+type TenantRouter struct {
+	config TenantRouterConfig
+}
+
+func NewTenantRouter(config TenantRouterConfig) (*TenantRouter, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid TenantRouter config")
+	}
+
+	return &TenantRouter{config}, nil
+}
+
+func (t *TenantRouter) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	// handlers are created per wrapped handler, because the middleware may be added to multiple handlers
+	handlers := &tenantHandlers{
+		factory:  t.config.HandlerFactory,
+		h:        h,
+		handlers: map[string]message.HandlerFunc{},
+	}
+
+	return func(msg *message.Message) ([]*message.Message, error) {
+		tenantID := msg.Metadata.Get(t.config.MetadataKey)
+		if tenantID == "" {
+			tenantID = t.config.DefaultTenantID
+		}
+		if tenantID == "" {
+			return nil, ErrMissingTenantID
+		}
+
+		if t.config.RateLimiter != nil {
+			if err := t.config.RateLimiter.Wait(msg.Context(), tenantID); err != nil {
+				return nil, errors.Wrapf(err, "rate limiter failed for tenant %s", tenantID)
+			}
+		}
+
+		if t.config.TenantTopic != nil {
+			return nil, t.config.Publisher.Publish(t.config.TenantTopic(tenantID), msg)
+		}
+
+		handler, err := handlers.get(tenantID)
+		if err != nil {
+			return nil, err
+		}
+
+		producedMessages, err := handler(msg)
+		for _, producedMsg := range producedMessages {
+			if producedMsg.Metadata.Get(t.config.MetadataKey) == "" {
+				producedMsg.Metadata.Set(t.config.MetadataKey, tenantID)
+			}
+		}
+
+		return producedMessages, err
+	}
+}
+
+type tenantHandlers struct {
+	factory TenantHandlerFactory
+	h       message.HandlerFunc
+
+	handlers     map[string]message.HandlerFunc
+	handlersLock sync.Mutex
+}
+
+func (t *tenantHandlers) get(tenantID string) (message.HandlerFunc, error) {
+	if t.factory == nil {
+		return t.h, nil
+	}
+
+	t.handlersLock.Lock()
+	defer t.handlersLock.Unlock()
+
+	if handler, ok := t.handlers[tenantID]; ok {
+		return handler, nil
+	}
+
+	handler, err := t.factory(tenantID, t.h)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create handler for tenant %s", tenantID)
+	}
+	t.handlers[tenantID] = handler
+
+	return handler, nil
+}
@@ -0,0 +1,95 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+type tenantRateLimiterMock struct {
+	waited []string
+}
+
+func (l *tenantRateLimiterMock) Wait(ctx context.Context, tenantID string) error {
+	l.waited = append(l.waited, tenantID)
+	return nil
+}
+
+func newTenantMessage(tenantID string) *message.Message {
+	msg := message.NewMessage("1", nil)
+	msg.Metadata.Set(middleware.TenantIDMetadataKey, tenantID)
+	return msg
+}
+
+func TestTenantRouter_handler_factory(t *testing.T) {
+	handledBy := map[string][]string{}
+	createdHandlers := 0
+	rateLimiter := &tenantRateLimiterMock{}
+
+	tenantRouter, err := middleware.NewTenantRouter(middleware.TenantRouterConfig{
+		HandlerFactory: func(tenantID string, h message.HandlerFunc) (message.HandlerFunc, error) {
+			createdHandlers++
+			return func(msg *message.Message) ([]*message.Message, error) {
+				handledBy[tenantID] = append(handledBy[tenantID], msg.Metadata.Get(middleware.TenantIDMetadataKey))
+				return h(msg)
+			}, nil
+		},
+		RateLimiter: rateLimiter,
+	})
+	require.NoError(t, err)
+
+	h := tenantRouter.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return []*message.Message{message.NewMessage("2", nil)}, nil
+	})
+
+	for _, tenantID := range []string{"tenant_1", "tenant_2", "tenant_1"} {
+		produced, err := h(newTenantMessage(tenantID))
+		require.NoError(t, err)
+		require.Len(t, produced, 1)
+		assert.Equal(t, tenantID, produced[0].Metadata.Get(middleware.TenantIDMetadataKey))
+	}
+
+	assert.Equal(t, 2, createdHandlers)
+	assert.Equal(t, map[string][]string{
+		"tenant_1": {"tenant_1", "tenant_1"},
+		"tenant_2": {"tenant_2"},
+	}, handledBy)
+	assert.Equal(t, []string{"tenant_1", "tenant_2", "tenant_1"}, rateLimiter.waited)
+}
+
+func TestTenantRouter_tenant_topic(t *testing.T) {
+	pub := &mockPublisher{behaviour: BehaviourAlwaysOK}
+
+	tenantRouter, err := middleware.NewTenantRouter(middleware.TenantRouterConfig{
+		TenantTopic: func(tenantID string) string {
+			return "events_" + tenantID
+		},
+		Publisher: pub,
+	})
+	require.NoError(t, err)
+
+	handlerCalled := false
+	msg := newTenantMessage("tenant_1")
+
+	_, err = tenantRouter.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		handlerCalled = true
+		return nil, nil
+	})(msg)
+	require.NoError(t, err)
+
+	assert.False(t, handlerCalled)
+	assert.Equal(t, []*message.Message{msg}, pub.PopMessages())
+}
+
+func TestTenantRouter_missing_tenant_id(t *testing.T) {
+	tenantRouter, err := middleware.NewTenantRouter(middleware.TenantRouterConfig{})
+	require.NoError(t, err)
+
+	_, err = tenantRouter.Middleware(handlerFuncAlwaysOK)(message.NewMessage("1", nil))
+	assert.Equal(t, middleware.ErrMissingTenantID, err)
+}
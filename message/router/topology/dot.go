@@ -0,0 +1,80 @@
+// Package topology exports the topology of the Router's handlers, for example to generate architecture diagrams.
+package topology
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// ExportDOT returns the topology of the router's handlers in the Graphviz DOT format.
+//
+// Topics are rendered as ellipses and handlers as boxes, with edges from the subscribed topic to the handler
+// and from the handler to the topic to which it publishes.
+// The output can be rendered with `dot -Tsvg topology.dot -o topology.svg`.
+func ExportDOT(router *message.Router) string {
+	return HandlersDOT(router.Handlers())
+}
+
+// HandlersDOT returns the topology of handlers in the Graphviz DOT format. See ExportDOT.
+func HandlersDOT(handlers []message.HandlerInfo) string {
+	topics := map[string]struct{}{}
+	for _, h := range handlers {
+		topics[h.SubscribeTopic] = struct{}{}
+		if h.PublishTopic != "" {
+			topics[h.PublishTopic] = struct{}{}
+		}
+	}
+
+	sortedTopics := make([]string, 0, len(topics))
+	for topic := range topics {
+		sortedTopics = append(sortedTopics, topic)
+	}
+	sort.Strings(sortedTopics)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("digraph watermill {\n")
+	buf.WriteString("\trankdir=LR;\n")
+
+	for _, topic := range sortedTopics {
+		fmt.Fprintf(buf, "\t%s [label=%s, shape=ellipse];\n", topicID(topic), strconv.Quote(topic))
+	}
+
+	for _, h := range handlers {
+		fmt.Fprintf(
+			buf,
+			"\t%s [label=%s, shape=box, tooltip=%s];\n",
+			handlerID(h.Name),
+			strconv.Quote(h.Name),
+			strconv.Quote(handlerTooltip(h)),
+		)
+		fmt.Fprintf(buf, "\t%s -> %s;\n", topicID(h.SubscribeTopic), handlerID(h.Name))
+		if h.PublishTopic != "" {
+			fmt.Fprintf(buf, "\t%s -> %s;\n", handlerID(h.Name), topicID(h.PublishTopic))
+		}
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
+
+// topics and handlers are prefixed, so a handler can have the same name as a topic
+func topicID(topic string) string {
+	return strconv.Quote("topic:" + topic)
+}
+
+func handlerID(name string) string {
+	return strconv.Quote("handler:" + name)
+}
+
+func handlerTooltip(h message.HandlerInfo) string {
+	tooltip := "subscriber: " + h.SubscriberName
+	if h.HasPublisher() {
+		tooltip += "\npublisher: " + h.PublisherName
+	}
+	return tooltip
+}
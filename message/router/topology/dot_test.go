@@ -0,0 +1,49 @@
+package topology_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/topology"
+)
+
+func TestHandlersDOT(t *testing.T) {
+	dot := topology.HandlersDOT([]message.HandlerInfo{
+		{
+			Name:           "orders",
+			SubscribeTopic: "orders",
+			SubscriberName: "kafka.Subscriber",
+			PublishTopic:   "invoices",
+			PublisherName:  "kafka.Publisher",
+		},
+		{
+			Name:           "mailer",
+			SubscribeTopic: "invoices",
+			SubscriberName: "kafka.Subscriber",
+		},
+		{
+			// publishes only to topics chosen with SendTo
+			Name:           "dispatcher",
+			SubscribeTopic: "orders",
+			SubscriberName: "kafka.Subscriber",
+			PublisherName:  "kafka.Publisher",
+		},
+	})
+
+	expected := `digraph watermill {
+	rankdir=LR;
+	"topic:invoices" [label="invoices", shape=ellipse];
+	"topic:orders" [label="orders", shape=ellipse];
+	"handler:orders" [label="orders", shape=box, tooltip="subscriber: kafka.Subscriber\npublisher: kafka.Publisher"];
+	"topic:orders" -> "handler:orders";
+	"handler:orders" -> "topic:invoices";
+	"handler:mailer" [label="mailer", shape=box, tooltip="subscriber: kafka.Subscriber"];
+	"topic:invoices" -> "handler:mailer";
+	"handler:dispatcher" [label="dispatcher", shape=box, tooltip="subscriber: kafka.Subscriber\npublisher: kafka.Publisher"];
+	"topic:orders" -> "handler:dispatcher";
+}
+`
+	assert.Equal(t, expected, dot)
+}
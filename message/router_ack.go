@@ -0,0 +1,42 @@
+package message
+
+// AckMode defines when the handler's messages are acked.
+type AckMode int
+
+const (
+	// AckAfterHandler acks the message after the handler returned no error and the produced messages were published.
+	// It provides at-least-once delivery. It's the default mode.
+	AckAfterHandler AckMode = iota
+
+	// AckOnReceive acks the message before the handler is called. It provides at-most-once delivery:
+	// the message is not redelivered, when the handler fails.
+	//
+	// Please keep in mind, that some subscribers cancel the message's context after the ack.
+	AckOnReceive
+
+	// AckManual leaves acking to the handler, which must call msg.Ack() or msg.Nack() explicitly,
+	// possibly after it returned (for example, when the work is completed by an external executor).
+	//
+	// The message is still nacked, when the handler returns an error (unless the ErrorHandler decides otherwise),
+	// panics or the produced messages cannot be published.
+	// Router doesn't wait for messages which are not acked yet when closing.
+	AckManual
+)
+
+func (m AckMode) String() string {
+	switch m {
+	case AckAfterHandler:
+		return "ack_after_handler"
+	case AckOnReceive:
+		return "ack_on_receive"
+	case AckManual:
+		return "ack_manual"
+	default:
+		return "unknown"
+	}
+}
+
+// SetAckMode sets when the handler's messages are acked. Defaults to AckAfterHandler.
+func (h *Handler) SetAckMode(mode AckMode) {
+	h.handler.ackMode = mode
+}
@@ -0,0 +1,90 @@
+package message
+
+import (
+	"sort"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// TopicDirection tells if the handler subscribes or publishes to the topic.
+type TopicDirection string
+
+const (
+	TopicDirectionSubscribe TopicDirection = "subscribe"
+	TopicDirectionPublish   TopicDirection = "publish"
+)
+
+// TopicAccess describes the access of the handler to the topic.
+type TopicAccess struct {
+	HandlerName string
+	Topic       string
+	Direction   TopicDirection
+}
+
+// Authorizer decides if the handler is allowed to subscribe or publish to the topic.
+//
+// It allows to enforce at runtime, which services may use which topics.
+type Authorizer interface {
+	// Authorize returns an error, when the access is denied.
+	Authorize(access TopicAccess) error
+}
+
+// AuthorizerFunc allows to use a function as Authorizer.
+type AuthorizerFunc func(access TopicAccess) error
+
+func (f AuthorizerFunc) Authorize(access TopicAccess) error {
+	return f(access)
+}
+
+// authorizeHandlers checks the access of all handlers to their topics with RouterConfig.Authorizer.
+// Denials of all handlers are returned together.
+func (r *Router) authorizeHandlers() error {
+	if r.config.Authorizer == nil {
+		return nil
+	}
+
+	handlerNames := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		handlerNames = append(handlerNames, name)
+	}
+	sort.Strings(handlerNames)
+
+	var result error
+
+	for _, name := range handlerNames {
+		h := r.handlers[name]
+
+		accesses := []TopicAccess{{HandlerName: name, Topic: h.subscribeTopic, Direction: TopicDirectionSubscribe}}
+		// handlers publishing only with SendTo have no publish topic, their topics are authorized when publishing
+		if h.publisherName != disabledPublisherName && h.publishTopic != "" {
+			accesses = append(accesses, TopicAccess{HandlerName: name, Topic: h.publishTopic, Direction: TopicDirectionPublish})
+		}
+
+		for _, access := range accesses {
+			if err := r.config.Authorizer.Authorize(access); err != nil {
+				result = multierror.Append(
+					result,
+					errors.Wrapf(err, "handler %s is not allowed to %s topic %s", name, access.Direction, access.Topic),
+				)
+			}
+		}
+	}
+
+	return result
+}
+
+// authorizeDestination checks the access of the handler to the topic chosen with SendTo.
+// The publish topic of the handler is already authorized, when the router is started.
+func (h *handler) authorizeDestination(topic string) error {
+	if h.authorizer == nil || topic == h.publishTopic || h.publisherName == disabledPublisherName {
+		return nil
+	}
+
+	access := TopicAccess{HandlerName: h.name, Topic: topic, Direction: TopicDirectionPublish}
+	if err := h.authorizer.Authorize(access); err != nil {
+		return errors.Wrapf(err, "handler %s is not allowed to %s topic %s", h.name, access.Direction, topic)
+	}
+
+	return nil
+}
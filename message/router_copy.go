@@ -0,0 +1,103 @@
+package message
+
+import (
+	"context"
+	"sync"
+)
+
+// CopyMessages makes the handler receive its own copy of every message (see Message.Copy),
+// with the ack or nack of the copy forwarded to the original message.
+//
+// It should be used, when the same Message instances are delivered to multiple handlers
+// (for example by a subscriber shared by many handlers), so handlers modifying the metadata
+// or the payload don't affect each other.
+func (h *Handler) CopyMessages() {
+	h.handler.copyMessages = true
+}
+
+type copyMessagesSubscriberDecorator struct {
+	sub Subscriber
+
+	subscribeWg sync.WaitGroup
+	closing     chan struct{}
+	closeOnce   sync.Once
+}
+
+func newCopyMessagesSubscriberDecorator(sub Subscriber) *copyMessagesSubscriberDecorator {
+	return &copyMessagesSubscriberDecorator{
+		sub:     sub,
+		closing: make(chan struct{}),
+	}
+}
+
+func (c *copyMessagesSubscriberDecorator) Subscribe(ctx context.Context, topic string) (<-chan *Message, error) {
+	in, err := c.sub.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *Message)
+	c.subscribeWg.Add(1)
+	go func() {
+		defer c.subscribeWg.Done()
+		defer close(out)
+
+		for {
+			var msg *Message
+			var ok bool
+
+			select {
+			case msg, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-c.closing:
+				return
+			}
+
+			msgCopy := msg.Copy()
+			msgCopy.SetContext(msg.Context())
+
+			select {
+			case out <- msgCopy:
+			case <-c.closing:
+				return
+			case <-ctx.Done():
+				return
+			}
+
+			c.subscribeWg.Add(1)
+			go func() {
+				defer c.subscribeWg.Done()
+				c.forwardAck(ctx, msgCopy, msg)
+			}()
+		}
+	}()
+
+	return out, nil
+}
+
+func (c *copyMessagesSubscriberDecorator) Close() error {
+	// acks are still forwarded while the underlying subscriber is closing, as it may wait for them
+	err := c.sub.Close()
+	c.closeOnce.Do(func() {
+		close(c.closing)
+	})
+
+	c.subscribeWg.Wait()
+	return err
+}
+
+// forwardAck acks or nacks the original message, when the copy was acked or nacked.
+// It stops waiting, when the subscription is done, so copies which are never acked
+// (for example with AckManual) don't leak.
+func (c *copyMessagesSubscriberDecorator) forwardAck(ctx context.Context, msgCopy *Message, original *Message) {
+	select {
+	case <-msgCopy.Acked():
+		original.Ack()
+	case <-msgCopy.Nacked():
+		original.Nack()
+	case <-ctx.Done():
+	case <-c.closing:
+	}
+}
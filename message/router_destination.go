@@ -0,0 +1,53 @@
+package message
+
+// DestinationTopicMetadataKey is the metadata key with the topic, to which the Router publishes
+// the message returned by the handler, instead of the publish topic of the handler.
+const DestinationTopicMetadataKey = "destination_topic"
+
+// SendTo marks the message returned by the handler to be published to the topic,
+// instead of the publish topic of the handler. It returns the same message.
+//
+// It allows a single handler to produce messages to many topics, without capturing the Publisher in a closure:
+//
+//	func(msg *message.Message) ([]*message.Message, error) {
+//		return []*message.Message{
+//			message.SendTo("orders_confirmed", confirmed),
+//			message.SendTo("emails_to_send", email),
+//		}, nil
+//	}
+//
+// The messages are published with the publisher of the handler, so it doesn't work in handlers added with
+// AddNoPublisherHandler. DestinationTopicMetadataKey is removed from the metadata before publishing.
+func SendTo(topic string, msg *Message) *Message {
+	msg.Metadata.Set(DestinationTopicMetadataKey, topic)
+	return msg
+}
+
+// destinationTopics returns topics to which the produced messages are published.
+// It returns ErrOutputInNoPublisherHandler, when the message is not marked with SendTo
+// and the handler has no publish topic, or the error of RouterConfig.Authorizer,
+// when the handler is not allowed to publish to the topic chosen with SendTo.
+func (h *handler) destinationTopics(producedMessages Messages) ([]string, error) {
+	topics := make([]string, len(producedMessages))
+
+	for i, msg := range producedMessages {
+		topic := msg.Metadata.Get(DestinationTopicMetadataKey)
+		if topic == "" {
+			topic = h.publishTopic
+		}
+		if topic == "" {
+			return nil, ErrOutputInNoPublisherHandler
+		}
+		if err := h.authorizeDestination(topic); err != nil {
+			return nil, err
+		}
+
+		topics[i] = topic
+	}
+
+	for _, msg := range producedMessages {
+		delete(msg.Metadata, DestinationTopicMetadataKey)
+	}
+
+	return topics, nil
+}
@@ -0,0 +1,119 @@
+package message
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// ErrorAction determines what the Router does with the message, when the handler returned an error.
+type ErrorAction int
+
+const (
+	// ErrorActionNack nacks the message, so it is redelivered by the Pub/Sub. It is the default action.
+	ErrorActionNack ErrorAction = iota
+	// ErrorActionAck acks the message, so the error is ignored.
+	ErrorActionAck
+	// ErrorActionRetry runs the handler again with the same message.
+	// ErrorHandler is responsible for limiting retries, RetriesFromCtx returns the number of retries done.
+	ErrorActionRetry
+	// ErrorActionDeadLetter publishes the message to the dead letter topic and acks it.
+	// The dead letter topic is configured with Router.SetDeadLetterPublisher.
+	ErrorActionDeadLetter
+)
+
+func (a ErrorAction) String() string {
+	switch a {
+	case ErrorActionNack:
+		return "nack"
+	case ErrorActionAck:
+		return "ack"
+	case ErrorActionRetry:
+		return "retry"
+	case ErrorActionDeadLetter:
+		return "dead_letter"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrorHandler decides what to do with the message, when the handler returned an error.
+type ErrorHandler func(msg *Message, err error, handlerName string) ErrorAction
+
+const (
+	// DeadLetterReasonMetadataKey is the metadata key with the error, because of which the message was dead-lettered.
+	DeadLetterReasonMetadataKey = "dead_letter_reason"
+	// DeadLetterHandlerMetadataKey is the metadata key with the name of the handler, which failed to handle the message.
+	DeadLetterHandlerMetadataKey = "dead_letter_handler"
+	// DeadLetterTopicMetadataKey is the metadata key with the topic, from which the handler received the message.
+	DeadLetterTopicMetadataKey = "dead_letter_topic"
+)
+
+const retriesKey ctxKey = "retries"
+
+// RetriesFromCtx returns how many times the handler was retried with the message, because of ErrorActionRetry.
+func RetriesFromCtx(ctx context.Context) int {
+	retries, _ := ctx.Value(retriesKey).(int)
+	return retries
+}
+
+// SetErrorHandler sets the ErrorHandler used by all handlers, which don't have their own ErrorHandler.
+//
+// When no ErrorHandler is set, messages are nacked when the handler returns an error.
+func (r *Router) SetErrorHandler(errorHandler ErrorHandler) {
+	r.errorHandler = errorHandler
+}
+
+// SetDeadLetterPublisher sets the publisher and the topic used for ErrorActionDeadLetter.
+func (r *Router) SetDeadLetterPublisher(publisher Publisher, topic string) {
+	r.deadLetterPublisher = publisher
+	r.deadLetterTopic = topic
+}
+
+// SetErrorHandler sets the ErrorHandler of the handler, overriding the Router's ErrorHandler.
+func (h *Handler) SetErrorHandler(errorHandler ErrorHandler) {
+	h.handler.errorHandler = errorHandler
+}
+
+// handleError executes the ErrorAction for the message.
+// It returns true, when the handler should be retried.
+func (h *handler) handleError(msg *Message, err error, msgFields watermill.LogFields) (retry bool) {
+	action := ErrorActionNack
+	if h.errorHandler != nil {
+		action = h.errorHandler(msg, err, h.name)
+	}
+
+	h.logger.Error("Handler returned error", err, msgFields.Add(watermill.LogFields{
+		"error_action": action.String(),
+	}))
+
+	switch action {
+	case ErrorActionAck:
+		msg.Ack()
+	case ErrorActionRetry:
+		msg.SetContext(context.WithValue(msg.Context(), retriesKey, RetriesFromCtx(msg.Context())+1))
+		return true
+	case ErrorActionDeadLetter:
+		if h.deadLetterPublisher == nil {
+			h.logger.Error("Dead letter publisher is not set, nacking message", err, msgFields)
+			msg.Nack()
+			break
+		}
+
+		msg.Metadata.Set(DeadLetterReasonMetadataKey, err.Error())
+		msg.Metadata.Set(DeadLetterHandlerMetadataKey, h.name)
+		msg.Metadata.Set(DeadLetterTopicMetadataKey, h.subscribeTopic)
+
+		if publishErr := h.deadLetterPublisher.Publish(h.deadLetterTopic, msg); publishErr != nil {
+			h.logger.Error("Cannot publish message to dead letter topic", publishErr, msgFields)
+			msg.Nack()
+			break
+		}
+
+		msg.Ack()
+	default:
+		msg.Nack()
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package message
+
+import (
+	"hash/fnv"
+)
+
+// OrderingKeyFunc returns the ordering key of the message.
+// Messages with the same ordering key are processed by the handler sequentially.
+type OrderingKeyFunc func(msg *Message) string
+
+// OrderingKeyFromMetadata returns OrderingKeyFunc which uses the value of the metadata key as the ordering key.
+func OrderingKeyFromMetadata(key string) OrderingKeyFunc {
+	return func(msg *Message) string {
+		return msg.Metadata.Get(key)
+	}
+}
+
+// ProcessInOrder makes the handler process messages with the same ordering key sequentially,
+// in the order in which they were received from the subscriber.
+// Messages with different ordering keys are processed in parallel by up to workersCount workers.
+//
+// Messages with an empty ordering key are processed without any ordering guarantees.
+//
+// Please keep in mind, that the handler can process messages in parallel only when the subscriber
+// is sending the next message before the previous one was acked.
+func (h *Handler) ProcessInOrder(orderingKey OrderingKeyFunc, workersCount int) {
+	if orderingKey == nil {
+		panic("orderingKey function is nil")
+	}
+	if workersCount <= 0 {
+		panic("workersCount must be positive")
+	}
+
+	h.handler.orderingKey = orderingKey
+	h.handler.orderingWorkersCount = workersCount
+}
+
+// orderedWorkers is a keyed worker pool.
+// All messages with the same key are processed by the same worker, one by one.
+type orderedWorkers struct {
+	workers []chan *Message
+}
+
+func newOrderedWorkers(count int, process func(msg *Message)) *orderedWorkers {
+	w := &orderedWorkers{
+		workers: make([]chan *Message, count),
+	}
+
+	for i := range w.workers {
+		messages := make(chan *Message)
+		w.workers[i] = messages
+
+		go func() {
+			for msg := range messages {
+				process(msg)
+			}
+		}()
+	}
+
+	return w
+}
+
+// dispatch sends the message to the worker assigned to the key.
+// It blocks until the worker is ready to process the message.
+func (w *orderedWorkers) dispatch(key string, msg *Message) {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+
+	w.workers[hash.Sum32()%uint32(len(w.workers))] <- msg
+}
+
+func (w *orderedWorkers) close() {
+	for _, messages := range w.workers {
+		close(messages)
+	}
+}
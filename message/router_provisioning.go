@@ -0,0 +1,64 @@
+package message
+
+import (
+	"context"
+	"sort"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// Provision initializes subscriptions of all handlers with subscribers implementing SubscribeInitializer,
+// for example it creates the topics and the subscriptions needed by the handlers.
+//
+// All handlers are provisioned, even when some of them fail, so errors of all handlers are returned together.
+func (r *Router) Provision(ctx context.Context) error {
+	handlerNames := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		handlerNames = append(handlerNames, name)
+	}
+	sort.Strings(handlerNames)
+
+	var result error
+
+	for _, name := range handlerNames {
+		if err := ctx.Err(); err != nil {
+			return multierror.Append(result, errors.Wrap(err, "provisioning interrupted"))
+		}
+
+		h := r.handlers[name]
+
+		initializer, ok := h.subscriber.(SubscribeInitializer)
+		if !ok {
+			continue
+		}
+
+		r.logger.Debug("Provisioning handler", watermill.LogFields{
+			"handler_name": name,
+			"topic":        h.subscribeTopic,
+		})
+
+		if err := initializer.SubscribeInitialize(h.subscribeTopic); err != nil {
+			result = multierror.Append(
+				result,
+				errors.Wrapf(err, "cannot provision handler %s, topic %s", name, h.subscribeTopic),
+			)
+		}
+	}
+
+	return result
+}
+
+// RunWithProvisioning provisions all handlers with Provision and runs the router.
+//
+// When provisioning of any handler fails, the router is not started
+// and the error with failures of all handlers is returned.
+func (r *Router) RunWithProvisioning(ctx context.Context) error {
+	if err := r.Provision(ctx); err != nil {
+		return errors.Wrap(err, "provisioning failed")
+	}
+
+	return r.Run()
+}
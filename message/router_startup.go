@@ -0,0 +1,233 @@
+package message
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// ErrStartupTimeout happens when handlers didn't become ready within RouterConfig.StartupTimeout.
+var ErrStartupTimeout = errors.New("router startup timeout")
+
+// errClosedDuringStartup is returned internally, when the router was closed while waiting for handlers.
+var errClosedDuringStartup = errors.New("router closed during startup")
+
+// ReadinessPredicate returns true, when the condition of the startup is met,
+// for example when the projection has caught up with the events.
+// An error stops the startup of the router.
+type ReadinessPredicate func(ctx context.Context) (bool, error)
+
+// StartAfter makes the handler start only after all of the handlers are ready (see SetReadiness),
+// for example command handlers can start after the projections were rebuilt.
+//
+// The Router starts the handlers in phases: handlers without dependencies are started first,
+// then the handlers depending only on them, and so on. Dependency cycles and unknown handlers
+// are reported by Router.Run.
+func (h *Handler) StartAfter(handlerNames ...string) {
+	h.handler.startAfter = append(h.handler.startAfter, handlerNames...)
+}
+
+// StartWhen makes the handler start only after the predicate returns true.
+// It is checked every RouterConfig.ReadinessCheckInterval.
+func (h *Handler) StartWhen(predicate ReadinessPredicate) {
+	if predicate == nil {
+		panic("predicate is nil")
+	}
+
+	h.handler.startWhen = append(h.handler.startWhen, predicate)
+}
+
+// SetReadiness sets the predicate telling that the handler is ready, so handlers started after it (see StartAfter)
+// can be started. By default, the handler is ready as soon as it is running.
+func (h *Handler) SetReadiness(predicate ReadinessPredicate) {
+	if predicate == nil {
+		panic("predicate is nil")
+	}
+
+	h.handler.readiness = predicate
+}
+
+// ReadyWhenIdle makes the handler ready, when it has no messages in flight and received no messages
+// for the idle duration. It's a simple way to tell that the handler has caught up with the backlog of the topic.
+func (h *Handler) ReadyWhenIdle(idle time.Duration) {
+	tracker := &idleTracker{}
+	h.handler.idleTracker = tracker
+
+	h.SetReadiness(func(ctx context.Context) (bool, error) {
+		return tracker.idleFor(idle), nil
+	})
+}
+
+// idleTracker tracks the activity of the handler.
+type idleTracker struct {
+	inFlight     int64
+	lastActivity int64
+}
+
+func (t *idleTracker) start() {
+	atomic.StoreInt64(&t.lastActivity, time.Now().UnixNano())
+}
+
+func (t *idleTracker) received() {
+	atomic.AddInt64(&t.inFlight, 1)
+	atomic.StoreInt64(&t.lastActivity, time.Now().UnixNano())
+}
+
+func (t *idleTracker) processed() {
+	atomic.StoreInt64(&t.lastActivity, time.Now().UnixNano())
+	atomic.AddInt64(&t.inFlight, -1)
+}
+
+func (t *idleTracker) idleFor(idle time.Duration) bool {
+	if atomic.LoadInt64(&t.inFlight) > 0 {
+		return false
+	}
+
+	lastActivity := time.Unix(0, atomic.LoadInt64(&t.lastActivity))
+	return time.Since(lastActivity) >= idle
+}
+
+// startupPhases groups the handlers into phases, in which they are started.
+// Handlers of every phase depend only on handlers of the previous phases.
+func (r *Router) startupPhases() ([][]*handler, error) {
+	levels := map[string]int{}
+	visiting := map[string]bool{}
+
+	var level func(name string, path []string) (int, error)
+	level = func(name string, path []string) (int, error) {
+		if l, ok := levels[name]; ok {
+			return l, nil
+		}
+		if visiting[name] {
+			return 0, errors.Errorf("dependency cycle: %v", append(path, name))
+		}
+		visiting[name] = true
+
+		l := 0
+		for _, dependency := range r.handlers[name].startAfter {
+			if _, ok := r.handlers[dependency]; !ok {
+				return 0, errors.Errorf("handler %s starts after unknown handler %s", name, dependency)
+			}
+
+			dependencyLevel, err := level(dependency, append(path, name))
+			if err != nil {
+				return 0, err
+			}
+			if dependencyLevel+1 > l {
+				l = dependencyLevel + 1
+			}
+		}
+
+		visiting[name] = false
+		levels[name] = l
+
+		return l, nil
+	}
+
+	handlerNames := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		handlerNames = append(handlerNames, name)
+	}
+	sort.Strings(handlerNames)
+
+	var phases [][]*handler
+	for _, name := range handlerNames {
+		l, err := level(name, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for len(phases) <= l {
+			phases = append(phases, nil)
+		}
+		phases[l] = append(phases[l], r.handlers[name])
+	}
+
+	return phases, nil
+}
+
+// startupContext returns the context of the startup, which is canceled after StartupTimeout
+// or when the router is closed.
+func (r *Router) startupContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if r.config.StartupTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), r.config.StartupTimeout)
+	}
+
+	go func() {
+		select {
+		case <-r.closeCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// waitForPhase waits until the dependencies and the predicates of all handlers of the phase are ready.
+func (r *Router) waitForPhase(ctx context.Context, phase []*handler) error {
+	for _, h := range phase {
+		for _, dependency := range h.startAfter {
+			r.logger.Debug("Waiting for handler dependency", watermill.LogFields{
+				"handler_name": h.name,
+				"dependency":   dependency,
+			})
+
+			if err := r.waitUntil(ctx, r.handlers[dependency].ready); err != nil {
+				return errors.Wrapf(err, "handler %s cannot start after %s", h.name, dependency)
+			}
+		}
+
+		for _, predicate := range h.startWhen {
+			if err := r.waitUntil(ctx, predicate); err != nil {
+				return errors.Wrapf(err, "handler %s cannot start", h.name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// waitUntil checks the predicate every ReadinessCheckInterval, until it returns true.
+func (r *Router) waitUntil(ctx context.Context, predicate ReadinessPredicate) error {
+	ticker := time.NewTicker(r.config.ReadinessCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		ready, err := predicate(ctx)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.closeCh:
+			return errClosedDuringStartup
+		case <-ctx.Done():
+			select {
+			case <-r.closeCh:
+				return errClosedDuringStartup
+			default:
+				return ErrStartupTimeout
+			}
+		}
+	}
+}
+
+// ready returns true, when handlers started after the handler can be started.
+func (h *handler) ready(ctx context.Context) (bool, error) {
+	if h.readiness == nil {
+		return true, nil
+	}
+
+	return h.readiness(ctx)
+}
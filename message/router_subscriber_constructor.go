@@ -0,0 +1,53 @@
+package message
+
+import (
+	"github.com/pkg/errors"
+)
+
+// SubscriberConstructor creates a separate Subscriber for every handler.
+//
+// It allows every handler to have its own consumer group, durable name or connection,
+// for example derived from the handler's name.
+type SubscriberConstructor func(handlerName string) (Subscriber, error)
+
+// AddHandlerWithSubscriberConstructor works like AddHandler,
+// but the handler's Subscriber is created with subscriberConstructor.
+//
+// Like any other handler's subscriber, the created Subscriber is closed when the Router is closed.
+func (r *Router) AddHandlerWithSubscriberConstructor(
+	handlerName string,
+	subscribeTopic string,
+	subscriberConstructor SubscriberConstructor,
+	publishTopic string,
+	publisher Publisher,
+	handlerFunc HandlerFunc,
+) (*Handler, error) {
+	if _, ok := r.handlers[handlerName]; ok {
+		return nil, DuplicateHandlerNameError{handlerName}
+	}
+
+	subscriber, err := subscriberConstructor(handlerName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create subscriber for handler %s", handlerName)
+	}
+
+	return r.AddHandler(handlerName, subscribeTopic, subscriber, publishTopic, publisher, handlerFunc), nil
+}
+
+// AddNoPublisherHandlerWithSubscriberConstructor works like AddNoPublisherHandler,
+// but the handler's Subscriber is created with subscriberConstructor.
+func (r *Router) AddNoPublisherHandlerWithSubscriberConstructor(
+	handlerName string,
+	subscribeTopic string,
+	subscriberConstructor SubscriberConstructor,
+	handlerFunc HandlerFunc,
+) (*Handler, error) {
+	return r.AddHandlerWithSubscriberConstructor(
+		handlerName,
+		subscribeTopic,
+		subscriberConstructor,
+		"",
+		disabledPublisher{},
+		handlerFunc,
+	)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/ThreeDotsLabs/watermill/internal/tests"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/message/subscriber"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -437,6 +438,116 @@ func TestRouterDecoratorsOrder(t *testing.T) {
 	assert.Equal(t, "foobar", transformedMessage.Metadata.Get("sub"))
 }
 
+type noAckWaitSubscriber struct {
+	messagesToSend []*message.Message
+	closing        chan struct{}
+}
+
+func newNoAckWaitSubscriber(messagesToSend []*message.Message) *noAckWaitSubscriber {
+	return &noAckWaitSubscriber{messagesToSend, make(chan struct{})}
+}
+
+func (m *noAckWaitSubscriber) Subscribe(_ context.Context, topic string) (<-chan *message.Message, error) {
+	out := make(chan *message.Message)
+
+	go func() {
+		defer close(out)
+
+		for _, msg := range m.messagesToSend {
+			select {
+			case out <- msg:
+			case <-m.closing:
+				return
+			}
+		}
+
+		<-m.closing
+	}()
+
+	return out, nil
+}
+
+func (m *noAckWaitSubscriber) Close() error {
+	close(m.closing)
+	return nil
+}
+
+func TestRouter_ProcessInOrder(t *testing.T) {
+	keys := []string{"a", "b", "c", "d"}
+	messagesPerKey := 20
+
+	var messagesToSend []*message.Message
+	for i := 0; i < messagesPerKey; i++ {
+		for _, key := range keys {
+			msg := message.NewMessage(fmt.Sprintf("%s_%d", key, i), nil)
+			msg.Metadata.Set("key", key)
+			messagesToSend = append(messagesToSend, msg)
+		}
+	}
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NewStdLogger(true, true))
+	require.NoError(t, err)
+
+	lock := sync.Mutex{}
+	processing := map[string]bool{}
+	processed := map[string][]string{}
+	allProcessed := make(chan struct{})
+
+	router.AddNoPublisherHandler(
+		"handler",
+		"topic",
+		newNoAckWaitSubscriber(messagesToSend),
+		func(msg *message.Message) ([]*message.Message, error) {
+			key := msg.Metadata.Get("key")
+
+			lock.Lock()
+			assert.False(t, processing[key], "messages with key %s are processed in parallel", key)
+			processing[key] = true
+			lock.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			processing[key] = false
+			processed[key] = append(processed[key], msg.UUID)
+
+			if len(processed) == len(keys) {
+				for _, key := range keys {
+					if len(processed[key]) != messagesPerKey {
+						return nil, nil
+					}
+				}
+				close(allProcessed)
+			}
+
+			return nil, nil
+		},
+	).ProcessInOrder(message.OrderingKeyFromMetadata("key"), 2)
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		assert.NoError(t, router.Close())
+	}()
+
+	select {
+	case <-allProcessed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("test timed out")
+	}
+
+	for _, key := range keys {
+		var expectedOrder []string
+		for i := 0; i < messagesPerKey; i++ {
+			expectedOrder = append(expectedOrder, fmt.Sprintf("%s_%d", key, i))
+		}
+		assert.Equal(t, expectedOrder, processed[key])
+	}
+}
+
 func createBenchSubscriber(b *testing.B) benchMockSubscriber {
 	var messagesToSend []*message.Message
 	for i := 0; i < b.N; i++ {
@@ -496,3 +607,791 @@ func readMessages(messagesCh <-chan *message.Message, limit int, timeout time.Du
 
 	return receivedMessages, len(receivedMessages) == limit
 }
+
+func TestRouter_SetErrorHandler(t *testing.T) {
+	handlerErr := errors.New("handler error")
+
+	testCases := []struct {
+		Name         string
+		Action       message.ErrorAction
+		ExpectedAck  bool
+		DeadLettered bool
+	}{
+		{Name: "nack", Action: message.ErrorActionNack, ExpectedAck: false},
+		{Name: "ack", Action: message.ErrorActionAck, ExpectedAck: true},
+		{Name: "dead_letter", Action: message.ErrorActionDeadLetter, ExpectedAck: true, DeadLettered: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			router, err := message.NewRouter(message.RouterConfig{}, watermill.NewStdLogger(true, true))
+			require.NoError(t, err)
+
+			deadLetterPubSub := createPubSub()
+			router.SetDeadLetterPublisher(deadLetterPubSub, "dead_letter")
+			router.SetErrorHandler(func(msg *message.Message, err error, handlerName string) message.ErrorAction {
+				assert.Equal(t, handlerErr, err)
+				assert.Equal(t, "handler", handlerName)
+
+				return tc.Action
+			})
+
+			msg := message.NewMessage(watermill.NewUUID(), nil)
+			router.AddNoPublisherHandler(
+				"handler",
+				"topic",
+				newNoAckWaitSubscriber([]*message.Message{msg}),
+				func(msg *message.Message) ([]*message.Message, error) {
+					return nil, handlerErr
+				},
+			)
+
+			go func() {
+				require.NoError(t, router.Run())
+			}()
+			defer func() {
+				assert.NoError(t, router.Close())
+			}()
+
+			select {
+			case <-msg.Acked():
+				assert.True(t, tc.ExpectedAck, "message should be nacked")
+			case <-msg.Nacked():
+				assert.False(t, tc.ExpectedAck, "message should be acked")
+			case <-time.After(5 * time.Second):
+				t.Fatal("message not acked or nacked")
+			}
+
+			if tc.DeadLettered {
+				deadLettered, err := deadLetterPubSub.Subscribe(context.Background(), "dead_letter")
+				require.NoError(t, err)
+
+				received, all := readMessages(deadLettered, 1, time.Second)
+				require.True(t, all)
+				assert.Equal(t, handlerErr.Error(), received[0].Metadata.Get(message.DeadLetterReasonMetadataKey))
+				assert.Equal(t, "handler", received[0].Metadata.Get(message.DeadLetterHandlerMetadataKey))
+				assert.Equal(t, "topic", received[0].Metadata.Get(message.DeadLetterTopicMetadataKey))
+			}
+		})
+	}
+}
+
+func TestHandler_SetErrorHandler_retry(t *testing.T) {
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NewStdLogger(true, true))
+	require.NoError(t, err)
+
+	router.SetErrorHandler(func(msg *message.Message, err error, handlerName string) message.ErrorAction {
+		t.Fatal("router's error handler should be not called")
+		return message.ErrorActionNack
+	})
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	handlerCalls := 0
+
+	router.AddNoPublisherHandler(
+		"handler",
+		"topic",
+		newNoAckWaitSubscriber([]*message.Message{msg}),
+		func(msg *message.Message) ([]*message.Message, error) {
+			handlerCalls++
+			return nil, errors.New("handler error")
+		},
+	).SetErrorHandler(func(msg *message.Message, err error, handlerName string) message.ErrorAction {
+		if message.RetriesFromCtx(msg.Context()) < 2 {
+			return message.ErrorActionRetry
+		}
+
+		return message.ErrorActionNack
+	})
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		assert.NoError(t, router.Close())
+	}()
+
+	select {
+	case <-msg.Nacked():
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not nacked")
+	}
+
+	assert.Equal(t, 3, handlerCalls)
+}
+
+type initializingSubscriber struct {
+	benchMockSubscriber
+
+	failingTopics         map[string]bool
+	initializedTopics     []string
+	initializedTopicsLock sync.Mutex
+}
+
+func (s *initializingSubscriber) SubscribeInitialize(topic string) error {
+	s.initializedTopicsLock.Lock()
+	defer s.initializedTopicsLock.Unlock()
+
+	s.initializedTopics = append(s.initializedTopics, topic)
+
+	if s.failingTopics[topic] {
+		return errors.New("cannot create topic")
+	}
+	return nil
+}
+
+func TestRouter_Provision(t *testing.T) {
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	sub := &initializingSubscriber{failingTopics: map[string]bool{"topic_2": true, "topic_3": true}}
+
+	for _, topic := range []string{"topic_1", "topic_2", "topic_3"} {
+		router.AddNoPublisherHandler("handler_"+topic, topic, sub, func(msg *message.Message) ([]*message.Message, error) {
+			return nil, nil
+		})
+	}
+	router.AddNoPublisherHandler("not_initializing", "topic_4", benchMockSubscriber{}, func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	})
+
+	err = router.RunWithProvisioning(context.Background())
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "handler_topic_2")
+	assert.Contains(t, err.Error(), "handler_topic_3")
+	assert.Equal(t, []string{"topic_1", "topic_2", "topic_3"}, sub.initializedTopics)
+}
+
+func TestRouter_AddHandlerWithSubscriberConstructor(t *testing.T) {
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	var constructedFor []string
+	constructor := func(handlerName string) (message.Subscriber, error) {
+		constructedFor = append(constructedFor, handlerName)
+		if handlerName == "failing" {
+			return nil, errors.New("cannot connect")
+		}
+		return benchMockSubscriber{}, nil
+	}
+
+	handlerFunc := func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	}
+
+	_, err = router.AddNoPublisherHandlerWithSubscriberConstructor("handler_1", "topic", constructor, handlerFunc)
+	require.NoError(t, err)
+
+	_, err = router.AddHandlerWithSubscriberConstructor("handler_2", "topic", constructor, "", nopPublisher{}, handlerFunc)
+	require.NoError(t, err)
+
+	_, err = router.AddNoPublisherHandlerWithSubscriberConstructor("failing", "topic", constructor, handlerFunc)
+	assert.Error(t, err)
+
+	_, err = router.AddNoPublisherHandlerWithSubscriberConstructor("handler_1", "topic", constructor, handlerFunc)
+	assert.Equal(t, message.DuplicateHandlerNameError{HandlerName: "handler_1"}, err)
+
+	assert.Equal(t, []string{"handler_1", "handler_2", "failing"}, constructedFor)
+}
+
+func TestRouter_Handlers(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	router.AddHandler(
+		"b_handler",
+		"in_topic",
+		pubSub,
+		"out_topic",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) { return nil, nil },
+	)
+	router.AddNoPublisherHandler(
+		"a_handler",
+		"out_topic",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) { return nil, nil },
+	)
+
+	assert.Equal(
+		t,
+		[]message.HandlerInfo{
+			{
+				Name:           "a_handler",
+				SubscribeTopic: "out_topic",
+				SubscriberName: "gochannel.GoChannel",
+			},
+			{
+				Name:           "b_handler",
+				SubscribeTopic: "in_topic",
+				SubscriberName: "gochannel.GoChannel",
+				PublishTopic:   "out_topic",
+				PublisherName:  "gochannel.GoChannel",
+			},
+		},
+		router.Handlers(),
+	)
+}
+
+func TestRouter_CopyMessages(t *testing.T) {
+	originalMsg := message.NewMessage("1", []byte("foo"))
+	originalMsg.Metadata.Set("key", "value")
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	receivedMessages := make(chan *message.Message, 1)
+	router.AddNoPublisherHandler(
+		"handler",
+		"topic",
+		newNoAckWaitSubscriber([]*message.Message{originalMsg}),
+		func(msg *message.Message) ([]*message.Message, error) {
+			msg.Metadata.Set("key", "changed")
+			receivedMessages <- msg
+			return nil, nil
+		},
+	).CopyMessages()
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		assert.NoError(t, router.Close())
+	}()
+
+	select {
+	case receivedMsg := <-receivedMessages:
+		assert.False(t, receivedMsg == originalMsg, "handler should receive a copy of the message")
+		assert.Equal(t, "1", receivedMsg.UUID)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	select {
+	case <-originalMsg.Acked():
+		// ok
+	case <-time.After(time.Second):
+		t.Fatal("original message not acked")
+	}
+
+	assert.Equal(t, "value", originalMsg.Metadata.Get("key"))
+}
+
+func TestRouter_CopyMessages_not_acked_copy(t *testing.T) {
+	originalMsg := message.NewMessage("1", nil)
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	handled := make(chan struct{})
+	h := router.AddNoPublisherHandler(
+		"handler",
+		"topic",
+		newNoAckWaitSubscriber([]*message.Message{originalMsg}),
+		func(msg *message.Message) ([]*message.Message, error) {
+			close(handled)
+			return nil, nil
+		},
+	)
+	h.CopyMessages()
+	h.SetAckMode(message.AckManual)
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("message not handled")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		assert.NoError(t, router.Close())
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("router not closed, while the copy of the message is not acked")
+	}
+
+	select {
+	case <-originalMsg.Acked():
+		t.Fatal("original message should not be acked")
+	default:
+	}
+}
+
+func TestRouter_Authorizer(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+
+	var accesses []message.TopicAccess
+	router, err := message.NewRouter(message.RouterConfig{
+		Authorizer: message.AuthorizerFunc(func(access message.TopicAccess) error {
+			accesses = append(accesses, access)
+			if access.Topic == "forbidden_topic" {
+				return errors.New("access denied")
+			}
+			return nil
+		}),
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	router.AddHandler(
+		"handler",
+		"in_topic",
+		pubSub,
+		"forbidden_topic",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) { return nil, nil },
+	)
+	router.AddNoPublisherHandler(
+		"no_publisher_handler",
+		"in_topic",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) { return nil, nil },
+	)
+
+	err = router.Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "handler handler is not allowed to publish topic forbidden_topic")
+
+	assert.Equal(
+		t,
+		[]message.TopicAccess{
+			{HandlerName: "handler", Topic: "in_topic", Direction: message.TopicDirectionSubscribe},
+			{HandlerName: "handler", Topic: "forbidden_topic", Direction: message.TopicDirectionPublish},
+			{HandlerName: "no_publisher_handler", Topic: "in_topic", Direction: message.TopicDirectionSubscribe},
+		},
+		accesses,
+	)
+}
+
+func TestRouter_Authorizer_SendTo(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+
+	var accesses []message.TopicAccess
+	accessesLock := sync.Mutex{}
+
+	router, err := message.NewRouter(message.RouterConfig{
+		Authorizer: message.AuthorizerFunc(func(access message.TopicAccess) error {
+			accessesLock.Lock()
+			defer accessesLock.Unlock()
+
+			accesses = append(accesses, access)
+			if access.Topic == "forbidden_topic" {
+				return errors.New("access denied")
+			}
+			return nil
+		}),
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	msg := message.NewMessage("1", nil)
+
+	router.AddHandler(
+		"handler",
+		"in_topic",
+		newNoAckWaitSubscriber([]*message.Message{msg}),
+		"",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) {
+			return []*message.Message{
+				message.SendTo("allowed_topic", message.NewMessage("allowed", nil)),
+				message.SendTo("forbidden_topic", message.NewMessage("forbidden", nil)),
+			}, nil
+		},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	allowedMessages, err := pubSub.Subscribe(ctx, "allowed_topic")
+	require.NoError(t, err)
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		assert.NoError(t, router.Close())
+	}()
+
+	select {
+	case <-msg.Nacked():
+		// ok
+	case <-ctx.Done():
+		t.Fatal("message not nacked")
+	}
+
+	select {
+	case msg := <-allowedMessages:
+		t.Fatalf("message %s should not be published, when any topic is forbidden", msg.UUID)
+	default:
+	}
+
+	accessesLock.Lock()
+	defer accessesLock.Unlock()
+
+	assert.Equal(
+		t,
+		[]message.TopicAccess{
+			{HandlerName: "handler", Topic: "in_topic", Direction: message.TopicDirectionSubscribe},
+			{HandlerName: "handler", Topic: "allowed_topic", Direction: message.TopicDirectionPublish},
+			{HandlerName: "handler", Topic: "forbidden_topic", Direction: message.TopicDirectionPublish},
+		},
+		accesses,
+	)
+}
+
+func TestHandler_SetAckMode(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		AckMode     message.AckMode
+		HandlerErr  error
+		ExpectAcked bool
+	}{
+		{Name: "ack_on_receive_failed_handler", AckMode: message.AckOnReceive, HandlerErr: errors.New("failed"), ExpectAcked: true},
+		{Name: "ack_after_handler_failed_handler", AckMode: message.AckAfterHandler, HandlerErr: errors.New("failed"), ExpectAcked: false},
+		{Name: "manual_not_acked", AckMode: message.AckManual, ExpectAcked: false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			msg := message.NewMessage("1", nil)
+
+			router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+			require.NoError(t, err)
+
+			handled := make(chan struct{}, 1)
+			router.AddNoPublisherHandler(
+				"handler",
+				"topic",
+				newNoAckWaitSubscriber([]*message.Message{msg}),
+				func(msg *message.Message) ([]*message.Message, error) {
+					handled <- struct{}{}
+					return nil, tc.HandlerErr
+				},
+			).SetAckMode(tc.AckMode)
+
+			go func() {
+				require.NoError(t, router.Run())
+			}()
+			defer func() {
+				assert.NoError(t, router.Close())
+			}()
+
+			select {
+			case <-handled:
+			case <-time.After(time.Second):
+				t.Fatal("message not handled")
+			}
+
+			select {
+			case <-msg.Acked():
+				assert.True(t, tc.ExpectAcked, "message should not be acked")
+			case <-time.After(time.Millisecond * 100):
+				assert.False(t, tc.ExpectAcked, "message should be acked")
+			}
+		})
+	}
+}
+
+func TestHandler_SetAckMode_manual(t *testing.T) {
+	msg := message.NewMessage("1", nil)
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	pending := make(chan *message.Message, 1)
+	router.AddNoPublisherHandler(
+		"handler",
+		"topic",
+		newNoAckWaitSubscriber([]*message.Message{msg}),
+		func(msg *message.Message) ([]*message.Message, error) {
+			// the work is completed later, after the handler returned
+			pending <- msg
+			return nil, nil
+		},
+	).SetAckMode(message.AckManual)
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		assert.NoError(t, router.Close())
+	}()
+
+	var pendingMsg *message.Message
+	select {
+	case pendingMsg = <-pending:
+	case <-time.After(time.Second):
+		t.Fatal("message not handled")
+	}
+
+	select {
+	case <-msg.Acked():
+		t.Fatal("message should not be acked before the work is completed")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	pendingMsg.Ack()
+
+	select {
+	case <-msg.Acked():
+	case <-time.After(time.Second):
+		t.Fatal("message not acked")
+	}
+}
+
+func TestHandler_StartAfter(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{Persistent: true}, watermill.NopLogger{})
+
+	router, err := message.NewRouter(message.RouterConfig{
+		ReadinessCheckInterval: time.Millisecond * 10,
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	projectionReady := make(chan struct{})
+	router.AddNoPublisherHandler(
+		"projection",
+		"events",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) { return nil, nil },
+	).SetReadiness(func(ctx context.Context) (bool, error) {
+		select {
+		case <-projectionReady:
+			return true, nil
+		default:
+			return false, nil
+		}
+	})
+
+	commandsHandled := make(chan struct{}, 1)
+	router.AddNoPublisherHandler(
+		"commands",
+		"commands",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) {
+			commandsHandled <- struct{}{}
+			return nil, nil
+		},
+	).StartAfter("projection")
+
+	require.NoError(t, pubSub.Publish("commands", message.NewMessage("1", nil)))
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		assert.NoError(t, router.Close())
+	}()
+
+	select {
+	case <-commandsHandled:
+		t.Fatal("commands handler started before the projection was ready")
+	case <-time.After(time.Millisecond * 100):
+		// ok
+	}
+
+	close(projectionReady)
+
+	select {
+	case <-commandsHandled:
+		// ok
+	case <-time.After(time.Second):
+		t.Fatal("commands handler not started")
+	}
+
+	<-router.Running()
+}
+
+func TestHandler_ReadyWhenIdle(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{Persistent: true}, watermill.NopLogger{})
+
+	router, err := message.NewRouter(message.RouterConfig{
+		ReadinessCheckInterval: time.Millisecond * 10,
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	messagesCount := 10
+	for i := 0; i < messagesCount; i++ {
+		require.NoError(t, pubSub.Publish("events", message.NewMessage(fmt.Sprintf("%d", i), nil)))
+	}
+	require.NoError(t, pubSub.Publish("commands", message.NewMessage("1", nil)))
+
+	var lock sync.Mutex
+	eventsHandled := 0
+	router.AddNoPublisherHandler(
+		"projection",
+		"events",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) {
+			time.Sleep(time.Millisecond * 5)
+
+			lock.Lock()
+			defer lock.Unlock()
+			eventsHandled++
+
+			return nil, nil
+		},
+	).ReadyWhenIdle(time.Millisecond * 50)
+
+	eventsHandledBeforeCommand := make(chan int, 1)
+	router.AddNoPublisherHandler(
+		"commands",
+		"commands",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			eventsHandledBeforeCommand <- eventsHandled
+
+			return nil, nil
+		},
+	).StartAfter("projection")
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		assert.NoError(t, router.Close())
+	}()
+
+	select {
+	case handled := <-eventsHandledBeforeCommand:
+		assert.Equal(t, messagesCount, handled)
+	case <-time.After(time.Second * 5):
+		t.Fatal("commands handler not started")
+	}
+}
+
+func TestHandler_StartAfter_invalid(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Dependencies  map[string][]string
+		ExpectedError string
+	}{
+		{
+			Name:          "unknown_handler",
+			Dependencies:  map[string][]string{"a": {"unknown"}},
+			ExpectedError: "handler a starts after unknown handler unknown",
+		},
+		{
+			Name:          "cycle",
+			Dependencies:  map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+			ExpectedError: "dependency cycle: [a b c a]",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+
+			router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+			require.NoError(t, err)
+
+			for name, dependencies := range tc.Dependencies {
+				router.AddNoPublisherHandler(
+					name,
+					"topic",
+					pubSub,
+					func(msg *message.Message) ([]*message.Message, error) { return nil, nil },
+				).StartAfter(dependencies...)
+			}
+
+			err = router.Run()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.ExpectedError)
+		})
+	}
+}
+
+func TestHandler_StartWhen_timeout(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+
+	router, err := message.NewRouter(message.RouterConfig{
+		StartupTimeout:         time.Millisecond * 50,
+		ReadinessCheckInterval: time.Millisecond * 10,
+	}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	router.AddNoPublisherHandler(
+		"first",
+		"topic",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) { return nil, nil },
+	)
+	router.AddNoPublisherHandler(
+		"second",
+		"topic",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) { return nil, nil },
+	).StartWhen(func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+
+	err = router.Run()
+	assert.Equal(t, message.ErrStartupTimeout, errors.Cause(err))
+}
+
+func TestRouter_SendTo(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	router.AddHandler(
+		"handler",
+		"topic",
+		newNoAckWaitSubscriber([]*message.Message{message.NewMessage("1", nil)}),
+		"default_topic",
+		pubSub,
+		func(msg *message.Message) ([]*message.Message, error) {
+			return []*message.Message{
+				message.SendTo("orders", message.NewMessage("order", nil)),
+				message.SendTo("emails", message.NewMessage("email", nil)),
+				message.NewMessage("default", nil),
+			}, nil
+		},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	expectedTopics := map[string]string{
+		"orders":        "order",
+		"emails":        "email",
+		"default_topic": "default",
+	}
+	received := map[string]<-chan *message.Message{}
+	for topic := range expectedTopics {
+		messages, err := pubSub.Subscribe(ctx, topic)
+		require.NoError(t, err)
+		received[topic] = messages
+	}
+
+	go func() {
+		require.NoError(t, router.Run())
+	}()
+	defer func() {
+		assert.NoError(t, router.Close())
+	}()
+
+	for topic, expectedUUID := range expectedTopics {
+		select {
+		case msg := <-received[topic]:
+			assert.Equal(t, expectedUUID, msg.UUID)
+			assert.Empty(t, msg.Metadata.Get(message.DestinationTopicMetadataKey))
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatalf("message not received from %s", topic)
+		}
+	}
+}
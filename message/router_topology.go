@@ -0,0 +1,59 @@
+package message
+
+import (
+	"sort"
+
+	"github.com/ThreeDotsLabs/watermill/internal"
+)
+
+// HandlerInfo describes a handler added to the Router.
+type HandlerInfo struct {
+	Name string
+
+	SubscribeTopic string
+	// SubscriberName is the type name of the handler's Subscriber (or its String(), when it implements fmt.Stringer).
+	SubscriberName string
+
+	// PublishTopic is empty for handlers added with AddNoPublisherHandler
+	// and for handlers publishing only to topics chosen with SendTo.
+	PublishTopic string
+	// PublisherName is the type name of the handler's Publisher (or its String(), when it implements fmt.Stringer).
+	// It is empty for handlers added with AddNoPublisherHandler.
+	PublisherName string
+}
+
+// HasPublisher returns true, when the handler can publish messages.
+func (i HandlerInfo) HasPublisher() bool {
+	return i.PublisherName != ""
+}
+
+var disabledPublisherName = internal.StructName(disabledPublisher{})
+
+// Handlers returns descriptions of all handlers added to the Router, sorted by name.
+//
+// It allows generating the documentation or architecture diagrams from the routing code.
+func (r *Router) Handlers() []HandlerInfo {
+	handlers := make([]HandlerInfo, 0, len(r.handlers))
+
+	for _, h := range r.handlers {
+		info := HandlerInfo{
+			Name:           h.name,
+			SubscribeTopic: h.subscribeTopic,
+			SubscriberName: h.subscriberName,
+		}
+
+		// h.publisher may be already decorated, so the name of the original publisher is checked
+		if h.publisherName != disabledPublisherName {
+			info.PublishTopic = h.publishTopic
+			info.PublisherName = h.publisherName
+		}
+
+		handlers = append(handlers, info)
+	}
+
+	sort.Slice(handlers, func(i, j int) bool {
+		return handlers[i].Name < handlers[j].Name
+	})
+
+	return handlers
+}
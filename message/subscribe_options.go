@@ -0,0 +1,84 @@
+package message
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ErrSubscribeOptionsNotSupported happens when subscribe options are passed to a Subscriber,
+// which doesn't implement OptionsSubscriber.
+var ErrSubscribeOptionsNotSupported = errors.New("subscriber doesn't support subscribe options")
+
+// StartPosition determines from which messages a new subscription starts consuming.
+type StartPosition int
+
+const (
+	// StartPositionDefault uses the start position configured in the subscriber.
+	StartPositionDefault StartPosition = iota
+	// StartPositionNewest starts consuming from messages published after subscribing.
+	StartPositionNewest
+	// StartPositionOldest starts consuming from the oldest available message.
+	StartPositionOldest
+)
+
+// SubscribeOptions are settings of a single subscription, overriding the subscriber's config.
+// Empty values mean that the subscriber's config is used.
+type SubscribeOptions struct {
+	// ConsumerGroup overrides the consumer group of the subscriber.
+	// Depending on the Pub/Sub, it is mapped to the consumer group, the queue group or the subscription name.
+	ConsumerGroup string
+
+	// StartPosition overrides the position from which the subscription starts consuming,
+	// when there is no committed offset for the consumer group yet.
+	StartPosition StartPosition
+}
+
+type SubscribeOption func(*SubscribeOptions)
+
+// WithConsumerGroup overrides the consumer group of the subscription.
+func WithConsumerGroup(consumerGroup string) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.ConsumerGroup = consumerGroup
+	}
+}
+
+// WithStartPosition overrides the start position of the subscription.
+func WithStartPosition(position StartPosition) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.StartPosition = position
+	}
+}
+
+// NewSubscribeOptions applies opts to empty SubscribeOptions.
+func NewSubscribeOptions(opts ...SubscribeOption) SubscribeOptions {
+	options := SubscribeOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+type OptionsSubscriber interface {
+	// SubscribeWithOptions works like Subscribe, but the subscription's settings can be overridden with opts.
+	//
+	// Implementations should return an error for options which are not supported by the Pub/Sub.
+	SubscribeWithOptions(ctx context.Context, topic string, opts ...SubscribeOption) (<-chan *Message, error)
+}
+
+// Subscribe subscribes to the topic with the options.
+//
+// When the subscriber doesn't implement OptionsSubscriber, it falls back to Subscribe,
+// but only if no options were provided. In other case ErrSubscribeOptionsNotSupported is returned.
+func Subscribe(ctx context.Context, sub Subscriber, topic string, opts ...SubscribeOption) (<-chan *Message, error) {
+	if optionsSubscriber, ok := sub.(OptionsSubscriber); ok {
+		return optionsSubscriber.SubscribeWithOptions(ctx, topic, opts...)
+	}
+
+	if len(opts) > 0 {
+		return nil, ErrSubscribeOptionsNotSupported
+	}
+
+	return sub.Subscribe(ctx, topic)
+}
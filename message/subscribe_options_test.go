@@ -0,0 +1,32 @@
+package message_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func TestSubscribe_options_not_supported(t *testing.T) {
+	sub := benchMockSubscriber{}
+
+	_, err := message.Subscribe(context.Background(), sub, "topic", message.WithConsumerGroup("group"))
+	assert.Equal(t, message.ErrSubscribeOptionsNotSupported, err)
+
+	_, err = message.Subscribe(context.Background(), sub, "topic")
+	assert.NoError(t, err)
+}
+
+func TestNewSubscribeOptions(t *testing.T) {
+	options := message.NewSubscribeOptions(
+		message.WithConsumerGroup("group"),
+		message.WithStartPosition(message.StartPositionOldest),
+	)
+
+	assert.Equal(t, message.SubscribeOptions{
+		ConsumerGroup: "group",
+		StartPosition: message.StartPositionOldest,
+	}, options)
+}
@@ -0,0 +1,98 @@
+package message
+
+import (
+	"context"
+	"sync"
+)
+
+// MessagePredicate decides if the message should be passed to the handler.
+type MessagePredicate func(msg *Message) bool
+
+// MetadataEquals returns MessagePredicate matching messages with the metadata key set to one of the values.
+func MetadataEquals(key string, values ...string) MessagePredicate {
+	return func(msg *Message) bool {
+		value := msg.Metadata.Get(key)
+		for _, v := range values {
+			if value == v {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterSubscriber returns the Subscriber, which passes only messages matching the predicate.
+// Other messages are acked and dropped, before they reach the handler.
+//
+// It allows to consume a topic carrying many types of events, with every handler receiving only the events
+// it's interested in, without invoking it for the other ones.
+func FilterSubscriber(sub Subscriber, predicate MessagePredicate) Subscriber {
+	if predicate == nil {
+		panic("predicate is nil")
+	}
+
+	return &filterSubscriber{
+		sub:       sub,
+		predicate: predicate,
+		closing:   make(chan struct{}),
+	}
+}
+
+// FilterSubscriberDecorator creates a subscriber decorator, which wraps the subscriber with FilterSubscriber.
+func FilterSubscriberDecorator(predicate MessagePredicate) SubscriberDecorator {
+	if predicate == nil {
+		panic("predicate is nil")
+	}
+	return func(sub Subscriber) (Subscriber, error) {
+		return FilterSubscriber(sub, predicate), nil
+	}
+}
+
+type filterSubscriber struct {
+	sub       Subscriber
+	predicate MessagePredicate
+
+	subscribeWg sync.WaitGroup
+	closing     chan struct{}
+	closeOnce   sync.Once
+}
+
+func (f *filterSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *Message, error) {
+	in, err := f.sub.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *Message)
+	f.subscribeWg.Add(1)
+	go func() {
+		defer f.subscribeWg.Done()
+		defer close(out)
+
+		for msg := range in {
+			if !f.predicate(msg) {
+				msg.Ack()
+				continue
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				// the message is not acked, so it will be redelivered to the next subscription
+				return
+			case <-f.closing:
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (f *filterSubscriber) Close() error {
+	f.closeOnce.Do(func() { close(f.closing) })
+	err := f.sub.Close()
+
+	f.subscribeWg.Wait()
+	return err
+}
@@ -0,0 +1,81 @@
+package message_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func newTypedMessage(uuid string, eventType string) *message.Message {
+	msg := message.NewMessage(uuid, nil)
+	msg.Metadata.Set("type", eventType)
+	return msg
+}
+
+func TestFilterSubscriber(t *testing.T) {
+	messagesToSend := []*message.Message{
+		newTypedMessage("1", "OrderPlaced"),
+		newTypedMessage("2", "OrderShipped"),
+		newTypedMessage("3", "PaymentReceived"),
+		newTypedMessage("4", "OrderPlaced"),
+	}
+
+	sub := message.FilterSubscriber(
+		newNoAckWaitSubscriber(messagesToSend),
+		message.MetadataEquals("type", "OrderPlaced", "PaymentReceived"),
+	)
+	defer func() {
+		assert.NoError(t, sub.Close())
+	}()
+
+	messages, err := sub.Subscribe(context.Background(), "events")
+	require.NoError(t, err)
+
+	var received []string
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-messages:
+			received = append(received, msg.UUID)
+			msg.Ack()
+		case <-time.After(time.Second):
+			t.Fatal("message not received")
+		}
+	}
+
+	assert.Equal(t, []string{"1", "3", "4"}, received)
+
+	select {
+	case <-messagesToSend[1].Acked():
+		// ok
+	default:
+		t.Fatal("filtered out message should be acked")
+	}
+}
+
+func TestFilterSubscriberDecorator(t *testing.T) {
+	decorated, err := message.FilterSubscriberDecorator(func(msg *message.Message) bool {
+		return string(msg.Payload) != "skip"
+	})(newNoAckWaitSubscriber([]*message.Message{
+		message.NewMessage("1", []byte("skip")),
+		message.NewMessage("2", []byte("handle")),
+	}))
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, decorated.Close())
+	}()
+
+	messages, err := decorated.Subscribe(context.Background(), "events")
+	require.NoError(t, err)
+
+	select {
+	case msg := <-messages:
+		assert.Equal(t, "2", msg.UUID)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+}
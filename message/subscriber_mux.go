@@ -0,0 +1,451 @@
+package message
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// DefaultMuxTopicMetadataKey is the default metadata key with the logical topic of the message.
+const DefaultMuxTopicMetadataKey = "mux_topic"
+
+// ErrSubscriberMuxClosed is returned when Subscribe is called on the closed SubscriberMux.
+var ErrSubscriberMuxClosed = errors.New("subscriber mux is closed")
+
+type SubscriberMuxConfig struct {
+	// Topic is the broker's topic consumed by the single underlying subscription. Required.
+	Topic string
+
+	// Topics are the logical topics expected to be subscribed.
+	// When set, the underlying subscription is created after all of them are subscribed,
+	// so messages of handlers subscribing later (like handlers added to the Router one by one)
+	// are not lost. Messages of logical topics not listed in Topics are acked and dropped.
+	//
+	// When empty, the underlying subscription is created with the first Subscribe call
+	// and messages of logical topics without subscription are nacked.
+	Topics []string
+
+	// TopicMetadataKey is the metadata key with the logical topic of the message.
+	// DefaultMuxTopicMetadataKey is used when empty.
+	TopicMetadataKey string
+
+	// TopicFunc is optional and returns the logical topic of the message, instead of TopicMetadataKey.
+	// It may be used with subscribers consuming multiple broker's topics at once.
+	TopicFunc func(msg *Message) string
+}
+
+func (c *SubscriberMuxConfig) setDefaults() {
+	if c.TopicMetadataKey == "" {
+		c.TopicMetadataKey = DefaultMuxTopicMetadataKey
+	}
+	if c.TopicFunc == nil {
+		key := c.TopicMetadataKey
+		c.TopicFunc = func(msg *Message) string {
+			return msg.Metadata.Get(key)
+		}
+	}
+}
+
+func (c SubscriberMuxConfig) Validate() error {
+	if c.Topic == "" {
+		return errors.New("missing Topic")
+	}
+
+	return nil
+}
+
+// SubscriberMux shares one subscription of the underlying Subscriber between many logical topics.
+// Every message is delivered to the subscription of its logical topic, so one consumer
+// (and one consumer group) can serve all handlers of the router.
+//
+// Messages published with MuxPublisher have the logical topic stored in the metadata.
+// Messages of a logical topic without subscription are nacked, unless the topic is not one
+// of SubscriberMuxConfig.Topics.
+//
+// Every logical topic has its own dispatcher, so when the underlying Subscriber delivers
+// the next message without waiting for the ack of the previous one, a slow handler of one topic
+// doesn't stall other topics. Subscribers waiting for the ack before delivering the next message
+// (like Kafka or GoChannel) still handle messages of all logical topics one by one.
+// Messages of the same logical topic are delivered one by one, in the order in which they were received.
+//
+// SubscriberMux may be passed as the subscriber of many handlers. The underlying Subscriber is closed
+// with the first Close call.
+type SubscriberMux struct {
+	sub    Subscriber
+	config SubscriberMuxConfig
+	logger watermill.LoggerAdapter
+
+	// expectedTopics is nil, when SubscriberMuxConfig.Topics is empty
+	expectedTopics map[string]struct{}
+
+	subscriptions     map[string][]*muxSubscription
+	subscriptionsLock sync.RWMutex
+
+	dispatchers     map[string]*muxDispatcher
+	dispatchersLock sync.Mutex
+
+	started   bool
+	closing   chan struct{}
+	closed    bool
+	closeLock sync.Mutex
+	wg        sync.WaitGroup
+}
+
+func NewSubscriberMux(sub Subscriber, config SubscriberMuxConfig, logger watermill.LoggerAdapter) (*SubscriberMux, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid SubscriberMux config")
+	}
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	var expectedTopics map[string]struct{}
+	if len(config.Topics) > 0 {
+		expectedTopics = make(map[string]struct{}, len(config.Topics))
+		for _, topic := range config.Topics {
+			expectedTopics[topic] = struct{}{}
+		}
+	}
+
+	return &SubscriberMux{
+		sub:            sub,
+		config:         config,
+		logger:         logger,
+		expectedTopics: expectedTopics,
+		subscriptions:  map[string][]*muxSubscription{},
+		dispatchers:    map[string]*muxDispatcher{},
+		closing:        make(chan struct{}),
+	}, nil
+}
+
+// Subscribe returns the channel with messages of the logical topic.
+// The underlying subscription is created with the Subscribe call of the last of SubscriberMuxConfig.Topics,
+// or with the first Subscribe call when Topics are empty.
+func (m *SubscriberMux) Subscribe(ctx context.Context, topic string) (<-chan *Message, error) {
+	m.closeLock.Lock()
+	defer m.closeLock.Unlock()
+
+	if m.closed {
+		return nil, ErrSubscriberMuxClosed
+	}
+
+	sub := &muxSubscription{
+		output: make(chan *Message),
+		done:   make(chan struct{}),
+	}
+
+	m.subscriptionsLock.Lock()
+	m.subscriptions[topic] = append(m.subscriptions[topic], sub)
+	m.subscriptionsLock.Unlock()
+
+	if !m.started && m.allTopicsSubscribed() {
+		if err := m.start(); err != nil {
+			m.removeSubscription(topic, sub)
+			return nil, err
+		}
+		m.started = true
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		select {
+		case <-ctx.Done():
+		case <-m.closing:
+		}
+
+		m.removeSubscription(topic, sub)
+	}()
+
+	return sub.output, nil
+}
+
+func (m *SubscriberMux) allTopicsSubscribed() bool {
+	for topic := range m.expectedTopics {
+		if !m.hasSubscriptions(topic) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *SubscriberMux) start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := m.sub.Subscribe(ctx, m.config.Topic)
+	if err != nil {
+		cancel()
+		return errors.Wrapf(err, "cannot subscribe to %s", m.config.Topic)
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				m.dispatch(msg)
+			case <-m.closing:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// dispatch passes the message to the dispatcher of its logical topic, without waiting for the ack.
+// The number of queued messages is limited by the underlying Subscriber, as messages are acked
+// only after they are handled.
+func (m *SubscriberMux) dispatch(msg *Message) {
+	topic := m.config.TopicFunc(msg)
+
+	if !m.hasSubscriptions(topic) {
+		m.handleNotSubscribed(topic, msg)
+		return
+	}
+
+	m.dispatchersLock.Lock()
+	d, ok := m.dispatchers[topic]
+	if !ok {
+		d = &muxDispatcher{pending: make(chan struct{}, 1)}
+		m.dispatchers[topic] = d
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.runDispatcher(topic, d)
+		}()
+	}
+	m.dispatchersLock.Unlock()
+
+	d.push(msg)
+}
+
+func (m *SubscriberMux) runDispatcher(topic string, d *muxDispatcher) {
+	for {
+		select {
+		case <-d.pending:
+		case <-m.closing:
+			// queued messages are not acked, so they are redelivered by the underlying Subscriber
+			return
+		}
+
+		for {
+			msg, ok := d.pop()
+			if !ok {
+				break
+			}
+			m.route(topic, msg)
+		}
+	}
+}
+
+func (m *SubscriberMux) hasSubscriptions(topic string) bool {
+	m.subscriptionsLock.RLock()
+	defer m.subscriptionsLock.RUnlock()
+
+	return len(m.subscriptions[topic]) > 0
+}
+
+// handleNotSubscribed nacks the message of the logical topic without subscription, so it is redelivered
+// when the topic is subscribed again. Messages of topics which are not expected are acked and dropped.
+func (m *SubscriberMux) handleNotSubscribed(topic string, msg *Message) {
+	logFields := watermill.LogFields{"message_uuid": msg.UUID, "mux_topic": topic}
+
+	if m.expectedTopics != nil {
+		if _, expected := m.expectedTopics[topic]; !expected {
+			m.logger.Info("Message's topic is not expected, acking", logFields)
+			msg.Ack()
+			return
+		}
+	}
+
+	m.logger.Info("No subscription for the message's topic, nacking", logFields)
+	msg.Nack()
+}
+
+func (m *SubscriberMux) route(topic string, msg *Message) {
+	m.subscriptionsLock.RLock()
+	subscriptions := append([]*muxSubscription(nil), m.subscriptions[topic]...)
+	m.subscriptionsLock.RUnlock()
+
+	if len(subscriptions) == 0 {
+		m.handleNotSubscribed(topic, msg)
+		return
+	}
+
+	for i, sub := range subscriptions {
+		msgToSend := msg
+		if i > 0 {
+			// every subscription of the same topic gets its own copy, like in the case of gochannel
+			msgToSend = msg.Copy()
+			msgToSend.SetContext(msg.Context())
+		}
+
+		if !sub.send(msgToSend, m.closing) {
+			msg.Nack()
+			return
+		}
+
+		select {
+		case <-msgToSend.Acked():
+		case <-msgToSend.Nacked():
+			msg.Nack()
+			return
+		case <-sub.done:
+			msg.Nack()
+			return
+		case <-m.closing:
+			return
+		}
+	}
+
+	msg.Ack()
+}
+
+func (m *SubscriberMux) removeSubscription(topic string, sub *muxSubscription) {
+	m.subscriptionsLock.Lock()
+	subscriptions := m.subscriptions[topic]
+	for i, s := range subscriptions {
+		if s == sub {
+			m.subscriptions[topic] = append(subscriptions[:i:i], subscriptions[i+1:]...)
+			break
+		}
+	}
+	if len(m.subscriptions[topic]) == 0 {
+		delete(m.subscriptions, topic)
+	}
+	m.subscriptionsLock.Unlock()
+
+	sub.close()
+}
+
+// muxDispatcher is the queue of messages of one logical topic.
+type muxDispatcher struct {
+	queue     []*Message
+	queueLock sync.Mutex
+
+	// pending signals that messages were pushed to the queue
+	pending chan struct{}
+}
+
+func (d *muxDispatcher) push(msg *Message) {
+	d.queueLock.Lock()
+	d.queue = append(d.queue, msg)
+	d.queueLock.Unlock()
+
+	select {
+	case d.pending <- struct{}{}:
+	default:
+		// the dispatcher is already signaled
+	}
+}
+
+func (d *muxDispatcher) pop() (*Message, bool) {
+	d.queueLock.Lock()
+	defer d.queueLock.Unlock()
+
+	if len(d.queue) == 0 {
+		return nil, false
+	}
+
+	msg := d.queue[0]
+	d.queue[0] = nil
+	d.queue = d.queue[1:]
+
+	return msg, true
+}
+
+type muxSubscription struct {
+	output chan *Message
+
+	done     chan struct{}
+	sendLock sync.Mutex
+}
+
+// send returns false, when the message was not sent, because the subscription or the mux is closed.
+func (s *muxSubscription) send(msg *Message, closing chan struct{}) bool {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.output <- msg:
+		return true
+	case <-s.done:
+		return false
+	case <-closing:
+		return false
+	}
+}
+
+func (s *muxSubscription) close() {
+	close(s.done)
+
+	// waiting for the pending send, so the output is not closed during sending
+	s.sendLock.Lock()
+	close(s.output)
+	s.sendLock.Unlock()
+}
+
+// Close closes all subscriptions and the underlying Subscriber.
+func (m *SubscriberMux) Close() error {
+	m.closeLock.Lock()
+	if m.closed {
+		m.closeLock.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.closing)
+	m.closeLock.Unlock()
+
+	err := m.sub.Close()
+	m.wg.Wait()
+
+	return err
+}
+
+// MuxPublisher publishes messages of all logical topics to the single topic consumed by SubscriberMux.
+type MuxPublisher struct {
+	pub    Publisher
+	config SubscriberMuxConfig
+}
+
+// NewMuxPublisher creates MuxPublisher. The logical topic is stored under config.TopicMetadataKey.
+func NewMuxPublisher(pub Publisher, config SubscriberMuxConfig) (*MuxPublisher, error) {
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid SubscriberMux config")
+	}
+
+	return &MuxPublisher{pub: pub, config: config}, nil
+}
+
+func (p *MuxPublisher) Publish(topic string, messages ...*Message) error {
+	for _, msg := range messages {
+		msg.Metadata.Set(p.config.TopicMetadataKey, topic)
+	}
+
+	return p.pub.Publish(p.config.Topic, messages...)
+}
+
+func (p *MuxPublisher) Close() error {
+	return p.pub.Close()
+}
@@ -0,0 +1,257 @@
+package message_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/gochannel"
+)
+
+func newMux(t *testing.T, topics ...string) (*message.MuxPublisher, *message.SubscriberMux) {
+	pubSub := gochannel.NewGoChannel(
+		gochannel.Config{Persistent: true},
+		watermill.NopLogger{},
+	)
+
+	config := message.SubscriberMuxConfig{Topic: "shared", Topics: topics}
+
+	pub, err := message.NewMuxPublisher(pubSub, config)
+	require.NoError(t, err)
+
+	mux, err := message.NewSubscriberMux(pubSub, config, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	return pub, mux
+}
+
+func receiveMessage(t *testing.T, messages <-chan *message.Message) *message.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second * 5):
+		t.Fatal("message not received")
+		return nil
+	}
+}
+
+func TestSubscriberMux(t *testing.T) {
+	pub, mux := newMux(t, "orders", "payments")
+	defer func() {
+		require.NoError(t, mux.Close())
+	}()
+
+	ordersMessages, err := mux.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	paymentsMessages, err := mux.Subscribe(context.Background(), "payments")
+	require.NoError(t, err)
+
+	// GoChannel doesn't guarantee the order of messages, so they are published one by one
+	require.NoError(t, pub.Publish("orders", message.NewMessage("order", nil)))
+
+	msg := receiveMessage(t, ordersMessages)
+	assert.Equal(t, "order", msg.UUID)
+	assert.Equal(t, "orders", msg.Metadata.Get(message.DefaultMuxTopicMetadataKey))
+	msg.Ack()
+
+	require.NoError(t, pub.Publish("unknown", message.NewMessage("unknown", nil)))
+	require.NoError(t, pub.Publish("payments", message.NewMessage("payment", nil)))
+
+	// the message of the topic which is not expected is dropped
+	msg = receiveMessage(t, paymentsMessages)
+	assert.Equal(t, "payment", msg.UUID)
+	msg.Ack()
+}
+
+// concurrentSubscriber delivers the next message without waiting for the ack of the previous one,
+// like Google Cloud Pub/Sub or Kafka with many partitions.
+type concurrentSubscriber struct {
+	messages chan *message.Message
+}
+
+func (s concurrentSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	return s.messages, nil
+}
+
+func (s concurrentSubscriber) Close() error {
+	return nil
+}
+
+func (s concurrentSubscriber) deliver(t *testing.T, msg *message.Message) {
+	select {
+	case s.messages <- msg:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("message %s not consumed", msg.UUID)
+	}
+}
+
+func TestSubscriberMux_slow_topic(t *testing.T) {
+	sub := concurrentSubscriber{messages: make(chan *message.Message)}
+
+	mux, err := message.NewSubscriberMux(sub, message.SubscriberMuxConfig{Topic: "shared"}, watermill.NopLogger{})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, mux.Close())
+	}()
+
+	ordersMessages, err := mux.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	paymentsMessages, err := mux.Subscribe(context.Background(), "payments")
+	require.NoError(t, err)
+
+	order := message.NewMessage("order", nil)
+	order.Metadata.Set(message.DefaultMuxTopicMetadataKey, "orders")
+	sub.deliver(t, order)
+
+	slowMsg := receiveMessage(t, ordersMessages)
+
+	// the order is not acked yet, but it doesn't stall other topics
+	payment := message.NewMessage("payment", nil)
+	payment.Metadata.Set(message.DefaultMuxTopicMetadataKey, "payments")
+	sub.deliver(t, payment)
+
+	msg := receiveMessage(t, paymentsMessages)
+	assert.Equal(t, "payment", msg.UUID)
+	msg.Ack()
+
+	select {
+	case <-payment.Acked():
+	case <-time.After(time.Second * 5):
+		t.Fatal("payment not acked")
+	}
+
+	slowMsg.Ack()
+
+	select {
+	case <-order.Acked():
+	case <-time.After(time.Second * 5):
+		t.Fatal("order not acked")
+	}
+}
+
+func TestSubscriberMux_subscribe_after_publish(t *testing.T) {
+	pub, mux := newMux(t, "orders", "payments")
+	defer func() {
+		require.NoError(t, mux.Close())
+	}()
+
+	ordersMessages, err := mux.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	require.NoError(t, pub.Publish("payments", message.NewMessage("payment", nil)))
+	require.NoError(t, pub.Publish("orders", message.NewMessage("order", nil)))
+
+	// messages are not consumed until all topics are subscribed
+	select {
+	case msg := <-ordersMessages:
+		t.Fatalf("message %s received before all topics were subscribed", msg.UUID)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	paymentsMessages, err := mux.Subscribe(context.Background(), "payments")
+	require.NoError(t, err)
+
+	// GoChannel doesn't guarantee the order of stored messages
+	received := map[string]string{}
+	for len(received) < 2 {
+		select {
+		case msg := <-ordersMessages:
+			received["orders"] = msg.UUID
+			msg.Ack()
+		case msg := <-paymentsMessages:
+			received["payments"] = msg.UUID
+			msg.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("messages not received")
+		}
+	}
+
+	assert.Equal(t, map[string]string{"orders": "order", "payments": "payment"}, received)
+}
+
+func TestSubscriberMux_not_subscribed_topic(t *testing.T) {
+	sub := concurrentSubscriber{messages: make(chan *message.Message)}
+
+	mux, err := message.NewSubscriberMux(sub, message.SubscriberMuxConfig{Topic: "shared"}, watermill.NopLogger{})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, mux.Close())
+	}()
+
+	_, err = mux.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	payment := message.NewMessage("payment", nil)
+	payment.Metadata.Set(message.DefaultMuxTopicMetadataKey, "payments")
+	sub.deliver(t, payment)
+
+	select {
+	case <-payment.Nacked():
+	case <-payment.Acked():
+		t.Fatal("message of the topic without subscription should not be acked")
+	case <-time.After(time.Second * 5):
+		t.Fatal("payment not nacked")
+	}
+}
+
+func TestSubscriberMux_nack(t *testing.T) {
+	pub, mux := newMux(t, "orders")
+	defer func() {
+		require.NoError(t, mux.Close())
+	}()
+
+	messages, err := mux.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	require.NoError(t, pub.Publish("orders", message.NewMessage("order", nil)))
+
+	msg := receiveMessage(t, messages)
+	msg.Nack()
+
+	msg = receiveMessage(t, messages)
+	assert.Equal(t, "order", msg.UUID, "nacked message should be redelivered")
+	msg.Ack()
+}
+
+func TestSubscriberMux_unsubscribe(t *testing.T) {
+	_, mux := newMux(t, "orders")
+	defer func() {
+		require.NoError(t, mux.Close())
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := mux.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	cancel()
+
+	select {
+	case _, ok := <-messages:
+		assert.False(t, ok, "channel should be closed")
+	case <-time.After(time.Second * 5):
+		t.Fatal("channel not closed")
+	}
+}
+
+func TestSubscriberMux_Close(t *testing.T) {
+	_, mux := newMux(t, "orders")
+
+	messages, err := mux.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	require.NoError(t, mux.Close())
+	require.NoError(t, mux.Close())
+
+	_, ok := <-messages
+	assert.False(t, ok)
+
+	_, err = mux.Subscribe(context.Background(), "orders")
+	assert.Equal(t, message.ErrSubscriberMuxClosed, err)
+}
@@ -0,0 +1,160 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Maximum message sizes of the brokers, which can be used with MaxPayloadSize.
+const (
+	// KafkaDefaultMaxMessageBytes is the default `message.max.bytes` of the Kafka broker.
+	KafkaDefaultMaxMessageBytes = 1000012
+	// GoogleCloudPubSubMaxMessageBytes is the maximum size of the Google Cloud Pub/Sub message.
+	GoogleCloudPubSubMaxMessageBytes = 10 * 1024 * 1024
+	// NatsDefaultMaxPayloadBytes is the default `max_payload` of the NATS server.
+	NatsDefaultMaxPayloadBytes = 1024 * 1024
+)
+
+// MessageValidator validates the message before it's published to the topic.
+type MessageValidator func(topic string, msg *Message) error
+
+// MaxPayloadSize returns MessageValidator which rejects messages with the payload larger than maxBytes.
+func MaxPayloadSize(maxBytes int) MessageValidator {
+	return func(topic string, msg *Message) error {
+		if len(msg.Payload) > maxBytes {
+			return errors.Errorf("payload size %d exceeds the limit of %d bytes", len(msg.Payload), maxBytes)
+		}
+		return nil
+	}
+}
+
+// RequiredMetadata returns MessageValidator which rejects messages without any of the metadata keys.
+func RequiredMetadata(keys ...string) MessageValidator {
+	return func(topic string, msg *Message) error {
+		var missing []string
+		for _, key := range keys {
+			if msg.Metadata.Get(key) == "" {
+				missing = append(missing, key)
+			}
+		}
+
+		if len(missing) > 0 {
+			return errors.Errorf("missing metadata: %s", strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+// ValidUTF8Payload is MessageValidator which rejects messages with the payload which is not valid UTF-8.
+// It is useful for text formats, like JSON.
+func ValidUTF8Payload(topic string, msg *Message) error {
+	if !utf8.Valid(msg.Payload) {
+		return errors.New("payload is not valid UTF-8")
+	}
+	return nil
+}
+
+// ValidUTF8Metadata is MessageValidator which rejects messages with metadata keys or values
+// which are not valid UTF-8.
+func ValidUTF8Metadata(topic string, msg *Message) error {
+	for k, v := range msg.Metadata {
+		if !utf8.ValidString(k) || !utf8.ValidString(v) {
+			return errors.Errorf("metadata %q is not valid UTF-8", k)
+		}
+	}
+	return nil
+}
+
+// InvalidMessage describes a message rejected by ValidatingPublisher.
+type InvalidMessage struct {
+	// Index is the index of the message in the published batch.
+	Index       int
+	MessageUUID string
+	Err         error
+}
+
+// ValidationError is returned by ValidatingPublisher, when any of the published messages is invalid.
+// It contains errors of all invalid messages of the batch.
+type ValidationError struct {
+	Topic           string
+	InvalidMessages []InvalidMessage
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.InvalidMessages))
+	for _, invalid := range e.InvalidMessages {
+		msgs = append(msgs, fmt.Sprintf("message %s (%d): %s", invalid.MessageUUID, invalid.Index, invalid.Err))
+	}
+
+	return fmt.Sprintf(
+		"%d invalid messages published to %s: %s",
+		len(e.InvalidMessages), e.Topic, strings.Join(msgs, "; "),
+	)
+}
+
+// ValidatingPublisher validates messages before they are published with the decorated Publisher.
+//
+// When any message of the batch is invalid, no messages are published and *ValidationError is returned.
+type ValidatingPublisher struct {
+	pub        Publisher
+	validators []MessageValidator
+}
+
+func NewValidatingPublisher(pub Publisher, validators ...MessageValidator) *ValidatingPublisher {
+	return &ValidatingPublisher{pub: pub, validators: validators}
+}
+
+// ValidatingPublisherDecorator creates a publisher decorator, which validates messages with validators.
+func ValidatingPublisherDecorator(validators ...MessageValidator) PublisherDecorator {
+	return func(pub Publisher) (Publisher, error) {
+		return NewValidatingPublisher(pub, validators...), nil
+	}
+}
+
+// Validate checks the messages with all validators.
+// It returns *ValidationError, when any of messages is invalid.
+func (p *ValidatingPublisher) Validate(topic string, messages ...*Message) error {
+	var invalidMessages []InvalidMessage
+
+	for i, msg := range messages {
+		for _, validator := range p.validators {
+			if err := validator(topic, msg); err != nil {
+				invalidMessages = append(invalidMessages, InvalidMessage{
+					Index:       i,
+					MessageUUID: msg.UUID,
+					Err:         err,
+				})
+			}
+		}
+	}
+
+	if len(invalidMessages) > 0 {
+		return &ValidationError{Topic: topic, InvalidMessages: invalidMessages}
+	}
+
+	return nil
+}
+
+func (p *ValidatingPublisher) Publish(topic string, messages ...*Message) error {
+	if err := p.Validate(topic, messages...); err != nil {
+		return err
+	}
+
+	return p.pub.Publish(topic, messages...)
+}
+
+// PublishWithResults validates messages and publishes them with PublishWithResults of the decorated Publisher.
+func (p *ValidatingPublisher) PublishWithResults(topic string, messages ...*Message) ([]PublishResult, error) {
+	if err := p.Validate(topic, messages...); err != nil {
+		return nil, err
+	}
+
+	return PublishWithResults(p.pub, topic, messages...)
+}
+
+func (p *ValidatingPublisher) Close() error {
+	return p.pub.Close()
+}
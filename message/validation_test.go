@@ -0,0 +1,57 @@
+package message_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func TestValidatingPublisher(t *testing.T) {
+	pub := &mockPublisher{message.Messages{}}
+	validatingPub := message.NewValidatingPublisher(
+		pub,
+		message.MaxPayloadSize(5),
+		message.RequiredMetadata("tenant_id"),
+		message.ValidUTF8Payload,
+	)
+
+	validMsg := message.NewMessage("1", []byte("valid"))
+	validMsg.Metadata.Set("tenant_id", "1")
+
+	require.NoError(t, validatingPub.Publish("topic", validMsg))
+	assert.Len(t, pub.published, 1)
+
+	tooLargeMsg := message.NewMessage("2", []byte("too large"))
+	tooLargeMsg.Metadata.Set("tenant_id", "1")
+
+	invalidUTF8Msg := message.NewMessage("3", []byte{0xff})
+
+	err := validatingPub.Publish("topic", validMsg, tooLargeMsg, invalidUTF8Msg)
+	require.Error(t, err)
+	assert.Len(t, pub.published, 1, "no messages should be published, when any message is invalid")
+
+	validationErr, ok := err.(*message.ValidationError)
+	require.True(t, ok)
+	assert.Equal(t, "topic", validationErr.Topic)
+
+	var invalidUUIDs []string
+	for _, invalid := range validationErr.InvalidMessages {
+		invalidUUIDs = append(invalidUUIDs, invalid.MessageUUID)
+	}
+	assert.Equal(t, []string{"2", "3", "3"}, invalidUUIDs)
+}
+
+func TestValidatingPublisherDecorator_results(t *testing.T) {
+	decorated, err := message.ValidatingPublisherDecorator(message.MaxPayloadSize(10))(resultsMockPublisher{})
+	require.NoError(t, err)
+
+	results, err := message.PublishWithResults(decorated, "topic", message.NewMessage("1", nil))
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	_, err = message.PublishWithResults(decorated, "topic", message.NewMessage("2", make([]byte, 11)))
+	assert.IsType(t, &message.ValidationError{}, err)
+}
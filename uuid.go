@@ -2,12 +2,18 @@ package watermill
 
 import (
 	"crypto/rand"
+	"fmt"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 	"github.com/oklog/ulid"
 	"github.com/renstrom/shortuuid"
 )
 
+// UUIDGenerator generates unique IDs, for example of messages.
+// It must be safe for concurrent use.
+type UUIDGenerator func() string
+
 func NewUUID() string {
 	return uuid.New().String()
 }
@@ -19,3 +25,46 @@ func NewShortUUID() string {
 func NewULID() string {
 	return ulid.MustNew(ulid.Now(), rand.Reader).String()
 }
+
+// NewUUIDv7 returns the time-ordered UUID version 7.
+// UUIDs generated later are sorted after the earlier ones, so they work well as keys of ordered indexes.
+func NewUUIDv7() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// NewSequentialUUIDGenerator returns UUIDGenerator generating IDs with the prefix and the increasing sequence number,
+// for example "prefix-00000000000000000001". IDs are unique only within the returned generator,
+// so it's useful mostly in tests and for debugging.
+func NewSequentialUUIDGenerator(prefix string) UUIDGenerator {
+	var sequence uint64
+
+	return func() string {
+		return fmt.Sprintf("%s-%020d", prefix, atomic.AddUint64(&sequence, 1))
+	}
+}
+
+var messageUUIDGenerator atomic.Value
+
+func init() {
+	messageUUIDGenerator.Store(UUIDGenerator(NewUUID))
+}
+
+// SetMessageUUIDGenerator sets the generator used by NewMessageUUID, for example to NewULID or NewUUIDv7.
+// It should be called before any message is created, usually in main.
+func SetMessageUUIDGenerator(generator UUIDGenerator) {
+	if generator == nil {
+		panic("generator is nil")
+	}
+
+	messageUUIDGenerator.Store(generator)
+}
+
+// NewMessageUUID returns the new UUID of the message generated with the generator set by SetMessageUUIDGenerator.
+// NewUUID is used by default.
+//
+// It's used by message.NewMessageWithGeneratedUUID, the CQRS marshalers and the default unmarshalers of adapters
+// receiving messages without the UUID (like HTTP, Kafka and Google Cloud Pub/Sub). Adapters keep the UUIDs
+// of messages published by Watermill. To generate UUIDs per publisher, use message.GenerateMissingUUIDs.
+func NewMessageUUID() string {
+	return messageUUIDGenerator.Load().(UUIDGenerator)()
+}
@@ -55,3 +55,38 @@ func TestShortUUID(t *testing.T) {
 func TestULID(t *testing.T) {
 	testuUniqness(t, watermill.NewULID)
 }
+
+func TestUUIDv7(t *testing.T) {
+	testuUniqness(t, watermill.NewUUIDv7)
+}
+
+func TestUUIDv7_time_ordered(t *testing.T) {
+	previous := watermill.NewUUIDv7()
+	for i := 0; i < 1000; i++ {
+		next := watermill.NewUUIDv7()
+		if next <= previous {
+			t.Fatalf("%s is not sorted after %s", next, previous)
+		}
+		previous = next
+	}
+}
+
+func TestSequentialUUIDGenerator(t *testing.T) {
+	generator := watermill.NewSequentialUUIDGenerator("test")
+
+	if id := generator(); id != "test-00000000000000000001" {
+		t.Fatalf("unexpected id %s", id)
+	}
+
+	testuUniqness(t, generator)
+}
+
+func TestSetMessageUUIDGenerator(t *testing.T) {
+	defer watermill.SetMessageUUIDGenerator(watermill.NewUUID)
+
+	watermill.SetMessageUUIDGenerator(watermill.NewSequentialUUIDGenerator("msg"))
+
+	if id := watermill.NewMessageUUID(); id != "msg-00000000000000000001" {
+		t.Fatalf("unexpected id %s", id)
+	}
+}